@@ -0,0 +1,236 @@
+// Package alarms evaluates alarm conditions on tag values.
+//
+// Values are fed to an Engine with Update, typically from the loop that reads the PLC,
+// and alarm transitions are reported as Events to a handler.
+package alarms
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ConditionType selects how an alarm limit is evaluated
+type ConditionType int
+
+const (
+	ConditionHigh         ConditionType = iota // Active while value > Limit
+	ConditionLow                               // Active while value < Limit
+	ConditionBitSet                            // Active while value != 0
+	ConditionRateOfChange                      // Active while |change per second| > Limit
+)
+
+// Definition describes a single alarm
+type Definition struct {
+	Name       string
+	Tag        string
+	Condition  ConditionType
+	Limit      float64
+	Hysteresis float64       // Distance the value must move back past Limit before the alarm clears
+	Debounce   time.Duration // Time a transition must persist before it is reported
+}
+
+// EventType is the kind of alarm transition
+type EventType int
+
+const (
+	EventActive EventType = iota
+	EventCleared
+	EventAcknowledged
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventActive:
+		return "ACTIVE"
+	case EventCleared:
+		return "CLEARED"
+	case EventAcknowledged:
+		return "ACKNOWLEDGED"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", int(t))
+	}
+}
+
+// Event is emitted on every alarm transition
+type Event struct {
+	Alarm     string
+	Tag       string
+	Type      EventType
+	Value     float64
+	Timestamp time.Time
+}
+
+type alarmState struct {
+	def          Definition
+	active       bool
+	acknowledged bool
+	pendingSince time.Time // Start of an unreported transition, zero if none
+	lastValue    float64
+	lastTime     time.Time
+	hasLast      bool
+}
+
+// Engine evaluates alarm definitions against incoming values
+type Engine struct {
+	sync.Mutex
+	alarms  map[string]*alarmState
+	byTag   map[string][]*alarmState
+	handler func(Event)
+}
+
+// NewEngine creates an Engine reporting events to handler.
+// The handler is called synchronously from Update and Acknowledge.
+func NewEngine(handler func(Event)) *Engine {
+	return &Engine{
+		alarms:  make(map[string]*alarmState),
+		byTag:   make(map[string][]*alarmState),
+		handler: handler,
+	}
+}
+
+// Add registers an alarm definition
+func (e *Engine) Add(d Definition) error {
+	if d.Name == "" || d.Tag == "" {
+		return fmt.Errorf("alarm name and tag are required")
+	}
+	if d.Hysteresis < 0 || d.Debounce < 0 {
+		return fmt.Errorf("alarm %s: hysteresis and debounce must not be negative", d.Name)
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	if _, exists := e.alarms[d.Name]; exists {
+		return fmt.Errorf("alarm %s already defined", d.Name)
+	}
+	s := &alarmState{def: d, acknowledged: true}
+	e.alarms[d.Name] = s
+	e.byTag[d.Tag] = append(e.byTag[d.Tag], s)
+	return nil
+}
+
+// Update evaluates all alarms on tag with a new value
+func (e *Engine) Update(tag string, value float64, ts time.Time) {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	var events []Event
+	e.Lock()
+	for _, s := range e.byTag[tag] {
+		if ev, ok := s.evaluate(value, ts); ok {
+			events = append(events, ev)
+		}
+	}
+	e.Unlock()
+
+	e.emit(events)
+}
+
+// Acknowledge acknowledges an active or unacknowledged alarm
+func (e *Engine) Acknowledge(name string) error {
+	e.Lock()
+	s, ok := e.alarms[name]
+	if !ok {
+		e.Unlock()
+		return fmt.Errorf("unknown alarm: %s", name)
+	}
+	if s.acknowledged {
+		e.Unlock()
+		return fmt.Errorf("alarm %s has nothing to acknowledge", name)
+	}
+	s.acknowledged = true
+	ev := Event{Alarm: name, Tag: s.def.Tag, Type: EventAcknowledged, Value: s.lastValue, Timestamp: time.Now()}
+	e.Unlock()
+
+	e.emit([]Event{ev})
+	return nil
+}
+
+// Active returns the names of all active alarms, sorted
+func (e *Engine) Active() []string {
+	e.Lock()
+	defer e.Unlock()
+
+	var names []string
+	for name, s := range e.alarms {
+		if s.active {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (e *Engine) emit(events []Event) {
+	if e.handler == nil {
+		return
+	}
+	for _, ev := range events {
+		e.handler(ev)
+	}
+}
+
+// evaluate updates the state with a new value and returns an event on a reported transition
+func (s *alarmState) evaluate(value float64, ts time.Time) (Event, bool) {
+	wanted := s.wantActive(value, ts)
+	s.lastValue = value
+	s.lastTime = ts
+	s.hasLast = true
+
+	if wanted == s.active {
+		s.pendingSince = time.Time{}
+		return Event{}, false
+	}
+
+	if s.pendingSince.IsZero() {
+		s.pendingSince = ts
+	}
+	if ts.Sub(s.pendingSince) < s.def.Debounce {
+		return Event{}, false
+	}
+
+	s.pendingSince = time.Time{}
+	s.active = wanted
+	ev := Event{Alarm: s.def.Name, Tag: s.def.Tag, Value: value, Timestamp: ts}
+	if wanted {
+		s.acknowledged = false
+		ev.Type = EventActive
+	} else {
+		ev.Type = EventCleared
+	}
+	return ev, true
+}
+
+// wantActive returns whether the condition holds, applying hysteresis when already active
+func (s *alarmState) wantActive(value float64, ts time.Time) bool {
+	d := s.def
+	switch d.Condition {
+	case ConditionHigh:
+		if s.active {
+			return value >= d.Limit-d.Hysteresis
+		}
+		return value > d.Limit
+	case ConditionLow:
+		if s.active {
+			return value <= d.Limit+d.Hysteresis
+		}
+		return value < d.Limit
+	case ConditionBitSet:
+		return value != 0
+	case ConditionRateOfChange:
+		if !s.hasLast || !ts.After(s.lastTime) {
+			return s.active
+		}
+		rate := math.Abs(value-s.lastValue) / ts.Sub(s.lastTime).Seconds()
+		if s.active {
+			return rate >= d.Limit-d.Hysteresis
+		}
+		return rate > d.Limit
+	default:
+		return false
+	}
+}
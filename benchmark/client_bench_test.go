@@ -0,0 +1,205 @@
+// Package benchmark contains performance benchmarks of the FINS client against the simulator.
+//
+// Run with `make bench`, baseline numbers are kept in README.md in this directory.
+package benchmark
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"folke99/gofins/fins"
+	"folke99/gofins/mapping"
+	"folke99/gofins/simulator"
+)
+
+func TestMain(m *testing.M) {
+	// Both the client and the simulator log per request, which would dominate the timings
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func setupBenchmark(b *testing.B) (*fins.Client, *simulator.Server, func()) {
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	c, err := newClient(s)
+	if err != nil {
+		s.Close()
+		b.Fatal(err)
+	}
+
+	return c, s, func() {
+		c.Close()
+		s.Close()
+	}
+}
+
+func newClient(s *simulator.Server) (*fins.Client, error) {
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return fins.NewClient(clientAddr, plcAddr)
+}
+
+func BenchmarkReadWords(b *testing.B) {
+	c, _, cleanup := setupBenchmark(b)
+	defer cleanup()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.ReadWords(mapping.MemoryAreaDMWord, 100, 10); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadWordsInto(b *testing.B) {
+	c, _, cleanup := setupBenchmark(b)
+	defer cleanup()
+
+	dst := make([]uint16, 10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.ReadWordsInto(mapping.MemoryAreaDMWord, 100, dst); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReadWordsPipelined issues reads from many goroutines on one connection
+func BenchmarkReadWordsPipelined(b *testing.B) {
+	c, _, cleanup := setupBenchmark(b)
+	defer cleanup()
+
+	b.ReportAllocs()
+	b.SetParallelism(8)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		dst := make([]uint16, 10)
+		for pb.Next() {
+			if err := c.ReadWordsInto(mapping.MemoryAreaDMWord, 100, dst); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkBulkRead reads the largest block a single read may transfer
+func BenchmarkBulkRead(b *testing.B) {
+	c, _, cleanup := setupBenchmark(b)
+	defer cleanup()
+
+	dst := make([]uint16, c.TransferLimit(mapping.MemoryAreaDMWord).Read)
+	b.SetBytes(int64(2 * len(dst)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.ReadWordsInto(mapping.MemoryAreaDMWord, 0, dst); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSnapshotDM streams the whole simulated DM area in chunks
+func BenchmarkSnapshotDM(b *testing.B) {
+	c, _, cleanup := setupBenchmark(b)
+	defer cleanup()
+
+	b.SetBytes(2 * simulator.DM_AREA_SIZE)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.SnapshotArea(io.Discard, mapping.MemoryAreaDMWord, 0, simulator.DM_AREA_SIZE, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkConnectStorm measures many clients dialing and handshaking at once,
+// as happens when a fleet of clients reconnects after an outage
+func BenchmarkConnectStorm(b *testing.B) {
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close()
+
+	b.ReportAllocs()
+	b.SetParallelism(4)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c, err := newClient(s)
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			c.Close()
+		}
+	})
+}
+
+// allocBudgets are the allocations per operation of the request path, client and simulator
+// together, as in the baseline of README.md. A change allocating more fails
+// TestAllocationBudgets; when the increase is intended, raise the budget with the baseline.
+var allocBudgets = map[string]float64{
+	"ReadWords":     25,
+	"ReadWordsInto": 24,
+	"BulkRead":      25,
+}
+
+func TestAllocationBudgets(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector adds allocations of its own")
+	}
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c, err := newClient(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	small := make([]uint16, 10)
+	bulk := make([]uint16, c.TransferLimit(mapping.MemoryAreaDMWord).Read)
+	ops := map[string]func() error{
+		"ReadWords": func() error {
+			_, err := c.ReadWords(mapping.MemoryAreaDMWord, 100, 10)
+			return err
+		},
+		"ReadWordsInto": func() error { return c.ReadWordsInto(mapping.MemoryAreaDMWord, 100, small) },
+		"BulkRead":      func() error { return c.ReadWordsInto(mapping.MemoryAreaDMWord, 0, bulk) },
+	}
+	for name, op := range ops {
+		t.Run(name, func(t *testing.T) {
+			var opErr error
+			allocs := testing.AllocsPerRun(200, func() {
+				if err := op(); err != nil {
+					opErr = err
+				}
+			})
+			if opErr != nil {
+				t.Fatal(opErr)
+			}
+			if allocs > allocBudgets[name] {
+				t.Errorf("%.1f allocs/op, the budget is %.0f", allocs, allocBudgets[name])
+			}
+			t.Logf("%.1f allocs/op", allocs)
+		})
+	}
+}
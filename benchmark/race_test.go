@@ -0,0 +1,6 @@
+//go:build race
+
+package benchmark
+
+// raceEnabled reports whether the tests run under the race detector, which allocates
+const raceEnabled = true
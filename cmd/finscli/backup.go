@@ -0,0 +1,253 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"folke99/gofins/fins"
+)
+
+const (
+	BACKUP_PREFIX       = "backup-"
+	BACKUP_TIME_LAYOUT  = "20060102-150405"
+	BACKUP_PARTIAL      = ".partial" // Suffix of the directory collecting an unfinished backup
+	BACKUP_PART         = ".part"    // Suffix of a file still being downloaded
+	BACKUP_MANIFEST     = "manifest.json"
+	BACKUP_PROGRAM_FILE = "program.bin"
+)
+
+// manifest describes the contents of a backup archive
+type manifest struct {
+	PLC     string          `json:"plc"`
+	Model   string          `json:"model,omitempty"`
+	Started time.Time       `json:"started"`
+	Done    time.Time       `json:"done"`
+	Program bool            `json:"program"`
+	Disk    *fins.DiskInfo  `json:"disk,omitempty"`
+	Files   []fins.FileInfo `json:"files,omitempty"`
+}
+
+// backup downloads into a staging directory first, so an interrupted backup can be resumed
+type backup struct {
+	client     *fins.Client
+	dir        string
+	retries    int
+	retryDelay time.Duration
+}
+
+// runBackup dumps the user program and the memory card files to a timestamped archive
+func runBackup(args []string) error {
+	flags, cfg, err := newFlagSet("backup")
+	if err != nil {
+		return err
+	}
+	out := flags.String("out", ".", "directory of the backup archives")
+	program := flags.Bool("program", true, "back up the user program")
+	disk := flags.String("disk", "card", "file memory to back up: card, em or none")
+	resume := flags.Bool("resume", false, "continue the latest unfinished backup in -out")
+	retries := flags.Int("retries", 5, "attempts per file on a flaky link")
+	retryDelay := flags.Duration("retry-delay", 2*time.Second, "wait between attempts")
+	flags.Parse(args)
+
+	var fileDisk fins.FileDisk
+	if *disk != "none" {
+		if fileDisk, err = parseDisk(*disk); err != nil {
+			return fmt.Errorf("%w or none", err)
+		}
+	}
+
+	dir, started, err := stagingDir(*out, *resume)
+	if err != nil {
+		return err
+	}
+
+	c, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	b := backup{client: c, dir: dir, retries: max(*retries, 1), retryDelay: *retryDelay}
+	m := manifest{PLC: cfg.Address, Started: started, Program: *program}
+	if m.Model, err = c.ReadCPUUnitModel(); err != nil {
+		log.Printf("Failed to read the CPU unit model: %v", err)
+	}
+
+	if *program {
+		log.Printf("Backing up the user program")
+		err := b.fetch(BACKUP_PROGRAM_FILE, func(w io.Writer, offset int64) (int64, error) {
+			return c.DownloadProgram(w, uint32(offset))
+		})
+		if err != nil {
+			return fmt.Errorf("program backup failed, continue with -resume: %w", err)
+		}
+	}
+
+	if fileDisk != 0 {
+		info, files, err := c.ReadFileNames(fileDisk, "")
+		if err != nil {
+			return fmt.Errorf("failed to list the files of %s: %w", *disk, err)
+		}
+		m.Disk, m.Files = &info, files
+		for _, f := range files {
+			log.Printf("Backing up %s (%d bytes)", f.Name, f.Size)
+			err := b.fetch(filepath.Join(*disk, f.Name), func(w io.Writer, offset int64) (int64, error) {
+				return c.DownloadFile(w, fileDisk, "", f.Name, uint32(offset), nil)
+			})
+			if err != nil {
+				return fmt.Errorf("backup of %s failed, continue with -resume: %w", f.Name, err)
+			}
+		}
+	}
+
+	m.Done = time.Now()
+	if err := writeManifest(filepath.Join(dir, BACKUP_MANIFEST), m); err != nil {
+		return err
+	}
+	archive := strings.TrimSuffix(dir, BACKUP_PARTIAL) + ".tar.gz"
+	if err := writeArchive(archive, dir); err != nil {
+		return err
+	}
+	log.Printf("Backup written to %s", archive)
+	return os.RemoveAll(dir)
+}
+
+// stagingDir returns the directory collecting the backup and the time the backup started,
+// the latest unfinished one with resume
+func stagingDir(out string, resume bool) (string, time.Time, error) {
+	if resume {
+		dirs, err := filepath.Glob(filepath.Join(out, BACKUP_PREFIX+"*"+BACKUP_PARTIAL))
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		if len(dirs) == 0 {
+			return "", time.Time{}, fmt.Errorf("no unfinished backup in %s", out)
+		}
+		sort.Strings(dirs)
+		dir := dirs[len(dirs)-1]
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(dir), BACKUP_PREFIX), BACKUP_PARTIAL)
+		started, err := time.ParseInLocation(BACKUP_TIME_LAYOUT, stamp, time.Local)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("invalid backup directory %s: %w", dir, err)
+		}
+		log.Printf("Resuming %s", dir)
+		return dir, started, nil
+	}
+
+	started := time.Now()
+	dir := filepath.Join(out, BACKUP_PREFIX+started.Format(BACKUP_TIME_LAYOUT)+BACKUP_PARTIAL)
+	return dir, started, os.MkdirAll(dir, 0o755)
+}
+
+// fetch downloads name into the staging directory. The data is appended to a part file,
+// which is renamed once complete; every attempt continues where the previous one stopped.
+func (b backup) fetch(name string, download func(w io.Writer, offset int64) (int64, error)) error {
+	path := filepath.Join(b.dir, name)
+	if _, err := os.Stat(path); err == nil {
+		log.Printf("%s is complete", name)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path+BACKUP_PART, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	offset := st.Size()
+	for attempt := 1; ; attempt++ {
+		n, err := download(f, offset)
+		offset += n
+		if err == nil {
+			break
+		}
+		if attempt == b.retries {
+			return err
+		}
+		log.Printf("Attempt %d failed at byte %d: %v, retrying in %v", attempt, offset, err, b.retryDelay)
+		time.Sleep(b.retryDelay)
+		if err := b.client.Reconnect(); err != nil {
+			log.Printf("Reconnect failed: %v", err)
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+BACKUP_PART, path)
+}
+
+func writeManifest(path string, m manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// writeArchive packs the files of dir into a gzip compressed tar archive
+func writeArchive(path, dir string) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"folke99/gofins/config"
+	"folke99/gofins/fins"
+)
+
+const (
+	PROGRESS_WIDTH    = 30                     // Characters of the progress bar
+	PROGRESS_INTERVAL = 100 * time.Millisecond // Shortest time between progress bar updates
+)
+
+// fileFlags are the flags shared by the file memory commands
+type fileFlags struct {
+	disk *string
+	dir  *string
+}
+
+func newFileFlagSet(name string) (*flag.FlagSet, *config.PLC, fileFlags, error) {
+	fs, cfg, err := newFlagSet(name)
+	if err != nil {
+		return nil, nil, fileFlags{}, err
+	}
+	f := fileFlags{
+		disk: fs.String("disk", "card", "file memory: card or em"),
+		dir:  fs.String("dir", `\`, `directory on the file memory, \ for the root`),
+	}
+	return fs, cfg, f, nil
+}
+
+// parseDisk returns the file memory named card or em
+func parseDisk(name string) (fins.FileDisk, error) {
+	switch name {
+	case "card":
+		return fins.DiskMemoryCard, nil
+	case "em":
+		return fins.DiskEMFileMemory, nil
+	default:
+		return 0, fmt.Errorf("invalid -disk %q, expected card or em", name)
+	}
+}
+
+// runLs lists the files of a directory of the file memory
+func runLs(args []string) error {
+	fs, cfg, ff, err := newFileFlagSet("ls")
+	if err != nil {
+		return err
+	}
+	fs.Parse(args)
+	disk, err := parseDisk(*ff.disk)
+	if err != nil {
+		return err
+	}
+
+	c, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	info, files, err := c.ReadFileNames(disk, *ff.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", *ff.dir, err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, f := range files {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t\n", f.Size, f.Modified.Format("2006-01-02 15:04"), f.Name)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	log.Printf("%s: %d files, %d of %d bytes free", info.Label, info.Files, info.Free, info.Capacity)
+	return nil
+}
+
+// runGet downloads files of the file memory to a local directory
+func runGet(args []string) error {
+	fs, cfg, ff, err := newFileFlagSet("get")
+	if err != nil {
+		return err
+	}
+	out := fs.String("out", ".", "local directory of the downloaded files")
+	quiet := fs.Bool("quiet", false, "don't show progress")
+	fs.Parse(args)
+	disk, err := parseDisk(*ff.disk)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: finscli get [flags] FILE...")
+	}
+
+	c, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for _, name := range fs.Args() {
+		path := filepath.Join(*out, name)
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		bar := newProgressBar(name, *quiet)
+		_, err = c.DownloadFile(f, disk, *ff.dir, name, 0, bar.update)
+		bar.done(err)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(path)
+			return err
+		}
+	}
+	return nil
+}
+
+// runPut uploads a local file to the file memory
+func runPut(args []string) error {
+	fs, cfg, ff, err := newFileFlagSet("put")
+	if err != nil {
+		return err
+	}
+	quiet := fs.Bool("quiet", false, "don't show progress")
+	fs.Parse(args)
+	disk, err := parseDisk(*ff.disk)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return fmt.Errorf("usage: finscli put [flags] LOCAL [NAME]")
+	}
+	local := fs.Arg(0)
+	name := strings.ToUpper(filepath.Base(local))
+	if fs.NArg() == 2 {
+		name = fs.Arg(1)
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	c, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	bar := newProgressBar(name, *quiet)
+	_, err = c.UploadFile(f, disk, *ff.dir, name, 0, int(st.Size()), bar.update)
+	bar.done(err)
+	return err
+}
+
+// progressBar draws the progress of a transfer on stderr
+type progressBar struct {
+	name    string
+	quiet   bool
+	started time.Time
+	drawn   time.Time
+	bytes   int
+}
+
+func newProgressBar(name string, quiet bool) *progressBar {
+	return &progressBar{name: name, quiet: quiet, started: time.Now()}
+}
+
+// update is the fins.ProgressFunc of the transfer
+func (p *progressBar) update(done, total int) {
+	p.bytes = done
+	if p.quiet || (time.Since(p.drawn) < PROGRESS_INTERVAL && done < total) {
+		return
+	}
+	p.drawn = time.Now()
+	filled := PROGRESS_WIDTH
+	percent := 100
+	if total > 0 {
+		filled = min(done*PROGRESS_WIDTH/total, PROGRESS_WIDTH)
+		percent = min(done*100/total, 100)
+	}
+	fmt.Fprintf(os.Stderr, "\r%-12s [%s%s] %3d%% %d/%d bytes", p.name,
+		strings.Repeat("#", filled), strings.Repeat(" ", PROGRESS_WIDTH-filled), percent, done, total)
+}
+
+// done ends the progress line and reports the outcome of the transfer
+func (p *progressBar) done(err error) {
+	if !p.quiet && !p.drawn.IsZero() {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		return
+	}
+	elapsed := time.Since(p.started)
+	log.Printf("%s: %d bytes in %v (%.1f kB/s)", p.name, p.bytes, elapsed.Round(time.Millisecond),
+		float64(p.bytes)/1000/max(elapsed.Seconds(), 0.001))
+}
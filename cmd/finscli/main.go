@@ -0,0 +1,83 @@
+// Command finscli runs commissioning and maintenance tasks against an Omron PLC. The
+// connection is configured by the FINS_* environment variables of the config package or
+// the matching flags, e.g.
+//
+//	FINS_ADDRESS=192.168.250.1 finscli write -file values.csv -report report.csv
+//	FINS_ADDRESS=192.168.250.1 finscli backup -out backups
+//	FINS_ADDRESS=192.168.250.1 finscli get -out logs DATA01.CSV DATA02.CSV
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"folke99/gofins/config"
+	"folke99/gofins/fins"
+)
+
+// command is a subcommand of finscli
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"backup": {"dump the user program and memory card files to a timestamped archive", runBackup},
+	"get":    {"download files from the memory card or EM file memory", runGet},
+	"ls":     {"list the files of the memory card or EM file memory", runLs},
+	"put":    {"upload a file to the memory card or EM file memory", runPut},
+	"write":  {"write values from a CSV sheet of address,value[,type] rows with verification", runWrite},
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: finscli <command> [flags]")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "Run finscli <command> -h for the flags of a command.")
+}
+
+// newFlagSet returns the flags of a command including the connection flags, which
+// override the environment
+func newFlagSet(name string) (*flag.FlagSet, *config.PLC, error) {
+	cfg := config.Default()
+	if err := cfg.LoadEnv(config.ENV_PREFIX); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	fs := flag.NewFlagSet("finscli "+name, flag.ExitOnError)
+	cfg.RegisterFlags(fs, "")
+	return fs, &cfg, nil
+}
+
+func connect(cfg *config.PLC) (*fins.Client, error) {
+	c, err := cfg.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", cfg.Address, err)
+	}
+	return c, nil
+}
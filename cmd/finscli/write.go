@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"folke99/gofins/fins"
+)
+
+// runWrite writes the values of a batch sheet and reports the outcome of every row
+func runWrite(args []string) error {
+	fs, cfg, err := newFlagSet("write")
+	if err != nil {
+		return err
+	}
+	file := fs.String("file", "", "CSV sheet of address,value[,type] rows")
+	reportPath := fs.String("report", "", "write the report CSV to this file instead of stdout")
+	stopOnError := fs.Bool("stop-on-error", false, "skip the remaining rows after the first failure")
+	check := fs.Bool("check", false, "only validate the sheet, don't connect")
+	fs.Parse(args)
+	if *file == "" {
+		return fmt.Errorf("-file is required")
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	rows, err := fins.LoadBatchCSV(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", *file, err)
+	}
+	if *check {
+		log.Printf("%s: %d rows are valid", *file, len(rows))
+		return nil
+	}
+
+	c, err := connect(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	report, batchErr := c.WriteBatch(rows, *stopOnError)
+
+	var out io.Writer = os.Stdout
+	if *reportPath != "" {
+		rf, err := os.Create(*reportPath)
+		if err != nil {
+			return err
+		}
+		defer rf.Close()
+		out = rf
+	}
+	if err := report.WriteCSV(out); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	log.Printf("%d written, %d failed, %d skipped", report.Written, report.Failed, report.Skipped)
+	return batchErr
+}
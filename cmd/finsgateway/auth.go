@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Role is what the holder of an HTTP token may do
+type Role string
+
+const (
+	RoleReadOnly Role = "readOnly" // Reads values
+	RoleOperator Role = "operator" // Also writes tags, except those with writeRole admin
+	RoleAdmin    Role = "admin"    // Writes all tags
+)
+
+// errForbidden rejects a write the role of the token doesn't allow
+var errForbidden = errors.New("forbidden")
+
+// canWrite reports whether the role may write tags with writeRole
+func (r Role) canWrite(writeRole Role) bool {
+	switch r {
+	case RoleAdmin:
+		return true
+	case RoleOperator:
+		return writeRole != RoleAdmin
+	}
+	return false
+}
+
+// TokenConfig grants the holder of a bearer token a role on the HTTP output
+type TokenConfig struct {
+	Name  string `yaml:"name"` // Recorded in the audit trail of writes
+	Token string `yaml:"token"`
+	Role  Role   `yaml:"role"`
+}
+
+type identityKey struct{}
+
+// authenticator checks the bearer tokens of HTTP requests
+type authenticator struct {
+	tokens []TokenConfig
+	hashes [][sha256.Size]byte // Compared in constant time
+}
+
+func newAuthenticator(tokens []TokenConfig) *authenticator {
+	a := &authenticator{tokens: tokens}
+	for _, t := range tokens {
+		a.hashes = append(a.hashes, sha256.Sum256([]byte(t.Token)))
+	}
+	return a
+}
+
+// enabled is false without tokens, every request may read and write then
+func (a *authenticator) enabled() bool {
+	return len(a.tokens) > 0
+}
+
+// middleware rejects requests without a valid token and passes the identity of the token in
+// the request context. The token is sent as "Authorization: Bearer <token>", or as the
+// access_token query parameter by browsers opening a WebSocket.
+func (a *authenticator) middleware(next http.Handler) http.Handler {
+	if !a.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("access_token")
+		if h := r.Header.Get("Authorization"); h != "" {
+			token, _ = strings.CutPrefix(h, "Bearer ")
+		}
+		id := a.identify(token)
+		if id == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="finsgateway"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	})
+}
+
+func (a *authenticator) identify(token string) *TokenConfig {
+	if token == "" {
+		return nil
+	}
+	hash := sha256.Sum256([]byte(token))
+	var id *TokenConfig
+	for i := range a.hashes {
+		if subtle.ConstantTimeCompare(hash[:], a.hashes[i][:]) == 1 {
+			id = &a.tokens[i]
+		}
+	}
+	return id
+}
+
+// role returns the role of the token of r, admin when the gateway has no tokens
+func (a *authenticator) role(r *http.Request) Role {
+	if !a.enabled() {
+		return RoleAdmin
+	}
+	if id, ok := r.Context().Value(identityKey{}).(*TokenConfig); ok {
+		return id.Role
+	}
+	return RoleReadOnly
+}
+
+// auditContext returns the audit context of a write requested by r
+func auditContext(r *http.Request) map[string]string {
+	context := map[string]string{"remote": r.RemoteAddr}
+	if id, ok := r.Context().Value(identityKey{}).(*TokenConfig); ok {
+		context["user"] = id.Name
+	}
+	return context
+}
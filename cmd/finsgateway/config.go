@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	"folke99/gofins/fins"
+	"folke99/gofins/mapping"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the gateway configuration file
+type Config struct {
+	PLCs       []PLCConfig            `yaml:"plcs"`
+	Tags       map[string][]TagConfig `yaml:"tags"` // Tag table per PLC name
+	PollGroups []PollGroupConfig      `yaml:"pollGroups"`
+	Outputs    OutputsConfig          `yaml:"outputs"`
+}
+
+// PLCConfig describes the connection to one PLC
+type PLCConfig struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"`
+	Port    int    `yaml:"port"` // 9600 when zero
+	Network byte   `yaml:"network"`
+	Node    byte   `yaml:"node"`
+	Unit    byte   `yaml:"unit"`
+	// Local is the FINS address of the gateway on the PLC network
+	Local struct {
+		Address string `yaml:"address"` // 0.0.0.0 when empty
+		Port    int    `yaml:"port"`    // 9600 when zero
+		Network byte   `yaml:"network"`
+		Node    byte   `yaml:"node"`
+		Unit    byte   `yaml:"unit"`
+	} `yaml:"local"`
+	Timeout     time.Duration   `yaml:"timeout"` // Response timeout, the client default when zero
+	DialTimeout time.Duration   `yaml:"dialTimeout"`
+	ReadOnly    bool            `yaml:"readOnly"` // Reject writes from the outputs
+	Reconnect   ReconnectConfig `yaml:"reconnect"`
+	// MaxFrameSize is the largest FINS/TCP frame of the unit, the client default when zero
+	MaxFrameSize int `yaml:"maxFrameSize"`
+}
+
+// ReconnectConfig is the reconnect policy of a PLC. Without Initial the client default
+// schedule is used.
+type ReconnectConfig struct {
+	Initial     time.Duration `yaml:"initial"`
+	Max         time.Duration `yaml:"max"`
+	Multiplier  float64       `yaml:"multiplier"`
+	Jitter      float64       `yaml:"jitter"`
+	MaxAttempts int           `yaml:"maxAttempts"`
+	MaxElapsed  time.Duration `yaml:"maxElapsed"`
+}
+
+// TagConfig is a tag in Omron address notation, e.g. "D100" or "H10.03"
+type TagConfig struct {
+	Name      string `yaml:"name"`
+	Address   string `yaml:"address"`
+	Type      string `yaml:"type"` // BOOL, UINT, INT, UDINT, DINT, REAL or LREAL
+	WordOrder string `yaml:"wordOrder"`
+	Unit      string `yaml:"unit"` // Unit of the value for dashboards, e.g. °C
+	// WriteRole is the role needed to write the tag over HTTP or MQTT, operator or admin.
+	// Default value: operator
+	WriteRole Role `yaml:"writeRole"`
+	// Min and Max narrow the range of the data type in the OpenAPI document, writes outside
+	// them are rejected
+	Min *float64 `yaml:"min"`
+	Max *float64 `yaml:"max"`
+	// Deadband of the WebSocket subscriptions of the tag, e.g. {type: absolute, value: 0.5}
+	Deadband *fins.Deadband `yaml:"deadband"`
+}
+
+// PollGroupConfig reads tags of a PLC at a fixed interval
+type PollGroupConfig struct {
+	Name     string        `yaml:"name"`
+	PLC      string        `yaml:"plc"`
+	Interval time.Duration `yaml:"interval"`
+	Tags     []string      `yaml:"tags"` // All tags of the PLC when empty
+}
+
+type OutputsConfig struct {
+	MQTT      *MQTTConfig      `yaml:"mqtt"`
+	HTTP      *HTTPConfig      `yaml:"http"`
+	Sparkplug *SparkplugConfig `yaml:"sparkplug"`
+}
+
+// MQTTConfig publishes every polled value to Topic, where {plc} and {tag} are replaced
+type MQTTConfig struct {
+	Broker   string `yaml:"broker"` // e.g. tcp://localhost:1883
+	ClientID string `yaml:"clientID"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Topic    string `yaml:"topic"` // {plc}/{tag} when empty
+	QoS      byte   `yaml:"qos"`
+	Retain   bool   `yaml:"retain"`
+	// Discovery announces the tags to Home Assistant or similar dashboards when set
+	Discovery *DiscoveryConfig `yaml:"discovery"`
+}
+
+// DiscoveryConfig publishes retained MQTT discovery messages describing the tags. In the
+// homeassistant format BOOL tags become switches, or binary sensors of read-only PLCs, and
+// the other tags sensors. The json format publishes the tags of each PLC, with their types,
+// units and topics, to <prefix>/<plc>. Tags the command role may write are written from
+// <topic>/set, with the same range checks as the HTTP output.
+type DiscoveryConfig struct {
+	Format string `yaml:"format"` // homeassistant (the default) or json
+	Prefix string `yaml:"prefix"` // homeassistant, or finsgateway/discovery for json, when empty
+	NodeID string `yaml:"nodeID"` // Identifies the gateway in unique IDs, the client ID when empty
+	// CommandRole is the role of writes from command topics, readOnly when empty which
+	// disables the command topics. Anyone allowed to publish on the broker writes with it.
+	CommandRole Role `yaml:"commandRole"`
+}
+
+// commandRole returns the role of writes from command topics
+func (d *DiscoveryConfig) commandRole() Role {
+	if d == nil {
+		return RoleReadOnly
+	}
+	if d.CommandRole == "" {
+		return RoleReadOnly
+	}
+	return d.CommandRole
+}
+
+// HTTPConfig serves the latest values as JSON and live updates over WebSocket, and writes
+// tags over both
+type HTTPConfig struct {
+	Listen string `yaml:"listen"`
+	// Tokens admitted as bearer tokens, every client may read and write without them
+	Tokens []TokenConfig `yaml:"tokens"`
+}
+
+// SparkplugConfig publishes the PLCs as devices of a Sparkplug B edge node, with their tag
+// tables as metrics
+type SparkplugConfig struct {
+	Broker   string `yaml:"broker"`
+	ClientID string `yaml:"clientID"` // NodeID when empty
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	GroupID  string `yaml:"groupID"`
+	NodeID   string `yaml:"nodeID"`
+	// CommandRole is the role of DCMD writes, readOnly when empty. Anyone allowed to publish
+	// on the broker writes with it.
+	CommandRole Role `yaml:"commandRole"`
+}
+
+// commandRole returns the role of DCMD writes
+func (sp *SparkplugConfig) commandRole() Role {
+	if sp.CommandRole == "" {
+		return RoleReadOnly
+	}
+	return sp.CommandRole
+}
+
+// LoadConfig reads and validates a configuration file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+func (cfg *Config) validate() error {
+	if len(cfg.PLCs) == 0 {
+		return fmt.Errorf("no PLCs configured")
+	}
+	plcs := make(map[string]bool)
+	for _, p := range cfg.PLCs {
+		if p.Name == "" || p.Address == "" {
+			return fmt.Errorf("every PLC needs a name and an address")
+		}
+		if plcs[p.Name] {
+			return fmt.Errorf("duplicate PLC %q", p.Name)
+		}
+		plcs[p.Name] = true
+	}
+
+	for plc := range cfg.Tags {
+		if !plcs[plc] {
+			return fmt.Errorf("tags of unknown PLC %q", plc)
+		}
+		if _, err := cfg.TagTable(plc); err != nil {
+			return err
+		}
+	}
+
+	for _, g := range cfg.PollGroups {
+		if !plcs[g.PLC] {
+			return fmt.Errorf("poll group %q: unknown PLC %q", g.Name, g.PLC)
+		}
+		if g.Interval <= 0 {
+			return fmt.Errorf("poll group %q: interval must be positive", g.Name)
+		}
+		if _, err := cfg.groupTags(g); err != nil {
+			return fmt.Errorf("poll group %q: %w", g.Name, err)
+		}
+	}
+
+	if cfg.Outputs.MQTT != nil && cfg.Outputs.MQTT.Broker == "" {
+		return fmt.Errorf("mqtt output needs a broker")
+	}
+	if cfg.Outputs.MQTT != nil && cfg.Outputs.MQTT.Discovery != nil {
+		switch f := cfg.Outputs.MQTT.Discovery.Format; f {
+		case "", DISCOVERY_HOME_ASSISTANT, DISCOVERY_JSON:
+		default:
+			return fmt.Errorf("mqtt discovery: unknown format %q", f)
+		}
+		switch r := cfg.Outputs.MQTT.Discovery.CommandRole; r {
+		case "", RoleReadOnly, RoleOperator, RoleAdmin:
+		default:
+			return fmt.Errorf("mqtt discovery: invalid command role %q", r)
+		}
+	}
+	if cfg.Outputs.HTTP != nil && cfg.Outputs.HTTP.Listen == "" {
+		return fmt.Errorf("http output needs a listen address")
+	}
+	if cfg.Outputs.HTTP != nil {
+		if err := validateTokens(cfg.Outputs.HTTP.Tokens); err != nil {
+			return fmt.Errorf("http output: %w", err)
+		}
+	}
+	if sp := cfg.Outputs.Sparkplug; sp != nil && (sp.Broker == "" || sp.GroupID == "" || sp.NodeID == "") {
+		return fmt.Errorf("sparkplug output needs a broker, a group ID and a node ID")
+	}
+	if sp := cfg.Outputs.Sparkplug; sp != nil {
+		switch r := sp.CommandRole; r {
+		case "", RoleReadOnly, RoleOperator, RoleAdmin:
+		default:
+			return fmt.Errorf("sparkplug: invalid command role %q", r)
+		}
+	}
+	return nil
+}
+
+func validateTokens(tokens []TokenConfig) error {
+	seen := make(map[string]bool)
+	for _, t := range tokens {
+		if t.Name == "" || t.Token == "" {
+			return fmt.Errorf("every token needs a name and a token")
+		}
+		if t.Role != RoleReadOnly && t.Role != RoleOperator && t.Role != RoleAdmin {
+			return fmt.Errorf("token %s: invalid role %q", t.Name, t.Role)
+		}
+		if seen[t.Token] {
+			return fmt.Errorf("token %s: duplicate token", t.Name)
+		}
+		seen[t.Token] = true
+	}
+	return nil
+}
+
+// TagTable returns the tags of a PLC
+func (cfg *Config) TagTable(plc string) ([]fins.Tag, error) {
+	tags := make([]fins.Tag, 0, len(cfg.Tags[plc]))
+	for _, tc := range cfg.Tags[plc] {
+		area, address, bit, err := mapping.ParseAddress(tc.Address)
+		if err != nil {
+			return nil, fmt.Errorf("tag %s of %s: %w", tc.Name, plc, err)
+		}
+		t := fins.Tag{
+			Name:       tc.Name,
+			MemoryArea: area,
+			Address:    address,
+			DataType:   fins.DataType(tc.Type),
+			WordOrder:  fins.WordOrder(tc.WordOrder),
+			Deadband:   tc.Deadband,
+		}
+		if _, err := t.DataType.WordCount(); err != nil {
+			return nil, fmt.Errorf("tag %s of %s: %w", tc.Name, plc, err)
+		}
+		if t.WordOrder != fins.WordOrderLowFirst && t.WordOrder != fins.WordOrderHighFirst {
+			return nil, fmt.Errorf("tag %s of %s: invalid word order %q", tc.Name, plc, tc.WordOrder)
+		}
+		if tc.WriteRole != "" && tc.WriteRole != RoleOperator && tc.WriteRole != RoleAdmin {
+			return nil, fmt.Errorf("tag %s of %s: invalid write role %q", tc.Name, plc, tc.WriteRole)
+		}
+		if tc.Min != nil && tc.Max != nil && *tc.Min > *tc.Max {
+			return nil, fmt.Errorf("tag %s of %s: min is above max", tc.Name, plc)
+		}
+		if t.Deadband != nil {
+			if err := t.Deadband.Validate(); err != nil {
+				return nil, fmt.Errorf("tag %s of %s: %w", tc.Name, plc, err)
+			}
+		}
+		if t.DataType == fins.DataTypeBool {
+			if bit < 0 {
+				return nil, fmt.Errorf("tag %s of %s: BOOL needs a bit address", tc.Name, plc)
+			}
+			t.MemoryArea, _ = area.BitArea()
+			t.BitOffset = byte(bit)
+		} else if bit >= 0 {
+			return nil, fmt.Errorf("tag %s of %s: only BOOL tags have a bit address", tc.Name, plc)
+		}
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
+
+// writeRole returns the role needed to write the tag
+func (tc TagConfig) writeRole() Role {
+	if tc.WriteRole == "" {
+		return RoleOperator
+	}
+	return tc.WriteRole
+}
+
+// checkRange rejects values outside Min and Max
+func (tc TagConfig) checkRange(value float64) error {
+	if (tc.Min != nil && value < *tc.Min) || (tc.Max != nil && value > *tc.Max) {
+		return fmt.Errorf("value %v of %s %w", value, tc.Name, errOutOfRange)
+	}
+	return nil
+}
+
+func (cfg *Config) groupTags(g PollGroupConfig) ([]fins.Tag, error) {
+	table, err := cfg.TagTable(g.PLC)
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Tags) == 0 {
+		return table, nil
+	}
+	byName := make(map[string]fins.Tag, len(table))
+	for _, t := range table {
+		byName[t.Name] = t
+	}
+	tags := make([]fins.Tag, 0, len(g.Tags))
+	for _, name := range g.Tags {
+		t, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tag %q of %s", name, g.PLC)
+		}
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
+
+// clientOptions returns the client options of a PLC
+func (p PLCConfig) clientOptions() fins.Options {
+	opts := fins.Options{
+		DialTimeout:         p.DialTimeout,
+		ReconnectMaxElapsed: p.Reconnect.MaxElapsed,
+		MaxFrameSize:        p.MaxFrameSize,
+	}
+	if p.Reconnect.Initial > 0 {
+		opts.ReconnectBackoff = fins.ExponentialBackoff{
+			Initial:     p.Reconnect.Initial,
+			Max:         p.Reconnect.Max,
+			Multiplier:  p.Reconnect.Multiplier,
+			Jitter:      p.Reconnect.Jitter,
+			MaxAttempts: p.Reconnect.MaxAttempts,
+		}
+	}
+	if p.ReadOnly {
+		opts.WriteGuard = func(fins.MemoryWrite) error {
+			return fmt.Errorf("PLC %s is read-only", p.Name)
+		}
+	}
+	return opts
+}
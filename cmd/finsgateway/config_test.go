@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"folke99/gofins/fins"
+	"folke99/gofins/mapping"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadConfigString(t *testing.T, config string) (*Config, error) {
+	path := filepath.Join(t.TempDir(), "finsgateway.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o644))
+	return LoadConfig(path)
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig("example.yaml")
+	require.NoError(t, err, "the example configuration is valid")
+	require.Len(t, cfg.PLCs, 1)
+	assert.Equal(t, 2*time.Second, cfg.PLCs[0].Timeout)
+	require.Len(t, cfg.PollGroups, 2)
+	assert.Equal(t, 500*time.Millisecond, cfg.PollGroups[0].Interval)
+
+	tags, err := cfg.TagTable("kiln")
+	require.NoError(t, err)
+	require.Len(t, tags, 4)
+	assert.Equal(t, fins.Tag{Name: "batch", MemoryArea: mapping.MemoryAreaDMWord, Address: 110, DataType: fins.DataTypeUdint}, tags[2])
+	assert.Equal(t, mapping.MemoryAreaCIOBit, tags[3].MemoryArea, "BOOL tags read the bit area")
+	assert.Equal(t, byte(3), tags[3].BitOffset)
+
+	group, err := cfg.groupTags(cfg.PollGroups[0])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"temperature", "burnerOn"}, []string{group[0].Name, group[1].Name})
+
+	_, err = LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+	_, err = loadConfigString(t, "plcs: [")
+	assert.ErrorContains(t, err, "failed to parse")
+
+	const plc = "plcs: [{name: kiln, address: 127.0.0.1}]\n"
+	for _, tc := range []struct {
+		name, config, err string
+	}{
+		{"No PLCs", "tags: {}\n", "no PLCs configured"},
+		{"Unnamed PLC", "plcs: [{address: 127.0.0.1}]\n", "needs a name"},
+		{"Duplicate PLC", "plcs: [{name: kiln, address: a}, {name: kiln, address: b}]\n", "duplicate PLC"},
+		{"Tags Of Unknown PLC", plc + "tags: {oven: [{name: t, address: D0, type: INT}]}\n", "unknown PLC"},
+		{"Invalid Address", plc + "tags: {kiln: [{name: t, address: X0, type: INT}]}\n", "tag t of kiln"},
+		{"Invalid Type", plc + "tags: {kiln: [{name: t, address: D0, type: DECIMAL}]}\n", "tag t of kiln"},
+		{"Bool Without Bit", plc + "tags: {kiln: [{name: t, address: D0, type: BOOL}]}\n", "BOOL needs a bit address"},
+		{"Bit Of Word Tag", plc + "tags: {kiln: [{name: t, address: D0.01, type: INT}]}\n", "only BOOL tags"},
+		{"Invalid Write Role", plc + "tags: {kiln: [{name: t, address: D0, type: INT, writeRole: root}]}\n", "invalid write role"},
+		{"Inverted Range", plc + "tags: {kiln: [{name: t, address: D0, type: INT, min: 10, max: 1}]}\n", "min is above max"},
+		{"Poll Group Of Unknown PLC", plc + "pollGroups: [{name: g, plc: oven, interval: 1s}]\n", "unknown PLC"},
+		{"Poll Group Without Interval", plc + "pollGroups: [{name: g, plc: kiln}]\n", "interval must be positive"},
+		{"Poll Group Of Unknown Tag", plc + "pollGroups: [{name: g, plc: kiln, interval: 1s, tags: [t]}]\n", "unknown tag"},
+		{"MQTT Without Broker", plc + "outputs: {mqtt: {}}\n", "needs a broker"},
+		{"Unknown Discovery Format", plc + "outputs: {mqtt: {broker: tcp://b:1883, discovery: {format: xml}}}\n", "unknown format"},
+		{"Invalid Command Role", plc + "outputs: {mqtt: {broker: tcp://b:1883, discovery: {commandRole: root}}}\n", "invalid command role"},
+		{"HTTP Without Listen", plc + "outputs: {http: {}}\n", "needs a listen address"},
+		{"Invalid Token Role", plc + "outputs: {http: {listen: ':0', tokens: [{name: a, token: x, role: root}]}}\n", "invalid role"},
+		{"Duplicate Token", plc + "outputs: {http: {listen: ':0', tokens: [{name: a, token: x, role: admin}, {name: b, token: x, role: admin}]}}\n", "duplicate token"},
+		{"Incomplete Sparkplug", plc + "outputs: {sparkplug: {broker: tcp://b:1883}}\n", "sparkplug output needs"},
+		{"Invalid Sparkplug Command Role", plc + "outputs: {sparkplug: {broker: tcp://b:1883, groupID: g, nodeID: n, commandRole: root}}\n", "invalid command role"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadConfigString(t, tc.config)
+			assert.ErrorContains(t, err, "invalid configuration")
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
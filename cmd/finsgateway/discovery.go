@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"folke99/gofins/fins"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	DISCOVERY_HOME_ASSISTANT = "homeassistant"
+	DISCOVERY_JSON           = "json"
+	DEFAULT_DISCOVERY_JSON   = "finsgateway/discovery" // Prefix of the generic JSON format
+)
+
+var discoveryObjectID = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// DiscoveryTag is a tag announced by MQTT discovery
+type DiscoveryTag struct {
+	PLC      string
+	Tag      fins.Tag
+	Unit     string
+	Writable bool // Written through the command topic <topic>/set
+}
+
+// DiscoveryTags returns the tags of every PLC for MQTT discovery. Tags of PLCs accepting
+// writes are writable when the command role may write them.
+func (cfg *Config) DiscoveryTags() []DiscoveryTag {
+	var role Role = RoleReadOnly
+	if cfg.Outputs.MQTT != nil {
+		role = cfg.Outputs.MQTT.Discovery.commandRole()
+	}
+	var tags []DiscoveryTag
+	for _, p := range cfg.PLCs {
+		// Validated by LoadConfig
+		table, _ := cfg.TagTable(p.Name)
+		for i, t := range table {
+			tc := cfg.Tags[p.Name][i]
+			tags = append(tags, DiscoveryTag{
+				PLC:      p.Name,
+				Tag:      t,
+				Unit:     tc.Unit,
+				Writable: !p.ReadOnly && role.canWrite(tc.writeRole()),
+			})
+		}
+	}
+	return tags
+}
+
+// discoveryMessage is a retained discovery message
+type discoveryMessage struct {
+	topic   string
+	payload []byte
+}
+
+// haEntity is the discovery config of a Home Assistant MQTT entity
+type haEntity struct {
+	Name              string           `json:"name"`
+	UniqueID          string           `json:"unique_id"`
+	StateTopic        string           `json:"state_topic"`
+	ValueTemplate     string           `json:"value_template"`
+	CommandTopic      string           `json:"command_topic,omitempty"`
+	PayloadOn         string           `json:"payload_on,omitempty"`
+	PayloadOff        string           `json:"payload_off,omitempty"`
+	UnitOfMeasurement string           `json:"unit_of_measurement,omitempty"`
+	StateClass        string           `json:"state_class,omitempty"`
+	Availability      []haAvailability `json:"availability"`
+	Device            haDevice         `json:"device"`
+}
+
+type haAvailability struct {
+	Topic         string `json:"topic"`
+	ValueTemplate string `json:"value_template"`
+}
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+// jsonDiscovery is the discovery message of a PLC in the generic JSON format
+type jsonDiscovery struct {
+	PLC  string    `json:"plc"`
+	Tags []jsonTag `json:"tags"`
+}
+
+type jsonTag struct {
+	Name         string        `json:"name"`
+	DataType     fins.DataType `json:"dataType"`
+	Unit         string        `json:"unit,omitempty"`
+	Topic        string        `json:"topic"`
+	CommandTopic string        `json:"commandTopic,omitempty"`
+}
+
+// discoveryMessages returns the retained messages announcing the tags in the configured format
+func (o *MQTTOutput) discoveryMessages() ([]discoveryMessage, error) {
+	if o.cfg.Discovery.Format == DISCOVERY_JSON {
+		return o.jsonDiscovery()
+	}
+
+	prefix := o.discoveryPrefix()
+	node := o.discoveryNode()
+	var messages []discoveryMessage
+	for _, t := range o.tags {
+		topic := o.Topic(t.PLC, t.Tag.Name)
+		e := haEntity{
+			Name:              t.Tag.Name,
+			UniqueID:          node + "_" + t.PLC + "_" + t.Tag.Name,
+			StateTopic:        topic,
+			ValueTemplate:     "{{ value_json.value }}",
+			UnitOfMeasurement: t.Unit,
+			// A failed read makes the entity unavailable rather than showing a stale zero
+			Availability: []haAvailability{{Topic: topic, ValueTemplate: "{{ 'offline' if value_json.error is defined else 'online' }}"}},
+			Device: haDevice{
+				Identifiers:  []string{node + "_" + t.PLC},
+				Name:         t.PLC,
+				Manufacturer: "Omron",
+			},
+		}
+		component := "sensor"
+		switch {
+		case t.Tag.DataType == fins.DataTypeBool && t.Writable:
+			component = "switch"
+			e.ValueTemplate = "{{ 'ON' if value_json.value else 'OFF' }}"
+			e.CommandTopic, e.PayloadOn, e.PayloadOff = topic+"/set", "ON", "OFF"
+		case t.Tag.DataType == fins.DataTypeBool:
+			component = "binary_sensor"
+			e.ValueTemplate = "{{ 'ON' if value_json.value else 'OFF' }}"
+		default:
+			e.StateClass = "measurement"
+		}
+
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		objectID := discoveryObjectID.ReplaceAllString(t.PLC+"_"+t.Tag.Name, "_")
+		messages = append(messages, discoveryMessage{
+			topic:   fmt.Sprintf("%s/%s/%s/%s/config", prefix, component, discoveryObjectID.ReplaceAllString(node, "_"), objectID),
+			payload: payload,
+		})
+	}
+	return messages, nil
+}
+
+// jsonDiscovery returns a message per PLC listing its tags with their topics
+func (o *MQTTOutput) jsonDiscovery() ([]discoveryMessage, error) {
+	prefix := o.discoveryPrefix()
+	var plcs []*jsonDiscovery
+	byPLC := make(map[string]*jsonDiscovery)
+	for _, t := range o.tags {
+		d, ok := byPLC[t.PLC]
+		if !ok {
+			d = &jsonDiscovery{PLC: t.PLC}
+			byPLC[t.PLC] = d
+			plcs = append(plcs, d)
+		}
+		tag := jsonTag{Name: t.Tag.Name, DataType: t.Tag.DataType, Unit: t.Unit, Topic: o.Topic(t.PLC, t.Tag.Name)}
+		if t.Writable {
+			tag.CommandTopic = tag.Topic + "/set"
+		}
+		d.Tags = append(d.Tags, tag)
+	}
+
+	messages := make([]discoveryMessage, 0, len(plcs))
+	for _, d := range plcs {
+		payload, err := json.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, discoveryMessage{topic: prefix + "/" + d.PLC, payload: payload})
+	}
+	return messages, nil
+}
+
+func (o *MQTTOutput) discoveryPrefix() string {
+	switch {
+	case o.cfg.Discovery.Prefix != "":
+		return o.cfg.Discovery.Prefix
+	case o.cfg.Discovery.Format == DISCOVERY_JSON:
+		return DEFAULT_DISCOVERY_JSON
+	}
+	return DISCOVERY_HOME_ASSISTANT
+}
+
+// discoveryNode identifies the gateway in unique IDs
+func (o *MQTTOutput) discoveryNode() string {
+	if o.cfg.Discovery.NodeID != "" {
+		return o.cfg.Discovery.NodeID
+	}
+	if o.cfg.ClientID != "" {
+		return o.cfg.ClientID
+	}
+	return "finsgateway"
+}
+
+// parseCommand returns the value of a command payload: ON, OFF, true, false or a number
+func parseCommand(payload []byte) (float64, error) {
+	s := strings.TrimSpace(string(payload))
+	switch strings.ToLower(s) {
+	case "on", "true":
+		return 1, nil
+	case "off", "false":
+		return 0, nil
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid command value %q", s)
+	}
+	return value, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"folke99/gofins/fins"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Output receives the values of every poll
+type Output interface {
+	Publish(plc string, values []fins.TagValue, t time.Time) error
+	Close() error
+}
+
+// Gateway polls the configured PLCs and forwards the values to the outputs
+type Gateway struct {
+	cfg     *Config
+	manager *fins.Manager
+	clients []*fins.Client
+	outputs []Output
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewGateway connects to every PLC of cfg
+func NewGateway(cfg *Config) (*Gateway, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &Gateway{cfg: cfg, manager: fins.NewManager(1), ctx: ctx, cancel: cancel}
+
+	for _, p := range cfg.PLCs {
+		c, err := connect(p)
+		if err != nil {
+			g.Close()
+			return nil, fmt.Errorf("PLC %s: %w", p.Name, err)
+		}
+		g.clients = append(g.clients, c)
+		if p.Timeout > 0 {
+			c = c.WithTimeout(p.Timeout)
+		}
+		g.manager.Add(p.Name, c)
+	}
+	return g, nil
+}
+
+func connect(p PLCConfig) (*fins.Client, error) {
+	port := p.Port
+	if port == 0 {
+		port = 9600
+	}
+	plcAddr, err := fins.NewAddress(p.Address, port, p.Network, p.Node, p.Unit)
+	if err != nil {
+		return nil, err
+	}
+
+	localIP, localPort := p.Local.Address, p.Local.Port
+	if localIP == "" {
+		localIP = net.IPv4zero.String()
+	}
+	if localPort == 0 {
+		localPort = 9600
+	}
+	localAddr, err := fins.NewAddress(localIP, localPort, p.Local.Network, p.Local.Node, p.Local.Unit)
+	if err != nil {
+		return nil, err
+	}
+
+	return fins.NewClientWithOptions(localAddr, plcAddr, p.clientOptions())
+}
+
+// AddOutput adds an output, it is closed with the gateway
+func (g *Gateway) AddOutput(o Output) {
+	g.outputs = append(g.outputs, o)
+}
+
+// Start runs the poll groups
+func (g *Gateway) Start() error {
+	for _, pg := range g.cfg.PollGroups {
+		tags, err := g.cfg.groupTags(pg)
+		if err != nil {
+			return err
+		}
+		g.wg.Add(1)
+		go g.poll(pg, tags)
+	}
+	return nil
+}
+
+// poll reads the tags of a poll group every interval. When every read fails the PLC is
+// considered lost and the client reconnects with its reconnect policy.
+func (g *Gateway) poll(pg PollGroupConfig, tags []fins.Tag) {
+	defer g.wg.Done()
+
+	ticker := time.NewTicker(pg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		results, _ := g.manager.ReadAll(g.ctx, map[string][]fins.Tag{pg.PLC: tags})
+		if g.ctx.Err() != nil {
+			return
+		}
+		values := results[pg.PLC]
+
+		now := time.Now()
+		for _, o := range g.outputs {
+			if err := o.Publish(pg.PLC, values, now); err != nil {
+				log.Printf("Poll group %s: output %T failed: %v", pg.Name, o, err)
+			}
+		}
+
+		if len(values) > 0 && allFailed(values) {
+			log.Printf("Poll group %s: all reads of %s failed (%v), reconnecting", pg.Name, pg.PLC, values[0].Err)
+			if c, ok := g.manager.Client(pg.PLC); ok {
+				if err := c.Reconnect(); err != nil {
+					log.Printf("Poll group %s: reconnect to %s failed: %v", pg.Name, pg.PLC, err)
+				}
+			}
+		}
+	}
+}
+
+func allFailed(values []fins.TagValue) bool {
+	for _, v := range values {
+		if v.Err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Close stops polling and closes the outputs and PLC connections
+func (g *Gateway) Close() error {
+	g.cancel()
+	g.wg.Wait()
+
+	var errs []error
+	for _, o := range g.outputs {
+		errs = append(errs, o.Close())
+	}
+	for _, c := range g.clients {
+		c.Close()
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"folke99/gofins/fins"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingOutput keeps the latest published values of every tag
+type recordingOutput struct {
+	sync.Mutex
+	values    map[string]float64
+	publishes int
+	closed    bool
+}
+
+func (o *recordingOutput) Publish(plc string, values []fins.TagValue, _ time.Time) error {
+	o.Lock()
+	defer o.Unlock()
+	o.publishes++
+	for _, v := range values {
+		if v.Err == nil {
+			o.values[plc+"/"+v.Tag.Name] = v.Value
+		}
+	}
+	return nil
+}
+
+func (o *recordingOutput) Close() error {
+	o.Lock()
+	defer o.Unlock()
+	o.closed = true
+	return nil
+}
+
+func (o *recordingOutput) value(key string) (float64, bool) {
+	o.Lock()
+	defer o.Unlock()
+	v, ok := o.values[key]
+	return v, ok
+}
+
+func TestGatewayStartStop(t *testing.T) {
+	g, _, s := newTestGateway(t, "")
+	require.Len(t, s.Clients(), 1, "the gateway connects to every PLC")
+
+	o := &recordingOutput{values: make(map[string]float64)}
+	g.AddOutput(o)
+	require.NoError(t, s.WriteDM(100, []uint16{421}))
+	require.NoError(t, s.WriteDM(110, []uint16{1 << 3}))
+	require.NoError(t, g.Start())
+
+	// Only the tags of the poll group are read
+	assert.Eventually(t, func() bool {
+		temperature, _ := o.value("kiln/temperature")
+		burnerOn, _ := o.value("kiln/burnerOn")
+		return temperature == 421 && burnerOn == 1
+	}, time.Second, 10*time.Millisecond)
+	_, ok := o.value("kiln/setpoint")
+	assert.False(t, ok)
+
+	require.NoError(t, s.WriteDM(100, []uint16{430}))
+	assert.Eventually(t, func() bool {
+		temperature, _ := o.value("kiln/temperature")
+		return temperature == 430
+	}, time.Second, 10*time.Millisecond, "the values follow the PLC")
+
+	require.NoError(t, g.Close())
+	o.Lock()
+	publishes, closed := o.publishes, o.closed
+	o.Unlock()
+	assert.True(t, closed, "the outputs are closed with the gateway")
+	assert.Eventually(t, func() bool { return len(s.Clients()) == 0 }, time.Second, 10*time.Millisecond,
+		"the PLC connections are closed")
+
+	time.Sleep(100 * time.Millisecond)
+	o.Lock()
+	assert.Equal(t, publishes, o.publishes, "polling stops")
+	o.Unlock()
+}
+
+func TestSparkplugCommandRole(t *testing.T) {
+	g, cfg, _ := newTestGateway(t, "")
+	writer := newTagWriter(cfg, g.manager)
+	tags, err := cfg.TagTable("kiln")
+	require.NoError(t, err)
+	temperature, setpoint := tags[0], tags[1]
+
+	sp := &SparkplugConfig{}
+	assert.Equal(t, RoleReadOnly, sp.commandRole(), "DCMD writes are opt-in")
+	assert.ErrorIs(t, writer.authorize(sp.commandRole())("kiln", temperature, 1), errForbidden)
+
+	operator := writer.authorize(RoleOperator)
+	assert.NoError(t, operator("kiln", temperature, 1))
+	assert.ErrorIs(t, operator("kiln", setpoint, 100), errForbidden, "setpoint has writeRole admin")
+
+	admin := writer.authorize(RoleAdmin)
+	assert.NoError(t, admin("kiln", setpoint, 100))
+	assert.ErrorIs(t, admin("kiln", setpoint, 1300), errOutOfRange)
+	assert.ErrorIs(t, admin("kiln", fins.Tag{Name: "unknown"}, 1), errUnknownTag)
+}
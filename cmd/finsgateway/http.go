@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"folke99/gofins/fins"
+	"folke99/gofins/websocket"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Reading is the latest value of a tag, as served by the HTTP output and published over MQTT
+type Reading struct {
+	Value float64   `json:"value"`
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"`
+}
+
+// HTTPOutput serves the latest values of every tag:
+//
+//	GET /values             all PLCs, {"plc": {"tag": reading}}
+//	GET /values/{plc}       one PLC, {"tag": reading}
+//	PUT /values/{plc}/{tag} writes a tag, {"value": 12.5}
+//	GET /openapi.json       OpenAPI document of these paths for the tag tables
+//	/ws                     live updates and writes over WebSocket, see package websocket
+//
+// With tokens configured every request needs one, and writes need a role allowed to write
+// the tag.
+type HTTPOutput struct {
+	sync.Mutex
+	values map[string]map[string]Reading
+	writer *tagWriter
+	auth   *authenticator
+	server *http.Server
+}
+
+// writeRequest is the body of a write
+type writeRequest struct {
+	Value *float64 `json:"value"`
+}
+
+// NewHTTPOutput starts serving on the listen address of the HTTP output of cfg
+func NewHTTPOutput(cfg *Config, w *tagWriter) (*HTTPOutput, error) {
+	o := &HTTPOutput{
+		values: make(map[string]map[string]Reading),
+		writer: w,
+		auth:   newAuthenticator(cfg.Outputs.HTTP.Tokens),
+	}
+	if !o.auth.enabled() {
+		log.Printf("HTTP output has no tokens, every client may write")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /values", func(w http.ResponseWriter, r *http.Request) {
+		o.Lock()
+		defer o.Unlock()
+		writeJSON(w, o.values)
+	})
+	mux.HandleFunc("GET /values/{plc}", func(w http.ResponseWriter, r *http.Request) {
+		o.Lock()
+		defer o.Unlock()
+		values, ok := o.values[r.PathValue("plc")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, values)
+	})
+	mux.HandleFunc("PUT /values/{plc}/{tag}", o.write)
+	openAPI := cfg.OpenAPI()
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, openAPI)
+	})
+	mux.Handle("/ws", websocket.NewServer(w.manager, websocket.Options{
+		Tags: w.tags,
+		Authorize: func(r *http.Request, plc string, tag fins.Tag, value float64) error {
+			_, err := w.check(plc, tag.Name, o.auth.role(r), value)
+			return err
+		},
+	}))
+
+	l, err := net.Listen("tcp", cfg.Outputs.HTTP.Listen)
+	if err != nil {
+		return nil, err
+	}
+	o.server = &http.Server{Handler: o.auth.middleware(mux)}
+	go func() {
+		if err := o.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP output stopped: %v", err)
+		}
+	}()
+	return o, nil
+}
+
+func (o *HTTPOutput) Publish(plc string, values []fins.TagValue, t time.Time) error {
+	o.Lock()
+	defer o.Unlock()
+	readings, ok := o.values[plc]
+	if !ok {
+		readings = make(map[string]Reading)
+		o.values[plc] = readings
+	}
+	for _, v := range values {
+		readings[v.Tag.Name] = newReading(v, t)
+	}
+	return nil
+}
+
+// write writes a tag of the table, the role of the token, the range of the tag, the write
+// guard and the audit trail of the PLC client apply
+func (o *HTTPOutput) write(w http.ResponseWriter, r *http.Request) {
+	var req writeRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil || req.Value == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf(`body must be {"value": <number>}`))
+		return
+	}
+	err := o.writer.write(r.PathValue("plc"), r.PathValue("tag"), o.auth.role(r), *req.Value, auditContext(r))
+	var denied fins.WriteDeniedError
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, errUnknownTag):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, errOutOfRange):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, errForbidden), errors.As(err, &denied):
+		writeError(w, http.StatusForbidden, err)
+	default:
+		writeError(w, http.StatusBadGateway, err)
+	}
+}
+
+func (o *HTTPOutput) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return o.server.Shutdown(ctx)
+}
+
+func newReading(v fins.TagValue, t time.Time) Reading {
+	r := Reading{Value: v.Value, Time: t}
+	if v.Err != nil {
+		r.Error = v.Err.Error()
+	}
+	return r
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
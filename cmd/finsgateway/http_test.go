@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"folke99/gofins/simulator"
+	finsws "folke99/gofins/websocket"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+const testConfig = `
+plcs:
+  - name: kiln
+    address: 127.0.0.1
+    port: %d
+    node: 10
+    local:
+      node: 2
+    timeout: 1s
+tags:
+  kiln:
+    - {name: temperature, address: D100, type: INT, unit: °C}
+    - {name: setpoint, address: D102, type: INT, min: 0, max: 1200, writeRole: admin}
+    - {name: burnerOn, address: D110.03, type: BOOL}
+pollGroups:
+  - {name: fast, plc: kiln, interval: 50ms, tags: [temperature, burnerOn]}
+outputs:
+  http:
+    listen: 127.0.0.1:0
+    tokens:
+      - {name: dashboard, token: read-token, role: readOnly}
+      - {name: shift, token: operator-token, role: operator}
+      - {name: engineering, token: admin-token, role: admin}
+`
+
+// newTestGateway loads testConfig, or config when set, for a simulator and connects a gateway
+func newTestGateway(t *testing.T, config string) (*Gateway, *Config, *simulator.Server) {
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	if config == "" {
+		config = testConfig
+	}
+	path := filepath.Join(t.TempDir(), "finsgateway.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(config, s.Addr().Port)), 0o644))
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	g, err := NewGateway(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { g.Close() })
+	return g, cfg, s
+}
+
+func newTestHTTPOutput(t *testing.T) (http.Handler, *simulator.Server) {
+	g, cfg, s := newTestGateway(t, "")
+	o, err := NewHTTPOutput(cfg, newTagWriter(cfg, g.manager))
+	require.NoError(t, err)
+	t.Cleanup(func() { o.Close() })
+	return o.server.Handler, s
+}
+
+func request(h http.Handler, method, target, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestBearerTokens(t *testing.T) {
+	a := newAuthenticator([]TokenConfig{
+		{Name: "shift", Token: "operator-token", Role: RoleOperator},
+		{Name: "engineering", Token: "admin-token", Role: RoleAdmin},
+	})
+	var role Role
+	var audit map[string]string
+	h := a.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, audit = a.role(r), auditContext(r)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		status int
+		role   Role
+	}{
+		{"Bearer header", "Bearer admin-token", "", http.StatusOK, RoleAdmin},
+		{"Query parameter", "", "?access_token=operator-token", http.StatusOK, RoleOperator},
+		{"Header wins over query", "Bearer operator-token", "?access_token=admin-token", http.StatusOK, RoleOperator},
+		{"Missing token", "", "", http.StatusUnauthorized, ""},
+		{"Unknown token", "Bearer guess", "", http.StatusUnauthorized, ""},
+		{"Prefix of a token", "Bearer admin", "", http.StatusUnauthorized, ""},
+		{"Other scheme", "Basic admin-token", "", http.StatusUnauthorized, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			role, audit = "", nil
+			r := httptest.NewRequest(http.MethodGet, "/values"+tc.query, nil)
+			if tc.header != "" {
+				r.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.status, w.Code)
+			assert.Equal(t, tc.role, role)
+			if tc.status == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="finsgateway"`, w.Header().Get("WWW-Authenticate"))
+			} else {
+				assert.NotEmpty(t, audit["user"])
+			}
+		})
+	}
+
+	t.Run("Without tokens", func(t *testing.T) {
+		a := newAuthenticator(nil)
+		a.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role = a.role(r)
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/values", nil))
+		assert.Equal(t, RoleAdmin, role, "Every client may write without tokens")
+	})
+}
+
+func TestHTTPWrite(t *testing.T) {
+	h, s := newTestHTTPOutput(t)
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		w := request(h, http.MethodPut, "/values/kiln/temperature", "", `{"value": 1}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = request(h, http.MethodGet, "/values", "wrong", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Forbidden", func(t *testing.T) {
+		w := request(h, http.MethodPut, "/values/kiln/temperature", "read-token", `{"value": 1}`)
+		assert.Equal(t, http.StatusForbidden, w.Code, "readOnly writes nothing")
+		w = request(h, http.MethodPut, "/values/kiln/setpoint", "operator-token", `{"value": 1}`)
+		assert.Equal(t, http.StatusForbidden, w.Code, "setpoint needs admin")
+
+		words, err := s.ReadDM(100, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{0, 0, 0}, words)
+	})
+
+	t.Run("Write", func(t *testing.T) {
+		w := request(h, http.MethodPut, "/values/kiln/temperature", "operator-token", `{"value": 21}`)
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+		w = request(h, http.MethodPut, "/values/kiln/setpoint", "admin-token", `{"value": 850}`)
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+		w = request(h, http.MethodPut, "/values/kiln/burnerOn", "operator-token", `{"value": 1}`)
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+		words, err := s.ReadDM(100, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{21}, words)
+		words, err = s.ReadDM(102, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{850}, words)
+		words, err = s.ReadDM(110, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{1 << 3}, words)
+	})
+
+	t.Run("Bad requests", func(t *testing.T) {
+		w := request(h, http.MethodPut, "/values/kiln/missing", "admin-token", `{"value": 1}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = request(h, http.MethodPut, "/values/kiln/temperature", "admin-token", `{}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = request(h, http.MethodPut, "/values/kiln/setpoint", "admin-token", `{"value": 1300}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "Above max")
+	})
+}
+
+func TestWebSocketWrite(t *testing.T) {
+	h, s := newTestHTTPOutput(t)
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	write := func(token, tag string, value float64) finsws.Message {
+		ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?access_token="+token, "", server.URL)
+		require.NoError(t, err)
+		defer ws.Close()
+		require.NoError(t, ws.SetDeadline(time.Now().Add(5*time.Second)))
+		require.NoError(t, websocket.JSON.Send(ws, finsws.Message{Type: "write", ID: "1", PLC: "kiln", Tag: tag, Value: &value}))
+		var msg finsws.Message
+		require.NoError(t, websocket.JSON.Receive(ws, &msg))
+		return msg
+	}
+
+	assert.Contains(t, write("operator-token", "setpoint", 850).Error, "forbidden")
+	assert.Contains(t, write("admin-token", "setpoint", 1300).Error, "out of range")
+	assert.Contains(t, write("admin-token", "setpoint", -1).Error, "out of range")
+	words, err := s.ReadDM(102, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{0}, words, "the rejected writes aren't sent")
+
+	assert.Empty(t, write("admin-token", "setpoint", 1200).Error)
+	words, err = s.ReadDM(102, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{1200}, words)
+}
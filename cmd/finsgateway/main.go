@@ -0,0 +1,95 @@
+// Command finsgateway connects to Omron PLCs and forwards their tags to MQTT, Sparkplug B
+// and HTTP, configured entirely by a YAML file. See example.yaml for the format.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"folke99/gofins/fins"
+	"folke99/gofins/sparkplug"
+)
+
+func main() {
+	configPath := flag.String("config", "finsgateway.yaml", "configuration file")
+	openAPIPath := flag.String("openapi", "", "write the OpenAPI document of the HTTP output to this file and exit")
+	flag.Parse()
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *openAPIPath != "" {
+		data, err := json.MarshalIndent(cfg.OpenAPI(), "", "  ")
+		if err == nil {
+			err = os.WriteFile(*openAPIPath, append(data, '\n'), 0o644)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	g, err := NewGateway(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tags := make(map[string][]fins.Tag, len(cfg.PLCs))
+	for _, p := range cfg.PLCs {
+		// Validated by LoadConfig
+		tags[p.Name], _ = cfg.TagTable(p.Name)
+	}
+	writer := newTagWriter(cfg, g.manager)
+	if cfg.Outputs.MQTT != nil {
+		o, err := NewMQTTOutput(cfg.Outputs.MQTT, writer, cfg.DiscoveryTags())
+		if err != nil {
+			g.Close()
+			log.Fatal(err)
+		}
+		g.AddOutput(o)
+	}
+	if cfg.Outputs.HTTP != nil {
+		o, err := NewHTTPOutput(cfg, writer)
+		if err != nil {
+			g.Close()
+			log.Fatal(err)
+		}
+		g.AddOutput(o)
+	}
+	if sp := cfg.Outputs.Sparkplug; sp != nil {
+		o, err := sparkplug.NewEdgeNode(g.manager, sparkplug.Options{
+			Broker:    sp.Broker,
+			ClientID:  sp.ClientID,
+			Username:  sp.Username,
+			Password:  sp.Password,
+			GroupID:   sp.GroupID,
+			NodeID:    sp.NodeID,
+			Tags:      tags,
+			Authorize: writer.authorize(sp.commandRole()),
+		})
+		if err != nil {
+			g.Close()
+			log.Fatal(err)
+		}
+		g.AddOutput(o)
+	}
+
+	if err := g.Start(); err != nil {
+		g.Close()
+		log.Fatal(err)
+	}
+	log.Printf("Gateway running with %d PLCs and %d poll groups", len(cfg.PLCs), len(cfg.PollGroups))
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	if err := g.Close(); err != nil {
+		log.Printf("Shutdown: %v", err)
+	}
+}
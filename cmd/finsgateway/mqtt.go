@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"folke99/gofins/fins"
+	"log"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const MQTT_PUBLISH_TIMEOUT = 5 * time.Second
+
+// MQTTOutput publishes every polled value as a JSON Reading. With discovery it announces the
+// tags as retained discovery messages on every connect and writes the writable tags from
+// their command topics.
+type MQTTOutput struct {
+	cfg    *MQTTConfig
+	writer *tagWriter
+	tags   []DiscoveryTag
+	client mqtt.Client
+}
+
+// NewMQTTOutput connects to the broker, the client reconnects by itself after a connection loss
+func NewMQTTOutput(cfg *MQTTConfig, w *tagWriter, tags []DiscoveryTag) (*MQTTOutput, error) {
+	o := &MQTTOutput{cfg: cfg, writer: w, tags: tags}
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true)
+	if cfg.Discovery != nil {
+		// Commands write from their handler
+		opts.SetOrderMatters(false).SetOnConnectHandler(o.announce)
+	}
+
+	client := mqtt.NewClient(opts)
+	o.client = client
+	token := client.Connect()
+	if !token.WaitTimeout(MQTT_PUBLISH_TIMEOUT) {
+		return nil, fmt.Errorf("timeout connecting to %s", cfg.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", cfg.Broker, err)
+	}
+	return o, nil
+}
+
+// Topic returns the topic of a tag
+func (o *MQTTOutput) Topic(plc, tag string) string {
+	topic := o.cfg.Topic
+	if topic == "" {
+		topic = "{plc}/{tag}"
+	}
+	return strings.NewReplacer("{plc}", plc, "{tag}", tag).Replace(topic)
+}
+
+func (o *MQTTOutput) Publish(plc string, values []fins.TagValue, t time.Time) error {
+	var errs []error
+	for _, v := range values {
+		payload, err := json.Marshal(newReading(v, t))
+		if err != nil {
+			return err
+		}
+		token := o.client.Publish(o.Topic(plc, v.Tag.Name), o.cfg.QoS, o.cfg.Retain, payload)
+		if !token.WaitTimeout(MQTT_PUBLISH_TIMEOUT) {
+			errs = append(errs, fmt.Errorf("timeout publishing %s", v.Tag.Name))
+		} else if err := token.Error(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// announce publishes the discovery messages and subscribes to the command topics. Home
+// Assistant asks for them again by publishing "online" to <prefix>/status when it starts.
+func (o *MQTTOutput) announce(c mqtt.Client) {
+	filters := map[string]byte{}
+	for _, t := range o.tags {
+		if t.Writable {
+			filters[o.Topic(t.PLC, t.Tag.Name)+"/set"] = 1
+		}
+	}
+	if o.cfg.Discovery.Format != DISCOVERY_JSON {
+		filters[o.discoveryPrefix()+"/status"] = 1
+	}
+	if len(filters) > 0 {
+		if token := c.SubscribeMultiple(filters, o.onMessage); token.WaitTimeout(MQTT_PUBLISH_TIMEOUT) && token.Error() != nil {
+			log.Printf("MQTT command subscription failed: %v", token.Error())
+		}
+	}
+	if err := o.publishDiscovery(); err != nil {
+		log.Printf("MQTT discovery failed: %v", err)
+	}
+}
+
+func (o *MQTTOutput) publishDiscovery() error {
+	messages, err := o.discoveryMessages()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, m := range messages {
+		token := o.client.Publish(m.topic, 1, true, m.payload)
+		if !token.WaitTimeout(MQTT_PUBLISH_TIMEOUT) {
+			errs = append(errs, fmt.Errorf("timeout publishing %s", m.topic))
+		} else if err := token.Error(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// onMessage writes a tag from its command topic with the command role, or announces the tags
+// again for a restarted Home Assistant
+func (o *MQTTOutput) onMessage(_ mqtt.Client, msg mqtt.Message) {
+	if o.cfg.Discovery.Format != DISCOVERY_JSON && msg.Topic() == o.discoveryPrefix()+"/status" {
+		if string(msg.Payload()) != "online" {
+			return
+		}
+		if err := o.publishDiscovery(); err != nil {
+			log.Printf("MQTT discovery failed: %v", err)
+		}
+		return
+	}
+	for _, t := range o.tags {
+		if !t.Writable || o.Topic(t.PLC, t.Tag.Name)+"/set" != msg.Topic() {
+			continue
+		}
+		value, err := parseCommand(msg.Payload())
+		if err == nil {
+			err = o.writer.write(t.PLC, t.Tag.Name, o.cfg.Discovery.commandRole(), value, map[string]string{"mqtt": msg.Topic()})
+		}
+		if err != nil {
+			log.Printf("MQTT command %s failed: %v", msg.Topic(), err)
+		}
+		return
+	}
+}
+
+func (o *MQTTOutput) Close() error {
+	o.client.Disconnect(250)
+	return nil
+}
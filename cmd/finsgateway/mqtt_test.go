@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commandMessage is a message on a command topic
+type commandMessage struct {
+	mqtt.Message
+	topic   string
+	payload string
+}
+
+func (m commandMessage) Topic() string   { return m.topic }
+func (m commandMessage) Payload() []byte { return []byte(m.payload) }
+
+func TestMQTTCommands(t *testing.T) {
+	g, cfg, s := newTestGateway(t, "")
+	mc := &MQTTConfig{Topic: "plant/{plc}/{tag}", Discovery: &DiscoveryConfig{Format: DISCOVERY_JSON, CommandRole: RoleOperator}}
+	cfg.Outputs.MQTT = mc
+	o := &MQTTOutput{cfg: mc, writer: newTagWriter(cfg, g.manager), tags: cfg.DiscoveryTags()}
+
+	writable := map[string]bool{}
+	for _, t := range o.tags {
+		writable[t.Tag.Name] = t.Writable
+	}
+	assert.Equal(t, map[string]bool{"temperature": true, "setpoint": false, "burnerOn": true}, writable,
+		"The operator command role doesn't write admin tags")
+
+	o.onMessage(nil, commandMessage{topic: "plant/kiln/temperature/set", payload: "42"})
+	o.onMessage(nil, commandMessage{topic: "plant/kiln/burnerOn/set", payload: "ON"})
+	o.onMessage(nil, commandMessage{topic: "plant/kiln/setpoint/set", payload: "850"})
+	words, err := s.ReadDM(100, 11)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(42), words[0])
+	assert.Equal(t, uint16(0), words[2], "No command topic for setpoint")
+	assert.Equal(t, uint16(1<<3), words[10])
+
+	t.Run("Range", func(t *testing.T) {
+		mc.Discovery.CommandRole = RoleAdmin
+		o.tags = cfg.DiscoveryTags()
+		o.onMessage(nil, commandMessage{topic: "plant/kiln/setpoint/set", payload: "1300"})
+		words, err := s.ReadDM(102, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{0}, words, "Above max")
+
+		o.onMessage(nil, commandMessage{topic: "plant/kiln/setpoint/set", payload: "850"})
+		words, err = s.ReadDM(102, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{850}, words)
+	})
+
+	t.Run("Read-only command role", func(t *testing.T) {
+		mc.Discovery.CommandRole = ""
+		for _, tag := range cfg.DiscoveryTags() {
+			assert.False(t, tag.Writable, tag.Tag.Name, "command topics are opt-in")
+		}
+		o.tags = cfg.DiscoveryTags()
+		o.onMessage(nil, commandMessage{topic: "plant/kiln/temperature/set", payload: "7"})
+		words, err := s.ReadDM(100, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{42}, words)
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"folke99/gofins/fins"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// OpenAPI returns an OpenAPI 3.0 document of the HTTP output for the tag tables of cfg. Every
+// PLC and every tag gets a path of its own with the type, unit and range of its values, so
+// generated clients are typed by tag.
+func (cfg *Config) OpenAPI() map[string]any {
+	reading := func(value map[string]any) map[string]any {
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"value": value,
+				"time":  map[string]any{"type": "string", "format": "date-time"},
+				"error": map[string]any{"type": "string", "description": "Why the last read failed, value is 0 then"},
+			},
+			"required": []string{"value", "time"},
+		}
+	}
+	errorResponse := func(description string) map[string]any {
+		return map[string]any{
+			"description": description,
+			"content":     jsonContent(map[string]any{"$ref": "#/components/schemas/Error"}),
+		}
+	}
+
+	schemas := map[string]any{
+		"Error": map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"error": map[string]any{"type": "string"}},
+			"required":   []string{"error"},
+		},
+	}
+	all := map[string]any{}
+	paths := map[string]any{}
+	for _, p := range cfg.PLCs {
+		schemaName := identifier(p.Name) + "Values"
+		tags := map[string]any{}
+		for _, tc := range cfg.Tags[p.Name] {
+			tags[tc.Name] = reading(tc.valueSchema())
+			if p.ReadOnly {
+				continue
+			}
+			paths["/values/"+p.Name+"/"+tc.Name] = map[string]any{
+				"put": map[string]any{
+					"operationId": "write" + identifier(p.Name) + identifier(tc.Name),
+					"summary":     "Write " + tc.Name + " of " + p.Name,
+					"description": "Needs the " + string(tc.writeRole()) + " or admin role when the gateway has tokens",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": jsonContent(map[string]any{
+							"type":       "object",
+							"properties": map[string]any{"value": tc.valueSchema()},
+							"required":   []string{"value"},
+						}),
+					},
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Written"},
+						"400": errorResponse("The value is missing or out of range"),
+						"401": errorResponse("Missing or invalid token"),
+						"403": errorResponse("The role of the token or the write guard of the PLC rejects the write"),
+						"502": errorResponse("The PLC write failed"),
+					},
+				},
+			}
+		}
+		schemas[schemaName] = map[string]any{
+			"type":        "object",
+			"description": "Latest values of the tags of " + p.Name + " polled so far",
+			"properties":  tags,
+		}
+		all[p.Name] = map[string]any{"$ref": "#/components/schemas/" + schemaName}
+		paths["/values/"+p.Name] = map[string]any{
+			"get": map[string]any{
+				"operationId": "get" + schemaName,
+				"summary":     "Latest values of " + p.Name,
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "Latest values by tag",
+						"content":     jsonContent(map[string]any{"$ref": "#/components/schemas/" + schemaName}),
+					},
+					"401": errorResponse("Missing or invalid token"),
+					"404": map[string]any{"description": "The PLC wasn't polled yet"},
+				},
+			},
+		}
+	}
+	paths["/values"] = map[string]any{
+		"get": map[string]any{
+			"operationId": "getValues",
+			"summary":     "Latest values of all PLCs",
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "Latest values by PLC and tag",
+					"content":     jsonContent(map[string]any{"type": "object", "properties": all}),
+				},
+				"401": errorResponse("Missing or invalid token"),
+			},
+		},
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "finsgateway",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas},
+	}
+	if cfg.Outputs.HTTP != nil && len(cfg.Outputs.HTTP.Tokens) > 0 {
+		doc["components"].(map[string]any)["securitySchemes"] = map[string]any{
+			"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+		}
+		doc["security"] = []map[string]any{{"bearerAuth": []string{}}}
+	}
+	return doc
+}
+
+// valueSchema returns the schema of the values of the tag, with the range of its data type
+// narrowed by Min and Max. BOOL tags take 0 or 1.
+func (tc TagConfig) valueSchema() map[string]any {
+	schema := map[string]any{"type": "integer"}
+	var lo, hi float64
+	switch fins.DataType(tc.Type) {
+	case fins.DataTypeBool:
+		schema["enum"] = []int{0, 1}
+		lo, hi = math.Inf(-1), math.Inf(1)
+	case fins.DataTypeUint:
+		lo, hi = 0, math.MaxUint16
+	case fins.DataTypeInt:
+		lo, hi = math.MinInt16, math.MaxInt16
+	case fins.DataTypeUdint:
+		lo, hi = 0, math.MaxUint32
+	case fins.DataTypeDint:
+		lo, hi = math.MinInt32, math.MaxInt32
+	case fins.DataTypeReal:
+		schema = map[string]any{"type": "number", "format": "float"}
+		lo, hi = -math.MaxFloat32, math.MaxFloat32
+	default:
+		schema = map[string]any{"type": "number", "format": "double"}
+		lo, hi = math.Inf(-1), math.Inf(1)
+	}
+	if tc.Min != nil {
+		lo = max(lo, *tc.Min)
+	}
+	if tc.Max != nil {
+		hi = min(hi, *tc.Max)
+	}
+	if !math.IsInf(lo, 0) {
+		schema["minimum"] = lo
+	}
+	if !math.IsInf(hi, 0) {
+		schema["maximum"] = hi
+	}
+	schema["description"] = string(tc.Type) + " at " + tc.Address
+	if tc.Unit != "" {
+		schema["description"] = schema["description"].(string) + " in " + tc.Unit
+		schema["x-unit"] = tc.Unit
+	}
+	return schema
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// identifier returns name in UpperCamelCase for operation and schema names, e.g. "kiln-2"
+// becomes "Kiln2"
+func identifier(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
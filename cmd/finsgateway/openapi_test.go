@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPI(t *testing.T) {
+	_, cfg, _ := newTestGateway(t, "")
+
+	// Compare the document as served, after a JSON round trip
+	var doc struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Security   []map[string][]string                `json:"security"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Properties map[string]map[string]any `json:"properties"`
+				} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	data, err := json.Marshal(cfg.OpenAPI())
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &doc))
+
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Equal(t, []map[string][]string{{"bearerAuth": {}}}, doc.Security, "the gateway has tokens")
+
+	values := doc.Components.Schemas["KilnValues"].Properties
+	require.Len(t, values, 3, "a schema per tag")
+	assert.Equal(t, map[string]any{
+		"type":        "integer",
+		"minimum":     -32768.0,
+		"maximum":     32767.0,
+		"description": "INT at D100 in °C",
+		"x-unit":      "°C",
+	}, values["temperature"].Properties["value"])
+	assert.Equal(t, map[string]any{
+		"type":        "integer",
+		"minimum":     0.0,
+		"maximum":     1200.0,
+		"description": "INT at D102",
+	}, values["setpoint"].Properties["value"], "min and max narrow the INT range")
+	assert.Equal(t, map[string]any{
+		"type":        "integer",
+		"enum":        []any{0.0, 1.0},
+		"description": "BOOL at D110.03",
+	}, values["burnerOn"].Properties["value"])
+
+	for _, tag := range []string{"temperature", "setpoint", "burnerOn"} {
+		put := doc.Paths["/values/kiln/"+tag]["put"]
+		require.NotNil(t, put, tag)
+		assert.Contains(t, put["responses"], "403")
+		body := put["requestBody"].(map[string]any)["content"].(map[string]any)["application/json"].(map[string]any)["schema"].(map[string]any)
+		assert.Equal(t, values[tag].Properties["value"], body["properties"].(map[string]any)["value"], "writes take the values read")
+	}
+	assert.Contains(t, doc.Paths["/values/kiln/setpoint"]["put"]["description"], "admin")
+	assert.Contains(t, doc.Paths, "/values/kiln")
+	assert.Contains(t, doc.Paths, "/values")
+
+	t.Run("Read-only PLC", func(t *testing.T) {
+		cfg.PLCs[0].ReadOnly = true
+		defer func() { cfg.PLCs[0].ReadOnly = false }()
+		data, err := json.Marshal(cfg.OpenAPI())
+		require.NoError(t, err)
+		var doc struct {
+			Paths map[string]any `json:"paths"`
+		}
+		require.NoError(t, json.Unmarshal(data, &doc))
+		assert.NotContains(t, doc.Paths, "/values/kiln/setpoint", "no write paths")
+	})
+
+	t.Run("Served", func(t *testing.T) {
+		h, _ := newTestHTTPOutput(t)
+		w := request(h, http.MethodGet, "/openapi.json", "read-token", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, string(data), w.Body.String())
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"folke99/gofins/fins"
+	"slices"
+)
+
+var (
+	errUnknownTag = errors.New("unknown tag")
+	errOutOfRange = errors.New("out of range")
+)
+
+// tagWriter writes the tags of the tag tables for the outputs. Every write source passes the
+// same checks: the role of the writer against the write role of the tag and the range of
+// the tag, then the write guard and audit trail of the PLC client.
+type tagWriter struct {
+	manager *fins.Manager
+	tags    map[string][]fins.Tag
+	configs map[string]map[string]TagConfig // Per PLC and tag
+}
+
+func newTagWriter(cfg *Config, m *fins.Manager) *tagWriter {
+	w := &tagWriter{
+		manager: m,
+		tags:    make(map[string][]fins.Tag, len(cfg.PLCs)),
+		configs: make(map[string]map[string]TagConfig, len(cfg.PLCs)),
+	}
+	for _, p := range cfg.PLCs {
+		// Validated by LoadConfig
+		w.tags[p.Name], _ = cfg.TagTable(p.Name)
+		w.configs[p.Name] = make(map[string]TagConfig)
+		for _, tc := range cfg.Tags[p.Name] {
+			w.configs[p.Name][tc.Name] = tc
+		}
+	}
+	return w
+}
+
+// check returns the tag name of plc once role may write value to it
+func (w *tagWriter) check(plc, name string, role Role, value float64) (fins.Tag, error) {
+	i := slices.IndexFunc(w.tags[plc], func(t fins.Tag) bool { return t.Name == name })
+	if i < 0 {
+		return fins.Tag{}, fmt.Errorf("%w %q of PLC %q", errUnknownTag, name, plc)
+	}
+	tc := w.configs[plc][name]
+	if !role.canWrite(tc.writeRole()) {
+		return fins.Tag{}, fmt.Errorf("%w: role %q may not write %s of %s", errForbidden, role, name, plc)
+	}
+	if err := tc.checkRange(value); err != nil {
+		return fins.Tag{}, err
+	}
+	return w.tags[plc][i], nil
+}
+
+// write writes value to the tag name of plc for a writer with role, recording audit in the
+// audit trail
+func (w *tagWriter) write(plc, name string, role Role, value float64, audit map[string]string) error {
+	tag, err := w.check(plc, name, role, value)
+	if err != nil {
+		return err
+	}
+	c, ok := w.manager.Client(plc)
+	if !ok {
+		return fmt.Errorf("%w: unknown PLC %q", errUnknownTag, plc)
+	}
+	return c.WithAuditContext(audit).WriteTag(tag, value)
+}
+
+// authorize returns a write hook applying the checks of role, for outputs writing through
+// their own library such as Sparkplug
+func (w *tagWriter) authorize(role Role) func(plc string, tag fins.Tag, value float64) error {
+	return func(plc string, tag fins.Tag, value float64) error {
+		_, err := w.check(plc, tag.Name, role, value)
+		return err
+	}
+}
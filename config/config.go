@@ -0,0 +1,256 @@
+// Package config builds PLC connection settings from environment variables and flags.
+//
+// Settings start from Default, environment variables override the defaults and flags
+// override both:
+//
+//	cfg := config.Default()
+//	if err := cfg.LoadEnv("FINS_"); err != nil { ... }
+//	cfg.RegisterFlags(flag.CommandLine, "")
+//	flag.Parse()
+//	c, err := cfg.Connect()
+//
+// The variable of a setting is the prefix followed by its key, e.g. FINS_ADDRESS or
+// FINS_DIAL_TIMEOUT; the flag is the flag prefix followed by its flag name, e.g. -address.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"folke99/gofins/fins"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	ENV_PREFIX   = "FINS_"
+	DEFAULT_PORT = 9600
+)
+
+// PLC is the connection configuration of one PLC
+type PLC struct {
+	Address string // IP address of the PLC
+	Port    int
+	Network byte
+	Node    byte
+	Unit    byte
+
+	// LocalAddress is the IP address of this host on the PLC network, it only
+	// provides the local node when LocalNode is zero
+	LocalAddress string
+	LocalNetwork byte
+	LocalNode    byte // The last byte of LocalAddress when zero
+	LocalUnit    byte
+
+	// ClientNode is requested in the FINS/TCP handshake, zero lets the PLC assign one.
+	// NodeLockDir allocates the node through lock files instead, see fins.FileNodeAllocator.
+	ClientNode  byte
+	NodeLockDir string
+
+	Timeout              time.Duration // Response timeout
+	DialTimeout          time.Duration
+	HandshakeTimeout     time.Duration
+	KeepAlive            time.Duration
+	SessionKeepAlive     time.Duration
+	HalfOpenTimeout      time.Duration
+	MaxRequestsPerSecond float64
+	MaxInFlight          int
+	MaxFrameSize         int
+	DetectProfile        bool
+}
+
+// Default returns the settings used when nothing is configured, the PLC address has no default
+func Default() PLC {
+	return PLC{
+		Port:             DEFAULT_PORT,
+		LocalAddress:     net.IPv4zero.String(),
+		Timeout:          fins.DEFAULT_RESPONSE_TIMEOUT * time.Millisecond,
+		DialTimeout:      fins.DEFAULT_CONNECT_TIMEOUT * time.Millisecond,
+		HandshakeTimeout: fins.DEFAULT_HANDSHAKE_TIMEOUT * time.Millisecond,
+	}
+}
+
+// setting is a configurable field with its environment key, flag name and usage
+type setting struct {
+	key   string
+	flag  string
+	usage string
+	value flag.Value
+}
+
+func (p *PLC) settings() []setting {
+	return []setting{
+		{"ADDRESS", "address", "IP address of the PLC", newValue(&p.Address, parseString)},
+		{"PORT", "port", "FINS/TCP port of the PLC", newValue(&p.Port, parseInt)},
+		{"NETWORK", "network", "FINS network of the PLC", newValue(&p.Network, parseByte)},
+		{"NODE", "node", "FINS node of the PLC", newValue(&p.Node, parseByte)},
+		{"UNIT", "unit", "FINS unit of the PLC", newValue(&p.Unit, parseByte)},
+		{"LOCAL_ADDRESS", "local-address", "IP address of this host on the PLC network", newValue(&p.LocalAddress, parseString)},
+		{"LOCAL_NETWORK", "local-network", "FINS network of this host", newValue(&p.LocalNetwork, parseByte)},
+		{"LOCAL_NODE", "local-node", "FINS node of this host, the last byte of the local address when 0", newValue(&p.LocalNode, parseByte)},
+		{"LOCAL_UNIT", "local-unit", "FINS unit of this host", newValue(&p.LocalUnit, parseByte)},
+		{"CLIENT_NODE", "client-node", "client node requested in the handshake, 0 lets the PLC assign one", newValue(&p.ClientNode, parseByte)},
+		{"NODE_LOCK_DIR", "node-lock-dir", "directory of the lock files coordinating client nodes between processes", newValue(&p.NodeLockDir, parseString)},
+		{"TIMEOUT", "timeout", "response timeout", newValue(&p.Timeout, time.ParseDuration)},
+		{"DIAL_TIMEOUT", "dial-timeout", "TCP connect timeout", newValue(&p.DialTimeout, time.ParseDuration)},
+		{"HANDSHAKE_TIMEOUT", "handshake-timeout", "FINS/TCP handshake timeout", newValue(&p.HandshakeTimeout, time.ParseDuration)},
+		{"KEEP_ALIVE", "keep-alive", "TCP keep-alive period, negative disables keep-alive", newValue(&p.KeepAlive, time.ParseDuration)},
+		{"SESSION_KEEP_ALIVE", "session-keep-alive", "probe the PLC after this long without traffic, 0 disables the probe", newValue(&p.SessionKeepAlive, time.ParseDuration)},
+		{"HALF_OPEN_TIMEOUT", "half-open-timeout", "re-establish the connection when a command times out after this long without traffic, 0 disables the check", newValue(&p.HalfOpenTimeout, time.ParseDuration)},
+		{"MAX_REQUESTS_PER_SECOND", "max-requests-per-second", "command rate limit, 0 disables the limit", newValue(&p.MaxRequestsPerSecond, parseFloat)},
+		{"MAX_IN_FLIGHT", "max-in-flight", "commands waiting for a response at a time, 0 disables the cap", newValue(&p.MaxInFlight, parseInt)},
+		{"MAX_FRAME_SIZE", "max-frame-size", "largest FINS/TCP frame in bytes, 0 uses the default", newValue(&p.MaxFrameSize, parseInt)},
+		{"DETECT_PROFILE", "detect-profile", "select the PLC profile from the CPU unit model", newValue(&p.DetectProfile, parseBool)},
+	}
+}
+
+// LoadEnv sets the fields whose environment variable, prefix followed by the key, is set
+func (p *PLC) LoadEnv(prefix string) error {
+	for _, s := range p.settings() {
+		v, ok := os.LookupEnv(prefix + s.key)
+		if !ok {
+			continue
+		}
+		if err := s.value.Set(v); err != nil {
+			return fmt.Errorf("invalid %s%s: %w", prefix, s.key, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the settings can be used to connect
+func (p PLC) Validate() error {
+	if net.ParseIP(p.Address) == nil {
+		return fmt.Errorf("invalid PLC address %q", p.Address)
+	}
+	if p.Port <= 0 || p.Port > 0xFFFF {
+		return fmt.Errorf("invalid PLC port %d", p.Port)
+	}
+	if net.ParseIP(p.LocalAddress) == nil {
+		return fmt.Errorf("invalid local address %q", p.LocalAddress)
+	}
+	if p.Timeout < 0 || p.DialTimeout < 0 || p.HandshakeTimeout < 0 || p.SessionKeepAlive < 0 || p.HalfOpenTimeout < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	if p.MaxRequestsPerSecond < 0 || p.MaxInFlight < 0 || p.MaxFrameSize < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+// Addresses returns the local and PLC addresses
+func (p PLC) Addresses() (fins.Address, fins.Address, error) {
+	if err := p.Validate(); err != nil {
+		return fins.Address{}, fins.Address{}, err
+	}
+
+	localNode := p.LocalNode
+	if ip := net.ParseIP(p.LocalAddress).To4(); localNode == 0 && ip != nil {
+		localNode = ip[3]
+	}
+	local, err := fins.NewAddress(p.LocalAddress, 0, p.LocalNetwork, localNode, p.LocalUnit)
+	if err != nil {
+		return fins.Address{}, fins.Address{}, err
+	}
+	plc, err := fins.NewAddress(p.Address, p.Port, p.Network, p.Node, p.Unit)
+	if err != nil {
+		return fins.Address{}, fins.Address{}, err
+	}
+	return local, plc, nil
+}
+
+// Options returns the client options of the settings
+func (p PLC) Options() fins.Options {
+	opts := fins.Options{
+		DialTimeout:          p.DialTimeout,
+		HandshakeTimeout:     p.HandshakeTimeout,
+		KeepAlive:            p.KeepAlive,
+		SessionKeepAlive:     p.SessionKeepAlive,
+		HalfOpenTimeout:      p.HalfOpenTimeout,
+		MaxRequestsPerSecond: p.MaxRequestsPerSecond,
+		MaxInFlight:          p.MaxInFlight,
+		MaxFrameSize:         p.MaxFrameSize,
+		DetectProfile:        p.DetectProfile,
+		ClientNode:           p.ClientNode,
+	}
+	if p.NodeLockDir != "" {
+		opts.NodeAllocator = fins.FileNodeAllocator{Dir: p.NodeLockDir}
+	}
+	return opts
+}
+
+// Connect validates the settings and connects to the PLC
+func (p PLC) Connect() (*fins.Client, error) {
+	local, plc, err := p.Addresses()
+	if err != nil {
+		return nil, err
+	}
+	c, err := fins.NewClientWithOptions(local, plc, p.Options())
+	if err != nil {
+		return nil, err
+	}
+	if p.Timeout > 0 {
+		c.SetTimeoutMs(uint(p.Timeout.Milliseconds()))
+	}
+	return c, nil
+}
+
+// LoadPLCs reads the settings of the PLCs named in the comma separated variable
+// <prefix>PLCS. Every PLC starts from Default and is configured by the variables
+// <prefix><NAME>_<KEY>, e.g. FINS_KILN_ADDRESS for the PLC "kiln".
+func LoadPLCs(prefix string) (map[string]PLC, error) {
+	names := strings.Split(os.Getenv(prefix+"PLCS"), ",")
+	plcs := make(map[string]PLC)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := plcs[name]; ok {
+			return nil, fmt.Errorf("duplicate PLC %q in %sPLCS", name, prefix)
+		}
+		p := Default()
+		if err := p.LoadEnv(PLCPrefix(prefix, name)); err != nil {
+			return nil, err
+		}
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("PLC %s: %w", name, err)
+		}
+		plcs[name] = p
+	}
+	if len(plcs) == 0 {
+		return nil, fmt.Errorf("%sPLCS names no PLCs", prefix)
+	}
+	return plcs, nil
+}
+
+// PLCPrefix returns the variable prefix of a named PLC, e.g. FINS_KILN_ for "kiln"
+func PLCPrefix(prefix, name string) string {
+	name = strings.ToUpper(strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name))
+	return prefix + name + "_"
+}
+
+// NewManager connects to every PLC and registers the clients under their names.
+// Clients already connected are closed when a connection fails.
+func NewManager(plcs map[string]PLC, concurrency int) (*fins.Manager, error) {
+	m := fins.NewManager(concurrency)
+	var clients []*fins.Client
+	for name, p := range plcs {
+		c, err := p.Connect()
+		if err != nil {
+			for _, c := range clients {
+				c.Close()
+			}
+			return nil, fmt.Errorf("PLC %s: %w", name, err)
+		}
+		clients = append(clients, c)
+		m.Add(name, c)
+	}
+	return m, nil
+}
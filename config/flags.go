@@ -0,0 +1,70 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+)
+
+// RegisterFlags registers a flag for every setting on fs, named prefix followed by the flag
+// name. The current values are the flag defaults, so call it after LoadEnv to let flags
+// override the environment.
+func (p *PLC) RegisterFlags(fs *flag.FlagSet, prefix string) {
+	for _, s := range p.settings() {
+		fs.Var(s.value, prefix+s.flag, s.usage)
+	}
+}
+
+// value is a flag.Value setting a field of the configuration
+type value[T any] struct {
+	p     *T
+	parse func(string) (T, error)
+}
+
+func newValue[T any](p *T, parse func(string) (T, error)) *value[T] {
+	return &value[T]{p: p, parse: parse}
+}
+
+func (v *value[T]) Set(s string) error {
+	parsed, err := v.parse(s)
+	if err != nil {
+		return err
+	}
+	*v.p = parsed
+	return nil
+}
+
+func (v *value[T]) String() string {
+	// The flag package calls String on a zero value to detect default values
+	if v == nil || v.p == nil {
+		return ""
+	}
+	return fmt.Sprint(*v.p)
+}
+
+// IsBoolFlag lets boolean flags be set without a value
+func (v *value[T]) IsBoolFlag() bool {
+	_, ok := any(*new(T)).(bool)
+	return ok
+}
+
+func parseString(s string) (string, error) {
+	return s, nil
+}
+
+func parseInt(s string) (int, error) {
+	return strconv.Atoi(s)
+}
+
+func parseByte(s string) (byte, error) {
+	b, err := strconv.ParseUint(s, 0, 8)
+	return byte(b), err
+}
+
+func parseFloat(s string) (float64, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseBool(s string) (bool, error) {
+	return strconv.ParseBool(s)
+}
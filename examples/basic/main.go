@@ -0,0 +1,59 @@
+// Command basic connects to a PLC, checks it with Verify and reads and writes DM words.
+//
+//	go run ./examples/basic -plc 192.168.250.1 -port 9600 -address 100
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"folke99/gofins/fins"
+	"folke99/gofins/mapping"
+)
+
+func main() {
+	plcIP := flag.String("plc", "192.168.250.1", "PLC IP address")
+	plcPort := flag.Int("port", 9600, "PLC FINS/TCP port")
+	plcNode := flag.Uint("node", 0, "PLC node, 0 uses the node assigned during the handshake")
+	address := flag.Uint("address", 100, "DM word to read and write")
+	write := flag.Bool("write", false, "increment the word after reading it")
+	flag.Parse()
+
+	clientAddr, err := fins.NewAddress("0.0.0.0", 0, 0, 0, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	plcAddr, err := fins.NewAddress(*plcIP, *plcPort, 0, byte(*plcNode), 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c, err := fins.NewClient(clientAddr, plcAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Verify(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, uint16(*address), 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("D%d = %d\n", *address, words[0])
+
+	if !*write {
+		return
+	}
+	if err := c.WriteWords(mapping.MemoryAreaDMWord, uint16(*address), []uint16{words[0] + 1}); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("D%d <- %d\n", *address, words[0]+1)
+}
@@ -0,0 +1,53 @@
+// Command float writes and reads REAL values through tags, using the in process simulator.
+//
+// An Omron REAL occupies two words with the low word first, ReadTag and WriteTag handle the
+// word order so the values are exact.
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"folke99/gofins/fins"
+	"folke99/gofins/mapping"
+	"folke99/gofins/simulator"
+)
+
+func main() {
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, simulator.SIMULATOR_NODE, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c, err := fins.NewClient(clientAddr, plcAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	fanSpeed := fins.Tag{Name: "fanSpeed", MemoryArea: mapping.MemoryAreaDMWord, Address: 200, DataType: fins.DataTypeReal}
+	if err := c.WriteTag(fanSpeed, 42.5); err != nil {
+		log.Fatal(err)
+	}
+
+	value, err := c.ReadTag(fanSpeed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	words, err := c.ReadWords(fanSpeed.MemoryArea, fanSpeed.Address, 2)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s = %g, stored as %04X %04X\n", fanSpeed.Name, value, words[0], words[1])
+	// output: fanSpeed = 42.5, stored as 0000 422A
+}
@@ -0,0 +1,52 @@
+// Command simulator runs the soft-PLC simulator in process and talks to it with a client.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"folke99/gofins/fins"
+	"folke99/gofins/mapping"
+	"folke99/gofins/simulator"
+)
+
+func main() {
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, simulator.SIMULATOR_NODE, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c, err := fins.NewClient(clientAddr, plcAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := c.Verify(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := c.WriteWords(mapping.MemoryAreaDMWord, 100, []uint16{1, 2, 3}); err != nil {
+		log.Fatal(err)
+	}
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 100, 3)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("D100-D102:", words)
+	// output: D100-D102: [1 2 3]
+}
@@ -0,0 +1,60 @@
+package fins
+
+// adaptive tracks the read interval of every tag of a poll group with adaptive polling, in
+// cycles of the group. A read that finds the value unchanged doubles the interval of the tag
+// up to maxStride, a changed value or an error makes it read every cycle again.
+type adaptive struct {
+	maxStride int64
+	stride    []int64
+	due       []int64 // Cycle of the next read
+	last      []TagValue
+	read      []bool // The tag was read at least once
+}
+
+// newAdaptive returns the adaptive state of g, nil when g doesn't poll adaptively
+func newAdaptive(g PollGroup) *adaptive {
+	if g.MaxPeriod <= g.Period {
+		return nil
+	}
+	n := len(g.Tags)
+	a := &adaptive{
+		maxStride: int64(g.MaxPeriod / g.Period),
+		stride:    make([]int64, n),
+		due:       make([]int64, n),
+		last:      make([]TagValue, n),
+		read:      make([]bool, n),
+	}
+	for i := range a.stride {
+		a.stride[i] = 1
+	}
+	return a
+}
+
+// dueTags returns the indexes of the tags to read in cycle
+func (a *adaptive) dueTags(cycle int64) []int {
+	var due []int
+	for i, next := range a.due {
+		if cycle >= next {
+			due = append(due, i)
+		}
+	}
+	return due
+}
+
+// update takes the values read in cycle for the tags at indexes and returns the latest values
+// of all tags, with whether they were read in this cycle
+func (a *adaptive) update(cycle int64, indexes []int, values []TagValue) ([]TagValue, []bool) {
+	fresh := make([]bool, len(a.last))
+	for j, i := range indexes {
+		v := values[j]
+		changed := !a.read[i] || v.Err != nil || a.last[i].Err != nil || v.Value != a.last[i].Value
+		if changed {
+			a.stride[i] = 1
+		} else {
+			a.stride[i] = min(2*a.stride[i], a.maxStride)
+		}
+		a.due[i] = cycle + a.stride[i]
+		a.last[i], a.read[i], fresh[i] = v, true, true
+	}
+	return append([]TagValue(nil), a.last...), fresh
+}
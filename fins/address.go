@@ -1,8 +1,8 @@
 package fins
 
 import (
-	"encoding/binary"
 	"fmt"
+	"folke99/gofins/mapping"
 	"net"
 )
 
@@ -17,13 +17,6 @@ type Address struct {
 	tcpAddress  *net.TCPAddr
 }
 
-// MemoryAddress represents a PLC memory address
-type MemoryAddress struct {
-	memoryArea byte
-	address    uint16
-	bitOffset  byte
-}
-
 // NewAddress creates a new Address instance with TCP addressing
 func NewAddress(ip string, port int, network, node, unit byte) (Address, error) {
 	ipAddr := net.ParseIP(ip)
@@ -70,44 +63,12 @@ func (a Address) Clone() Address {
 
 // ---------- MEMORY ADDRESS FUNCTIONS ----------
 
-// Getters
-func (m MemoryAddress) GetMemoryArea() byte {
-	return m.memoryArea
-}
-func (m MemoryAddress) GetAddress() uint16 {
-	return m.address
-}
-func (m MemoryAddress) GetBitOffset() byte {
-	return m.bitOffset
-}
-
 // Create MemoryAddress
-func memAddr(memoryArea byte, address uint16) MemoryAddress {
-	return MemoryAddress{memoryArea, address, 0}
+func memAddr(memoryArea mapping.MemoryArea, address uint16) MemoryAddress {
+	return MemoryAddress{MemoryArea: byte(memoryArea), Address: address}
 }
 
 // Create MemoryAddress with offset
-func memAddrWithBitOffset(memoryArea byte, address uint16, bitOffset byte) MemoryAddress {
-	return MemoryAddress{memoryArea, address, bitOffset}
-}
-
-// Memory address encoding/decoding
-func encodeMemoryAddress(memoryAddr MemoryAddress) []byte {
-	bytes := make([]byte, 4)
-	bytes[0] = memoryAddr.memoryArea
-	binary.BigEndian.PutUint16(bytes[1:3], memoryAddr.address)
-	bytes[3] = memoryAddr.bitOffset
-	return bytes
-}
-
-// NOTE: Only used in server.go
-func DecodeMemoryAddress(data []byte) (MemoryAddress, error) {
-	if len(data) < 4 {
-		return MemoryAddress{}, fmt.Errorf("insufficient data for memory address: expected 4 bytes, got %d", len(data))
-	}
-	return MemoryAddress{
-		memoryArea: data[0],
-		address:    binary.BigEndian.Uint16(data[1:3]),
-		bitOffset:  data[3],
-	}, nil
+func memAddrWithBitOffset(memoryArea mapping.MemoryArea, address uint16, bitOffset byte) MemoryAddress {
+	return MemoryAddress{MemoryArea: byte(memoryArea), Address: address, BitOffset: bitOffset}
 }
@@ -0,0 +1,135 @@
+package fins
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"folke99/gofins/finsproto"
+	"folke99/gofins/mapping"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes a memory area write sent by the client
+type AuditRecord struct {
+	Time       time.Time          `json:"time"`
+	MemoryArea mapping.MemoryArea `json:"memoryArea"`
+	Address    uint16             `json:"address"`
+	BitOffset  byte               `json:"bitOffset,omitempty"`
+	ItemCount  uint16             `json:"itemCount"`
+	// Previous holds the memory before the write when read-before-write is enabled
+	Previous    []byte            `json:"previous,omitempty"`
+	PreviousErr string            `json:"previousError,omitempty"`
+	Data        []byte            `json:"data"`
+	Context     map[string]string `json:"context,omitempty"` // Set with WithAuditContext
+	Err         string            `json:"error,omitempty"`   // Why the write failed
+}
+
+// AuditSink stores audit records, it is called once per write after the outcome is known
+type AuditSink interface {
+	RecordWrite(r AuditRecord) error
+}
+
+// JSONAuditSink writes one JSON object per record
+type JSONAuditSink struct {
+	sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONAuditSink creates a sink writing JSON lines to w
+func NewJSONAuditSink(w io.Writer) *JSONAuditSink {
+	return &JSONAuditSink{enc: json.NewEncoder(w)}
+}
+
+// OpenAuditFile opens path for appending, creating it if needed, and returns a sink writing to it
+func OpenAuditFile(path string) (*JSONAuditSink, *os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewJSONAuditSink(f), f, nil
+}
+
+func (s *JSONAuditSink) RecordWrite(r AuditRecord) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.enc.Encode(r)
+}
+
+// SetAuditSink records every memory area write to sink, nil disables the audit trail.
+// With readBefore the written memory is read first so the record holds the previous value.
+func (c *Client) SetAuditSink(sink AuditSink, readBefore bool) {
+	c.Lock()
+	c.auditSink = sink
+	c.auditReadBefore = readBefore
+	c.Unlock()
+}
+
+// WithAuditContext returns a handle sharing the connection whose writes are recorded
+// with the given context, for example the name of the user
+func (c *Client) WithAuditContext(context map[string]string) *Client {
+	h := *c
+	h.auditContext = maps.Clone(context)
+	return &h
+}
+
+// startAudit returns the record of a memory area write, or nil when the command
+// is not a write or no sink is set
+func (c *Client) startAudit(command []byte) *AuditRecord {
+	c.Lock()
+	sink, readBefore := c.auditSink, c.auditReadBefore
+	c.Unlock()
+	if sink == nil || binary.BigEndian.Uint16(command[0:2]) != mapping.CommandCodeMemoryAreaWrite {
+		return nil
+	}
+	w, err := decodeMemoryWrite(command[2:])
+	if err != nil {
+		return nil
+	}
+
+	r := &AuditRecord{
+		MemoryArea: mapping.MemoryArea(w.Address.MemoryArea),
+		Address:    w.Address.Address,
+		BitOffset:  w.Address.BitOffset,
+		ItemCount:  w.ItemCount,
+		Data:       append([]byte(nil), w.Data...),
+		Context:    c.auditContext,
+	}
+	if readBefore {
+		resp, err := c.roundTrip(finsproto.ReadCommand(w.Address, w.ItemCount))
+		if err = checkResponse(resp, err); err == nil {
+			want := int(w.ItemCount) * 2
+			if r.MemoryArea.IsBit() {
+				want = int(w.ItemCount)
+			}
+			err = checkDataLength(resp, want, "memory area read")
+		}
+		if err != nil {
+			r.PreviousErr = err.Error()
+		} else {
+			r.Previous = resp.Data
+		}
+	}
+	return r
+}
+
+// finishAudit stores the record with the outcome of the write
+func (c *Client) finishAudit(r *AuditRecord, err error) {
+	c.Lock()
+	sink := c.auditSink
+	c.Unlock()
+	if sink == nil {
+		return
+	}
+
+	r.Time = time.Now()
+	if err != nil {
+		r.Err = err.Error()
+	}
+	if err := sink.RecordWrite(*r); err != nil {
+		log.Printf("Failed to record write to the audit trail: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package fins
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff decides the delay before each reconnection attempt
+type Backoff interface {
+	// Next returns the delay before attempt (starting at 1), false stops reconnecting
+	Next(attempt int) (time.Duration, bool)
+}
+
+// ReconnectAttempt describes a finished reconnection attempt, Err is nil when it succeeded
+type ReconnectAttempt struct {
+	Attempt int
+	Delay   time.Duration // Wait before the attempt
+	Elapsed time.Duration // Time since Reconnect was called
+	Err     error
+}
+
+// ScheduleBackoff waits the listed delays in order and stops after the last one
+type ScheduleBackoff []time.Duration
+
+func (s ScheduleBackoff) Next(attempt int) (time.Duration, bool) {
+	if attempt < 1 || attempt > len(s) {
+		return 0, false
+	}
+	return s[attempt-1], true
+}
+
+// ConstantBackoff waits Interval before every attempt, MaxAttempts of zero retries until the
+// maximum elapsed time
+type ConstantBackoff struct {
+	Interval    time.Duration
+	MaxAttempts int
+}
+
+func (b ConstantBackoff) Next(attempt int) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && attempt > b.MaxAttempts {
+		return 0, false
+	}
+	return b.Interval, true
+}
+
+// ExponentialBackoff multiplies the delay by Multiplier (default 2) after every attempt, up to Max.
+// Jitter randomizes each delay by up to that fraction in either direction, so clients that
+// lost the same PLC don't reconnect in lockstep.
+type ExponentialBackoff struct {
+	Initial     time.Duration
+	Max         time.Duration
+	Multiplier  float64
+	Jitter      float64
+	MaxAttempts int
+}
+
+func (b ExponentialBackoff) Next(attempt int) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && attempt > b.MaxAttempts {
+		return 0, false
+	}
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	d := float64(b.Initial) * math.Pow(multiplier, float64(attempt-1))
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		d += d * b.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(max(d, 0)), true
+}
+
+// FibonacciBackoff waits Unit times the Fibonacci sequence (1, 1, 2, 3, 5, ...), up to Max
+type FibonacciBackoff struct {
+	Unit        time.Duration
+	Max         time.Duration
+	MaxAttempts int
+}
+
+func (b FibonacciBackoff) Next(attempt int) (time.Duration, bool) {
+	if b.MaxAttempts > 0 && attempt > b.MaxAttempts {
+		return 0, false
+	}
+	prev, cur := 0, 1
+	for i := 1; i < attempt; i++ {
+		prev, cur = cur, prev+cur
+		if b.Max > 0 && time.Duration(cur)*b.Unit > b.Max {
+			return b.Max, true
+		}
+	}
+	return time.Duration(cur) * b.Unit, true
+}
+
+// defaultBackoff is used when Options.ReconnectBackoff is not set
+var defaultBackoff = ScheduleBackoff{1 * time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second}
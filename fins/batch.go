@@ -0,0 +1,223 @@
+package fins
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"folke99/gofins/mapping"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// BatchRow is a value to write to an address, one row of a batch sheet
+type BatchRow struct {
+	Line    int    // Line of the row in the sheet
+	Address string // Address in Omron notation, e.g. "D100" or "W0.03"
+	Tag     Tag
+	Value   float64
+}
+
+// BatchResult is the outcome of writing one row
+type BatchResult struct {
+	Row      BatchRow
+	Previous *float64 // Value before the write, nil when it could not be read
+	Written  bool     // The value was written and read back
+	Skipped  bool     // Not attempted because an earlier row failed
+	Err      error
+}
+
+// BatchReport lists the outcome of every row of a batch write
+type BatchReport struct {
+	Results []BatchResult
+	Written int
+	Failed  int
+	Skipped int
+}
+
+// LoadBatchCSV reads a batch sheet with rows of address, value and an optional data type,
+// for example "D100,12.5,REAL" or "W0.03,1". The data type defaults to BOOL for bit addresses
+// and UINT for words. Values may be hex with a "#" or "0x" prefix, BOOL values may also be
+// true/false or on/off. Empty rows, rows starting with "#" and a header row are skipped.
+// Sheets saved by Excel with ";" as separator and decimal commas are detected.
+func LoadBatchCSV(r io.Reader) ([]BatchRow, error) {
+	br := bufio.NewReader(r)
+	cr := csv.NewReader(br)
+	first, _ := br.Peek(br.Size())
+	if line := firstLine(first); bytes.Count(line, []byte(";")) > bytes.Count(line, []byte(",")) {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	var rows []BatchRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(rows) == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "address") {
+			continue
+		}
+
+		row, err := parseBatchRow(record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		row.Line = line
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func firstLine(b []byte) []byte {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return b[:i]
+	}
+	return b
+}
+
+func parseBatchRow(record []string) (BatchRow, error) {
+	if len(record) < 2 {
+		return BatchRow{}, fmt.Errorf("expected address and value, got %d fields", len(record))
+	}
+	row := BatchRow{Address: strings.TrimSpace(record[0])}
+	area, address, bit, err := mapping.ParseAddress(row.Address)
+	if err != nil {
+		return BatchRow{}, err
+	}
+
+	dataType := DataTypeUint
+	if bit >= 0 {
+		dataType = DataTypeBool
+	}
+	if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+		dataType = DataType(strings.ToUpper(strings.TrimSpace(record[2])))
+	}
+	if _, err := dataType.WordCount(); err != nil {
+		return BatchRow{}, err
+	}
+
+	row.Tag = Tag{Name: row.Address, MemoryArea: area, Address: address, DataType: dataType}
+	if dataType == DataTypeBool {
+		if bit < 0 {
+			return BatchRow{}, fmt.Errorf("BOOL needs a bit address, got %s", row.Address)
+		}
+		row.Tag.MemoryArea, _ = area.BitArea()
+		row.Tag.BitOffset = byte(bit)
+	} else if bit >= 0 {
+		return BatchRow{}, fmt.Errorf("only BOOL values have a bit address, got %s", row.Address)
+	}
+
+	if row.Value, err = parseBatchValue(strings.TrimSpace(record[1]), dataType); err != nil {
+		return BatchRow{}, err
+	}
+	if dataType != DataTypeBool {
+		if _, err := encodeTagValue(dataType, row.Value); err != nil {
+			return BatchRow{}, err
+		}
+	}
+	return row, nil
+}
+
+func parseBatchValue(s string, dataType DataType) (float64, error) {
+	if dataType == DataTypeBool {
+		switch strings.ToLower(s) {
+		case "1", "true", "on":
+			return 1, nil
+		case "0", "false", "off":
+			return 0, nil
+		}
+		return 0, fmt.Errorf("invalid BOOL value %q", s)
+	}
+
+	if hex, ok := strings.CutPrefix(s, "#"); ok {
+		s = "0x" + hex
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		v, err := strconv.ParseUint(s[2:], 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid hex value %q", s)
+		}
+		return float64(v), nil
+	}
+	// Excel writes decimal commas in the locales that separate fields with ";"
+	v, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// WriteBatch writes the rows in order, reading every value back to verify it. The previous
+// value of each row is read first so the report shows what was changed. With stopOnError the
+// rows after the first failure are skipped, otherwise all rows are attempted. The report holds
+// every row, the returned *MultiError lists the failed ones.
+func (c *Client) WriteBatch(rows []BatchRow, stopOnError bool) (BatchReport, error) {
+	report := BatchReport{Results: make([]BatchResult, len(rows))}
+	multi := &MultiError{Total: len(rows)}
+	for i, row := range rows {
+		res := &report.Results[i]
+		res.Row = row
+		if stopOnError && report.Failed > 0 {
+			res.Skipped = true
+			report.Skipped++
+			continue
+		}
+
+		previous, err := c.ReadTag(row.Tag)
+		if err != nil {
+			res.Err = fmt.Errorf("failed to read current value: %w", err)
+		} else {
+			res.Previous = &previous
+			res.Err = c.writeAndVerifyTag(row.Tag, row.Value)
+		}
+		if res.Err != nil {
+			report.Failed++
+			multi.Errors = append(multi.Errors, ItemError{Index: i, Item: fmt.Sprintf("%s (line %d)", row.Address, row.Line), Err: res.Err})
+			continue
+		}
+		res.Written = true
+		report.Written++
+	}
+	return report, multi.errOrNil()
+}
+
+// WriteCSV writes the report with one row per batch row: line, address, data type, value,
+// previous value, status (ok, failed or skipped) and error
+func (r BatchReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"line", "address", "type", "value", "previous", "status", "error"})
+	for _, res := range r.Results {
+		status, previous, message := "ok", "", ""
+		switch {
+		case res.Skipped:
+			status = "skipped"
+		case res.Err != nil:
+			status, message = "failed", res.Err.Error()
+		}
+		if res.Previous != nil {
+			previous = strconv.FormatFloat(*res.Previous, 'g', -1, 64)
+		}
+		cw.Write([]string{
+			strconv.Itoa(res.Row.Line),
+			res.Row.Address,
+			string(res.Row.Tag.DataType),
+			strconv.FormatFloat(res.Row.Value, 'g', -1, 64),
+			previous,
+			status,
+			message,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
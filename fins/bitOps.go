@@ -2,27 +2,33 @@ package fins
 
 import (
 	"encoding/binary"
+	"folke99/gofins/finsproto"
 	"folke99/gofins/mapping"
 )
 
 // Set byte order
 // Default value: binary.BigEndian
 func (c *Client) SetByteOrder(o binary.ByteOrder) {
-	c.byteOrder = o
+	c.byteOrder.Store(&o)
+}
+
+// order returns the byte order set with SetByteOrder
+func (c *Client) order() binary.ByteOrder {
+	return *c.byteOrder.Load()
 }
 
 // SetBit Sets a bit in the PLC data area
-func (c *Client) SetBit(memoryArea byte, address uint16, bitOffset byte) error {
+func (c *Client) SetBit(memoryArea mapping.MemoryArea, address uint16, bitOffset byte) error {
 	return c.bitTwiddle(memoryArea, address, bitOffset, 0x01)
 }
 
 // ResetBit Resets a bit in the PLC data area
-func (c *Client) ResetBit(memoryArea byte, address uint16, bitOffset byte) error {
+func (c *Client) ResetBit(memoryArea mapping.MemoryArea, address uint16, bitOffset byte) error {
 	return c.bitTwiddle(memoryArea, address, bitOffset, 0x00)
 }
 
 // ToggleBit Toggles a bit in the PLC data area
-func (c *Client) ToggleBit(memoryArea byte, address uint16, bitOffset byte) error {
+func (c *Client) ToggleBit(memoryArea mapping.MemoryArea, address uint16, bitOffset byte) error {
 	b, e := c.ReadBits(memoryArea, address, bitOffset, 1)
 	if e != nil {
 		return e
@@ -36,12 +42,15 @@ func (c *Client) ToggleBit(memoryArea byte, address uint16, bitOffset byte) erro
 	return c.bitTwiddle(memoryArea, address, bitOffset, t)
 }
 
-func (c *Client) bitTwiddle(memoryArea byte, address uint16, bitOffset byte, value byte) error {
+func (c *Client) bitTwiddle(memoryArea mapping.MemoryArea, address uint16, bitOffset byte, value byte) error {
 	if mapping.CheckIsBitMemoryArea(memoryArea) == false {
 		return IncompatibleMemoryAreaError{memoryArea}
 	}
-	mem := MemoryAddress{memoryArea, address, bitOffset}
-	command := writeCommand(mem, 1, []byte{value})
+	if err := c.checkBitRange(memoryArea, address, bitOffset, 1); err != nil {
+		return err
+	}
+	mem := memAddrWithBitOffset(memoryArea, address, bitOffset)
+	command := finsproto.WriteCommand(mem, 1, []byte{value})
 
 	return checkResponse(c.sendCommand(command))
 }
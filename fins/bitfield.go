@@ -0,0 +1,84 @@
+package fins
+
+import (
+	"fmt"
+	"folke99/gofins/mapping"
+)
+
+// BitField is a named group of Width bits starting at bit Shift of a word
+type BitField struct {
+	Name  string `json:"name"`
+	Shift byte   `json:"shift"`
+	Width byte   `json:"width"`
+}
+
+// Mask returns the bits of the word used by the field
+func (f BitField) Mask() uint16 {
+	return uint16((1<<f.Width)-1) << f.Shift
+}
+
+// Get extracts the field value from word
+func (f BitField) Get(word uint16) uint16 {
+	return (word & f.Mask()) >> f.Shift
+}
+
+func (f BitField) check() error {
+	if f.Width == 0 || int(f.Shift)+int(f.Width) > 16 {
+		return fmt.Errorf("bit field %s: shift %d and width %d don't fit a word", f.Name, f.Shift, f.Width)
+	}
+	return nil
+}
+
+// ReadBitFields reads the word at the tag address and returns the value of every tag field by name
+func (c *Client) ReadBitFields(t Tag) (map[string]uint16, error) {
+	words, err := c.ReadWords(t.MemoryArea, t.Address, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]uint16, len(t.Fields))
+	for _, f := range t.Fields {
+		if err := f.check(); err != nil {
+			return nil, err
+		}
+		values[f.Name] = f.Get(words[0])
+	}
+	return values, nil
+}
+
+// WriteBitFields sets the named tag fields to values with a read-modify-write of the word,
+// fields that are not in values keep their bits
+func (c *Client) WriteBitFields(t Tag, values map[string]uint16) error {
+	var mask, bits uint16
+	for name, value := range values {
+		f, ok := findBitField(t.Fields, name)
+		if !ok {
+			return fmt.Errorf("tag %s has no bit field %s", t.Name, name)
+		}
+		if err := f.check(); err != nil {
+			return err
+		}
+		if value > f.Mask()>>f.Shift {
+			return fmt.Errorf("value %d out of range for bit field %s of width %d", value, name, f.Width)
+		}
+		mask |= f.Mask()
+		bits |= value << f.Shift
+	}
+	return c.UpdateBits(t.MemoryArea, t.Address, mask, bits)
+}
+
+// UpdateBits sets the bits of mask in the word at address to those of value and keeps the others
+func (c *Client) UpdateBits(memoryArea mapping.MemoryArea, address uint16, mask, value uint16) error {
+	return c.UpdateWord(memoryArea, address, func(old uint16) uint16 {
+		return old&^mask | value&mask
+	})
+}
+
+func findBitField(fields []BitField, name string) (BitField, bool) {
+	for _, f := range fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return BitField{}, false
+}
@@ -5,73 +5,262 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"folke99/gofins/finsproto"
 	"folke99/gofins/mapping"
+	"io"
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Client Omron FINS client using TCP
+//
+// Clients returned by WithPriority, WithTimeout, WithAuditContext, WithUnit and WithDestination share the connection of the client they were created from.
+// All methods are safe for concurrent use, also while the connection is replaced by a reconnect
+// or closed, commands in flight at that moment fail with an error.
 type Client struct {
+	*session
+	priority Priority
+	timeout  time.Duration // Overrides the response timeout of the session when non-zero
+	target   *finsAddress  // Overrides the PLC address when set
+	unit     *byte         // Overrides the unit address (DA2) of the PLC address when set
+	// Context recorded with the writes of this handle in the audit trail
+	auditContext map[string]string
+}
+
+// session holds the connection state shared by all handles of a client
+type session struct {
 	conn net.Conn
 	// resp []chan Response
+
+	// The session lock guards the session state for short moments and is never held while
+	// waiting on the network. Connection management holds connLock instead, so a reconnect
+	// with its backoff or a slow handshake doesn't block commands or configuration changes.
 	sync.Mutex
+	connLock          sync.Mutex   // Serializes reconnects, held for the whole handshake and backoff
+	connMutex         sync.RWMutex // Guards conn and ready for the command path, which doesn't take the session lock
+	ready             bool         // The handshake of conn completed and its listen loop runs
 	plcAddr           Address
 	dst               finsAddress
 	src               finsAddress
 	sid               byte
-	closed            bool
-	responseTimeoutMs time.Duration
-	byteOrder         binary.ByteOrder
+	closed            atomic.Bool
+	responseTimeoutMs atomic.Int64
+	byteOrder         atomic.Pointer[binary.ByteOrder]
 	reader            *bufio.Reader
 	listening         bool
+	maxFrameSize      int
+	receiveBufferSize int
+	scannerBufferSize int
+	listenDone        chan struct{} // Closed when the listen loop of the current connection exits
+	lastReceived      atomic.Int64  // Unix time in nanoseconds of the last frame from the PLC
 
-	resp      map[uint8]chan Response
+	resp      map[uint8]*pendingResponse
 	respMutex sync.Mutex // Dedicated mutex for response channels
+	delivery  DeliveryPolicy
+
+	limiter         *tokenBucket
+	scheduler       *scheduler
+	commandPriority map[uint16]Priority
+
+	commandHandler CommandHandler
+	commands       chan []byte   // Commands from the PLC waiting for commandLoop
+	commandStop    chan struct{} // Stops commandLoop when the client is closed
+
+	minSid      byte
+	maxSid      byte
+	diagnostics *diagnostics
+
+	profile        atomic.Pointer[mapping.Profile] // Swapped by profile detection while the reader runs
+	transferLimits map[mapping.MemoryArea]mapping.TransferLimit
+
+	rmwMutex      sync.Mutex // Serializes read-modify-write cycles of all handles
+	verifyUpdates bool
+
+	middleware []Middleware
+	writeGuard WriteGuard
+
+	auditSink       AuditSink
+	auditReadBefore bool
+
+	dryRun bool
+
+	variables VariableBackend
+
+	dialTimeout      time.Duration
+	handshakeTimeout time.Duration
+	keepAlive        time.Duration
+
+	clientNode    byte
+	nodeAllocator NodeAllocator
+	nodeRelease   func() // Releases the node allocated for the current connection
+
+	// Keep-alive set with SetKeepAlive, reapplied after Reconnect
+	keepAliveSet      bool
+	keepAliveEnabled  bool
+	keepAliveInterval time.Duration
+
+	keepAliveStop   chan struct{} // Stops the session keep-alive, nil when it is disabled
+	keepAliveProbe  KeepAliveProbe
+	halfOpenTimeout time.Duration
+	probing         atomic.Bool
+
+	reconnectHooks      []func()
+	reconnectBackoff    Backoff
+	reconnectMaxElapsed time.Duration
+	onReconnectAttempt  func(ReconnectAttempt)
+
+	onConnect          func(ConnectionEvent)
+	onDisconnect       func(ConnectionEvent)
+	onReconnectSuccess func(ConnectionEvent)
+	disconnectedAt     time.Time // Time the connection was lost, zero while connected
 }
 
 // Note: These values are not optimized and can be further improved upon.
 const (
-	DEFAULT_RESPONSE_TIMEOUT = 10000
-	DEFAULT_CONNECT_TIMEOUT  = 5000
-	MAX_PACKET_SIZE          = 2048
+	DEFAULT_RESPONSE_TIMEOUT  = 10000
+	DEFAULT_CONNECT_TIMEOUT   = 5000
+	DEFAULT_HANDSHAKE_TIMEOUT = 5000
+	MAX_PACKET_SIZE           = 2048 // Default largest FINS/TCP frame, see Options.MaxFrameSize
+	MIN_FRAME_SIZE            = 64   // Smallest configurable frame size
+	DEFAULT_RECEIVE_BUFFER    = 4096
+
+	// Bytes of a response frame that are not data: TCP header (16), FINS header (10),
+	// command code (2) and end code (2)
+	RESPONSE_OVERHEAD = 30
 )
 
 // Creates a new FINS client and returns it
 func NewClient(localAddr, plcAddr Address) (*Client, error) {
-	c := new(Client)
+	return NewClientWithOptions(localAddr, plcAddr, Options{})
+}
+
+// Creates a new FINS client configured with opts and returns it
+func NewClientWithOptions(localAddr, plcAddr Address, opts Options) (*Client, error) {
+	c := &Client{session: new(session), priority: PriorityNormal}
+	for code, p := range opts.CommandPriorities {
+		if p < PriorityLow || p > PriorityHigh {
+			return nil, fmt.Errorf("invalid priority %d for command %04X", p, code)
+		}
+	}
+	c.commandPriority = opts.CommandPriorities
 	c.plcAddr = plcAddr
 	c.dst = plcAddr.finsAddress
 	c.src = localAddr.finsAddress
-	c.responseTimeoutMs = DEFAULT_RESPONSE_TIMEOUT
-	c.byteOrder = binary.BigEndian
+	c.responseTimeoutMs.Store(DEFAULT_RESPONSE_TIMEOUT)
+	c.SetByteOrder(binary.BigEndian)
 	c.sid = 0
 
-	dialer := net.Dialer{
-		Timeout: time.Duration(DEFAULT_CONNECT_TIMEOUT) * time.Millisecond,
+	if opts.MaxRequestsPerSecond > 0 {
+		c.limiter = newTokenBucket(opts.MaxRequestsPerSecond, opts.Burst)
+	}
+	if opts.MaxInFlight > 0 {
+		c.scheduler = newScheduler(opts.MaxInFlight)
 	}
 
-	conn, err := dialer.Dial("tcp", plcAddr.tcpAddress.String())
-	if err != nil {
-		return nil, fmt.Errorf("failed to establish TCP connection: %w", err)
+	c.minSid, c.maxSid = opts.MinSID, opts.MaxSID
+	if c.minSid == 0 {
+		c.minSid = 1
+	}
+	if c.maxSid == 0 {
+		c.maxSid = 255
+	}
+	if c.minSid > c.maxSid {
+		return nil, fmt.Errorf("invalid SID range: %d-%d", c.minSid, c.maxSid)
 	}
+	c.diagnostics = newDiagnostics(opts.DiagnosticsHistory)
 
-	c.conn = conn
-	c.reader = bufio.NewReader(conn)
-	c.resp = make(map[uint8]chan Response)
+	profile := mapping.ProfileCJ2
+	if opts.Profile != nil {
+		profile = *opts.Profile
+	}
+	c.profile.Store(&profile)
+	c.transferLimits = opts.TransferLimits
+
+	c.maxFrameSize = opts.MaxFrameSize
+	if c.maxFrameSize == 0 {
+		c.maxFrameSize = MAX_PACKET_SIZE
+	}
+	if c.maxFrameSize < MIN_FRAME_SIZE {
+		return nil, fmt.Errorf("invalid max frame size: %d bytes, at least %d required", c.maxFrameSize, MIN_FRAME_SIZE)
+	}
+	c.receiveBufferSize = opts.ReceiveBufferSize
+	if c.receiveBufferSize <= 0 {
+		c.receiveBufferSize = DEFAULT_RECEIVE_BUFFER
+	}
+	c.scannerBufferSize = min(opts.ScannerBufferSize, c.maxFrameSize)
+	if c.scannerBufferSize <= 0 {
+		c.scannerBufferSize = c.maxFrameSize
+	}
 
-	for i := range c.resp {
-		c.resp[i] = make(chan Response, 1)
+	c.dialTimeout = opts.DialTimeout
+	if c.dialTimeout <= 0 {
+		c.dialTimeout = time.Duration(DEFAULT_CONNECT_TIMEOUT) * time.Millisecond
+	}
+	c.handshakeTimeout = opts.HandshakeTimeout
+	if c.handshakeTimeout <= 0 {
+		c.handshakeTimeout = time.Duration(DEFAULT_HANDSHAKE_TIMEOUT) * time.Millisecond
 	}
+	c.keepAlive = opts.KeepAlive
+	c.clientNode = opts.ClientNode
+	c.keepAliveProbe = opts.KeepAliveProbe
+	c.halfOpenTimeout = opts.HalfOpenTimeout
+	c.nodeAllocator = opts.NodeAllocator
+
+	c.reconnectBackoff = opts.ReconnectBackoff
+	if c.reconnectBackoff == nil {
+		c.reconnectBackoff = defaultBackoff
+	}
+	c.reconnectMaxElapsed = opts.ReconnectMaxElapsed
+	c.onReconnectAttempt = opts.OnReconnectAttempt
+	c.onConnect = opts.OnConnect
+	c.onDisconnect = opts.OnDisconnect
+	c.onReconnectSuccess = opts.OnReconnectSuccess
+	c.verifyUpdates = opts.VerifyUpdates
+	c.middleware = append([]Middleware(nil), opts.Middleware...)
+	c.writeGuard = opts.WriteGuard
+	c.auditSink = opts.AuditSink
+	c.auditReadBefore = opts.AuditReadBefore
+	c.dryRun = opts.DryRun
+	c.delivery = opts.ResponseDelivery
+
+	conn, err := c.dial()
+	if err != nil {
+		return nil, fmt.Errorf("failed to establish TCP connection: %w", err)
+	}
+
+	c.setConnection(conn)
+	c.resp = make(map[uint8]*pendingResponse)
 
 	err = c.sendConnectionRequest()
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 
-	go c.listenLoop()
+	c.commands = make(chan []byte, INCOMING_COMMAND_QUEUE)
+	c.commandStop = make(chan struct{})
+	go c.commandLoop(c.commands, c.commandStop)
+	c.startListenLoop()
+
+	if opts.SessionKeepAlive > 0 {
+		c.keepAliveStop = make(chan struct{})
+		go c.keepAliveLoop(opts.SessionKeepAlive, c.keepAliveStop)
+	}
+
+	if opts.Profile == nil && opts.DetectProfile {
+		if err := c.detectProfile(); err != nil {
+			log.Printf("Profile detection failed, using %s: %v", c.Profile().Name, err)
+		}
+	}
+
+	if c.onConnect != nil {
+		c.onConnect(c.connectionEvent())
+	}
 	return c, nil
 }
 
@@ -80,21 +269,24 @@ func (c *Client) Close() error {
 	c.Lock()
 	defer c.Unlock()
 
-	if c.closed {
+	if c.closed.Load() {
 		return nil
 	}
 
-	c.closed = true
-
-	c.respMutex.Lock()
-	for sid, ch := range c.resp {
-		close(ch)
-		delete(c.resp, sid)
+	c.closed.Store(true)
+	c.releaseNode()
+	if c.keepAliveStop != nil {
+		close(c.keepAliveStop)
 	}
-	c.respMutex.Unlock()
+	close(c.commandStop)
+
+	c.failPending()
 
-	if c.conn != nil {
-		return c.conn.Close()
+	// A running reconnect notices the closed client and gives up
+	if conn := c.connection(); conn != nil {
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			return err
+		}
 	}
 
 	return nil
@@ -104,65 +296,210 @@ func checkResponse(r *Response, e error) error {
 	if e != nil {
 		return e
 	}
-	if r.endCode != mapping.EndCodeNormalCompletion {
-		return fmt.Errorf("error reported by destination, end code 0x%x", r.endCode)
+	if r.EndCode != mapping.EndCodeNormalCompletion {
+		return EndCodeError{CommandCode: r.CommandCode, EndCode: r.EndCode}
+	}
+	return nil
+}
+
+// checkDataLength returns a ProtocolError unless the response of a read carries exactly want bytes
+func checkDataLength(r *Response, want int, read string) error {
+	if len(r.Data) != want {
+		return ProtocolError{SID: r.Header.SID, Reason: fmt.Sprintf("%s response holds %d data bytes, expected %d", read, len(r.Data), want)}
+	}
+	return nil
+}
+
+// checkMinDataLength returns a ProtocolError when the response of a read carries fewer than min bytes
+func checkMinDataLength(r *Response, min int, read string) error {
+	if len(r.Data) < min {
+		return ProtocolError{SID: r.Header.SID, Reason: fmt.Sprintf("%s response holds %d data bytes, expected at least %d", read, len(r.Data), min)}
+	}
+	return nil
+}
+
+// validateResponse checks that a response answers the request sent with header and command code
+func validateResponse(req Header, commandCode uint16, resp Response) error {
+	if resp.CommandCode != commandCode {
+		return ProtocolError{SID: req.SID, Reason: fmt.Sprintf("response command %s does not match request %s", mapping.CommandCode(resp.CommandCode), mapping.CommandCode(commandCode))}
+	}
+
+	h := resp.Header
+	if h.DNA != req.SNA || h.DA1 != req.SA1 || h.DA2 != req.SA2 {
+		return ProtocolError{SID: req.SID, Reason: fmt.Sprintf("response destination %d.%d.%d is not the request source %d.%d.%d",
+			h.DNA, h.DA1, h.DA2, req.SNA, req.SA1, req.SA2)}
+	}
+	if h.SNA != req.DNA || h.SA1 != req.DA1 || h.SA2 != req.DA2 {
+		return ProtocolError{SID: req.SID, Reason: fmt.Sprintf("response source %d.%d.%d is not the request destination %d.%d.%d",
+			h.SNA, h.SA1, h.SA2, req.DNA, req.DA1, req.DA2)}
 	}
 	return nil
 }
 
 func (c *Client) sendCommand(command []byte) (*Response, error) {
-	if c.closed {
-		return nil, fmt.Errorf("connection is closed")
+	c.Lock()
+	middleware := c.middleware
+	c.Unlock()
+
+	var s Sender = SenderFunc(c.roundTrip)
+	for i := len(middleware) - 1; i >= 0; i-- {
+		s = middleware[i](s)
 	}
+	return s.SendCommand(command)
+}
 
-	commandLength := len(command)
-	c.sendInitFrame((18 + commandLength), 2, false)
+// roundTrip sends a command and waits for its response
+func (c *Client) roundTrip(command []byte) (resp *Response, err error) {
+	if c.closed.Load() {
+		return nil, fmt.Errorf("connection is closed")
+	}
 
-	header := c.nextHeader()
-	fullPacket := encodeHeader(*header)
-	fullPacket = append(fullPacket, command...)
+	if err := c.checkCommand(command); err != nil {
+		return nil, err
+	}
+	if err := c.guardWrite(command); err != nil {
+		return nil, err
+	}
+	if audit := c.startAudit(command); audit != nil {
+		defer func() { c.finishAudit(audit, checkResponse(resp, err)) }()
+	}
+	if resp, ok := c.skipDryRun(command); ok {
+		return resp, nil
+	}
 
-	log.Printf("📨 Sending FINS command - Service ID: %d", header.sid) // TODO: remove trace
-	log.Printf("FullPacket: % X", fullPacket)                         // TODO: remove trace
+	release := c.acquireSlot(c.commandPriorityOf(command))
+	defer release()
 
-	responseChan := make(chan Response, 1)
+	header, pending, err := c.nextPendingHeader()
+	if err != nil {
+		return nil, err
+	}
+	var quarantine time.Duration // Keeps the SID reserved after a timeout
+	defer func() { c.finish(header.SID, pending, quarantine) }()
 
-	c.respMutex.Lock()
-	c.resp[header.sid] = responseChan
-	c.respMutex.Unlock()
+	commandCode := binary.BigEndian.Uint16(command[0:2])
+	sent := c.diagnostics.start(header.SID, commandCode)
+	defer func() {
+		c.diagnostics.finish(header.SID, commandCode, sent, resp, err)
+	}()
 
+	bufPtr := packetPool.Get().(*[]byte)
+	fullPacket := appendCommandFrame((*bufPtr)[:0], header, command)
 	defer func() {
-		c.respMutex.Lock()
-		delete(c.resp, header.sid)
-		c.respMutex.Unlock()
+		*bufPtr = fullPacket[:0]
+		packetPool.Put(bufPtr)
 	}()
 
-	_, err := c.conn.Write(fullPacket)
+	conn, err := c.readyConnection()
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Write(fullPacket)
 	if err != nil {
 		log.Printf("❌ Failed to send initiation packet!")
 		return nil, fmt.Errorf("failed to send packet: %w", err)
 	}
-	log.Printf("Command sent successfully") // TODO: remove trace
 
 	// Wait for response with timeout
-	timeout := time.Duration(c.responseTimeoutMs) * time.Millisecond
+	timeout := c.timeout
+	if timeout == 0 {
+		timeout = time.Duration(c.responseTimeoutMs.Load()) * time.Millisecond
+	}
 	if timeout == 0 {
 		timeout = 10 * time.Second
 	}
 
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var ans Response
 	select {
-	case resp, ok := <-responseChan:
-		if !ok {
+	case ans = <-pending.ch:
+	case <-pending.done:
+		// A response that arrived before the connection was lost is still taken
+		select {
+		case ans = <-pending.ch:
+		default:
+			if pending.err != nil {
+				return nil, pending.err
+			}
 			return nil, fmt.Errorf("response channel closed")
 		}
-		log.Printf("Response received - Command Code: %04X, End Code: %04X", resp.commandCode, resp.endCode)
-		return &resp, nil
-	case <-time.After(timeout):
-		return nil, fmt.Errorf("response timeout after %v", timeout)
+	case <-timer.C:
+		select {
+		case ans = <-pending.ch:
+		default:
+			quarantine = timeout
+			c.checkHalfOpen()
+			return nil, fmt.Errorf("response timeout after %v", timeout)
+		}
+	}
+	if err := validateResponse(header, commandCode, ans); err != nil {
+		return nil, err
+	}
+	return &ans, nil
+}
+
+// sendCommandNoAck sends a command with the "response not required" ICF flag and returns
+// as soon as it is written, only send errors are reported
+func (c *Client) sendCommandNoAck(command []byte) (err error) {
+	if c.closed.Load() {
+		return fmt.Errorf("connection is closed")
+	}
+
+	if err := c.checkCommand(command); err != nil {
+		return err
+	}
+	if err := c.guardWrite(command); err != nil {
+		return err
+	}
+	if audit := c.startAudit(command); audit != nil {
+		defer func() { c.finishAudit(audit, err) }()
+	}
+	if _, ok := c.skipDryRun(command); ok {
+		return nil
+	}
+
+	release := c.acquireSlot(c.commandPriorityOf(command))
+	defer release()
+
+	header := c.nextHeader()
+	header.ICF |= ICFResponseNotRequired
+
+	bufPtr := packetPool.Get().(*[]byte)
+	fullPacket := appendCommandFrame((*bufPtr)[:0], header, command)
+	defer func() {
+		*bufPtr = fullPacket[:0]
+		packetPool.Put(bufPtr)
+	}()
+
+	conn, err := c.readyConnection()
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(fullPacket); err != nil {
+		return fmt.Errorf("failed to send packet: %w", err)
 	}
+	return nil
 }
 
-func (c *Client) sendInitFrame(length, commandCode int, initCon bool) error {
+// packetPool recycles command frame buffers between requests
+var packetPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, MAX_PACKET_SIZE)
+		return &b
+	},
+}
+
+// appendCommandFrame appends the FINS/TCP frame header (command 2, send frame),
+// the FINS header and the command to dst
+func appendCommandFrame(dst []byte, header Header, command []byte) []byte {
+	dst = finsproto.AppendTCPHeader(dst, TCP_COMMAND_FRAME_SEND, FINS_HEADER_LENGTH+len(command))
+	dst = finsproto.AppendHeader(dst, header)
+	return append(dst, command...)
+}
+
+func (c *Client) sendInitFrame(length, commandCode int, initCon bool, clientNode byte) error {
 	initFrame := []byte{
 		0x46, 0x49, 0x4E, 0x53, // "FINS"
 		0x00, 0x00, 0x00, byte(length), // Length
@@ -171,7 +508,7 @@ func (c *Client) sendInitFrame(length, commandCode int, initCon bool) error {
 	}
 
 	if initCon {
-		initFrame = append(initFrame, 0x00, 0x00, 0x00, 0x00) // Client node address (0 = auto-assign)
+		initFrame = append(initFrame, 0x00, 0x00, 0x00, clientNode) // Client node address (0 = auto-assign)
 	}
 
 	log.Printf("Sending init frame: %02X with the connection: %+v", initFrame, c.conn) // TODO: remove trace
@@ -182,56 +519,196 @@ func (c *Client) sendInitFrame(length, commandCode int, initCon bool) error {
 	return nil
 }
 
-func (c *Client) sendConnectionRequest() error {
-	err := c.sendInitFrame(12, 0, true)
+// connection returns the current connection, Reconnect replaces it
+func (c *Client) connection() net.Conn {
+	c.connMutex.RLock()
+	defer c.connMutex.RUnlock()
+	return c.conn
+}
+
+// readyConnection returns the current connection for commands. While a reconnect is still
+// negotiating the session, commands fail right away instead of waiting for their timeout.
+func (c *Client) readyConnection() (net.Conn, error) {
+	if c.closed.Load() {
+		return nil, fmt.Errorf("connection is closed")
+	}
+	c.connMutex.RLock()
+	defer c.connMutex.RUnlock()
+	if !c.ready {
+		return nil, fmt.Errorf("connection is not established")
+	}
+	return c.conn, nil
+}
+
+// setReady marks whether commands may use conn, a replaced connection stays not ready
+func (c *Client) setReady(conn net.Conn, ready bool) {
+	c.connMutex.Lock()
+	if c.conn == conn {
+		c.ready = ready
+	}
+	c.connMutex.Unlock()
+}
+
+// setConnection replaces the connection and its reader, the caller holds connLock or owns the client
+func (c *Client) setConnection(conn net.Conn) {
+	c.connMutex.Lock()
+	c.conn = conn
+	c.ready = false
+	c.connMutex.Unlock()
+	c.reader = bufio.NewReaderSize(conn, c.receiveBufferSize)
+}
+
+// dial opens the TCP connection to the PLC with the configured timeouts
+func (c *Client) dial() (net.Conn, error) {
+	dialer := net.Dialer{
+		Timeout:   c.dialTimeout,
+		KeepAlive: c.keepAlive,
+	}
+	return dialer.Dial("tcp", c.plcAddr.tcpAddress.String())
+}
+
+// sendConnectionRequest negotiates the node addresses on the current connection, the caller
+// holds connLock or owns the client
+func (c *Client) sendConnectionRequest() (err error) {
+	if err := c.conn.SetReadDeadline(time.Now().Add(c.handshakeTimeout)); err != nil {
+		return fmt.Errorf("failed to set handshake deadline: %w", err)
+	}
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	requested, err := c.allocateNode()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			c.Lock()
+			c.releaseNode()
+			c.Unlock()
+		}
+	}()
+
+	err = c.sendInitFrame(12, 0, true, requested)
 	if err != nil {
 		return err
 	}
 
-	// Read response
-	response := make([]byte, 24)
-	n, err := c.reader.Read(response)
-	if err != nil || n < 16 {
-		return fmt.Errorf("failed to receive connection response: %v", err)
+	// Read the header first, a rejected request has no payload
+	header := make([]byte, finsproto.TCP_HEADER_LENGTH)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return fmt.Errorf("failed to receive connection response: %w", err)
 	}
 
 	// Verify response header
-	if !bytes.Equal(response[0:4], []byte{0x46, 0x49, 0x4E, 0x53}) { // "FINS"
+	if !bytes.Equal(header[0:4], []byte{0x46, 0x49, 0x4E, 0x53}) { // "FINS"
 		return fmt.Errorf("invalid FINS response header")
 	}
+	if code := binary.BigEndian.Uint32(header[12:16]); code != 0 {
+		return HandshakeError{PLC: c.plcAddr.tcpAddress.String(), Node: requested, Code: code}
+	}
+	if length := binary.BigEndian.Uint32(header[4:8]); length != 16 {
+		return fmt.Errorf("invalid connection response length: %d", length)
+	}
 
-	clientNode := response[19] // Client node assigned by PLC
-	serverNode := response[23] // Server node
+	response := make([]byte, 8)
+	if _, err := io.ReadFull(c.reader, response); err != nil {
+		return fmt.Errorf("failed to receive connection response: %w", err)
+	}
+
+	clientNode := response[3] // Client node assigned by PLC
+	serverNode := response[7] // Server node
 
 	log.Printf("✅ Connection established. Client Node: %d, Server Node: %d Response: %02X", clientNode, serverNode, response) // TODO: remove?
 
 	// Store these values for later messages
+	c.Lock()
 	c.src.node = clientNode
 	c.dst.node = serverNode
+	c.Unlock()
 
 	return nil
 }
 
+// allocateNode returns the client node to request for the current connection. The node of
+// the previous connection is released first.
+func (c *Client) allocateNode() (byte, error) {
+	c.Lock()
+	c.releaseNode()
+	c.Unlock()
+	if c.nodeAllocator == nil {
+		return c.clientNode, nil
+	}
+
+	node, release, err := c.nodeAllocator.AllocateNode(c.conn.LocalAddr(), c.conn.RemoteAddr())
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate client node: %w", err)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.closed.Load() {
+		release()
+		return 0, fmt.Errorf("connection is closed")
+	}
+	c.nodeRelease = release
+	return node, nil
+}
+
+// releaseNode releases the node of the current connection, the caller holds the lock
+func (c *Client) releaseNode() {
+	if c.nodeRelease != nil {
+		c.nodeRelease()
+		c.nodeRelease = nil
+	}
+}
+
+// ClientNode returns the client node of the current connection
+func (c *Client) ClientNode() byte {
+	c.Lock()
+	defer c.Unlock()
+	return c.src.node
+}
+
 // Set response timeout duration (ms).
 // Default value: 20ms.
 // A timeout of zero can be used to block indefinitely.
 func (c *Client) SetTimeoutMs(t uint) {
-	c.responseTimeoutMs = time.Duration(t)
+	c.responseTimeoutMs.Store(int64(t))
+}
+
+// WithTimeout returns a client handle waiting at most d for each response.
+// The handle shares the connection with c, so a quick status poll and a bulk read can use
+// different timeouts on the same client. A d of zero uses the timeout set with SetTimeoutMs.
+func (c *Client) WithTimeout(d time.Duration) *Client {
+	h := *c
+	h.timeout = max(d, 0)
+	return &h
 }
 
-// SetKeepAlive enables keepalive with the specified interval
+// SetKeepAlive enables keepalive with the specified interval.
+// The setting is reapplied to the new connection after Reconnect.
 func (c *Client) SetKeepAlive(enabled bool, interval time.Duration) error {
-	tcpConn, ok := c.conn.(*net.TCPConn)
+	c.Lock()
+	defer c.Unlock()
+
+	c.keepAliveSet = true
+	c.keepAliveEnabled = enabled
+	c.keepAliveInterval = interval
+	return c.applyKeepAlive(c.connection())
+}
+
+// applyKeepAlive applies the keep-alive setting to conn, the caller holds the lock
+func (c *Client) applyKeepAlive(conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
 	if !ok {
 		return fmt.Errorf("connection is not TCP")
 	}
 
-	if err := tcpConn.SetKeepAlive(enabled); err != nil {
+	if err := tcpConn.SetKeepAlive(c.keepAliveEnabled); err != nil {
 		return err
 	}
 
-	if enabled {
-		return tcpConn.SetKeepAlivePeriod(interval)
+	if c.keepAliveEnabled {
+		return tcpConn.SetKeepAlivePeriod(c.keepAliveInterval)
 	}
 	return nil
 }
@@ -0,0 +1,112 @@
+package fins
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_CLOCK_SYNC_INTERVAL  = time.Hour
+	DEFAULT_CLOCK_SYNC_THRESHOLD = 2 * time.Second
+)
+
+// ClockSyncOptions configures a ClockSync, zero values use the defaults
+type ClockSyncOptions struct {
+	Interval  time.Duration          // Time between checks, 1h by default
+	Threshold time.Duration          // Largest drift left uncorrected, 2s by default
+	OnEvent   func(e ClockSyncEvent) // Audit hook called after every check
+}
+
+// ClockSyncEvent is the outcome of one clock check
+type ClockSyncEvent struct {
+	Checked   time.Time     // Host time of the check
+	PLCTime   time.Time     // PLC clock before a correction
+	Drift     time.Duration // PLC clock minus host time
+	Corrected bool          // The PLC clock was written
+	Err       error
+}
+
+// ClockSync periodically compares the PLC clock with the host clock and
+// writes the host time to the PLC when the drift exceeds the threshold
+type ClockSync struct {
+	sync.Mutex
+	client *Client
+	opts   ClockSyncOptions
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewClockSync starts synchronizing the clock of the PLC behind c, the first check runs immediately
+func NewClockSync(c *Client, opts ClockSyncOptions) *ClockSync {
+	if opts.Interval <= 0 {
+		opts.Interval = DEFAULT_CLOCK_SYNC_INTERVAL
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = DEFAULT_CLOCK_SYNC_THRESHOLD
+	}
+	s := &ClockSync{
+		client: c,
+		opts:   opts,
+		done:   make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.loop()
+	return s
+}
+
+// SyncNow checks the clock immediately and corrects it if needed
+func (s *ClockSync) SyncNow() ClockSyncEvent {
+	e := ClockSyncEvent{Checked: time.Now()}
+	plcTime, err := s.client.ReadClock()
+	if err != nil {
+		e.Err = err
+		return s.report(e)
+	}
+
+	// The PLC clock has a resolution of one second, drifts below that are not measurable
+	e.PLCTime = *plcTime
+	e.Drift = plcTime.Sub(e.Checked.Truncate(time.Second))
+	if e.Drift.Abs() > s.opts.Threshold {
+		e.Err = s.client.WriteClock(time.Now())
+		e.Corrected = e.Err == nil
+	}
+	return s.report(e)
+}
+
+// Close stops the periodic checks and waits for a running check to finish
+func (s *ClockSync) Close() {
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return
+	}
+	s.closed = true
+	s.Unlock()
+
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *ClockSync) loop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.SyncNow()
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ClockSync) report(e ClockSyncEvent) ClockSyncEvent {
+	if s.opts.OnEvent != nil {
+		s.opts.OnEvent(e)
+	}
+	return e
+}
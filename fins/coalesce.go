@@ -0,0 +1,116 @@
+package fins
+
+import (
+	"folke99/gofins/mapping"
+	"sort"
+)
+
+// readBlock is a range of words read with one command for the tags it covers
+type readBlock struct {
+	area  mapping.MemoryArea
+	first uint16
+	count int
+	tags  []int // Indexes of the tags covered
+	gap   int   // Words read only to bridge gaps between the tags
+}
+
+// tagReads counts the reads of the tags of one cycle
+type tagReads struct {
+	reads    int
+	tags     int
+	gap      int
+	deferred int // Tags not due in the cycle of an adaptive group
+}
+
+// wordRange returns the word area, first word and word count holding the value of t, ok is
+// false for tags a coalesced read can't cover
+func wordRange(t Tag) (area mapping.MemoryArea, count int, ok bool) {
+	if t.Variable != "" {
+		return 0, 0, false
+	}
+	if t.DataType == DataTypeBool {
+		area, ok = t.MemoryArea.WordArea()
+		return area, 1, ok && t.BitOffset < 16
+	}
+	n, err := t.DataType.WordCount()
+	if err != nil || !mapping.CheckIsWordMemoryArea(t.MemoryArea) {
+		return 0, 0, false
+	}
+	return t.MemoryArea, int(n), true
+}
+
+// planReads groups the tags into blocks of tags in the same area with at most maxGap unused
+// words between them, no longer than the read limit of the area. Tags a block can't cover
+// are returned as single, to be read on their own.
+func (c *Client) planReads(tags []Tag, maxGap uint16) (blocks []readBlock, single []int) {
+	type item struct {
+		index int
+		area  mapping.MemoryArea
+		count int
+	}
+	items := make([]item, 0, len(tags))
+	for i, t := range tags {
+		area, count, ok := wordRange(t)
+		if !ok {
+			single = append(single, i)
+			continue
+		}
+		items = append(items, item{i, area, count})
+	}
+	sort.SliceStable(items, func(a, b int) bool {
+		if items[a].area != items[b].area {
+			return items[a].area < items[b].area
+		}
+		return tags[items[a].index].Address < tags[items[b].index].Address
+	})
+
+	for _, it := range items {
+		address := int(tags[it.index].Address)
+		if n := len(blocks); n > 0 {
+			b := &blocks[n-1]
+			end := int(b.first) + b.count
+			newEnd := max(end, address+it.count)
+			if b.area == it.area && address <= end+int(maxGap) && newEnd-int(b.first) <= c.maxReadWords(it.area) {
+				b.gap += max(address-end, 0)
+				b.count = newEnd - int(b.first)
+				b.tags = append(b.tags, it.index)
+				continue
+			}
+		}
+		blocks = append(blocks, readBlock{area: it.area, first: uint16(address), count: it.count, tags: []int{it.index}})
+	}
+	return blocks, single
+}
+
+// readCoalesced reads the tags with as few commands as planReads allows. A failed read fails
+// all tags of its block.
+func (c *Client) readCoalesced(tags []Tag, maxGap uint16) ([]TagValue, tagReads) {
+	values := make([]TagValue, len(tags))
+	blocks, single := c.planReads(tags, maxGap)
+	stats := tagReads{reads: len(blocks) + len(single), tags: len(tags)}
+
+	for _, b := range blocks {
+		stats.gap += b.gap
+		words, err := c.ReadWords(b.area, b.first, uint16(b.count))
+		for _, i := range b.tags {
+			t := tags[i]
+			values[i].Tag = t
+			if err != nil {
+				values[i].Err = err
+				continue
+			}
+			offset := int(t.Address - b.first)
+			if t.DataType == DataTypeBool {
+				values[i].Value = float64(words[offset] >> t.BitOffset & 1)
+				continue
+			}
+			count, _ := t.DataType.WordCount()
+			values[i].Value = decodeTagValue(t.DataType, t.WordOrder.toLowFirst(words[offset:offset+int(count)]))
+		}
+	}
+	for _, i := range single {
+		values[i].Tag = tags[i]
+		values[i].Value, values[i].Err = c.ReadTag(tags[i])
+	}
+	return values, stats
+}
@@ -0,0 +1,43 @@
+package fins
+
+import (
+	"fmt"
+	"math"
+)
+
+// ConvertFloat32ToOmronData converts a float to the two words of an Omron REAL, low word first.
+// The conversion is exact, the words hold the IEEE 754 bits of value.
+func ConvertFloat32ToOmronData(value float32) ([]uint16, error) {
+	bits := math.Float32bits(value)
+	return []uint16{uint16(bits), uint16(bits >> 16)}, nil
+}
+
+// ConvertToFloat32 converts the two words of an Omron REAL, low word first, to a float.
+// The value is not rounded, use RoundReal to format it for display.
+func ConvertToFloat32(arr []uint16) (float32, error) {
+	if len(arr) < 2 {
+		return 0, fmt.Errorf("a REAL needs 2 words, got %d", len(arr))
+	}
+	return math.Float32frombits(uint32(arr[1])<<16 | uint32(arr[0])), nil
+}
+
+// ConvertFloat64ToOmronData converts a float to the four words of an Omron LREAL, low word first
+func ConvertFloat64ToOmronData(value float64) ([]uint16, error) {
+	bits := math.Float64bits(value)
+	return []uint16{uint16(bits), uint16(bits >> 16), uint16(bits >> 32), uint16(bits >> 48)}, nil
+}
+
+// ConvertToFloat64 converts the four words of an Omron LREAL, low word first, to a float
+func ConvertToFloat64(arr []uint16) (float64, error) {
+	if len(arr) < 4 {
+		return 0, fmt.Errorf("an LREAL needs 4 words, got %d", len(arr))
+	}
+	return math.Float64frombits(uint64(arr[3])<<48 | uint64(arr[2])<<32 | uint64(arr[1])<<16 | uint64(arr[0])), nil
+}
+
+// RoundReal rounds value to the given number of decimals, for display only since the
+// result is generally not the value stored in the PLC
+func RoundReal(value float32, decimals int) float32 {
+	scale := math.Pow(10, float64(decimals))
+	return float32(math.Round(float64(value)*scale) / scale)
+}
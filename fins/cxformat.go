@@ -0,0 +1,114 @@
+package fins
+
+import (
+	"encoding/csv"
+	"fmt"
+	"folke99/gofins/mapping"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CSV_WORDS_PER_ROW is the number of words per row of the CX-Programmer memory CSV,
+// rows start at addresses that are a multiple of it
+const CSV_WORDS_PER_ROW = 10
+
+// WriteCSV writes the snapshot in the CSV layout of the CX-Programmer PLC memory window:
+// one row per ten words, labelled with the address of the first word ("D00100", "E2_00100"
+// in EM bank 2), values as four hex digits. Cells outside the snapshot are left empty.
+//
+// CXT files, the text project export of CX-Programmer, are not supported: their format is
+// undocumented, memory is exchanged through the CSV export of the memory window.
+func (s *Snapshot) WriteCSV(w io.Writer) error {
+	prefix, ok := s.MemoryArea.AddressPrefix()
+	if !ok {
+		return fmt.Errorf("memory area %s can't be exported as CSV", s.MemoryArea)
+	}
+	width := 4
+	if _, em := s.MemoryArea.EMBank(); em || s.MemoryArea == mapping.MemoryAreaDMWord || s.MemoryArea == mapping.MemoryAreaEMCurrentWord {
+		width = 5
+	}
+
+	cw := csv.NewWriter(w)
+	end := int(s.Start) + len(s.Words)
+	for row := int(s.Start) - int(s.Start)%CSV_WORDS_PER_ROW; row < end; row += CSV_WORDS_PER_ROW {
+		record := make([]string, 1+CSV_WORDS_PER_ROW)
+		record[0] = fmt.Sprintf("%s%0*d", prefix, width, row)
+		for i := range CSV_WORDS_PER_ROW {
+			if address := row + i; address >= int(s.Start) && address < end {
+				record[1+i] = fmt.Sprintf("%04X", s.Words[address-int(s.Start)])
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadSnapshotCSV reads a CSV in the layout written by WriteCSV, as exported by CX-Programmer.
+// The words must form one contiguous range of a single memory area, values may carry a
+// "#" or "0x" prefix.
+func ReadSnapshotCSV(r io.Reader) (*Snapshot, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var s *Snapshot
+	next := -1 // Address of the next word of the range, -1 before the first word
+	ended := false
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		area, row, bit, err := mapping.ParseAddress(record[0])
+		if err != nil || bit >= 0 {
+			return nil, fmt.Errorf("line %d: invalid address %q", line, record[0])
+		}
+		if s == nil {
+			s = &Snapshot{MemoryArea: area}
+		} else if area != s.MemoryArea {
+			return nil, fmt.Errorf("line %d: memory area %s differs from %s", line, area, s.MemoryArea)
+		}
+
+		for i, cell := range record[1:] {
+			cell = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(cell), "#"), "0x")
+			address := int(row) + i
+			if cell == "" {
+				if next >= 0 {
+					ended = true
+				}
+				continue
+			}
+			if address > 0xFFFF {
+				return nil, fmt.Errorf("line %d: address %d out of range", line, address)
+			}
+			if ended || (next >= 0 && address != next) {
+				return nil, fmt.Errorf("line %d: address %d doesn't continue the range ending at %d", line, address, next-1)
+			}
+			word, err := strconv.ParseUint(cell, 16, 16)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid value %q", line, cell)
+			}
+			if next < 0 {
+				s.Start = uint16(address)
+			}
+			s.Words = append(s.Words, uint16(word))
+			next = address + 1
+		}
+	}
+
+	if s == nil || len(s.Words) == 0 {
+		return nil, fmt.Errorf("CSV contains no values")
+	}
+	return s, nil
+}
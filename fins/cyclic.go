@@ -0,0 +1,232 @@
+package fins
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PollGroup is a set of tags read together once per period
+type PollGroup struct {
+	Name     string
+	Tags     []Tag
+	Period   time.Duration
+	Phase    time.Duration      // Offset of the cycles within the period, so groups don't start at the same instant
+	OnSample func(s PollSample) // Called after every cycle with the values read
+
+	// Scan counter or clock word of the PLC read with every cycle, so consumers can relate
+	// the values to PLC scans rather than to the time they arrived. Optional.
+	Stamp *Tag
+
+	// Coalesce reads tags of the same area with at most MaxGap unused words between them
+	// with one command, up to the read limit of the area, rather than one command per tag.
+	// Variable tags are always read on their own. Optional.
+	Coalesce bool
+	MaxGap   uint16
+
+	// MaxPeriod above Period polls adaptively: a tag found unchanged is read half as often
+	// as before, down to once per MaxPeriod, and a tag that changed is read every Period
+	// again. Optional.
+	MaxPeriod time.Duration
+}
+
+// PollSample is the outcome of one cycle of a poll group
+type PollSample struct {
+	Group     string
+	Cycle     int64     // Number of the cycle since the poller started
+	Scheduled time.Time // Planned start of the cycle
+	Started   time.Time
+	Duration  time.Duration
+	Values    []TagValue
+	Fresh     []bool    // Whether each value was read in this cycle, set for adaptive groups only
+	Stamp     *TagValue // Stamp tag of the group, read right before the values
+	Overrun   bool      // The cycle ended after the start of the next one
+	Skipped   int       // Cycles skipped because of the overrun
+}
+
+// PollStats summarizes the cycles of a poll group
+type PollStats struct {
+	Cycles      int64
+	Overruns    int64
+	Skipped     int64
+	MaxDuration time.Duration
+	MaxLateness time.Duration // Largest delay of a cycle start behind its schedule
+
+	// Reads of the tags, without the stamp tag, to tune the tag layout for coalescing
+	Reads    int64 // Read commands sent
+	TagReads int64 // Tag values read
+	GapWords int64 // Words read only to bridge gaps between coalesced tags
+	Deferred int64 // Tag reads saved by adaptive polling
+}
+
+// TagsPerRead returns the tag values read per command, 1 without coalescing
+func (s PollStats) TagsPerRead() float64 {
+	if s.Reads == 0 {
+		return 0
+	}
+	return float64(s.TagReads) / float64(s.Reads)
+}
+
+// CyclicPoller reads poll groups on a fixed schedule for applications that need predictable
+// sampling. Cycle n of a group starts at the poller start + Phase + n*Period, independent of
+// how long earlier cycles took, so groups don't drift against each other. A cycle that ends
+// after the start of the next one is an overrun, the cycles it overlaps are skipped rather
+// than run late.
+type CyclicPoller struct {
+	sync.Mutex
+	client *Client
+	start  time.Time
+	stats  map[string]*PollStats
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewCyclicPoller starts polling the groups through c, the first cycle of every group starts
+// after its phase
+func NewCyclicPoller(c *Client, groups []PollGroup) (*CyclicPoller, error) {
+	stats := make(map[string]*PollStats, len(groups))
+	for _, g := range groups {
+		if g.Period <= 0 {
+			return nil, fmt.Errorf("poll group %q: period must be positive", g.Name)
+		}
+		if g.Phase < 0 || g.Phase >= g.Period {
+			return nil, fmt.Errorf("poll group %q: phase %v is outside the period %v", g.Name, g.Phase, g.Period)
+		}
+		if g.MaxPeriod != 0 && g.MaxPeriod < g.Period {
+			return nil, fmt.Errorf("poll group %q: max period %v is below the period %v", g.Name, g.MaxPeriod, g.Period)
+		}
+		if _, ok := stats[g.Name]; ok {
+			return nil, fmt.Errorf("duplicate poll group %q", g.Name)
+		}
+		stats[g.Name] = &PollStats{}
+	}
+
+	p := &CyclicPoller{
+		client: c,
+		start:  time.Now(),
+		stats:  stats,
+		done:   make(chan struct{}),
+	}
+	for _, g := range groups {
+		p.wg.Add(1)
+		go p.loop(g)
+	}
+	return p, nil
+}
+
+// Stats returns the statistics of the named group
+func (p *CyclicPoller) Stats(group string) (PollStats, bool) {
+	p.Lock()
+	defer p.Unlock()
+	s, ok := p.stats[group]
+	if !ok {
+		return PollStats{}, false
+	}
+	return *s, true
+}
+
+// Close stops polling and waits for running cycles to finish
+func (p *CyclicPoller) Close() {
+	p.Lock()
+	if p.closed {
+		p.Unlock()
+		return
+	}
+	p.closed = true
+	p.Unlock()
+
+	close(p.done)
+	p.wg.Wait()
+}
+
+// scheduled returns the planned start of a cycle of g
+func (p *CyclicPoller) scheduled(g PollGroup, cycle int64) time.Time {
+	return p.start.Add(g.Phase + time.Duration(cycle)*g.Period)
+}
+
+func (p *CyclicPoller) loop(g PollGroup) {
+	defer p.wg.Done()
+
+	timer := time.NewTimer(time.Until(p.scheduled(g, 0)))
+	defer timer.Stop()
+	ad := newAdaptive(g)
+
+	for cycle := int64(0); ; {
+		select {
+		case <-p.done:
+			return
+		case <-timer.C:
+		}
+
+		s := PollSample{Group: g.Name, Cycle: cycle, Scheduled: p.scheduled(g, cycle), Started: time.Now()}
+		var reads tagReads
+		if g.Stamp != nil {
+			s.Stamp = &p.read([]Tag{*g.Stamp})[0]
+		}
+		if ad == nil {
+			s.Values, reads = p.readTags(g, g.Tags)
+		} else {
+			due := ad.dueTags(cycle)
+			tags := make([]Tag, len(due))
+			for j, i := range due {
+				tags[j] = g.Tags[i]
+			}
+			var values []TagValue
+			values, reads = p.readTags(g, tags)
+			s.Values, s.Fresh = ad.update(cycle, due, values)
+			reads.deferred = len(g.Tags) - len(due)
+		}
+		s.Duration = time.Since(s.Started)
+
+		// Continue with the first cycle that starts after this one ended
+		next := cycle + 1
+		if late := s.Started.Add(s.Duration).Sub(p.scheduled(g, next)); late > 0 {
+			next += int64((late + g.Period - 1) / g.Period)
+		}
+		s.Skipped = int(next - cycle - 1)
+		s.Overrun = s.Skipped > 0
+		p.record(s, reads)
+
+		if g.OnSample != nil {
+			g.OnSample(s)
+		}
+		cycle = next
+		timer.Reset(time.Until(p.scheduled(g, cycle)))
+	}
+}
+
+// readTags reads tags of g, with coalesced reads if g asks for them
+func (p *CyclicPoller) readTags(g PollGroup, tags []Tag) ([]TagValue, tagReads) {
+	if g.Coalesce {
+		return p.client.readCoalesced(tags, g.MaxGap)
+	}
+	return p.read(tags), tagReads{reads: len(tags), tags: len(tags)}
+}
+
+func (p *CyclicPoller) read(tags []Tag) []TagValue {
+	values := make([]TagValue, len(tags))
+	for i, t := range tags {
+		values[i].Tag = t
+		values[i].Value, values[i].Err = p.client.ReadTag(t)
+	}
+	return values
+}
+
+func (p *CyclicPoller) record(s PollSample, reads tagReads) {
+	p.Lock()
+	defer p.Unlock()
+
+	stats := p.stats[s.Group]
+	stats.Cycles++
+	stats.Skipped += int64(s.Skipped)
+	if s.Overrun {
+		stats.Overruns++
+	}
+	stats.MaxDuration = max(stats.MaxDuration, s.Duration)
+	stats.MaxLateness = max(stats.MaxLateness, s.Started.Sub(s.Scheduled))
+	stats.Reads += int64(reads.reads)
+	stats.TagReads += int64(reads.tags)
+	stats.GapWords += int64(reads.gap)
+	stats.Deferred += int64(reads.deferred)
+}
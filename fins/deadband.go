@@ -0,0 +1,97 @@
+package fins
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// DeadbandType selects when a subscription reports a new value of a tag
+type DeadbandType string
+
+const (
+	DeadbandNone     DeadbandType = ""         // Every change is reported
+	DeadbandAbsolute DeadbandType = "absolute" // A change of more than Value from the last reported value
+	DeadbandPercent  DeadbandType = "percent"  // A change of more than Value percent of Span, of the last reported value without a span
+	DeadbandIntegral DeadbandType = "integral" // The deviation from the last reported value integrated over time exceeds Value, in value×seconds
+)
+
+// Deadband suppresses reports of insignificant changes of a tag, as historians expect. An
+// integrating deadband reports a small lasting deviation eventually and a large one at once,
+// so the reported values track the area under the curve.
+type Deadband struct {
+	Type  DeadbandType `json:"type"`
+	Value float64      `json:"value"`
+	Span  float64      `json:"span,omitempty"` // Engineering range of the tag, for DeadbandPercent
+}
+
+// Validate checks the type and the bounds of the deadband
+func (d Deadband) Validate() error {
+	switch d.Type {
+	case DeadbandNone, DeadbandAbsolute, DeadbandPercent, DeadbandIntegral:
+	default:
+		return fmt.Errorf("unsupported deadband type: %q", d.Type)
+	}
+	if d.Value < 0 || math.IsNaN(d.Value) || d.Span < 0 || math.IsNaN(d.Span) {
+		return fmt.Errorf("deadband value %v and span %v must not be negative", d.Value, d.Span)
+	}
+	return nil
+}
+
+// DeadbandFilter applies the deadband of a tag to its successive readings. The first reading,
+// a failed read, a different error and the recovery from an error are always reported.
+type DeadbandFilter struct {
+	deadband Deadband
+	reported bool
+	value    float64 // Last reported value
+	errText  string  // Error of the last reported reading
+	integral float64
+	previous time.Time // Time of the previous reading
+}
+
+// NewDeadbandFilter creates a filter for d, reporting every change when d is nil
+func NewDeadbandFilter(d *Deadband) *DeadbandFilter {
+	f := &DeadbandFilter{}
+	if d != nil {
+		f.deadband = *d
+	}
+	return f
+}
+
+// Report reports whether the reading v taken at t is reported, it becomes the last reported
+// value then
+func (f *DeadbandFilter) Report(v TagValue, t time.Time) bool {
+	var errText string
+	if v.Err != nil {
+		errText = v.Err.Error()
+	}
+	report := !f.reported || errText != f.errText
+	if !report && errText == "" {
+		report = f.exceeded(v.Value, t)
+	}
+	f.previous = t
+	if report {
+		f.reported, f.value, f.errText, f.integral = true, v.Value, errText, 0
+	}
+	return report
+}
+
+// exceeded reports whether value leaves the deadband around the last reported value
+func (f *DeadbandFilter) exceeded(value float64, t time.Time) bool {
+	deviation := math.Abs(value - f.value)
+	switch f.deadband.Type {
+	case DeadbandAbsolute:
+		return deviation > f.deadband.Value
+	case DeadbandPercent:
+		span := f.deadband.Span
+		if span == 0 {
+			span = math.Abs(f.value)
+		}
+		return deviation > f.deadband.Value/100*span
+	case DeadbandIntegral:
+		f.integral += deviation * t.Sub(f.previous).Seconds()
+		return f.integral > f.deadband.Value
+	default:
+		return value != f.value
+	}
+}
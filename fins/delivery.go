@@ -0,0 +1,175 @@
+package fins
+
+import (
+	"log"
+	"time"
+)
+
+// MIN_SID_QUARANTINE is the shortest time the SID of a command that timed out stays reserved
+// for its late response
+const MIN_SID_QUARANTINE = time.Second
+
+// DeliveryPolicy decides what the listen loop does with a response for a command that
+// hasn't taken the previous response for its SID yet, e.g. a duplicate sent by a gateway.
+// Every command receives at most one response under all policies.
+type DeliveryPolicy int
+
+const (
+	DeliveryDrop    DeliveryPolicy = iota // Keep the response waiting for the command, discard the new one
+	DeliveryReplace                       // Discard the response waiting for the command, keep the new one
+	DeliveryBlock                         // Hand responses over directly, the listen loop waits until the command takes it or gives up
+)
+
+func (p DeliveryPolicy) String() string {
+	switch p {
+	case DeliveryDrop:
+		return "Drop"
+	case DeliveryReplace:
+		return "Replace"
+	case DeliveryBlock:
+		return "Block"
+	default:
+		return "Unknown"
+	}
+}
+
+// pendingResponse is the registration of a command waiting for the response to its SID
+type pendingResponse struct {
+	ch       chan Response // Buffered, except for DeliveryBlock
+	done     chan struct{} // Closed once the command stopped waiting
+	finished bool          // done is closed, guarded by respMutex
+	err      error         // Why the command can't get a response, set before done is closed
+	// A command that gave up keeps its SID reserved until expires, so its late response
+	// can't be taken for the response of a new command using the same SID
+	expires time.Time
+}
+
+// register reserves sid for a command waiting for its response, the caller holds respMutex
+func (c *Client) register(sid byte) *pendingResponse {
+	p := &pendingResponse{done: make(chan struct{})}
+	if c.delivery == DeliveryBlock {
+		p.ch = make(chan Response)
+	} else {
+		p.ch = make(chan Response, 1)
+	}
+	c.resp[sid] = p
+	return p
+}
+
+// sidInUse reports whether sid is reserved by a command, the caller holds respMutex
+func (c *Client) sidInUse(sid byte, now time.Time) bool {
+	p, ok := c.resp[sid]
+	return ok && (!p.finished || now.Before(p.expires))
+}
+
+// finish ends the wait of the command registered as p. A command that gave up keeps its SID
+// for quarantine, at least MIN_SID_QUARANTINE, or until its late response arrives. Responses
+// still queued for the command are discarded.
+func (c *Client) finish(sid byte, p *pendingResponse, quarantine time.Duration) {
+	c.respMutex.Lock()
+	defer c.respMutex.Unlock()
+
+	if !p.finished {
+		p.finished = true
+		close(p.done)
+	}
+	select {
+	case <-p.ch:
+		c.discard(sid, "command finished before taking it")
+		quarantine = 0
+	default:
+	}
+	if c.resp[sid] != p {
+		return
+	}
+	if quarantine > 0 {
+		p.expires = time.Now().Add(max(quarantine, MIN_SID_QUARANTINE))
+	} else {
+		delete(c.resp, sid)
+	}
+}
+
+// failPending ends the wait of all commands, their responses are lost with the connection
+func (c *Client) failPending() {
+	c.respMutex.Lock()
+	defer c.respMutex.Unlock()
+	for sid, p := range c.resp {
+		if !p.finished {
+			p.finished = true
+			close(p.done)
+		}
+		delete(c.resp, sid)
+	}
+}
+
+// reject ends the wait of the command waiting for sid with err, all commands when all is set
+func (c *Client) reject(sid byte, all bool, err error) {
+	c.respMutex.Lock()
+	defer c.respMutex.Unlock()
+	for s, p := range c.resp {
+		if (all || s == sid) && !p.finished {
+			p.err = err
+			p.finished = true
+			close(p.done)
+			delete(c.resp, s)
+		}
+	}
+}
+
+// deliver passes a response to the command waiting for its SID according to the delivery policy
+func (c *Client) deliver(ans Response) {
+	sid := ans.Header.SID
+
+	c.respMutex.Lock()
+	p, exists := c.resp[sid]
+	if !exists {
+		c.respMutex.Unlock()
+		c.discard(sid, "no waiting request")
+		return
+	}
+	if p.finished {
+		// The late response of a command that gave up releases the SID
+		delete(c.resp, sid)
+		c.respMutex.Unlock()
+		c.discard(sid, "command gave up waiting")
+		return
+	}
+
+	switch c.delivery {
+	case DeliveryBlock:
+		c.respMutex.Unlock()
+		select {
+		case p.ch <- ans:
+		case <-p.done:
+			c.respMutex.Lock()
+			if c.resp[sid] == p {
+				delete(c.resp, sid)
+			}
+			c.respMutex.Unlock()
+			c.discard(sid, "command gave up waiting")
+		}
+		return
+
+	case DeliveryReplace:
+		select {
+		case <-p.ch:
+			c.discard(sid, "replaced by a newer response")
+		default:
+		}
+		p.ch <- ans
+
+	default:
+		select {
+		case p.ch <- ans:
+		default:
+			c.discard(sid, "a response is already waiting")
+		}
+	}
+	c.respMutex.Unlock()
+}
+
+// discard counts a response that wasn't delivered
+func (c *Client) discard(sid byte, reason string) {
+	c.diagnostics.discarded.Add(1)
+	log.Printf("Response for SID %d discarded: %s", sid, reason)
+}
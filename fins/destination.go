@@ -0,0 +1,46 @@
+package fins
+
+import (
+	"fmt"
+	"folke99/gofins/mapping"
+)
+
+// Destination is the FINS address of a PLC reached through the PLC the client is connected
+// to, e.g. a PLC on another FINS network relayed by a gateway PLC. The routing tables of the
+// gateway must route Network.
+type Destination struct {
+	Network byte
+	Node    byte
+	Unit    byte
+}
+
+func (d Destination) String() string {
+	return fmt.Sprintf("%d.%d.%d", d.Network, d.Node, d.Unit)
+}
+
+// WithDestination returns a handle sending its commands to d instead of the PLC of the
+// connection, so one connection to a gateway reaches several PLCs. The handle shares the
+// connection of c and its timeout applies to the whole relayed round trip.
+func (c *Client) WithDestination(d Destination) *Client {
+	h := *c
+	h.target = &finsAddress{network: d.Network, node: d.Node, unit: d.Unit}
+	h.unit = nil
+	return &h
+}
+
+// ReadWordsAt reads words from the PLC at d, see WithDestination
+func (c *Client) ReadWordsAt(d Destination, memoryArea mapping.MemoryArea, address uint16, readCount uint16) ([]uint16, error) {
+	words, err := c.WithDestination(d).ReadWords(memoryArea, address, readCount)
+	if err != nil {
+		return nil, fmt.Errorf("read from %s failed: %w", d, err)
+	}
+	return words, nil
+}
+
+// WriteWordsAt writes words to the PLC at d, see WithDestination
+func (c *Client) WriteWordsAt(d Destination, memoryArea mapping.MemoryArea, address uint16, data []uint16) error {
+	if err := c.WithDestination(d).WriteWords(memoryArea, address, data); err != nil {
+		return fmt.Errorf("write to %s failed: %w", d, err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package fins
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const DEFAULT_DIAGNOSTICS_HISTORY = 32
+
+// OutstandingRequest is a command still waiting for its response
+type OutstandingRequest struct {
+	SID         byte
+	CommandCode uint16
+	Sent        time.Time
+	Age         time.Duration
+}
+
+// Exchange is a completed command/response exchange
+type Exchange struct {
+	SID         byte
+	CommandCode uint16
+	EndCode     uint16
+	Sent        time.Time
+	Duration    time.Duration
+	Err         error
+}
+
+// Diagnostics is a point-in-time view of the SID sequence of a connection
+type Diagnostics struct {
+	MinSID      byte
+	MaxSID      byte
+	LastSID     byte
+	Outstanding []OutstandingRequest // Oldest first
+	Recent      []Exchange           // Oldest first
+	// Responses that weren't delivered: duplicates, late responses of commands that timed
+	// out and responses to SIDs nobody waits for
+	Discarded uint64
+}
+
+// diagnostics tracks outstanding requests and a ring buffer of completed exchanges
+type diagnostics struct {
+	sync.Mutex
+	outstanding map[byte]OutstandingRequest
+	history     []Exchange
+	next        int
+	full        bool
+	discarded   atomic.Uint64
+}
+
+func newDiagnostics(size int) *diagnostics {
+	if size <= 0 {
+		size = DEFAULT_DIAGNOSTICS_HISTORY
+	}
+	return &diagnostics{
+		outstanding: make(map[byte]OutstandingRequest),
+		history:     make([]Exchange, size),
+	}
+}
+
+func (d *diagnostics) start(sid byte, commandCode uint16) time.Time {
+	now := time.Now()
+	d.Lock()
+	d.outstanding[sid] = OutstandingRequest{SID: sid, CommandCode: commandCode, Sent: now}
+	d.Unlock()
+	return now
+}
+
+func (d *diagnostics) finish(sid byte, commandCode uint16, sent time.Time, resp *Response, err error) {
+	ex := Exchange{
+		SID:         sid,
+		CommandCode: commandCode,
+		Sent:        sent,
+		Duration:    time.Since(sent),
+		Err:         err,
+	}
+	if resp != nil {
+		ex.EndCode = resp.EndCode
+	}
+
+	d.Lock()
+	delete(d.outstanding, sid)
+	d.history[d.next] = ex
+	d.next = (d.next + 1) % len(d.history)
+	if d.next == 0 {
+		d.full = true
+	}
+	d.Unlock()
+}
+
+// Diagnostics returns the outstanding SIDs with their ages and the most recent completed
+// exchanges, to debug stuck requests without a packet capture
+func (c *Client) Diagnostics() Diagnostics {
+	c.Lock()
+	diag := Diagnostics{MinSID: c.minSid, MaxSID: c.maxSid, LastSID: c.sid}
+	c.Unlock()
+
+	d := c.diagnostics
+	now := time.Now()
+	d.Lock()
+	for _, o := range d.outstanding {
+		o.Age = now.Sub(o.Sent)
+		diag.Outstanding = append(diag.Outstanding, o)
+	}
+	if d.full {
+		diag.Recent = append(diag.Recent, d.history[d.next:]...)
+	}
+	diag.Recent = append(diag.Recent, d.history[:d.next]...)
+	d.Unlock()
+	diag.Discarded = d.discarded.Load()
+
+	sort.Slice(diag.Outstanding, func(i, j int) bool {
+		return diag.Outstanding[i].Sent.Before(diag.Outstanding[j].Sent)
+	})
+	return diag
+}
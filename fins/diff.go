@@ -0,0 +1,60 @@
+package fins
+
+import (
+	"fmt"
+	"folke99/gofins/mapping"
+)
+
+// WordDiff is a single changed word between two memory images
+type WordDiff struct {
+	MemoryArea mapping.MemoryArea
+	Address    uint16
+	Old        uint16
+	New        uint16
+}
+
+func (d WordDiff) String() string {
+	return fmt.Sprintf("area 0x%02X address %d: 0x%04X -> 0x%04X", byte(d.MemoryArea), d.Address, d.Old, d.New)
+}
+
+// CompareSnapshots returns the words that differ between two snapshots of the same region
+func CompareSnapshots(old, new *Snapshot) ([]WordDiff, error) {
+	if old.MemoryArea != new.MemoryArea || old.Start != new.Start || len(old.Words) != len(new.Words) {
+		return nil, fmt.Errorf("snapshots cover different regions: area 0x%02X %d+%d vs area 0x%02X %d+%d",
+			byte(old.MemoryArea), old.Start, len(old.Words), byte(new.MemoryArea), new.Start, len(new.Words))
+	}
+	return compareWords(old.MemoryArea, old.Start, old.Words, new.Words), nil
+}
+
+// CompareLive reads the region covered by a snapshot from the PLC, in chunks of at most
+// the transfer limit of its memory area, and returns the words that changed since the
+// snapshot was taken
+func (c *Client) CompareLive(s *Snapshot) ([]WordDiff, error) {
+	var diffs []WordDiff
+	for done := 0; done < len(s.Words); {
+		n := min(SNAPSHOT_CHUNK_WORDS, c.maxReadWords(s.MemoryArea), len(s.Words)-done)
+		address := s.Start + uint16(done)
+		live, err := c.ReadWords(s.MemoryArea, address, uint16(n))
+		if err != nil {
+			return nil, fmt.Errorf("live read at address %d failed: %w", address, err)
+		}
+		diffs = append(diffs, compareWords(s.MemoryArea, address, s.Words[done:done+n], live)...)
+		done += n
+	}
+	return diffs, nil
+}
+
+func compareWords(memoryArea mapping.MemoryArea, start uint16, old, new []uint16) []WordDiff {
+	var diffs []WordDiff
+	for i := range old {
+		if old[i] != new[i] {
+			diffs = append(diffs, WordDiff{
+				MemoryArea: memoryArea,
+				Address:    start + uint16(i),
+				Old:        old[i],
+				New:        new[i],
+			})
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,65 @@
+package fins
+
+import (
+	"encoding/binary"
+	"folke99/gofins/mapping"
+	"log"
+)
+
+// writeCommands are the commands changing PLC memory, files or state, they pass the write
+// guard and are not sent in dry-run mode. Message read/clear is left out as it mostly reads.
+var writeCommands = map[uint16]bool{
+	mapping.CommandCodeMemoryAreaWrite:           true,
+	mapping.CommandCodeMemoryAreaFill:            true,
+	mapping.CommandCodeMemoryAreaTransfer:        true,
+	mapping.CommandCodeParameterAreaWrite:        true,
+	mapping.CommandCodeParameterAreaClear:        true,
+	mapping.CommandCodeProgramAreaProtect:        true,
+	mapping.CommandCodeProgramAreaProtectClear:   true,
+	mapping.CommandCodeProgramAreaWrite:          true,
+	mapping.CommandCodeProgramAreaClear:          true,
+	mapping.CommandCodeRun:                       true,
+	mapping.CommandCodeStop:                      true,
+	mapping.CommandCodeClockWrite:                true,
+	mapping.CommandCodeAccessRightAcquire:        true,
+	mapping.CommandCodeAccessRightForcedAcquire:  true,
+	mapping.CommandCodeAccessRightRelease:        true,
+	mapping.CommandCodeErrorClear:                true,
+	mapping.CommandCodeErrorLogClear:             true,
+	mapping.CommandCodeFINSWriteAccessLogWrite:   true,
+	mapping.CommandCodeMemoryCassetteTransfer:    true,
+	mapping.CommandCodeSingleFileWrite:           true,
+	mapping.CommandCodeFileMemoryFormat:          true,
+	mapping.CommandCodeFileDelete:                true,
+	mapping.CommandCodeFileCopy:                  true,
+	mapping.CommandCodeFileNameChange:            true,
+	mapping.CommandCodeMemoryAreaFileTransfer:    true,
+	mapping.CommandCodeParameterAreaFileTransfer: true,
+	mapping.CommandCodeProgramAreaFileTransfer:   true,
+	mapping.CommandCodeDirectoryCreateDelete:     true,
+	mapping.CommandCodeForcedSetReset:            true,
+	mapping.CommandCodeForcedSetResetCancel:      true,
+}
+
+// DryRun reports whether the client was created with Options.DryRun
+func (c *Client) DryRun() bool {
+	return c.dryRun
+}
+
+// skipDryRun logs a write command instead of sending it when the client is in dry-run mode
+// and returns the successful response the PLC is assumed to give
+func (c *Client) skipDryRun(command []byte) (*Response, bool) {
+	code := binary.BigEndian.Uint16(command[0:2])
+	if !c.dryRun || !writeCommands[code] {
+		return nil, false
+	}
+
+	w, err := decodeMemoryWrite(command[2:])
+	if code == mapping.CommandCodeMemoryAreaWrite && err == nil {
+		log.Printf("Dry run: not writing %d items to %s address %d bit %d: % X",
+			w.ItemCount, mapping.MemoryArea(w.Address.MemoryArea), w.Address.Address, w.Address.BitOffset, w.Data)
+	} else {
+		log.Printf("Dry run: not sending %s: % X", mapping.CommandCode(code), command[2:])
+	}
+	return &Response{CommandCode: code, EndCode: mapping.EndCodeNormalCompletion}, true
+}
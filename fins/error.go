@@ -2,6 +2,9 @@ package fins
 
 import (
 	"fmt"
+	"folke99/gofins/finsproto"
+	"folke99/gofins/mapping"
+	"strings"
 	"time"
 )
 
@@ -15,11 +18,69 @@ func (e ResponseTimeoutError) Error() string {
 }
 
 type IncompatibleMemoryAreaError struct {
-	area byte
+	area mapping.MemoryArea
 }
 
 func (e IncompatibleMemoryAreaError) Error() string {
-	return fmt.Sprintf("The memory area is incompatible with the data type to be read: 0x%X", e.area)
+	return fmt.Sprintf("The memory area is incompatible with the data type to be read: %s (0x%02X)", e.area, byte(e.area))
+}
+
+// AddressRangeError is returned when a read or write falls outside the memory area of the PLC profile
+type AddressRangeError struct {
+	Area       mapping.MemoryArea
+	Address    uint16
+	BitOffset  byte
+	Count      uint16
+	MaxAddress uint16
+}
+
+func (e AddressRangeError) Error() string {
+	if e.BitOffset > 15 {
+		return fmt.Sprintf("Bit offset %d is out of range for %s address %d: valid offsets are 0-15", e.BitOffset, e.Area, e.Address)
+	}
+	return fmt.Sprintf("%d items at %s address %d exceed the highest address %d", e.Count, e.Area, e.Address, e.MaxAddress)
+}
+
+// CountLimitError is returned when a read or write transfers more words than a single command may carry
+type CountLimitError struct {
+	Write bool // The limit of writes was exceeded, otherwise the limit of reads
+	Count int
+	Max   int
+}
+
+func (e CountLimitError) Error() string {
+	op := "read"
+	if e.Write {
+		op = "write"
+	}
+	return fmt.Sprintf("%s of %d words exceeds the limit of %d words per command", op, e.Count, e.Max)
+}
+
+// UnsupportedCommandError is returned when the PLC profile does not support a command
+type UnsupportedCommandError struct {
+	Profile     string
+	CommandCode uint16
+}
+
+func (e UnsupportedCommandError) Error() string {
+	return fmt.Sprintf("Command %s (0x%04X) is not supported by %s PLCs", mapping.CommandCode(e.CommandCode), e.CommandCode, e.Profile)
+}
+
+// EndCodeError is returned when the PLC answers a command with an end code other than normal completion
+type EndCodeError struct {
+	CommandCode uint16
+	EndCode     uint16
+}
+
+func (e EndCodeError) Error() string {
+	return fmt.Sprintf("error reported by destination for %s, end code 0x%04X: %s",
+		mapping.CommandCode(e.CommandCode), e.EndCode, mapping.EndCode(e.EndCode))
+}
+
+// Retryable reports whether sending the command again may succeed, the end code reports a
+// transient condition and the command has the same effect when it is executed twice
+func (e EndCodeError) Retryable() bool {
+	return mapping.EndCode(e.EndCode).IsRetryable() && mapping.CommandCode(e.CommandCode).IsRetryable()
 }
 
 // Driver errors
@@ -39,14 +100,6 @@ func (e BCDOverflowError) Error() string {
 }
 
 // BCD encoding/decoding
-type BCDError struct {
-	msg string
-}
-
-func (e BCDError) Error() string {
-	return fmt.Sprintf("BCD error: %s", e.msg)
-}
-
 // FatalErrorCode represents fatal error information as bit flags
 type FatalErrorCode uint16
 
@@ -63,3 +116,306 @@ const (
 	ErrorIOBus         FatalErrorCode = 1 << 14 // I/O bus error
 	ErrorMemory        FatalErrorCode = 1 << 15 // Memory error
 )
+
+var fatalErrorNames = map[FatalErrorCode]string{
+	ErrorWatchDogTimer: "watchdog timer error",
+	ErrorFALS:          "FALS error",
+	ErrorFatalSFC:      "fatal SFC error",
+	ErrorCycleTimeOver: "cycle time over",
+	ErrorProgram:       "program error",
+	ErrorIOSetting:     "I/O setting error",
+	ErrorIOOverflow:    "I/O point overflow",
+	ErrorCPUBus:        "CPU bus error",
+	ErrorDuplication:   "duplication error",
+	ErrorIOBus:         "I/O bus error",
+	ErrorMemory:        "memory error",
+}
+
+// Names returns the names of the set flags, unknown flags as their bit number
+func (f FatalErrorCode) Names() []string {
+	return flagNames(uint16(f), func(bit uint16) string { return fatalErrorNames[FatalErrorCode(bit)] })
+}
+
+func (f FatalErrorCode) String() string {
+	return strings.Join(f.Names(), ", ")
+}
+
+// NonFatalErrorCode represents non-fatal error information as bit flags, the PLC keeps running
+type NonFatalErrorCode uint16
+
+const (
+	ErrorSpecialIOUnitSetting NonFatalErrorCode = 1 << 2  // Special I/O unit setting error
+	ErrorCPUBusUnitSetting    NonFatalErrorCode = 1 << 3  // CPU bus unit setting error
+	ErrorBattery              NonFatalErrorCode = 1 << 4  // Battery error
+	ErrorSYSMACBus            NonFatalErrorCode = 1 << 5  // SYSMAC BUS error
+	ErrorSpecialIOUnit        NonFatalErrorCode = 1 << 6  // Special I/O unit error
+	ErrorCPUBusUnit           NonFatalErrorCode = 1 << 7  // CPU bus unit error
+	ErrorInnerBoard           NonFatalErrorCode = 1 << 8  // Inner board error
+	ErrorIOVerification       NonFatalErrorCode = 1 << 9  // I/O verification error
+	ErrorPLCSetup             NonFatalErrorCode = 1 << 10 // PLC setup error
+	ErrorBasicIOUnit          NonFatalErrorCode = 1 << 12 // Basic I/O unit error
+	ErrorInterruptTask        NonFatalErrorCode = 1 << 13 // Interrupt task error
+	ErrorFAL                  NonFatalErrorCode = 1 << 15 // FAL error
+)
+
+var nonFatalErrorNames = map[NonFatalErrorCode]string{
+	ErrorSpecialIOUnitSetting: "special I/O unit setting error",
+	ErrorCPUBusUnitSetting:    "CPU bus unit setting error",
+	ErrorBattery:              "battery error",
+	ErrorSYSMACBus:            "SYSMAC BUS error",
+	ErrorSpecialIOUnit:        "special I/O unit error",
+	ErrorCPUBusUnit:           "CPU bus unit error",
+	ErrorInnerBoard:           "inner board error",
+	ErrorIOVerification:       "I/O verification error",
+	ErrorPLCSetup:             "PLC setup error",
+	ErrorBasicIOUnit:          "basic I/O unit error",
+	ErrorInterruptTask:        "interrupt task error",
+	ErrorFAL:                  "FAL error",
+}
+
+// Names returns the names of the set flags, unknown flags as their bit number
+func (f NonFatalErrorCode) Names() []string {
+	return flagNames(uint16(f), func(bit uint16) string { return nonFatalErrorNames[NonFatalErrorCode(bit)] })
+}
+
+func (f NonFatalErrorCode) String() string {
+	return strings.Join(f.Names(), ", ")
+}
+
+func flagNames(flags uint16, name func(bit uint16) string) []string {
+	var names []string
+	for i := range 16 {
+		bit := uint16(1) << i
+		if flags&bit == 0 {
+			continue
+		}
+		if n := name(bit); n != "" {
+			names = append(names, n)
+		} else {
+			names = append(names, fmt.Sprintf("bit %d", i))
+		}
+	}
+	return names
+}
+
+// ItemError is the failure of one item of a batch operation
+type ItemError struct {
+	PLC   string // Manager name of the PLC, empty for batches of a single client
+	Index int    // Position of the item in the batch
+	Item  string // Tag or address of the item, e.g. "tag speed" or "D100"
+	Err   error
+}
+
+func (e ItemError) Error() string {
+	if e.PLC != "" {
+		return fmt.Sprintf("%s: %s: %v", e.PLC, e.Item, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Item, e.Err)
+}
+
+func (e ItemError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError is returned by batch operations when some items failed. The batch results still
+// hold every item, the successful ones included. errors.Is and errors.As search the item errors.
+type MultiError struct {
+	Total  int // Items in the batch
+	Errors []ItemError
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d of %d items failed: %s", len(e.Errors), e.Total, strings.Join(msgs, "; "))
+}
+
+func (e *MultiError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// errOrNil returns e, or nil without failed items so callers can return it as error
+func (e *MultiError) errOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// RecipeError reports the step at which a recipe download failed
+type RecipeError struct {
+	Recipe      string
+	Step        int
+	Tag         string
+	Err         error
+	RollbackErr error // Set if restoring the previous values failed as well, joins every failed restore
+}
+
+func (e RecipeError) Error() string {
+	msg := fmt.Sprintf("recipe %q failed at step %d (tag %s): %v", e.Recipe, e.Step, e.Tag, e.Err)
+	if e.RollbackErr != nil {
+		msg += fmt.Sprintf(", rollback failed: %v", e.RollbackErr)
+	}
+	return msg
+}
+
+func (e RecipeError) Unwrap() error {
+	return e.Err
+}
+
+// TransactionError reports the step at which a transaction commit failed
+type TransactionError struct {
+	Step        int
+	Err         error
+	RollbackErr error // Set if restoring the previous values failed as well, joins every failed restore
+}
+
+func (e TransactionError) Error() string {
+	msg := fmt.Sprintf("transaction failed at step %d: %v", e.Step, e.Err)
+	if e.RollbackErr != nil {
+		msg += fmt.Sprintf(", rollback failed: %v", e.RollbackErr)
+	}
+	return msg
+}
+
+func (e TransactionError) Unwrap() error {
+	return e.Err
+}
+
+// ConflictError is returned by UpdateWord when the word read back after the update holds a
+// different value than was written. The update can be retried.
+type ConflictError struct {
+	Area     mapping.MemoryArea
+	Address  uint16
+	Expected uint16 // Value written by the update
+	Actual   uint16
+}
+
+func (e ConflictError) Error() string {
+	return fmt.Sprintf("%s address %d was changed concurrently: expected 0x%04X, found 0x%04X", e.Area, e.Address, e.Expected, e.Actual)
+}
+
+// ProtocolError reports a response that does not match the request it answers
+type ProtocolError struct {
+	SID    byte
+	Reason string
+}
+
+func (e ProtocolError) Error() string {
+	return fmt.Sprintf("protocol error for SID %d: %s", e.SID, e.Reason)
+}
+
+// HandshakeError is returned when the PLC rejects the FINS/TCP node address request
+type HandshakeError struct {
+	PLC  string // TCP address of the PLC
+	Node byte   // Client node requested, 0 when the PLC was asked to assign one
+	Code uint32 // FINS/TCP error code, one of finsproto.TCP_ERROR_*
+}
+
+func (e HandshakeError) Error() string {
+	msg := fmt.Sprintf("PLC %s rejected the connection request for client node %d: %s (0x%02X)", e.PLC, e.Node, e.Reason(), e.Code)
+	if r := e.Remediation(); r != "" {
+		msg += "; " + r
+	}
+	return msg
+}
+
+// NodeInUse reports whether another connection already uses the requested client node
+func (e HandshakeError) NodeInUse() bool {
+	return e.Code == finsproto.TCP_ERROR_NODE_IN_USE
+}
+
+// Reason describes the error code
+func (e HandshakeError) Reason() string {
+	return tcpErrorReason(e.Code)
+}
+
+// TCPError is returned for a command the PLC rejected in the FINS/TCP layer, reported by
+// a frame with a non-zero error code instead of a response
+type TCPError struct {
+	Command uint32 // FINS/TCP command of the frame reporting the error
+	Code    uint32 // FINS/TCP error code, one of finsproto.TCP_ERROR_*
+}
+
+func (e TCPError) Error() string {
+	return fmt.Sprintf("PLC rejected the FINS/TCP frame: %s (0x%02X)", e.Reason(), e.Code)
+}
+
+// Reason describes the error code
+func (e TCPError) Reason() string {
+	return tcpErrorReason(e.Code)
+}
+
+// tcpErrorReason describes a FINS/TCP error code
+func tcpErrorReason(code uint32) string {
+	switch code {
+	case finsproto.TCP_ERROR_NOT_FINS:
+		return "the header is not FINS"
+	case finsproto.TCP_ERROR_DATA_TOO_LONG:
+		return "the data length is too long"
+	case finsproto.TCP_ERROR_COMMAND_NOT_SUPPORTED:
+		return "the command is not supported"
+	case finsproto.TCP_ERROR_ALL_CONNECTIONS_IN_USE:
+		return "all connections are in use"
+	case finsproto.TCP_ERROR_NODE_IN_USE:
+		return "the node is already connected"
+	case finsproto.TCP_ERROR_PROTECTED_NODE:
+		return "the node is protected from this IP address"
+	case finsproto.TCP_ERROR_NODE_OUT_OF_RANGE:
+		return "the node is out of range"
+	case finsproto.TCP_ERROR_SAME_NODE:
+		return "the node is the node of the PLC"
+	case finsproto.TCP_ERROR_NO_NODE_AVAILABLE:
+		return "no node is left for automatic allocation"
+	}
+	return "unknown error"
+}
+
+// Remediation suggests how to resolve the error, it is empty when there is no suggestion
+func (e HandshakeError) Remediation() string {
+	switch e.Code {
+	case finsproto.TCP_ERROR_NODE_IN_USE:
+		return "another process on this or another host is connected with the same node, give every process its own node with a NodeAllocator or Options.ClientNode, or request node 0 to let the PLC assign one"
+	case finsproto.TCP_ERROR_SAME_NODE:
+		return "request a node other than the node of the PLC"
+	case finsproto.TCP_ERROR_NODE_OUT_OF_RANGE:
+		return fmt.Sprintf("request a node from %d to %d, or 0 to let the PLC assign one", MIN_CLIENT_NODE, MAX_CLIENT_NODE)
+	case finsproto.TCP_ERROR_PROTECTED_NODE:
+		return "request a node that is not reserved for another IP address in the IP address table of the PLC"
+	case finsproto.TCP_ERROR_NO_NODE_AVAILABLE:
+		return "close idle connections to the PLC or request a fixed node with Options.ClientNode"
+	case finsproto.TCP_ERROR_ALL_CONNECTIONS_IN_USE:
+		return "close idle connections to the PLC or share one connection between tasks with a Manager"
+	}
+	return ""
+}
+
+// TriggerTimeoutError is reported by a TriggeredReader when the PLC did not reset the trigger
+// within the timeout after the acknowledge
+type TriggerTimeoutError struct {
+	Area    mapping.MemoryArea
+	Address uint16
+	Bit     byte
+	Timeout time.Duration
+}
+
+func (e TriggerTimeoutError) Error() string {
+	return fmt.Sprintf("trigger %s %d.%02d was not reset within %v of the acknowledge", e.Area, e.Address, e.Bit, e.Timeout)
+}
+
+// MissedTriggerError is reported by a TriggeredReader when the sequence number of a block
+// skipped blocks the PLC dropped without waiting for the acknowledge
+type MissedTriggerError struct {
+	Sequence uint16 // Sequence number of the block received
+	Missed   int
+}
+
+func (e MissedTriggerError) Error() string {
+	return fmt.Sprintf("missed %d trigger(s) before block %d", e.Missed, e.Sequence)
+}
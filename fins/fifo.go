@@ -0,0 +1,135 @@
+package fins
+
+import (
+	"fmt"
+	"folke99/gofins/mapping"
+	"sync"
+)
+
+// FIFOLayout describes a ring buffer of fixed size records in PLC memory. The PLC program
+// writes a record to the slot at the head and then advances the head; the reader processes
+// the records from the tail up to the head and then advances the tail. Head and tail are
+// slot indexes, the buffer is empty when they are equal and full when the head is one slot
+// behind the tail, so it holds at most Capacity-1 records.
+type FIFOLayout struct {
+	MemoryArea  mapping.MemoryArea // Word area of the pointers and records, DM by default
+	HeadAddress uint16             // Word holding the slot the PLC writes next, advanced by the PLC
+	TailAddress uint16             // Word holding the slot the reader reads next, advanced by the reader
+	DataAddress uint16             // First word of slot 0
+	RecordSize  uint16             // Words per record
+	Capacity    uint16             // Number of slots
+}
+
+// FIFORecord is a record read from the ring buffer
+type FIFORecord struct {
+	Slot uint16
+	Data []uint16
+}
+
+// FIFOReader drains a ring buffer the PLC program fills with records, with at-least-once
+// delivery: the tail is only advanced after the records were accepted, so records are
+// delivered again when processing or the tail write fails.
+type FIFOReader struct {
+	sync.Mutex // Serializes drains
+	client     *Client
+	layout     FIFOLayout
+}
+
+// NewFIFOReader returns a reader of the ring buffer described by layout in the PLC behind c
+func NewFIFOReader(c *Client, layout FIFOLayout) (*FIFOReader, error) {
+	if layout.MemoryArea == 0 {
+		layout.MemoryArea = mapping.MemoryAreaDMWord
+	}
+	if !layout.MemoryArea.IsWord() {
+		return nil, IncompatibleMemoryAreaError{layout.MemoryArea}
+	}
+	if layout.RecordSize == 0 || layout.Capacity < 2 {
+		return nil, fmt.Errorf("invalid FIFO layout: %d slots of %d words, at least 2 slots of 1 word required", layout.Capacity, layout.RecordSize)
+	}
+	if limit := c.maxReadWords(layout.MemoryArea); int(layout.RecordSize) > limit {
+		return nil, fmt.Errorf("FIFO record of %d words exceeds the limit of %d words per read", layout.RecordSize, limit)
+	}
+	words := int(layout.RecordSize) * int(layout.Capacity)
+	if int(layout.DataAddress)+words > 0x10000 {
+		return nil, fmt.Errorf("FIFO slots of %d words from %s address %d exceed the address space", words, layout.MemoryArea, layout.DataAddress)
+	}
+	if err := c.checkWordRange(layout.MemoryArea, layout.DataAddress, uint16(words)); err != nil {
+		return nil, err
+	}
+	return &FIFOReader{client: c, layout: layout}, nil
+}
+
+// Pending returns the number of records waiting in the buffer
+func (q *FIFOReader) Pending() (int, error) {
+	head, tail, err := q.pointers()
+	if err != nil {
+		return 0, err
+	}
+	return q.count(head, tail), nil
+}
+
+// Drain reads the waiting records in order and passes them to fn in batches of as many
+// records as one read transfers. After fn accepted a batch the tail is advanced past it.
+// Drain stops at the first error and returns the number of records accepted.
+func (q *FIFOReader) Drain(fn func(records []FIFORecord) error) (int, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	head, tail, err := q.pointers()
+	if err != nil {
+		return 0, err
+	}
+
+	l := q.layout
+	perRead := max(q.client.maxReadWords(l.MemoryArea)/int(l.RecordSize), 1)
+	drained := 0
+	for tail != head {
+		// Read up to the head or the end of the buffer, whichever comes first
+		n := q.count(head, tail)
+		n = min(n, int(l.Capacity-tail), perRead)
+
+		words, err := q.client.ReadWords(l.MemoryArea, l.DataAddress+tail*l.RecordSize, uint16(n)*l.RecordSize)
+		if err != nil {
+			return drained, fmt.Errorf("failed to read FIFO slot %d: %w", tail, err)
+		}
+		records := make([]FIFORecord, n)
+		for i := range records {
+			records[i] = FIFORecord{Slot: tail + uint16(i), Data: words[i*int(l.RecordSize) : (i+1)*int(l.RecordSize)]}
+		}
+		if err := fn(records); err != nil {
+			return drained, err
+		}
+
+		next := (tail + uint16(n)) % l.Capacity
+		if err := q.client.WriteWords(l.MemoryArea, l.TailAddress, []uint16{next}); err != nil {
+			return drained, fmt.Errorf("failed to advance FIFO tail to %d: %w", next, err)
+		}
+		tail = next
+		drained += n
+	}
+	return drained, nil
+}
+
+// pointers reads the head and tail and checks that they are slot indexes
+func (q *FIFOReader) pointers() (head, tail uint16, err error) {
+	l := q.layout
+	words, err := q.client.ReadWords(l.MemoryArea, l.HeadAddress, 1)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read FIFO head: %w", err)
+	}
+	head = words[0]
+	if words, err = q.client.ReadWords(l.MemoryArea, l.TailAddress, 1); err != nil {
+		return 0, 0, fmt.Errorf("failed to read FIFO tail: %w", err)
+	}
+	tail = words[0]
+
+	if head >= l.Capacity || tail >= l.Capacity {
+		return 0, 0, fmt.Errorf("FIFO pointers out of range: head %d, tail %d, capacity %d", head, tail, l.Capacity)
+	}
+	return head, tail, nil
+}
+
+// count returns the number of records between tail and head
+func (q *FIFOReader) count(head, tail uint16) int {
+	return (int(head) - int(tail) + int(q.layout.Capacity)) % int(q.layout.Capacity)
+}
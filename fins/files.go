@@ -0,0 +1,243 @@
+package fins
+
+import (
+	"encoding/binary"
+	"fmt"
+	"folke99/gofins/finsproto"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	PROGRAM_READ_CHUNK = 512 // Largest program area read in bytes
+	FILE_READ_CHUNK    = 992 // Largest file read in bytes, reads are smaller when the frame size requires it
+	FILE_WRITE_CHUNK   = 992 // Largest file write in bytes, writes are smaller when the frame size requires it
+	FILE_NAMES_CHUNK   = 20  // Files listed per file name read
+)
+
+// FileDisk selects the file memory of the file commands
+type FileDisk uint16
+
+const (
+	DiskMemoryCard   FileDisk = finsproto.DISK_MEMORY_CARD
+	DiskEMFileMemory FileDisk = finsproto.DISK_EM_FILE_MEMORY
+)
+
+// FileWriteMode selects how a file write treats an existing file
+type FileWriteMode uint16
+
+const (
+	FileWriteNew       FileWriteMode = finsproto.FILE_WRITE_NEW       // Create the file, fails when it exists
+	FileWriteReplace   FileWriteMode = finsproto.FILE_WRITE_REPLACE   // Create the file, replacing an existing one
+	FileWriteAppend    FileWriteMode = finsproto.FILE_WRITE_APPEND    // Add to the end of an existing file
+	FileWriteOverwrite FileWriteMode = finsproto.FILE_WRITE_OVERWRITE // Overwrite an existing file at the position
+)
+
+// DiskInfo describes a file memory
+type DiskInfo struct {
+	Label    string
+	Created  time.Time
+	Capacity uint32 // Bytes
+	Free     uint32 // Bytes
+	Files    int    // Files in the directory listed
+}
+
+// FileInfo describes a file in file memory
+type FileInfo struct {
+	Name     string // 8.3 file name
+	Modified time.Time
+	Size     uint32
+}
+
+// ReadProgramArea reads count bytes of the user program starting at offset, last reports
+// that the block holds the end of the program
+func (c *Client) ReadProgramArea(offset uint32, count uint16) (data []byte, last bool, err error) {
+	r, e := c.sendCommand(finsproto.ProgramAreaReadCommand(offset, count))
+	if e = checkResponse(r, e); e != nil {
+		return nil, false, e
+	}
+	if e := checkMinDataLength(r, 8, "program area read"); e != nil {
+		return nil, false, e
+	}
+	n := binary.BigEndian.Uint16(r.Data[6:8])
+	last = n&finsproto.PROGRAM_LAST_BLOCK != 0
+	n &^= finsproto.PROGRAM_LAST_BLOCK
+	if e := checkDataLength(r, 8+int(n), "program area read"); e != nil {
+		return nil, false, e
+	}
+	return r.Data[8 : 8+int(n)], last, nil
+}
+
+// DownloadProgram copies the user program to w, starting at offset so an interrupted
+// download can be resumed with the number of bytes copied so far. It returns the bytes
+// copied by this call, also when it fails.
+func (c *Client) DownloadProgram(w io.Writer, offset uint32) (int64, error) {
+	var copied int64
+	for {
+		data, last, err := c.ReadProgramArea(offset, uint16(min(PROGRAM_READ_CHUNK, c.maxFileChunk())))
+		if err != nil {
+			return copied, fmt.Errorf("program area read at %d failed: %w", offset, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return copied, err
+		}
+		copied += int64(len(data))
+		offset += uint32(len(data))
+		if last {
+			return copied, nil
+		}
+		if len(data) == 0 {
+			return copied, fmt.Errorf("program area read at %d returned no data", offset)
+		}
+	}
+}
+
+// ReadFileNames lists the files of the directory dir, `\` or empty for the root, on disk
+func (c *Client) ReadFileNames(disk FileDisk, dir string) (DiskInfo, []FileInfo, error) {
+	var info DiskInfo
+	var files []FileInfo
+	for {
+		r, e := c.sendCommand(finsproto.FileNameReadCommand(uint16(disk), uint16(len(files)), FILE_NAMES_CHUNK, dir))
+		if e = checkResponse(r, e); e != nil {
+			return DiskInfo{}, nil, e
+		}
+		if e := checkMinDataLength(r, finsproto.DISK_DATA_LENGTH+2, "file name read"); e != nil {
+			return DiskInfo{}, nil, e
+		}
+
+		d := r.Data[:finsproto.DISK_DATA_LENGTH]
+		info = DiskInfo{
+			Label:    strings.TrimRight(string(d[0:12]), " \x00"),
+			Created:  finsproto.DecodeFileTime(binary.BigEndian.Uint32(d[12:16])),
+			Capacity: binary.BigEndian.Uint32(d[16:20]),
+			Free:     binary.BigEndian.Uint32(d[20:24]),
+			Files:    int(binary.BigEndian.Uint16(d[24:26])),
+		}
+
+		n := binary.BigEndian.Uint16(r.Data[finsproto.DISK_DATA_LENGTH:])
+		last := n&finsproto.FILE_NAMES_LAST_FILE != 0
+		n &^= finsproto.FILE_NAMES_LAST_FILE
+		if e := checkDataLength(r, finsproto.DISK_DATA_LENGTH+2+int(n)*finsproto.FILE_DATA_LENGTH, "file name read"); e != nil {
+			return DiskInfo{}, nil, e
+		}
+		entries := r.Data[finsproto.DISK_DATA_LENGTH+2:]
+		for i := range int(n) {
+			entry := entries[i*finsproto.FILE_DATA_LENGTH:]
+			files = append(files, FileInfo{
+				Name:     finsproto.DecodeFileName(entry[0:12]),
+				Modified: finsproto.DecodeFileTime(binary.BigEndian.Uint32(entry[12:16])),
+				Size:     binary.BigEndian.Uint32(entry[16:20]),
+			})
+		}
+		if last || n == 0 || len(files) >= info.Files {
+			return info, files, nil
+		}
+	}
+}
+
+// ReadFile reads up to length bytes of a file starting at position and returns them with
+// the size of the file
+func (c *Client) ReadFile(disk FileDisk, dir, name string, position uint32, length uint16) (data []byte, size uint32, err error) {
+	r, e := c.sendCommand(finsproto.FileReadCommand(uint16(disk), dir, name, position, length))
+	if e = checkResponse(r, e); e != nil {
+		return nil, 0, e
+	}
+	if e := checkMinDataLength(r, 10, "file read"); e != nil {
+		return nil, 0, e
+	}
+	size = binary.BigEndian.Uint32(r.Data[0:4])
+	n := binary.BigEndian.Uint16(r.Data[8:10])
+	if e := checkDataLength(r, 10+int(n), "file read"); e != nil {
+		return nil, 0, e
+	}
+	return r.Data[10 : 10+int(n)], size, nil
+}
+
+// DownloadFile copies a file to w, starting at position so an interrupted download can be
+// resumed with the number of bytes copied so far. It returns the bytes copied by this call,
+// also when it fails. progress receives the bytes done and the file size.
+func (c *Client) DownloadFile(w io.Writer, disk FileDisk, dir, name string, position uint32, progress ProgressFunc) (int64, error) {
+	var copied int64
+	for {
+		data, size, err := c.ReadFile(disk, dir, name, position, uint16(min(FILE_READ_CHUNK, c.maxFileChunk())))
+		if err != nil {
+			return copied, fmt.Errorf("read of %s at %d failed: %w", name, position, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return copied, err
+		}
+		copied += int64(len(data))
+		position += uint32(len(data))
+		if progress != nil {
+			progress(int(position), int(size))
+		}
+		if position >= size {
+			return copied, nil
+		}
+		if len(data) == 0 {
+			return copied, fmt.Errorf("read of %s at %d returned no data", name, position)
+		}
+	}
+}
+
+// WriteFile writes data to a file at position, see FileWriteMode for the handling of an
+// existing file. The name must be an 8.3 file name.
+func (c *Client) WriteFile(disk FileDisk, dir, name string, mode FileWriteMode, position uint32, data []byte) error {
+	if err := checkFileName(name); err != nil {
+		return err
+	}
+	r, e := c.sendCommand(finsproto.FileWriteCommand(uint16(disk), uint16(mode), dir, name, position, data))
+	return checkResponse(r, e)
+}
+
+// UploadFile copies r to a file of size bytes in chunks that fit the frame size. Starting at
+// position 0 it replaces an existing file, at a later position it appends to the file, so an
+// interrupted upload can be resumed with the number of bytes copied so far. It returns the
+// bytes copied by this call, also when it fails. progress receives the bytes done and size.
+func (c *Client) UploadFile(r io.Reader, disk FileDisk, dir, name string, position uint32, size int, progress ProgressFunc) (int64, error) {
+	if err := checkFileName(name); err != nil {
+		return 0, err
+	}
+	chunk := min(FILE_WRITE_CHUNK, c.maxFrameSize-TCP_HEADER_LENGTH-FINS_HEADER_LENGTH-2-24-len(dir))
+	buf := make([]byte, chunk)
+	var copied int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF && (copied > 0 || position > 0) {
+			return copied, nil
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return copied, err
+		}
+		mode := FileWriteAppend
+		if position == 0 {
+			mode = FileWriteReplace
+		}
+		if e := c.WriteFile(disk, dir, name, mode, position, buf[:n]); e != nil {
+			return copied, fmt.Errorf("write of %s at %d failed: %w", name, position, e)
+		}
+		copied += int64(n)
+		position += uint32(n)
+		if progress != nil {
+			progress(int(position), size)
+		}
+		if err != nil {
+			return copied, nil
+		}
+	}
+}
+
+// checkFileName checks that name fits the 8.3 file names of file memory
+func checkFileName(name string) error {
+	base, ext, _ := strings.Cut(name, ".")
+	if base == "" || len(base) > 8 || len(ext) > 3 || strings.ContainsAny(ext, ".") {
+		return fmt.Errorf("%q is not an 8.3 file name", name)
+	}
+	return nil
+}
+
+// maxFileChunk returns the bytes a program or file read response may carry in one frame
+func (c *Client) maxFileChunk() int {
+	return c.maxFrameSize - RESPONSE_OVERHEAD - 10
+}
@@ -0,0 +1,37 @@
+package fins
+
+import "folke99/gofins/mapping"
+
+// Future is the pending result of an asynchronous read
+type Future struct {
+	done  chan struct{}
+	words []uint16
+	err   error
+}
+
+// Done is closed when the result is available
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result waits for the read to complete and returns its words
+func (f *Future) Result() ([]uint16, error) {
+	<-f.done
+	return f.words, f.err
+}
+
+// ReadWordsAsync starts reading words from the PLC data area and returns immediately.
+// Invalid reads fail right away, errors of the exchange are returned by Result.
+// Many futures can be outstanding at once, Options.MaxInFlight still limits what is sent.
+func (c *Client) ReadWordsAsync(memoryArea mapping.MemoryArea, address uint16, readCount uint16) (*Future, error) {
+	if err := c.checkReadWords(memoryArea, address, int(readCount)); err != nil {
+		return nil, err
+	}
+
+	f := &Future{done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		f.words, f.err = c.ReadWords(memoryArea, address, readCount)
+	}()
+	return f, nil
+}
@@ -0,0 +1,92 @@
+package fins
+
+import (
+	"encoding/binary"
+	"fmt"
+	"folke99/gofins/mapping"
+)
+
+// WriteGuard decides whether a write command may be sent, a non-nil error rejects it. It
+// sees every command changing PLC memory, files or state, the same commands dry-run mode
+// holds back. Bit writes carry one data byte per bit. The guard runs before the command is
+// sent and may call client methods, for example Status to refuse writes while the PLC is in
+// RUN mode.
+type WriteGuard func(w MemoryWrite) error
+
+// WriteDeniedError is returned when the write guard rejects a write
+type WriteDeniedError struct {
+	Write MemoryWrite
+	Err   error
+}
+
+func (e WriteDeniedError) Error() string {
+	if e.Write.Address.MemoryArea == 0 {
+		return fmt.Sprintf("%s denied: %v", mapping.CommandCode(e.Write.Command), e.Err)
+	}
+	return fmt.Sprintf("write to %s address %d denied: %v", mapping.MemoryArea(e.Write.Address.MemoryArea), e.Write.Address.Address, e.Err)
+}
+
+func (e WriteDeniedError) Unwrap() error {
+	return e.Err
+}
+
+// SetWriteGuard replaces the write guard, nil allows all writes
+func (c *Client) SetWriteGuard(g WriteGuard) {
+	c.Lock()
+	c.writeGuard = g
+	c.Unlock()
+}
+
+// guardWrite passes write commands to the write guard
+func (c *Client) guardWrite(command []byte) error {
+	c.Lock()
+	guard := c.writeGuard
+	c.Unlock()
+	if guard == nil {
+		return nil
+	}
+
+	code := binary.BigEndian.Uint16(command[0:2])
+	if !writeCommands[code] {
+		return nil
+	}
+	w, err := decodeWriteCommand(code, command[2:])
+	if err != nil {
+		return err
+	}
+	if err := guard(w); err != nil {
+		return WriteDeniedError{Write: w, Err: err}
+	}
+	return nil
+}
+
+// decodeWriteCommand returns the write of a write command for the guard. Memory area writes
+// are decoded fully, fills and transfers get the address and item count they write and the
+// other commands only their parameters as Data.
+func decodeWriteCommand(code uint16, params []byte) (MemoryWrite, error) {
+	switch code {
+	case mapping.CommandCodeMemoryAreaWrite:
+		return decodeMemoryWrite(params)
+	case mapping.CommandCodeMemoryAreaFill:
+		// Address, item count, fill word
+		if len(params) < 8 {
+			return MemoryWrite{}, fmt.Errorf("fill needs 8 parameter bytes, got %d", len(params))
+		}
+		addr, err := DecodeMemoryAddress(params)
+		if err != nil {
+			return MemoryWrite{}, err
+		}
+		return MemoryWrite{Command: code, Address: addr, ItemCount: binary.BigEndian.Uint16(params[4:6]), Data: params[6:]}, nil
+	case mapping.CommandCodeMemoryAreaTransfer:
+		// Source address, destination address, item count
+		if len(params) < 10 {
+			return MemoryWrite{}, fmt.Errorf("transfer needs 10 parameter bytes, got %d", len(params))
+		}
+		addr, err := DecodeMemoryAddress(params[4:])
+		if err != nil {
+			return MemoryWrite{}, err
+		}
+		return MemoryWrite{Command: code, Address: addr, ItemCount: binary.BigEndian.Uint16(params[8:10]), Data: params[:4]}, nil
+	}
+	return MemoryWrite{Command: code, Data: params}, nil
+}
@@ -3,63 +3,30 @@ package fins
 import (
 	"fmt"
 	"log"
-)
-
-// Header represents a FINS frame header structure
-type Header struct {
-	icf uint8 // Information Control Field
-	rsv uint8 // Reserved
-	gct uint8 // Gateway Count
-	dna uint8 // Destination Network Address
-	da1 uint8 // Destination Node Address
-	da2 uint8 // Destination Unit Address
-	sna uint8 // Source Network Address
-	sa1 uint8 // Source Node Address
-	sa2 uint8 // Source Unit Address
-	sid uint8 // Service ID
-}
-
-//This is not used anywhere? originaly called MagicFrame
-// // Header represents a FINS frame header structure
-// type FINSFrame struct {
-// 	header     []byte // 46,49,4E,53 == FINS
-// 	length     []byte // init == 12 || FINSHeader = 8 + finsHeader = 10 + command(differs depending on command)
-// 	command    []byte // init == 0, response == 1, read/write == 2
-// 	errorCode  []byte // 00, 00, 00, 00
-// 	clientNode []byte // Only for initial connection
-// }
-
-const (
-	// ICF (Information Control Field) bits
-	ICFCommandResponse  uint8 = 0x80 // 1 = Command, 0 = Response
-	ICFResponseRequired uint8 = 0x40 // 1 = Response required, 0 = Response not required
-
-	// Default values
-	DefaultGatewayCount uint8 = 0x02 //0x02
-	DefaultReserved     uint8 = 0x00
+	"time"
 )
 
 // defaultHeader creates a new Header with standard configuration
 func defaultHeader(isCommand bool, responseRequired bool, src finsAddress, dst finsAddress, serviceID uint8) Header {
-	var icf uint8
-	if isCommand {
-		icf |= ICFCommandResponse
+	icf := ICFGatewayUsage
+	if !isCommand {
+		icf |= ICFDataTypeResponse
 	}
-	if responseRequired {
-		icf |= ICFResponseRequired
+	if !responseRequired {
+		icf |= ICFResponseNotRequired
 	}
 
 	return Header{
-		icf: 0x80,
-		rsv: DefaultReserved,
-		gct: DefaultGatewayCount,
-		dna: dst.network,
-		da1: dst.node,
-		da2: dst.unit,
-		sna: src.network,
-		sa1: src.node,
-		sa2: src.unit,
-		sid: serviceID,
+		ICF: icf,
+		RSV: DefaultReserved,
+		GCT: DefaultGatewayCount,
+		DNA: dst.network,
+		DA1: dst.node,
+		DA2: dst.unit,
+		SNA: src.network,
+		SA1: src.node,
+		SA2: src.unit,
+		SID: serviceID,
 	}
 }
 
@@ -68,84 +35,64 @@ func defaultCommandHeader(src finsAddress, dst finsAddress, serviceID uint8) Hea
 	return defaultHeader(true, true, src, dst, serviceID)
 }
 
-// encodeHeader converts a Header to its byte representation
-func encodeHeader(h Header) []byte {
-	return []byte{
-		h.icf,
-		h.rsv,
-		h.gct,
-		h.dna,
-		h.da1,
-		h.da2,
-		h.sna,
-		h.sa1,
-		h.sa2,
-		h.sid,
-	}
-}
+// Increments the SID and returns the next header
+func (c *Client) nextHeader() Header {
+	c.Lock()
+	defer c.Unlock()
+	c.respMutex.Lock()
+	sid, free := c.incrementSid()
+	c.respMutex.Unlock()
 
-// decodeHeader creates a Header from its byte representation
-func decodeHeader(data []byte) (Header, error) {
-	if len(data) < 10 {
-		return Header{}, fmt.Errorf("insufficient data for FINS header: expected 10 bytes, got %d", len(data))
+	if !free {
+		log.Printf("Warning: All SIDs appear to be in use, reusing SID %d", sid)
 	}
-
-	return Header{
-		icf: data[0],
-		rsv: data[1],
-		gct: data[2],
-		dna: data[3],
-		da1: data[4],
-		da2: data[5],
-		sna: data[6],
-		sa1: data[7],
-		sa2: data[8],
-		sid: data[9],
-	}, nil
+	return defaultCommandHeader(c.src, c.destination(), sid)
 }
 
-// IsCommand returns true if the header represents a command message
-func (h Header) IsCommand() bool {
-	return h.icf&ICFCommandResponse != 0
-}
+// nextPendingHeader reserves the next free SID for a command waiting for its response and
+// returns its header. It fails instead of reusing a SID, whose response could be taken for
+// the response of the other command.
+func (c *Client) nextPendingHeader() (Header, *pendingResponse, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.respMutex.Lock()
+	defer c.respMutex.Unlock()
 
-// IsResponseRequired returns true if a response is required for this message
-func (h Header) IsResponseRequired() bool {
-	return h.icf&ICFResponseRequired != 0
+	sid, free := c.incrementSid()
+	if !free {
+		return Header{}, nil, fmt.Errorf("all SIDs from %d to %d are waiting for a response", c.minSid, c.maxSid)
+	}
+	return defaultCommandHeader(c.src, c.destination(), sid), c.register(sid), nil
 }
 
-// Increments the SID and returns the next header
-func (c *Client) nextHeader() *Header {
-	sid := c.incrementSid()
-	header := defaultCommandHeader(c.src, c.dst, sid)
-	return &header
+// destination returns the address commands of this handle are sent to, the caller holds the lock
+func (c *Client) destination() finsAddress {
+	dst := c.dst
+	if c.target != nil {
+		dst = *c.target
+	}
+	if c.unit != nil {
+		dst.unit = *c.unit
+	}
+	return dst
 }
 
-func (c *Client) incrementSid() byte {
-	c.Lock()
-	startSid := c.sid
-	for {
-		c.sid++
-		if c.sid == 0 {
-			c.sid = 1
+// incrementSid returns the next SID and whether it is free, the caller holds the lock and respMutex
+func (c *Client) incrementSid() (byte, bool) {
+	minSid, maxSid := c.minSid, c.maxSid
+	now := time.Now()
+	for tries := int(maxSid) - int(minSid); ; tries-- {
+		if c.sid < minSid || c.sid >= maxSid {
+			c.sid = minSid
+		} else {
+			c.sid++
 		}
 
-		c.respMutex.Lock()
-		_, inUse := c.resp[c.sid]
-		c.respMutex.Unlock()
-
-		if !inUse {
-			break
+		if !c.sidInUse(c.sid, now) {
+			return c.sid, true
 		}
-
-		if c.sid == startSid {
-			log.Printf("Warning: All SIDs appear to be in use, reusing SID %d", c.sid)
-			break
+		if tries == 0 {
+			return c.sid, false
 		}
 	}
-
-	sid := c.sid
-	c.Unlock()
-
-	return sid
 }
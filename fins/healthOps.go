@@ -1,88 +1,195 @@
 package fins
 
 import (
-	"bufio"
+	"context"
+	"encoding/binary"
 	"fmt"
+	"folke99/gofins/finsproto"
 	"folke99/gofins/mapping"
 	"log"
-	"net"
+	"math/bits"
+	"strings"
 	"time"
 )
 
-// Recreates plc connection and starts the listenloop
+// Recreates plc connection and starts the listenloop.
+//
+// The whole session is restored: the node addresses are negotiated again, keep-alive set
+// with SetKeepAlive is reapplied, and the byte order, command handler and options are kept.
+// Functions registered with OnReconnect run once the connection is back, after
+// Options.OnReconnectSuccess.
 func (c *Client) Reconnect() error {
+	attempts, start, err := c.reconnect()
+	if err != nil || attempts == 0 {
+		return err
+	}
+	c.reconnected(attempts, start)
+
 	c.Lock()
-	defer c.Unlock()
+	hooks := append([]func(){}, c.reconnectHooks...)
+	c.Unlock()
 
-	if c.listening {
-		log.Print("Listener already exists, canceling reconnect")
-		return nil
+	for _, hook := range hooks {
+		hook()
 	}
+	return nil
+}
 
-	if c.closed {
-		return fmt.Errorf("cannot reconnect: connection already closed")
-	}
+// OnReconnect registers fn to run after every successful Reconnect, for example to resume
+// subscriptions that depend on the connection
+func (c *Client) OnReconnect(fn func()) {
+	c.Lock()
+	c.reconnectHooks = append(c.reconnectHooks, fn)
+	c.Unlock()
+}
 
-	c.conn.Close()
+// reconnect replaces the connection, commands keep failing fast on the closed connection
+// meanwhile instead of queueing behind the backoff. It returns the attempts it took, zero
+// when another reconnect or the listen loop holds the connection, and when it started.
+func (c *Client) reconnect() (int, time.Time, error) {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
 
-	// Attempt reconnection with backoff
-	backoffIntervals := []time.Duration{
-		1 * time.Second,
-		2 * time.Second,
-		5 * time.Second,
-		10 * time.Second,
+	c.Lock()
+	listening := c.listening
+	c.Unlock()
+	if listening {
+		log.Print("Listener already exists, canceling reconnect")
+		return 0, time.Time{}, nil
 	}
 
-	for _, backoff := range backoffIntervals {
-		log.Printf("Attempting to reconnect in %v", backoff)
-		time.Sleep(backoff)
+	if c.closed.Load() {
+		return 0, time.Time{}, fmt.Errorf("cannot reconnect: connection already closed")
+	}
 
-		dialer := net.Dialer{
-			Timeout: time.Duration(DEFAULT_CONNECT_TIMEOUT) * time.Millisecond,
-		}
+	c.connection().Close()
 
-		conn, err := dialer.Dial("tcp", c.plcAddr.tcpAddress.String())
-		if err != nil {
-			log.Printf("Reconnection attempt failed: %v", err)
-			continue
+	start := time.Now()
+	attempt := 1
+	for ; ; attempt++ {
+		delay, ok := c.reconnectBackoff.Next(attempt)
+		if !ok {
+			break
+		}
+		if c.reconnectMaxElapsed > 0 && time.Since(start)+delay > c.reconnectMaxElapsed {
+			break
 		}
 
-		// Update connection
-		c.conn = conn
-		c.reader = bufio.NewReader(conn)
+		log.Printf("Attempting to reconnect in %v", delay)
+		time.Sleep(delay)
+		if c.closed.Load() {
+			return 0, time.Time{}, fmt.Errorf("cannot reconnect: connection closed during reconnect")
+		}
 
-		// Reestablish connection request
-		err = c.sendConnectionRequest()
+		err := c.reconnectOnce()
+		if c.onReconnectAttempt != nil {
+			c.onReconnectAttempt(ReconnectAttempt{Attempt: attempt, Delay: delay, Elapsed: time.Since(start), Err: err})
+		}
 		if err != nil {
-			log.Printf("Connection request failed: %v", err)
-			conn.Close()
+			log.Printf("Reconnection attempt %d failed: %v", attempt, err)
 			continue
 		}
 
-		go c.listenLoop()
-
 		log.Println("🔄 Connection successfully reestablished") //TODO: Remove trace?
-		return nil
+		return attempt, start, nil
 	}
 
-	return fmt.Errorf("failed to reconnect after multiple attempts")
+	return 0, time.Time{}, fmt.Errorf("failed to reconnect after %d attempts", attempt-1)
 }
 
-// Ping the PLC with a ReadClock() command to check availability
-func (c *Client) Ping() error {
-	log.Print("Pinging...")
-	_, err := c.ReadClock()
+// reconnectOnce dials the PLC and restores the session, the caller holds connLock
+func (c *Client) reconnectOnce() error {
+	conn, err := c.dial()
 	if err != nil {
 		return err
 	}
-	log.Print("Pong")
+
+	// Update connection
+	c.setConnection(conn)
+
+	// Reestablish connection request
+	if err := c.sendConnectionRequest(); err != nil {
+		conn.Close()
+		return fmt.Errorf("connection request failed: %w", err)
+	}
+
+	c.Lock()
+	if c.keepAliveSet {
+		if err := c.applyKeepAlive(conn); err != nil {
+			log.Printf("Failed to reapply keep-alive: %v", err)
+		}
+	}
+	c.Unlock()
+
+	// Close may have run during the handshake and missed the new connection
+	if c.closed.Load() {
+		conn.Close()
+		return fmt.Errorf("connection closed during reconnect")
+	}
+
+	c.startListenLoop()
 	return nil
 }
 
+// Ping checks that the PLC answers Options.KeepAliveProbe and returns the round-trip time
+func (c *Client) Ping() (time.Duration, error) {
+	return c.PingWith(c.keepAliveProbe)
+}
+
+// PingWith checks that the PLC answers probe and returns the round-trip time, e.g.
+// ProbeStatusRead for units that don't support the clock read. A probe the PLC rejects
+// returns its EndCodeError.
+func (c *Client) PingWith(probe KeepAliveProbe) (time.Duration, error) {
+	log.Print("Pinging...")
+	start := time.Now()
+	r, err := c.sendCommand(probe.command())
+	rtt := time.Since(start)
+	if err := checkResponse(r, err); err != nil {
+		return 0, err
+	}
+	log.Printf("Pong after %v", rtt)
+	return rtt, nil
+}
+
+// Verify checks that the PLC answers a controller status read and reports no fatal error.
+// It only reads from the PLC and returns ctx.Err() if ctx is done before the PLC answers.
+func (c *Client) Verify(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	type result struct {
+		status *PLCStatus
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		status, err := c.Status()
+		done <- result{status, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case r := <-done:
+		if r.err != nil {
+			return fmt.Errorf("verify failed: %w", r.err)
+		}
+		if r.status.HasFatalError() {
+			return fmt.Errorf("verify failed: PLC reports fatal error 0x%04X", uint16(r.status.FatalError))
+		}
+		return nil
+	}
+}
+
 type PLCStatus struct {
-	Status     mapping.StatusCode
-	Mode       mapping.ModeCode
-	FatalError FatalErrorCode
+	Status        mapping.StatusCode
+	Mode          mapping.ModeCode
+	FatalError    FatalErrorCode
+	NonFatalError NonFatalErrorCode
+	Messages      uint8  // Bit n is set while message n of the MSG instruction is waiting, see ReadMessages
+	ErrorCode     uint16 // Code of the most serious error, 0x4101-0x42FF for FAL and 0xC101-0xC2FF for FALS errors
+	ErrorMessage  string // Message of the FAL/FALS instruction that raised the error
 }
 
 // Status sends a ReadPLCStatus() and returns the processed result or error
@@ -95,29 +202,77 @@ func (c *Client) Status() (*PLCStatus, error) {
 
 	// data[0] = Status
 	// data[1] = Mode
-	// data[2:18] = FatalError (16 bytes)
+	// data[2:4] = Fatal error flags
+	// data[4:6] = Non-fatal error flags
+	// data[6:8] = Message flags
+	// data[8:10] = Error code
+	// data[10:26] = Error message
 
-	if len(response.data) < 18 {
-		return nil, fmt.Errorf("incomplete status data")
+	if err := checkMinDataLength(response, 6, "CPU unit status read"); err != nil {
+		return nil, err
 	}
 
 	status := &PLCStatus{
-		Status: mapping.StatusCode(response.data[0]),
-		Mode:   mapping.ModeCode(response.data[1]),
+		Status:        mapping.StatusCode(response.Data[0]),
+		Mode:          mapping.ModeCode(response.Data[1]),
+		FatalError:    FatalErrorCode(binary.BigEndian.Uint16(response.Data[2:4])),
+		NonFatalError: NonFatalErrorCode(binary.BigEndian.Uint16(response.Data[4:6])),
 	}
 
-	// Process fatal error flags
-	var fatalError FatalErrorCode
-	for i := 0; i < 16; i++ {
-		if response.data[i+2] == 1 {
-			fatalError |= FatalErrorCode(1 << i)
-		}
+	// Older CPU units end the response after the error flags
+	if len(response.Data) >= 10 {
+		status.Messages = uint8(binary.BigEndian.Uint16(response.Data[6:8]))
+		status.ErrorCode = binary.BigEndian.Uint16(response.Data[8:10])
+	}
+	if len(response.Data) >= 10+finsproto.FAL_MESSAGE_LENGTH {
+		status.ErrorMessage = finsproto.DecodeMessage(response.Data[10 : 10+finsproto.FAL_MESSAGE_LENGTH])
 	}
-	status.FatalError = fatalError
 
 	return status, nil
 }
 
+// ReadMessages reads the messages of the MSG instruction selected by the bits of numbers,
+// e.g. PLCStatus.Messages, and returns them by message number
+func (c *Client) ReadMessages(numbers uint8) (map[int]string, error) {
+	r, e := c.sendCommand(finsproto.MessageReadCommand(numbers))
+	if e = checkResponse(r, e); e != nil {
+		return nil, e
+	}
+	if e := checkMinDataLength(r, 2, "message read"); e != nil {
+		return nil, e
+	}
+
+	// The response repeats the parameter and holds the messages in ascending order
+	read := uint8(binary.BigEndian.Uint16(r.Data[0:2]))
+	if e := checkDataLength(r, 2+bits.OnesCount8(read)*finsproto.MESSAGE_LENGTH, "message read"); e != nil {
+		return nil, e
+	}
+	data := r.Data[2:]
+	messages := make(map[int]string)
+	for n := range finsproto.MESSAGE_COUNT {
+		if read&(1<<n) == 0 {
+			continue
+		}
+		messages[n] = finsproto.DecodeMessage(data[:finsproto.MESSAGE_LENGTH])
+		data = data[finsproto.MESSAGE_LENGTH:]
+	}
+	return messages, nil
+}
+
+// ReadFAL reads the FAL/FALS number and error message of the current FAL or FALS error,
+// the number is 0 when no such error is raised
+func (c *Client) ReadFAL() (number uint16, message string, err error) {
+	r, e := c.sendCommand(finsproto.FALReadCommand())
+	if e = checkResponse(r, e); e != nil {
+		return 0, "", e
+	}
+	if e := checkMinDataLength(r, 4+finsproto.FAL_MESSAGE_LENGTH, "FAL/FALS number read"); e != nil {
+		return 0, "", e
+	}
+	number = binary.BigEndian.Uint16(r.Data[2:4])
+	return number, finsproto.DecodeMessage(r.Data[4 : 4+finsproto.FAL_MESSAGE_LENGTH]), nil
+}
+
 // Helper methods for checking status and errors
 func (s *PLCStatus) IsRunning() bool {
 	return s.Status == mapping.StatusRun
@@ -138,3 +293,47 @@ func (s *PLCStatus) HasFatalError() bool {
 func (s *PLCStatus) HasError(errType FatalErrorCode) bool {
 	return (s.FatalError & errType) != 0
 }
+
+func (s *PLCStatus) HasNonFatalError(errType NonFatalErrorCode) bool {
+	return (s.NonFatalError & errType) != 0
+}
+
+// HasBatteryError reports a missing or low battery, the PLC may lose its memory on power loss
+func (s *PLCStatus) HasBatteryError() bool {
+	return s.HasNonFatalError(ErrorBattery)
+}
+
+// FAL returns the number of the FAL or FALS instruction that raised the current error, 0 otherwise
+func (s *PLCStatus) FAL() uint16 {
+	switch {
+	case s.ErrorCode >= 0x4101 && s.ErrorCode <= 0x42FF:
+		return s.ErrorCode - 0x4100
+	case s.ErrorCode >= 0xC101 && s.ErrorCode <= 0xC2FF:
+		return s.ErrorCode - 0xC100
+	}
+	return 0
+}
+
+// String reports the status for logs, e.g. "STOP, MONITOR mode, fatal: program error, non-fatal: battery error"
+func (s *PLCStatus) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s, %s mode", s.Status, s.Mode)
+	if s.FatalError != 0 {
+		fmt.Fprintf(&b, ", fatal: %s", s.FatalError)
+	}
+	if s.NonFatalError != 0 {
+		fmt.Fprintf(&b, ", non-fatal: %s", s.NonFatalError)
+	}
+	if fal := s.FAL(); fal != 0 {
+		fmt.Fprintf(&b, ", FAL %d", fal)
+		if s.ErrorMessage != "" {
+			fmt.Fprintf(&b, " %q", s.ErrorMessage)
+		}
+	} else if s.ErrorCode != 0 {
+		fmt.Fprintf(&b, ", error code 0x%04X", s.ErrorCode)
+	}
+	if s.Messages != 0 {
+		fmt.Fprintf(&b, ", messages 0b%08b", s.Messages)
+	}
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package fins
+
+import (
+	"folke99/gofins/mapping"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_HEARTBEAT_INTERVAL   = time.Second
+	DEFAULT_HEARTBEAT_MAX_MISSED = 3
+)
+
+// HeartbeatOptions configures a Heartbeat, zero durations and counts use the defaults
+type HeartbeatOptions struct {
+	MemoryArea  mapping.MemoryArea     // Word area of both words, DM by default
+	Address     uint16                 // Word the incrementing counter is written to
+	EchoAddress uint16                 // Word the PLC program updates, for example with a copy of the counter
+	Interval    time.Duration          // Time between beats, 1s by default
+	MaxMissed   int                    // Consecutive missed beats before the link counts as down, 3 by default
+	OnMissed    func(e HeartbeatEvent) // Called for every missed beat
+}
+
+// HeartbeatEvent describes a missed beat
+type HeartbeatEvent struct {
+	Time    time.Time
+	Counter uint16 // Value written in this beat
+	Echo    uint16 // Value read from the echo word, unchanged since the previous beat
+	Missed  int    // Consecutive missed beats including this one
+	Err     error  // Read or write error, nil when the PLC didn't update the echo word
+}
+
+// Heartbeat writes an incrementing counter to the PLC so its program can tell the link is alive,
+// and checks that the PLC updates an echo word in return.
+// A beat is missed when the echo word didn't change since the previous beat and doesn't hold the counter.
+type Heartbeat struct {
+	sync.Mutex
+	client  *Client
+	opts    HeartbeatOptions
+	counter uint16
+	echo    uint16
+	started bool
+	missed  int
+	closed  bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewHeartbeat starts the heartbeat exchange with the PLC behind c
+func NewHeartbeat(c *Client, opts HeartbeatOptions) (*Heartbeat, error) {
+	if opts.MemoryArea == 0 {
+		opts.MemoryArea = mapping.MemoryAreaDMWord
+	}
+	if !opts.MemoryArea.IsWord() {
+		return nil, IncompatibleMemoryAreaError{opts.MemoryArea}
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DEFAULT_HEARTBEAT_INTERVAL
+	}
+	if opts.MaxMissed <= 0 {
+		opts.MaxMissed = DEFAULT_HEARTBEAT_MAX_MISSED
+	}
+
+	h := &Heartbeat{
+		client: c,
+		opts:   opts,
+		done:   make(chan struct{}),
+	}
+	h.wg.Add(1)
+	go h.loop()
+	return h, nil
+}
+
+// Alive reports whether fewer than MaxMissed consecutive beats were missed
+func (h *Heartbeat) Alive() bool {
+	h.Lock()
+	defer h.Unlock()
+	return h.missed < h.opts.MaxMissed
+}
+
+// Missed returns the number of consecutive missed beats
+func (h *Heartbeat) Missed() int {
+	h.Lock()
+	defer h.Unlock()
+	return h.missed
+}
+
+// Close stops the heartbeat, the PLC program detects the stopped counter
+func (h *Heartbeat) Close() {
+	h.Lock()
+	if h.closed {
+		h.Unlock()
+		return
+	}
+	h.closed = true
+	h.Unlock()
+
+	close(h.done)
+	h.wg.Wait()
+}
+
+func (h *Heartbeat) loop() {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(h.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		h.beat()
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Heartbeat) beat() {
+	h.Lock()
+	h.counter++
+	e := HeartbeatEvent{Time: time.Now(), Counter: h.counter}
+	h.Unlock()
+
+	var echo []uint16
+	e.Err = h.client.WriteWords(h.opts.MemoryArea, h.opts.Address, []uint16{e.Counter})
+	if e.Err == nil {
+		echo, e.Err = h.client.ReadWords(h.opts.MemoryArea, h.opts.EchoAddress, 1)
+	}
+
+	h.Lock()
+	if e.Err == nil {
+		e.Echo = echo[0]
+		updated := !h.started || echo[0] != h.echo || echo[0] == e.Counter
+		h.started = true
+		h.echo = echo[0]
+		if updated {
+			h.missed = 0
+			h.Unlock()
+			return
+		}
+	}
+	h.missed++
+	e.Missed = h.missed
+	h.Unlock()
+
+	if h.opts.OnMissed != nil {
+		h.opts.OnMissed(e)
+	}
+}
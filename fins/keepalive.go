@@ -0,0 +1,97 @@
+package fins
+
+import (
+	"encoding/binary"
+	"folke99/gofins/finsproto"
+	"folke99/gofins/mapping"
+	"log"
+	"time"
+)
+
+// KeepAliveProbe is the command sent by the session keep-alive and Ping, see Options.SessionKeepAlive
+type KeepAliveProbe int
+
+const (
+	ProbeClockRead  KeepAliveProbe = iota // Clock read, answered by every CPU unit
+	ProbeStatusRead                       // CPU unit status read
+)
+
+func (p KeepAliveProbe) command() []byte {
+	if p == ProbeStatusRead {
+		return binary.BigEndian.AppendUint16(make([]byte, 0, 2), mapping.CommandCodeCPUUnitStatusRead)
+	}
+	return finsproto.ClockReadCommand()
+}
+
+// markReceived records that a frame was received from the PLC
+func (c *Client) markReceived() {
+	c.lastReceived.Store(time.Now().UnixNano())
+}
+
+// Idle returns the time since the last frame was received from the PLC
+func (c *Client) Idle() time.Duration {
+	return time.Since(time.Unix(0, c.lastReceived.Load()))
+}
+
+// keepAliveLoop probes the PLC whenever the connection was idle for interval, until the client is closed
+func (c *Client) keepAliveLoop(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(max(interval/4, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if c.Idle() >= interval {
+			c.probeSession(interval)
+		}
+	}
+}
+
+// checkHalfOpen is called when a request timed out. Nothing received from the PLC for the
+// half-open timeout suggests a half-open connection, e.g. after a PLC power cycle, so the
+// session is probed in the background.
+func (c *Client) checkHalfOpen() {
+	if c.halfOpenTimeout <= 0 || c.Idle() < c.halfOpenTimeout {
+		return
+	}
+	go c.probeSession(c.halfOpenTimeout)
+}
+
+// probeSession sends the keep-alive probe and re-establishes the session when it gets no
+// answer within timeout. Only one probe runs at a time.
+func (c *Client) probeSession(timeout time.Duration) {
+	if !c.probing.CompareAndSwap(false, true) {
+		return
+	}
+	defer c.probing.Store(false)
+
+	// Only a missing answer counts, an error end code still shows the session is alive
+	_, err := c.WithTimeout(timeout).sendCommand(c.keepAliveProbe.command())
+	if err == nil || c.closed.Load() {
+		return
+	}
+
+	log.Printf("Session probe failed: %v, reconnecting", err)
+	c.dropConnection()
+	if err := c.Reconnect(); err != nil {
+		log.Printf("Reconnect after failed session probe: %v", err)
+	}
+}
+
+// dropConnection closes the current connection and waits for its listen loop to exit, so
+// Reconnect replaces the connection
+func (c *Client) dropConnection() {
+	c.Lock()
+	conn, done := c.connection(), c.listenDone
+	c.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+	if done != nil {
+		<-done
+	}
+}
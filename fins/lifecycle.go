@@ -0,0 +1,66 @@
+package fins
+
+import (
+	"time"
+)
+
+// ConnectionEvent describes a change of the connection to the PLC, for alerting on a link
+// that flaps. See Options.OnConnect, Options.OnDisconnect and Options.OnReconnectSuccess.
+type ConnectionEvent struct {
+	Time       time.Time
+	PLC        string        // TCP address of the PLC
+	Local      string        // Local TCP address of the connection
+	ClientNode byte          // Client node of the connection
+	ServerNode byte          // Node of the PLC
+	Err        error         // Cause of a disconnect
+	Attempts   int           // Attempts the reconnect took
+	Downtime   time.Duration // Time from the disconnect until the reconnect succeeded
+}
+
+// connectionEvent returns an event describing the current connection
+func (c *Client) connectionEvent() ConnectionEvent {
+	e := ConnectionEvent{Time: time.Now(), PLC: c.plcAddr.tcpAddress.String()}
+	if conn := c.connection(); conn != nil {
+		e.Local = conn.LocalAddr().String()
+	}
+	c.Lock()
+	e.ClientNode, e.ServerNode = c.src.node, c.dst.node
+	c.Unlock()
+	return e
+}
+
+// disconnected records the time the connection was lost and reports it, unless the client
+// was closed
+func (c *Client) disconnected(cause error) {
+	if c.closed.Load() {
+		return
+	}
+	e := c.connectionEvent()
+	e.Err = cause
+
+	c.Lock()
+	c.disconnectedAt = e.Time
+	c.Unlock()
+
+	if c.onDisconnect != nil {
+		c.onDisconnect(e)
+	}
+}
+
+// reconnected reports a successful reconnect after attempts attempts started at start
+func (c *Client) reconnected(attempts int, start time.Time) {
+	e := c.connectionEvent()
+	e.Attempts = attempts
+
+	c.Lock()
+	if !c.disconnectedAt.IsZero() && c.disconnectedAt.Before(start) {
+		start = c.disconnectedAt
+	}
+	c.disconnectedAt = time.Time{}
+	c.Unlock()
+	e.Downtime = e.Time.Sub(start)
+
+	if c.onReconnectSuccess != nil {
+		c.onReconnectSuccess(e)
+	}
+}
@@ -3,76 +3,94 @@ package fins
 import (
 	"bufio"
 	"encoding/binary"
+	"fmt"
+	"folke99/gofins/finsproto"
+	"io"
 	"log"
+	"net"
 	"runtime/debug"
 	"time"
 )
 
 const (
-	FINS_MIN_FRAME_LENGTH      = 8      // Minimum frame length
-	FINS_COMMAND_HEADER_LENGTH = 12     // FINS command header length
-	FINS_MARKER                = "FINS" // FINS initiation frame number
+	FINS_MIN_FRAME_LENGTH      = 8  // Minimum frame length
+	FINS_COMMAND_HEADER_LENGTH = 12 // FINS command header length
 )
 
-func (c *Client) listenLoop() {
+// startListenLoop starts the listen loop of the current connection, the caller holds connLock
+// or owns the client. The loop counts as listening from here on, so a Reconnect can't replace
+// the connection before the loop took it over.
+func (c *Client) startListenLoop() {
+	c.Lock()
+	defer c.Unlock()
+	c.listening = true
+	c.listenDone = make(chan struct{})
+	c.markReceived()
+	c.setReady(c.conn, true)
+	go c.listenLoop(c.conn, c.reader, c.listenDone)
+}
+
+func (c *Client) listenLoop(localConn net.Conn, localReader *bufio.Reader, done chan struct{}) {
+	cause := io.EOF
+	defer close(done)
 	defer func() {
+		// Fail the commands waiting on this connection before a Reconnect may replace it
+		c.setReady(localConn, false)
+		c.failPending()
+
 		c.Lock()
 		c.listening = false
 		c.Unlock()
 
-		c.respMutex.Lock()
-		for sid, ch := range c.resp {
-			close(ch)
-			delete(c.resp, sid)
-		}
-		c.respMutex.Unlock()
-
 		if r := recover(); r != nil {
 			log.Printf("🚨 Panic recovered in listenLoop: %s", debug.Stack())
-			if c.conn != nil {
-				log.Printf("Connection details - Local: %v, Remote: %v",
-					c.conn.LocalAddr(),
-					c.conn.RemoteAddr())
-			}
+			log.Printf("Connection details - Local: %v, Remote: %v",
+				localConn.LocalAddr(),
+				localConn.RemoteAddr())
+			cause = fmt.Errorf("panic in listen loop: %v", r)
 		}
+		c.disconnected(cause)
 	}()
 
-	c.Lock()
-	c.listening = true
-	localConn := c.conn
-	localReader := c.reader
-	c.Unlock()
-
-	if localConn == nil {
-		log.Printf("Connection is nil in listenLoop, exiting")
-		return
-	}
-
 	log.Printf("Starting listen loop with connection: %v", localConn.LocalAddr()) // TODO: Remove trace?
 
 	if err := localConn.SetReadDeadline(time.Time{}); err != nil {
 		log.Printf("Failed to clear read deadline: %v", err)
+		cause = err
 		return
 	}
 
 	scanner := bufio.NewScanner(localReader)
-	scanBuffer := make([]byte, MAX_PACKET_SIZE)
-	scanner.Buffer(scanBuffer, MAX_PACKET_SIZE)
+	scanBuffer := make([]byte, c.scannerBufferSize)
+	scanner.Buffer(scanBuffer, c.maxFrameSize)
 
 	scanner.Split(c.finsSplitFunc)
 
 	for scanner.Scan() {
-		if c.closed {
+		if c.closed.Load() {
 			log.Printf("Connection closed, exiting listen loop")
 			return
 		}
 
+		c.markReceived()
 		frameData := scanner.Bytes()
 		frameCopy := make([]byte, len(frameData))
 		copy(frameCopy, frameData)
 
 		// Extract FINS message (skip header)
-		messageBuf := frameCopy[16:]
+		command, messageBuf, err := finsproto.DecodeTCPFrame(frameCopy)
+		if err != nil {
+			log.Printf("Invalid frame: %v", err)
+			continue
+		}
+		if code := finsproto.TCPFrameErrorCode(frameCopy); code != 0 {
+			c.frameError(command, code, messageBuf)
+			continue
+		}
+		if command != TCP_COMMAND_FRAME_SEND {
+			log.Printf("Unexpected FINS/TCP command %d, frame discarded", command)
+			continue
+		}
 
 		ans, err := DecodeResponse(messageBuf)
 		if err != nil {
@@ -81,10 +99,15 @@ func (c *Client) listenLoop() {
 			continue
 		}
 
-		c.channelHandler(ans)
+		if ans.Header.IsCommand() {
+			c.queueIncomingCommand(messageBuf)
+			continue
+		}
+
+		c.deliver(ans)
 	}
 
-	if c.closed {
+	if c.closed.Load() {
 		log.Printf("Client closed, exiting listen loop cleanly")
 		return
 	}
@@ -92,14 +115,46 @@ func (c *Client) listenLoop() {
 	if err := scanner.Err(); err != nil {
 		log.Printf("Scanner error: %v, attempting to recover", err)
 		log.Printf("Error details: %T %v", err, err)
+		cause = err
+	}
+}
+
+// frameError fails the command whose frame the PLC rejected with a FINS/TCP error code. The
+// rejected frame follows the header when the PLC includes it; without it the command can't
+// be identified and all waiting commands fail.
+func (c *Client) frameError(command, code uint32, rejected []byte) {
+	err := TCPError{Command: command, Code: code}
+	h, decodeErr := finsproto.DecodeHeader(rejected)
+	if decodeErr != nil || !h.IsCommand() {
+		log.Printf("FINS/TCP error for an unknown frame, failing all waiting commands: %v", err)
+		c.reject(0, true, err)
+		return
 	}
+	log.Printf("FINS/TCP error for SID %d: %v", h.SID, err)
+	c.reject(h.SID, false, err)
 }
 
-// Split function to properly frame FINS messages
+// Split function to properly frame FINS messages. Invalid bytes are skipped within the same
+// call, the scanner would otherwise wait for more data before looking at what it has buffered.
 func (c *Client) finsSplitFunc(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for {
+		skip, token := c.splitFrame(data[advance:])
+		if skip == 0 {
+			return advance, token, nil
+		}
+		advance += skip
+		if token != nil {
+			return advance, token, nil
+		}
+	}
+}
+
+// splitFrame returns the length and bytes of the frame at the start of data, or the number of
+// invalid bytes to skip without a frame. It returns 0 when more data is needed.
+func (c *Client) splitFrame(data []byte) (int, []byte) {
 	// Need at least 8 bytes for the header
 	if len(data) < 8 {
-		return 0, nil, nil
+		return 0, nil
 	}
 
 	// Check for FINS marker
@@ -110,61 +165,26 @@ func (c *Client) finsSplitFunc(data []byte, atEOF bool) (advance int, token []by
 		for i := 1; i < len(data)-3; i++ {
 			if string(data[i:i+4]) == FINS_MARKER {
 				log.Printf("Resyncing, skipping %d bytes", i)
-				return i, nil, nil
+				return i, nil
 			}
 		}
 
-		return 1, nil, nil
+		// Keep a tail that may be the start of the next marker
+		return len(data) - 3, nil
 	}
 
 	messageLength := binary.BigEndian.Uint32(data[4:8])
 
-	if messageLength == 0 || messageLength > MAX_PACKET_SIZE {
+	// The length covers the command and error code fields of the header
+	if messageLength < 8 || int(messageLength) > c.maxFrameSize-8 {
 		log.Printf("Invalid message length: %d, skipping header", messageLength)
-		return 8, nil, nil
+		return 8, nil
 	}
 
 	totalLength := 8 + int(messageLength)
 	if len(data) < totalLength {
-		return 0, nil, nil // Need more data
+		return 0, nil // Need more data
 	}
 
-	return totalLength, data[:totalLength], nil
-}
-
-// Allocating response channels based on SIDs
-func (c *Client) channelHandler(ans Response) {
-	sid := ans.header.sid
-
-	c.respMutex.Lock()
-	responseChan, exists := c.resp[sid]
-	c.respMutex.Unlock()
-
-	if !exists {
-		log.Printf("No waiting request found for SID %d, response discarded", sid)
-		return
-	}
-
-	select {
-	case responseChan <- ans:
-		log.Printf("Response for SID %d delivered successfully", sid)
-	default:
-		log.Printf("Channel for SID %d is full or closed, attempting recovery", sid)
-
-		// Try to empty response channel
-		select {
-		case <-responseChan:
-			log.Printf("Successfully drained channel for SID %d, retrying delivery", sid)
-		default:
-			log.Printf("Channel for SID %d wasn't full, might be closed", sid)
-		}
-
-		// Try again with timeout
-		select {
-		case responseChan <- ans:
-			log.Printf("Response for SID %d delivered after recovery attempt", sid)
-		case <-time.After(100 * time.Millisecond):
-			log.Printf("Unable to deliver response for SID %d after recovery attempt", sid)
-		}
-	}
+	return totalLength, data[:totalLength]
 }
@@ -0,0 +1,130 @@
+package fins
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Manager groups the clients of several PLCs by name for batch operations
+type Manager struct {
+	sync.Mutex
+	clients     map[string]*Client
+	concurrency int
+}
+
+// TagValue is the result of reading one tag, Err is set when the read failed
+type TagValue struct {
+	Tag   Tag
+	Value float64
+	Err   error
+}
+
+// NewManager creates a Manager running at most concurrency requests per PLC at a time.
+// Default value: 1
+func NewManager(concurrency int) *Manager {
+	return &Manager{clients: make(map[string]*Client), concurrency: max(concurrency, 1)}
+}
+
+// Add registers the client of a PLC under name, replacing any client with the same name
+func (m *Manager) Add(name string, c *Client) {
+	m.Lock()
+	m.clients[name] = c
+	m.Unlock()
+}
+
+// Remove unregisters a PLC, the client is not closed
+func (m *Manager) Remove(name string) {
+	m.Lock()
+	delete(m.clients, name)
+	m.Unlock()
+}
+
+// Client returns the client registered under name
+func (m *Manager) Client(name string) (*Client, bool) {
+	m.Lock()
+	defer m.Unlock()
+	c, ok := m.clients[name]
+	return c, ok
+}
+
+// Names returns the registered PLC names in sorted order
+func (m *Manager) Names() []string {
+	m.Lock()
+	defer m.Unlock()
+	names := make([]string, 0, len(m.clients))
+	for name := range m.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadAll reads the tags of every PLC concurrently and returns the values per PLC name, in the
+// order of the requested tags. The PLCs are read in parallel, each with at most the manager
+// concurrency in flight. Reads not started when ctx is done fail with ctx.Err().
+//
+// Every tag gets a result; the returned *MultiError lists the failed reads, the tags of
+// unknown PLC names included.
+func (m *Manager) ReadAll(ctx context.Context, reads map[string][]Tag) (map[string][]TagValue, error) {
+	results := make(map[string][]TagValue, len(reads))
+	var wg sync.WaitGroup
+
+	names := make([]string, 0, len(reads))
+	for name := range reads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		tags := reads[name]
+		values := make([]TagValue, len(tags))
+		for i, t := range tags {
+			values[i].Tag = t
+		}
+		results[name] = values
+
+		c, ok := m.Client(name)
+		if !ok {
+			err := fmt.Errorf("unknown PLC %q", name)
+			for i := range values {
+				values[i].Err = err
+			}
+			continue
+		}
+
+		slots := make(chan struct{}, m.concurrency)
+		for i := range values {
+			wg.Add(1)
+			go func(v *TagValue) {
+				defer wg.Done()
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					v.Err = ctx.Err()
+					return
+				}
+				defer func() { <-slots }()
+
+				if err := ctx.Err(); err != nil {
+					v.Err = err
+					return
+				}
+				v.Value, v.Err = c.ReadTag(v.Tag)
+			}(&values[i])
+		}
+	}
+	wg.Wait()
+
+	multi := &MultiError{}
+	for _, name := range names {
+		for i, v := range results[name] {
+			multi.Total++
+			if v.Err != nil {
+				multi.Errors = append(multi.Errors, ItemError{PLC: name, Index: i, Item: "tag " + v.Tag.Name, Err: v.Err})
+			}
+		}
+	}
+	return results, multi.errOrNil()
+}
@@ -0,0 +1,314 @@
+package fins
+
+import (
+	"fmt"
+	"folke99/gofins/mapping"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// Struct fields are mapped to PLC memory with a fins tag holding the address and the type:
+//
+//	type Status struct {
+//		Speed   int16   `fins:"D100,int16"`
+//		Count   uint32  `fins:"D101,uint32"`
+//		Temp    float32 `fins:"D103,real"`
+//		Running bool    `fins:"D105.00,bool"`
+//	}
+//
+// Types are bool (with a bit offset), int16, uint16, int32, uint32, real and lreal, or the
+// Omron names INT, UINT, DINT, UDINT and LREAL. Multi-word values are stored with the least
+// significant word first. All fields must be in the same memory area and must not overlap,
+// only bools may share a word, each with its own bit. Fields without a tag or tagged "-"
+// are skipped.
+
+// structField is a tagged struct field and its location in the memory block
+type structField struct {
+	index    int
+	name     string
+	address  uint16
+	bit      int
+	dataType string
+	words    int
+}
+
+var structFieldWords = map[string]int{
+	"bool":   1,
+	"int16":  1,
+	"uint16": 1,
+	"int32":  2,
+	"uint32": 2,
+	"real":   2,
+	"lreal":  4,
+}
+
+var structTypeAliases = map[string]string{
+	"int":   "int16",
+	"uint":  "uint16",
+	"dint":  "int32",
+	"udint": "uint32",
+	"float": "real",
+}
+
+// Unmarshal reads the memory block covering all tagged fields of the struct v points to
+// with a single read and stores the values in the fields
+func (c *Client) Unmarshal(v any) error {
+	rv, err := structPointer(v)
+	if err != nil {
+		return err
+	}
+	fields, area, start, count, err := structLayout(rv.Type())
+	if err != nil {
+		return err
+	}
+
+	words, err := c.ReadWords(area, start, uint16(count))
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		decodeStructField(rv.Field(f.index), f, words[f.address-start:])
+	}
+	return nil
+}
+
+// Marshal writes the tagged fields of the struct v points to with a single write.
+// When the fields leave gaps in the block or share words as bits, the block is read
+// first so the memory between the fields keeps its value.
+func (c *Client) Marshal(v any) error {
+	rv, err := structPointer(v)
+	if err != nil {
+		return err
+	}
+	fields, area, start, count, err := structLayout(rv.Type())
+	if err != nil {
+		return err
+	}
+
+	words := make([]uint16, count)
+	if !coversBlock(fields, start, count) {
+		if err := c.ReadWordsInto(area, start, words); err != nil {
+			return err
+		}
+	}
+	for _, f := range fields {
+		if err := encodeStructField(rv.Field(f.index), f, words[f.address-start:]); err != nil {
+			return err
+		}
+	}
+	return c.WriteWords(area, start, words)
+}
+
+func structPointer(v any) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("expected a non-nil pointer to a struct, got %T", v)
+	}
+	return rv.Elem(), nil
+}
+
+// structLayout parses the fins tags of t and returns the fields with the memory block they span
+func structLayout(t reflect.Type) ([]structField, mapping.MemoryArea, uint16, int, error) {
+	var fields []structField
+	var area mapping.MemoryArea
+	start, end := math.MaxInt, 0
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("fins")
+		if !ok || tag == "-" {
+			continue
+		}
+		f, fieldArea, err := parseStructField(sf, tag)
+		if err != nil {
+			return nil, 0, 0, 0, err
+		}
+		if len(fields) > 0 && fieldArea != area {
+			return nil, 0, 0, 0, fmt.Errorf("field %s: all fields must be in the %s area", sf.Name, area)
+		}
+		for _, other := range fields {
+			if f.overlaps(other) {
+				return nil, 0, 0, 0, fmt.Errorf("field %s overlaps field %s", sf.Name, other.name)
+			}
+		}
+		f.index = i
+		area = fieldArea
+		start = min(start, int(f.address))
+		end = max(end, int(f.address)+f.words)
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, 0, 0, 0, fmt.Errorf("%s has no fields with a fins tag", t)
+	}
+	if end > 0x10000 {
+		return nil, 0, 0, 0, fmt.Errorf("%s extends beyond the address range", t)
+	}
+	return fields, area, uint16(start), end - start, nil
+}
+
+// overlaps reports whether f and other share memory, bools only share a word with other bools
+// when their bits differ
+func (f structField) overlaps(other structField) bool {
+	if f.dataType == "bool" && other.dataType == "bool" {
+		return f.address == other.address && f.bit == other.bit
+	}
+	return int(f.address) < int(other.address)+other.words && int(other.address) < int(f.address)+f.words
+}
+
+func parseStructField(sf reflect.StructField, tag string) (structField, mapping.MemoryArea, error) {
+	if !sf.IsExported() {
+		// reflect can't set or read it
+		return structField{}, 0, fmt.Errorf("field %s: fins tag on an unexported field", sf.Name)
+	}
+	address, dataType, ok := strings.Cut(tag, ",")
+	if !ok {
+		return structField{}, 0, fmt.Errorf("field %s: fins tag %q needs an address and a type", sf.Name, tag)
+	}
+	area, word, bit, err := mapping.ParseAddress(address)
+	if err != nil {
+		return structField{}, 0, fmt.Errorf("field %s: %w", sf.Name, err)
+	}
+
+	dataType = strings.ToLower(strings.TrimSpace(dataType))
+	if alias, ok := structTypeAliases[dataType]; ok {
+		dataType = alias
+	}
+	words, ok := structFieldWords[dataType]
+	if !ok {
+		return structField{}, 0, fmt.Errorf("field %s: unsupported type %q", sf.Name, dataType)
+	}
+	if (dataType == "bool") != (bit >= 0) {
+		return structField{}, 0, fmt.Errorf("field %s: only bool fields have a bit offset", sf.Name)
+	}
+	if !fieldKindMatches(sf.Type.Kind(), dataType) {
+		return structField{}, 0, fmt.Errorf("field %s: %s can't hold %s", sf.Name, sf.Type, dataType)
+	}
+
+	return structField{
+		name:     sf.Name,
+		address:  word,
+		bit:      bit,
+		dataType: dataType,
+		words:    words,
+	}, area, nil
+}
+
+func fieldKindMatches(kind reflect.Kind, dataType string) bool {
+	switch dataType {
+	case "bool":
+		return kind == reflect.Bool
+	case "real", "lreal":
+		return kind == reflect.Float32 || kind == reflect.Float64
+	default:
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		}
+		return false
+	}
+}
+
+// coversBlock returns true if the fields fill every word of the block without bit fields
+func coversBlock(fields []structField, start uint16, count int) bool {
+	covered := make([]bool, count)
+	for _, f := range fields {
+		if f.dataType == "bool" {
+			return false
+		}
+		for i := 0; i < f.words; i++ {
+			covered[int(f.address-start)+i] = true
+		}
+	}
+	for _, c := range covered {
+		if !c {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeStructField(v reflect.Value, f structField, words []uint16) {
+	var bits uint64
+	for i := f.words - 1; i >= 0; i-- {
+		bits = bits<<16 | uint64(words[i])
+	}
+
+	switch f.dataType {
+	case "bool":
+		v.SetBool(words[0]&(1<<f.bit) != 0)
+	case "real":
+		v.SetFloat(float64(math.Float32frombits(uint32(bits))))
+	case "lreal":
+		v.SetFloat(math.Float64frombits(bits))
+	case "int16":
+		setStructInt(v, int64(int16(bits)))
+	case "int32":
+		setStructInt(v, int64(int32(bits)))
+	default:
+		setStructInt(v, int64(bits))
+	}
+}
+
+// setStructInt stores n in an integer field, fields too small for the PLC type keep the low bits
+func setStructInt(v reflect.Value, n int64) {
+	if v.CanInt() {
+		v.SetInt(n)
+	} else {
+		v.SetUint(uint64(n))
+	}
+}
+
+func encodeStructField(v reflect.Value, f structField, words []uint16) error {
+	var bits uint64
+	switch f.dataType {
+	case "bool":
+		if v.Bool() {
+			words[0] |= 1 << f.bit
+		} else {
+			words[0] &^= 1 << f.bit
+		}
+		return nil
+	case "real":
+		bits = uint64(math.Float32bits(float32(v.Float())))
+	case "lreal":
+		bits = math.Float64bits(v.Float())
+	default:
+		n, err := structIntValue(v, f)
+		if err != nil {
+			return err
+		}
+		bits = uint64(n)
+	}
+
+	for i := 0; i < f.words; i++ {
+		words[i] = uint16(bits >> (16 * i))
+	}
+	return nil
+}
+
+func structIntValue(v reflect.Value, f structField) (int64, error) {
+	var lo, hi int64
+	switch f.dataType {
+	case "int16":
+		lo, hi = math.MinInt16, math.MaxInt16
+	case "uint16":
+		lo, hi = 0, math.MaxUint16
+	case "int32":
+		lo, hi = math.MinInt32, math.MaxInt32
+	default:
+		lo, hi = 0, math.MaxUint32
+	}
+
+	if v.CanUint() {
+		if n := v.Uint(); n > uint64(hi) {
+			return 0, fmt.Errorf("field %s: value %d out of range for %s", f.name, n, f.dataType)
+		}
+		return int64(v.Uint()), nil
+	}
+	if n := v.Int(); n < lo || n > hi {
+		return 0, fmt.Errorf("field %s: value %d out of range for %s", f.name, n, f.dataType)
+	}
+	return v.Int(), nil
+}
@@ -0,0 +1,25 @@
+package fins
+
+// Sender sends a FINS command (command code and parameters) and returns the response
+type Sender interface {
+	SendCommand(command []byte) (*Response, error)
+}
+
+// SenderFunc adapts a function to a Sender
+type SenderFunc func(command []byte) (*Response, error)
+
+func (f SenderFunc) SendCommand(command []byte) (*Response, error) {
+	return f(command)
+}
+
+// Middleware wraps a Sender, for example to log, measure, retry or reject commands.
+// Middleware must not keep the command slice after SendCommand returns.
+type Middleware func(next Sender) Sender
+
+// Use appends middleware to the chain wrapping every command of the client and its handles
+func (c *Client) Use(middleware ...Middleware) {
+	c.Lock()
+	defer c.Unlock()
+	// Copy so commands in flight keep the chain they started with
+	c.middleware = append(c.middleware[:len(c.middleware):len(c.middleware)], middleware...)
+}
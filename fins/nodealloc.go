@@ -0,0 +1,112 @@
+package fins
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	MIN_CLIENT_NODE = 1
+	MAX_CLIENT_NODE = 254
+)
+
+// NodeAllocator chooses the client node requested in the FINS/TCP handshake, so processes
+// connecting to the same PLC don't collide. AllocateNode is called with the addresses of
+// every new connection, including reconnects, and release is called once the connection
+// is closed or replaced.
+type NodeAllocator interface {
+	AllocateNode(local, plc net.Addr) (node byte, release func(), err error)
+}
+
+// nodeRange returns the node range of an allocator, zero bounds use the FINS/TCP limits
+func nodeRange(min, max byte) (byte, byte, error) {
+	if min == 0 {
+		min = MIN_CLIENT_NODE
+	}
+	if max == 0 {
+		max = MAX_CLIENT_NODE
+	}
+	if min > max || max > MAX_CLIENT_NODE {
+		return 0, 0, fmt.Errorf("invalid node range: %d-%d", min, max)
+	}
+	return min, max, nil
+}
+
+// PortNodeAllocator derives the node from the local TCP port of the connection. It needs no
+// coordination, but connections whose ports are equal modulo the size of the range get the
+// same node. Use FileNodeAllocator when that is not acceptable.
+type PortNodeAllocator struct {
+	Min, Max byte // Node range, zero values use 1-254
+}
+
+func (a PortNodeAllocator) AllocateNode(local, _ net.Addr) (byte, func(), error) {
+	min, max, err := nodeRange(a.Min, a.Max)
+	if err != nil {
+		return 0, nil, err
+	}
+	addr, ok := local.(*net.TCPAddr)
+	if !ok {
+		return 0, nil, fmt.Errorf("local address %v is not a TCP address", local)
+	}
+	return min + byte(addr.Port%(int(max-min)+1)), func() {}, nil
+}
+
+// FileNodeAllocator hands out nodes to the processes of a host through lock files in Dir,
+// one per PLC and node. A node is allocated while its lock file is locked, the operating
+// system releases the lock when the connection is closed or its process dies. The files
+// stay in Dir, they are reused by the next allocation.
+type FileNodeAllocator struct {
+	Dir      string // Directory of the lock files, created if missing
+	Min, Max byte   // Node range, zero values use 1-254
+}
+
+func (a FileNodeAllocator) AllocateNode(_, plc net.Addr) (byte, func(), error) {
+	min, max, err := nodeRange(a.Min, a.Max)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := os.MkdirAll(a.Dir, 0o755); err != nil {
+		return 0, nil, err
+	}
+
+	name := strings.NewReplacer(":", "_", "[", "", "]", "").Replace(plc.String())
+	for node := int(min); node <= int(max); node++ {
+		path := filepath.Join(a.Dir, fmt.Sprintf("%s-node%d.lock", name, node))
+		f, err := claimLockFile(path)
+		if err != nil {
+			return 0, nil, err
+		}
+		if f != nil {
+			var once sync.Once
+			return byte(node), func() { once.Do(func() { f.Close() }) }, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("all nodes %d-%d for PLC %s are allocated in %s", min, max, plc, a.Dir)
+}
+
+// claimLockFile opens and locks the lock file at path, it returns nil if another connection
+// holds the lock. Closing the returned file releases the lock.
+//
+// The file is never removed: a process could lock it between the unlock and the removal
+// of the holder, while the next one creates a new file under the same name.
+func claimLockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := tryLockFile(f)
+	if err != nil || !locked {
+		f.Close()
+		return nil, err
+	}
+
+	// The PID only helps to find the holder, the lock decides
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(fmt.Sprintf("%d\n", os.Getpid())), 0)
+	}
+	return f, nil
+}
@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package fins
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func tryLockFile(*os.File) (bool, error) {
+	return false, fmt.Errorf("file locks are not supported on %s, use PortNodeAllocator", runtime.GOOS)
+}
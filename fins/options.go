@@ -0,0 +1,120 @@
+package fins
+
+import (
+	"folke99/gofins/mapping"
+	"time"
+)
+
+// Options configures a Client. The zero value of a field keeps the default behaviour.
+type Options struct {
+	// MaxRequestsPerSecond limits the command rate with a token bucket, zero disables the limit.
+	// Commands waiting for a token get it in priority order.
+	MaxRequestsPerSecond float64
+	// Burst is the number of commands that may be sent back to back under the rate limit.
+	// Default value: 1
+	Burst int
+	// MaxInFlight caps the number of commands waiting for a response, zero disables the cap.
+	// When the cap is reached, queued commands are sent in priority order.
+	MaxInFlight int
+	// CommandPriorities overrides the default priority class of command codes, the classes
+	// must be between PriorityLow and PriorityHigh
+	CommandPriorities map[uint16]Priority
+	// MinSID and MaxSID limit the service IDs used by the client, so processes sharing a
+	// node can use disjoint ranges.
+	// Default value: 1 to 255
+	MinSID byte
+	MaxSID byte
+	// DiagnosticsHistory is the number of completed exchanges kept for Diagnostics().
+	// Default value: 32
+	DiagnosticsHistory int
+	// Profile describes the PLC model, its memory limits, supported commands and transfer sizes
+	// are checked before a command is sent.
+	// Default value: mapping.ProfileCJ2
+	Profile *mapping.Profile
+	// TransferLimits overrides the words a single read or write of a memory area may transfer,
+	// for units whose limits differ from their profile. Zero fields keep the profile limits.
+	TransferLimits map[mapping.MemoryArea]mapping.TransferLimit
+	// DetectProfile reads the CPU unit model after connecting and selects the matching profile
+	// from mapping.Profiles. It is ignored when Profile is set, the default is kept if the
+	// model can't be read or has no profile.
+	DetectProfile bool
+	// MaxFrameSize is the largest FINS/TCP frame in bytes, headers included, that is sent or
+	// accepted. It also limits the words of a single read or write, so it can be tuned to
+	// units accepting 2012 byte FINS frames or older units limited to 1004 bytes.
+	// Default value: MAX_PACKET_SIZE
+	MaxFrameSize int
+	// ReceiveBufferSize is the size of the buffered reader of the connection.
+	// Default value: DEFAULT_RECEIVE_BUFFER
+	ReceiveBufferSize int
+	// ScannerBufferSize is the initial buffer of the frame scanner, it grows up to MaxFrameSize.
+	// Default value: MaxFrameSize
+	ScannerBufferSize int
+	// DialTimeout limits the TCP connect.
+	// Default value: DEFAULT_CONNECT_TIMEOUT
+	DialTimeout time.Duration
+	// HandshakeTimeout limits the wait for the node address response after connecting, so a
+	// silent device can't hang NewClient.
+	// Default value: DEFAULT_HANDSHAKE_TIMEOUT
+	HandshakeTimeout time.Duration
+	// KeepAlive is the TCP keep-alive period of the connection, zero uses the Go default
+	// (15s) and a negative value disables keep-alive
+	KeepAlive time.Duration
+	// SessionKeepAlive sends KeepAliveProbe whenever nothing was received from the PLC for
+	// this long, for Ethernet units that drop idle FINS/TCP sessions despite TCP keep-alive.
+	// A probe without an answer within the interval drops the connection and starts
+	// Reconnect. Zero disables the session keep-alive.
+	SessionKeepAlive time.Duration
+	// HalfOpenTimeout detects half-open connections, where commands are sent but nothing
+	// arrives, e.g. after a PLC power cycle. When a command times out and nothing was received
+	// from the PLC for this long, KeepAliveProbe is sent and the connection is re-established
+	// if the probe gets no answer within HalfOpenTimeout either. Zero disables the detection.
+	HalfOpenTimeout time.Duration
+	// KeepAliveProbe is the command of the session keep-alive, the half-open detection and Ping.
+	// Default value: ProbeClockRead
+	KeepAliveProbe KeepAliveProbe
+	// ClientNode is the client node requested in the FINS/TCP handshake, zero lets the PLC
+	// assign one. Processes connecting to the same PLC need different nodes, the handshake
+	// fails with a HandshakeError otherwise.
+	ClientNode byte
+	// NodeAllocator chooses the client node of every connection, including reconnects,
+	// and overrides ClientNode. See FileNodeAllocator and PortNodeAllocator.
+	NodeAllocator NodeAllocator
+	// ReconnectBackoff decides the delays between Reconnect attempts.
+	// Default value: 1s, 2s, 5s and 10s, then give up
+	ReconnectBackoff Backoff
+	// ReconnectMaxElapsed stops Reconnect once the next attempt would start later than this
+	// after the call, zero leaves the limit to the backoff
+	ReconnectMaxElapsed time.Duration
+	// OnReconnectAttempt is called after every reconnection attempt. It runs while Reconnect
+	// holds the client and must not call client methods.
+	OnReconnectAttempt func(ReconnectAttempt)
+	// OnConnect is called once NewClient established the connection.
+	OnConnect func(ConnectionEvent)
+	// OnDisconnect is called when the connection is lost, with the cause in Err. It runs on
+	// the goroutine reading the connection and must return quickly. Close doesn't call it.
+	OnDisconnect func(ConnectionEvent)
+	// OnReconnectSuccess is called when Reconnect re-established the connection, with the
+	// attempts it took and the downtime since the disconnect.
+	OnReconnectSuccess func(ConnectionEvent)
+	// VerifyUpdates re-reads the word after UpdateWord and UpdateBits and returns a
+	// ConflictError when the PLC changed it in the meantime
+	VerifyUpdates bool
+	// Middleware wraps every command that expects a response, the first middleware is the
+	// outermost. More can be added with Use.
+	Middleware []Middleware
+	// WriteGuard is called before every write command and can reject it, see SetWriteGuard
+	WriteGuard WriteGuard
+	// AuditSink records every memory area write, AuditReadBefore reads the memory first so
+	// the record holds the previous value. See SetAuditSink.
+	AuditSink       AuditSink
+	AuditReadBefore bool
+	// ResponseDelivery decides what happens to a second response for a SID while the command
+	// hasn't taken the first one yet. Late responses of commands that timed out are always
+	// discarded, their SID isn't reused for the response timeout or MIN_SID_QUARANTINE.
+	// Default value: DeliveryDrop
+	ResponseDelivery DeliveryPolicy
+	// DryRun validates and logs writes and control commands and reports them as successful
+	// without sending them, reads are sent as usual. Use it to test a configuration against
+	// a production PLC.
+	DryRun bool
+}
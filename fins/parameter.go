@@ -0,0 +1,93 @@
+package fins
+
+import (
+	"encoding/binary"
+	"fmt"
+	"folke99/gofins/finsproto"
+)
+
+// ParameterArea selects the area of the parameter area commands
+type ParameterArea uint16
+
+const (
+	ParameterPLCSetup        ParameterArea = finsproto.PARAMETER_AREA_PLC_SETUP
+	ParameterIOTable         ParameterArea = finsproto.PARAMETER_AREA_IO_TABLE
+	ParameterRoutingTable    ParameterArea = finsproto.PARAMETER_AREA_ROUTING_TABLE
+	ParameterCPUBusUnitSetup ParameterArea = finsproto.PARAMETER_AREA_CPU_BUS_UNIT
+)
+
+func (a ParameterArea) String() string {
+	switch a {
+	case ParameterPLCSetup:
+		return "PLC Setup"
+	case ParameterIOTable:
+		return "I/O table"
+	case ParameterRoutingTable:
+		return "routing table"
+	case ParameterCPUBusUnitSetup:
+		return "CPU Bus Unit setup"
+	default:
+		return fmt.Sprintf("parameter area 0x%04X", uint16(a))
+	}
+}
+
+// Words returns the size of the area in words on CS/CJ CPU units, 0 for unknown areas
+func (a ParameterArea) Words() int {
+	return finsproto.ParameterAreaWords(uint16(a))
+}
+
+// checkParameterRange checks that count words starting at first fit in a known area
+func checkParameterRange(area ParameterArea, first uint16, count int) error {
+	if words := area.Words(); words > 0 && int(first)+count > words {
+		return fmt.Errorf("%d words at %d exceed the %d words of the %s", count, first, words, area)
+	}
+	return nil
+}
+
+// ReadParameterArea reads count words of a parameter area starting at first, e.g. the PLC
+// Setup or the routing tables. Reads larger than a frame are split into several commands.
+func (c *Client) ReadParameterArea(area ParameterArea, first, count uint16) ([]uint16, error) {
+	if err := checkParameterRange(area, first, int(count)); err != nil {
+		return nil, err
+	}
+
+	chunk := (c.maxFrameSize - RESPONSE_OVERHEAD - finsproto.PARAMETER_AREA_HEADER_LENGTH) / 2
+	words := make([]uint16, 0, count)
+	for len(words) < int(count) {
+		start := first + uint16(len(words))
+		n := uint16(min(chunk, int(count)-len(words)))
+		r, e := c.sendCommand(finsproto.ParameterAreaReadCommand(uint16(area), start, n))
+		if e = checkResponse(r, e); e != nil {
+			return nil, e
+		}
+		if e := checkDataLength(r, finsproto.PARAMETER_AREA_HEADER_LENGTH+int(n)*2, "parameter area read"); e != nil {
+			return nil, e
+		}
+		for i := range int(n) {
+			words = append(words, binary.BigEndian.Uint16(r.Data[finsproto.PARAMETER_AREA_HEADER_LENGTH+i*2:]))
+		}
+	}
+	return words, nil
+}
+
+// WriteParameterArea writes words to a parameter area starting at first. Most areas can only
+// be written while the PLC is in PROGRAM mode. Writes larger than a frame are split into
+// several commands, so a failure can leave the area partly written.
+func (c *Client) WriteParameterArea(area ParameterArea, first uint16, words []uint16) error {
+	if err := checkParameterRange(area, first, len(words)); err != nil {
+		return err
+	}
+
+	chunk := (c.maxFrameSize - TCP_HEADER_LENGTH - FINS_HEADER_LENGTH - 2 - finsproto.PARAMETER_AREA_HEADER_LENGTH) / 2
+	for written := 0; written < len(words); {
+		n := min(chunk, len(words)-written)
+		start := first + uint16(written)
+		last := int(start)+n == area.Words()
+		r, e := c.sendCommand(finsproto.ParameterAreaWriteCommand(uint16(area), start, words[written:written+n], last))
+		if e = checkResponse(r, e); e != nil {
+			return fmt.Errorf("%s write at word %d failed: %w", area, start, e)
+		}
+		written += n
+	}
+	return nil
+}
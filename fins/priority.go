@@ -0,0 +1,95 @@
+package fins
+
+import (
+	"encoding/binary"
+	"folke99/gofins/mapping"
+	"sync"
+)
+
+// Priority is the scheduling class of a command
+type Priority int
+
+const (
+	PriorityLow    Priority = iota // Background polling
+	PriorityNormal                 // Operator-initiated reads, the default
+	PriorityHigh                   // Writes and control commands
+	priorityCount
+)
+
+// WithPriority returns a client handle sending its commands at priority p.
+// The handle shares the connection with c, use it for example to run bulk polling at PriorityLow.
+func (c *Client) WithPriority(p Priority) *Client {
+	h := *c
+	h.priority = min(max(p, PriorityLow), PriorityHigh)
+	return &h
+}
+
+// commandPriorityOf returns the priority a command is scheduled with:
+// the configured class of the command code, otherwise the higher of the handle
+// priority and the default class of the command
+func (c *Client) commandPriorityOf(command []byte) Priority {
+	code := binary.BigEndian.Uint16(command[0:2])
+	if p, ok := c.commandPriority[code]; ok {
+		return p
+	}
+	return max(c.priority, defaultCommandPriority(code))
+}
+
+func defaultCommandPriority(code uint16) Priority {
+	switch code {
+	case mapping.CommandCodeMemoryAreaWrite,
+		mapping.CommandCodeMemoryAreaFill,
+		mapping.CommandCodeMemoryAreaTransfer,
+		mapping.CommandCodeParameterAreaWrite,
+		mapping.CommandCodeRun,
+		mapping.CommandCodeStop,
+		mapping.CommandCodeClockWrite,
+		mapping.CommandCodeForcedSetReset,
+		mapping.CommandCodeForcedSetResetCancel:
+		return PriorityHigh
+	default:
+		return PriorityLow
+	}
+}
+
+// scheduler is a counting semaphore granting free slots to the highest priority waiter
+type scheduler struct {
+	sync.Mutex
+	capacity int
+	inUse    int
+	waiting  [priorityCount][]chan struct{}
+}
+
+func newScheduler(capacity int) *scheduler {
+	return &scheduler{capacity: capacity}
+}
+
+func (s *scheduler) acquire(p Priority) {
+	s.Lock()
+	if s.inUse < s.capacity {
+		s.inUse++
+		s.Unlock()
+		return
+	}
+	ch := make(chan struct{})
+	s.waiting[p] = append(s.waiting[p], ch)
+	s.Unlock()
+
+	<-ch
+}
+
+// release hands the slot directly to the next waiter, or frees it if nobody waits
+func (s *scheduler) release() {
+	s.Lock()
+	defer s.Unlock()
+
+	for p := PriorityHigh; p >= PriorityLow; p-- {
+		if len(s.waiting[p]) > 0 {
+			ch := s.waiting[p][0]
+			s.waiting[p] = s.waiting[p][1:]
+			close(ch)
+			return
+		}
+	}
+	s.inUse--
+}
@@ -0,0 +1,110 @@
+package fins
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"folke99/gofins/mapping"
+)
+
+// Profile returns the PLC profile used to validate commands
+func (c *Client) Profile() mapping.Profile {
+	return *c.profile.Load()
+}
+
+// ReadCPUUnitModel reads the CPU unit model name, for example "CJ2M-CPU33"
+func (c *Client) ReadCPUUnitModel() (string, error) {
+	command := binary.BigEndian.AppendUint16(nil, mapping.CommandCodeCPUUnitDataRead)
+	r, e := c.sendCommand(command)
+	if e = checkResponse(r, e); e != nil {
+		return "", e
+	}
+	if e := checkMinDataLength(r, 20, "CPU unit data read"); e != nil {
+		return "", e
+	}
+	return string(bytes.TrimRight(r.Data[0:20], " \x00")), nil
+}
+
+// detectProfile selects the registered profile matching the CPU unit model
+func (c *Client) detectProfile() error {
+	model, err := c.ReadCPUUnitModel()
+	if err != nil {
+		return fmt.Errorf("failed to read CPU unit model: %w", err)
+	}
+	p, ok := mapping.ProfileForModel(model)
+	if !ok {
+		return fmt.Errorf("no profile for CPU unit model %q", model)
+	}
+	c.profile.Store(&p)
+	return nil
+}
+
+// TransferLimit returns the words a single read or write of memoryArea may transfer
+func (c *Client) TransferLimit(memoryArea mapping.MemoryArea) mapping.TransferLimit {
+	return mapping.TransferLimit{Read: uint16(c.maxReadWords(memoryArea)), Write: uint16(c.maxWriteWords(memoryArea))}
+}
+
+// maxReadWords returns the words a single read of memoryArea may transfer, limited by the
+// frame size, the transfer limits of the options and the profile
+func (c *Client) maxReadWords(memoryArea mapping.MemoryArea) int {
+	n := (c.maxFrameSize - RESPONSE_OVERHEAD) / 2
+	limit := c.transferLimits[memoryArea].Read
+	if limit == 0 {
+		limit = c.profile.Load().ReadLimit(memoryArea)
+	}
+	if limit > 0 {
+		n = min(n, int(limit))
+	}
+	return n
+}
+
+// maxWriteWords returns the words a single write to memoryArea may transfer, limited by the
+// frame size, the transfer limits of the options and the profile
+func (c *Client) maxWriteWords(memoryArea mapping.MemoryArea) int {
+	n := (c.maxFrameSize - TCP_HEADER_LENGTH - FINS_HEADER_LENGTH - 8) / 2
+	limit := c.transferLimits[memoryArea].Write
+	if limit == 0 {
+		limit = c.profile.Load().WriteLimit(memoryArea)
+	}
+	if limit > 0 {
+		n = min(n, int(limit))
+	}
+	return n
+}
+
+// checkCommand rejects command codes the profile does not support
+func (c *Client) checkCommand(command []byte) error {
+	if len(command) < 2 {
+		return fmt.Errorf("command too short: %d bytes", len(command))
+	}
+	commandCode := binary.BigEndian.Uint16(command[0:2])
+	if profile := c.profile.Load(); !profile.Supports(commandCode) {
+		return UnsupportedCommandError{Profile: profile.Name, CommandCode: commandCode}
+	}
+	return nil
+}
+
+// checkWordRange checks that count words starting at address fit in the memory area
+func (c *Client) checkWordRange(memoryArea mapping.MemoryArea, address uint16, count uint16) error {
+	return c.checkRange(memoryArea, address, 0, count, int(address)+int(count)-1)
+}
+
+// checkBitRange checks that count bits starting at address.bitOffset fit in the memory area
+func (c *Client) checkBitRange(memoryArea mapping.MemoryArea, address uint16, bitOffset byte, count uint16) error {
+	if bitOffset > 15 {
+		return AddressRangeError{Area: memoryArea, Address: address, BitOffset: bitOffset, Count: count}
+	}
+	last := int(address) + (int(bitOffset)+int(count)-1)/16
+	return c.checkRange(memoryArea, address, bitOffset, count, last)
+}
+
+func (c *Client) checkRange(memoryArea mapping.MemoryArea, address uint16, bitOffset byte, count uint16, last int) error {
+	max := c.profile.Load().AreaMaxAddress(memoryArea)
+	if max == 0 {
+		return nil
+	}
+	if count > 0 && last > int(max) || int(address) > int(max) {
+		return AddressRangeError{Area: memoryArea, Address: address, BitOffset: bitOffset, Count: count, MaxAddress: max}
+	}
+	return nil
+}
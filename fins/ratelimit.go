@@ -0,0 +1,107 @@
+package fins
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket limits the rate of commands sent to the PLC. Commands waiting for a token get
+// them in priority order, first come first served within a priority.
+type tokenBucket struct {
+	sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	tokens  float64
+	last    time.Time
+	waiting [priorityCount][]chan struct{}
+	timer   *time.Timer // Fires when the next token is earned, nil while nobody waits
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until a token is granted to a command of priority p and takes it
+func (b *tokenBucket) wait(p Priority) {
+	b.Lock()
+	b.refill()
+	if b.tokens >= 1 && !b.queued() {
+		b.tokens--
+		b.Unlock()
+		return
+	}
+	ch := make(chan struct{})
+	b.waiting[p] = append(b.waiting[p], ch)
+	b.schedule()
+	b.Unlock()
+
+	<-ch
+}
+
+// grant hands the earned tokens to the waiting commands, the highest priority first
+func (b *tokenBucket) grant() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.timer = nil
+	b.refill()
+	for p := PriorityHigh; p >= PriorityLow && b.tokens >= 1; {
+		if len(b.waiting[p]) == 0 {
+			p--
+			continue
+		}
+		close(b.waiting[p][0])
+		b.waiting[p] = b.waiting[p][1:]
+		b.tokens--
+	}
+	b.schedule()
+}
+
+// schedule arms the timer for the next token while commands wait, the caller holds the lock
+func (b *tokenBucket) schedule() {
+	if b.timer != nil || !b.queued() {
+		return
+	}
+	delay := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	b.timer = time.AfterFunc(delay, b.grant)
+}
+
+// refill adds the tokens earned since the last refill, the caller holds the lock
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+func (b *tokenBucket) queued() bool {
+	for _, w := range b.waiting {
+		if len(w) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// acquireSlot blocks until the request may be sent, the returned func releases the in-flight slot.
+// The token is taken first, so a command waiting for a token doesn't hold an in-flight slot.
+func (c *Client) acquireSlot(p Priority) func() {
+	if c.limiter != nil {
+		c.limiter.wait(p)
+	}
+	if c.scheduler != nil {
+		c.scheduler.acquire(p)
+	}
+	return func() {
+		if c.scheduler != nil {
+			c.scheduler.release()
+		}
+	}
+}
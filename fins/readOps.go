@@ -3,37 +3,61 @@ package fins
 import (
 	"bytes"
 	"fmt"
+	"folke99/gofins/finsproto"
 	"folke99/gofins/mapping"
 	"log"
 	"time"
 )
 
 // ReadWords Reads words from the PLC data area
-func (c *Client) ReadWords(memoryArea byte, address uint16, readCount uint16) ([]uint16, error) {
-	if mapping.CheckIsWordMemoryArea(memoryArea) == false {
-		return nil, IncompatibleMemoryAreaError{memoryArea}
+func (c *Client) ReadWords(memoryArea mapping.MemoryArea, address uint16, readCount uint16) ([]uint16, error) {
+	data := make([]uint16, readCount, readCount)
+	if err := c.ReadWordsInto(memoryArea, address, data); err != nil {
+		return nil, err
 	}
-	command := readCommand(memAddr(memoryArea, address), readCount)
-	r, e := c.sendCommand(command)
-	e = checkResponse(r, e)
-
-	//tracing TODO: remove
-	log.Printf("Response from ReadWords(), %+v", r)
+	return data, nil
+}
 
+// ReadWordsInto Reads len(dst) words from the PLC data area into dst.
+// Reusing dst between calls keeps hot polling loops from allocating a result slice per read.
+func (c *Client) ReadWordsInto(memoryArea mapping.MemoryArea, address uint16, dst []uint16) error {
+	if err := c.checkReadWords(memoryArea, address, len(dst)); err != nil {
+		return err
+	}
+	readCount := uint16(len(dst))
+	var command [8]byte
+	r, e := c.sendCommand(finsproto.AppendReadCommand(command[:0], memAddr(memoryArea, address), readCount))
+	e = checkResponse(r, e)
 	if e != nil {
-		return nil, e
+		return e
+	}
+	if e := checkDataLength(r, int(readCount)*2, "memory area read"); e != nil {
+		return e
 	}
 
-	data := make([]uint16, readCount, readCount)
 	for i := 0; i < int(readCount); i++ {
-		data[i] = c.byteOrder.Uint16(r.data[i*2 : i*2+2])
+		dst[i] = c.order().Uint16(r.Data[i*2 : i*2+2])
 	}
 
-	return data, nil
+	return nil
+}
+
+// checkReadWords validates a word read before anything is sent
+func (c *Client) checkReadWords(memoryArea mapping.MemoryArea, address uint16, readCount int) error {
+	if mapping.CheckIsWordMemoryArea(memoryArea) == false {
+		return IncompatibleMemoryAreaError{memoryArea}
+	}
+	if readCount == 0 {
+		return fmt.Errorf("read count must be greater than zero")
+	}
+	if max := c.maxReadWords(memoryArea); readCount > max {
+		return CountLimitError{Count: readCount, Max: max}
+	}
+	return c.checkWordRange(memoryArea, address, uint16(readCount))
 }
 
 // ReadBytes Reads bytes from the PLC data area
-func (c *Client) ReadBytes(memoryArea byte, address uint16, byteCount uint16) ([]byte, error) {
+func (c *Client) ReadBytes(memoryArea mapping.MemoryArea, address uint16, byteCount uint16) ([]byte, error) {
 	if !mapping.CheckIsWordMemoryArea(memoryArea) {
 		return nil, IncompatibleMemoryAreaError{memoryArea}
 	}
@@ -45,23 +69,29 @@ func (c *Client) ReadBytes(memoryArea byte, address uint16, byteCount uint16) ([
 
 	// Convert bytes to words (FINS protocol expects word count)
 	wordCount := byteCount / 2
+	if max := c.maxReadWords(memoryArea); int(wordCount) > max {
+		return nil, CountLimitError{Count: int(wordCount), Max: max}
+	}
+	if err := c.checkWordRange(memoryArea, address, wordCount); err != nil {
+		return nil, err
+	}
 
-	command := readCommand(memAddr(memoryArea, address), wordCount)
+	command := finsproto.ReadCommand(memAddr(memoryArea, address), wordCount)
 	r, e := c.sendCommand(command)
 	e = checkResponse(r, e)
 
-	//tracing TODO: remove
-	log.Printf("Response from ReadBytes(), %+v", r)
-
 	if e != nil {
 		return nil, e
 	}
+	if e := checkDataLength(r, int(byteCount), "memory area read"); e != nil {
+		return nil, e
+	}
 
-	return r.data, nil
+	return r.Data, nil
 }
 
 // ReadString reads a string from the PLC's DM memory area
-func (c *Client) ReadString(memoryArea byte, address uint16, byteCount uint16) (string, error) {
+func (c *Client) ReadString(memoryArea mapping.MemoryArea, address uint16, byteCount uint16) (string, error) {
 	if !mapping.CheckIsWordMemoryArea(memoryArea) {
 		return "", IncompatibleMemoryAreaError{memoryArea}
 	}
@@ -81,24 +111,27 @@ func (c *Client) ReadString(memoryArea byte, address uint16, byteCount uint16) (
 }
 
 // ReadBits Reads bits from the PLC data area
-func (c *Client) ReadBits(memoryArea byte, address uint16, bitOffset byte, readCount uint16) ([]bool, error) {
+func (c *Client) ReadBits(memoryArea mapping.MemoryArea, address uint16, bitOffset byte, readCount uint16) ([]bool, error) {
 	if mapping.CheckIsBitMemoryArea(memoryArea) == false {
 		return nil, IncompatibleMemoryAreaError{memoryArea}
 	}
-	command := readCommand(memAddrWithBitOffset(memoryArea, address, bitOffset), readCount)
+	if err := c.checkBitRange(memoryArea, address, bitOffset, readCount); err != nil {
+		return nil, err
+	}
+	command := finsproto.ReadCommand(memAddrWithBitOffset(memoryArea, address, bitOffset), readCount)
 	r, e := c.sendCommand(command)
 	e = checkResponse(r, e)
 
-	//tracing TODO: remove
-	log.Printf("Response from ReadBits(), %+v", r)
-
 	if e != nil {
 		return nil, e
 	}
+	if e := checkDataLength(r, int(readCount), "memory area bit read"); e != nil {
+		return nil, e
+	}
 
 	data := make([]bool, readCount, readCount)
 	for i := 0; i < int(readCount); i++ {
-		data[i] = r.data[i]&0x01 > 0
+		data[i] = r.Data[i]&0x01 > 0
 	}
 
 	return data, nil
@@ -125,22 +158,25 @@ func (c *Client) ReadPLCStatus() (*Response, error) {
 
 // ReadClock Reads the PLC clock
 func (c *Client) ReadClock() (*time.Time, error) {
-	r, e := c.sendCommand(clockReadCommand())
+	r, e := c.sendCommand(finsproto.ClockReadCommand())
 	e = checkResponse(r, e)
 	if e != nil {
 		return nil, e
 	}
-	year, _ := decodeBCD(r.data[0:1])
+	if e := checkMinDataLength(r, 6, "clock read"); e != nil {
+		return nil, e
+	}
+	year, _ := finsproto.DecodeBCD(r.Data[0:1])
 	if year < 50 {
 		year += 2000
 	} else {
 		year += 1900
 	}
-	month, _ := decodeBCD(r.data[1:2])
-	day, _ := decodeBCD(r.data[2:3])
-	hour, _ := decodeBCD(r.data[3:4])
-	minute, _ := decodeBCD(r.data[4:5])
-	second, _ := decodeBCD(r.data[5:6])
+	month, _ := finsproto.DecodeBCD(r.Data[1:2])
+	day, _ := finsproto.DecodeBCD(r.Data[2:3])
+	hour, _ := finsproto.DecodeBCD(r.Data[3:4])
+	minute, _ := finsproto.DecodeBCD(r.Data[4:5])
+	second, _ := finsproto.DecodeBCD(r.Data[5:6])
 
 	t := time.Date(
 		int(year), time.Month(month), int(day), int(hour), int(minute), int(second),
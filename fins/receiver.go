@@ -0,0 +1,286 @@
+package fins
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"folke99/gofins/finsproto"
+	"folke99/gofins/mapping"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const RECEIVER_EVENT_BUFFER = 64
+
+// ReceivedCommand is a FINS command initiated by a PLC
+type ReceivedCommand struct {
+	From     net.Addr
+	Request  Request
+	Memory   *MemoryWrite // Decoded payload of memory area write commands, nil otherwise
+	Received time.Time
+}
+
+// MemoryWrite is the payload of a memory area write command, as sent by the SEND instruction.
+// The write guard also gets the other write commands, Command tells them apart.
+type MemoryWrite struct {
+	Command   uint16        // Command code, mapping.CommandCodeMemoryAreaWrite for memory area writes
+	Address   MemoryAddress // Zero for commands not writing a memory area
+	ItemCount uint16
+	Data      []byte
+}
+
+// Words returns the written data as big endian words
+func (m MemoryWrite) Words() []uint16 {
+	words := make([]uint16, len(m.Data)/2)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(m.Data[i*2 : i*2+2])
+	}
+	return words
+}
+
+// Receiver accepts FINS/TCP connections opened by PLCs and exposes the commands they send.
+//
+// Memory area writes (SEND instructions) are acknowledged with a normal completion, other
+// commands are answered with EndCodeUndefinedCommand. All commands are delivered on Events().
+type Receiver struct {
+	sync.Mutex
+	listener net.Listener
+	node     byte
+	events   chan ReceivedCommand
+	dropped  uint64 // Commands not delivered because Events() was full
+	closed   bool
+	conns    map[net.Conn]byte // The node of each PLC connection, 0 before its handshake
+	nextNode byte              // Where the search for a free node starts
+}
+
+// NewReceiver listens on address, answering the FINS/TCP handshake as node
+func NewReceiver(address string, node byte) (*Receiver, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for PLC connections: %w", err)
+	}
+
+	r := &Receiver{
+		listener: listener,
+		node:     node,
+		events:   make(chan ReceivedCommand, RECEIVER_EVENT_BUFFER),
+		conns:    make(map[net.Conn]byte),
+		nextNode: node + 1,
+	}
+	go r.acceptConnections()
+	return r, nil
+}
+
+// Events returns the channel of received commands, it is closed by Close. Commands arriving
+// while it is full are dropped and answered with EndCodeDestinationNodeBusy, so the PLC
+// repeats its SEND; Dropped counts them.
+func (r *Receiver) Events() <-chan ReceivedCommand {
+	return r.events
+}
+
+// Dropped returns the number of commands dropped because Events() was full
+func (r *Receiver) Dropped() uint64 {
+	r.Lock()
+	defer r.Unlock()
+	return r.dropped
+}
+
+// Addr returns the address the receiver is listening on
+func (r *Receiver) Addr() net.Addr {
+	return r.listener.Addr()
+}
+
+// Close stops listening, closes all PLC connections and the Events() channel
+func (r *Receiver) Close() error {
+	r.Lock()
+	if r.closed {
+		r.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.events)
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.Unlock()
+
+	return r.listener.Close()
+}
+
+func (r *Receiver) acceptConnections() {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			r.Lock()
+			closed := r.closed
+			r.Unlock()
+			if closed {
+				return
+			}
+			log.Printf("Error accepting PLC connection: %v", err)
+			continue
+		}
+
+		r.Lock()
+		r.conns[conn] = 0
+		r.Unlock()
+
+		go r.handleConnection(conn)
+	}
+}
+
+func (r *Receiver) handleConnection(conn net.Conn) {
+	defer func() {
+		r.Lock()
+		delete(r.conns, conn)
+		r.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		command, payload, err := finsproto.ReadTCPFrame(reader)
+		if err != nil {
+			r.Lock()
+			closed := r.closed
+			r.Unlock()
+			if err != io.EOF && !closed {
+				log.Printf("PLC connection %v: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		var reply []byte
+		switch command {
+		case TCP_COMMAND_NODE_ADDRESS_REQUEST:
+			if len(payload) < 4 {
+				log.Printf("PLC connection %v: short node address request", conn.RemoteAddr())
+				return
+			}
+			reply = r.nodeAddressResponse(conn, payload[3])
+
+		case TCP_COMMAND_FRAME_SEND:
+			reply = r.handleFrame(conn.RemoteAddr(), payload)
+
+		default:
+			log.Printf("PLC connection %v: unsupported FINS/TCP command %d", conn.RemoteAddr(), command)
+			continue
+		}
+
+		if reply == nil {
+			continue
+		}
+		if _, err := conn.Write(reply); err != nil {
+			log.Printf("PLC connection %v: failed to reply: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// nodeAddressResponse answers the handshake of a PLC connection, a PLC requesting node 0 is
+// assigned a node that neither the receiver nor another connection uses
+func (r *Receiver) nodeAddressResponse(conn net.Conn, node byte) []byte {
+	r.Lock()
+	defer r.Unlock()
+
+	for tries := 0; node == 0; tries++ {
+		if tries == 0xFF {
+			return finsproto.TCPErrorFrame(TCP_COMMAND_NODE_ADDRESS_RESPONSE, finsproto.TCP_ERROR_NO_NODE_AVAILABLE)
+		}
+		if r.nextNode == 0 || r.nextNode == 0xFF {
+			r.nextNode = 1
+		}
+		if r.nextNode != r.node && !r.nodeInUse(conn, r.nextNode) {
+			node = r.nextNode
+		}
+		r.nextNode++
+	}
+	r.conns[conn] = node
+	return finsproto.TCPFrame(TCP_COMMAND_NODE_ADDRESS_RESPONSE, []byte{0, 0, 0, node, 0, 0, 0, r.node})
+}
+
+// nodeInUse reports whether a connection other than conn uses node, the caller holds the lock
+func (r *Receiver) nodeInUse(conn net.Conn, node byte) bool {
+	for other, n := range r.conns {
+		if other != conn && n == node {
+			return true
+		}
+	}
+	return false
+}
+
+// handleFrame publishes a command and returns the reply frame, or nil if none is required
+func (r *Receiver) handleFrame(from net.Addr, message []byte) []byte {
+	req, err := DecodeRequest(message)
+	if err != nil {
+		log.Printf("Failed to decode PLC command from %v: %v", from, err)
+		return nil
+	}
+	if !req.Header.IsCommand() {
+		log.Printf("Ignoring response frame from %v", from)
+		return nil
+	}
+
+	event := ReceivedCommand{From: from, Request: req, Received: time.Now()}
+	endCode := mapping.EndCodeUndefinedCommand
+	if req.CommandCode == mapping.CommandCodeMemoryAreaWrite {
+		if mw, err := decodeMemoryWrite(req.Data); err != nil {
+			log.Printf("Invalid memory area write from %v: %v", from, err)
+			endCode = mapping.EndCodeElementsDataDontMatch
+		} else {
+			event.Memory = &mw
+			endCode = mapping.EndCodeNormalCompletion
+		}
+	}
+
+	if !r.publish(event) {
+		log.Printf("Events() is full, dropping %s from %v", mapping.CommandCode(req.CommandCode), from)
+		endCode = mapping.EndCodeDestinationNodeBusy
+	}
+
+	if !req.Header.IsResponseRequired() {
+		return nil
+	}
+	return finsproto.TCPFrame(TCP_COMMAND_FRAME_SEND, EncodeResponse(NewResponse(req, endCode, nil)))
+}
+
+// publish delivers event on Events() without blocking the connection, it reports false when
+// the event was dropped
+func (r *Receiver) publish(event ReceivedCommand) bool {
+	r.Lock()
+	defer r.Unlock()
+	if r.closed {
+		return false
+	}
+	select {
+	case r.events <- event:
+		return true
+	default:
+		r.dropped++
+		return false
+	}
+}
+
+func decodeMemoryWrite(data []byte) (MemoryWrite, error) {
+	addr, err := DecodeMemoryAddress(data)
+	if err != nil {
+		return MemoryWrite{}, err
+	}
+	if len(data) < 6 {
+		return MemoryWrite{}, fmt.Errorf("missing item count")
+	}
+	count := binary.BigEndian.Uint16(data[4:6])
+
+	itemSize := 2
+	if mapping.MemoryArea(addr.MemoryArea).IsBit() {
+		itemSize = 1
+	}
+	if len(data)-6 != int(count)*itemSize {
+		return MemoryWrite{}, fmt.Errorf("expected %d data bytes for %d items, got %d", int(count)*itemSize, count, len(data)-6)
+	}
+
+	return MemoryWrite{Command: mapping.CommandCodeMemoryAreaWrite, Address: addr, ItemCount: count, Data: data[6:]}, nil
+}
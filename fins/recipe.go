@@ -0,0 +1,97 @@
+package fins
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// RecipeValue is a single tag value in a recipe
+type RecipeValue struct {
+	Tag   Tag     `json:"tag"`
+	Value float64 `json:"value"`
+}
+
+// Recipe is a named set of tag values, downloaded to the PLC in the listed order
+type Recipe struct {
+	Name   string        `json:"name"`
+	Values []RecipeValue `json:"values"`
+}
+
+// DownloadRecipe writes a recipe to the PLC as a Transaction of tag writes.
+//
+// The current values are read first, then every value is written and verified in order.
+// If a step fails, the already written tags are restored in reverse order and a
+// RecipeError describing the failed step is returned.
+func (c *Client) DownloadRecipe(r Recipe) error {
+	tx := c.Transaction()
+	for _, v := range r.Values {
+		tx.WriteTag(v.Tag, v.Value)
+	}
+	var txErr TransactionError
+	if err := tx.Commit(); !errors.As(err, &txErr) {
+		return err
+	}
+	tag := r.Values[txErr.Step].Tag.Name
+	log.Printf("Recipe %q failed at tag %s: %v", r.Name, tag, txErr.Err)
+	return RecipeError{Recipe: r.Name, Step: txErr.Step, Tag: tag, Err: txErr.Err, RollbackErr: txErr.RollbackErr}
+}
+
+// UploadRecipe reads the current values of tags into a new recipe
+func (c *Client) UploadRecipe(name string, tags []Tag) (*Recipe, error) {
+	r := &Recipe{Name: name, Values: make([]RecipeValue, 0, len(tags))}
+	for _, t := range tags {
+		value, err := c.ReadTag(t)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tag %s: %w", t.Name, err)
+		}
+		r.Values = append(r.Values, RecipeValue{Tag: t, Value: value})
+	}
+	return r, nil
+}
+
+// SaveRecipe writes a recipe as JSON
+func SaveRecipe(w io.Writer, r Recipe) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// LoadRecipe reads a recipe saved with SaveRecipe
+func LoadRecipe(rd io.Reader) (*Recipe, error) {
+	var r Recipe
+	if err := json.NewDecoder(rd).Decode(&r); err != nil {
+		return nil, fmt.Errorf("failed to decode recipe: %w", err)
+	}
+	for _, v := range r.Values {
+		if _, err := v.Tag.DataType.WordCount(); err != nil {
+			return nil, fmt.Errorf("tag %s: %w", v.Tag.Name, err)
+		}
+	}
+	return &r, nil
+}
+
+// writeAndVerifyTag writes a tag and reads it back, unless the write wasn't sent in dry-run mode
+func (c *Client) writeAndVerifyTag(t Tag, value float64) error {
+	if err := c.WriteTag(t, value); err != nil || c.dryRun {
+		return err
+	}
+
+	readBack, err := c.ReadTag(t)
+	if err != nil {
+		return fmt.Errorf("failed to verify write: %w", err)
+	}
+
+	expected := value
+	if t.DataType == DataTypeReal {
+		expected = float64(float32(value))
+	} else if t.DataType == DataTypeBool && value != 0 {
+		expected = 1
+	}
+	if readBack != expected {
+		return fmt.Errorf("verification failed: wrote %v, read back %v", expected, readBack)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package fins
+
+import "fmt"
+
+// Layout of the routing table parameter area. The local network table is a count word and
+// one word per entry, network address in the high and unit address in the low byte. The relay
+// network table follows with a count word and two words per entry: destination and relay
+// network in the first, relay node in the low byte of the second.
+const (
+	ROUTING_LOCAL_COUNT_WORD = 0x00
+	ROUTING_LOCAL_FIRST_WORD = 0x01
+	ROUTING_MAX_LOCAL        = 16
+	ROUTING_RELAY_COUNT_WORD = ROUTING_LOCAL_FIRST_WORD + ROUTING_MAX_LOCAL
+	ROUTING_RELAY_FIRST_WORD = ROUTING_RELAY_COUNT_WORD + 1
+	ROUTING_MAX_RELAY        = 20
+	ROUTING_TABLE_WORDS      = ROUTING_RELAY_FIRST_WORD + 2*ROUTING_MAX_RELAY
+
+	MAX_NETWORK_ADDRESS = 127
+	MIN_CPU_BUS_UNIT    = 0x10 // Unit address of CPU Bus Unit 0, unit n has 0x10+n
+	MAX_CPU_BUS_UNIT    = 0x1F
+)
+
+// LocalNetwork connects a network to the communications unit at UnitAddress
+type LocalNetwork struct {
+	Network     byte
+	UnitAddress byte // CPU Bus Unit number + 0x10
+}
+
+// RelayNetwork routes a Destination network through RelayNode of RelayNetwork
+type RelayNetwork struct {
+	Destination  byte
+	RelayNetwork byte
+	RelayNode    byte
+}
+
+// RoutingTables are the FINS routing tables of a CPU unit
+type RoutingTables struct {
+	Local []LocalNetwork
+	Relay []RelayNetwork
+}
+
+// Validate checks the table sizes and addresses and that every network is routed once.
+// Relay networks must be local networks of the PLC.
+func (t RoutingTables) Validate() error {
+	if len(t.Local) > ROUTING_MAX_LOCAL {
+		return fmt.Errorf("%d local networks exceed the limit of %d", len(t.Local), ROUTING_MAX_LOCAL)
+	}
+	if len(t.Relay) > ROUTING_MAX_RELAY {
+		return fmt.Errorf("%d relay networks exceed the limit of %d", len(t.Relay), ROUTING_MAX_RELAY)
+	}
+
+	local := make(map[byte]bool)
+	units := make(map[byte]bool)
+	for _, l := range t.Local {
+		if l.Network < 1 || l.Network > MAX_NETWORK_ADDRESS {
+			return fmt.Errorf("local network %d is out of range 1 to %d", l.Network, MAX_NETWORK_ADDRESS)
+		}
+		if l.UnitAddress < MIN_CPU_BUS_UNIT || l.UnitAddress > MAX_CPU_BUS_UNIT {
+			return fmt.Errorf("unit address 0x%02X of local network %d is not a CPU Bus Unit", l.UnitAddress, l.Network)
+		}
+		if local[l.Network] {
+			return fmt.Errorf("local network %d is listed twice", l.Network)
+		}
+		if units[l.UnitAddress] {
+			return fmt.Errorf("unit address 0x%02X connects two local networks", l.UnitAddress)
+		}
+		local[l.Network], units[l.UnitAddress] = true, true
+	}
+
+	relayed := make(map[byte]bool)
+	for _, r := range t.Relay {
+		if r.Destination < 1 || r.Destination > MAX_NETWORK_ADDRESS {
+			return fmt.Errorf("destination network %d is out of range 1 to %d", r.Destination, MAX_NETWORK_ADDRESS)
+		}
+		if local[r.Destination] || relayed[r.Destination] {
+			return fmt.Errorf("network %d is routed twice", r.Destination)
+		}
+		if !local[r.RelayNetwork] {
+			return fmt.Errorf("relay network %d of destination %d is not a local network", r.RelayNetwork, r.Destination)
+		}
+		if r.RelayNode < 1 || r.RelayNode > 254 {
+			return fmt.Errorf("relay node %d of destination %d is out of range 1 to 254", r.RelayNode, r.Destination)
+		}
+		relayed[r.Destination] = true
+	}
+	return nil
+}
+
+// SetLocalNetwork adds a local network or moves it to another unit
+func (t *RoutingTables) SetLocalNetwork(network, unitAddress byte) {
+	for i := range t.Local {
+		if t.Local[i].Network == network {
+			t.Local[i].UnitAddress = unitAddress
+			return
+		}
+	}
+	t.Local = append(t.Local, LocalNetwork{Network: network, UnitAddress: unitAddress})
+}
+
+// SetRelayNetwork adds a relay route to destination or replaces its route
+func (t *RoutingTables) SetRelayNetwork(destination, relayNetwork, relayNode byte) {
+	route := RelayNetwork{Destination: destination, RelayNetwork: relayNetwork, RelayNode: relayNode}
+	for i := range t.Relay {
+		if t.Relay[i].Destination == destination {
+			t.Relay[i] = route
+			return
+		}
+	}
+	t.Relay = append(t.Relay, route)
+}
+
+// RemoveNetwork removes the local network or relay route of network and reports whether one existed
+func (t *RoutingTables) RemoveNetwork(network byte) bool {
+	for i, l := range t.Local {
+		if l.Network == network {
+			t.Local = append(t.Local[:i], t.Local[i+1:]...)
+			return true
+		}
+	}
+	for i, r := range t.Relay {
+		if r.Destination == network {
+			t.Relay = append(t.Relay[:i], t.Relay[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// decodeRoutingTables decodes the words of the routing table parameter area
+func decodeRoutingTables(words []uint16) (RoutingTables, error) {
+	var t RoutingTables
+	local, relay := int(words[ROUTING_LOCAL_COUNT_WORD]), int(words[ROUTING_RELAY_COUNT_WORD])
+	if local > ROUTING_MAX_LOCAL || relay > ROUTING_MAX_RELAY {
+		return t, fmt.Errorf("invalid routing tables with %d local and %d relay networks", local, relay)
+	}
+	for i := range local {
+		w := words[ROUTING_LOCAL_FIRST_WORD+i]
+		t.Local = append(t.Local, LocalNetwork{Network: byte(w >> 8), UnitAddress: byte(w)})
+	}
+	for i := range relay {
+		w := words[ROUTING_RELAY_FIRST_WORD+2*i:]
+		t.Relay = append(t.Relay, RelayNetwork{Destination: byte(w[0] >> 8), RelayNetwork: byte(w[0]), RelayNode: byte(w[1])})
+	}
+	return t, nil
+}
+
+// encode returns the words of the routing table parameter area, unused entries are zero
+func (t RoutingTables) encode() []uint16 {
+	words := make([]uint16, ROUTING_TABLE_WORDS)
+	words[ROUTING_LOCAL_COUNT_WORD] = uint16(len(t.Local))
+	for i, l := range t.Local {
+		words[ROUTING_LOCAL_FIRST_WORD+i] = uint16(l.Network)<<8 | uint16(l.UnitAddress)
+	}
+	words[ROUTING_RELAY_COUNT_WORD] = uint16(len(t.Relay))
+	for i, r := range t.Relay {
+		words[ROUTING_RELAY_FIRST_WORD+2*i] = uint16(r.Destination)<<8 | uint16(r.RelayNetwork)
+		words[ROUTING_RELAY_FIRST_WORD+2*i+1] = uint16(r.RelayNode)
+	}
+	return words
+}
+
+// ReadRoutingTables reads the local and relay network tables of the PLC
+func (c *Client) ReadRoutingTables() (RoutingTables, error) {
+	words, err := c.ReadParameterArea(ParameterRoutingTable, 0, ROUTING_TABLE_WORDS)
+	if err != nil {
+		return RoutingTables{}, err
+	}
+	return decodeRoutingTables(words)
+}
+
+// WriteRoutingTables validates and writes the routing tables, which needs PROGRAM mode. The
+// PLC uses the new tables after it was restarted or power cycled.
+func (c *Client) WriteRoutingTables(t RoutingTables) error {
+	if err := t.Validate(); err != nil {
+		return fmt.Errorf("invalid routing tables: %w", err)
+	}
+	return c.WriteParameterArea(ParameterRoutingTable, 0, t.encode())
+}
+
+// UpdateRoutingTables reads the routing tables, applies update and writes them back unless
+// update returns an error
+func (c *Client) UpdateRoutingTables(update func(t *RoutingTables) error) error {
+	t, err := c.ReadRoutingTables()
+	if err != nil {
+		return err
+	}
+	if err := update(&t); err != nil {
+		return err
+	}
+	return c.WriteRoutingTables(t)
+}
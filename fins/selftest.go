@@ -0,0 +1,147 @@
+package fins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"folke99/gofins/mapping"
+	"strings"
+	"time"
+)
+
+// Steps of the self-test in the order they run
+const (
+	SelfTestHandshake  = "handshake"
+	SelfTestStatusRead = "status read"
+	SelfTestClockRead  = "clock read"
+	SelfTestDMRead     = "DM read"
+)
+
+// SelfTestStep is the outcome of one step of the self-test
+type SelfTestStep struct {
+	Name     string
+	Duration time.Duration
+	Detail   string // What the PLC answered
+	Err      error  // Nil when the step passed
+}
+
+// SelfTestReport is the outcome of SelfTest
+type SelfTestReport struct {
+	Started    time.Time
+	ClientNode byte
+	ServerNode byte
+	Status     *PLCStatus // Nil when the status read failed
+	Clock      time.Time  // Zero when the clock read failed
+	Steps      []SelfTestStep
+}
+
+// OK reports whether all steps passed
+func (r SelfTestReport) OK() bool {
+	return r.Err() == nil
+}
+
+// Err returns the errors of the failed steps, nil when all passed
+func (r SelfTestReport) Err() error {
+	var errs []error
+	for _, s := range r.Steps {
+		if s.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name, s.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r SelfTestReport) String() string {
+	var b strings.Builder
+	for _, s := range r.Steps {
+		if s.Err != nil {
+			fmt.Fprintf(&b, "FAIL %-12s %v\n", s.Name, s.Err)
+		} else {
+			fmt.Fprintf(&b, "ok   %-12s %s (%v)\n", s.Name, s.Detail, s.Duration.Round(time.Microsecond))
+		}
+	}
+	return b.String()
+}
+
+// SelfTest checks that the link to the PLC works: the session handshake, a status read, a
+// clock read and a read of D0. It only reads from the PLC. Every step runs even when an
+// earlier one failed, except that nothing is sent without a session; steps left when ctx is
+// done fail with ctx.Err(). The error is that of the report.
+func (c *Client) SelfTest(ctx context.Context) (SelfTestReport, error) {
+	report := SelfTestReport{Started: time.Now()}
+
+	connected := report.run(ctx, SelfTestHandshake, func(report *SelfTestReport) (string, error) {
+		if _, err := c.readyConnection(); err != nil {
+			return "", err
+		}
+		e := c.connectionEvent()
+		report.ClientNode, report.ServerNode = e.ClientNode, e.ServerNode
+		if e.ClientNode == 0 || e.ServerNode == 0 {
+			return "", fmt.Errorf("session has client node %d and PLC node %d", e.ClientNode, e.ServerNode)
+		}
+		return fmt.Sprintf("client node %d, PLC node %d via %s", e.ClientNode, e.ServerNode, e.Local), nil
+	})
+	if !connected {
+		for _, name := range []string{SelfTestStatusRead, SelfTestClockRead, SelfTestDMRead} {
+			report.Steps = append(report.Steps, SelfTestStep{Name: name, Err: fmt.Errorf("skipped without a session")})
+		}
+		return report, report.Err()
+	}
+
+	report.run(ctx, SelfTestStatusRead, func(report *SelfTestReport) (string, error) {
+		status, err := c.Status()
+		if err != nil {
+			return "", err
+		}
+		report.Status = status
+		return status.String(), nil
+	})
+	report.run(ctx, SelfTestClockRead, func(report *SelfTestReport) (string, error) {
+		t, err := c.ReadClock()
+		if err != nil {
+			return "", err
+		}
+		report.Clock = *t
+		return t.Format(time.DateTime), nil
+	})
+	report.run(ctx, SelfTestDMRead, func(*SelfTestReport) (string, error) {
+		words, err := c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("D0 = 0x%04X", words[0]), nil
+	})
+	return report, report.Err()
+}
+
+// run appends the outcome of step to the report and reports whether it passed. step fills in
+// a copy of the report, which is kept once it returned, so a step abandoned for ctx can't
+// change the report.
+func (r *SelfTestReport) run(ctx context.Context, name string, step func(r *SelfTestReport) (string, error)) bool {
+	start := time.Now()
+	if err := ctx.Err(); err != nil {
+		r.Steps = append(r.Steps, SelfTestStep{Name: name, Err: err})
+		return false
+	}
+
+	type result struct {
+		report SelfTestReport
+		detail string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func(local SelfTestReport) {
+		detail, err := step(&local)
+		done <- result{local, detail, err}
+	}(*r)
+
+	select {
+	case <-ctx.Done():
+		r.Steps = append(r.Steps, SelfTestStep{Name: name, Duration: time.Since(start), Err: ctx.Err()})
+		return false
+	case res := <-done:
+		*r = res.report
+		r.Steps = append(r.Steps, SelfTestStep{Name: name, Duration: time.Since(start), Detail: res.detail, Err: res.err})
+		return res.err == nil
+	}
+}
@@ -0,0 +1,225 @@
+package fins
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"folke99/gofins/mapping"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Snapshot stream format (all values big endian):
+//
+//	header: "FINSSNAP" | version (1) | memory area (1) | start (2) | word count (4) | unix nano (8)
+//	chunk:  word count (2) | words (2 per word) | CRC-32 of the words (4)
+const (
+	SNAPSHOT_MAGIC       = "FINSSNAP"
+	SNAPSHOT_VERSION     = 1
+	SNAPSHOT_HEADER_SIZE = 24
+	SNAPSHOT_CHUNK_WORDS = 500 // Largest chunk, reads are smaller when the PLC profile requires it
+)
+
+// Snapshot is a copy of a contiguous memory region
+type Snapshot struct {
+	MemoryArea mapping.MemoryArea
+	Start      uint16
+	Words      []uint16
+	Taken      time.Time
+}
+
+// ProgressFunc is called after every chunk with the number of words done and the total
+type ProgressFunc func(done, total int)
+
+// SnapshotArea reads count words starting at start and streams them to w in chunks
+func (c *Client) SnapshotArea(w io.Writer, memoryArea mapping.MemoryArea, start uint16, count int, progress ProgressFunc) error {
+	if count <= 0 || int(start)+count > 0x10000 {
+		return fmt.Errorf("invalid snapshot range: start %d, count %d", start, count)
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(encodeSnapshotHeader(memoryArea, start, count, time.Now())); err != nil {
+		return err
+	}
+
+	for done := 0; done < count; {
+		n := min(SNAPSHOT_CHUNK_WORDS, c.maxReadWords(memoryArea), count-done)
+		words, err := c.ReadWords(memoryArea, start+uint16(done), uint16(n))
+		if err != nil {
+			return fmt.Errorf("snapshot read at address %d failed: %w", int(start)+done, err)
+		}
+		if err := writeSnapshotChunk(bw, words); err != nil {
+			return err
+		}
+		done += n
+		if progress != nil {
+			progress(done, count)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// RestoreArea writes a snapshot stream produced by SnapshotArea back to the PLC.
+// Every chunk is checked against its checksum before it is written, a corrupt chunk
+// stops the restore with the preceding chunks already written.
+func (c *Client) RestoreArea(r io.Reader, progress ProgressFunc) error {
+	br := bufio.NewReader(r)
+	memoryArea, start, count, _, err := readSnapshotHeader(br)
+	if err != nil {
+		return err
+	}
+
+	for done := 0; done < count; {
+		words, err := readSnapshotChunk(br)
+		if err != nil {
+			return fmt.Errorf("restore stopped after %d of %d words: %w", done, count, err)
+		}
+		if done+len(words) > count {
+			return fmt.Errorf("restore stopped after %d of %d words: snapshot contains more words than declared", done, count)
+		}
+		for len(words) > 0 {
+			n := min(len(words), c.maxWriteWords(memoryArea))
+			if err := c.WriteWords(memoryArea, start+uint16(done), words[:n]); err != nil {
+				return fmt.Errorf("restore write at address %d failed: %w", int(start)+done, err)
+			}
+			words = words[n:]
+			done += n
+		}
+		if progress != nil {
+			progress(done, count)
+		}
+	}
+
+	return nil
+}
+
+// ReadSnapshot decodes and verifies a complete snapshot stream into memory
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	br := bufio.NewReader(r)
+	memoryArea, start, count, taken, err := readSnapshotHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		MemoryArea: memoryArea,
+		Start:      start,
+		Words:      make([]uint16, 0, count),
+		Taken:      taken,
+	}
+	for len(s.Words) < count {
+		words, err := readSnapshotChunk(br)
+		if err != nil {
+			return nil, err
+		}
+		s.Words = append(s.Words, words...)
+	}
+	if len(s.Words) != count {
+		return nil, fmt.Errorf("snapshot contains %d words, header declares %d", len(s.Words), count)
+	}
+
+	return s, nil
+}
+
+// WriteTo streams an in-memory snapshot in the SnapshotArea format
+func (s *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	if _, err := bw.Write(encodeSnapshotHeader(s.MemoryArea, s.Start, len(s.Words), s.Taken)); err != nil {
+		return cw.n, err
+	}
+
+	for i := 0; i < len(s.Words); i += SNAPSHOT_CHUNK_WORDS {
+		end := min(i+SNAPSHOT_CHUNK_WORDS, len(s.Words))
+		if err := writeSnapshotChunk(bw, s.Words[i:end]); err != nil {
+			return cw.n, err
+		}
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func encodeSnapshotHeader(memoryArea mapping.MemoryArea, start uint16, count int, taken time.Time) []byte {
+	header := make([]byte, SNAPSHOT_HEADER_SIZE)
+	copy(header[0:8], SNAPSHOT_MAGIC)
+	header[8] = SNAPSHOT_VERSION
+	header[9] = byte(memoryArea)
+	binary.BigEndian.PutUint16(header[10:12], start)
+	binary.BigEndian.PutUint32(header[12:16], uint32(count))
+	binary.BigEndian.PutUint64(header[16:24], uint64(taken.UnixNano()))
+	return header
+}
+
+func writeSnapshotChunk(w io.Writer, words []uint16) error {
+	chunk := make([]byte, 2+2*len(words)+4)
+	binary.BigEndian.PutUint16(chunk[0:2], uint16(len(words)))
+	for i, word := range words {
+		binary.BigEndian.PutUint16(chunk[2+i*2:4+i*2], word)
+	}
+	data := chunk[2 : 2+2*len(words)]
+	binary.BigEndian.PutUint32(chunk[2+len(data):], crc32.ChecksumIEEE(data))
+	_, err := w.Write(chunk)
+	return err
+}
+
+func readSnapshotHeader(r io.Reader) (mapping.MemoryArea, uint16, int, time.Time, error) {
+	header := make([]byte, SNAPSHOT_HEADER_SIZE)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, 0, time.Time{}, fmt.Errorf("failed to read snapshot header: %w", err)
+	}
+	if string(header[0:8]) != SNAPSHOT_MAGIC {
+		return 0, 0, 0, time.Time{}, fmt.Errorf("invalid snapshot marker: %q", header[0:8])
+	}
+	if header[8] != SNAPSHOT_VERSION {
+		return 0, 0, 0, time.Time{}, fmt.Errorf("unsupported snapshot version: %d", header[8])
+	}
+
+	start := binary.BigEndian.Uint16(header[10:12])
+	count := int(binary.BigEndian.Uint32(header[12:16]))
+	if int(start)+count > 0x10000 {
+		return 0, 0, 0, time.Time{}, fmt.Errorf("invalid snapshot range: start %d, count %d", start, count)
+	}
+	taken := time.Unix(0, int64(binary.BigEndian.Uint64(header[16:24])))
+
+	return mapping.MemoryArea(header[9]), start, count, taken, nil
+}
+
+func readSnapshotChunk(r io.Reader) ([]uint16, error) {
+	lengthBytes := make([]byte, 2)
+	if _, err := io.ReadFull(r, lengthBytes); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot chunk: %w", err)
+	}
+	n := int(binary.BigEndian.Uint16(lengthBytes))
+	if n == 0 || n > SNAPSHOT_CHUNK_WORDS {
+		return nil, fmt.Errorf("invalid snapshot chunk length: %d", n)
+	}
+
+	data := make([]byte, 2*n+4)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot chunk: %w", err)
+	}
+	if crc32.ChecksumIEEE(data[:2*n]) != binary.BigEndian.Uint32(data[2*n:]) {
+		return nil, fmt.Errorf("snapshot chunk checksum mismatch")
+	}
+
+	words := make([]uint16, n)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(data[i*2 : i*2+2])
+	}
+	return words, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,205 @@
+package fins
+
+import (
+	"folke99/gofins/mapping"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_STATUS_WATCH_INTERVAL = time.Second
+	STATUS_EVENT_BUFFER           = 16
+)
+
+// StatusEventType is the kind of transition a StatusEvent reports
+type StatusEventType uint8
+
+const (
+	EventModeChanged         StatusEventType = iota // Operating status or mode changed, other than the transitions below
+	EventRunToStop                                  // The program stopped executing
+	EventStopToRun                                  // The program started executing
+	EventFatalErrorRaised                           // Fatal error flags were set
+	EventFatalErrorCleared                          // Fatal error flags were reset
+	EventBatteryErrorRaised                         // The battery error flag was set
+	EventBatteryErrorCleared                        // The battery error flag was reset
+	EventStatusReadFailed                           // The status could not be read, reported once until a read succeeds
+)
+
+func (t StatusEventType) String() string {
+	switch t {
+	case EventModeChanged:
+		return "ModeChanged"
+	case EventRunToStop:
+		return "RunToStop"
+	case EventStopToRun:
+		return "StopToRun"
+	case EventFatalErrorRaised:
+		return "FatalErrorRaised"
+	case EventFatalErrorCleared:
+		return "FatalErrorCleared"
+	case EventBatteryErrorRaised:
+		return "BatteryErrorRaised"
+	case EventBatteryErrorCleared:
+		return "BatteryErrorCleared"
+	case EventStatusReadFailed:
+		return "StatusReadFailed"
+	default:
+		return "Unknown"
+	}
+}
+
+// StatusEvent is a transition between two status reads
+type StatusEvent struct {
+	Type     StatusEventType
+	Time     time.Time
+	Previous *PLCStatus     // Status before the transition, nil for errors present at the first read
+	Current  *PLCStatus     // Status after the transition, nil when the read failed
+	Fatal    FatalErrorCode // Fatal error flags raised or cleared
+	Errors   []string       // Names of the fatal error flags raised or cleared
+	Err      error          // Read error of EventStatusReadFailed
+}
+
+// StatusWatcherOptions configures a StatusWatcher, zero values use the defaults
+type StatusWatcherOptions struct {
+	Interval time.Duration // Time between status reads, 1s by default
+}
+
+// StatusWatcher polls Status() and emits an event for every mode and error transition.
+// The first read is the baseline, errors present at that read are reported as raised.
+type StatusWatcher struct {
+	sync.Mutex
+	client *Client
+	opts   StatusWatcherOptions
+	last   *PLCStatus
+	failed bool
+	events chan StatusEvent
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewStatusWatcher starts watching the status of the PLC behind c, the first read runs immediately
+func NewStatusWatcher(c *Client, opts StatusWatcherOptions) *StatusWatcher {
+	if opts.Interval <= 0 {
+		opts.Interval = DEFAULT_STATUS_WATCH_INTERVAL
+	}
+	w := &StatusWatcher{
+		client: c,
+		opts:   opts,
+		events: make(chan StatusEvent, STATUS_EVENT_BUFFER),
+		done:   make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.loop()
+	return w
+}
+
+// Events returns the channel of status events, it is closed by Close.
+// It must be drained, polling pauses while the channel is full.
+func (w *StatusWatcher) Events() <-chan StatusEvent {
+	return w.events
+}
+
+// Status returns the status of the last successful read, nil before the first one
+func (w *StatusWatcher) Status() *PLCStatus {
+	w.Lock()
+	defer w.Unlock()
+	return w.last
+}
+
+// Close stops polling and closes the event channel
+func (w *StatusWatcher) Close() {
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return
+	}
+	w.closed = true
+	w.Unlock()
+
+	close(w.done)
+	w.wg.Wait()
+	close(w.events)
+}
+
+func (w *StatusWatcher) loop() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, e := range w.poll() {
+			select {
+			case <-w.done:
+				return
+			case w.events <- e:
+			}
+		}
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll reads the status and returns the events of the transition from the previous read
+func (w *StatusWatcher) poll() []StatusEvent {
+	status, err := w.client.Status()
+	now := time.Now()
+
+	w.Lock()
+	defer w.Unlock()
+	if err != nil {
+		if w.failed {
+			return nil
+		}
+		w.failed = true
+		return []StatusEvent{{Type: EventStatusReadFailed, Time: now, Previous: w.last, Err: err}}
+	}
+	w.failed = false
+	previous := w.last
+	w.last = status
+	return statusTransitions(previous, status, now)
+}
+
+// statusTransitions compares two status reads, previous is nil for the first read
+func statusTransitions(previous, current *PLCStatus, now time.Time) []StatusEvent {
+	var events []StatusEvent
+	event := func(t StatusEventType) *StatusEvent {
+		events = append(events, StatusEvent{Type: t, Time: now, Previous: previous, Current: current})
+		return &events[len(events)-1]
+	}
+
+	before := PLCStatus{}
+	if previous != nil {
+		before = *previous
+		switch {
+		case previous.Status == mapping.StatusRun && current.Status == mapping.StatusStop:
+			event(EventRunToStop)
+		case previous.Status == mapping.StatusStop && current.Status == mapping.StatusRun:
+			event(EventStopToRun)
+		case previous.Status != current.Status || previous.Mode != current.Mode:
+			event(EventModeChanged)
+		}
+	}
+
+	if raised := current.FatalError &^ before.FatalError; raised != 0 {
+		e := event(EventFatalErrorRaised)
+		e.Fatal, e.Errors = raised, raised.Names()
+	}
+	if cleared := before.FatalError &^ current.FatalError; cleared != 0 {
+		e := event(EventFatalErrorCleared)
+		e.Fatal, e.Errors = cleared, cleared.Names()
+	}
+
+	battery := current.HasNonFatalError(ErrorBattery)
+	switch {
+	case battery && !before.HasNonFatalError(ErrorBattery):
+		event(EventBatteryErrorRaised)
+	case !battery && before.HasNonFatalError(ErrorBattery):
+		event(EventBatteryErrorCleared)
+	}
+	return events
+}
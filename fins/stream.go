@@ -0,0 +1,126 @@
+package fins
+
+import (
+	"fmt"
+	"folke99/gofins/mapping"
+	"io"
+)
+
+// AreaReader returns a reader streaming the words starting at start as big endian bytes.
+// The words are read lazily in chunks as the consumer reads, so whole DM or EM banks
+// can be exported without buffering them in memory.
+func (c *Client) AreaReader(memoryArea mapping.MemoryArea, start uint16, words int) io.Reader {
+	r := &areaReader{
+		client:     c,
+		memoryArea: memoryArea,
+		next:       start,
+		remaining:  words,
+	}
+	if words < 0 || int(start)+words > 0x10000 {
+		r.err = fmt.Errorf("invalid area range: start %d, count %d", start, words)
+	}
+	return r
+}
+
+type areaReader struct {
+	client     *Client
+	memoryArea mapping.MemoryArea
+	next       uint16
+	remaining  int
+	buf        []byte
+	err        error
+}
+
+func (r *areaReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.remaining == 0 {
+			return 0, io.EOF
+		}
+		n := min(r.client.maxReadWords(r.memoryArea), r.remaining)
+		data, err := r.client.ReadBytes(r.memoryArea, r.next, uint16(2*n))
+		if err != nil {
+			r.err = fmt.Errorf("area read at address %d failed: %w", r.next, err)
+			return 0, r.err
+		}
+		r.buf = data
+		r.next += uint16(n)
+		r.remaining -= n
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// AreaWriter returns a writer storing big endian bytes as words starting at start.
+// Data is buffered to word boundaries and written in chunks as it arrives, Close writes
+// the rest and fails if an odd number of bytes was written.
+func (c *Client) AreaWriter(memoryArea mapping.MemoryArea, start uint16) io.WriteCloser {
+	return &areaWriter{
+		client:     c,
+		memoryArea: memoryArea,
+		next:       int(start),
+	}
+}
+
+type areaWriter struct {
+	client     *Client
+	memoryArea mapping.MemoryArea
+	next       int
+	buf        []byte
+	err        error
+	closed     bool
+}
+
+func (w *areaWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("area writer is closed")
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buf = append(w.buf, p...)
+	chunk := 2 * w.client.maxWriteWords(w.memoryArea)
+	for len(w.buf) >= chunk {
+		if err := w.flush(chunk); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *areaWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.buf)%2 != 0 {
+		return fmt.Errorf("area write of %d bytes doesn't end on a word boundary", len(w.buf))
+	}
+	if len(w.buf) > 0 {
+		return w.flush(len(w.buf))
+	}
+	return nil
+}
+
+// flush writes the first n bytes of the buffer, n is a multiple of 2
+func (w *areaWriter) flush(n int) error {
+	if w.next+n/2 > 0x10000 {
+		w.err = fmt.Errorf("area write at address %d exceeds the address range", w.next)
+		return w.err
+	}
+	if err := w.client.WriteBytes(w.memoryArea, uint16(w.next), w.buf[:n]); err != nil {
+		w.err = fmt.Errorf("area write at address %d failed: %w", w.next, err)
+		return w.err
+	}
+	w.next += n / 2
+	w.buf = w.buf[n:]
+	return nil
+}
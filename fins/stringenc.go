@@ -0,0 +1,125 @@
+package fins
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"folke99/gofins/mapping"
+
+	"golang.org/x/text/encoding"
+)
+
+// StringLayout is how the length of a string in PLC memory is determined
+type StringLayout int
+
+const (
+	StringNullTerminated StringLayout = iota // The string ends at the first null byte or the end of the area, the default
+	StringLengthPrefixed                     // A word with the byte count precedes the characters
+)
+
+// StringOptions describes how strings are stored in PLC memory.
+// The zero value stores plain bytes, high byte first and null padded like ReadString and WriteString.
+type StringOptions struct {
+	Encoding  encoding.Encoding // Character encoding, for example japanese.ShiftJIS; nil stores the bytes of the Go string
+	SwapBytes bool              // Store the first character of every word in the low byte
+	Length    int               // Fixed length in bytes, shorter strings are padded and longer ones rejected; 0 for no fixed length
+	Padding   byte              // Byte filling up to the fixed length and the word boundary, 0x00 by default
+	Layout    StringLayout
+}
+
+// ReadStringWith reads a string of at most byteCount bytes stored as described by opts.
+// For length prefixed strings byteCount excludes the prefix word.
+func (c *Client) ReadStringWith(memoryArea mapping.MemoryArea, address uint16, byteCount uint16, opts StringOptions) (string, error) {
+	if !mapping.CheckIsWordMemoryArea(memoryArea) {
+		return "", IncompatibleMemoryAreaError{memoryArea}
+	}
+	if opts.Length > 0 {
+		byteCount = uint16(opts.Length)
+	}
+	if byteCount%2 != 0 {
+		byteCount++
+	}
+
+	var data []byte
+	if opts.Layout == StringLengthPrefixed {
+		raw, err := c.ReadBytes(memoryArea, address, byteCount+2)
+		if err != nil {
+			return "", err
+		}
+		data = swapStringBytes(raw[2:], opts.SwapBytes)
+		if n := int(binary.BigEndian.Uint16(raw[0:2])); n < len(data) {
+			data = data[:n]
+		}
+	} else {
+		raw, err := c.ReadBytes(memoryArea, address, byteCount)
+		if err != nil {
+			return "", err
+		}
+		data = swapStringBytes(raw, opts.SwapBytes)
+		if i := bytes.IndexByte(data, 0x00); i >= 0 {
+			data = data[:i]
+		}
+		if opts.Padding != 0x00 {
+			data = bytes.TrimRight(data, string(opts.Padding))
+		}
+	}
+
+	if opts.Encoding == nil {
+		return string(data), nil
+	}
+	s, err := opts.Encoding.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode string: %w", err)
+	}
+	return string(s), nil
+}
+
+// WriteStringWith writes s stored as described by opts
+func (c *Client) WriteStringWith(memoryArea mapping.MemoryArea, address uint16, s string, opts StringOptions) error {
+	if !mapping.CheckIsWordMemoryArea(memoryArea) {
+		return IncompatibleMemoryAreaError{memoryArea}
+	}
+
+	text := []byte(s)
+	if opts.Encoding != nil {
+		var err error
+		if text, err = opts.Encoding.NewEncoder().Bytes(text); err != nil {
+			return fmt.Errorf("failed to encode string: %w", err)
+		}
+	}
+	if opts.Length > 0 && len(text) > opts.Length {
+		return fmt.Errorf("string of %d bytes exceeds the fixed length of %d bytes", len(text), opts.Length)
+	}
+	if opts.Layout == StringLengthPrefixed && len(text) > 0xFFFF {
+		return fmt.Errorf("string of %d bytes is too long for a length prefix", len(text))
+	}
+
+	size := max(len(text), opts.Length)
+	size += size % 2
+	var b []byte
+	if opts.Layout == StringLengthPrefixed {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(text)))
+	}
+	b = append(b, swapStringBytes(padString(text, size, opts.Padding), opts.SwapBytes)...)
+
+	return c.WriteBytes(memoryArea, address, b)
+}
+
+func padString(text []byte, size int, padding byte) []byte {
+	padded := make([]byte, size)
+	n := copy(padded, text)
+	for i := n; i < size; i++ {
+		padded[i] = padding
+	}
+	return padded
+}
+
+// swapStringBytes swaps the bytes within every word of b in place if swap is set
+func swapStringBytes(b []byte, swap bool) []byte {
+	if swap {
+		for i := 0; i+1 < len(b); i += 2 {
+			b[i], b[i+1] = b[i+1], b[i]
+		}
+	}
+	return b
+}
@@ -0,0 +1,204 @@
+package fins
+
+import (
+	"fmt"
+	"folke99/gofins/mapping"
+	"math"
+)
+
+// DataType names the PLC data type stored at a tag, using the Omron type names
+type DataType string
+
+const (
+	DataTypeBool  DataType = "BOOL"
+	DataTypeUint  DataType = "UINT"
+	DataTypeInt   DataType = "INT"
+	DataTypeUdint DataType = "UDINT"
+	DataTypeDint  DataType = "DINT"
+	DataTypeReal  DataType = "REAL"
+	DataTypeLreal DataType = "LREAL"
+)
+
+// WordOrder is the order of the words of multi-word values in PLC memory
+type WordOrder string
+
+const (
+	WordOrderLowFirst  WordOrder = ""          // Least significant word first, the Omron layout and the default
+	WordOrderHighFirst WordOrder = "highFirst" // Most significant word first, used by some gateways and HMIs
+)
+
+// Tag is a named PLC memory location, or NJ/NX variable, with a data type
+type Tag struct {
+	Name       string             `json:"name"`
+	MemoryArea mapping.MemoryArea `json:"memoryArea"`
+	Address    uint16             `json:"address"`
+	BitOffset  byte               `json:"bitOffset,omitempty"`
+	DataType   DataType           `json:"dataType"`
+	WordOrder  WordOrder          `json:"wordOrder,omitempty"`
+	// Variable names a controller variable served by the VariableBackend instead of a
+	// memory address, used for NJ/NX controllers
+	Variable string `json:"variable,omitempty"`
+	// Fields are bit fields packed in the word at Address, see ReadBitFields
+	Fields []BitField `json:"fields,omitempty"`
+	// Deadband of the subscriptions of the tag, every change is reported without one
+	Deadband *Deadband `json:"deadband,omitempty"`
+}
+
+// WordCount returns the number of PLC words used by the data type, BOOL counts as one item
+func (d DataType) WordCount() (uint16, error) {
+	switch d {
+	case DataTypeBool, DataTypeUint, DataTypeInt:
+		return 1, nil
+	case DataTypeUdint, DataTypeDint, DataTypeReal:
+		return 2, nil
+	case DataTypeLreal:
+		return 4, nil
+	default:
+		return 0, fmt.Errorf("unsupported data type: %q", d)
+	}
+}
+
+// ReadTag reads the value of a tag as a float64
+func (c *Client) ReadTag(t Tag) (float64, error) {
+	if t.Variable != "" {
+		b, err := c.variableBackend(t)
+		if err != nil {
+			return 0, err
+		}
+		return b.ReadVariable(t.Variable, t.DataType)
+	}
+
+	if t.DataType == DataTypeBool {
+		bits, err := c.ReadBits(t.MemoryArea, t.Address, t.BitOffset, 1)
+		if err != nil {
+			return 0, err
+		}
+		if bits[0] {
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	count, err := t.DataType.WordCount()
+	if err != nil {
+		return 0, err
+	}
+	words, err := c.ReadWords(t.MemoryArea, t.Address, count)
+	if err != nil {
+		return 0, err
+	}
+	return decodeTagValue(t.DataType, t.WordOrder.toLowFirst(words)), nil
+}
+
+// ReadMultiple reads the tags in order and returns a value for every tag. A failed read does
+// not stop the batch: its TagValue holds the error and the returned *MultiError lists it.
+func (c *Client) ReadMultiple(tags []Tag) ([]TagValue, error) {
+	values := make([]TagValue, len(tags))
+	multi := &MultiError{Total: len(tags)}
+	for i, t := range tags {
+		values[i].Tag = t
+		values[i].Value, values[i].Err = c.ReadTag(t)
+		if values[i].Err != nil {
+			multi.Errors = append(multi.Errors, ItemError{Index: i, Item: "tag " + t.Name, Err: values[i].Err})
+		}
+	}
+	return values, multi.errOrNil()
+}
+
+// WriteTag writes a value to a tag, the value must be representable by the tag data type
+func (c *Client) WriteTag(t Tag, value float64) error {
+	if t.Variable != "" {
+		b, err := c.variableBackend(t)
+		if err != nil {
+			return err
+		}
+		return b.WriteVariable(t.Variable, t.DataType, value)
+	}
+
+	if t.DataType == DataTypeBool {
+		return c.WriteBits(t.MemoryArea, t.Address, t.BitOffset, []bool{value != 0})
+	}
+
+	words, err := encodeTagValue(t.DataType, value)
+	if err != nil {
+		return fmt.Errorf("tag %s: %w", t.Name, err)
+	}
+	return c.WriteWords(t.MemoryArea, t.Address, t.WordOrder.toLowFirst(words))
+}
+
+// toLowFirst converts between the word order o and least significant word first,
+// the conversion is its own inverse
+func (o WordOrder) toLowFirst(words []uint16) []uint16 {
+	if o != WordOrderHighFirst {
+		return words
+	}
+	reversed := make([]uint16, len(words))
+	for i, w := range words {
+		reversed[len(words)-1-i] = w
+	}
+	return reversed
+}
+
+// Multi-word values are stored with the least significant word first
+func decodeTagValue(d DataType, words []uint16) float64 {
+	switch d {
+	case DataTypeUint:
+		return float64(words[0])
+	case DataTypeInt:
+		return float64(int16(words[0]))
+	case DataTypeUdint:
+		return float64(uint32(words[1])<<16 | uint32(words[0]))
+	case DataTypeDint:
+		return float64(int32(uint32(words[1])<<16 | uint32(words[0])))
+	case DataTypeReal:
+		return float64(math.Float32frombits(uint32(words[1])<<16 | uint32(words[0])))
+	case DataTypeLreal:
+		return math.Float64frombits(uint64(words[3])<<48 | uint64(words[2])<<32 | uint64(words[1])<<16 | uint64(words[0]))
+	default:
+		return 0
+	}
+}
+
+func encodeTagValue(d DataType, value float64) ([]uint16, error) {
+	var bits uint32
+	switch d {
+	case DataTypeLreal:
+		lbits := math.Float64bits(value)
+		return []uint16{uint16(lbits), uint16(lbits >> 16), uint16(lbits >> 32), uint16(lbits >> 48)}, nil
+	case DataTypeReal:
+		bits = math.Float32bits(float32(value))
+	case DataTypeUint, DataTypeInt, DataTypeUdint, DataTypeDint:
+		if value != math.Trunc(value) {
+			return nil, fmt.Errorf("value %v is not an integer", value)
+		}
+		min, max := integerRange(d)
+		if value < min || value > max {
+			return nil, fmt.Errorf("value %v out of range for %s", value, d)
+		}
+		if value < 0 {
+			bits = uint32(int32(value))
+		} else {
+			bits = uint32(value)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported data type: %q", d)
+	}
+
+	if d == DataTypeUint || d == DataTypeInt {
+		return []uint16{uint16(bits)}, nil
+	}
+	return []uint16{uint16(bits), uint16(bits >> 16)}, nil
+}
+
+func integerRange(d DataType) (float64, float64) {
+	switch d {
+	case DataTypeUint:
+		return 0, math.MaxUint16
+	case DataTypeInt:
+		return math.MinInt16, math.MaxInt16
+	case DataTypeUdint:
+		return 0, math.MaxUint32
+	default:
+		return math.MinInt32, math.MaxInt32
+	}
+}
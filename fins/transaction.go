@@ -0,0 +1,188 @@
+package fins
+
+import (
+	"errors"
+	"fmt"
+	"folke99/gofins/mapping"
+	"log"
+	"slices"
+)
+
+// Transaction queues writes that are committed in order with all-or-nothing semantics.
+//
+// FINS has no native transactions, so Commit reads the current values first, verifies
+// every write by reading it back and restores the previous values if a step fails.
+type Transaction struct {
+	client *Client
+	steps  []transactionStep
+}
+
+type transactionStep struct {
+	tag        *Tag // Set for tag writes, which write value
+	value      float64
+	prevValue  float64
+	memoryArea mapping.MemoryArea
+	address    uint16
+	bitOffset  byte
+	bitWrite   bool
+	words      []uint16 // Written by word writes
+	bits       []bool   // Written by bit writes
+	previous   []uint16
+	prevBits   []bool
+}
+
+// Transaction starts a new write transaction on the client
+func (c *Client) Transaction() *Transaction {
+	return &Transaction{client: c}
+}
+
+// WriteWords queues a word write
+func (t *Transaction) WriteWords(memoryArea mapping.MemoryArea, address uint16, data []uint16) *Transaction {
+	t.steps = append(t.steps, transactionStep{
+		memoryArea: memoryArea,
+		address:    address,
+		words:      slices.Clone(data),
+	})
+	return t
+}
+
+// WriteBits queues a bit write
+func (t *Transaction) WriteBits(memoryArea mapping.MemoryArea, address uint16, bitOffset byte, data []bool) *Transaction {
+	t.steps = append(t.steps, transactionStep{
+		memoryArea: memoryArea,
+		address:    address,
+		bitOffset:  bitOffset,
+		bitWrite:   true,
+		bits:       slices.Clone(data),
+	})
+	return t
+}
+
+// WriteTag queues a tag write, verified like the other writes with the conversions of the
+// data type applied
+func (t *Transaction) WriteTag(tag Tag, value float64) *Transaction {
+	t.steps = append(t.steps, transactionStep{tag: &tag, value: value})
+	return t
+}
+
+// Commit executes the queued writes in the order they were added.
+// On failure a TransactionError reports the failed step and whether the rollback succeeded.
+// The rollback restores every step up to the failed one, also after a restore failed.
+// In dry-run mode the writes aren't sent, so they are neither verified nor rolled back.
+func (t *Transaction) Commit() error {
+	for i, s := range t.steps {
+		if err := s.validate(); err != nil {
+			return TransactionError{Step: i, Err: err}
+		}
+	}
+
+	for i := range t.steps {
+		if err := t.steps[i].readPrevious(t.client); err != nil {
+			return TransactionError{Step: i, Err: fmt.Errorf("failed to read current value: %w", err)}
+		}
+	}
+
+	for i := range t.steps {
+		err := t.steps[i].apply(t.client)
+		if err == nil {
+			continue
+		}
+		if t.client.dryRun {
+			return TransactionError{Step: i, Err: err}
+		}
+
+		// The failed step may have been partially applied, so it is restored as well
+		var rbErrs []error
+		for j := i; j >= 0; j-- {
+			if rbErr := t.steps[j].restore(t.client); rbErr != nil {
+				log.Printf("Transaction rollback failed at step %d: %v", j, rbErr)
+				rbErrs = append(rbErrs, fmt.Errorf("step %d: %w", j, rbErr))
+			}
+		}
+		return TransactionError{Step: i, Err: err, RollbackErr: errors.Join(rbErrs...)}
+	}
+
+	return nil
+}
+
+func (s *transactionStep) validate() error {
+	if s.tag != nil {
+		if _, err := s.tag.DataType.WordCount(); err != nil || s.tag.DataType == DataTypeBool {
+			return err
+		}
+		// Values the tag can't hold fail here, not halfway through the transaction
+		if _, err := encodeTagValue(s.tag.DataType, s.value); err != nil {
+			return fmt.Errorf("tag %s: %w", s.tag.Name, err)
+		}
+		return nil
+	}
+	if s.bitWrite {
+		if !mapping.CheckIsBitMemoryArea(s.memoryArea) {
+			return IncompatibleMemoryAreaError{s.memoryArea}
+		}
+		if len(s.bits) == 0 {
+			return fmt.Errorf("empty bit write")
+		}
+		return nil
+	}
+	if !mapping.CheckIsWordMemoryArea(s.memoryArea) {
+		return IncompatibleMemoryAreaError{s.memoryArea}
+	}
+	if len(s.words) == 0 {
+		return fmt.Errorf("empty word write")
+	}
+	return nil
+}
+
+func (s *transactionStep) readPrevious(c *Client) error {
+	var err error
+	if s.tag != nil {
+		s.prevValue, err = c.ReadTag(*s.tag)
+	} else if s.bitWrite {
+		s.prevBits, err = c.ReadBits(s.memoryArea, s.address, s.bitOffset, uint16(len(s.bits)))
+	} else {
+		s.previous, err = c.ReadWords(s.memoryArea, s.address, uint16(len(s.words)))
+	}
+	return err
+}
+
+func (s *transactionStep) apply(c *Client) error {
+	if s.tag != nil {
+		return c.writeAndVerifyTag(*s.tag, s.value)
+	}
+	if s.bitWrite {
+		if err := c.WriteBits(s.memoryArea, s.address, s.bitOffset, s.bits); err != nil || c.dryRun {
+			return err
+		}
+		readBack, err := c.ReadBits(s.memoryArea, s.address, s.bitOffset, uint16(len(s.bits)))
+		if err != nil {
+			return fmt.Errorf("failed to verify write: %w", err)
+		}
+		if !slices.Equal(readBack, s.bits) {
+			return fmt.Errorf("verification failed: wrote %v, read back %v", s.bits, readBack)
+		}
+		return nil
+	}
+
+	if err := c.WriteWords(s.memoryArea, s.address, s.words); err != nil || c.dryRun {
+		return err
+	}
+	readBack, err := c.ReadWords(s.memoryArea, s.address, uint16(len(s.words)))
+	if err != nil {
+		return fmt.Errorf("failed to verify write: %w", err)
+	}
+	if !slices.Equal(readBack, s.words) {
+		return fmt.Errorf("verification failed: wrote %v, read back %v", s.words, readBack)
+	}
+	return nil
+}
+
+func (s *transactionStep) restore(c *Client) error {
+	if s.tag != nil {
+		return c.WriteTag(*s.tag, s.prevValue)
+	}
+	if s.bitWrite {
+		return c.WriteBits(s.memoryArea, s.address, s.bitOffset, s.prevBits)
+	}
+	return c.WriteWords(s.memoryArea, s.address, s.previous)
+}
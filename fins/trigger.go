@@ -0,0 +1,219 @@
+package fins
+
+import (
+	"fmt"
+	"folke99/gofins/mapping"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_TRIGGER_POLL_INTERVAL = 50 * time.Millisecond
+	DEFAULT_TRIGGER_TIMEOUT       = 5 * time.Second
+)
+
+// TriggerOptions configures a TriggeredReader, zero durations use the defaults
+type TriggerOptions struct {
+	MemoryArea     mapping.MemoryArea // Word area of the trigger, acknowledge and data words, DM by default
+	TriggerAddress uint16             // Word of the bit the PLC sets when a data block is ready
+	TriggerBit     byte
+	AckAddress     uint16 // Word of the bit set once the block was read
+	AckBit         byte
+	DataAddress    uint16 // First word of the data block
+	DataCount      uint16
+
+	// The first data word is a sequence number the PLC increments for every block, a gap
+	// reveals blocks the PLC dropped without waiting for the acknowledge
+	Sequenced bool
+
+	PollInterval time.Duration // Time between trigger reads, 50ms by default
+	Timeout      time.Duration // Time the PLC has to reset the trigger after the acknowledge, 5s by default
+
+	OnData  func(b TriggerBlock) error // Called with every block, an error withholds the acknowledge so the block is read again
+	OnError func(e TriggerEvent)       // Called for failed reads and writes, timeouts and missed triggers
+}
+
+// TriggerBlock is a data block read after the PLC raised the trigger
+type TriggerBlock struct {
+	Time     time.Time // Time the trigger was seen
+	Sequence uint16    // First data word when Sequenced
+	Data     []uint16
+}
+
+// TriggerEvent reports a problem with the handshake
+type TriggerEvent struct {
+	Time time.Time
+	Err  error // TriggerTimeoutError, MissedTriggerError or the error of a read, write or OnData
+}
+
+// TriggerStats counts the blocks and problems of a TriggeredReader
+type TriggerStats struct {
+	Blocks   int64
+	Missed   int64 // Blocks missed according to the sequence numbers
+	Timeouts int64
+	Errors   int64 // Failed reads and writes and blocks rejected by OnData
+}
+
+// TriggeredReader implements the trigger/acknowledge handshake between a PLC program and a PC.
+// The PLC sets the trigger bit when a data block is ready; the reader reads the block, hands it
+// to OnData and sets the acknowledge bit; the PLC resets the trigger and the reader resets the
+// acknowledge, after which the PLC may raise the next trigger. Blocks are delivered at least
+// once: a block whose acknowledge could not be written is read again.
+type TriggeredReader struct {
+	sync.Mutex
+	client   *Client
+	opts     TriggerOptions
+	bitArea  mapping.MemoryArea
+	acked    bool      // The acknowledge is set and the reader waits for the trigger to drop
+	ackedAt  time.Time // Time the acknowledge was set
+	timedOut bool      // The timeout of the current acknowledge was reported
+	sequence uint16    // Sequence number of the last acknowledged block
+	started  bool      // A sequenced block was acknowledged
+	stats    TriggerStats
+	closed   bool
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewTriggeredReader starts watching the trigger bit of the PLC behind c
+func NewTriggeredReader(c *Client, opts TriggerOptions) (*TriggeredReader, error) {
+	if opts.MemoryArea == 0 {
+		opts.MemoryArea = mapping.MemoryAreaDMWord
+	}
+	bitArea, ok := opts.MemoryArea.BitArea()
+	if !opts.MemoryArea.IsWord() || !ok {
+		return nil, IncompatibleMemoryAreaError{opts.MemoryArea}
+	}
+	if opts.DataCount == 0 {
+		return nil, fmt.Errorf("trigger data block is empty")
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DEFAULT_TRIGGER_POLL_INTERVAL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DEFAULT_TRIGGER_TIMEOUT
+	}
+
+	r := &TriggeredReader{
+		client:  c,
+		opts:    opts,
+		bitArea: bitArea,
+		done:    make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go r.loop()
+	return r, nil
+}
+
+// Stats returns the counters of the reader
+func (r *TriggeredReader) Stats() TriggerStats {
+	r.Lock()
+	defer r.Unlock()
+	return r.stats
+}
+
+// Close stops watching the trigger, a set acknowledge stays set
+func (r *TriggeredReader) Close() {
+	r.Lock()
+	if r.closed {
+		r.Unlock()
+		return
+	}
+	r.closed = true
+	r.Unlock()
+
+	close(r.done)
+	r.wg.Wait()
+}
+
+func (r *TriggeredReader) loop() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.poll()
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *TriggeredReader) poll() {
+	trigger, err := r.client.ReadBits(r.bitArea, r.opts.TriggerAddress, r.opts.TriggerBit, 1)
+	if err != nil {
+		r.fail(err, &r.stats.Errors)
+		return
+	}
+
+	switch {
+	case !r.acked && trigger[0]:
+		r.receive()
+	case r.acked && !trigger[0]:
+		// The PLC saw the acknowledge, it may raise the next trigger once it is reset
+		if err := r.client.ResetBit(r.bitArea, r.opts.AckAddress, r.opts.AckBit); err != nil {
+			r.fail(err, &r.stats.Errors)
+			return
+		}
+		r.acked = false
+	case r.acked && !r.timedOut && time.Since(r.ackedAt) > r.opts.Timeout:
+		r.timedOut = true
+		r.fail(TriggerTimeoutError{Area: r.opts.MemoryArea, Address: r.opts.TriggerAddress, Bit: r.opts.TriggerBit, Timeout: r.opts.Timeout}, &r.stats.Timeouts)
+	}
+}
+
+// receive reads the data block, passes it on and acknowledges it
+func (r *TriggeredReader) receive() {
+	b := TriggerBlock{Time: time.Now()}
+	data, err := r.client.ReadWords(r.opts.MemoryArea, r.opts.DataAddress, r.opts.DataCount)
+	if err != nil {
+		r.fail(err, &r.stats.Errors)
+		return
+	}
+	b.Data = data
+
+	if r.opts.Sequenced {
+		b.Sequence = data[0]
+		// A repeated sequence number is a block read again after a failed acknowledge
+		if r.started && b.Sequence != r.sequence {
+			if missed := b.Sequence - r.sequence - 1; missed > 0 {
+				r.fail(MissedTriggerError{Sequence: b.Sequence, Missed: int(missed)}, nil)
+				r.Lock()
+				r.stats.Missed += int64(missed)
+				r.Unlock()
+			}
+		}
+	}
+
+	if r.opts.OnData != nil {
+		if err := r.opts.OnData(b); err != nil {
+			r.fail(err, &r.stats.Errors)
+			return
+		}
+	}
+	if err := r.client.SetBit(r.bitArea, r.opts.AckAddress, r.opts.AckBit); err != nil {
+		r.fail(err, &r.stats.Errors)
+		return
+	}
+
+	r.Lock()
+	r.stats.Blocks++
+	r.Unlock()
+	r.acked, r.ackedAt, r.timedOut = true, time.Now(), false
+	r.sequence, r.started = b.Sequence, r.opts.Sequenced
+}
+
+// fail counts the problem in counter, if given, and reports it to OnError
+func (r *TriggeredReader) fail(err error, counter *int64) {
+	if counter != nil {
+		r.Lock()
+		*counter++
+		r.Unlock()
+	}
+	if r.opts.OnError != nil {
+		r.opts.OnError(TriggerEvent{Time: time.Now(), Err: err})
+	}
+}
@@ -0,0 +1,128 @@
+package fins
+
+import (
+	"folke99/gofins/mapping"
+	"math"
+)
+
+// PLCType is a Go type with a fixed PLC memory representation
+type PLCType interface {
+	bool | int16 | uint16 | int32 | uint32 | float32 | float64
+}
+
+// PLCValue is a type Write can store, a PLCType or a string
+type PLCValue interface {
+	PLCType | string
+}
+
+// Read reads a value of type T at address.
+// Integers and floats use one, two or four words with the least significant word first.
+// A bool is the bit at offset 0 in bit areas and a non-zero word in word areas.
+// Strings have no fixed size, ReadStringWith reads one of at most a given number of bytes
+// up to the first null byte.
+func Read[T PLCType](c *Client, memoryArea mapping.MemoryArea, address uint16) (T, error) {
+	var v T
+	var err error
+	switch p := any(&v).(type) {
+	case *bool:
+		*p, err = readTypedBool(c, memoryArea, address)
+	default:
+		var words []uint16
+		words, err = c.ReadWords(memoryArea, address, typedWordCount(p))
+		if err == nil {
+			decodeTyped(p, words)
+		}
+	}
+	return v, err
+}
+
+// Write writes value at address in the representation Read uses, strings as WriteString does
+func Write[T PLCValue](c *Client, memoryArea mapping.MemoryArea, address uint16, value T) error {
+	switch v := any(value).(type) {
+	case bool:
+		if memoryArea.IsBit() {
+			return c.WriteBits(memoryArea, address, 0, []bool{v})
+		}
+		if v {
+			return c.WriteWords(memoryArea, address, []uint16{1})
+		}
+		return c.WriteWords(memoryArea, address, []uint16{0})
+	case string:
+		return c.WriteString(memoryArea, address, v)
+	default:
+		return c.WriteWords(memoryArea, address, encodeTyped(v))
+	}
+}
+
+func readTypedBool(c *Client, memoryArea mapping.MemoryArea, address uint16) (bool, error) {
+	if memoryArea.IsBit() {
+		bits, err := c.ReadBits(memoryArea, address, 0, 1)
+		if err != nil {
+			return false, err
+		}
+		return bits[0], nil
+	}
+	words, err := c.ReadWords(memoryArea, address, 1)
+	if err != nil {
+		return false, err
+	}
+	return words[0] != 0, nil
+}
+
+func typedWordCount(p any) uint16 {
+	switch p.(type) {
+	case *int16, *uint16:
+		return 1
+	case *float64:
+		return 4
+	default:
+		return 2
+	}
+}
+
+func decodeTyped(p any, words []uint16) {
+	var bits uint64
+	for i := len(words) - 1; i >= 0; i-- {
+		bits = bits<<16 | uint64(words[i])
+	}
+
+	switch p := p.(type) {
+	case *int16:
+		*p = int16(bits)
+	case *uint16:
+		*p = uint16(bits)
+	case *int32:
+		*p = int32(bits)
+	case *uint32:
+		*p = uint32(bits)
+	case *float32:
+		*p = math.Float32frombits(uint32(bits))
+	case *float64:
+		*p = math.Float64frombits(bits)
+	}
+}
+
+func encodeTyped(v any) []uint16 {
+	var bits uint64
+	var count int
+	switch v := v.(type) {
+	case int16:
+		bits, count = uint64(uint16(v)), 1
+	case uint16:
+		bits, count = uint64(v), 1
+	case int32:
+		bits, count = uint64(uint32(v)), 2
+	case uint32:
+		bits, count = uint64(v), 2
+	case float32:
+		bits, count = uint64(math.Float32bits(v)), 2
+	case float64:
+		bits, count = math.Float64bits(v), 4
+	}
+
+	words := make([]uint16, count)
+	for i := range words {
+		words[i] = uint16(bits >> (16 * i))
+	}
+	return words
+}
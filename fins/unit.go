@@ -0,0 +1,107 @@
+package fins
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"folke99/gofins/mapping"
+	"sync"
+)
+
+// Unit addresses (DA2) of the units of a PLC
+const (
+	UNIT_CPU          = 0x00
+	UNIT_SPECIAL_IO   = 0x20 // Special I/O Unit 0, unit n has 0x20+n
+	UNIT_INNER_BOARD  = 0xE1
+	UNIT_DATA_LENGTH  = 40 // Model and version returned by the unit data read
+	UNIT_MODEL_LENGTH = 20
+)
+
+// CPUBusUnit returns the unit address of CPU Bus Unit number n (0 to 15)
+func CPUBusUnit(n byte) byte {
+	return MIN_CPU_BUS_UNIT + n
+}
+
+// SpecialIOUnit returns the unit address of Special I/O Unit number n (0 to 95)
+func SpecialIOUnit(n byte) byte {
+	return UNIT_SPECIAL_IO + n
+}
+
+// UnitDecoder parses the response of a unit-specific command, unitAddress is the unit that answered
+type UnitDecoder func(unitAddress byte, r *Response) (any, error)
+
+var (
+	unitDecodersMutex sync.RWMutex
+	unitDecoders      = map[uint16]UnitDecoder{
+		mapping.CommandCodeCPUUnitDataRead: decodeUnitData,
+	}
+)
+
+// RegisterUnitDecoder registers the decoder UnitCommand applies to responses of commandCode,
+// replacing a registered decoder. Decoders can tell units apart by the unit address.
+func RegisterUnitDecoder(commandCode uint16, decode UnitDecoder) {
+	unitDecodersMutex.Lock()
+	defer unitDecodersMutex.Unlock()
+	if decode == nil {
+		delete(unitDecoders, commandCode)
+		return
+	}
+	unitDecoders[commandCode] = decode
+}
+
+func unitDecoder(commandCode uint16) UnitDecoder {
+	unitDecodersMutex.RLock()
+	defer unitDecodersMutex.RUnlock()
+	return unitDecoders[commandCode]
+}
+
+// UnitData is the model and version a CPU Bus Unit or Special I/O Unit returns for the
+// controller data read, decoded by the built-in decoder of UnitCommand
+type UnitData struct {
+	Model   string
+	Version string
+}
+
+func decodeUnitData(_ byte, r *Response) (any, error) {
+	if err := checkMinDataLength(r, UNIT_DATA_LENGTH, "unit data read"); err != nil {
+		return nil, err
+	}
+	return UnitData{
+		Model:   string(bytes.TrimRight(r.Data[:UNIT_MODEL_LENGTH], " \x00")),
+		Version: string(bytes.TrimRight(r.Data[UNIT_MODEL_LENGTH:UNIT_DATA_LENGTH], " \x00")),
+	}, nil
+}
+
+// WithUnit returns a handle sending its commands to the unit at unitAddress of the PLC (DA2),
+// e.g. CPUBusUnit(0) for a communications unit with unit number 0, of the PLC of the
+// connection or the destination of c. The handle shares the connection of c.
+func (c *Client) WithUnit(unitAddress byte) *Client {
+	h := *c
+	h.unit = &unitAddress
+	return &h
+}
+
+// SendUnitCommand sends a command with data to the unit at unitAddress and returns the
+// response, an error when the unit rejects the command
+func (c *Client) SendUnitCommand(unitAddress byte, commandCode uint16, data []byte) (*Response, error) {
+	command := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(data)), commandCode)
+	r, err := c.WithUnit(unitAddress).sendCommand(append(command, data...))
+	if err := checkResponse(r, err); err != nil {
+		return nil, fmt.Errorf("%s to unit 0x%02X failed: %w", mapping.CommandCode(commandCode), unitAddress, err)
+	}
+	return r, nil
+}
+
+// UnitCommand sends a command to the unit at unitAddress and decodes the response with the
+// decoder registered for commandCode. Without a decoder the response data is returned.
+func (c *Client) UnitCommand(unitAddress byte, commandCode uint16, data []byte) (any, error) {
+	r, err := c.SendUnitCommand(unitAddress, commandCode, data)
+	if err != nil {
+		return nil, err
+	}
+	decode := unitDecoder(commandCode)
+	if decode == nil {
+		return r.Data, nil
+	}
+	return decode(unitAddress, r)
+}
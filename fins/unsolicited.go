@@ -0,0 +1,78 @@
+package fins
+
+import (
+	"folke99/gofins/finsproto"
+	"folke99/gofins/mapping"
+	"log"
+)
+
+// INCOMING_COMMAND_QUEUE is the number of commands from the PLC waiting for the handler, more
+// are dropped and the PLC times out on them
+const INCOMING_COMMAND_QUEUE = 64
+
+// CommandHandler handles a FINS command sent to the client by the PLC, for example by a SEND
+// or CMND instruction. The returned end code and data are sent back when the command requires
+// a response.
+type CommandHandler func(req Request) (endCode uint16, data []byte)
+
+// OnCommand registers the handler for commands received from the PLC.
+// Without a handler, commands that require a response are answered with EndCodeUndefinedCommand.
+// The handler runs on a goroutine of its own, one command at a time in the order they
+// arrived, so it may send commands with the client while responses keep arriving.
+func (c *Client) OnCommand(handler CommandHandler) {
+	c.Lock()
+	c.commandHandler = handler
+	c.Unlock()
+}
+
+// queueIncomingCommand passes a command frame received on the connection to the command loop,
+// the listen loop never waits for the handler
+func (c *Client) queueIncomingCommand(message []byte) {
+	select {
+	case c.commands <- message:
+	default:
+		log.Printf("Incoming command queue is full, dropping % X", message)
+	}
+}
+
+// commandLoop handles the commands from the PLC until the client is closed
+func (c *Client) commandLoop(commands chan []byte, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case message := <-commands:
+			c.handleIncomingCommand(message)
+		}
+	}
+}
+
+// handleIncomingCommand dispatches a command frame received on the connection
+func (c *Client) handleIncomingCommand(message []byte) {
+	req, err := DecodeRequest(message)
+	if err != nil {
+		log.Printf("Failed to decode incoming command: %v", err)
+		return
+	}
+
+	c.Lock()
+	handler := c.commandHandler
+	c.Unlock()
+
+	endCode := mapping.EndCodeUndefinedCommand
+	var data []byte
+	if handler != nil {
+		endCode, data = handler(req)
+	} else {
+		log.Printf("No handler for incoming %s (SID %d)", mapping.CommandCode(req.CommandCode), req.Header.SID)
+	}
+
+	if !req.Header.IsResponseRequired() {
+		return
+	}
+
+	frame := finsproto.TCPFrame(TCP_COMMAND_FRAME_SEND, EncodeResponse(NewResponse(req, endCode, data)))
+	if _, err := c.connection().Write(frame); err != nil {
+		log.Printf("Failed to send response to incoming command: %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package fins
+
+import "folke99/gofins/mapping"
+
+// UpdateWord reads the word at address, writes the value returned by fn and, with
+// Options.VerifyUpdates, reads it back. Read-modify-write cycles of all handles of a client
+// are serialized, changes made by the PLC program in between are reported as a ConflictError
+// when verification is enabled so the caller can retry. Dry-run writes aren't verified.
+func (c *Client) UpdateWord(memoryArea mapping.MemoryArea, address uint16, fn func(old uint16) uint16) error {
+	c.rmwMutex.Lock()
+	defer c.rmwMutex.Unlock()
+
+	words, err := c.ReadWords(memoryArea, address, 1)
+	if err != nil {
+		return err
+	}
+	word := fn(words[0])
+	if err := c.WriteWords(memoryArea, address, []uint16{word}); err != nil {
+		return err
+	}
+	if !c.verifyUpdates || c.dryRun {
+		return nil
+	}
+
+	if err := c.ReadWordsInto(memoryArea, address, words); err != nil {
+		return err
+	}
+	if words[0] != word {
+		return ConflictError{Area: memoryArea, Address: address, Expected: word, Actual: words[0]}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package fins
+
+import "fmt"
+
+// VariableBackend reads and writes controller variables by name.
+//
+// NJ/NX controllers expose their variables over CIP rather than through FINS memory areas,
+// only the memory used for CJ-series units is reachable with FINS. A backend implementing
+// this interface, for example a CIP client, serves the tags that have a Variable name, so
+// ReadTag, WriteTag and recipes work unchanged on NJ/NX.
+type VariableBackend interface {
+	ReadVariable(name string, dataType DataType) (float64, error)
+	WriteVariable(name string, dataType DataType, value float64) error
+}
+
+// SetVariableBackend sets the backend serving tags with a Variable name, nil removes it
+func (c *Client) SetVariableBackend(b VariableBackend) {
+	c.Lock()
+	c.variables = b
+	c.Unlock()
+}
+
+// variableBackend returns the backend for a variable tag
+func (c *Client) variableBackend(t Tag) (VariableBackend, error) {
+	c.Lock()
+	b := c.variables
+	c.Unlock()
+
+	if b == nil {
+		return nil, fmt.Errorf("tag %s: variable %q requires a variable backend", t.Name, t.Variable)
+	}
+	return b, nil
+}
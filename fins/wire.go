@@ -0,0 +1,57 @@
+package fins
+
+import "folke99/gofins/finsproto"
+
+// Wire format types, defined in package finsproto
+type (
+	Header        = finsproto.Header
+	Request       = finsproto.Request
+	Response      = finsproto.Response
+	MemoryAddress = finsproto.MemoryAddress
+	BCDError      = finsproto.BCDError
+)
+
+const (
+	// ICF (Information Control Field) bits
+	ICFGatewayUsage        = finsproto.ICFGatewayUsage
+	ICFDataTypeResponse    = finsproto.ICFDataTypeResponse
+	ICFResponseNotRequired = finsproto.ICFResponseNotRequired
+	ICFResponse            = finsproto.ICFResponse
+
+	// Default values
+	DefaultGatewayCount = finsproto.DefaultGatewayCount
+	DefaultReserved     = finsproto.DefaultReserved
+
+	FINS_HEADER_LENGTH = finsproto.FINS_HEADER_LENGTH
+	FINS_MARKER        = finsproto.FINS_MARKER
+
+	TCP_COMMAND_NODE_ADDRESS_REQUEST  = finsproto.TCP_COMMAND_NODE_ADDRESS_REQUEST
+	TCP_COMMAND_NODE_ADDRESS_RESPONSE = finsproto.TCP_COMMAND_NODE_ADDRESS_RESPONSE
+	TCP_COMMAND_FRAME_SEND            = finsproto.TCP_COMMAND_FRAME_SEND
+	TCP_HEADER_LENGTH                 = finsproto.TCP_HEADER_LENGTH
+)
+
+// NewResponse creates a new FINS response to req, addressed back to the sender of the request
+func NewResponse(req Request, endCode uint16, data []byte) Response {
+	return finsproto.NewResponse(req, endCode, data)
+}
+
+// DecodeRequest decodes a FINS command message
+func DecodeRequest(bytes []byte) (Request, error) {
+	return finsproto.DecodeRequest(bytes)
+}
+
+// DecodeResponse decodes a FINS response message
+func DecodeResponse(bytes []byte) (Response, error) {
+	return finsproto.DecodeResponse(bytes)
+}
+
+// EncodeResponse converts a Response to its byte representation
+func EncodeResponse(resp Response) []byte {
+	return finsproto.EncodeResponse(resp)
+}
+
+// DecodeMemoryAddress creates a MemoryAddress from its 4 byte representation
+func DecodeMemoryAddress(data []byte) (MemoryAddress, error) {
+	return finsproto.DecodeMemoryAddress(data)
+}
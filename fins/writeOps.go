@@ -2,26 +2,54 @@ package fins
 
 import (
 	"fmt"
+	"folke99/gofins/finsproto"
 	"folke99/gofins/mapping"
+	"time"
 )
 
 // WriteWords Writes words to the PLC data area
-func (c *Client) WriteWords(memoryArea byte, address uint16, data []uint16) error {
+func (c *Client) WriteWords(memoryArea mapping.MemoryArea, address uint16, data []uint16) error {
+	command, err := c.writeWordsCommand(memoryArea, address, data)
+	if err != nil {
+		return err
+	}
+	return checkResponse(c.sendCommand(command))
+}
+
+// WriteWordsNoAck Writes words without waiting for a response.
+// The PLC does not answer, so only send errors are reported. Meant for high-rate,
+// loss-tolerant writes such as streaming setpoints.
+func (c *Client) WriteWordsNoAck(memoryArea mapping.MemoryArea, address uint16, data []uint16) error {
+	command, err := c.writeWordsCommand(memoryArea, address, data)
+	if err != nil {
+		return err
+	}
+	return c.sendCommandNoAck(command)
+}
+
+func (c *Client) writeWordsCommand(memoryArea mapping.MemoryArea, address uint16, data []uint16) ([]byte, error) {
 	if mapping.CheckIsWordMemoryArea(memoryArea) == false {
-		return IncompatibleMemoryAreaError{memoryArea}
+		return nil, IncompatibleMemoryAreaError{memoryArea}
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no words to write")
+	}
+	if max := c.maxWriteWords(memoryArea); len(data) > max {
+		return nil, CountLimitError{Write: true, Count: len(data), Max: max}
 	}
 	l := uint16(len(data))
+	if err := c.checkWordRange(memoryArea, address, l); err != nil {
+		return nil, err
+	}
 	bts := make([]byte, 2*l, 2*l)
 	for i := 0; i < int(l); i++ {
-		c.byteOrder.PutUint16(bts[i*2:i*2+2], data[i])
+		c.order().PutUint16(bts[i*2:i*2+2], data[i])
 	}
-	command := writeCommand(memAddr(memoryArea, address), l, bts)
-
-	return checkResponse(c.sendCommand(command))
+	return finsproto.WriteCommand(memAddr(memoryArea, address), l, bts), nil
 }
 
 // WriteString writes a string to the PLC's DM memory area
-func (c *Client) WriteString(memoryArea byte, address uint16, s string) error {
+func (c *Client) WriteString(memoryArea mapping.MemoryArea, address uint16, s string) error {
 	if !mapping.CheckIsWordMemoryArea(memoryArea) {
 		return IncompatibleMemoryAreaError{memoryArea}
 	}
@@ -37,7 +65,7 @@ func (c *Client) WriteString(memoryArea byte, address uint16, s string) error {
 }
 
 // WriteBytes writes bytes to the PLC's DM memory area
-func (c *Client) WriteBytes(memoryArea byte, address uint16, b []byte) error {
+func (c *Client) WriteBytes(memoryArea mapping.MemoryArea, address uint16, b []byte) error {
 	if !mapping.CheckIsWordMemoryArea(memoryArea) {
 		return IncompatibleMemoryAreaError{memoryArea}
 	}
@@ -48,18 +76,44 @@ func (c *Client) WriteBytes(memoryArea byte, address uint16, b []byte) error {
 	}
 
 	// Convert bytes to words (FINS protocol expects word count)
+	if max := c.maxWriteWords(memoryArea); len(b)/2 > max {
+		return CountLimitError{Write: true, Count: len(b) / 2, Max: max}
+	}
 	wordCount := uint16(len(b) / 2)
+	if err := c.checkWordRange(memoryArea, address, wordCount); err != nil {
+		return err
+	}
 
-	command := writeCommand(memAddr(memoryArea, address), wordCount, b)
+	command := finsproto.WriteCommand(memAddr(memoryArea, address), wordCount, b)
 	return checkResponse(c.sendCommand(command))
 }
 
 // WriteBits Writes bits to the PLC data area
-func (c *Client) WriteBits(memoryArea byte, address uint16, bitOffset byte, data []bool) error {
+func (c *Client) WriteBits(memoryArea mapping.MemoryArea, address uint16, bitOffset byte, data []bool) error {
+	command, err := c.writeBitsCommand(memoryArea, address, bitOffset, data)
+	if err != nil {
+		return err
+	}
+	return checkResponse(c.sendCommand(command))
+}
+
+// WriteBitsNoAck Writes bits without waiting for a response, only send errors are reported
+func (c *Client) WriteBitsNoAck(memoryArea mapping.MemoryArea, address uint16, bitOffset byte, data []bool) error {
+	command, err := c.writeBitsCommand(memoryArea, address, bitOffset, data)
+	if err != nil {
+		return err
+	}
+	return c.sendCommandNoAck(command)
+}
+
+func (c *Client) writeBitsCommand(memoryArea mapping.MemoryArea, address uint16, bitOffset byte, data []bool) ([]byte, error) {
 	if mapping.CheckIsBitMemoryArea(memoryArea) == false {
-		return IncompatibleMemoryAreaError{memoryArea}
+		return nil, IncompatibleMemoryAreaError{memoryArea}
 	}
 	l := uint16(len(data))
+	if err := c.checkBitRange(memoryArea, address, bitOffset, l); err != nil {
+		return nil, err
+	}
 	bts := make([]byte, 0, l)
 	var d byte
 	for i := 0; i < int(l); i++ {
@@ -70,7 +124,10 @@ func (c *Client) WriteBits(memoryArea byte, address uint16, bitOffset byte, data
 		}
 		bts = append(bts, d)
 	}
-	command := writeCommand(memAddrWithBitOffset(memoryArea, address, bitOffset), l, bts)
+	return finsproto.WriteCommand(memAddrWithBitOffset(memoryArea, address, bitOffset), l, bts), nil
+}
 
-	return checkResponse(c.sendCommand(command))
+// WriteClock sets the PLC clock to t, in the local time zone of the host
+func (c *Client) WriteClock(t time.Time) error {
+	return checkResponse(c.sendCommand(finsproto.ClockWriteCommand(t.In(time.Local))))
 }
@@ -0,0 +1,49 @@
+package finsproto
+
+import "fmt"
+
+// BCDError is returned when a byte is not valid binary coded decimal
+type BCDError struct {
+	msg string
+}
+
+func (e BCDError) Error() string {
+	return fmt.Sprintf("BCD error: %s", e.msg)
+}
+
+// DecodeBCD decodes binary coded decimal digits, a trailing 0xF nibble is ignored
+func DecodeBCD(bcd []byte) (uint64, error) {
+	var result uint64
+
+	for i, b := range bcd {
+		hi, lo := uint64(b>>4), uint64(b&0x0f)
+
+		// Validate high digit
+		if hi > 9 {
+			return 0, BCDError{fmt.Sprintf("invalid BCD digit (hi): %d", hi)}
+		}
+
+		// Add high digit
+		result = result*10 + hi
+
+		// Handle last nibble specially
+		if lo == 0x0f && i == len(bcd)-1 {
+			return result, nil
+		}
+
+		// Validate low digit
+		if lo > 9 {
+			return 0, BCDError{fmt.Sprintf("invalid BCD digit (lo): %d", lo)}
+		}
+
+		// Add low digit
+		result = result*10 + lo
+	}
+
+	return result, nil
+}
+
+// EncodeBCDByte encodes a value from 0 to 99 as two BCD digits
+func EncodeBCDByte(v int) byte {
+	return byte(v/10%10<<4 | v%10)
+}
@@ -0,0 +1,231 @@
+package finsproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"folke99/gofins/mapping"
+	"strings"
+	"time"
+)
+
+// ---------- Command creation functions ----------
+
+// ReadCommand creates a memory area read command
+func ReadCommand(memoryAddr MemoryAddress, itemCount uint16) []byte {
+	return AppendReadCommand(make([]byte, 0, 8), memoryAddr, itemCount)
+}
+
+// AppendReadCommand appends a memory area read command to dst
+func AppendReadCommand(dst []byte, memoryAddr MemoryAddress, itemCount uint16) []byte {
+	dst = binary.BigEndian.AppendUint16(dst, mapping.CommandCodeMemoryAreaRead)
+	dst = AppendMemoryAddress(dst, memoryAddr)
+	return binary.BigEndian.AppendUint16(dst, itemCount)
+}
+
+// WriteCommand creates a memory area write command carrying bytes
+func WriteCommand(memoryAddr MemoryAddress, itemCount uint16, bytes []byte) []byte {
+	commandData := make([]byte, 0, 8+len(bytes))
+	commandData = binary.BigEndian.AppendUint16(commandData, mapping.CommandCodeMemoryAreaWrite)
+	commandData = AppendMemoryAddress(commandData, memoryAddr)
+	commandData = binary.BigEndian.AppendUint16(commandData, itemCount)
+	return append(commandData, bytes...)
+}
+
+// ClockReadCommand creates a clock read command
+func ClockReadCommand() []byte {
+	return binary.BigEndian.AppendUint16(make([]byte, 0, 2), mapping.CommandCodeClockRead)
+}
+
+// ClockWriteCommand creates a clock write command setting the PLC clock to t: year, month,
+// day, hour, minute, second and day of week (0 is Sunday), each one BCD byte
+func ClockWriteCommand(t time.Time) []byte {
+	commandData := binary.BigEndian.AppendUint16(make([]byte, 0, 9), mapping.CommandCodeClockWrite)
+	return append(commandData,
+		EncodeBCDByte(t.Year()%100),
+		EncodeBCDByte(int(t.Month())),
+		EncodeBCDByte(t.Day()),
+		EncodeBCDByte(t.Hour()),
+		EncodeBCDByte(t.Minute()),
+		EncodeBCDByte(t.Second()),
+		EncodeBCDByte(int(t.Weekday())),
+	)
+}
+
+// Message read parameters and lengths
+const (
+	MESSAGE_COUNT      = 8      // Messages 0 to 7 of the MSG instruction
+	MESSAGE_LENGTH     = 32     // Bytes per message of the message read response
+	FAL_MESSAGE_LENGTH = 16     // Bytes of the error message of FAL/FALS instructions
+	MESSAGE_FAL_READ   = 0x8000 // Parameter of the FAL/FALS number read
+)
+
+// MessageReadCommand creates a message read command, bit n of numbers selects message n
+func MessageReadCommand(numbers uint8) []byte {
+	commandData := binary.BigEndian.AppendUint16(make([]byte, 0, 4), mapping.CommandCodeMessageReadClear)
+	return binary.BigEndian.AppendUint16(commandData, uint16(numbers))
+}
+
+// FALReadCommand creates a FAL/FALS number read command returning the FAL/FALS number and
+// error message of the current error
+func FALReadCommand() []byte {
+	commandData := binary.BigEndian.AppendUint16(make([]byte, 0, 4), mapping.CommandCodeMessageReadClear)
+	return binary.BigEndian.AppendUint16(commandData, MESSAGE_FAL_READ)
+}
+
+// DecodeMessage decodes an ASCII message padded with spaces or NUL bytes
+func DecodeMessage(b []byte) string {
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimRight(string(b), " ")
+}
+
+// File memory disks of the file commands
+const (
+	DISK_MEMORY_CARD     = 0x8000
+	DISK_EM_FILE_MEMORY  = 0x8001
+	FILE_NAME_LENGTH     = 12 // 8.3 file name, "NAME    .EXT"
+	FILE_DATA_LENGTH     = 20 // File entry of the file name read response
+	DISK_DATA_LENGTH     = 26 // Disk entry of the file name read response
+	PROGRAM_NO_WHOLE     = 0xFFFF
+	PROGRAM_LAST_BLOCK   = 0x8000 // Set in the response word count of the last program block
+	FILE_NAMES_LAST_FILE = 0x8000 // Set in the response file count when the last file is included
+)
+
+// Parameter codes of the file write command
+const (
+	FILE_WRITE_NEW       = 0x0000 // Create a file, fails when it exists
+	FILE_WRITE_REPLACE   = 0x0001 // Create a file, replacing an existing one
+	FILE_WRITE_APPEND    = 0x0002 // Add data at the end of an existing file
+	FILE_WRITE_OVERWRITE = 0x0003 // Overwrite data of an existing file at the file position
+)
+
+// Parameter areas of the parameter area commands
+const (
+	PARAMETER_AREA_PLC_SETUP     = 0x8010
+	PARAMETER_AREA_IO_TABLE      = 0x8012 // Registered I/O tables
+	PARAMETER_AREA_ROUTING_TABLE = 0x8013
+	PARAMETER_AREA_CPU_BUS_UNIT  = 0x8002 // CPU Bus Unit setup
+	PARAMETER_LAST_WORD          = 0x8000 // Set in the word count when the last word of the area is included
+	PARAMETER_AREA_HEADER_LENGTH = 6      // Area code, first word and word count ahead of the data
+)
+
+// ParameterAreaWords returns the size of a parameter area of CS/CJ CPU units in words, 0 for unknown areas
+func ParameterAreaWords(area uint16) int {
+	switch area {
+	case PARAMETER_AREA_PLC_SETUP, PARAMETER_AREA_ROUTING_TABLE:
+		return 0x200
+	case PARAMETER_AREA_IO_TABLE:
+		return 0x500
+	case PARAMETER_AREA_CPU_BUS_UNIT:
+		return 0x1420
+	default:
+		return 0
+	}
+}
+
+// ParameterAreaReadCommand creates a parameter area read command of count words of area starting at first
+func ParameterAreaReadCommand(area, first, count uint16) []byte {
+	commandData := binary.BigEndian.AppendUint16(make([]byte, 0, 8), mapping.CommandCodeParameterAreaRead)
+	commandData = binary.BigEndian.AppendUint16(commandData, area)
+	commandData = binary.BigEndian.AppendUint16(commandData, first)
+	return binary.BigEndian.AppendUint16(commandData, count)
+}
+
+// ParameterAreaWriteCommand creates a parameter area write command of words to area starting
+// at first, last marks a write including the last word of the area
+func ParameterAreaWriteCommand(area, first uint16, words []uint16, last bool) []byte {
+	count := uint16(len(words))
+	if last {
+		count |= PARAMETER_LAST_WORD
+	}
+	commandData := binary.BigEndian.AppendUint16(make([]byte, 0, 8+2*len(words)), mapping.CommandCodeParameterAreaWrite)
+	commandData = binary.BigEndian.AppendUint16(commandData, area)
+	commandData = binary.BigEndian.AppendUint16(commandData, first)
+	commandData = binary.BigEndian.AppendUint16(commandData, count)
+	for _, w := range words {
+		commandData = binary.BigEndian.AppendUint16(commandData, w)
+	}
+	return commandData
+}
+
+// ProgramAreaReadCommand creates a program area read command of count bytes at offset of the whole user program
+func ProgramAreaReadCommand(offset uint32, count uint16) []byte {
+	commandData := binary.BigEndian.AppendUint16(make([]byte, 0, 10), mapping.CommandCodeProgramAreaRead)
+	commandData = binary.BigEndian.AppendUint16(commandData, PROGRAM_NO_WHOLE)
+	commandData = binary.BigEndian.AppendUint32(commandData, offset)
+	return binary.BigEndian.AppendUint16(commandData, count)
+}
+
+// FileNameReadCommand creates a file name read command listing count files of the directory
+// dir on disk, starting with file number first
+func FileNameReadCommand(disk uint16, first, count uint16, dir string) []byte {
+	commandData := binary.BigEndian.AppendUint16(make([]byte, 0, 10+len(dir)), mapping.CommandCodeFileNameRead)
+	commandData = binary.BigEndian.AppendUint16(commandData, disk)
+	commandData = binary.BigEndian.AppendUint16(commandData, first)
+	commandData = binary.BigEndian.AppendUint16(commandData, count)
+	return appendDirectory(commandData, dir)
+}
+
+// FileReadCommand creates a single file read command of length bytes of the file name in
+// the directory dir on disk, starting at position
+func FileReadCommand(disk uint16, dir, name string, position uint32, length uint16) []byte {
+	commandData := binary.BigEndian.AppendUint16(make([]byte, 0, 24+len(dir)), mapping.CommandCodeSingleFileRead)
+	commandData = binary.BigEndian.AppendUint16(commandData, disk)
+	commandData = append(commandData, EncodeFileName(name)...)
+	commandData = binary.BigEndian.AppendUint32(commandData, position)
+	commandData = binary.BigEndian.AppendUint16(commandData, length)
+	return appendDirectory(commandData, dir)
+}
+
+// FileWriteCommand creates a single file write command writing data to the file name in the
+// directory dir on disk at position, mode is one of the FILE_WRITE parameter codes
+func FileWriteCommand(disk, mode uint16, dir, name string, position uint32, data []byte) []byte {
+	commandData := binary.BigEndian.AppendUint16(make([]byte, 0, 26+len(dir)+len(data)), mapping.CommandCodeSingleFileWrite)
+	commandData = binary.BigEndian.AppendUint16(commandData, disk)
+	commandData = binary.BigEndian.AppendUint16(commandData, mode)
+	commandData = append(commandData, EncodeFileName(name)...)
+	commandData = binary.BigEndian.AppendUint32(commandData, position)
+	commandData = binary.BigEndian.AppendUint16(commandData, uint16(len(data)))
+	commandData = appendDirectory(commandData, dir)
+	return append(commandData, data...)
+}
+
+// appendDirectory appends the directory name length and the absolute directory path, the
+// root directory has an empty path
+func appendDirectory(dst []byte, dir string) []byte {
+	if dir == `\` {
+		dir = ""
+	}
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(dir)))
+	return append(dst, dir...)
+}
+
+// EncodeFileName encodes a file name in the 12 byte 8.3 layout, name and extension padded with spaces
+func EncodeFileName(name string) []byte {
+	base, ext, _ := strings.Cut(name, ".")
+	return []byte(fmt.Sprintf("%-8.8s.%-3.3s", base, ext))
+}
+
+// DecodeFileName decodes a 12 byte 8.3 file name
+func DecodeFileName(b []byte) string {
+	base, ext, _ := strings.Cut(string(b), ".")
+	base, ext = strings.TrimRight(base, " \x00"), strings.TrimRight(ext, " \x00")
+	if ext == "" {
+		return base
+	}
+	return base + "." + ext
+}
+
+// EncodeFileTime encodes t in the packed date and time of file entries: year since 1980
+// (7 bits), month (4), day (5), hour (5), minute (6) and seconds divided by two (5)
+func EncodeFileTime(t time.Time) uint32 {
+	return uint32(t.Year()-1980)<<25 | uint32(t.Month())<<21 | uint32(t.Day())<<16 |
+		uint32(t.Hour())<<11 | uint32(t.Minute())<<5 | uint32(t.Second()/2)
+}
+
+// DecodeFileTime decodes the packed date and time of file entries, in local time
+func DecodeFileTime(v uint32) time.Time {
+	return time.Date(1980+int(v>>25), time.Month(v>>21&0x0F), int(v>>16&0x1F),
+		int(v>>11&0x1F), int(v>>5&0x3F), int(v&0x1F)*2, 0, time.Local)
+}
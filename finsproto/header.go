@@ -0,0 +1,84 @@
+// Package finsproto implements the FINS and FINS/TCP wire format: frames, headers, requests,
+// responses and memory addresses. It holds no connection state, see package fins for the client.
+package finsproto
+
+import "fmt"
+
+// Header represents a FINS frame header structure
+type Header struct {
+	ICF uint8 // Information Control Field
+	RSV uint8 // Reserved
+	GCT uint8 // Gateway Count
+	DNA uint8 // Destination Network Address
+	DA1 uint8 // Destination Node Address
+	DA2 uint8 // Destination Unit Address
+	SNA uint8 // Source Network Address
+	SA1 uint8 // Source Node Address
+	SA2 uint8 // Source Unit Address
+	SID uint8 // Service ID
+}
+
+const (
+	// ICF (Information Control Field) bits
+	ICFGatewayUsage        uint8 = 0x80 // 1 = Use gateway
+	ICFDataTypeResponse    uint8 = 0x40 // 1 = Response, 0 = Command
+	ICFResponseNotRequired uint8 = 0x01 // 1 = Response not required, 0 = Response required
+	ICFResponse            uint8 = 0xC0 // ICF of a response frame
+
+	// Default values
+	DefaultGatewayCount uint8 = 0x02
+	DefaultReserved     uint8 = 0x00
+
+	FINS_HEADER_LENGTH = 10
+)
+
+// EncodeHeader converts a Header to its byte representation
+func EncodeHeader(h Header) []byte {
+	return AppendHeader(make([]byte, 0, FINS_HEADER_LENGTH), h)
+}
+
+// AppendHeader appends the byte representation of a Header to dst
+func AppendHeader(dst []byte, h Header) []byte {
+	return append(dst,
+		h.ICF,
+		h.RSV,
+		h.GCT,
+		h.DNA,
+		h.DA1,
+		h.DA2,
+		h.SNA,
+		h.SA1,
+		h.SA2,
+		h.SID,
+	)
+}
+
+// DecodeHeader creates a Header from its byte representation
+func DecodeHeader(data []byte) (Header, error) {
+	if len(data) < FINS_HEADER_LENGTH {
+		return Header{}, fmt.Errorf("insufficient data for FINS header: expected 10 bytes, got %d", len(data))
+	}
+
+	return Header{
+		ICF: data[0],
+		RSV: data[1],
+		GCT: data[2],
+		DNA: data[3],
+		DA1: data[4],
+		DA2: data[5],
+		SNA: data[6],
+		SA1: data[7],
+		SA2: data[8],
+		SID: data[9],
+	}, nil
+}
+
+// IsCommand returns true if the header represents a command message
+func (h Header) IsCommand() bool {
+	return h.ICF&ICFDataTypeResponse == 0
+}
+
+// IsResponseRequired returns true if a response is required for this message
+func (h Header) IsResponseRequired() bool {
+	return h.ICF&ICFResponseNotRequired == 0
+}
@@ -0,0 +1,48 @@
+package finsproto
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// MemoryAddress represents a PLC memory address
+type MemoryAddress struct {
+	MemoryArea byte
+	Address    uint16
+	BitOffset  byte
+}
+
+// Getters
+func (m MemoryAddress) GetMemoryArea() byte {
+	return m.MemoryArea
+}
+func (m MemoryAddress) GetAddress() uint16 {
+	return m.Address
+}
+func (m MemoryAddress) GetBitOffset() byte {
+	return m.BitOffset
+}
+
+// EncodeMemoryAddress converts a MemoryAddress to its 4 byte representation
+func EncodeMemoryAddress(memoryAddr MemoryAddress) []byte {
+	return AppendMemoryAddress(make([]byte, 0, 4), memoryAddr)
+}
+
+// AppendMemoryAddress appends the 4 byte representation of a MemoryAddress to dst
+func AppendMemoryAddress(dst []byte, memoryAddr MemoryAddress) []byte {
+	dst = append(dst, memoryAddr.MemoryArea)
+	dst = binary.BigEndian.AppendUint16(dst, memoryAddr.Address)
+	return append(dst, memoryAddr.BitOffset)
+}
+
+// DecodeMemoryAddress creates a MemoryAddress from its 4 byte representation
+func DecodeMemoryAddress(data []byte) (MemoryAddress, error) {
+	if len(data) < 4 {
+		return MemoryAddress{}, fmt.Errorf("insufficient data for memory address: expected 4 bytes, got %d", len(data))
+	}
+	return MemoryAddress{
+		MemoryArea: data[0],
+		Address:    binary.BigEndian.Uint16(data[1:3]),
+		BitOffset:  data[3],
+	}, nil
+}
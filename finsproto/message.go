@@ -0,0 +1,118 @@
+package finsproto
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Request represents a FINS command request, sent by the client or received from the PLC
+type Request struct {
+	Header      Header
+	CommandCode uint16
+	Data        []byte
+}
+
+// Response represents a FINS command response
+type Response struct {
+	Header      Header
+	CommandCode uint16
+	EndCode     uint16
+	Data        []byte
+}
+
+// NewResponse creates a new FINS response to req, addressed back to the sender of the request
+func NewResponse(req Request, endCode uint16, data []byte) Response {
+	h := req.Header
+	return Response{
+		Header: Header{
+			ICF: ICFResponse,
+			RSV: DefaultReserved,
+			GCT: DefaultGatewayCount,
+			DNA: h.SNA,
+			DA1: h.SA1,
+			DA2: h.SA2,
+			SNA: h.DNA,
+			SA1: h.DA1,
+			SA2: h.DA2,
+			SID: h.SID,
+		},
+		CommandCode: req.CommandCode,
+		EndCode:     endCode,
+		Data:        data,
+	}
+}
+
+// Getters
+func (r Request) GetHeader() Header {
+	return r.Header
+}
+
+func (r Request) GetCommandCode() uint16 {
+	return r.CommandCode
+}
+
+func (r Request) GetData() []byte {
+	return r.Data
+}
+
+func (r Response) GetHeader() Header {
+	return r.Header
+}
+
+func (r Response) GetCommandCode() uint16 {
+	return r.CommandCode
+}
+
+func (r Response) GetEndCode() uint16 {
+	return r.EndCode
+}
+
+func (r Response) GetData() []byte {
+	return r.Data
+}
+
+// DecodeRequest decodes a FINS command message (header, command code and parameters)
+func DecodeRequest(bytes []byte) (Request, error) {
+	if len(bytes) < 12 {
+		return Request{}, fmt.Errorf("insufficient bytes for request decoding: expected at least 12 bytes, got %d", len(bytes))
+	}
+
+	header, err := DecodeHeader(bytes[0:10])
+	if err != nil {
+		return Request{}, fmt.Errorf("failed to decode header: %w", err)
+	}
+
+	return Request{
+		Header:      header,
+		CommandCode: binary.BigEndian.Uint16(bytes[10:12]),
+		Data:        bytes[12:],
+	}, nil
+}
+
+// DecodeResponse decodes a FINS response message (header, command code, end code and data)
+func DecodeResponse(bytes []byte) (Response, error) {
+	if len(bytes) < 14 {
+		return Response{}, fmt.Errorf("insufficient bytes for response: %d", len(bytes))
+	}
+
+	header, err := DecodeHeader(bytes[0:10])
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to decode header: %w", err)
+	}
+
+	return Response{
+		Header:      header,
+		CommandCode: binary.BigEndian.Uint16(bytes[10:12]),
+		EndCode:     binary.BigEndian.Uint16(bytes[12:14]),
+		Data:        bytes[14:],
+	}, nil
+}
+
+// EncodeResponse converts a Response to its byte representation
+func EncodeResponse(resp Response) []byte {
+	bytes := make([]byte, 0, FINS_HEADER_LENGTH+4+len(resp.Data))
+	bytes = AppendHeader(bytes, resp.Header)
+	bytes = binary.BigEndian.AppendUint16(bytes, resp.CommandCode)
+	bytes = binary.BigEndian.AppendUint16(bytes, resp.EndCode)
+	return append(bytes, resp.Data...)
+}
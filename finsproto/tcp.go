@@ -0,0 +1,97 @@
+package finsproto
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// FINS/TCP framing
+const (
+	FINS_MARKER = "FINS" // FINS/TCP frame marker
+
+	TCP_COMMAND_NODE_ADDRESS_REQUEST  = 0
+	TCP_COMMAND_NODE_ADDRESS_RESPONSE = 1
+	TCP_COMMAND_FRAME_SEND            = 2
+	TCP_COMMAND_FRAME_SEND_ERROR      = 3 // Frame send error notification, carries the rejected frame
+	TCP_HEADER_LENGTH                 = 16
+
+	MAX_FRAME_LENGTH = 2048 // Largest length field accepted by ReadTCPFrame
+)
+
+// FINS/TCP error codes, reported in the error code field of the header
+const (
+	TCP_ERROR_NOT_FINS               = 0x01 // The header is not "FINS"
+	TCP_ERROR_DATA_TOO_LONG          = 0x02
+	TCP_ERROR_COMMAND_NOT_SUPPORTED  = 0x03
+	TCP_ERROR_ALL_CONNECTIONS_IN_USE = 0x20
+	TCP_ERROR_NODE_IN_USE            = 0x21 // The requested client node is already connected
+	TCP_ERROR_PROTECTED_NODE         = 0x22 // The node is protected from unregistered IP addresses
+	TCP_ERROR_NODE_OUT_OF_RANGE      = 0x23
+	TCP_ERROR_SAME_NODE              = 0x24 // The client requested the node of the server
+	TCP_ERROR_NO_NODE_AVAILABLE      = 0x25 // All nodes available for automatic allocation are used
+)
+
+// AppendTCPHeader appends a FINS/TCP header for a payload of payloadLength bytes to dst
+func AppendTCPHeader(dst []byte, command uint32, payloadLength int) []byte {
+	dst = append(dst, FINS_MARKER...)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(8+payloadLength)) // Length
+	dst = binary.BigEndian.AppendUint32(dst, command)                 // Command
+	return binary.BigEndian.AppendUint32(dst, 0)                      // Error code
+}
+
+// TCPFrame wraps a payload in a FINS/TCP header
+func TCPFrame(command uint32, payload []byte) []byte {
+	frame := AppendTCPHeader(make([]byte, 0, TCP_HEADER_LENGTH+len(payload)), command, len(payload))
+	return append(frame, payload...)
+}
+
+// TCPErrorFrame returns a FINS/TCP frame reporting errorCode, with the FINS frame the error
+// refers to as payload if there is one
+func TCPErrorFrame(command, errorCode uint32, payload ...byte) []byte {
+	frame := TCPFrame(command, payload)
+	binary.BigEndian.PutUint32(frame[12:16], errorCode)
+	return frame
+}
+
+// TCPFrameErrorCode returns the error code field of a FINS/TCP frame decoded by DecodeTCPFrame
+func TCPFrameErrorCode(frame []byte) uint32 {
+	return binary.BigEndian.Uint32(frame[12:16])
+}
+
+// DecodeTCPFrame returns the command and payload of a complete FINS/TCP frame. The frame
+// must hold exactly the bytes announced by its length field.
+func DecodeTCPFrame(frame []byte) (uint32, []byte, error) {
+	if len(frame) < TCP_HEADER_LENGTH {
+		return 0, nil, fmt.Errorf("frame of %d bytes is shorter than the %d byte FINS/TCP header", len(frame), TCP_HEADER_LENGTH)
+	}
+	if string(frame[0:4]) != FINS_MARKER {
+		return 0, nil, fmt.Errorf("invalid FINS marker: % X", frame[0:4])
+	}
+	if length := binary.BigEndian.Uint32(frame[4:8]); int64(length) != int64(len(frame)-8) {
+		return 0, nil, fmt.Errorf("frame holds %d bytes after the length field, expected %d", len(frame)-8, length)
+	}
+	return binary.BigEndian.Uint32(frame[8:12]), frame[TCP_HEADER_LENGTH:], nil
+}
+
+// ReadTCPFrame reads one FINS/TCP frame and returns its command and payload
+func ReadTCPFrame(r io.Reader) (uint32, []byte, error) {
+	header := make([]byte, TCP_HEADER_LENGTH)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	if string(header[0:4]) != FINS_MARKER {
+		return 0, nil, fmt.Errorf("invalid FINS marker: % X", header[0:4])
+	}
+
+	length := binary.BigEndian.Uint32(header[4:8])
+	if length < 8 || length > MAX_FRAME_LENGTH {
+		return 0, nil, fmt.Errorf("invalid frame length: %d", length)
+	}
+
+	payload := make([]byte, length-8)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return binary.BigEndian.Uint32(header[8:12]), payload, nil
+}
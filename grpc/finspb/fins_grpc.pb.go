@@ -0,0 +1,250 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: fins.proto
+
+// FINS gateway service, implemented by folke99/gofins/grpc on top of a fins.Manager.
+// PLCs are addressed by the name they are registered with in the manager.
+
+package finspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	FINS_Read_FullMethodName      = "/gofins.v1.FINS/Read"
+	FINS_Write_FullMethodName     = "/gofins.v1.FINS/Write"
+	FINS_Subscribe_FullMethodName = "/gofins.v1.FINS/Subscribe"
+	FINS_Status_FullMethodName    = "/gofins.v1.FINS/Status"
+)
+
+// FINSClient is the client API for FINS service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FINSClient interface {
+	// Read reads tags of one PLC, every tag gets a value or an error
+	Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (*ReadResponse, error)
+	// Write writes tags of one PLC in order, every write gets an error or none
+	Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteResponse, error)
+	// Subscribe polls tags of one PLC and streams the values that changed
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TagUpdate], error)
+	// Status reads the operating status of one PLC
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+}
+
+type fINSClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFINSClient(cc grpc.ClientConnInterface) FINSClient {
+	return &fINSClient{cc}
+}
+
+func (c *fINSClient) Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (*ReadResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReadResponse)
+	err := c.cc.Invoke(ctx, FINS_Read_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fINSClient) Write(ctx context.Context, in *WriteRequest, opts ...grpc.CallOption) (*WriteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(WriteResponse)
+	err := c.cc.Invoke(ctx, FINS_Write_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fINSClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TagUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FINS_ServiceDesc.Streams[0], FINS_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRequest, TagUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FINS_SubscribeClient = grpc.ServerStreamingClient[TagUpdate]
+
+func (c *fINSClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, FINS_Status_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FINSServer is the server API for FINS service.
+// All implementations must embed UnimplementedFINSServer
+// for forward compatibility.
+type FINSServer interface {
+	// Read reads tags of one PLC, every tag gets a value or an error
+	Read(context.Context, *ReadRequest) (*ReadResponse, error)
+	// Write writes tags of one PLC in order, every write gets an error or none
+	Write(context.Context, *WriteRequest) (*WriteResponse, error)
+	// Subscribe polls tags of one PLC and streams the values that changed
+	Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[TagUpdate]) error
+	// Status reads the operating status of one PLC
+	Status(context.Context, *StatusRequest) (*StatusResponse, error)
+	mustEmbedUnimplementedFINSServer()
+}
+
+// UnimplementedFINSServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFINSServer struct{}
+
+func (UnimplementedFINSServer) Read(context.Context, *ReadRequest) (*ReadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Read not implemented")
+}
+func (UnimplementedFINSServer) Write(context.Context, *WriteRequest) (*WriteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Write not implemented")
+}
+func (UnimplementedFINSServer) Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[TagUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedFINSServer) Status(context.Context, *StatusRequest) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedFINSServer) mustEmbedUnimplementedFINSServer() {}
+func (UnimplementedFINSServer) testEmbeddedByValue()              {}
+
+// UnsafeFINSServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FINSServer will
+// result in compilation errors.
+type UnsafeFINSServer interface {
+	mustEmbedUnimplementedFINSServer()
+}
+
+func RegisterFINSServer(s grpc.ServiceRegistrar, srv FINSServer) {
+	// If the following call pancis, it indicates UnimplementedFINSServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&FINS_ServiceDesc, srv)
+}
+
+func _FINS_Read_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FINSServer).Read(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FINS_Read_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FINSServer).Read(ctx, req.(*ReadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FINS_Write_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FINSServer).Write(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FINS_Write_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FINSServer).Write(ctx, req.(*WriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FINS_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FINSServer).Subscribe(m, &grpc.GenericServerStream[SubscribeRequest, TagUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FINS_SubscribeServer = grpc.ServerStreamingServer[TagUpdate]
+
+func _FINS_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FINSServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FINS_Status_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FINSServer).Status(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// FINS_ServiceDesc is the grpc.ServiceDesc for FINS service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FINS_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gofins.v1.FINS",
+	HandlerType: (*FINSServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Read",
+			Handler:    _FINS_Read_Handler,
+		},
+		{
+			MethodName: "Write",
+			Handler:    _FINS_Write_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _FINS_Status_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _FINS_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "fins.proto",
+}
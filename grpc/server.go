@@ -0,0 +1,252 @@
+// Package grpc serves the PLCs of a fins.Manager over gRPC, which lets applications in any
+// language use gofins as a protocol gateway.
+//
+// The service is defined in finspb/fins.proto, PLCs are addressed by the name they are
+// registered with in the manager.
+package grpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative finspb/fins.proto
+
+import (
+	"context"
+	"fmt"
+	"folke99/gofins/fins"
+	"folke99/gofins/grpc/finspb"
+	"folke99/gofins/mapping"
+	"time"
+
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DEFAULT_SUBSCRIBE_INTERVAL = time.Second
+	MIN_SUBSCRIBE_INTERVAL     = 10 * time.Millisecond
+)
+
+// Server implements the FINS gRPC service on top of a fins.Manager
+type Server struct {
+	finspb.UnimplementedFINSServer
+	manager *fins.Manager
+}
+
+// NewServer creates a service serving the PLCs registered in m
+func NewServer(m *fins.Manager) *Server {
+	return &Server{manager: m}
+}
+
+// Register adds the service to a gRPC server
+func (s *Server) Register(r gogrpc.ServiceRegistrar) {
+	finspb.RegisterFINSServer(r, s)
+}
+
+func (s *Server) Read(ctx context.Context, req *finspb.ReadRequest) (*finspb.ReadResponse, error) {
+	tags, err := tagsFromProto(req.Tags)
+	if err != nil {
+		return nil, err
+	}
+	values, err := s.readTags(ctx, req.Plc, tags)
+	if err != nil {
+		return nil, err
+	}
+	return &finspb.ReadResponse{Values: values}, nil
+}
+
+func (s *Server) Write(ctx context.Context, req *finspb.WriteRequest) (*finspb.WriteResponse, error) {
+	c, err := s.client(req.Plc)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]fins.Tag, len(req.Writes))
+	for i, w := range req.Writes {
+		if tags[i], err = tagFromProto(w.Tag); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &finspb.WriteResponse{Errors: make([]string, len(req.Writes))}
+	for i, w := range req.Writes {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		if err := c.WriteTag(tags[i], w.Value); err != nil {
+			resp.Errors[i] = err.Error()
+		}
+	}
+	return resp, nil
+}
+
+// Subscribe reads the tags every interval and sends the values that changed beyond the
+// deadband of their tag since they were last sent, the first update holds all tags
+func (s *Server) Subscribe(req *finspb.SubscribeRequest, stream gogrpc.ServerStreamingServer[finspb.TagUpdate]) error {
+	tags, err := tagsFromProto(req.Tags)
+	if err != nil {
+		return err
+	}
+	if _, err := s.client(req.Plc); err != nil {
+		return err
+	}
+	interval := time.Duration(req.IntervalMs) * time.Millisecond
+	if interval == 0 {
+		interval = DEFAULT_SUBSCRIBE_INTERVAL
+	}
+	interval = max(interval, MIN_SUBSCRIBE_INTERVAL)
+
+	ctx := stream.Context()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	filters := make([]*fins.DeadbandFilter, len(tags))
+	for i, t := range tags {
+		filters[i] = fins.NewDeadbandFilter(t.Deadband)
+	}
+	for {
+		values, err := s.readValues(ctx, req.Plc, tags)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		update := &finspb.TagUpdate{TimeUnixNano: now.UnixNano()}
+		for i, v := range values {
+			if filters[i].Report(v, now) {
+				update.Values = append(update.Values, tagValueToProto(v))
+			}
+		}
+		if len(update.Values) > 0 {
+			if err := stream.Send(update); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) Status(ctx context.Context, req *finspb.StatusRequest) (*finspb.StatusResponse, error) {
+	c, err := s.client(req.Plc)
+	if err != nil {
+		return nil, err
+	}
+	st, err := c.Status()
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to read status of %s: %v", req.Plc, err)
+	}
+	return &finspb.StatusResponse{
+		Status:     uint32(st.Status),
+		StatusName: st.Status.String(),
+		Mode:       uint32(st.Mode),
+		ModeName:   st.Mode.String(),
+		FatalError: uint32(st.FatalError),
+	}, nil
+}
+
+func (s *Server) client(plc string) (*fins.Client, error) {
+	c, ok := s.manager.Client(plc)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown PLC %q", plc)
+	}
+	return c, nil
+}
+
+// readTags reads the tags of a PLC through the manager, read errors are reported per tag
+func (s *Server) readTags(ctx context.Context, plc string, tags []fins.Tag) ([]*finspb.TagValue, error) {
+	results, err := s.readValues(ctx, plc, tags)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]*finspb.TagValue, len(results))
+	for i, r := range results {
+		values[i] = tagValueToProto(r)
+	}
+	return values, nil
+}
+
+// readValues reads the tags of a PLC through the manager, read errors are reported per tag
+func (s *Server) readValues(ctx context.Context, plc string, tags []fins.Tag) ([]fins.TagValue, error) {
+	if _, err := s.client(plc); err != nil {
+		return nil, err
+	}
+	results, _ := s.manager.ReadAll(ctx, map[string][]fins.Tag{plc: tags})
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return results[plc], nil
+}
+
+func tagValueToProto(v fins.TagValue) *finspb.TagValue {
+	pv := &finspb.TagValue{Tag: tagToProto(v.Tag), Value: v.Value}
+	if v.Err != nil {
+		pv.Error = v.Err.Error()
+	}
+	return pv
+}
+
+func tagsFromProto(pts []*finspb.Tag) ([]fins.Tag, error) {
+	tags := make([]fins.Tag, len(pts))
+	for i, pt := range pts {
+		t, err := tagFromProto(pt)
+		if err != nil {
+			return nil, err
+		}
+		tags[i] = t
+	}
+	return tags, nil
+}
+
+func tagFromProto(pt *finspb.Tag) (fins.Tag, error) {
+	if pt == nil {
+		return fins.Tag{}, status.Error(codes.InvalidArgument, "missing tag")
+	}
+	t := fins.Tag{
+		Name:       pt.Name,
+		MemoryArea: mapping.MemoryArea(pt.MemoryArea),
+		Address:    uint16(pt.Address),
+		BitOffset:  byte(pt.BitOffset),
+		DataType:   fins.DataType(pt.DataType),
+		WordOrder:  fins.WordOrder(pt.WordOrder),
+		Variable:   pt.Variable,
+	}
+	if d := pt.Deadband; d != nil {
+		t.Deadband = &fins.Deadband{Type: fins.DeadbandType(d.Type), Value: d.Value, Span: d.Span}
+	}
+	var err error
+	switch {
+	case pt.MemoryArea > 0xFF:
+		err = fmt.Errorf("invalid memory area 0x%X", pt.MemoryArea)
+	case pt.Address > 0xFFFF:
+		err = fmt.Errorf("invalid address %d", pt.Address)
+	case pt.BitOffset > 15:
+		err = fmt.Errorf("invalid bit offset %d", pt.BitOffset)
+	case t.WordOrder != fins.WordOrderLowFirst && t.WordOrder != fins.WordOrderHighFirst:
+		err = fmt.Errorf("invalid word order %q", pt.WordOrder)
+	case t.Deadband != nil && t.Deadband.Validate() != nil:
+		err = t.Deadband.Validate()
+	default:
+		_, err = t.DataType.WordCount()
+	}
+	if err != nil {
+		return fins.Tag{}, status.Errorf(codes.InvalidArgument, "tag %s: %v", pt.Name, err)
+	}
+	return t, nil
+}
+
+func tagToProto(t fins.Tag) *finspb.Tag {
+	pt := &finspb.Tag{
+		Name:       t.Name,
+		MemoryArea: uint32(t.MemoryArea),
+		Address:    uint32(t.Address),
+		BitOffset:  uint32(t.BitOffset),
+		DataType:   string(t.DataType),
+		WordOrder:  string(t.WordOrder),
+		Variable:   t.Variable,
+	}
+	if d := t.Deadband; d != nil {
+		pt.Deadband = &finspb.Deadband{Type: string(d.Type), Value: d.Value, Span: d.Span}
+	}
+	return pt
+}
@@ -0,0 +1,203 @@
+package historian
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Aggregate is a value computed from the samples of a tag in one window
+type Aggregate string
+
+const (
+	AggregateMin  Aggregate = "min"
+	AggregateMax  Aggregate = "max"
+	AggregateAvg  Aggregate = "avg" // Arithmetic mean of the samples
+	AggregateLast Aggregate = "last"
+)
+
+// AggregateOptions configures an AggregatingSink
+type AggregateOptions struct {
+	// Window is the length of the windows, they start at multiples of Window as computed
+	// by time.Truncate so windows of different tags and loggers line up
+	Window time.Duration
+	// TagWindows overrides Window for individual tags, e.g. a longer window for slow tags
+	TagWindows map[string]time.Duration
+	// Aggregates written per window and tag.
+	// Default value: all of min, max, avg and last
+	Aggregates []Aggregate
+}
+
+// AggregatingSink downsamples the samples of every tag to one sample per aggregate and window
+// before writing them to another sink, so fast-polled tags can be stored long-term. Put it
+// next to a sink of the raw samples in the sinks of a Logger to keep both. The aggregates of
+// tag "temp" are written as tags "temp.min", "temp.max", ... stamped with the window start.
+//
+// A window is written once a sample of any tag is at or after its end, the windows still open
+// on Close are written then. Samples older than the open window of their tag, or than the end
+// of its last written one, are late and dropped.
+type AggregatingSink struct {
+	sync.Mutex
+	sink    Sink
+	opts    AggregateOptions
+	windows map[string]*window   // Open window per tag
+	written map[string]time.Time // End of the last written window per tag
+	latest  time.Time            // Latest sample timestamp seen
+	dropped int
+}
+
+// window accumulates the samples of a tag in one window
+type window struct {
+	tag   string
+	start time.Time
+	end   time.Time
+	count int
+	min   float64
+	max   float64
+	sum   float64
+	last  float64
+	lastT time.Time
+}
+
+// NewAggregatingSink creates a sink writing the aggregates of the samples to sink
+func NewAggregatingSink(sink Sink, opts AggregateOptions) (*AggregatingSink, error) {
+	if opts.Window <= 0 {
+		return nil, fmt.Errorf("aggregation window must be positive")
+	}
+	for tag, w := range opts.TagWindows {
+		if w <= 0 {
+			return nil, fmt.Errorf("aggregation window of tag %s must be positive", tag)
+		}
+	}
+	if len(opts.Aggregates) == 0 {
+		opts.Aggregates = []Aggregate{AggregateMin, AggregateMax, AggregateAvg, AggregateLast}
+	}
+	for _, a := range opts.Aggregates {
+		switch a {
+		case AggregateMin, AggregateMax, AggregateAvg, AggregateLast:
+		default:
+			return nil, fmt.Errorf("unsupported aggregate %q", a)
+		}
+	}
+	return &AggregatingSink{sink: sink, opts: opts, windows: make(map[string]*window), written: make(map[string]time.Time)}, nil
+}
+
+// WriteBatch adds the samples to their windows and writes the windows they completed
+func (s *AggregatingSink) WriteBatch(samples []Sample) error {
+	s.Lock()
+	var done []*window
+	for _, sample := range samples {
+		w := s.windows[sample.Tag]
+		if sample.Timestamp.Before(s.written[sample.Tag]) || (w != nil && sample.Timestamp.Before(w.start)) {
+			s.dropped++
+			continue
+		}
+		if w != nil && !sample.Timestamp.Before(w.end) {
+			done = append(done, s.complete(w))
+		}
+		w = s.windows[sample.Tag]
+		if w == nil {
+			w = s.newWindow(sample)
+			s.windows[sample.Tag] = w
+		}
+		w.add(sample)
+		if sample.Timestamp.After(s.latest) {
+			s.latest = sample.Timestamp
+		}
+	}
+	for _, w := range s.windows {
+		if !s.latest.Before(w.end) {
+			done = append(done, s.complete(w))
+		}
+	}
+	s.Unlock()
+
+	return s.write(done)
+}
+
+// Dropped returns the number of late samples dropped
+func (s *AggregatingSink) Dropped() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.dropped
+}
+
+// complete removes w from the open windows, the caller holds the lock
+func (s *AggregatingSink) complete(w *window) *window {
+	delete(s.windows, w.tag)
+	s.written[w.tag] = w.end
+	return w
+}
+
+// Close writes the open windows and closes the sink
+func (s *AggregatingSink) Close() error {
+	s.Lock()
+	done := make([]*window, 0, len(s.windows))
+	for _, w := range s.windows {
+		done = append(done, w)
+	}
+	s.windows = make(map[string]*window)
+	s.Unlock()
+
+	err := s.write(done)
+	if cerr := s.sink.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *AggregatingSink) newWindow(sample Sample) *window {
+	length := s.opts.Window
+	if tw, ok := s.opts.TagWindows[sample.Tag]; ok {
+		length = tw
+	}
+	start := sample.Timestamp.Truncate(length)
+	return &window{tag: sample.Tag, start: start, end: start.Add(length), min: math.Inf(1), max: math.Inf(-1)}
+}
+
+func (w *window) add(s Sample) {
+	w.count++
+	w.min = min(w.min, s.Value)
+	w.max = max(w.max, s.Value)
+	w.sum += s.Value
+	// Samples of a batch may arrive out of order, last is the latest by timestamp
+	if !s.Timestamp.Before(w.lastT) {
+		w.last, w.lastT = s.Value, s.Timestamp
+	}
+}
+
+// write writes the aggregates of the windows, in order of their start and tag
+func (s *AggregatingSink) write(windows []*window) error {
+	if len(windows) == 0 {
+		return nil
+	}
+	sort.Slice(windows, func(i, j int) bool {
+		if !windows[i].start.Equal(windows[j].start) {
+			return windows[i].start.Before(windows[j].start)
+		}
+		return windows[i].tag < windows[j].tag
+	})
+
+	batch := make([]Sample, 0, len(windows)*len(s.opts.Aggregates))
+	for _, w := range windows {
+		for _, a := range s.opts.Aggregates {
+			batch = append(batch, Sample{Tag: w.tag + "." + string(a), Value: w.value(a), Timestamp: w.start})
+		}
+	}
+	return s.sink.WriteBatch(batch)
+}
+
+func (w *window) value(a Aggregate) float64 {
+	switch a {
+	case AggregateMin:
+		return w.min
+	case AggregateMax:
+		return w.max
+	case AggregateAvg:
+		return w.sum / float64(w.count)
+	default:
+		return w.last
+	}
+}
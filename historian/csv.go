@@ -0,0 +1,98 @@
+package historian
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// CSVSink writes samples to CSV files in a directory, rotating files by size and age
+type CSVSink struct {
+	dir       string
+	prefix    string
+	maxBytes  int64
+	maxAge    time.Duration
+	file      *os.File
+	writer    *csv.Writer
+	size      int64
+	createdAt time.Time
+}
+
+// NewCSVSink creates a sink writing <prefix>_<timestamp>.csv files to dir.
+// A new file is started when the current one exceeds maxBytes or is older than maxAge,
+// zero disables the respective limit.
+func NewCSVSink(dir, prefix string, maxBytes int64, maxAge time.Duration) (*CSVSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create historian directory: %w", err)
+	}
+	return &CSVSink{
+		dir:      dir,
+		prefix:   prefix,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+	}, nil
+}
+
+// WriteBatch appends the samples to the current file
+func (s *CSVSink) WriteBatch(samples []Sample) error {
+	if err := s.rotateIfNeeded(); err != nil {
+		return err
+	}
+
+	for _, sample := range samples {
+		record := []string{
+			sample.Timestamp.Format(time.RFC3339Nano),
+			sample.Tag,
+			strconv.FormatFloat(sample.Value, 'g', -1, 64),
+		}
+		if err := s.writer.Write(record); err != nil {
+			return err
+		}
+		// +3 for the two separators and the newline
+		s.size += int64(len(record[0]) + len(record[1]) + len(record[2]) + 3)
+	}
+
+	s.writer.Flush()
+	return s.writer.Error()
+}
+
+// Close closes the current file
+func (s *CSVSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	s.writer.Flush()
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *CSVSink) rotateIfNeeded() error {
+	if s.file != nil {
+		tooBig := s.maxBytes > 0 && s.size >= s.maxBytes
+		tooOld := s.maxAge > 0 && time.Since(s.createdAt) >= s.maxAge
+		if !tooBig && !tooOld {
+			return nil
+		}
+		if err := s.Close(); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	name := filepath.Join(s.dir, fmt.Sprintf("%s_%s.csv", s.prefix, now.Format("20060102T150405.000")))
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open historian file: %w", err)
+	}
+
+	s.file = file
+	s.writer = csv.NewWriter(file)
+	s.size = 0
+	s.createdAt = now
+
+	return s.writer.Write([]string{"timestamp", "tag", "value"})
+}
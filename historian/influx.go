@@ -0,0 +1,99 @@
+package historian
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DEFAULT_INFLUX_TIMEOUT = 10 * time.Second
+
+// InfluxOptions configures an InfluxSink
+type InfluxOptions struct {
+	URL         string // Base URL of the server, e.g. http://localhost:8086
+	Org         string
+	Bucket      string // For InfluxDB 1.x the database, optionally database/retention policy
+	Token       string // API token, for InfluxDB 1.x username:password
+	Measurement string
+	// Timeout of a write request.
+	// Default value: DEFAULT_INFLUX_TIMEOUT
+	Timeout time.Duration
+	// Client sends the requests, http.DefaultClient when nil
+	Client *http.Client
+}
+
+// InfluxSink writes samples to InfluxDB through its v2 write API, which InfluxDB 1.8 and
+// later serve as well. Wrap it in a RetrySink to survive outages of the database.
+type InfluxSink struct {
+	opts     InfluxOptions
+	endpoint string
+}
+
+// NewInfluxSink creates a sink writing to the bucket in opts
+func NewInfluxSink(opts InfluxOptions) (*InfluxSink, error) {
+	if opts.URL == "" || opts.Bucket == "" || opts.Measurement == "" {
+		return nil, fmt.Errorf("influx sink needs a URL, a bucket and a measurement")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DEFAULT_INFLUX_TIMEOUT
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	u, err := url.Parse(strings.TrimSuffix(opts.URL, "/") + "/api/v2/write")
+	if err != nil {
+		return nil, fmt.Errorf("invalid influx URL: %w", err)
+	}
+	q := url.Values{"bucket": {opts.Bucket}, "precision": {"ns"}}
+	if opts.Org != "" {
+		q.Set("org", opts.Org)
+	}
+	u.RawQuery = q.Encode()
+	return &InfluxSink{opts: opts, endpoint: u.String()}, nil
+}
+
+// WriteBatch writes the samples with one request. Rejected data is a PermanentError, as
+// sending it again fails again.
+func (s *InfluxSink) WriteBatch(samples []Sample) error {
+	var body bytes.Buffer
+	for _, sample := range samples {
+		body.WriteString(FormatLine(s.opts.Measurement, sample))
+		body.WriteByte('\n')
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.opts.Token)
+	}
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("influx write failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge || resp.StatusCode == http.StatusUnprocessableEntity {
+		return PermanentError{err}
+	}
+	return err
+}
+
+// Close does nothing, the requests don't hold connections of their own
+func (s *InfluxSink) Close() error {
+	return nil
+}
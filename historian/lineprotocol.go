@@ -0,0 +1,56 @@
+package historian
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// LineProtocolSink writes samples in InfluxDB line protocol:
+//
+//	<measurement>,tag=<tag> value=<value> <unix nanoseconds>
+type LineProtocolSink struct {
+	writer      io.Writer
+	measurement string
+}
+
+// NewLineProtocolSink creates a sink writing line protocol to w.
+// If w is an io.Closer it is closed together with the sink.
+func NewLineProtocolSink(w io.Writer, measurement string) *LineProtocolSink {
+	return &LineProtocolSink{
+		writer:      w,
+		measurement: measurement,
+	}
+}
+
+// WriteBatch writes one line per sample
+func (s *LineProtocolSink) WriteBatch(samples []Sample) error {
+	buf := bufio.NewWriter(s.writer)
+	for _, sample := range samples {
+		buf.WriteString(FormatLine(s.measurement, sample))
+		buf.WriteByte('\n')
+	}
+	return buf.Flush()
+}
+
+// Close closes the underlying writer if it is closable
+func (s *LineProtocolSink) Close() error {
+	if c, ok := s.writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+// FormatLine formats a single sample as a line protocol line without trailing newline
+func FormatLine(measurement string, sample Sample) string {
+	return measurementEscaper.Replace(measurement) +
+		",tag=" + tagEscaper.Replace(sample.Tag) +
+		" value=" + strconv.FormatFloat(sample.Value, 'g', -1, 64) +
+		" " + strconv.FormatInt(sample.Timestamp.UnixNano(), 10)
+}
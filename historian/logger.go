@@ -0,0 +1,150 @@
+// Package historian records timestamped PLC samples into pluggable sinks.
+//
+// Samples are buffered by a Logger and written to every sink in batches, either when
+// the batch is full or when the flush interval elapses.
+package historian
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Sample is a single recorded value
+type Sample struct {
+	Tag       string
+	Value     float64
+	Timestamp time.Time
+}
+
+// Sink persists batches of samples
+type Sink interface {
+	WriteBatch(samples []Sample) error
+	Close() error
+}
+
+const (
+	DEFAULT_BATCH_SIZE     = 100
+	DEFAULT_FLUSH_INTERVAL = 5 * time.Second
+)
+
+// Logger batches samples and forwards them to its sinks
+type Logger struct {
+	sync.Mutex
+	flushMutex    sync.Mutex // Serializes the flushes, sinks get one batch at a time and in order
+	sinks         []Sink
+	batchSize     int
+	flushInterval time.Duration
+	buffer        []Sample
+	closed        bool
+	done          chan struct{}
+	wg            sync.WaitGroup
+}
+
+// NewLogger creates a Logger writing to the given sinks.
+// A batchSize or flushInterval of zero selects the defaults.
+func NewLogger(batchSize int, flushInterval time.Duration, sinks ...Sink) *Logger {
+	if batchSize <= 0 {
+		batchSize = DEFAULT_BATCH_SIZE
+	}
+	if flushInterval <= 0 {
+		flushInterval = DEFAULT_FLUSH_INTERVAL
+	}
+
+	l := &Logger{
+		sinks:         sinks,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		buffer:        make([]Sample, 0, batchSize),
+		done:          make(chan struct{}),
+	}
+
+	l.wg.Add(1)
+	go l.flushLoop()
+	return l
+}
+
+// Record adds a sample, flushing when the batch is full
+func (l *Logger) Record(s Sample) error {
+	if s.Timestamp.IsZero() {
+		s.Timestamp = time.Now()
+	}
+
+	l.Lock()
+	if l.closed {
+		l.Unlock()
+		return fmt.Errorf("logger is closed")
+	}
+	l.buffer = append(l.buffer, s)
+	full := len(l.buffer) >= l.batchSize
+	l.Unlock()
+
+	if full {
+		return l.Flush()
+	}
+	return nil
+}
+
+// Flush writes all buffered samples to the sinks. It waits for a flush in progress, so
+// sinks never write batches concurrently.
+func (l *Logger) Flush() error {
+	l.flushMutex.Lock()
+	defer l.flushMutex.Unlock()
+
+	l.Lock()
+	if len(l.buffer) == 0 {
+		l.Unlock()
+		return nil
+	}
+	batch := l.buffer
+	l.buffer = make([]Sample, 0, l.batchSize)
+	l.Unlock()
+
+	var errs []error
+	for _, sink := range l.sinks {
+		if err := sink.WriteBatch(batch); err != nil {
+			errs = append(errs, fmt.Errorf("sink %T: %w", sink, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close flushes the remaining samples and closes all sinks
+func (l *Logger) Close() error {
+	l.Lock()
+	if l.closed {
+		l.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.Unlock()
+
+	close(l.done)
+	l.wg.Wait()
+
+	errs := []error{l.Flush()}
+	for _, sink := range l.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (l *Logger) flushLoop() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.Flush(); err != nil {
+				log.Printf("Historian flush failed: %v", err)
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
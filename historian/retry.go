@@ -0,0 +1,357 @@
+package historian
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"folke99/gofins/fins"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEFAULT_SPOOL_BYTES = 64 << 20
+
+// PermanentError is returned by a sink for a batch that would fail again when retried, e.g.
+// data the database rejects. A RetrySink drops such batches.
+type PermanentError struct {
+	Err error
+}
+
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// RetryOptions configures a RetrySink
+type RetryOptions struct {
+	// Dir holds the spooled batches, they survive a restart of the process
+	Dir string
+	// MaxBytes limits the size of the spool, the oldest batches are dropped beyond it.
+	// Default value: DEFAULT_SPOOL_BYTES
+	MaxBytes int64
+	// Backoff decides the delay before each retry, the last delay repeats once it stops.
+	// Default value: ExponentialBackoff from 1s to 1m with 20% jitter
+	Backoff fins.Backoff
+}
+
+// RetryStats describes the state of a RetrySink
+type RetryStats struct {
+	SpooledBatches int
+	SpooledBytes   int64
+	Retries        int64 // Failed writes of spooled batches
+	Dropped        int64 // Samples dropped for the spool limit or a PermanentError
+}
+
+// RetrySink keeps the samples a sink failed to write in a spool on disk and writes them again
+// with backoff, in order, until the sink takes them. New batches go to the spool as long as
+// it isn't empty, so the sink receives all batches in the order they were written.
+type RetrySink struct {
+	sync.Mutex
+	sink    Sink
+	opts    RetryOptions
+	files   []string // Spooled batches, oldest first
+	sending string   // Spooled batch being written to the sink
+	sizes   map[string]int64
+	next    uint64 // Sequence number of the next spool file
+	stats   RetryStats
+	sendMu  sync.Mutex // Serializes writes to the sink
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewRetrySink creates a sink writing to sink and spooling to opts.Dir, resuming the batches
+// spooled by an earlier run
+func NewRetrySink(sink Sink, opts RetryOptions) (*RetrySink, error) {
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("retry sink needs a spool directory")
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DEFAULT_SPOOL_BYTES
+	}
+	if opts.Backoff == nil {
+		opts.Backoff = fins.ExponentialBackoff{Initial: time.Second, Max: time.Minute, Jitter: 0.2}
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	s := &RetrySink{
+		sink:    sink,
+		opts:    opts,
+		sizes:   make(map[string]int64),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if err := s.loadSpool(); err != nil {
+		return nil, err
+	}
+	go s.retryLoop()
+	return s, nil
+}
+
+// WriteBatch writes the samples to the sink, or spools them when the sink fails or older
+// batches wait in the spool. It only fails when the samples are lost.
+func (s *RetrySink) WriteBatch(samples []Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	if s.spooling() {
+		return s.spool(samples)
+	}
+
+	s.sendMu.Lock()
+	if s.spooling() {
+		s.sendMu.Unlock()
+		return s.spool(samples)
+	}
+	err := s.sink.WriteBatch(samples)
+	s.sendMu.Unlock()
+
+	var permanent PermanentError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &permanent):
+		s.Lock()
+		s.stats.Dropped += int64(len(samples))
+		s.Unlock()
+		return err
+	default:
+		log.Printf("Historian sink %T failed, spooling: %v", s.sink, err)
+		return s.spool(samples)
+	}
+}
+
+// Stats returns the state of the spool and the retries
+func (s *RetrySink) Stats() RetryStats {
+	s.Lock()
+	defer s.Unlock()
+	stats := s.stats
+	stats.SpooledBatches = len(s.files)
+	for _, size := range s.sizes {
+		stats.SpooledBytes += size
+	}
+	return stats
+}
+
+// Close stops retrying and closes the sink, the spooled batches stay on disk for the next run
+func (s *RetrySink) Close() error {
+	s.Lock()
+	select {
+	case <-s.done:
+		s.Unlock()
+		return nil
+	default:
+	}
+	close(s.done)
+	s.Unlock()
+
+	<-s.stopped
+	return s.sink.Close()
+}
+
+func (s *RetrySink) spooling() bool {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.files) > 0
+}
+
+// spool appends the samples to the spool, dropping the oldest batches beyond MaxBytes
+func (s *RetrySink) spool(samples []Sample) error {
+	s.Lock()
+	defer s.Unlock()
+
+	name := filepath.Join(s.opts.Dir, fmt.Sprintf("%020d.batch", s.next))
+	s.next++
+	f, err := os.Create(name)
+	if err != nil {
+		s.stats.Dropped += int64(len(samples))
+		return fmt.Errorf("failed to spool %d samples: %w", len(samples), err)
+	}
+	err = gob.NewEncoder(f).Encode(samples)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name)
+		s.stats.Dropped += int64(len(samples))
+		return fmt.Errorf("failed to spool %d samples: %w", len(samples), err)
+	}
+	st, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	s.files = append(s.files, name)
+	s.sizes[name] = st.Size()
+
+	var total int64
+	for _, size := range s.sizes {
+		total += size
+	}
+	for total > s.opts.MaxBytes && len(s.files) > 1 {
+		oldest := s.files[0]
+		if oldest == s.sending {
+			oldest = s.files[1]
+		}
+		if oldest == name {
+			// Only the batch being sent is older, the samples of this call are lost
+			s.stats.Dropped += int64(len(samples))
+			s.remove(name)
+			return fmt.Errorf("spool exceeds %d bytes, dropped %d samples", s.opts.MaxBytes, len(samples))
+		}
+		if batch, err := readBatch(oldest); err == nil {
+			s.stats.Dropped += int64(len(batch))
+		}
+		log.Printf("Historian spool exceeds %d bytes, dropping %s", s.opts.MaxBytes, filepath.Base(oldest))
+		total -= s.sizes[oldest]
+		s.remove(oldest)
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// remove deletes a spooled batch, the caller holds the lock
+func (s *RetrySink) remove(name string) {
+	os.Remove(name)
+	delete(s.sizes, name)
+	for i, f := range s.files {
+		if f == name {
+			s.files = append(s.files[:i], s.files[i+1:]...)
+			break
+		}
+	}
+}
+
+// loadSpool picks up the batches spooled by an earlier run
+func (s *RetrySink) loadSpool() error {
+	entries, err := os.ReadDir(s.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory: %w", err)
+	}
+	var seqs []uint64
+	for _, e := range entries {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), ".batch"), 10, 64)
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".batch") || err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	for _, seq := range seqs {
+		name := filepath.Join(s.opts.Dir, fmt.Sprintf("%020d.batch", seq))
+		st, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		s.files = append(s.files, name)
+		s.sizes[name] = st.Size()
+		s.next = seq + 1
+	}
+	return nil
+}
+
+func readBatch(name string) ([]Sample, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var samples []Sample
+	err = gob.NewDecoder(f).Decode(&samples)
+	return samples, err
+}
+
+// retryLoop writes the spooled batches to the sink, oldest first
+func (s *RetrySink) retryLoop() {
+	defer close(s.stopped)
+
+	attempt := 0
+	var delay time.Duration
+	for {
+		s.Lock()
+		var oldest string
+		if len(s.files) > 0 {
+			oldest = s.files[0]
+		}
+		s.Unlock()
+
+		if oldest == "" {
+			select {
+			case <-s.done:
+				return
+			case <-s.wake:
+				continue
+			}
+		}
+
+		err := s.retry(oldest)
+		if err == nil {
+			attempt = 0
+			continue
+		}
+		attempt++
+		s.Lock()
+		s.stats.Retries++
+		s.Unlock()
+		if d, ok := s.opts.Backoff.Next(attempt); ok {
+			delay = d
+		}
+		log.Printf("Historian sink %T still failing, retrying in %v: %v", s.sink, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-s.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// retry writes the spooled batch name to the sink and removes it unless the sink failed
+func (s *RetrySink) retry(name string) error {
+	samples, err := readBatch(name)
+	if err != nil {
+		log.Printf("Historian spool file %s is unreadable, dropping it: %v", filepath.Base(name), err)
+		s.Lock()
+		s.remove(name)
+		s.Unlock()
+		return nil
+	}
+
+	s.Lock()
+	s.sending = name
+	s.Unlock()
+	s.sendMu.Lock()
+	err = s.sink.WriteBatch(samples)
+	s.sendMu.Unlock()
+
+	s.Lock()
+	defer s.Unlock()
+	s.sending = ""
+	var permanent PermanentError
+	if err != nil && !errors.As(err, &permanent) {
+		return err
+	}
+	if err != nil {
+		log.Printf("Historian sink %T rejected %d spooled samples: %v", s.sink, len(samples), err)
+		s.stats.Dropped += int64(len(samples))
+	}
+	s.remove(name)
+	return nil
+}
@@ -0,0 +1,108 @@
+package historian
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_SQL_TIMEOUT    = 30 * time.Second
+	SQL_ROWS_PER_INSERT    = 1000 // Rows per INSERT, well below the 65535 parameters PostgreSQL allows
+	SQLITE_ROWS_PER_INSERT = 333  // Rows per INSERT, below the 999 parameters of older SQLite builds
+	// SQLITE_TIME_LAYOUT stores times in UTC, it sorts as text and the SQLite date functions parse it
+	SQLITE_TIME_LAYOUT = "2006-01-02 15:04:05.000000000"
+)
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// SQLSink writes samples to a PostgreSQL or TimescaleDB table through database/sql, the
+// application picks the driver. The table needs the columns time, tag and value, e.g.
+//
+//	CREATE TABLE samples (time TIMESTAMPTZ NOT NULL, tag TEXT NOT NULL, value DOUBLE PRECISION);
+//	SELECT create_hypertable('samples', 'time');
+//
+// Wrap it in a RetrySink to survive outages of the database. NewSQLiteSink creates one for
+// an SQLite file.
+type SQLSink struct {
+	db      *sql.DB
+	table   string
+	timeout time.Duration
+	sqlite  bool // ? placeholders, smaller inserts and times as text
+}
+
+// NewSQLSink creates a sink inserting into table, which may be qualified by its schema
+func NewSQLSink(db *sql.DB, table string) (*SQLSink, error) {
+	if !sqlIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	return &SQLSink{db: db, table: table, timeout: DEFAULT_SQL_TIMEOUT}, nil
+}
+
+// NewSQLiteSink creates a sink inserting into table of an SQLite database opened with the
+// driver of the application, e.g. modernc.org/sqlite or github.com/mattn/go-sqlite3. The
+// table and an index on tag and time are created when missing; times are stored as UTC text
+// in SQLITE_TIME_LAYOUT, which the date and time functions of SQLite accept.
+func NewSQLiteSink(db *sql.DB, table string) (*SQLSink, error) {
+	if !sqlIdentifier.MatchString(table) || strings.Contains(table, ".") {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DEFAULT_SQL_TIMEOUT)
+	defer cancel()
+	for _, statement := range []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (time TEXT NOT NULL, tag TEXT NOT NULL, value REAL)", table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_tag_time ON %s (tag, time)", table, table),
+	} {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return nil, fmt.Errorf("failed to create table %s: %w", table, err)
+		}
+	}
+	return &SQLSink{db: db, table: table, timeout: DEFAULT_SQL_TIMEOUT, sqlite: true}, nil
+}
+
+// WriteBatch inserts the samples in one transaction
+func (s *SQLSink) WriteBatch(samples []Sample) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows := SQL_ROWS_PER_INSERT
+	if s.sqlite {
+		rows = SQLITE_ROWS_PER_INSERT
+	}
+	for len(samples) > 0 {
+		n := min(len(samples), rows)
+		var query strings.Builder
+		fmt.Fprintf(&query, "INSERT INTO %s (time, tag, value) VALUES ", s.table)
+		args := make([]any, 0, 3*n)
+		for i, sample := range samples[:n] {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			if s.sqlite {
+				query.WriteString("(?, ?, ?)")
+				args = append(args, sample.Timestamp.UTC().Format(SQLITE_TIME_LAYOUT), sample.Tag, sample.Value)
+				continue
+			}
+			fmt.Fprintf(&query, "($%d, $%d, $%d)", 3*i+1, 3*i+2, 3*i+3)
+			args = append(args, sample.Timestamp, sample.Tag, sample.Value)
+		}
+		if _, err := tx.ExecContext(ctx, query.String(), args...); err != nil {
+			return err
+		}
+		samples = samples[n:]
+	}
+	return tx.Commit()
+}
+
+// Close does nothing, the application owns the database handle
+func (s *SQLSink) Close() error {
+	return nil
+}
@@ -0,0 +1,115 @@
+package mapping
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// addressPrefixes maps the area prefixes of Omron address notation to word areas,
+// longer prefixes first so "DM" isn't read as "D"
+var addressPrefixes = []struct {
+	prefix string
+	area   MemoryArea
+}{
+	{"CIO", MemoryAreaCIOWord},
+	{"DM", MemoryAreaDMWord},
+	{"HR", MemoryAreaHRWord},
+	{"WR", MemoryAreaWRWord},
+	{"AR", MemoryAreaARWord},
+	{"D", MemoryAreaDMWord},
+	{"H", MemoryAreaHRWord},
+	{"W", MemoryAreaWRWord},
+	{"A", MemoryAreaARWord},
+}
+
+// wordBitAreas maps word areas to the bit area of the same memory
+var wordBitAreas = map[MemoryArea]MemoryArea{
+	MemoryAreaCIOWord:       MemoryAreaCIOBit,
+	MemoryAreaWRWord:        MemoryAreaWRBit,
+	MemoryAreaHRWord:        MemoryAreaHRBit,
+	MemoryAreaARWord:        MemoryAreaARBit,
+	MemoryAreaDMWord:        MemoryAreaDMBit,
+	MemoryAreaEMCurrentWord: MemoryAreaEMCurrentBit,
+}
+
+// BitArea returns the bit area of a word area, ok is false for areas without one
+func (m MemoryArea) BitArea() (MemoryArea, bool) {
+	bit, ok := wordBitAreas[m]
+	return bit, ok
+}
+
+// WordArea returns the word area of a bit area, ok is false for areas without one
+func (m MemoryArea) WordArea() (MemoryArea, bool) {
+	for word, bit := range wordBitAreas {
+		if bit == m {
+			return word, true
+		}
+	}
+	return 0, false
+}
+
+// AddressPrefix returns the short prefix of a word area in Omron address notation, empty for CIO.
+// EM banks are prefixed with their hex bank number ("E1_"), the current bank with "E".
+// ok is false for areas ParseAddress doesn't know.
+func (m MemoryArea) AddressPrefix() (string, bool) {
+	if m == MemoryAreaCIOWord {
+		return "", true
+	}
+	if m == MemoryAreaEMCurrentWord {
+		return "E", true
+	}
+	if bank, ok := m.EMBank(); ok && m.IsWord() {
+		return fmt.Sprintf("E%X_", bank), true
+	}
+	for _, p := range addressPrefixes {
+		if p.area == m && len(p.prefix) == 1 {
+			return p.prefix, true
+		}
+	}
+	return "", false
+}
+
+// ParseAddress parses an address in Omron notation such as "D100", "H10.03", "CIO0.15" or
+// "E1_200" (EM bank 1, "E200" is in the current bank). Plain numbers are CIO addresses.
+// It returns the word area, the word address and the bit offset, which is -1 when the
+// address has no bit part.
+func ParseAddress(s string) (MemoryArea, uint16, int, error) {
+	rest := strings.ToUpper(strings.TrimSpace(s))
+	area := MemoryAreaCIOWord
+	if em, ok := strings.CutPrefix(rest, "E"); ok {
+		area, rest = MemoryAreaEMCurrentWord, em
+		if bank, word, ok := strings.Cut(em, "_"); ok {
+			n, err := strconv.ParseUint(bank, 16, 8)
+			if err != nil {
+				return 0, 0, 0, fmt.Errorf("invalid EM bank in address %q", s)
+			}
+			if area, ok = EMBankWord(byte(n)); !ok {
+				return 0, 0, 0, fmt.Errorf("invalid EM bank in address %q", s)
+			}
+			rest = word
+		}
+	} else {
+		for _, p := range addressPrefixes {
+			if strings.HasPrefix(rest, p.prefix) {
+				area = p.area
+				rest = rest[len(p.prefix):]
+				break
+			}
+		}
+	}
+
+	word, bit, hasBit := strings.Cut(rest, ".")
+	address, err := strconv.ParseUint(word, 10, 16)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid address %q", s)
+	}
+	if !hasBit {
+		return area, uint16(address), -1, nil
+	}
+	offset, err := strconv.ParseUint(bit, 10, 8)
+	if err != nil || offset > 15 {
+		return 0, 0, 0, fmt.Errorf("invalid bit offset in address %q", s)
+	}
+	return area, uint16(address), int(offset), nil
+}
@@ -26,14 +26,20 @@ const (
 	// CommandCodeParameterAreaClear Command code: Parameter area clear
 	CommandCodeParameterAreaClear uint16 = 0x0203
 
+	// CommandCodeProgramAreaProtect Command code: Program area protect
+	CommandCodeProgramAreaProtect uint16 = 0x0304
+
+	// CommandCodeProgramAreaProtectClear Command code: Program area protect clear
+	CommandCodeProgramAreaProtectClear uint16 = 0x0305
+
 	// CommandCodeProgramAreaRead Command code: Program area read
-	CommandCodeProgramAreaRead uint16 = 0x0301
+	CommandCodeProgramAreaRead uint16 = 0x0306
 
 	// CommandCodeProgramAreaWrite Command code: Program area write
-	CommandCodeProgramAreaWrite uint16 = 0x0302
+	CommandCodeProgramAreaWrite uint16 = 0x0307
 
 	// CommandCodeProgramAreaClear Command code: Program area clear
-	CommandCodeProgramAreaClear uint16 = 0x0303
+	CommandCodeProgramAreaClear uint16 = 0x0308
 
 	// CommandCodeRun Command code: Set operating mode to run
 	CommandCodeRun uint16 = 0x0401
@@ -59,6 +65,15 @@ const (
 	// CommandCodeClockWrite Command code: clock write
 	CommandCodeClockWrite uint16 = 0x702
 
+	// CommandCodeInternodeEchoTest Command code: internode echo test
+	CommandCodeInternodeEchoTest uint16 = 0x0801
+
+	// CommandCodeBroadcastTestResultsRead Command code: broadcast test results read
+	CommandCodeBroadcastTestResultsRead uint16 = 0x0802
+
+	// CommandCodeBroadcastTestDataSend Command code: broadcast test data send
+	CommandCodeBroadcastTestDataSend uint16 = 0x0803
+
 	// CommandCodeMessageReadClear Command code: message read/clear
 	CommandCodeMessageReadClear uint16 = 0x0920
 
@@ -87,37 +102,37 @@ const (
 	CommandCodeFINSWriteAccessLogWrite uint16 = 0x2141
 
 	// CommandCodeFileNameRead Command code: file name read
-	CommandCodeFileNameRead uint16 = 0x2101
+	CommandCodeFileNameRead uint16 = 0x2201
 
 	// CommandCodeSingleFileRead Command code: file read
-	CommandCodeSingleFileRead uint16 = 0x2102
+	CommandCodeSingleFileRead uint16 = 0x2202
 
 	// CommandCodeSingleFileWrite Command code: file write
-	CommandCodeSingleFileWrite uint16 = 0x2103
+	CommandCodeSingleFileWrite uint16 = 0x2203
 
 	// CommandCodeFileMemoryFormat Command code: file memory format
-	CommandCodeFileMemoryFormat uint16 = 0x2104
+	CommandCodeFileMemoryFormat uint16 = 0x2204
 
 	// CommandCodeFileDelete Command code: file delete
-	CommandCodeFileDelete uint16 = 0x2105
+	CommandCodeFileDelete uint16 = 0x2205
 
 	// CommandCodeFileCopy Command code: file copy
-	CommandCodeFileCopy uint16 = 0x2107
+	CommandCodeFileCopy uint16 = 0x2207
 
 	// CommandCodeFileNameChange Command code: file name change
-	CommandCodeFileNameChange uint16 = 0x2108
+	CommandCodeFileNameChange uint16 = 0x2208
 
 	// CommandCodeMemoryAreaFileTransfer Command code: memory area file transfer
-	CommandCodeMemoryAreaFileTransfer uint16 = 0x210a
+	CommandCodeMemoryAreaFileTransfer uint16 = 0x220a
 
 	// CommandCodeParameterAreaFileTransfer Command code: parameter area file transfer
-	CommandCodeParameterAreaFileTransfer uint16 = 0x210b
+	CommandCodeParameterAreaFileTransfer uint16 = 0x220b
 
 	// CommandCodeProgramAreaFileTransfer Command code: program area file transfer
-	CommandCodeProgramAreaFileTransfer uint16 = 0x210b
+	CommandCodeProgramAreaFileTransfer uint16 = 0x220c
 
 	// CommandCodeDirectoryCreateDelete Command code: directory create/delete
-	CommandCodeDirectoryCreateDelete uint16 = 0x2115
+	CommandCodeDirectoryCreateDelete uint16 = 0x2215
 
 	// CommandCodeMemoryCassetteTransfer Command code: memory cassette transfer (CP1H and CP1L CPU units only)
 	CommandCodeMemoryCassetteTransfer uint16 = 0x2120
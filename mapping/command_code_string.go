@@ -0,0 +1,93 @@
+package mapping
+
+import "fmt"
+
+// CommandCode is a FINS command code. The CommandCode* constants are plain uint16 for the
+// frame encoders, convert them to get the name, e.g. CommandCode(CommandCodeMemoryAreaRead).
+type CommandCode uint16
+
+var commandNames = map[uint16]string{
+	CommandCodeMemoryAreaRead:              "MEMORY AREA READ",
+	CommandCodeMemoryAreaWrite:             "MEMORY AREA WRITE",
+	CommandCodeMemoryAreaFill:              "MEMORY AREA FILL",
+	CommandCodeMultipleMemoryAreaRead:      "MULTIPLE MEMORY AREA READ",
+	CommandCodeMemoryAreaTransfer:          "MEMORY AREA TRANSFER",
+	CommandCodeParameterAreaRead:           "PARAMETER AREA READ",
+	CommandCodeParameterAreaWrite:          "PARAMETER AREA WRITE",
+	CommandCodeParameterAreaClear:          "PARAMETER AREA CLEAR",
+	CommandCodeProgramAreaProtect:          "PROGRAM AREA PROTECT",
+	CommandCodeProgramAreaProtectClear:     "PROGRAM AREA PROTECT CLEAR",
+	CommandCodeProgramAreaRead:             "PROGRAM AREA READ",
+	CommandCodeProgramAreaWrite:            "PROGRAM AREA WRITE",
+	CommandCodeProgramAreaClear:            "PROGRAM AREA CLEAR",
+	CommandCodeRun:                         "RUN",
+	CommandCodeStop:                        "STOP",
+	CommandCodeCPUUnitDataRead:             "CPU UNIT DATA READ",
+	CommandCodeConnectionDataRead:          "CONNECTION DATA READ",
+	CommandCodeCPUUnitStatusRead:           "CPU UNIT STATUS READ",
+	CommandCodeCycleTimeRead:               "CYCLE TIME READ",
+	CommandCodeClockRead:                   "CLOCK READ",
+	CommandCodeClockWrite:                  "CLOCK WRITE",
+	CommandCodeInternodeEchoTest:           "INTERNODE ECHO TEST",
+	CommandCodeBroadcastTestResultsRead:    "BROADCAST TEST RESULTS READ",
+	CommandCodeBroadcastTestDataSend:       "BROADCAST TEST DATA SEND",
+	CommandCodeMessageReadClear:            "MESSAGE READ/CLEAR",
+	CommandCodeAccessRightAcquire:          "ACCESS RIGHT ACQUIRE",
+	CommandCodeAccessRightForcedAcquire:    "ACCESS RIGHT FORCED ACQUIRE",
+	CommandCodeAccessRightRelease:          "ACCESS RIGHT RELEASE",
+	CommandCodeErrorClear:                  "ERROR CLEAR",
+	CommandCodeErrorLogRead:                "ERROR LOG READ",
+	CommandCodeErrorLogClear:               "ERROR LOG CLEAR",
+	CommandCodeFINSWriteAccessLogRead:      "FINS WRITE ACCESS LOG READ",
+	CommandCodeFINSWriteAccessLogWrite:     "FINS WRITE ACCESS LOG CLEAR",
+	CommandCodeMemoryCassetteTransfer:      "MEMORY CASSETTE TRANSFER",
+	CommandCodeFileNameRead:                "FILE NAME READ",
+	CommandCodeSingleFileRead:              "SINGLE FILE READ",
+	CommandCodeSingleFileWrite:             "SINGLE FILE WRITE",
+	CommandCodeFileMemoryFormat:            "FILE MEMORY FORMAT",
+	CommandCodeFileDelete:                  "FILE DELETE",
+	CommandCodeFileCopy:                    "FILE COPY",
+	CommandCodeFileNameChange:              "FILE NAME CHANGE",
+	CommandCodeMemoryAreaFileTransfer:      "MEMORY AREA-FILE TRANSFER",
+	CommandCodeParameterAreaFileTransfer:   "PARAMETER AREA-FILE TRANSFER",
+	CommandCodeProgramAreaFileTransfer:     "PROGRAM AREA-FILE TRANSFER",
+	CommandCodeDirectoryCreateDelete:       "CREATE/DELETE DIRECTORY",
+	CommandCodeForcedSetReset:              "FORCED SET/RESET",
+	CommandCodeForcedSetResetCancel:        "FORCED SET/RESET CANCEL",
+	CommandCodeConvertToCompoWayFCommand:   "CONVERT TO COMPOWAY/F COMMAND",
+	CommandCodeConvertToModbusRTUCommand:   "CONVERT TO MODBUS-RTU COMMAND",
+	CommandCodeConvertToModbusASCIICommand: "CONVERT TO MODBUS-ASCII COMMAND",
+}
+
+// notRetryableCommands change the PLC differently when they are executed twice, e.g. a
+// second ERROR CLEAR clears the next error and a second FILE COPY fails on the copy
+var notRetryableCommands = map[uint16]bool{
+	CommandCodeErrorClear:                  true,
+	CommandCodeFileDelete:                  true,
+	CommandCodeFileCopy:                    true,
+	CommandCodeFileNameChange:              true,
+	CommandCodeMemoryAreaFileTransfer:      true,
+	CommandCodeParameterAreaFileTransfer:   true,
+	CommandCodeProgramAreaFileTransfer:     true,
+	CommandCodeDirectoryCreateDelete:       true,
+	CommandCodeMemoryCassetteTransfer:      true,
+	CommandCodeBroadcastTestDataSend:       true,
+	CommandCodeConvertToCompoWayFCommand:   true,
+	CommandCodeConvertToModbusRTUCommand:   true,
+	CommandCodeConvertToModbusASCIICommand: true,
+}
+
+// String returns the name of the command as in the Omron manuals, e.g. "MEMORY AREA READ"
+func (c CommandCode) String() string {
+	if name, ok := commandNames[uint16(c)]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown command 0x%04X", uint16(c))
+}
+
+// IsRetryable reports whether the command can be sent again when its response was lost,
+// because it only reads or sets state to the same result. Unknown commands are not retryable.
+func (c CommandCode) IsRetryable() bool {
+	_, known := commandNames[uint16(c)]
+	return known && !notRetryableCommands[uint16(c)]
+}
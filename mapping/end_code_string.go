@@ -0,0 +1,136 @@
+package mapping
+
+import "fmt"
+
+// EndCode is the end code of a FINS response. The EndCode* constants are plain uint16 for the
+// frame encoders, convert them to get the description, e.g. EndCode(EndCodeAddressRangeError).
+type EndCode uint16
+
+// End code flags, reported in addition to the main and sub response code
+const (
+	EndCodeFlagRelayError       EndCode = 0x8000 // The error occurred at a relay node on the way to the destination
+	EndCodeFlagFatalCPUError    EndCode = 0x0080 // The destination CPU unit has a fatal error
+	EndCodeFlagNonFatalCPUError EndCode = 0x0040 // The destination CPU unit has a non-fatal error
+)
+
+var endCodeDescriptions = map[uint16]string{
+	EndCodeNormalCompletion:                                      "normal completion",
+	EndCodeServiceInterrupted:                                    "normal completion; service was interrupted",
+	EndCodeLocalNodeNotInNetwork:                                 "local node error; local node not in network",
+	EndCodeTokenTimeout:                                          "local node error; token timeout",
+	EndCodeRetriesFailed:                                         "local node error; retries failed",
+	EndCodeTooManySendFrames:                                     "local node error; too many send frames",
+	EndCodeNodeAddressRangeError:                                 "local node error; node address range error",
+	EndCodeNodeAddressRangeDuplication:                           "local node error; node address range duplication",
+	EndCodeDestinationNodeNotInNetwork:                           "destination node error; destination node not in network",
+	EndCodeUnitMissing:                                           "destination node error; unit missing",
+	EndCodeThirdNodeMissing:                                      "destination node error; third node missing",
+	EndCodeDestinationNodeBusy:                                   "destination node error; destination node busy",
+	EndCodeResponseTimeout:                                       "destination node error; response timeout",
+	EndCodeCommunicationsControllerError:                         "controller error; communication controller error",
+	EndCodeCPUUnitError:                                          "controller error; CPU unit error",
+	EndCodeControllerError:                                       "controller error; controller error",
+	EndCodeUnitNumberError:                                       "controller error; unit number error",
+	EndCodeUndefinedCommand:                                      "service unsupported; undefined command",
+	EndCodeNotSupportedByModelVersion:                            "service unsupported; not supported by model version",
+	EndCodeDestinationAddressSettingError:                        "routing table error; destination address setting error",
+	EndCodeNoRoutingTables:                                       "routing table error; no routing tables",
+	EndCodeRoutingTableError:                                     "routing table error; routing table error",
+	EndCodeTooManyRelays:                                         "routing table error; too many relays",
+	EndCodeCommandTooLong:                                        "command format error; command too long",
+	EndCodeCommandTooShort:                                       "command format error; command too short",
+	EndCodeElementsDataDontMatch:                                 "command format error; elements/data don't match",
+	EndCodeCommandFormatError:                                    "command format error; command format error",
+	EndCodeHeaderError:                                           "command format error; header error",
+	EndCodeAreaClassificationMissing:                             "parameter error; classification missing",
+	EndCodeAccessSizeError:                                       "parameter error; access size error",
+	EndCodeAddressRangeError:                                     "parameter error; address range error",
+	EndCodeAddressRangeExceeded:                                  "parameter error; address range exceeded",
+	EndCodeProgramMissing:                                        "parameter error; program missing",
+	EndCodeRelationalError:                                       "parameter error; relational error",
+	EndCodeDuplicateDataAccess:                                   "parameter error; duplicate data access",
+	EndCodeResponseTooBig:                                        "parameter error; response too big",
+	EndCodeParameterError:                                        "parameter error",
+	EndCodeReadNotPossibleProtected:                              "read not possible; protected",
+	EndCodeReadNotPossibleTableMissing:                           "read not possible; table missing",
+	EndCodeReadNotPossibleDataMissing:                            "read not possible; data missing",
+	EndCodeReadNotPossibleProgramMissing:                         "read not possible; program missing",
+	EndCodeReadNotPossibleFileMissing:                            "read not possible; file missing",
+	EndCodeReadNotPossibleDataMismatch:                           "read not possible; data mismatch",
+	EndCodeWriteNotPossibleReadOnly:                              "write not possible; read only",
+	EndCodeWriteNotPossibleProtected:                             "write not possible; write protected",
+	EndCodeWriteNotPossibleCannotRegister:                        "write not possible; cannot register",
+	EndCodeWriteNotPossibleProgramMissing:                        "write not possible; program missing",
+	EndCodeWriteNotPossibleFileMissing:                           "write not possible; file missing",
+	EndCodeWriteNotPossibleFileNameAlreadyExists:                 "write not possible; file name already exists",
+	EndCodeWriteNotPossibleCannotChange:                          "write not possible; cannot change",
+	EndCodeNotExecutableInCurrentModeNotPossibleDuringExecution:  "not executable in current mode; not possible during execution",
+	EndCodeNotExecutableInCurrentModeNotPossibleWhileRunning:     "not executable in current mode; not possible while running",
+	EndCodeNotExecutableInCurrentModeWrongPLCModeInProgram:       "not executable in current mode; PLC is in PROGRAM mode",
+	EndCodeNotExecutableInCurrentModeWrongPLCModeInDebug:         "not executable in current mode; PLC is in DEBUG mode",
+	EndCodeNotExecutableInCurrentModeWrongPLCModeInMonitor:       "not executable in current mode; PLC is in MONITOR mode",
+	EndCodeNotExecutableInCurrentModeWrongPLCModeInRun:           "not executable in current mode; PLC is in RUN mode",
+	EndCodeNotExecutableInCurrentModeSpecifiedNodeNotPollingNode: "not executable in current mode; specified node is not polling node",
+	EndCodeNotExecutableInCurrentModeStepCannotBeExecuted:        "not executable in current mode; step cannot be executed",
+	EndCodeNoSuchDeviceFileDeviceMissing:                         "no such device; file device missing",
+	EndCodeNoSuchDeviceMemoryMissing:                             "no such device; memory missing",
+	EndCodeNoSuchDeviceClockMissing:                              "no such device; clock missing",
+	EndCodeCannotStartStopTableMissing:                           "cannot start/stop; table missing",
+	EndCodeUnitErrorMemoryError:                                  "unit error; memory error",
+	EndCodeUnitErrorIOError:                                      "unit error; IO error",
+	EndCodeUnitErrorTooManyIOPoints:                              "unit error; too many IO points",
+	EndCodeUnitErrorCPUBusError:                                  "unit error; CPU bus error",
+	EndCodeUnitErrorIODuplication:                                "unit error; IO duplication",
+	EndCodeUnitErrorIOBusError:                                   "unit error; IO bus error",
+	EndCodeUnitErrorSYSMACBUS2Error:                              "unit error; SYSMAC BUS/2 error",
+	EndCodeUnitErrorCPUBusUnitError:                              "unit error; CPU bus unit error",
+	EndCodeUnitErrorSYSMACBusNumberDuplication:                   "unit error; SYSMAC bus number duplication",
+	EndCodeUnitErrorMemoryStatusError:                            "unit error; memory status error",
+	EndCodeUnitErrorSYSMACBusTerminatorMissing:                   "unit error; SYSMAC bus terminator missing",
+	EndCodeCommandErrorNoProtection:                              "command error; no protection",
+	EndCodeCommandErrorIncorrectPassword:                         "command error; incorrect password",
+	EndCodeCommandErrorProtected:                                 "command error; protected",
+	EndCodeCommandErrorServiceAlreadyExecuting:                   "command error; service already executing",
+	EndCodeCommandErrorServiceStopped:                            "command error; service stopped",
+	EndCodeCommandErrorNoExecutionRight:                          "command error; no execution right",
+	EndCodeCommandErrorSettingsNotComplete:                       "command error; settings not complete",
+	EndCodeCommandErrorNecessaryItemsNotSet:                      "command error; necessary items not set",
+	EndCodeCommandErrorNumberAlreadyDefined:                      "command error; number already defined",
+	EndCodeCommandErrorErrorWillNotClear:                         "command error; error will not clear",
+	EndCodeAccessWriteErrorNoAccessRight:                         "access write error; no access right",
+	EndCodeAbortServiceAborted:                                   "abort; service aborted",
+}
+
+// Code returns the main and sub response code without the flags
+func (e EndCode) Code() EndCode {
+	return e &^ (EndCodeFlagRelayError | EndCodeFlagFatalCPUError | EndCodeFlagNonFatalCPUError)
+}
+
+// String returns the description of the end code as in the Omron manuals, e.g.
+// "parameter error; address range error"
+func (e EndCode) String() string {
+	if d, ok := endCodeDescriptions[uint16(e.Code())]; ok {
+		return d
+	}
+	return fmt.Sprintf("unknown end code 0x%04X", uint16(e))
+}
+
+// IsRetryable reports whether the command may succeed when it is sent again unchanged,
+// because the error was caused by a busy or unreachable node rather than by the command
+func (e EndCode) IsRetryable() bool {
+	switch uint16(e.Code()) {
+	case EndCodeServiceInterrupted,
+		EndCodeTokenTimeout,
+		EndCodeRetriesFailed,
+		EndCodeTooManySendFrames,
+		EndCodeDestinationNodeNotInNetwork,
+		EndCodeThirdNodeMissing,
+		EndCodeDestinationNodeBusy,
+		EndCodeResponseTimeout,
+		EndCodeCommandErrorServiceAlreadyExecuting,
+		EndCodeCommandErrorNoExecutionRight,
+		EndCodeAccessWriteErrorNoAccessRight:
+		return true
+	}
+	return false
+}
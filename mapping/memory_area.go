@@ -1,75 +1,189 @@
 // Package mapping handles mapping of codes. such as, command codes, area codes, status codes, end codes.
 package mapping
 
+import "fmt"
+
+// MemoryArea is a FINS memory area code. It knows whether the area is bit or word addressable,
+// its highest address and its display name.
+type MemoryArea byte
+
 const (
 	// MemoryAreaCIOBit Memory area: CIO area; bit
-	MemoryAreaCIOBit byte = 0x30
+	MemoryAreaCIOBit MemoryArea = 0x30
 
 	// MemoryAreaWRBit Memory area: work area; bit
-	MemoryAreaWRBit byte = 0x31
+	MemoryAreaWRBit MemoryArea = 0x31
 
 	// MemoryAreaHRBit Memory area: holding area; bit
-	MemoryAreaHRBit byte = 0x32
+	MemoryAreaHRBit MemoryArea = 0x32
 
 	// MemoryAreaARBit Memory area: axuillary area; bit
-	MemoryAreaARBit byte = 0x33
+	MemoryAreaARBit MemoryArea = 0x33
 
 	// MemoryAreaCIOWord Memory area: CIO area; word
-	MemoryAreaCIOWord byte = 0xb0
+	MemoryAreaCIOWord MemoryArea = 0xb0
 
 	// MemoryAreaWRWord Memory area: work area; word
-	MemoryAreaWRWord byte = 0xb1
+	MemoryAreaWRWord MemoryArea = 0xb1
 
 	// MemoryAreaHRWord Memory area: holding area; word
-	MemoryAreaHRWord byte = 0xb2
+	MemoryAreaHRWord MemoryArea = 0xb2
 
 	// MemoryAreaARWord Memory area: auxillary area; word
-	MemoryAreaARWord byte = 0xb3
+	MemoryAreaARWord MemoryArea = 0xb3
 
 	// MemoryAreaTimerCounterCompletionFlag Memory area: counter completion flag
-	MemoryAreaTimerCounterCompletionFlag byte = 0x09
+	MemoryAreaTimerCounterCompletionFlag MemoryArea = 0x09
 
 	// MemoryAreaTimerCounterPV Memory area: counter PV
-	MemoryAreaTimerCounterPV byte = 0x89
+	MemoryAreaTimerCounterPV MemoryArea = 0x89
 
 	// MemoryAreaDMBit Memory area: data area; bit
-	MemoryAreaDMBit byte = 0x02
+	MemoryAreaDMBit MemoryArea = 0x02
 
 	// MemoryAreaDMWord Memory area: data area; word
-	MemoryAreaDMWord byte = 0x82
+	MemoryAreaDMWord MemoryArea = 0x82
 
 	// MemoryAreaTaskBit Memory area: task flags; bit
-	MemoryAreaTaskBit byte = 0x06
+	MemoryAreaTaskBit MemoryArea = 0x06
 
 	// MemoryAreaTaskStatus Memory area: task flags; status
-	MemoryAreaTaskStatus byte = 0x46
+	MemoryAreaTaskStatus MemoryArea = 0x46
 
 	// MemoryAreaIndexRegisterPV Memory area: CIO bit
-	MemoryAreaIndexRegisterPV byte = 0xdc
+	MemoryAreaIndexRegisterPV MemoryArea = 0xdc
 
 	// MemoryAreaDataRegisterPV Memory area: CIO bit
-	MemoryAreaDataRegisterPV byte = 0xbc
+	MemoryAreaDataRegisterPV MemoryArea = 0xbc
 
 	// MemoryAreaClockPulsesConditionFlagsBit Memory area: CIO bit
-	MemoryAreaClockPulsesConditionFlagsBit byte = 0x07
+	MemoryAreaClockPulsesConditionFlagsBit MemoryArea = 0x07
+
+	// MemoryAreaEMCurrentBit Memory area: EM current bank; bit
+	MemoryAreaEMCurrentBit MemoryArea = 0x0a
+
+	// MemoryAreaEMCurrentWord Memory area: EM current bank; word
+	MemoryAreaEMCurrentWord MemoryArea = 0x98
 )
 
-func CheckIsWordMemoryArea(memoryArea byte) bool {
-	if memoryArea == MemoryAreaDMWord ||
-		memoryArea == MemoryAreaARWord ||
-		memoryArea == MemoryAreaHRWord ||
-		memoryArea == MemoryAreaWRWord {
-		return true
+// EM_BANKS is the number of EM banks with their own area codes, banks 0 to 0x18 (CJ2H).
+// Banks 0-F use the area codes 0x20-0x2F (bit) and 0xA0-0xAF (word), banks 10-18 use
+// 0xE0-0xE8 (bit) and 0x60-0x68 (word).
+const EM_BANKS = 0x19
+
+// EMBankWord returns the word area of an EM bank, ok is false for banks beyond EM_BANKS
+func EMBankWord(bank byte) (MemoryArea, bool) {
+	switch {
+	case bank < 0x10:
+		return 0xa0 + MemoryArea(bank), true
+	case bank < EM_BANKS:
+		return 0x60 + MemoryArea(bank-0x10), true
 	}
-	return false
+	return 0, false
 }
 
-func CheckIsBitMemoryArea(memoryArea byte) bool {
-	if memoryArea == MemoryAreaDMBit ||
-		memoryArea == MemoryAreaARBit ||
-		memoryArea == MemoryAreaHRBit ||
-		memoryArea == MemoryAreaWRBit {
-		return true
+// EMBankBit returns the bit area of an EM bank, ok is false for banks beyond EM_BANKS
+func EMBankBit(bank byte) (MemoryArea, bool) {
+	switch {
+	case bank < 0x10:
+		return 0x20 + MemoryArea(bank), true
+	case bank < EM_BANKS:
+		return 0xe0 + MemoryArea(bank-0x10), true
 	}
-	return false
+	return 0, false
+}
+
+// EMBank returns the bank of an EM bank area, bit or word. ok is false for other areas,
+// including the current bank areas.
+func (m MemoryArea) EMBank() (byte, bool) {
+	switch {
+	case m >= 0xa0 && m <= 0xaf:
+		return byte(m - 0xa0), true
+	case m >= 0x20 && m <= 0x2f:
+		return byte(m - 0x20), true
+	case m >= 0x60 && m < 0x60+EM_BANKS-0x10:
+		return byte(m-0x60) + 0x10, true
+	case m >= 0xe0 && m < 0xe0+EM_BANKS-0x10:
+		return byte(m-0xe0) + 0x10, true
+	}
+	return 0, false
+}
+
+// memoryAreaInfo describes a memory area, maxAddress is the highest word address on CJ2 CPUs
+type memoryAreaInfo struct {
+	name       string
+	bit        bool
+	word       bool
+	maxAddress uint16
+}
+
+var memoryAreas = map[MemoryArea]memoryAreaInfo{
+	MemoryAreaCIOBit:                       {name: "CIO bit", bit: true, maxAddress: 6143},
+	MemoryAreaWRBit:                        {name: "WR bit", bit: true, maxAddress: 511},
+	MemoryAreaHRBit:                        {name: "HR bit", bit: true, maxAddress: 1535},
+	MemoryAreaARBit:                        {name: "AR bit", bit: true, maxAddress: 959},
+	MemoryAreaCIOWord:                      {name: "CIO word", word: true, maxAddress: 6143},
+	MemoryAreaWRWord:                       {name: "WR word", word: true, maxAddress: 511},
+	MemoryAreaHRWord:                       {name: "HR word", word: true, maxAddress: 1535},
+	MemoryAreaARWord:                       {name: "AR word", word: true, maxAddress: 959},
+	MemoryAreaTimerCounterCompletionFlag:   {name: "TIM/CNT completion flag", bit: true, maxAddress: 4095},
+	MemoryAreaTimerCounterPV:               {name: "TIM/CNT PV", word: true, maxAddress: 4095},
+	MemoryAreaDMBit:                        {name: "DM bit", bit: true, maxAddress: 32767},
+	MemoryAreaDMWord:                       {name: "DM word", word: true, maxAddress: 32767},
+	MemoryAreaTaskBit:                      {name: "task flag", bit: true, maxAddress: 31},
+	MemoryAreaTaskStatus:                   {name: "task status", bit: true, maxAddress: 31},
+	MemoryAreaIndexRegisterPV:              {name: "IR PV", word: true, maxAddress: 15},
+	MemoryAreaDataRegisterPV:               {name: "DR PV", word: true, maxAddress: 15},
+	MemoryAreaClockPulsesConditionFlagsBit: {name: "clock pulse/condition flag", bit: true, maxAddress: 0x1FFF},
+	MemoryAreaEMCurrentBit:                 {name: "EM current bank bit", bit: true, maxAddress: 32767},
+	MemoryAreaEMCurrentWord:                {name: "EM current bank word", word: true, maxAddress: 32767},
+}
+
+func init() {
+	for bank := byte(0); bank < EM_BANKS; bank++ {
+		word, _ := EMBankWord(bank)
+		bit, _ := EMBankBit(bank)
+		memoryAreas[word] = memoryAreaInfo{name: fmt.Sprintf("EM%X word", bank), word: true, maxAddress: 32767}
+		memoryAreas[bit] = memoryAreaInfo{name: fmt.Sprintf("EM%X bit", bank), bit: true, maxAddress: 32767}
+		wordBitAreas[word] = bit
+	}
+}
+
+// String returns the display name of the memory area
+func (m MemoryArea) String() string {
+	if info, ok := memoryAreas[m]; ok {
+		return info.name
+	}
+	return fmt.Sprintf("unknown memory area 0x%02X", byte(m))
+}
+
+// Known returns true if m is one of the memory areas defined in this package
+func (m MemoryArea) Known() bool {
+	_, ok := memoryAreas[m]
+	return ok
+}
+
+// IsBit returns true if the memory area is read and written one bit per item
+func (m MemoryArea) IsBit() bool {
+	return memoryAreas[m].bit
+}
+
+// IsWord returns true if the memory area is read and written one word per item
+func (m MemoryArea) IsWord() bool {
+	return memoryAreas[m].word
+}
+
+// MaxAddress returns the highest word address of the memory area, 0 for unknown areas
+func (m MemoryArea) MaxAddress() uint16 {
+	return memoryAreas[m].maxAddress
+}
+
+// CheckIsWordMemoryArea returns true if the memory area is word addressable
+func CheckIsWordMemoryArea(memoryArea MemoryArea) bool {
+	return memoryArea.IsWord()
+}
+
+// CheckIsBitMemoryArea returns true if the memory area is bit addressable
+func CheckIsBitMemoryArea(memoryArea MemoryArea) bool {
+	return memoryArea.IsBit()
 }
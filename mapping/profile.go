@@ -0,0 +1,144 @@
+package mapping
+
+import "strings"
+
+// Profile describes the capabilities of a PLC model: memory area sizes, supported commands
+// and the largest transfers accepted by a single command
+type Profile struct {
+	Name string
+	// ModelPrefixes match the model name returned by the CPU unit data read command
+	ModelPrefixes []string
+	// MaxAddress is the highest word address per memory area, areas that are missing
+	// use MemoryArea.MaxAddress
+	MaxAddress map[MemoryArea]uint16
+	// Commands lists the supported command codes, nil supports all commands
+	Commands []uint16
+	// MaxReadWords and MaxWriteWords limit the words transferred by a single memory area
+	// read or write, zero leaves the limit to the frame size
+	MaxReadWords  uint16
+	MaxWriteWords uint16
+	// AreaTransferLimits overrides MaxReadWords and MaxWriteWords for single memory areas,
+	// zero fields keep the limits of the profile
+	AreaTransferLimits map[MemoryArea]TransferLimit
+}
+
+// TransferLimit is the largest number of words a single memory area read or write transfers
+type TransferLimit struct {
+	Read  uint16
+	Write uint16
+}
+
+var (
+	// ProfileCJ2 CJ2H/CJ2M CPUs, the limits of MemoryArea.MaxAddress
+	ProfileCJ2 = Profile{
+		Name:          "CJ2",
+		ModelPrefixes: []string{"CJ2"},
+		MaxReadWords:  999,
+		MaxWriteWords: 996,
+	}
+
+	// ProfileCJ1 CJ1 CPUs, which have a smaller HR area than CJ2
+	ProfileCJ1 = Profile{
+		Name:          "CJ1",
+		ModelPrefixes: []string{"CJ1"},
+		MaxAddress:    map[MemoryArea]uint16{MemoryAreaHRBit: 511, MemoryAreaHRWord: 511},
+		MaxReadWords:  999,
+		MaxWriteWords: 996,
+	}
+
+	// ProfileCS1 CS1 CPUs, with the same memory layout as CJ1
+	ProfileCS1 = Profile{
+		Name:          "CS1",
+		ModelPrefixes: []string{"CS1"},
+		MaxAddress:    map[MemoryArea]uint16{MemoryAreaHRBit: 511, MemoryAreaHRWord: 511},
+		MaxReadWords:  999,
+		MaxWriteWords: 996,
+	}
+
+	// ProfileCP1 CP1H/CP1L CPUs
+	ProfileCP1 = Profile{
+		Name:          "CP1",
+		ModelPrefixes: []string{"CP1"},
+		MaxAddress:    map[MemoryArea]uint16{MemoryAreaHRBit: 511, MemoryAreaHRWord: 511},
+		MaxReadWords:  499,
+		MaxWriteWords: 496,
+	}
+
+	// ProfileNJNX NJ/NX controllers. Their memory used for CJ-series units is reachable
+	// through the FINS memory area commands, other variables are not.
+	ProfileNJNX = Profile{
+		Name:          "NJ/NX",
+		ModelPrefixes: []string{"NJ", "NX"},
+		Commands: []uint16{
+			CommandCodeMemoryAreaRead,
+			CommandCodeMemoryAreaWrite,
+			CommandCodeMemoryAreaFill,
+			CommandCodeMultipleMemoryAreaRead,
+			CommandCodeMemoryAreaTransfer,
+			CommandCodeRun,
+			CommandCodeStop,
+			CommandCodeCPUUnitDataRead,
+			CommandCodeCPUUnitStatusRead,
+			CommandCodeClockRead,
+			CommandCodeClockWrite,
+		},
+		MaxReadWords:  999,
+		MaxWriteWords: 996,
+	}
+
+	// Profiles is the registry searched by ProfileForModel
+	Profiles = []Profile{ProfileCJ2, ProfileCJ1, ProfileCS1, ProfileCP1, ProfileNJNX}
+)
+
+// ProfileForModel returns the registered profile matching a CPU unit model name such as
+// "CJ2M-CPU33", or false if no profile matches
+func ProfileForModel(model string) (Profile, bool) {
+	model = strings.ToUpper(strings.TrimSpace(model))
+	for _, p := range Profiles {
+		for _, prefix := range p.ModelPrefixes {
+			if strings.HasPrefix(model, prefix) {
+				return p, true
+			}
+		}
+	}
+	return Profile{}, false
+}
+
+// AreaMaxAddress returns the highest word address of memoryArea, 0 if the area is unknown
+func (p Profile) AreaMaxAddress(memoryArea MemoryArea) uint16 {
+	if max, ok := p.MaxAddress[memoryArea]; ok {
+		return max
+	}
+	return memoryArea.MaxAddress()
+}
+
+// ReadLimit returns the words a single read of memoryArea may transfer, 0 if only the frame
+// size limits it
+func (p Profile) ReadLimit(memoryArea MemoryArea) uint16 {
+	if l := p.AreaTransferLimits[memoryArea]; l.Read > 0 {
+		return l.Read
+	}
+	return p.MaxReadWords
+}
+
+// WriteLimit returns the words a single write to memoryArea may transfer, 0 if only the
+// frame size limits it
+func (p Profile) WriteLimit(memoryArea MemoryArea) uint16 {
+	if l := p.AreaTransferLimits[memoryArea]; l.Write > 0 {
+		return l.Write
+	}
+	return p.MaxWriteWords
+}
+
+// Supports returns true if the command code is supported by the model
+func (p Profile) Supports(commandCode uint16) bool {
+	if p.Commands == nil {
+		return true
+	}
+	for _, c := range p.Commands {
+		if c == commandCode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,445 @@
+// Package modbus serves Modbus TCP and translates the requests into FINS commands.
+//
+// Holding registers and coils are mapped onto configured FINS memory areas, which lets
+// legacy Modbus masters read and write Omron PLC memory through a gofins client.
+package modbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"folke99/gofins/fins"
+	"folke99/gofins/mapping"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// Backend is the part of the FINS client used by the translator, *fins.Client satisfies it
+type Backend interface {
+	ReadWords(memoryArea mapping.MemoryArea, address uint16, readCount uint16) ([]uint16, error)
+	WriteWords(memoryArea mapping.MemoryArea, address uint16, data []uint16) error
+	ReadBits(memoryArea mapping.MemoryArea, address uint16, bitOffset byte, readCount uint16) ([]bool, error)
+	WriteBits(memoryArea mapping.MemoryArea, address uint16, bitOffset byte, data []bool) error
+}
+
+// Mapping describes where the Modbus tables live in PLC memory.
+//
+// Holding register n maps to word HoldingRegisterStart+n of HoldingRegisterArea.
+// Coil n maps to bit n%16 of word CoilStart+n/16 of CoilArea.
+type Mapping struct {
+	HoldingRegisterArea  mapping.MemoryArea
+	HoldingRegisterStart uint16
+	CoilArea             mapping.MemoryArea
+	CoilStart            uint16
+}
+
+// Modbus function codes
+const (
+	FunctionReadCoils              byte = 0x01
+	FunctionReadHoldingRegisters   byte = 0x03
+	FunctionWriteSingleCoil        byte = 0x05
+	FunctionWriteSingleRegister    byte = 0x06
+	FunctionWriteMultipleCoils     byte = 0x0F
+	FunctionWriteMultipleRegisters byte = 0x10
+)
+
+// Modbus exception codes
+const (
+	ExceptionIllegalFunction     byte = 0x01
+	ExceptionIllegalDataAddress  byte = 0x02
+	ExceptionIllegalDataValue    byte = 0x03
+	ExceptionServerDeviceFailure byte = 0x04
+)
+
+const (
+	MBAP_HEADER_LENGTH  = 7
+	MAX_PDU_LENGTH      = 253
+	MAX_READ_COILS      = 2000
+	MAX_READ_REGISTERS  = 125
+	MAX_WRITE_COILS     = 1968
+	MAX_WRITE_REGISTERS = 123
+)
+
+// Server is a Modbus TCP server proxying requests to a FINS backend
+type Server struct {
+	sync.Mutex
+	address  string
+	listener net.Listener
+	backend  Backend
+	mapping  Mapping
+	closed   bool
+	conns    map[net.Conn]struct{}
+}
+
+// NewServer validates the mapping and starts serving Modbus TCP on address
+func NewServer(address string, backend Backend, m Mapping) (*Server, error) {
+	if !mapping.CheckIsWordMemoryArea(m.HoldingRegisterArea) {
+		return nil, fmt.Errorf("holding register area must be a word memory area: %s", m.HoldingRegisterArea)
+	}
+	if !mapping.CheckIsBitMemoryArea(m.CoilArea) {
+		return nil, fmt.Errorf("coil area must be a bit memory area: %s", m.CoilArea)
+	}
+
+	s := &Server{
+		address: address,
+		backend: backend,
+		mapping: m,
+		conns:   make(map[net.Conn]struct{}),
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	s.listener = listener
+
+	go s.acceptConnections()
+	return s, nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops listening and closes all Modbus connections
+func (s *Server) Close() error {
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return nil
+	}
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.Unlock()
+
+	return s.listener.Close()
+}
+
+func (s *Server) isClosed() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.closed
+}
+
+func (s *Server) acceptConnections() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return
+			}
+			log.Println("Error accepting Modbus connection:", err)
+			continue
+		}
+
+		s.Lock()
+		if s.closed {
+			s.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.Unlock()
+
+		go s.handleClient(conn)
+	}
+}
+
+func (s *Server) handleClient(conn net.Conn) {
+	defer func() {
+		s.Lock()
+		delete(s.conns, conn)
+		s.Unlock()
+		conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+
+	for {
+		header := make([]byte, MBAP_HEADER_LENGTH)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err != io.EOF && !s.isClosed() {
+				log.Printf("Modbus header read error: %v", err)
+			}
+			return
+		}
+
+		transactionID := binary.BigEndian.Uint16(header[0:2])
+		protocolID := binary.BigEndian.Uint16(header[2:4])
+		length := binary.BigEndian.Uint16(header[4:6])
+		unitID := header[6]
+
+		if protocolID != 0 || length < 2 || length-1 > MAX_PDU_LENGTH {
+			log.Printf("Invalid MBAP header: protocol %d, length %d", protocolID, length)
+			return
+		}
+
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(reader, pdu); err != nil {
+			log.Printf("Modbus PDU read error: %v", err)
+			return
+		}
+
+		resp := s.handler(pdu)
+
+		frame := make([]byte, MBAP_HEADER_LENGTH, MBAP_HEADER_LENGTH+len(resp))
+		binary.BigEndian.PutUint16(frame[0:2], transactionID)
+		binary.BigEndian.PutUint16(frame[2:4], 0)
+		binary.BigEndian.PutUint16(frame[4:6], uint16(len(resp)+1))
+		frame[6] = unitID
+		frame = append(frame, resp...)
+
+		if _, err := conn.Write(frame); err != nil {
+			log.Printf("Modbus response write error: %v", err)
+			return
+		}
+	}
+}
+
+// handler executes a single PDU and returns the response PDU
+func (s *Server) handler(pdu []byte) []byte {
+	function := pdu[0]
+	data := pdu[1:]
+
+	switch function {
+	case FunctionReadCoils:
+		return s.readCoils(function, data)
+	case FunctionReadHoldingRegisters:
+		return s.readHoldingRegisters(function, data)
+	case FunctionWriteSingleCoil:
+		return s.writeSingleCoil(function, data)
+	case FunctionWriteSingleRegister:
+		return s.writeSingleRegister(function, data)
+	case FunctionWriteMultipleCoils:
+		return s.writeMultipleCoils(function, data)
+	case FunctionWriteMultipleRegisters:
+		return s.writeMultipleRegisters(function, data)
+	default:
+		log.Printf("Unsupported Modbus function: 0x%02X", function)
+		return exception(function, ExceptionIllegalFunction)
+	}
+}
+
+func (s *Server) readCoils(function byte, data []byte) []byte {
+	if len(data) != 4 {
+		return exception(function, ExceptionIllegalDataValue)
+	}
+	start := binary.BigEndian.Uint16(data[0:2])
+	quantity := binary.BigEndian.Uint16(data[2:4])
+	if quantity == 0 || quantity > MAX_READ_COILS {
+		return exception(function, ExceptionIllegalDataValue)
+	}
+
+	address, bitOffset, ok := s.coilAddress(start, quantity)
+	if !ok {
+		return exception(function, ExceptionIllegalDataAddress)
+	}
+
+	bits, err := s.backend.ReadBits(s.mapping.CoilArea, address, bitOffset, quantity)
+	if err != nil {
+		log.Printf("FINS read for coils %d-%d failed: %v", start, int(start)+int(quantity)-1, err)
+		return exception(function, exceptionCode(err))
+	}
+
+	packed := packBits(bits)
+	return append([]byte{function, byte(len(packed))}, packed...)
+}
+
+func (s *Server) readHoldingRegisters(function byte, data []byte) []byte {
+	if len(data) != 4 {
+		return exception(function, ExceptionIllegalDataValue)
+	}
+	start := binary.BigEndian.Uint16(data[0:2])
+	quantity := binary.BigEndian.Uint16(data[2:4])
+	if quantity == 0 || quantity > MAX_READ_REGISTERS {
+		return exception(function, ExceptionIllegalDataValue)
+	}
+
+	address, ok := s.registerAddress(start, quantity)
+	if !ok {
+		return exception(function, ExceptionIllegalDataAddress)
+	}
+
+	words, err := s.backend.ReadWords(s.mapping.HoldingRegisterArea, address, quantity)
+	if err != nil {
+		log.Printf("FINS read for registers %d-%d failed: %v", start, int(start)+int(quantity)-1, err)
+		return exception(function, exceptionCode(err))
+	}
+
+	resp := make([]byte, 2, 2+2*len(words))
+	resp[0] = function
+	resp[1] = byte(2 * len(words))
+	for _, w := range words {
+		resp = binary.BigEndian.AppendUint16(resp, w)
+	}
+	return resp
+}
+
+func (s *Server) writeSingleCoil(function byte, data []byte) []byte {
+	if len(data) != 4 {
+		return exception(function, ExceptionIllegalDataValue)
+	}
+	start := binary.BigEndian.Uint16(data[0:2])
+	value := binary.BigEndian.Uint16(data[2:4])
+	if value != 0xFF00 && value != 0x0000 {
+		return exception(function, ExceptionIllegalDataValue)
+	}
+
+	address, bitOffset, ok := s.coilAddress(start, 1)
+	if !ok {
+		return exception(function, ExceptionIllegalDataAddress)
+	}
+
+	err := s.backend.WriteBits(s.mapping.CoilArea, address, bitOffset, []bool{value == 0xFF00})
+	if err != nil {
+		log.Printf("FINS write for coil %d failed: %v", start, err)
+		return exception(function, exceptionCode(err))
+	}
+
+	return append([]byte{function}, data...)
+}
+
+func (s *Server) writeSingleRegister(function byte, data []byte) []byte {
+	if len(data) != 4 {
+		return exception(function, ExceptionIllegalDataValue)
+	}
+	start := binary.BigEndian.Uint16(data[0:2])
+	value := binary.BigEndian.Uint16(data[2:4])
+
+	address, ok := s.registerAddress(start, 1)
+	if !ok {
+		return exception(function, ExceptionIllegalDataAddress)
+	}
+
+	err := s.backend.WriteWords(s.mapping.HoldingRegisterArea, address, []uint16{value})
+	if err != nil {
+		log.Printf("FINS write for register %d failed: %v", start, err)
+		return exception(function, exceptionCode(err))
+	}
+
+	return append([]byte{function}, data...)
+}
+
+func (s *Server) writeMultipleCoils(function byte, data []byte) []byte {
+	if len(data) < 5 {
+		return exception(function, ExceptionIllegalDataValue)
+	}
+	start := binary.BigEndian.Uint16(data[0:2])
+	quantity := binary.BigEndian.Uint16(data[2:4])
+	byteCount := int(data[4])
+	if quantity == 0 || quantity > MAX_WRITE_COILS ||
+		byteCount != (int(quantity)+7)/8 || len(data) != 5+byteCount {
+		return exception(function, ExceptionIllegalDataValue)
+	}
+
+	address, bitOffset, ok := s.coilAddress(start, quantity)
+	if !ok {
+		return exception(function, ExceptionIllegalDataAddress)
+	}
+
+	err := s.backend.WriteBits(s.mapping.CoilArea, address, bitOffset, unpackBits(data[5:], quantity))
+	if err != nil {
+		log.Printf("FINS write for coils %d-%d failed: %v", start, int(start)+int(quantity)-1, err)
+		return exception(function, exceptionCode(err))
+	}
+
+	return append([]byte{function}, data[0:4]...)
+}
+
+func (s *Server) writeMultipleRegisters(function byte, data []byte) []byte {
+	if len(data) < 5 {
+		return exception(function, ExceptionIllegalDataValue)
+	}
+	start := binary.BigEndian.Uint16(data[0:2])
+	quantity := binary.BigEndian.Uint16(data[2:4])
+	byteCount := int(data[4])
+	if quantity == 0 || quantity > MAX_WRITE_REGISTERS ||
+		byteCount != 2*int(quantity) || len(data) != 5+byteCount {
+		return exception(function, ExceptionIllegalDataValue)
+	}
+
+	address, ok := s.registerAddress(start, quantity)
+	if !ok {
+		return exception(function, ExceptionIllegalDataAddress)
+	}
+
+	words := make([]uint16, quantity)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(data[5+i*2 : 7+i*2])
+	}
+
+	err := s.backend.WriteWords(s.mapping.HoldingRegisterArea, address, words)
+	if err != nil {
+		log.Printf("FINS write for registers %d-%d failed: %v", start, int(start)+int(quantity)-1, err)
+		return exception(function, exceptionCode(err))
+	}
+
+	return append([]byte{function}, data[0:4]...)
+}
+
+// registerAddress translates a register range into a FINS word address
+func (s *Server) registerAddress(start, quantity uint16) (uint16, bool) {
+	last := int(s.mapping.HoldingRegisterStart) + int(start) + int(quantity) - 1
+	if last > 0xFFFF {
+		return 0, false
+	}
+	return s.mapping.HoldingRegisterStart + start, true
+}
+
+// coilAddress translates a coil range into a FINS word address and bit offset
+func (s *Server) coilAddress(start, quantity uint16) (uint16, byte, bool) {
+	last := int(start) + int(quantity) - 1
+	if int(s.mapping.CoilStart)+last/16 > 0xFFFF {
+		return 0, 0, false
+	}
+	return s.mapping.CoilStart + start/16, byte(start % 16), true
+}
+
+// exceptionCode maps a failed FINS command to the Modbus exception of its cause: ranges the
+// PLC memory doesn't hold are illegal addresses, more items than a command carries an illegal
+// value, and everything else, e.g. a timeout, is a failure of the PLC
+func exceptionCode(err error) byte {
+	var rangeErr fins.AddressRangeError
+	var countErr fins.CountLimitError
+	var endCodeErr fins.EndCodeError
+	switch {
+	case errors.As(err, &rangeErr):
+		return ExceptionIllegalDataAddress
+	case errors.As(err, &countErr):
+		return ExceptionIllegalDataValue
+	case errors.As(err, &endCodeErr):
+		switch endCodeErr.EndCode {
+		case mapping.EndCodeAddressRangeError, mapping.EndCodeAddressRangeExceeded:
+			return ExceptionIllegalDataAddress
+		}
+	}
+	return ExceptionServerDeviceFailure
+}
+
+func exception(function, code byte) []byte {
+	return []byte{function | 0x80, code}
+}
+
+// packBits packs bools LSB first as Modbus expects
+func packBits(bits []bool) []byte {
+	packed := make([]byte, (len(bits)+7)/8)
+	for i, b := range bits {
+		if b {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+func unpackBits(packed []byte, quantity uint16) []bool {
+	bits := make([]bool, quantity)
+	for i := range bits {
+		bits[i] = packed[i/8]&(1<<(i%8)) != 0
+	}
+	return bits
+}
@@ -0,0 +1,334 @@
+// Package opcua exposes the tag tables of a fins.Manager as an OPC UA address space.
+//
+// gofins doesn't ship an OPC UA stack: AddressSpace is the adapter an embedding OPC UA server
+// plugs into. Register creates the nodes through the Registry the server implements, a
+// folder per PLC holding a variable per tag, and the server forwards the Read and Write
+// services of these nodes to the address space, which reads and writes the PLC.
+//
+// Node IDs are string identifiers in the namespace of the options, "<plc>.<tag>" for tags and
+// "<plc>" for the folders, e.g. ns=2;s=kiln.temp. Values use the OPC UA built-in type of the
+// data type of the tag, writes must pass a value of that type.
+package opcua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"folke99/gofins/fins"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DEFAULT_NAMESPACE = 2
+
+// BuiltinType is the OPC UA built-in data type ID of a variable
+type BuiltinType uint32
+
+const (
+	TypeBoolean BuiltinType = 1
+	TypeInt16   BuiltinType = 4
+	TypeUInt16  BuiltinType = 5
+	TypeInt32   BuiltinType = 6
+	TypeUInt32  BuiltinType = 7
+	TypeFloat   BuiltinType = 10
+	TypeDouble  BuiltinType = 11
+)
+
+// StatusCode is the OPC UA status code of a read or write
+type StatusCode uint32
+
+const (
+	StatusGood                  StatusCode = 0x00000000
+	StatusBadCommunicationError StatusCode = 0x80050000
+	StatusBadUserAccessDenied   StatusCode = 0x801F0000
+	StatusBadNodeIDUnknown      StatusCode = 0x80340000
+	StatusBadNotWritable        StatusCode = 0x803B0000
+	StatusBadTypeMismatch       StatusCode = 0x80740000
+)
+
+// NodeID is a string node identifier in a namespace
+type NodeID struct {
+	Namespace uint16
+	ID        string
+}
+
+func (n NodeID) String() string {
+	return fmt.Sprintf("ns=%d;s=%s", n.Namespace, n.ID)
+}
+
+// ParseNodeID parses a string node ID in the notation of NodeID.String, ns=2;s=kiln.temp
+func ParseNodeID(s string) (NodeID, error) {
+	ns, id, ok := strings.Cut(s, ";s=")
+	if !ok || !strings.HasPrefix(ns, "ns=") {
+		return NodeID{}, fmt.Errorf("invalid string node ID %q", s)
+	}
+	namespace, err := strconv.ParseUint(strings.TrimPrefix(ns, "ns="), 10, 16)
+	if err != nil {
+		return NodeID{}, fmt.Errorf("invalid namespace in node ID %q", s)
+	}
+	return NodeID{Namespace: uint16(namespace), ID: id}, nil
+}
+
+// Node is a node of the address space, a folder of a PLC or a variable of a tag
+type Node struct {
+	ID          NodeID
+	BrowseName  string
+	Parent      *NodeID // The folder of a variable, nil for the folders of the PLCs
+	Folder      bool
+	DataType    BuiltinType // Only set for variables
+	Writable    bool
+	Description string
+}
+
+// DataValue is the result of reading a variable
+type DataValue struct {
+	Value           any // bool, int16, uint16, int32, uint32, float32 or float64 as the DataType
+	Status          StatusCode
+	SourceTimestamp time.Time
+}
+
+// Registry is implemented by the embedding OPC UA server to create the nodes of the address
+// space, folders are added before their variables
+type Registry interface {
+	AddNode(n Node) error
+}
+
+// Options configures an AddressSpace
+type Options struct {
+	// Tags is the tag table per PLC name, every tag becomes a variable
+	Tags map[string][]fins.Tag
+	// Namespace index of the node IDs.
+	// Default value: DEFAULT_NAMESPACE
+	Namespace uint16
+	// ReadOnly makes every variable read-only
+	ReadOnly bool
+	// Authorize decides whether session may write value to tag of plc, a non-nil error rejects
+	// the write with StatusBadUserAccessDenied. session is what the server passed to Write,
+	// e.g. the user identity of the OPC UA session. All writes are authorized when nil.
+	Authorize func(session any, plc string, tag fins.Tag, value float64) error
+}
+
+// AddressSpace maps the tag tables to OPC UA nodes and passes reads and writes on to the PLCs
+type AddressSpace struct {
+	manager *fins.Manager
+	opts    Options
+	plcs    []string
+	tags    map[string]variable
+}
+
+type variable struct {
+	plc string
+	tag fins.Tag
+}
+
+type readPosition struct {
+	plc   string
+	index int
+}
+
+// NewAddressSpace creates the address space of the tag table in opts
+func NewAddressSpace(m *fins.Manager, opts Options) (*AddressSpace, error) {
+	if opts.Namespace == 0 {
+		opts.Namespace = DEFAULT_NAMESPACE
+	}
+	a := &AddressSpace{manager: m, opts: opts, tags: make(map[string]variable)}
+	for plc, tags := range opts.Tags {
+		a.plcs = append(a.plcs, plc)
+		for _, t := range tags {
+			if _, err := builtinType(t.DataType); err != nil {
+				return nil, fmt.Errorf("tag %s of PLC %s: %w", t.Name, plc, err)
+			}
+			id := plc + "." + t.Name
+			if _, ok := a.tags[id]; ok {
+				return nil, fmt.Errorf("duplicate node ID %q", id)
+			}
+			a.tags[id] = variable{plc: plc, tag: t}
+		}
+	}
+	sort.Strings(a.plcs)
+	return a, nil
+}
+
+// Nodes returns the nodes of the address space, the folder of every PLC in name order
+// followed by its variables in the order of its tag table
+func (a *AddressSpace) Nodes() []Node {
+	var nodes []Node
+	for _, plc := range a.plcs {
+		folder := a.nodeID(plc)
+		nodes = append(nodes, Node{ID: folder, BrowseName: plc, Folder: true})
+		for _, t := range a.opts.Tags[plc] {
+			dataType, _ := builtinType(t.DataType)
+			nodes = append(nodes, Node{
+				ID:          a.nodeID(plc + "." + t.Name),
+				BrowseName:  t.Name,
+				Parent:      &folder,
+				DataType:    dataType,
+				Writable:    !a.opts.ReadOnly,
+				Description: string(t.DataType),
+			})
+		}
+	}
+	return nodes
+}
+
+// Register adds the nodes of the address space to the OPC UA server
+func (a *AddressSpace) Register(r Registry) error {
+	for _, n := range a.Nodes() {
+		if err := r.AddNode(n); err != nil {
+			return fmt.Errorf("failed to add node %s: %w", n.ID, err)
+		}
+	}
+	return nil
+}
+
+// Read reads the variables ids from the PLCs, the tags of each PLC in parallel as
+// fins.Manager.ReadAll does. Every ID gets a value, with the status of its read.
+func (a *AddressSpace) Read(ctx context.Context, ids []NodeID) []DataValue {
+	values := make([]DataValue, len(ids))
+	reads := make(map[string][]fins.Tag)
+	// Where the result of each ID is in the reads, nil for unknown IDs
+	positions := make([]*readPosition, len(ids))
+	for i, id := range ids {
+		v, ok := a.variable(id)
+		if !ok {
+			values[i].Status = StatusBadNodeIDUnknown
+			continue
+		}
+		positions[i] = &readPosition{plc: v.plc, index: len(reads[v.plc])}
+		reads[v.plc] = append(reads[v.plc], v.tag)
+	}
+
+	results, _ := a.manager.ReadAll(ctx, reads)
+	now := time.Now()
+	for i, p := range positions {
+		if p == nil {
+			continue
+		}
+		result := results[p.plc][p.index]
+		values[i].SourceTimestamp = now
+		if result.Err != nil {
+			values[i].Status = StatusBadCommunicationError
+			continue
+		}
+		values[i].Value = toBuiltin(result.Tag.DataType, result.Value)
+	}
+	return values
+}
+
+// Write writes value to the variable id, value must have the Go type of its DataType.
+// session is passed on to Authorize. Authorize, the client write guard and audit trail apply.
+func (a *AddressSpace) Write(session any, id NodeID, value any) StatusCode {
+	v, ok := a.variable(id)
+	if !ok {
+		return StatusBadNodeIDUnknown
+	}
+	if a.opts.ReadOnly {
+		return StatusBadNotWritable
+	}
+	f, ok := fromBuiltin(v.tag.DataType, value)
+	if !ok {
+		return StatusBadTypeMismatch
+	}
+	if authorize := a.opts.Authorize; authorize != nil {
+		if err := authorize(session, v.plc, v.tag, f); err != nil {
+			return StatusBadUserAccessDenied
+		}
+	}
+	client, ok := a.manager.Client(v.plc)
+	if !ok {
+		return StatusBadCommunicationError
+	}
+	if err := client.WriteTag(v.tag, f); err != nil {
+		var denied fins.WriteDeniedError
+		if errors.As(err, &denied) {
+			return StatusBadUserAccessDenied
+		}
+		return StatusBadCommunicationError
+	}
+	return StatusGood
+}
+
+func (a *AddressSpace) nodeID(id string) NodeID {
+	return NodeID{Namespace: a.opts.Namespace, ID: id}
+}
+
+func (a *AddressSpace) variable(id NodeID) (variable, bool) {
+	if id.Namespace != a.opts.Namespace {
+		return variable{}, false
+	}
+	v, ok := a.tags[id.ID]
+	return v, ok
+}
+
+func builtinType(d fins.DataType) (BuiltinType, error) {
+	switch d {
+	case fins.DataTypeBool:
+		return TypeBoolean, nil
+	case fins.DataTypeInt:
+		return TypeInt16, nil
+	case fins.DataTypeUint:
+		return TypeUInt16, nil
+	case fins.DataTypeDint:
+		return TypeInt32, nil
+	case fins.DataTypeUdint:
+		return TypeUInt32, nil
+	case fins.DataTypeReal:
+		return TypeFloat, nil
+	case fins.DataTypeLreal:
+		return TypeDouble, nil
+	default:
+		return 0, fmt.Errorf("unsupported data type: %q", d)
+	}
+}
+
+// toBuiltin converts a tag value to the Go type of the OPC UA built-in type
+func toBuiltin(d fins.DataType, v float64) any {
+	switch d {
+	case fins.DataTypeBool:
+		return v != 0
+	case fins.DataTypeInt:
+		return int16(v)
+	case fins.DataTypeUint:
+		return uint16(v)
+	case fins.DataTypeDint:
+		return int32(v)
+	case fins.DataTypeUdint:
+		return uint32(v)
+	case fins.DataTypeReal:
+		return float32(v)
+	default:
+		return v
+	}
+}
+
+// fromBuiltin converts a written value to a tag value, it fails when the Go type doesn't
+// match the built-in type of the data type
+func fromBuiltin(d fins.DataType, v any) (float64, bool) {
+	switch value := v.(type) {
+	case bool:
+		if d != fins.DataTypeBool {
+			return 0, false
+		}
+		if value {
+			return 1, true
+		}
+		return 0, true
+	case int16:
+		return float64(value), d == fins.DataTypeInt
+	case uint16:
+		return float64(value), d == fins.DataTypeUint
+	case int32:
+		return float64(value), d == fins.DataTypeDint
+	case uint32:
+		return float64(value), d == fins.DataTypeUdint
+	case float32:
+		return float64(value), d == fins.DataTypeReal && !math.IsNaN(float64(value))
+	case float64:
+		return value, d == fins.DataTypeLreal && !math.IsNaN(value)
+	default:
+		return 0, false
+	}
+}
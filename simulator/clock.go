@@ -0,0 +1,104 @@
+package simulator
+
+import (
+	"fmt"
+	"folke99/gofins/finsproto"
+	"time"
+)
+
+// virtualClock is the PLC clock of the simulator. It runs from base, set at the host time
+// ref, at 1+drift times the speed of the host clock, or stands still while held.
+type virtualClock struct {
+	base  time.Time
+	ref   time.Time
+	drift float64
+	held  bool
+}
+
+// now returns the time of the PLC clock, the caller holds the lock
+func (c *virtualClock) now() time.Time {
+	host := time.Now()
+	if c.ref.IsZero() {
+		return host
+	}
+	if c.held {
+		return c.base
+	}
+	elapsed := host.Sub(c.ref)
+	return c.base.Add(elapsed + time.Duration(float64(elapsed)*c.drift))
+}
+
+// set restarts the clock at t, the caller holds the lock
+func (c *virtualClock) set(t time.Time) {
+	c.base, c.ref = t, time.Now()
+}
+
+// Clock returns the current time of the simulated PLC clock
+func (s *Server) Clock() time.Time {
+	s.Lock()
+	defer s.Unlock()
+	return s.clock.now()
+}
+
+// SetClock sets the simulated PLC clock to t, keeping its drift
+func (s *Server) SetClock(t time.Time) {
+	s.Lock()
+	s.clock.set(t)
+	s.Unlock()
+}
+
+// SetClockDrift makes the simulated PLC clock run fast by drift (slow when negative) relative
+// to the host clock, e.g. 100e-6 gains 8.64s a day
+func (s *Server) SetClockDrift(drift float64) {
+	s.Lock()
+	s.clock.set(s.clock.now())
+	s.clock.drift = drift
+	s.Unlock()
+}
+
+// HoldClock stops the simulated PLC clock at its current time, or lets it run again, so
+// tests read deterministic times. A clock write while held sets the time it stands at.
+func (s *Server) HoldClock(hold bool) {
+	s.Lock()
+	s.clock.set(s.clock.now())
+	s.clock.held = hold
+	s.Unlock()
+}
+
+// clockData returns the clock read data: year, month, day, hour, minute, second and day of week in BCD
+func clockData(t time.Time) []byte {
+	return []byte{
+		finsproto.EncodeBCDByte(t.Year() % 100),
+		finsproto.EncodeBCDByte(int(t.Month())),
+		finsproto.EncodeBCDByte(t.Day()),
+		finsproto.EncodeBCDByte(t.Hour()),
+		finsproto.EncodeBCDByte(t.Minute()),
+		finsproto.EncodeBCDByte(t.Second()),
+		finsproto.EncodeBCDByte(int(t.Weekday())),
+	}
+}
+
+// decodeClock decodes the clock write data, in local time. The seconds and the day of week
+// may be omitted, the seconds are zero then.
+func decodeClock(data []byte) (time.Time, error) {
+	if len(data) < 5 {
+		return time.Time{}, fmt.Errorf("expected at least 5 bytes, got %d", len(data))
+	}
+	var v [6]int
+	for i := range min(len(data), len(v)) {
+		d, err := finsproto.DecodeBCD(data[i : i+1])
+		if err != nil {
+			return time.Time{}, err
+		}
+		v[i] = int(d)
+	}
+	year := 1900 + v[0]
+	if v[0] < 50 {
+		year = 2000 + v[0]
+	}
+	t := time.Date(year, time.Month(v[1]), v[2], v[3], v[4], v[5], 0, time.Local)
+	if int(t.Month()) != v[1] || t.Day() != v[2] || t.Hour() != v[3] || t.Minute() != v[4] || t.Second() != v[5] {
+		return time.Time{}, fmt.Errorf("invalid date and time %02d-%02d-%02d %02d:%02d:%02d", v[0], v[1], v[2], v[3], v[4], v[5])
+	}
+	return t, nil
+}
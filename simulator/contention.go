@@ -0,0 +1,63 @@
+package simulator
+
+import (
+	"folke99/gofins/mapping"
+	"time"
+)
+
+// Contention makes the simulator reject writes that collide with the write of another client,
+// like a PLC whose access right or communication buffer is held by another node. A write
+// reserves its DM words for the writing node for Window, writes of other nodes touching
+// them in that time fail with EndCode.
+type Contention struct {
+	Window  time.Duration
+	EndCode uint16 // EndCodeAccessWriteErrorNoAccessRight when zero, e.g. EndCodeDestinationNodeBusy
+}
+
+// reservation is the range of DM words a node wrote last
+type reservation struct {
+	node   byte
+	first  uint16
+	count  int
+	expiry time.Time
+}
+
+// SetContention enables write contention between clients, nil disables it
+func (s *Server) SetContention(c *Contention) {
+	s.Lock()
+	defer s.Unlock()
+	s.contention = nil
+	s.reservations = nil
+	if c != nil {
+		cc := *c
+		if cc.EndCode == 0 {
+			cc.EndCode = mapping.EndCodeAccessWriteErrorNoAccessRight
+		}
+		s.contention = &cc
+	}
+}
+
+// contentionEndCode reserves count DM words starting at address for a write of node and returns
+// the end code of a collision with the write of another node, or EndCodeNormalCompletion.
+// The caller holds the lock.
+func (s *Server) contentionEndCode(node byte, address uint16, count int) uint16 {
+	if s.contention == nil {
+		return mapping.EndCodeNormalCompletion
+	}
+	now := time.Now()
+	kept := s.reservations[:0]
+	for _, r := range s.reservations {
+		if now.Before(r.expiry) {
+			kept = append(kept, r)
+		}
+	}
+	s.reservations = kept
+
+	for _, r := range s.reservations {
+		if r.node != node && int(address) < int(r.first)+r.count && int(address)+count > int(r.first) {
+			return s.contention.EndCode
+		}
+	}
+	s.reservations = append(s.reservations, reservation{node: node, first: address, count: count, expiry: now.Add(s.contention.Window)})
+	return mapping.EndCodeNormalCompletion
+}
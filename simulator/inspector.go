@@ -0,0 +1,301 @@
+package simulator
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"folke99/gofins/finsproto"
+	"html/template"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	INSPECTOR_LOG_SIZE     = 200 // Requests kept for the inspector
+	INSPECTOR_MAX_WORDS    = 1000
+	INSPECTOR_DEFAULT_VIEW = 32
+)
+
+// ClientInfo describes a connected client
+type ClientInfo struct {
+	Addr      string    `json:"addr"`
+	Node      byte      `json:"node"`
+	Connected time.Time `json:"connected"`
+	Requests  int       `json:"requests"`
+}
+
+// RequestLogEntry is a request handled by the simulator
+type RequestLogEntry struct {
+	Time        time.Time `json:"time"`
+	Client      string    `json:"client"`
+	CommandCode uint16    `json:"commandCode"`
+	EndCode     uint16    `json:"endCode"`
+	DataLength  int       `json:"dataLength"`
+}
+
+// Clients returns the connected clients ordered by connection time
+func (s *Server) Clients() []ClientInfo {
+	s.Lock()
+	defer s.Unlock()
+
+	clients := make([]ClientInfo, 0, len(s.clients))
+	for _, c := range s.clients {
+		clients = append(clients, *c)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Connected.Before(clients[j].Connected) })
+	return clients
+}
+
+// RequestLog returns the last INSPECTOR_LOG_SIZE requests, oldest first
+func (s *Server) RequestLog() []RequestLogEntry {
+	s.Lock()
+	defer s.Unlock()
+	return append([]RequestLogEntry(nil), s.requestLog...)
+}
+
+// ReadDM returns count DM words starting at address
+func (s *Server) ReadDM(address uint16, count int) ([]uint16, error) {
+	if count < 0 || int(address)+count > DM_AREA_SIZE {
+		return nil, fmt.Errorf("DM range %d+%d exceeds the area", address, count)
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	words := make([]uint16, count)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(s.dmarea[(int(address)+i)*2:])
+	}
+	return words, nil
+}
+
+// WriteDM sets the DM words starting at address
+func (s *Server) WriteDM(address uint16, words []uint16) error {
+	if int(address)+len(words) > DM_AREA_SIZE {
+		return fmt.Errorf("DM range %d+%d exceeds the area", address, len(words))
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	for i, w := range words {
+		binary.BigEndian.PutUint16(s.dmarea[(int(address)+i)*2:], w)
+	}
+	return nil
+}
+
+// ReadDMLreal returns the LREAL stored in the four DM words starting at address, low word first
+func (s *Server) ReadDMLreal(address uint16) (float64, error) {
+	words, err := s.ReadDM(address, 4)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(uint64(words[3])<<48 | uint64(words[2])<<32 | uint64(words[1])<<16 | uint64(words[0])), nil
+}
+
+// WriteDMLreal stores an LREAL in the four DM words starting at address, low word first
+func (s *Server) WriteDMLreal(address uint16, value float64) error {
+	bits := math.Float64bits(value)
+	return s.WriteDM(address, []uint16{uint16(bits), uint16(bits >> 16), uint16(bits >> 32), uint16(bits >> 48)})
+}
+
+func (s *Server) clientConnected(conn net.Conn) {
+	s.Lock()
+	s.clients[conn] = &ClientInfo{Addr: conn.RemoteAddr().String(), Connected: time.Now()}
+	s.Unlock()
+}
+
+func (s *Server) clientDisconnected(conn net.Conn) {
+	s.Lock()
+	delete(s.clients, conn)
+	s.Unlock()
+}
+
+func (s *Server) logRequest(conn net.Conn, req finsproto.Request, resp finsproto.Response) {
+	s.Lock()
+	defer s.Unlock()
+
+	entry := RequestLogEntry{
+		Time:        time.Now(),
+		Client:      conn.RemoteAddr().String(),
+		CommandCode: req.GetCommandCode(),
+		EndCode:     resp.EndCode,
+		DataLength:  len(req.GetData()),
+	}
+	if c, ok := s.clients[conn]; ok {
+		c.Node = req.GetHeader().SA1
+		c.Requests++
+	}
+	if len(s.requestLog) == INSPECTOR_LOG_SIZE {
+		s.requestLog = append(s.requestLog[:0], s.requestLog[1:]...)
+	}
+	s.requestLog = append(s.requestLog, entry)
+}
+
+// Inspector returns an HTTP handler to view and edit the DM area, see the connected
+// clients and the request log in a browser. JSON is served under /api/clients, /api/log
+// and /api/memory?address=D100&count=16, POST /api/memory with {"address":"D100","values":[1,2]} writes words.
+func (s *Server) Inspector() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/clients", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.Clients())
+	})
+	mux.HandleFunc("GET /api/log", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.RequestLog())
+	})
+	mux.HandleFunc("GET /api/memory", func(w http.ResponseWriter, r *http.Request) {
+		address, count, err := memoryQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		words, err := s.ReadDM(address, count)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, words)
+	})
+	mux.HandleFunc("POST /api/memory", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Address string   `json:"address"`
+			Values  []uint16 `json:"values"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.writeDMAddress(body.Address, body.Values); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /memory", func(w http.ResponseWriter, r *http.Request) {
+		value, err := strconv.ParseUint(r.FormValue("value"), 0, 16)
+		if err == nil {
+			err = s.writeDMAddress(r.FormValue("address"), []uint16{uint16(value)})
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/?address="+r.FormValue("view"), http.StatusSeeOther)
+	})
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		address, count, err := memoryQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		words, _ := s.ReadDM(address, min(count, DM_AREA_SIZE-int(address)))
+		rows := make([]inspectorRow, len(words))
+		for i, word := range words {
+			rows[i] = inspectorRow{Address: fmt.Sprintf("D%d", int(address)+i), Value: word}
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		inspectorPage.Execute(w, inspectorData{
+			View:    fmt.Sprintf("D%d", address),
+			Count:   count,
+			Memory:  rows,
+			Clients: s.Clients(),
+			Log:     s.RequestLog(),
+		})
+	})
+	return mux
+}
+
+// StartInspector serves the inspector on address until the simulator is closed
+func (s *Server) StartInspector(address string) (*net.TCPAddr, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: s.Inspector()}
+
+	s.Lock()
+	s.inspector = server
+	s.Unlock()
+
+	go server.Serve(listener)
+	return listener.Addr().(*net.TCPAddr), nil
+}
+
+func (s *Server) writeDMAddress(address string, words []uint16) error {
+	start, err := parseDMAddress(address)
+	if err != nil {
+		return err
+	}
+	return s.WriteDM(start, words)
+}
+
+// memoryQuery parses the address and count query parameters, D0 and INSPECTOR_DEFAULT_VIEW by default
+func memoryQuery(r *http.Request) (uint16, int, error) {
+	address, count := uint16(0), INSPECTOR_DEFAULT_VIEW
+	if a := r.URL.Query().Get("address"); a != "" {
+		var err error
+		if address, err = parseDMAddress(a); err != nil {
+			return 0, 0, err
+		}
+	}
+	if c := r.URL.Query().Get("count"); c != "" {
+		n, err := strconv.Atoi(c)
+		if err != nil || n <= 0 || n > INSPECTOR_MAX_WORDS {
+			return 0, 0, fmt.Errorf("count must be between 1 and %d", INSPECTOR_MAX_WORDS)
+		}
+		count = n
+	}
+	return address, count, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+type inspectorRow struct {
+	Address string
+	Value   uint16
+}
+
+type inspectorData struct {
+	View    string
+	Count   int
+	Memory  []inspectorRow
+	Clients []ClientInfo
+	Log     []RequestLogEntry
+}
+
+var inspectorPage = template.Must(template.New("inspector").Funcs(template.FuncMap{
+	"hex": func(v uint16) string { return fmt.Sprintf("0x%04X", v) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><title>FINS simulator</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:2px 8px;text-align:right}</style>
+</head>
+<body>
+<h1>FINS simulator</h1>
+<h2>Memory</h2>
+<form method="get" action="/">
+<input name="address" value="{{.View}}"> <input name="count" value="{{.Count}}"> <button>Show</button>
+</form>
+<table>
+<tr><th>Address</th><th>Value</th><th>Hex</th><th>Edit</th></tr>
+{{range .Memory}}<tr><td>{{.Address}}</td><td>{{.Value}}</td><td>{{hex .Value}}</td>
+<td><form method="post" action="/memory"><input type="hidden" name="view" value="{{$.View}}"><input type="hidden" name="address" value="{{.Address}}"><input name="value" size="6"> <button>Set</button></form></td></tr>
+{{end}}</table>
+<h2>Clients</h2>
+<table>
+<tr><th>Address</th><th>Node</th><th>Connected</th><th>Requests</th></tr>
+{{range .Clients}}<tr><td>{{.Addr}}</td><td>{{.Node}}</td><td>{{.Connected.Format "15:04:05"}}</td><td>{{.Requests}}</td></tr>
+{{end}}</table>
+<h2>Requests</h2>
+<table>
+<tr><th>Time</th><th>Client</th><th>Command</th><th>End code</th><th>Data bytes</th></tr>
+{{range .Log}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Client}}</td><td>{{hex .CommandCode}}</td><td>{{hex .EndCode}}</td><td>{{.DataLength}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
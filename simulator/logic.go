@@ -0,0 +1,119 @@
+package simulator
+
+import (
+	"encoding/binary"
+	"folke99/gofins/mapping"
+	"math"
+	"time"
+)
+
+// ScanFunc is the user program of the simulator. It runs every scan while the simulator is in
+// RUN or MONITOR mode and mutates memory through the scan, e.g. to ramp an analog value or
+// toggle a heartbeat bit. Client commands are served between scans, never during one.
+type ScanFunc func(scan *Scan)
+
+// Scan gives a ScanFunc access to the simulator memory during one scan. It must not be used
+// after the ScanFunc returned.
+type Scan struct {
+	Cycle   uint64        // Scans run since the logic was set, starting at 1
+	Elapsed time.Duration // Time since the logic was set
+	Delta   time.Duration // Time since the previous scan
+
+	s *Server
+}
+
+// Mode returns the operating mode of the simulator
+func (sc *Scan) Mode() mapping.ModeCode {
+	return sc.s.mode
+}
+
+// Word returns a DM word, 0 outside the area
+func (sc *Scan) Word(address uint16) uint16 {
+	if int(address) >= DM_AREA_SIZE {
+		return 0
+	}
+	return binary.BigEndian.Uint16(sc.s.dmarea[int(address)*2:])
+}
+
+// SetWord sets a DM word, addresses outside the area are ignored
+func (sc *Scan) SetWord(address uint16, value uint16) {
+	if int(address) < DM_AREA_SIZE {
+		binary.BigEndian.PutUint16(sc.s.dmarea[int(address)*2:], value)
+	}
+}
+
+// Bit returns bit 0 to 15 of a DM word
+func (sc *Scan) Bit(address uint16, bit byte) bool {
+	return sc.Word(address)&(1<<(bit&0x0F)) != 0
+}
+
+// SetBit sets or clears bit 0 to 15 of a DM word
+func (sc *Scan) SetBit(address uint16, bit byte, value bool) {
+	w := sc.Word(address) &^ (1 << (bit & 0x0F))
+	if value {
+		w |= 1 << (bit & 0x0F)
+	}
+	sc.SetWord(address, w)
+}
+
+// Real returns the REAL stored in the two DM words starting at address, low word first
+func (sc *Scan) Real(address uint16) float32 {
+	return math.Float32frombits(uint32(sc.Word(address+1))<<16 | uint32(sc.Word(address)))
+}
+
+// SetReal stores a REAL in the two DM words starting at address, low word first
+func (sc *Scan) SetReal(address uint16, value float32) {
+	bits := math.Float32bits(value)
+	sc.SetWord(address, uint16(bits))
+	sc.SetWord(address+1, uint16(bits>>16))
+}
+
+// SetScanLogic runs logic every scan, DEFAULT_SCAN_TIME when scan is zero, replacing the
+// logic set before. A nil logic stops it.
+func (s *Server) SetScanLogic(scan time.Duration, logic ScanFunc) {
+	if scan <= 0 {
+		scan = DEFAULT_SCAN_TIME
+	}
+
+	s.Lock()
+	if s.logicDone != nil {
+		close(s.logicDone)
+		s.logicDone = nil
+	}
+	if logic == nil {
+		s.Unlock()
+		return
+	}
+	done := make(chan struct{})
+	s.logicDone = done
+	s.Unlock()
+
+	go s.runLogic(scan, logic, done)
+}
+
+func (s *Server) runLogic(scan time.Duration, logic ScanFunc, done chan struct{}) {
+	ticker := time.NewTicker(scan)
+	defer ticker.Stop()
+
+	started := time.Now()
+	previous := started
+	var cycle uint64
+	for {
+		var now time.Time
+		select {
+		case <-done:
+			return
+		case now = <-ticker.C:
+		}
+
+		s.Lock()
+		if s.mode == mapping.ModeProgram {
+			s.Unlock()
+			continue
+		}
+		cycle++
+		logic(&Scan{Cycle: cycle, Elapsed: now.Sub(started), Delta: now.Sub(previous), s: s})
+		s.Unlock()
+		previous = now
+	}
+}
@@ -0,0 +1,71 @@
+package simulator
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Latency is a distribution of artificial response delays
+type Latency interface {
+	Delay() time.Duration
+}
+
+// FixedLatency delays every response by the same duration
+type FixedLatency time.Duration
+
+func (l FixedLatency) Delay() time.Duration {
+	return time.Duration(l)
+}
+
+// UniformLatency delays responses by a duration uniformly distributed between Min and Max
+type UniformLatency struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+func (l UniformLatency) Delay() time.Duration {
+	if l.Max <= l.Min {
+		return l.Min
+	}
+	return l.Min + rand.N(l.Max-l.Min)
+}
+
+// NormalLatency delays responses by a normally distributed duration, negative samples are 0
+type NormalLatency struct {
+	Mean   time.Duration
+	StdDev time.Duration
+}
+
+func (l NormalLatency) Delay() time.Duration {
+	return max(0, l.Mean+time.Duration(rand.NormFloat64()*float64(l.StdDev)))
+}
+
+// SetLatency delays every FINS response by a sample of l, nil disables the delay.
+// Requests on one connection are answered in order, so delays add up under pipelining like on a busy PLC.
+func (s *Server) SetLatency(l Latency) {
+	s.Lock()
+	s.latency = l
+	s.Unlock()
+}
+
+// SetPacketLoss drops the given fraction (0 to 1) of FINS requests without answering them
+func (s *Server) SetPacketLoss(rate float64) {
+	s.Lock()
+	s.packetLoss = rate
+	s.Unlock()
+}
+
+// networkConditions returns the delay of the next response and whether its request is dropped
+func (s *Server) networkConditions() (time.Duration, bool) {
+	s.Lock()
+	latency, loss := s.latency, s.packetLoss
+	s.Unlock()
+
+	if loss > 0 && rand.Float64() < loss {
+		return 0, true
+	}
+	if latency == nil {
+		return 0, false
+	}
+	return latency.Delay(), false
+}
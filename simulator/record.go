@@ -0,0 +1,261 @@
+package simulator
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"folke99/gofins/finsproto"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Exchange is a recorded request and the response of the PLC, stored one JSON object per line
+type Exchange struct {
+	Time         time.Time     `json:"time"`
+	CommandCode  uint16        `json:"commandCode"`
+	Request      []byte        `json:"request"` // Command data after the command code
+	EndCode      uint16        `json:"endCode"`
+	Response     []byte        `json:"response"` // Response data after the end code
+	ResponseTime time.Duration `json:"responseTime"`
+}
+
+// Proxy forwards FINS/TCP connections to a PLC and records every request/response pair.
+// Each client connection gets its own connection to the PLC, frames are passed on unchanged.
+type Proxy struct {
+	sync.Mutex
+	listener   net.Listener
+	plcAddress string
+	recording  *json.Encoder
+	closed     bool
+	conns      map[net.Conn]struct{}
+	wg         sync.WaitGroup
+}
+
+// pendingRequest is a request waiting for the PLC response
+type pendingRequest struct {
+	request finsproto.Request
+	sent    time.Time
+}
+
+// NewProxy listens on address and forwards connections to the PLC at plcAddress,
+// writing the exchanges to recording
+func NewProxy(address, plcAddress string, recording io.Writer) (*Proxy, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	p := &Proxy{
+		listener:   listener,
+		plcAddress: plcAddress,
+		recording:  json.NewEncoder(recording),
+		conns:      make(map[net.Conn]struct{}),
+	}
+	go p.acceptConnections()
+	return p, nil
+}
+
+// Addr returns the address the proxy is listening on
+func (p *Proxy) Addr() *net.TCPAddr {
+	return p.listener.Addr().(*net.TCPAddr)
+}
+
+// Close stops the proxy, closes all forwarded connections and waits until the
+// exchanges in flight are recorded
+func (p *Proxy) Close() error {
+	p.Lock()
+	p.closed = true
+	for conn := range p.conns {
+		conn.Close()
+	}
+	err := p.listener.Close()
+	p.Unlock()
+
+	p.wg.Wait()
+	return err
+}
+
+func (p *Proxy) acceptConnections() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			p.Lock()
+			closed := p.closed
+			p.Unlock()
+			if closed {
+				return
+			}
+			log.Println("Error accepting proxy connection:", err)
+			continue
+		}
+		p.Lock()
+		if p.closed {
+			p.Unlock()
+			conn.Close()
+			return
+		}
+		p.wg.Add(1)
+		p.Unlock()
+		go func() {
+			defer p.wg.Done()
+			p.forward(conn)
+		}()
+	}
+}
+
+func (p *Proxy) forward(client net.Conn) {
+	plc, err := net.DialTimeout("tcp", p.plcAddress, 5*time.Second)
+	if err != nil {
+		log.Printf("Proxy failed to connect to the PLC: %v", err)
+		client.Close()
+		return
+	}
+	if !p.track(client, plc) {
+		return
+	}
+	defer p.untrack(client, plc)
+
+	var mu sync.Mutex
+	pending := make(map[byte]pendingRequest)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// A disconnected client ends the PLC connection too, which stops the loop below
+		defer plc.Close()
+		// Every byte read from the client is passed on to the PLC as it is read
+		r := io.TeeReader(bufio.NewReader(client), plc)
+		for {
+			command, payload, err := finsproto.ReadTCPFrame(r)
+			if err != nil {
+				return
+			}
+			if command != finsproto.TCP_COMMAND_FRAME_SEND {
+				continue
+			}
+			if req, err := finsproto.DecodeRequest(payload); err == nil {
+				mu.Lock()
+				pending[req.Header.SID] = pendingRequest{request: req, sent: time.Now()}
+				mu.Unlock()
+			}
+		}
+	}()
+
+	r := io.TeeReader(bufio.NewReader(plc), client)
+	for {
+		command, payload, err := finsproto.ReadTCPFrame(r)
+		if err != nil {
+			break
+		}
+		if command != finsproto.TCP_COMMAND_FRAME_SEND {
+			continue
+		}
+		resp, err := finsproto.DecodeResponse(payload)
+		if err != nil {
+			continue
+		}
+		mu.Lock()
+		req, ok := pending[resp.Header.SID]
+		delete(pending, resp.Header.SID)
+		mu.Unlock()
+		if ok && req.request.CommandCode == resp.CommandCode {
+			p.record(req, resp)
+		}
+	}
+
+	client.Close()
+	plc.Close()
+	<-done
+}
+
+func (p *Proxy) track(conns ...net.Conn) bool {
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		for _, conn := range conns {
+			conn.Close()
+		}
+		return false
+	}
+	for _, conn := range conns {
+		p.conns[conn] = struct{}{}
+	}
+	return true
+}
+
+func (p *Proxy) untrack(conns ...net.Conn) {
+	p.Lock()
+	defer p.Unlock()
+	for _, conn := range conns {
+		delete(p.conns, conn)
+	}
+}
+
+func (p *Proxy) record(req pendingRequest, resp finsproto.Response) {
+	p.Lock()
+	defer p.Unlock()
+
+	err := p.recording.Encode(Exchange{
+		Time:         req.sent,
+		CommandCode:  req.request.CommandCode,
+		Request:      req.request.Data,
+		EndCode:      resp.EndCode,
+		Response:     resp.Data,
+		ResponseTime: time.Since(req.sent),
+	})
+	if err != nil {
+		log.Printf("Failed to record exchange: %v", err)
+	}
+}
+
+// ReadRecording decodes the exchanges written by a Proxy
+func ReadRecording(r io.Reader) ([]Exchange, error) {
+	var exchanges []Exchange
+	dec := json.NewDecoder(r)
+	for {
+		var e Exchange
+		if err := dec.Decode(&e); err == io.EOF {
+			return exchanges, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid recording after %d exchanges: %w", len(exchanges), err)
+		}
+		exchanges = append(exchanges, e)
+	}
+}
+
+// Replay answers requests matching a recorded exchange with the recorded response.
+// Identical requests get the recorded responses in order, repeating the last one, so a polled
+// address plays back the values seen on the real PLC. Other requests are handled by the simulator.
+func (s *Server) Replay(exchanges []Exchange) {
+	replay := make(map[string][]Exchange)
+	for _, e := range exchanges {
+		key := replayKey(e.CommandCode, e.Request)
+		replay[key] = append(replay[key], e)
+	}
+
+	s.Lock()
+	s.replay = replay
+	s.Unlock()
+}
+
+// replayResponse returns the next recorded response for a request
+func (s *Server) replayResponse(r finsproto.Request) (Exchange, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	key := replayKey(r.CommandCode, r.Data)
+	queue := s.replay[key]
+	if len(queue) == 0 {
+		return Exchange{}, false
+	}
+	if len(queue) > 1 {
+		s.replay[key] = queue[1:]
+	}
+	return queue[0], true
+}
+
+func replayKey(commandCode uint16, data []byte) string {
+	return fmt.Sprintf("%04X:%X", commandCode, data)
+}
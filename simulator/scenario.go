@@ -0,0 +1,265 @@
+package simulator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"folke99/gofins/mapping"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const DEFAULT_SCAN_TIME = 100 * time.Millisecond
+
+// Scenario scripts simulator behaviour, usually loaded from a YAML file:
+//
+//	scan: 50ms
+//	endCodes:
+//	  - {from: D100, to: D199, endCode: 0x2002, commands: [read]}
+//	readOnly:
+//	  - {from: D0, to: D99}
+//	counters:
+//	  - {address: D500, step: 1}
+//	modes:
+//	  - {after: 2s, mode: program}
+//	  - {after: 5s, mode: run}
+//
+// Addresses are in Omron notation and refer to the DM area, the only area the simulator has.
+type Scenario struct {
+	Scan     time.Duration    `yaml:"scan"` // Interval of the counter increments, DEFAULT_SCAN_TIME by default
+	EndCodes []EndCodeRange   `yaml:"endCodes"`
+	ReadOnly []AddressRange   `yaml:"readOnly"`
+	Counters []Counter        `yaml:"counters"`
+	Modes    []ModeTransition `yaml:"modes"`
+}
+
+// AddressRange is an inclusive range of DM words, To defaults to From
+type AddressRange struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+
+	first, last uint16
+}
+
+// EndCodeRange answers memory area commands touching the range with EndCode
+type EndCodeRange struct {
+	AddressRange `yaml:",inline"`
+	EndCode      uint16   `yaml:"endCode"`
+	Commands     []string `yaml:"commands"` // "read" and/or "write", both when empty
+}
+
+// Counter adds Step to a DM word every scan
+type Counter struct {
+	Address string `yaml:"address"`
+	Step    int    `yaml:"step"` // 1 when zero
+
+	address uint16
+}
+
+// ModeTransition switches the operating mode After the scenario started.
+// Modes are run, monitor, program and standby.
+type ModeTransition struct {
+	After time.Duration `yaml:"after"`
+	Mode  string        `yaml:"mode"`
+}
+
+var scenarioModes = map[string]struct {
+	status mapping.StatusCode
+	mode   mapping.ModeCode
+}{
+	"run":     {mapping.StatusRun, mapping.ModeRun},
+	"monitor": {mapping.StatusRun, mapping.ModeMonitor},
+	"program": {mapping.StatusStop, mapping.ModeProgram},
+	"standby": {mapping.StatusStandby, mapping.ModeRun},
+}
+
+// LoadScenario reads a scenario from a YAML file
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScenario(data)
+}
+
+// ParseScenario decodes and validates a YAML scenario
+func ParseScenario(data []byte) (*Scenario, error) {
+	var sc Scenario
+	if err := yaml.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %w", err)
+	}
+	if err := sc.validate(); err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+func (sc *Scenario) validate() error {
+	if sc.Scan <= 0 {
+		sc.Scan = DEFAULT_SCAN_TIME
+	}
+	for i := range sc.EndCodes {
+		if err := sc.EndCodes[i].parse(); err != nil {
+			return err
+		}
+		for _, c := range sc.EndCodes[i].Commands {
+			if c != "read" && c != "write" {
+				return fmt.Errorf("invalid scenario command %q, expected read or write", c)
+			}
+		}
+	}
+	for i := range sc.ReadOnly {
+		if err := sc.ReadOnly[i].parse(); err != nil {
+			return err
+		}
+	}
+	for i := range sc.Counters {
+		address, err := parseDMAddress(sc.Counters[i].Address)
+		if err != nil {
+			return err
+		}
+		sc.Counters[i].address = address
+		if sc.Counters[i].Step == 0 {
+			sc.Counters[i].Step = 1
+		}
+	}
+	for _, m := range sc.Modes {
+		if _, ok := scenarioModes[strings.ToLower(m.Mode)]; !ok {
+			return fmt.Errorf("invalid scenario mode %q", m.Mode)
+		}
+	}
+	return nil
+}
+
+func (r *AddressRange) parse() error {
+	var err error
+	if r.first, err = parseDMAddress(r.From); err != nil {
+		return err
+	}
+	r.last = r.first
+	if r.To != "" {
+		if r.last, err = parseDMAddress(r.To); err != nil {
+			return err
+		}
+	}
+	if r.last < r.first {
+		return fmt.Errorf("invalid scenario range %s-%s", r.From, r.To)
+	}
+	return nil
+}
+
+// overlaps returns true if any of the count words starting at address is in the range
+func (r AddressRange) overlaps(address uint16, count int) bool {
+	return int(address) <= int(r.last) && int(address)+count > int(r.first)
+}
+
+func (r EndCodeRange) applies(write bool) bool {
+	if len(r.Commands) == 0 {
+		return true
+	}
+	for _, c := range r.Commands {
+		if (c == "write") == write {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDMAddress(s string) (uint16, error) {
+	area, address, bit, err := mapping.ParseAddress(s)
+	if err != nil {
+		return 0, err
+	}
+	if area != mapping.MemoryAreaDMWord || bit >= 0 || address >= DM_AREA_SIZE {
+		return 0, fmt.Errorf("invalid scenario address %q, expected a DM word", s)
+	}
+	return address, nil
+}
+
+// RunScenario applies sc to the simulator, replacing a running scenario.
+// Counters and mode transitions start now, a nil scenario stops the running one.
+func (s *Server) RunScenario(sc *Scenario) error {
+	if sc != nil {
+		if err := sc.validate(); err != nil {
+			return err
+		}
+	}
+
+	s.Lock()
+	if s.scenarioDone != nil {
+		close(s.scenarioDone)
+		s.scenarioDone = nil
+	}
+	s.scenario = sc
+	if sc == nil {
+		s.Unlock()
+		return nil
+	}
+	done := make(chan struct{})
+	s.scenarioDone = done
+	s.Unlock()
+
+	go s.runScans(sc, done)
+	for _, m := range sc.Modes {
+		go s.runModeTransition(m, done)
+	}
+	return nil
+}
+
+func (s *Server) runScans(sc *Scenario, done chan struct{}) {
+	if len(sc.Counters) == 0 {
+		return
+	}
+	ticker := time.NewTicker(sc.Scan)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		s.Lock()
+		for _, c := range sc.Counters {
+			word := s.dmarea[int(c.address)*2:]
+			binary.BigEndian.PutUint16(word, binary.BigEndian.Uint16(word)+uint16(c.Step))
+		}
+		s.Unlock()
+	}
+}
+
+func (s *Server) runModeTransition(m ModeTransition, done chan struct{}) {
+	timer := time.NewTimer(m.After)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		mode := scenarioModes[strings.ToLower(m.Mode)]
+		s.SetMode(mode.status, mode.mode)
+	}
+}
+
+// scenarioEndCode returns the end code a scenario forces for a memory area command on the
+// DM words starting at address, or EndCodeNormalCompletion. The caller holds the lock.
+func (s *Server) scenarioEndCode(address uint16, count int, write bool) uint16 {
+	sc := s.scenario
+	if sc == nil {
+		return mapping.EndCodeNormalCompletion
+	}
+	for _, r := range sc.EndCodes {
+		if r.applies(write) && r.overlaps(address, count) {
+			return r.EndCode
+		}
+	}
+	if write {
+		for _, r := range sc.ReadOnly {
+			if r.overlaps(address, count) {
+				return mapping.EndCodeWriteNotPossibleReadOnly
+			}
+		}
+	}
+	return mapping.EndCodeNormalCompletion
+}
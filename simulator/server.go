@@ -7,30 +7,84 @@ package simulator
 import (
 	"bufio"
 	"encoding/binary"
-	"folke99/gofins/fins"
+	"fmt"
+	"folke99/gofins/finsproto"
 	"folke99/gofins/mapping"
 	"io"
 	"log"
 	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
 )
 
 // PLC Simulator (FINS TCP Server)
 type Server struct {
-	address   string
-	listener  net.Listener
-	dmarea    []byte
-	bitdmarea []byte
-	closed    bool
+	sync.Mutex
+	address  string
+	listener net.Listener
+	dmarea   []byte
+	closed   bool
+	node     byte
+	nextNode byte
+	clock    virtualClock
+
+	latency    Latency
+	packetLoss float64
+
+	status        mapping.StatusCode
+	mode          mapping.ModeCode
+	fatalError    uint16
+	nonFatalError uint16
+	errorCode     uint16
+	errorMessage  string
+	messages      [finsproto.MESSAGE_COUNT]string
+	scenario      *Scenario
+	scenarioDone  chan struct{}
+	logicDone     chan struct{} // Closed to stop the scan logic
+	contention    *Contention
+	reservations  []reservation // DM words recently written by each node, see Contention
+
+	clients    map[net.Conn]*ClientInfo
+	requestLog []RequestLogEntry
+	inspector  *http.Server
+
+	replay map[string][]Exchange
+
+	program    []byte                   // User program served by the program area read command
+	files      map[string]simulatedFile // Memory card root directory by 8.3 file name
+	parameters map[uint16][]uint16      // Parameter areas by area code, created on first access
+	units      map[byte]UnitHandler     // Units other than the CPU unit by unit address (DA2)
+	routes     map[uint16]*Server       // PLCs on other networks by network<<8 | node
+}
+
+// UnitHandler answers the commands sent to a simulated CPU Bus Unit or Special I/O Unit
+type UnitHandler func(r finsproto.Request) (endCode uint16, data []byte)
+
+type simulatedFile struct {
+	data     []byte
+	modified time.Time
 }
 
 const DM_AREA_SIZE = 32768
-const MAX_PACKET_SIZE = 4096 // Define an appropriate max size
+const SIMULATOR_NODE = 1
+const SIMULATOR_MODEL = "CJ2M-CPU33"  // CPU unit model reported by the CPU unit data read command
+const SIMULATOR_CARD_SIZE = 128 << 20 // Capacity of the simulated memory card
 
 func NewPLCSimulator(address string) (*Server, error) {
 	s := &Server{
-		address:   address,
-		dmarea:    make([]byte, DM_AREA_SIZE),
-		bitdmarea: make([]byte, DM_AREA_SIZE),
+		address:    address,
+		dmarea:     make([]byte, DM_AREA_SIZE*2),
+		node:       SIMULATOR_NODE,
+		nextNode:   SIMULATOR_NODE + 1,
+		status:     mapping.StatusRun,
+		mode:       mapping.ModeRun,
+		clients:    make(map[net.Conn]*ClientInfo),
+		files:      make(map[string]simulatedFile),
+		parameters: make(map[uint16][]uint16),
+		units:      make(map[byte]UnitHandler),
+		routes:     make(map[uint16]*Server),
 	}
 
 	// Start TCP Listener
@@ -44,6 +98,11 @@ func NewPLCSimulator(address string) (*Server, error) {
 	return s, nil
 }
 
+// Addr returns the address the simulator is listening on
+func (s *Server) Addr() *net.TCPAddr {
+	return s.listener.Addr().(*net.TCPAddr)
+}
+
 // Accepts client connections
 func (s *Server) acceptConnections() {
 	for {
@@ -61,69 +120,158 @@ func (s *Server) acceptConnections() {
 
 func (s *Server) handleClient(conn net.Conn) {
 	defer conn.Close()
+	s.clientConnected(conn)
+	defer s.clientDisconnected(conn)
 	reader := bufio.NewReader(conn)
 
 	for {
-		lengthBytes := make([]byte, 4)
-		_, err := io.ReadFull(reader, lengthBytes)
+		tcpCommand, messageBytes, err := finsproto.ReadTCPFrame(reader)
 		if err != nil {
 			if err != io.EOF {
-				log.Printf("Length read error: %v", err)
+				log.Printf("Frame read error: %v", err)
 			}
 			break
 		}
 
-		// Decode message length
-		messageLength := binary.BigEndian.Uint32(lengthBytes)
-		if messageLength > MAX_PACKET_SIZE {
-			log.Printf("Message too large: %d", messageLength)
-			break
+		var respFrame []byte
+		switch tcpCommand {
+		case finsproto.TCP_COMMAND_NODE_ADDRESS_REQUEST:
+			respFrame = s.nodeAddressResponse(conn, messageBytes)
+
+		case finsproto.TCP_COMMAND_FRAME_SEND:
+			req, err := finsproto.DecodeRequest(messageBytes)
+			if err != nil {
+				log.Printf("Request decoding error: %v", err)
+				continue
+			}
+			delay, drop := s.networkConditions()
+			if drop {
+				continue
+			}
+			time.Sleep(delay)
+			resp := s.handler(req)
+			s.logRequest(conn, req, resp)
+			if !req.GetHeader().IsResponseRequired() {
+				continue
+			}
+			respFrame = finsproto.TCPFrame(finsproto.TCP_COMMAND_FRAME_SEND, finsproto.EncodeResponse(resp))
+
+		default:
+			log.Printf("Unsupported FINS/TCP command: %d", tcpCommand)
+			continue
 		}
 
-		messageBytes := make([]byte, messageLength)
-		_, err = io.ReadFull(reader, messageBytes)
+		_, err = conn.Write(respFrame)
 		if err != nil {
-			log.Printf("Message read error: %v", err)
+			log.Printf("Response write error: %v", err)
 			break
 		}
+	}
+}
 
-		log.Printf("Received TCP message: % x", messageBytes)
+// nodeAddressResponse answers the connection handshake, assigning a node when the client requests 0.
+// Like a PLC, it rejects nodes used by another connection.
+func (s *Server) nodeAddressResponse(conn net.Conn, message []byte) []byte {
+	clientNode := byte(0)
+	if len(message) >= 4 {
+		clientNode = message[3]
+	}
 
-		// Process the message
-		req, err := fins.DecodeRequest(messageBytes)
-		if err != nil {
-			log.Printf("Request decoding error: %v", err)
-			continue
-		}
+	s.Lock()
+	defer s.Unlock()
 
-		resp := s.handler(req)
+	switch {
+	case clientNode == s.node:
+		return finsproto.TCPErrorFrame(finsproto.TCP_COMMAND_NODE_ADDRESS_RESPONSE, finsproto.TCP_ERROR_SAME_NODE)
+	case clientNode == 0xFF:
+		return finsproto.TCPErrorFrame(finsproto.TCP_COMMAND_NODE_ADDRESS_RESPONSE, finsproto.TCP_ERROR_NODE_OUT_OF_RANGE)
+	case clientNode != 0 && s.nodeInUse(conn, clientNode):
+		return finsproto.TCPErrorFrame(finsproto.TCP_COMMAND_NODE_ADDRESS_RESPONSE, finsproto.TCP_ERROR_NODE_IN_USE)
+	}
 
-		// Prepare and send response
-		respData := fins.EncodeResponse(resp)
-		respLength := make([]byte, 4)
-		binary.BigEndian.PutUint32(respLength, uint32(len(respData)))
+	for tries := 0; clientNode == 0; tries++ {
+		if tries == 0xFF {
+			return finsproto.TCPErrorFrame(finsproto.TCP_COMMAND_NODE_ADDRESS_RESPONSE, finsproto.TCP_ERROR_NO_NODE_AVAILABLE)
+		}
+		if !s.nodeInUse(conn, s.nextNode) {
+			clientNode = s.nextNode
+		}
+		s.nextNode++
+		if s.nextNode == 0 || s.nextNode == 0xFF {
+			s.nextNode = s.node + 1
+		}
+	}
+	if c, ok := s.clients[conn]; ok {
+		c.Node = clientNode
+	}
 
-		_, err = conn.Write(append(respLength, respData...))
-		if err != nil {
-			log.Printf("Response write error: %v", err)
-			break
+	return finsproto.TCPFrame(finsproto.TCP_COMMAND_NODE_ADDRESS_RESPONSE, []byte{0, 0, 0, clientNode, 0, 0, 0, s.node})
+}
+
+// nodeInUse reports whether a connection other than conn uses node, the caller holds the lock
+func (s *Server) nodeInUse(conn net.Conn, node byte) bool {
+	for other, c := range s.clients {
+		if other != conn && c.Node == node {
+			return true
 		}
 	}
+	return false
 }
 
-func (s *Server) handler(r fins.Request) fins.Response {
+func (s *Server) handler(r finsproto.Request) finsproto.Response {
 	var endCode uint16 = mapping.EndCodeNormalCompletion
 	data := []byte{}
 
 	log.Printf("Handler received: CommandCode=0x%04x, DataLength=%d",
 		r.GetCommandCode(), len(r.GetData()))
 
+	if e, ok := s.replayResponse(r); ok {
+		return finsproto.NewResponse(r, e.EndCode, e.Response)
+	}
+	if r.Header.DNA != 0 {
+		return s.relay(r)
+	}
+	if r.Header.DA2 != 0 {
+		return s.unitCommand(r)
+	}
+
+	switch r.GetCommandCode() {
+	case mapping.CommandCodeCPUUnitStatusRead:
+		return finsproto.NewResponse(r, endCode, s.cpuUnitStatus())
+	case mapping.CommandCodeCPUUnitDataRead:
+		return finsproto.NewResponse(r, endCode, cpuUnitData())
+	case mapping.CommandCodeClockRead:
+		return finsproto.NewResponse(r, endCode, clockData(s.Clock()))
+	case mapping.CommandCodeClockWrite:
+		t, err := decodeClock(r.GetData())
+		if err != nil {
+			log.Printf("Invalid clock write: %v", err)
+			return newErrorResponse(r, mapping.EndCodeParameterError)
+		}
+		s.SetClock(t)
+		return finsproto.NewResponse(r, endCode, nil)
+	case mapping.CommandCodeMessageReadClear:
+		return s.messageRead(r)
+	case mapping.CommandCodeParameterAreaRead:
+		return s.parameterAreaRead(r)
+	case mapping.CommandCodeParameterAreaWrite:
+		return s.parameterAreaWrite(r)
+	case mapping.CommandCodeProgramAreaRead:
+		return s.programAreaRead(r)
+	case mapping.CommandCodeFileNameRead:
+		return s.fileNameRead(r)
+	case mapping.CommandCodeSingleFileRead:
+		return s.fileRead(r)
+	case mapping.CommandCodeSingleFileWrite:
+		return s.fileWrite(r)
+	}
+
 	if len(r.GetData()) < 6 {
 		log.Printf("Insufficient data for request: %d bytes", len(r.GetData()))
 		return newErrorResponse(r, mapping.EndCodeNotSupportedByModelVersion)
 	}
 
-	m, err := fins.DecodeMemoryAddress(r.GetData()[:4])
+	m, err := finsproto.DecodeMemoryAddress(r.GetData()[:4])
 	if err != nil {
 		log.Printf("Memory address decoding error: %v", err)
 		return newErrorResponse(r, mapping.EndCodeAddressRangeExceeded)
@@ -134,40 +282,74 @@ func (s *Server) handler(r fins.Request) fins.Response {
 	log.Printf("Memory Operation: Area=0x%02x, Address=%d, ItemCount=%d",
 		m.GetMemoryArea(), m.GetAddress(), ic)
 
+	s.Lock()
+	defer s.Unlock()
+
 	switch r.GetCommandCode() {
 	case mapping.CommandCodeMemoryAreaRead, mapping.CommandCodeMemoryAreaWrite:
-		switch m.GetMemoryArea() {
+		write := r.GetCommandCode() == mapping.CommandCodeMemoryAreaWrite
+		words := int(ic)
+		if mapping.MemoryArea(m.GetMemoryArea()).IsBit() {
+			words = (int(m.GetBitOffset()) + int(ic) + 15) / 16
+		}
+		if code := s.scenarioEndCode(m.GetAddress(), words, write); code != mapping.EndCodeNormalCompletion {
+			return newErrorResponse(r, code)
+		}
+		if write {
+			if code := s.contentionEndCode(r.Header.SA1, m.GetAddress(), words); code != mapping.EndCodeNormalCompletion {
+				return newErrorResponse(r, code)
+			}
+		}
+
+		switch mapping.MemoryArea(m.GetMemoryArea()) {
 		case mapping.MemoryAreaDMWord:
-			if m.GetAddress()+ic*2 > DM_AREA_SIZE {
+			if int(m.GetAddress())+int(ic) > DM_AREA_SIZE {
 				log.Printf("Address range exceeded for DMWord")
 				return newErrorResponse(r, mapping.EndCodeAddressRangeExceeded)
 			}
 
+			start := int(m.GetAddress()) * 2
+			end := start + int(ic)*2
 			if r.GetCommandCode() == mapping.CommandCodeMemoryAreaRead {
-				data = s.dmarea[m.GetAddress() : m.GetAddress()+ic*2]
+				data = append(data, s.dmarea[start:end]...)
 			} else {
-				if len(r.GetData()) < 6+int(ic*2) {
+				if len(r.GetData()) < 6+int(ic)*2 {
 					log.Printf("Insufficient data for DMWord write")
 					return newErrorResponse(r, mapping.EndCodeNotSupportedByModelVersion)
 				}
-				copy(s.dmarea[m.GetAddress():m.GetAddress()+ic*2], r.GetData()[6:6+ic*2])
+				copy(s.dmarea[start:end], r.GetData()[6:6+int(ic)*2])
 			}
 
 		case mapping.MemoryAreaDMBit:
-			if m.GetAddress()+ic > DM_AREA_SIZE {
+			if m.GetBitOffset() > 15 {
+				log.Printf("Bit offset %d out of range for DMBit", m.GetBitOffset())
+				return newErrorResponse(r, mapping.EndCodeAddressRangeError)
+			}
+			if int(m.GetAddress())+words > DM_AREA_SIZE {
 				log.Printf("Address range exceeded for DMBit")
 				return newErrorResponse(r, mapping.EndCodeAddressRangeExceeded)
 			}
 
-			start := m.GetAddress() + uint16(m.GetBitOffset())
+			// Bit n of the command is bit (offset+n)%16 of word address+(offset+n)/16
+			first := int(m.GetAddress())*16 + int(m.GetBitOffset())
 			if r.GetCommandCode() == mapping.CommandCodeMemoryAreaRead {
-				data = s.bitdmarea[start : start+ic]
+				for i := range int(ic) {
+					data = append(data, s.dmBit(first+i))
+				}
 			} else {
 				if len(r.GetData()) < 6+int(ic) {
 					log.Printf("Insufficient data for DMBit write")
 					return newErrorResponse(r, mapping.EndCodeNotSupportedByModelVersion)
 				}
-				copy(s.bitdmarea[start:start+ic], r.GetData()[6:6+ic])
+				values := r.GetData()[6 : 6+int(ic)]
+				for _, v := range values {
+					if v > 1 {
+						return newErrorResponse(r, mapping.EndCodeParameterError)
+					}
+				}
+				for i, v := range values {
+					s.setDMBit(first+i, v)
+				}
 			}
 
 		default:
@@ -176,19 +358,472 @@ func (s *Server) handler(r fins.Request) fins.Response {
 		}
 
 	default:
-		log.Printf("Unsupported command code: 0x%04x", r.GetCommandCode())
+		log.Printf("Unsupported command: %s", mapping.CommandCode(r.GetCommandCode()))
+		return newErrorResponse(r, mapping.EndCodeNotSupportedByModelVersion)
+	}
+
+	return finsproto.NewResponse(r, endCode, data)
+}
+
+// dmBit returns bit n%16 of DM word n/16 as 0 or 1, the caller holds the lock
+func (s *Server) dmBit(n int) byte {
+	return s.dmarea[n/16*2+1-n%16/8] >> (n % 8) & 1
+}
+
+// setDMBit sets bit n%16 of DM word n/16 to v, 0 or 1, the caller holds the lock
+func (s *Server) setDMBit(n int, v byte) {
+	i := n/16*2 + 1 - n%16/8
+	s.dmarea[i] = s.dmarea[i]&^(1<<(n%8)) | v<<(n%8)
+}
+
+// SetMode sets the operating status and mode reported by the CPU unit status read command
+func (s *Server) SetMode(status mapping.StatusCode, mode mapping.ModeCode) {
+	s.Lock()
+	s.status, s.mode = status, mode
+	s.Unlock()
+}
+
+// SetErrors sets the fatal and non-fatal error flags reported by the CPU unit status read
+// command, a fatal error also stops the program like on a PLC
+func (s *Server) SetErrors(fatal, nonFatal uint16) {
+	s.Lock()
+	s.fatalError, s.nonFatalError = fatal, nonFatal
+	if fatal != 0 {
+		s.status = mapping.StatusStop
+	}
+	s.Unlock()
+}
+
+// SetFAL raises the error of a FAL instruction with number and message, or of a FALS
+// instruction with fatal, which stops the program. Number 0 clears it.
+func (s *Server) SetFAL(number uint16, fatal bool, message string) {
+	const falFlag, falsFlag = 1 << 15, 1 << 6
+
+	s.Lock()
+	defer s.Unlock()
+	s.nonFatalError &^= falFlag
+	s.fatalError &^= falsFlag
+	s.errorCode, s.errorMessage = 0, ""
+	if number == 0 {
+		return
+	}
+	s.errorMessage = message
+	if fatal {
+		s.fatalError |= falsFlag
+		s.errorCode = 0xC100 + number
+		s.status = mapping.StatusStop
+	} else {
+		s.nonFatalError |= falFlag
+		s.errorCode = 0x4100 + number
+	}
+}
+
+// SetMessage sets message n of the MSG instruction, an empty text clears it
+func (s *Server) SetMessage(n int, text string) {
+	s.Lock()
+	s.messages[n] = text
+	s.Unlock()
+}
+
+// cpuUnitStatus returns the CPU unit status read data: status, mode, fatal and non-fatal
+// error flags, messages, error code and error message
+func (s *Server) cpuUnitStatus() []byte {
+	s.Lock()
+	defer s.Unlock()
+
+	data := make([]byte, 10, 10+finsproto.FAL_MESSAGE_LENGTH)
+	data[0] = byte(s.status)
+	data[1] = byte(s.mode)
+	binary.BigEndian.PutUint16(data[2:4], s.fatalError)
+	binary.BigEndian.PutUint16(data[4:6], s.nonFatalError)
+	binary.BigEndian.PutUint16(data[6:8], uint16(s.messageFlags()))
+	binary.BigEndian.PutUint16(data[8:10], s.errorCode)
+	return append(data, fmt.Sprintf("%-16.16s", s.errorMessage)...)
+}
+
+// messageFlags returns the bits of the waiting messages, the caller holds the lock
+func (s *Server) messageFlags() uint8 {
+	var flags uint8
+	for n, m := range s.messages {
+		if m != "" {
+			flags |= 1 << n
+		}
+	}
+	return flags
+}
+
+// messageRead answers the message read and the FAL/FALS number read, the message clear
+// parameters are not supported
+func (s *Server) messageRead(r finsproto.Request) finsproto.Response {
+	data := r.GetData()
+	if len(data) < 2 {
+		return newErrorResponse(r, mapping.EndCodeCommandTooShort)
+	}
+	param := binary.BigEndian.Uint16(data)
+
+	s.Lock()
+	defer s.Unlock()
+	response := binary.BigEndian.AppendUint16(nil, param)
+	switch {
+	case param == finsproto.MESSAGE_FAL_READ:
+		var fal uint16
+		if s.errorCode&0x3FFF > 0x100 {
+			fal = s.errorCode&0x3FFF - 0x100
+		}
+		response = binary.BigEndian.AppendUint16(response, fal)
+		response = append(response, fmt.Sprintf("%-16.16s", s.errorMessage)...)
+	case param&0xFF00 == 0:
+		for n := range finsproto.MESSAGE_COUNT {
+			if param&(1<<n) != 0 {
+				response = append(response, fmt.Sprintf("%-32.32s", s.messages[n])...)
+			}
+		}
+	default:
+		return newErrorResponse(r, mapping.EndCodeParameterError)
+	}
+	return finsproto.NewResponse(r, mapping.EndCodeNormalCompletion, response)
+}
+
+// cpuUnitData returns the CPU unit data read data: model and version (20 bytes each, space
+// padded), 40 bytes for system use and the area data
+func cpuUnitData() []byte {
+	data := make([]byte, 92)
+	copy(data[0:20], fmt.Sprintf("%-20s", SIMULATOR_MODEL))
+	copy(data[20:40], fmt.Sprintf("%-20s", "01.00"))
+	return data
+}
+
+func newErrorResponse(r finsproto.Request, endCode uint16) finsproto.Response {
+	return finsproto.NewResponse(r, endCode, nil)
+}
+
+// SetProgram sets the user program returned by the program area read command
+func (s *Server) SetProgram(program []byte) {
+	s.Lock()
+	s.program = append([]byte(nil), program...)
+	s.Unlock()
+}
+
+// SetFile stores a file in the root directory of the simulated memory card
+func (s *Server) SetFile(name string, data []byte, modified time.Time) {
+	s.Lock()
+	s.files[finsproto.DecodeFileName(finsproto.EncodeFileName(name))] = simulatedFile{append([]byte(nil), data...), modified}
+	s.Unlock()
+}
+
+// SetRoute makes the simulator a gateway relaying the commands for node on network to
+// remote, nil removes the route. Commands for other networks fail with
+// EndCodeDestinationAddressSettingError, for other nodes of a routed network with
+// EndCodeDestinationNodeNotInNetwork.
+func (s *Server) SetRoute(network, node byte, remote *Server) {
+	s.Lock()
+	defer s.Unlock()
+	key := uint16(network)<<8 | uint16(node)
+	if remote == nil {
+		delete(s.routes, key)
+		return
+	}
+	s.routes[key] = remote
+}
+
+// relay passes a command for another network to the PLC routed there
+func (s *Server) relay(r finsproto.Request) finsproto.Response {
+	s.Lock()
+	remote, ok := s.routes[uint16(r.Header.DNA)<<8|uint16(r.Header.DA1)]
+	known := false
+	for key := range s.routes {
+		known = known || byte(key>>8) == r.Header.DNA
+	}
+	s.Unlock()
+	if !ok {
+		if known {
+			return newErrorResponse(r, mapping.EndCodeDestinationNodeNotInNetwork)
+		}
+		return newErrorResponse(r, mapping.EndCodeDestinationAddressSettingError)
+	}
+	// The remote PLC sees the command as addressed to its own network
+	local := r
+	local.Header.DNA = 0
+	resp := remote.handler(local)
+	resp.Header.SNA = r.Header.DNA
+	return resp
+}
+
+// SetUnit simulates a unit at unitAddress answering the commands sent to it with h, nil
+// removes the unit. Commands for units without a handler fail with EndCodeUnitMissing.
+func (s *Server) SetUnit(unitAddress byte, h UnitHandler) {
+	s.Lock()
+	defer s.Unlock()
+	if h == nil {
+		delete(s.units, unitAddress)
+		return
+	}
+	s.units[unitAddress] = h
+}
+
+// unitCommand passes a command for a unit other than the CPU unit to its handler
+func (s *Server) unitCommand(r finsproto.Request) finsproto.Response {
+	s.Lock()
+	h, ok := s.units[r.Header.DA2]
+	s.Unlock()
+	if !ok {
+		return newErrorResponse(r, mapping.EndCodeUnitMissing)
+	}
+	endCode, data := h(r)
+	return finsproto.NewResponse(r, endCode, data)
+}
+
+// File returns a copy of a file in the root directory of the simulated memory card
+func (s *Server) File(name string) ([]byte, bool) {
+	s.Lock()
+	defer s.Unlock()
+	f, ok := s.files[name]
+	return append([]byte(nil), f.data...), ok
+}
+
+// SetParameterArea writes words to a parameter area starting at first, regardless of the mode
+func (s *Server) SetParameterArea(area, first uint16, words []uint16) {
+	s.Lock()
+	defer s.Unlock()
+	if p := s.parameterArea(area); p != nil {
+		copy(p[min(int(first), len(p)):], words)
+	}
+}
+
+// ParameterArea returns a copy of a parameter area, nil for unknown areas
+func (s *Server) ParameterArea(area uint16) []uint16 {
+	s.Lock()
+	defer s.Unlock()
+	return append([]uint16(nil), s.parameterArea(area)...)
+}
+
+// parameterArea returns the words of a parameter area, the caller holds the lock
+func (s *Server) parameterArea(area uint16) []uint16 {
+	p, ok := s.parameters[area]
+	if !ok {
+		words := finsproto.ParameterAreaWords(area)
+		if words == 0 {
+			return nil
+		}
+		p = make([]uint16, words)
+		s.parameters[area] = p
+	}
+	return p
+}
+
+// decodeParameterRange decodes the area code, first word and word count of a parameter area
+// command and returns the words of the area they select
+func (s *Server) decodeParameterRange(d []byte) (area uint16, first int, words []uint16, endCode uint16) {
+	if len(d) < finsproto.PARAMETER_AREA_HEADER_LENGTH {
+		return 0, 0, nil, mapping.EndCodeCommandTooShort
+	}
+	area = binary.BigEndian.Uint16(d[0:2])
+	first = int(binary.BigEndian.Uint16(d[2:4]))
+	count := int(binary.BigEndian.Uint16(d[4:6]) &^ finsproto.PARAMETER_LAST_WORD)
+	p := s.parameterArea(area)
+	if p == nil {
+		return 0, 0, nil, mapping.EndCodeAreaClassificationMissing
+	}
+	if first+count > len(p) {
+		return 0, 0, nil, mapping.EndCodeAddressRangeExceeded
+	}
+	return area, first, p[first : first+count], mapping.EndCodeNormalCompletion
+}
+
+// parameterAreaRead answers a parameter area read: area code, first word, word count with the
+// last word flag and the words
+func (s *Server) parameterAreaRead(r finsproto.Request) finsproto.Response {
+	s.Lock()
+	defer s.Unlock()
+	area, first, words, endCode := s.decodeParameterRange(r.GetData())
+	if endCode != mapping.EndCodeNormalCompletion {
+		return newErrorResponse(r, endCode)
+	}
+
+	count := uint16(len(words))
+	if first+len(words) == len(s.parameters[area]) {
+		count |= finsproto.PARAMETER_LAST_WORD
+	}
+	data := binary.BigEndian.AppendUint16(nil, area)
+	data = binary.BigEndian.AppendUint16(data, uint16(first))
+	data = binary.BigEndian.AppendUint16(data, count)
+	for _, w := range words {
+		data = binary.BigEndian.AppendUint16(data, w)
+	}
+	return finsproto.NewResponse(r, mapping.EndCodeNormalCompletion, data)
+}
+
+// parameterAreaWrite answers a parameter area write, which needs PROGRAM mode like on a PLC
+func (s *Server) parameterAreaWrite(r finsproto.Request) finsproto.Response {
+	s.Lock()
+	defer s.Unlock()
+	switch s.mode {
+	case mapping.ModeRun:
+		return newErrorResponse(r, mapping.EndCodeNotExecutableInCurrentModeWrongPLCModeInRun)
+	case mapping.ModeMonitor:
+		return newErrorResponse(r, mapping.EndCodeNotExecutableInCurrentModeWrongPLCModeInMonitor)
+	}
+
+	d := r.GetData()
+	_, _, words, endCode := s.decodeParameterRange(d)
+	if endCode != mapping.EndCodeNormalCompletion {
+		return newErrorResponse(r, endCode)
+	}
+	if len(d) != finsproto.PARAMETER_AREA_HEADER_LENGTH+2*len(words) {
+		return newErrorResponse(r, mapping.EndCodeElementsDataDontMatch)
+	}
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(d[finsproto.PARAMETER_AREA_HEADER_LENGTH+2*i:])
+	}
+	return finsproto.NewResponse(r, mapping.EndCodeNormalCompletion, nil)
+}
+
+// programAreaRead answers a program area read: program number, offset, byte count with the
+// last block flag and the data
+func (s *Server) programAreaRead(r finsproto.Request) finsproto.Response {
+	d := r.GetData()
+	if len(d) < 8 {
+		return newErrorResponse(r, mapping.EndCodeNotSupportedByModelVersion)
+	}
+	offset, count := binary.BigEndian.Uint32(d[2:6]), binary.BigEndian.Uint16(d[6:8])
+
+	s.Lock()
+	defer s.Unlock()
+	if int(offset) > len(s.program) {
+		return newErrorResponse(r, mapping.EndCodeAddressRangeExceeded)
+	}
+	block := s.program[offset:min(int(offset)+int(count), len(s.program))]
+	n := uint16(len(block))
+	if int(offset)+len(block) == len(s.program) {
+		n |= finsproto.PROGRAM_LAST_BLOCK
+	}
+	data := append([]byte(nil), d[0:6]...)
+	data = binary.BigEndian.AppendUint16(data, n)
+	return finsproto.NewResponse(r, mapping.EndCodeNormalCompletion, append(data, block...))
+}
+
+// fileNameRead answers a file name read of the memory card root directory
+func (s *Server) fileNameRead(r finsproto.Request) finsproto.Response {
+	d := r.GetData()
+	if len(d) < 8 || binary.BigEndian.Uint16(d[0:2]) != finsproto.DISK_MEMORY_CARD {
+		return newErrorResponse(r, mapping.EndCodeNotSupportedByModelVersion)
+	}
+	first, count := int(binary.BigEndian.Uint16(d[2:4])), int(binary.BigEndian.Uint16(d[4:6]))
+
+	s.Lock()
+	defer s.Unlock()
+	names := make([]string, 0, len(s.files))
+	used := 0
+	for name, f := range s.files {
+		names = append(names, name)
+		used += len(f.data)
+	}
+	sort.Strings(names)
+
+	data := make([]byte, finsproto.DISK_DATA_LENGTH, finsproto.DISK_DATA_LENGTH+2+count*finsproto.FILE_DATA_LENGTH)
+	copy(data[0:12], fmt.Sprintf("%-12s", "SIMULATOR"))
+	binary.BigEndian.PutUint32(data[16:20], SIMULATOR_CARD_SIZE)
+	binary.BigEndian.PutUint32(data[20:24], uint32(max(SIMULATOR_CARD_SIZE-used, 0)))
+	binary.BigEndian.PutUint16(data[24:26], uint16(len(names)))
+
+	listed := names[min(first, len(names)):min(first+count, len(names))]
+	n := uint16(len(listed))
+	if first+len(listed) == len(names) {
+		n |= finsproto.FILE_NAMES_LAST_FILE
+	}
+	data = binary.BigEndian.AppendUint16(data, n)
+	for _, name := range listed {
+		f := s.files[name]
+		data = append(data, finsproto.EncodeFileName(name)...)
+		data = binary.BigEndian.AppendUint32(data, finsproto.EncodeFileTime(f.modified))
+		data = binary.BigEndian.AppendUint32(data, uint32(len(f.data)))
+	}
+	return finsproto.NewResponse(r, mapping.EndCodeNormalCompletion, data)
+}
+
+// fileRead answers a single file read from the memory card root directory
+func (s *Server) fileRead(r finsproto.Request) finsproto.Response {
+	d := r.GetData()
+	if len(d) < 20 || binary.BigEndian.Uint16(d[0:2]) != finsproto.DISK_MEMORY_CARD {
+		return newErrorResponse(r, mapping.EndCodeNotSupportedByModelVersion)
+	}
+	name := finsproto.DecodeFileName(d[2:14])
+	position, length := binary.BigEndian.Uint32(d[14:18]), binary.BigEndian.Uint16(d[18:20])
+
+	s.Lock()
+	defer s.Unlock()
+	f, ok := s.files[name]
+	if !ok || int(position) > len(f.data) {
+		return newErrorResponse(r, mapping.EndCodeAddressRangeExceeded)
+	}
+	block := f.data[position:min(int(position)+int(length), len(f.data))]
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(f.data)))
+	data = binary.BigEndian.AppendUint32(data, position)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(block)))
+	return finsproto.NewResponse(r, mapping.EndCodeNormalCompletion, append(data, block...))
+}
+
+// fileWrite answers a single file write to the memory card root directory
+func (s *Server) fileWrite(r finsproto.Request) finsproto.Response {
+	d := r.GetData()
+	if len(d) < 24 || binary.BigEndian.Uint16(d[0:2]) != finsproto.DISK_MEMORY_CARD {
 		return newErrorResponse(r, mapping.EndCodeNotSupportedByModelVersion)
 	}
+	mode := binary.BigEndian.Uint16(d[2:4])
+	name := finsproto.DecodeFileName(d[4:16])
+	position, length := binary.BigEndian.Uint32(d[16:20]), int(binary.BigEndian.Uint16(d[20:22]))
+	dataStart := 24 + int(binary.BigEndian.Uint16(d[22:24]))
+	if len(d) != dataStart+length {
+		return newErrorResponse(r, mapping.EndCodeCommandTooShort)
+	}
+	data := d[dataStart:]
 
-	return fins.NewResponse(r, endCode, data)
+	s.Lock()
+	defer s.Unlock()
+	f, exists := s.files[name]
+	switch mode {
+	case finsproto.FILE_WRITE_NEW, finsproto.FILE_WRITE_REPLACE:
+		if exists && mode == finsproto.FILE_WRITE_NEW {
+			return newErrorResponse(r, mapping.EndCodeWriteNotPossibleFileNameAlreadyExists)
+		}
+		f.data = append([]byte(nil), data...)
+	case finsproto.FILE_WRITE_APPEND, finsproto.FILE_WRITE_OVERWRITE:
+		if !exists {
+			return newErrorResponse(r, mapping.EndCodeWriteNotPossibleFileMissing)
+		}
+		if mode == finsproto.FILE_WRITE_APPEND {
+			position = uint32(len(f.data))
+		}
+		if int(position) > len(f.data) {
+			return newErrorResponse(r, mapping.EndCodeAddressRangeExceeded)
+		}
+		f.data = append(f.data[:position:position], append(data, f.data[min(int(position)+len(data), len(f.data)):]...)...)
+	default:
+		return newErrorResponse(r, mapping.EndCodeNotSupportedByModelVersion)
+	}
+	f.modified = s.clock.now()
+	s.files[name] = f
+	return finsproto.NewResponse(r, mapping.EndCodeNormalCompletion, nil)
 }
 
-func newErrorResponse(r fins.Request, endCode uint16) fins.Response {
-	return fins.NewResponse(r, endCode, nil)
+// DisconnectClients closes every client connection, as a PLC dropping its sessions does
+func (s *Server) DisconnectClients() {
+	s.Lock()
+	defer s.Unlock()
+	for conn := range s.clients {
+		conn.Close()
+	}
 }
 
 // Shut down the simulator
 func (s *Server) Close() {
+	s.RunScenario(nil)
+	s.SetScanLogic(0, nil)
+	s.Lock()
+	if s.inspector != nil {
+		s.inspector.Close()
+	}
+	s.Unlock()
 	s.closed = true
 	s.listener.Close()
 }
@@ -0,0 +1,107 @@
+package sparkplug
+
+import (
+	"fmt"
+	"folke99/gofins/fins"
+	"folke99/gofins/sparkplug/sparkplugpb"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// metric returns the metric of a tag, null when the tag wasn't read or its read failed
+func metric(t fins.Tag, v fins.TagValue, read bool, at time.Time) *sparkplugpb.Payload_Metric {
+	m := &sparkplugpb.Payload_Metric{
+		Name:      proto.String(t.Name),
+		Timestamp: timestamp(at),
+		Datatype:  datatype(metricType(t.DataType)),
+	}
+	if !read || v.Err != nil {
+		m.IsNull = proto.Bool(true)
+		return m
+	}
+	switch t.DataType {
+	case fins.DataTypeBool:
+		m.Value = &sparkplugpb.Payload_Metric_BooleanValue{BooleanValue: v.Value != 0}
+	case fins.DataTypeUint, fins.DataTypeUdint:
+		m.Value = &sparkplugpb.Payload_Metric_IntValue{IntValue: uint32(v.Value)}
+	case fins.DataTypeInt, fins.DataTypeDint:
+		// Signed types are sent as two's complement
+		m.Value = &sparkplugpb.Payload_Metric_IntValue{IntValue: uint32(int32(v.Value))}
+	case fins.DataTypeReal:
+		m.Value = &sparkplugpb.Payload_Metric_FloatValue{FloatValue: float32(v.Value)}
+	default:
+		m.Value = &sparkplugpb.Payload_Metric_DoubleValue{DoubleValue: v.Value}
+	}
+	return m
+}
+
+// metricType maps a PLC data type to its Sparkplug data type
+func metricType(d fins.DataType) sparkplugpb.DataType {
+	switch d {
+	case fins.DataTypeBool:
+		return sparkplugpb.DataType_Boolean
+	case fins.DataTypeUint:
+		return sparkplugpb.DataType_UInt16
+	case fins.DataTypeInt:
+		return sparkplugpb.DataType_Int16
+	case fins.DataTypeUdint:
+		return sparkplugpb.DataType_UInt32
+	case fins.DataTypeDint:
+		return sparkplugpb.DataType_Int32
+	case fins.DataTypeReal:
+		return sparkplugpb.DataType_Float
+	case fins.DataTypeLreal:
+		return sparkplugpb.DataType_Double
+	}
+	return sparkplugpb.DataType_Unknown
+}
+
+// metricValue returns the value a command metric writes to tag t
+func metricValue(t fins.Tag, m *sparkplugpb.Payload_Metric) (float64, error) {
+	signed := t.DataType == fins.DataTypeInt || t.DataType == fins.DataTypeDint
+	switch v := m.Value.(type) {
+	case *sparkplugpb.Payload_Metric_BooleanValue:
+		if v.BooleanValue {
+			return 1, nil
+		}
+		return 0, nil
+	case *sparkplugpb.Payload_Metric_IntValue:
+		if signed {
+			return float64(int32(v.IntValue)), nil
+		}
+		return float64(v.IntValue), nil
+	case *sparkplugpb.Payload_Metric_LongValue:
+		if signed {
+			return float64(int64(v.LongValue)), nil
+		}
+		return float64(v.LongValue), nil
+	case *sparkplugpb.Payload_Metric_FloatValue:
+		return float64(v.FloatValue), nil
+	case *sparkplugpb.Payload_Metric_DoubleValue:
+		if math.IsNaN(v.DoubleValue) || math.IsInf(v.DoubleValue, 0) {
+			return 0, fmt.Errorf("value %v isn't finite", v.DoubleValue)
+		}
+		return v.DoubleValue, nil
+	}
+	return 0, fmt.Errorf("metric has no numeric or boolean value")
+}
+
+func booleanMetric(name string, value bool, at time.Time) *sparkplugpb.Payload_Metric {
+	return &sparkplugpb.Payload_Metric{
+		Name:      proto.String(name),
+		Timestamp: timestamp(at),
+		Datatype:  datatype(sparkplugpb.DataType_Boolean),
+		Value:     &sparkplugpb.Payload_Metric_BooleanValue{BooleanValue: value},
+	}
+}
+
+func datatype(d sparkplugpb.DataType) *uint32 {
+	return proto.Uint32(uint32(d))
+}
+
+// timestamp returns t in milliseconds since the epoch, as Sparkplug sends times
+func timestamp(t time.Time) *uint64 {
+	return proto.Uint64(uint64(t.UnixMilli()))
+}
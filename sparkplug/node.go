@@ -0,0 +1,427 @@
+// Package sparkplug publishes the tag tables of a fins.Manager as a Sparkplug B edge node
+// over MQTT, so SCADA and MES systems discover the metrics and their types by themselves.
+//
+// The edge node stands for the gateway and every PLC is a device of it. The device is born
+// (DBIRTH) with all tags of its table as metrics once a read of the PLC succeeds, sends the
+// changed values beyond the deadband of their tag (DDATA) and dies (DDEATH) when all reads of
+// a poll fail. The node metric "PLCs/<plc>/Connected" follows the devices in NDATA. Host
+// applications write tags with DCMD and ask for a rebirth with NCMD "Node Control/Rebirth"
+// or DCMD "Device Control/Rebirth". The broker publishes the NDEATH of the node when the
+// connection is lost.
+package sparkplug
+
+import (
+	"errors"
+	"fmt"
+	"folke99/gofins/fins"
+	"folke99/gofins/sparkplug/sparkplugpb"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	NAMESPACE             = "spBv1.0"
+	METRIC_BDSEQ          = "bdSeq"
+	METRIC_NODE_REBIRTH   = "Node Control/Rebirth"
+	METRIC_DEVICE_REBIRTH = "Device Control/Rebirth"
+	MQTT_TIMEOUT          = 5 * time.Second
+)
+
+// Options configures an EdgeNode
+type Options struct {
+	Broker   string // e.g. tcp://localhost:1883
+	ClientID string // NodeID when empty
+	Username string
+	Password string
+	GroupID  string
+	NodeID   string
+	// Tags is the tag table per PLC name, the metrics of the device of the PLC
+	Tags map[string][]fins.Tag
+	// Authorize decides whether a DCMD may write value to tag of plc, a non-nil error rejects
+	// the write. All writes are authorized when nil.
+	Authorize func(plc string, tag fins.Tag, value float64) error
+	// NewClient creates the MQTT client from the options the node set up.
+	// Default value: mqtt.NewClient
+	NewClient func(*mqtt.ClientOptions) mqtt.Client
+}
+
+// EdgeNode is a Sparkplug B edge node with a device per PLC
+type EdgeNode struct {
+	sync.Mutex
+	manager *fins.Manager
+	opts    Options
+	client  mqtt.Client
+	bdSeq   uint64
+	seq     uint64
+	devices map[string]*device
+	closed  bool
+}
+
+// device is the state of the device of a PLC
+type device struct {
+	name    string
+	tags    []fins.Tag
+	values  []fins.TagValue // Latest value of every tag
+	read    []bool          // The tag was read at least once
+	filters []*fins.DeadbandFilter
+	alive   bool
+}
+
+// NewEdgeNode connects to the broker, the node is born once connected. The MQTT client
+// reconnects by itself after a connection loss and the node is born again then.
+func NewEdgeNode(m *fins.Manager, opts Options) (*EdgeNode, error) {
+	for _, id := range []string{opts.GroupID, opts.NodeID} {
+		if id == "" || strings.ContainsAny(id, "/+#") {
+			return nil, fmt.Errorf("invalid Sparkplug group or node ID %q", id)
+		}
+	}
+	if opts.ClientID == "" {
+		opts.ClientID = opts.NodeID
+	}
+	if opts.NewClient == nil {
+		opts.NewClient = mqtt.NewClient
+	}
+
+	n := &EdgeNode{manager: m, opts: opts, devices: make(map[string]*device, len(opts.Tags))}
+	for plc, tags := range opts.Tags {
+		if strings.ContainsAny(plc, "/+#") {
+			return nil, fmt.Errorf("invalid Sparkplug device ID %q", plc)
+		}
+		if _, ok := m.Client(plc); !ok {
+			return nil, fmt.Errorf("unknown PLC %q", plc)
+		}
+		n.devices[plc] = &device{
+			name:   plc,
+			tags:   tags,
+			values: make([]fins.TagValue, len(tags)),
+			read:   make([]bool, len(tags)),
+		}
+	}
+
+	mqttOpts := mqtt.NewClientOptions().
+		AddBroker(opts.Broker).
+		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOrderMatters(false). // Commands publish from their handler
+		SetBinaryWill(n.topic("NDEATH", ""), n.deathPayload(), 1, false).
+		SetOnConnectHandler(n.onConnect).
+		SetReconnectingHandler(func(_ mqtt.Client, o *mqtt.ClientOptions) {
+			// Every MQTT session has its own bdSeq, so hosts tell a stale NDEATH apart. Like
+			// seq it runs from 0 to 255.
+			n.Lock()
+			n.bdSeq = (n.bdSeq + 1) % 256
+			o.WillPayload = n.deathPayload()
+			n.Unlock()
+		})
+
+	n.client = opts.NewClient(mqttOpts)
+	token := n.client.Connect()
+	if !token.WaitTimeout(MQTT_TIMEOUT) {
+		return nil, fmt.Errorf("timeout connecting to %s", opts.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", opts.Broker, err)
+	}
+	return n, nil
+}
+
+// Publish takes the values of a poll of plc: the device is born with the first successful
+// read, sends the values that changed beyond their deadband and dies when all reads failed
+func (n *EdgeNode) Publish(plc string, values []fins.TagValue, t time.Time) error {
+	n.Lock()
+	defer n.Unlock()
+	d, ok := n.devices[plc]
+	if !ok {
+		return fmt.Errorf("no tag table for PLC %q", plc)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	if allFailed(values) {
+		if !d.alive {
+			return nil
+		}
+		d.alive = false
+		return errors.Join(
+			n.publish("DDEATH", d.name, &sparkplugpb.Payload{Timestamp: timestamp(t)}),
+			n.publishConnected(d, t),
+		)
+	}
+
+	var changed []*sparkplugpb.Payload_Metric
+	for _, v := range values {
+		i := slices.IndexFunc(d.tags, func(tag fins.Tag) bool { return tag.Name == v.Tag.Name })
+		if i < 0 {
+			continue
+		}
+		d.values[i], d.read[i] = v, true
+		if d.alive && d.filters[i].Report(v, t) {
+			m := metric(d.tags[i], v, true, t)
+			m.Name, m.Alias = nil, proto.Uint64(uint64(i+1))
+			changed = append(changed, m)
+		}
+	}
+	if !d.alive {
+		d.alive = true
+		return errors.Join(n.deviceBirth(d, t), n.publishConnected(d, t))
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return n.publish("DDATA", d.name, &sparkplugpb.Payload{Timestamp: timestamp(t), Metrics: changed})
+}
+
+// Close publishes the NDEATH of the node and disconnects from the broker
+func (n *EdgeNode) Close() error {
+	n.Lock()
+	if n.closed {
+		n.Unlock()
+		return nil
+	}
+	n.closed = true
+	var err error
+	if n.client.IsConnected() {
+		token := n.client.Publish(n.topic("NDEATH", ""), 1, false, n.deathPayload())
+		if !token.WaitTimeout(MQTT_TIMEOUT) {
+			err = fmt.Errorf("timeout publishing NDEATH")
+		} else {
+			err = token.Error()
+		}
+	}
+	n.Unlock()
+
+	n.client.Disconnect(250)
+	return err
+}
+
+// onConnect subscribes to the commands of the node and its devices and publishes the births
+func (n *EdgeNode) onConnect(c mqtt.Client) {
+	filters := map[string]byte{n.topic("NCMD", ""): 1, n.topic("DCMD", "+"): 1}
+	if token := c.SubscribeMultiple(filters, n.onCommand); token.WaitTimeout(MQTT_TIMEOUT) && token.Error() != nil {
+		log.Printf("Sparkplug command subscription failed: %v", token.Error())
+	}
+	n.Lock()
+	defer n.Unlock()
+	if err := n.rebirth(); err != nil {
+		log.Printf("Sparkplug birth failed: %v", err)
+	}
+}
+
+// rebirth publishes the NBIRTH of the node and the DBIRTH of every live device, the caller
+// holds the lock
+func (n *EdgeNode) rebirth() error {
+	now := time.Now()
+	n.seq = 0
+	metrics := []*sparkplugpb.Payload_Metric{
+		{Name: proto.String(METRIC_BDSEQ), Timestamp: timestamp(now), Datatype: datatype(sparkplugpb.DataType_UInt64),
+			Value: &sparkplugpb.Payload_Metric_LongValue{LongValue: n.bdSeq}},
+		booleanMetric(METRIC_NODE_REBIRTH, false, now),
+	}
+	for _, d := range n.sortedDevices() {
+		metrics = append(metrics, booleanMetric(connectedMetric(d), d.alive, now))
+	}
+	errs := []error{n.publish("NBIRTH", "", &sparkplugpb.Payload{Timestamp: timestamp(now), Metrics: metrics})}
+	for _, d := range n.sortedDevices() {
+		if d.alive {
+			errs = append(errs, n.deviceBirth(d, now))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deviceBirth publishes the DBIRTH of d with all tags of its table and restarts the deadband
+// filters from the values sent, the caller holds the lock
+func (n *EdgeNode) deviceBirth(d *device, t time.Time) error {
+	metrics := make([]*sparkplugpb.Payload_Metric, 0, len(d.tags)+1)
+	metrics = append(metrics, booleanMetric(METRIC_DEVICE_REBIRTH, false, t))
+	d.filters = make([]*fins.DeadbandFilter, len(d.tags))
+	for i, tag := range d.tags {
+		m := metric(tag, d.values[i], d.read[i], t)
+		m.Alias = proto.Uint64(uint64(i + 1))
+		metrics = append(metrics, m)
+		d.filters[i] = fins.NewDeadbandFilter(tag.Deadband)
+		if d.read[i] {
+			d.filters[i].Report(d.values[i], t)
+		}
+	}
+	return n.publish("DBIRTH", d.name, &sparkplugpb.Payload{Timestamp: timestamp(t), Metrics: metrics})
+}
+
+// publishConnected publishes the connection state of the PLC of d in NDATA, the caller holds
+// the lock
+func (n *EdgeNode) publishConnected(d *device, t time.Time) error {
+	return n.publish("NDATA", "", &sparkplugpb.Payload{
+		Timestamp: timestamp(t),
+		Metrics:   []*sparkplugpb.Payload_Metric{booleanMetric(connectedMetric(d), d.alive, t)},
+	})
+}
+
+// publish sends a message of the node, or of device when set, with the next sequence number.
+// The caller holds the lock.
+func (n *EdgeNode) publish(kind, device string, p *sparkplugpb.Payload) error {
+	if n.closed || !n.client.IsConnected() {
+		return fmt.Errorf("%s not sent, not connected to %s", kind, n.opts.Broker)
+	}
+	p.Seq = proto.Uint64(n.seq)
+	n.seq = (n.seq + 1) % 256
+	payload, err := proto.Marshal(p)
+	if err != nil {
+		return err
+	}
+	token := n.client.Publish(n.topic(kind, device), 0, false, payload)
+	if !token.WaitTimeout(MQTT_TIMEOUT) {
+		return fmt.Errorf("timeout publishing %s", kind)
+	}
+	return token.Error()
+}
+
+// deathPayload returns the NDEATH payload of the current MQTT session, the caller holds the
+// lock or owns the node
+func (n *EdgeNode) deathPayload() []byte {
+	payload, _ := proto.Marshal(&sparkplugpb.Payload{
+		Timestamp: timestamp(time.Now()),
+		Metrics: []*sparkplugpb.Payload_Metric{{Name: proto.String(METRIC_BDSEQ), Datatype: datatype(sparkplugpb.DataType_UInt64),
+			Value: &sparkplugpb.Payload_Metric_LongValue{LongValue: n.bdSeq}}},
+	})
+	return payload
+}
+
+// onCommand handles NCMD and DCMD messages
+func (n *EdgeNode) onCommand(_ mqtt.Client, msg mqtt.Message) {
+	var p sparkplugpb.Payload
+	if err := proto.Unmarshal(msg.Payload(), &p); err != nil {
+		log.Printf("Sparkplug command on %s is invalid: %v", msg.Topic(), err)
+		return
+	}
+	parts := strings.Split(msg.Topic(), "/")
+	if len(parts) < 4 {
+		return
+	}
+
+	// The PLC writes are sent after the lock is released, a slow PLC mustn't hold up the
+	// births and data of the other devices
+	var writes []tagWrite
+	n.Lock()
+	switch parts[2] {
+	case "NCMD":
+		for _, m := range p.Metrics {
+			if m.GetName() == METRIC_NODE_REBIRTH && m.GetBooleanValue() {
+				if err := n.rebirth(); err != nil {
+					log.Printf("Sparkplug rebirth failed: %v", err)
+				}
+			}
+		}
+	case "DCMD":
+		if len(parts) != 5 {
+			break
+		}
+		d, ok := n.devices[parts[4]]
+		if !ok {
+			log.Printf("Sparkplug DCMD for unknown device %q", parts[4])
+			break
+		}
+		for _, m := range p.Metrics {
+			w, err := n.deviceCommand(d, m)
+			if err != nil {
+				log.Printf("Sparkplug DCMD %s of %s failed: %v", m.GetName(), d.name, err)
+			} else if w != nil {
+				writes = append(writes, *w)
+			}
+		}
+	}
+	n.Unlock()
+
+	for _, w := range writes {
+		if err := n.write(w); err != nil {
+			log.Printf("Sparkplug DCMD %s of %s failed: %v", w.tag.Name, w.plc, err)
+		}
+	}
+}
+
+// tagWrite is a tag write requested by a DCMD
+type tagWrite struct {
+	plc   string
+	tag   fins.Tag
+	value float64
+}
+
+// deviceCommand rebirths d or returns the tag write of metric m, the caller holds the lock
+func (n *EdgeNode) deviceCommand(d *device, m *sparkplugpb.Payload_Metric) (*tagWrite, error) {
+	if m.GetName() == METRIC_DEVICE_REBIRTH {
+		if m.GetBooleanValue() && d.alive {
+			return nil, n.deviceBirth(d, time.Now())
+		}
+		return nil, nil
+	}
+
+	i := slices.IndexFunc(d.tags, func(tag fins.Tag) bool { return tag.Name == m.GetName() })
+	if m.Name == nil && m.Alias != nil {
+		i = int(m.GetAlias()) - 1
+	}
+	if i < 0 || i >= len(d.tags) {
+		return nil, fmt.Errorf("unknown metric")
+	}
+	value, err := metricValue(d.tags[i], m)
+	if err != nil {
+		return nil, err
+	}
+	return &tagWrite{plc: d.name, tag: d.tags[i], value: value}, nil
+}
+
+// write writes the tag of a DCMD, Authorize and the write guard and audit trail of the
+// client apply
+func (n *EdgeNode) write(w tagWrite) error {
+	if authorize := n.opts.Authorize; authorize != nil {
+		if err := authorize(w.plc, w.tag, w.value); err != nil {
+			return err
+		}
+	}
+	c, ok := n.manager.Client(w.plc)
+	if !ok {
+		return fmt.Errorf("unknown PLC")
+	}
+	return c.WithAuditContext(map[string]string{"sparkplug": "DCMD"}).WriteTag(w.tag, w.value)
+}
+
+// topic returns the topic of a message type of the node, or of device when set
+func (n *EdgeNode) topic(kind, device string) string {
+	topic := NAMESPACE + "/" + n.opts.GroupID + "/" + kind + "/" + n.opts.NodeID
+	if device != "" {
+		topic += "/" + device
+	}
+	return topic
+}
+
+func (n *EdgeNode) sortedDevices() []*device {
+	devices := make([]*device, 0, len(n.devices))
+	for _, d := range n.devices {
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].name < devices[j].name })
+	return devices
+}
+
+func allFailed(values []fins.TagValue) bool {
+	for _, v := range values {
+		if v.Err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func connectedMetric(d *device) string {
+	return "PLCs/" + d.name + "/Connected"
+}
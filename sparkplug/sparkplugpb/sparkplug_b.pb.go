@@ -0,0 +1,540 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.5
+// 	protoc        (unknown)
+// source: sparkplug_b.proto
+
+// Sparkplug B payload, the subset of the Eclipse Tahu sparkplug_b.proto used by
+// folke99/gofins/sparkplug. Field numbers match the specification, so payloads are
+// compatible with every Sparkplug B host application.
+
+package sparkplugpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// DataType is the type of a metric
+type DataType int32
+
+const (
+	DataType_Unknown  DataType = 0
+	DataType_Int8     DataType = 1
+	DataType_Int16    DataType = 2
+	DataType_Int32    DataType = 3
+	DataType_Int64    DataType = 4
+	DataType_UInt8    DataType = 5
+	DataType_UInt16   DataType = 6
+	DataType_UInt32   DataType = 7
+	DataType_UInt64   DataType = 8
+	DataType_Float    DataType = 9
+	DataType_Double   DataType = 10
+	DataType_Boolean  DataType = 11
+	DataType_String   DataType = 12
+	DataType_DateTime DataType = 13
+	DataType_Text     DataType = 14
+)
+
+// Enum value maps for DataType.
+var (
+	DataType_name = map[int32]string{
+		0:  "Unknown",
+		1:  "Int8",
+		2:  "Int16",
+		3:  "Int32",
+		4:  "Int64",
+		5:  "UInt8",
+		6:  "UInt16",
+		7:  "UInt32",
+		8:  "UInt64",
+		9:  "Float",
+		10: "Double",
+		11: "Boolean",
+		12: "String",
+		13: "DateTime",
+		14: "Text",
+	}
+	DataType_value = map[string]int32{
+		"Unknown":  0,
+		"Int8":     1,
+		"Int16":    2,
+		"Int32":    3,
+		"Int64":    4,
+		"UInt8":    5,
+		"UInt16":   6,
+		"UInt32":   7,
+		"UInt64":   8,
+		"Float":    9,
+		"Double":   10,
+		"Boolean":  11,
+		"String":   12,
+		"DateTime": 13,
+		"Text":     14,
+	}
+)
+
+func (x DataType) Enum() *DataType {
+	p := new(DataType)
+	*p = x
+	return p
+}
+
+func (x DataType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (DataType) Descriptor() protoreflect.EnumDescriptor {
+	return file_sparkplug_b_proto_enumTypes[0].Descriptor()
+}
+
+func (DataType) Type() protoreflect.EnumType {
+	return &file_sparkplug_b_proto_enumTypes[0]
+}
+
+func (x DataType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Do not use.
+func (x *DataType) UnmarshalJSON(b []byte) error {
+	num, err := protoimpl.X.UnmarshalJSONEnum(x.Descriptor(), b)
+	if err != nil {
+		return err
+	}
+	*x = DataType(num)
+	return nil
+}
+
+// Deprecated: Use DataType.Descriptor instead.
+func (DataType) EnumDescriptor() ([]byte, []int) {
+	return file_sparkplug_b_proto_rawDescGZIP(), []int{0}
+}
+
+type Payload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp     *uint64                `protobuf:"varint,1,opt,name=timestamp" json:"timestamp,omitempty"` // Milliseconds since the Unix epoch
+	Metrics       []*Payload_Metric      `protobuf:"bytes,2,rep,name=metrics" json:"metrics,omitempty"`
+	Seq           *uint64                `protobuf:"varint,3,opt,name=seq" json:"seq,omitempty"`
+	Uuid          *string                `protobuf:"bytes,4,opt,name=uuid" json:"uuid,omitempty"`
+	Body          []byte                 `protobuf:"bytes,5,opt,name=body" json:"body,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Payload) Reset() {
+	*x = Payload{}
+	mi := &file_sparkplug_b_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Payload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Payload) ProtoMessage() {}
+
+func (x *Payload) ProtoReflect() protoreflect.Message {
+	mi := &file_sparkplug_b_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Payload.ProtoReflect.Descriptor instead.
+func (*Payload) Descriptor() ([]byte, []int) {
+	return file_sparkplug_b_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Payload) GetTimestamp() uint64 {
+	if x != nil && x.Timestamp != nil {
+		return *x.Timestamp
+	}
+	return 0
+}
+
+func (x *Payload) GetMetrics() []*Payload_Metric {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *Payload) GetSeq() uint64 {
+	if x != nil && x.Seq != nil {
+		return *x.Seq
+	}
+	return 0
+}
+
+func (x *Payload) GetUuid() string {
+	if x != nil && x.Uuid != nil {
+		return *x.Uuid
+	}
+	return ""
+}
+
+func (x *Payload) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+type Payload_Metric struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Name         *string                `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Alias        *uint64                `protobuf:"varint,2,opt,name=alias" json:"alias,omitempty"`
+	Timestamp    *uint64                `protobuf:"varint,3,opt,name=timestamp" json:"timestamp,omitempty"` // Milliseconds since the Unix epoch
+	Datatype     *uint32                `protobuf:"varint,4,opt,name=datatype" json:"datatype,omitempty"`   // DataType
+	IsHistorical *bool                  `protobuf:"varint,5,opt,name=is_historical,json=isHistorical" json:"is_historical,omitempty"`
+	IsTransient  *bool                  `protobuf:"varint,6,opt,name=is_transient,json=isTransient" json:"is_transient,omitempty"`
+	IsNull       *bool                  `protobuf:"varint,7,opt,name=is_null,json=isNull" json:"is_null,omitempty"`
+	// Types that are valid to be assigned to Value:
+	//
+	//	*Payload_Metric_IntValue
+	//	*Payload_Metric_LongValue
+	//	*Payload_Metric_FloatValue
+	//	*Payload_Metric_DoubleValue
+	//	*Payload_Metric_BooleanValue
+	//	*Payload_Metric_StringValue
+	//	*Payload_Metric_BytesValue
+	Value         isPayload_Metric_Value `protobuf_oneof:"value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Payload_Metric) Reset() {
+	*x = Payload_Metric{}
+	mi := &file_sparkplug_b_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Payload_Metric) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Payload_Metric) ProtoMessage() {}
+
+func (x *Payload_Metric) ProtoReflect() protoreflect.Message {
+	mi := &file_sparkplug_b_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Payload_Metric.ProtoReflect.Descriptor instead.
+func (*Payload_Metric) Descriptor() ([]byte, []int) {
+	return file_sparkplug_b_proto_rawDescGZIP(), []int{0, 0}
+}
+
+func (x *Payload_Metric) GetName() string {
+	if x != nil && x.Name != nil {
+		return *x.Name
+	}
+	return ""
+}
+
+func (x *Payload_Metric) GetAlias() uint64 {
+	if x != nil && x.Alias != nil {
+		return *x.Alias
+	}
+	return 0
+}
+
+func (x *Payload_Metric) GetTimestamp() uint64 {
+	if x != nil && x.Timestamp != nil {
+		return *x.Timestamp
+	}
+	return 0
+}
+
+func (x *Payload_Metric) GetDatatype() uint32 {
+	if x != nil && x.Datatype != nil {
+		return *x.Datatype
+	}
+	return 0
+}
+
+func (x *Payload_Metric) GetIsHistorical() bool {
+	if x != nil && x.IsHistorical != nil {
+		return *x.IsHistorical
+	}
+	return false
+}
+
+func (x *Payload_Metric) GetIsTransient() bool {
+	if x != nil && x.IsTransient != nil {
+		return *x.IsTransient
+	}
+	return false
+}
+
+func (x *Payload_Metric) GetIsNull() bool {
+	if x != nil && x.IsNull != nil {
+		return *x.IsNull
+	}
+	return false
+}
+
+func (x *Payload_Metric) GetValue() isPayload_Metric_Value {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *Payload_Metric) GetIntValue() uint32 {
+	if x != nil {
+		if x, ok := x.Value.(*Payload_Metric_IntValue); ok {
+			return x.IntValue
+		}
+	}
+	return 0
+}
+
+func (x *Payload_Metric) GetLongValue() uint64 {
+	if x != nil {
+		if x, ok := x.Value.(*Payload_Metric_LongValue); ok {
+			return x.LongValue
+		}
+	}
+	return 0
+}
+
+func (x *Payload_Metric) GetFloatValue() float32 {
+	if x != nil {
+		if x, ok := x.Value.(*Payload_Metric_FloatValue); ok {
+			return x.FloatValue
+		}
+	}
+	return 0
+}
+
+func (x *Payload_Metric) GetDoubleValue() float64 {
+	if x != nil {
+		if x, ok := x.Value.(*Payload_Metric_DoubleValue); ok {
+			return x.DoubleValue
+		}
+	}
+	return 0
+}
+
+func (x *Payload_Metric) GetBooleanValue() bool {
+	if x != nil {
+		if x, ok := x.Value.(*Payload_Metric_BooleanValue); ok {
+			return x.BooleanValue
+		}
+	}
+	return false
+}
+
+func (x *Payload_Metric) GetStringValue() string {
+	if x != nil {
+		if x, ok := x.Value.(*Payload_Metric_StringValue); ok {
+			return x.StringValue
+		}
+	}
+	return ""
+}
+
+func (x *Payload_Metric) GetBytesValue() []byte {
+	if x != nil {
+		if x, ok := x.Value.(*Payload_Metric_BytesValue); ok {
+			return x.BytesValue
+		}
+	}
+	return nil
+}
+
+type isPayload_Metric_Value interface {
+	isPayload_Metric_Value()
+}
+
+type Payload_Metric_IntValue struct {
+	IntValue uint32 `protobuf:"varint,10,opt,name=int_value,json=intValue,oneof"` // Int8 to UInt32, signed values in two's complement
+}
+
+type Payload_Metric_LongValue struct {
+	LongValue uint64 `protobuf:"varint,11,opt,name=long_value,json=longValue,oneof"` // Int64, UInt64 and DateTime
+}
+
+type Payload_Metric_FloatValue struct {
+	FloatValue float32 `protobuf:"fixed32,12,opt,name=float_value,json=floatValue,oneof"`
+}
+
+type Payload_Metric_DoubleValue struct {
+	DoubleValue float64 `protobuf:"fixed64,13,opt,name=double_value,json=doubleValue,oneof"`
+}
+
+type Payload_Metric_BooleanValue struct {
+	BooleanValue bool `protobuf:"varint,14,opt,name=boolean_value,json=booleanValue,oneof"`
+}
+
+type Payload_Metric_StringValue struct {
+	StringValue string `protobuf:"bytes,15,opt,name=string_value,json=stringValue,oneof"`
+}
+
+type Payload_Metric_BytesValue struct {
+	BytesValue []byte `protobuf:"bytes,16,opt,name=bytes_value,json=bytesValue,oneof"`
+}
+
+func (*Payload_Metric_IntValue) isPayload_Metric_Value() {}
+
+func (*Payload_Metric_LongValue) isPayload_Metric_Value() {}
+
+func (*Payload_Metric_FloatValue) isPayload_Metric_Value() {}
+
+func (*Payload_Metric_DoubleValue) isPayload_Metric_Value() {}
+
+func (*Payload_Metric_BooleanValue) isPayload_Metric_Value() {}
+
+func (*Payload_Metric_StringValue) isPayload_Metric_Value() {}
+
+func (*Payload_Metric_BytesValue) isPayload_Metric_Value() {}
+
+var File_sparkplug_b_proto protoreflect.FileDescriptor
+
+var file_sparkplug_b_proto_rawDesc = string([]byte{
+	0x0a, 0x11, 0x73, 0x70, 0x61, 0x72, 0x6b, 0x70, 0x6c, 0x75, 0x67, 0x5f, 0x62, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x12, 0x19, 0x6f, 0x72, 0x67, 0x2e, 0x65, 0x63, 0x6c, 0x69, 0x70, 0x73, 0x65,
+	0x2e, 0x74, 0x61, 0x68, 0x75, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x22, 0xf6,
+	0x04, 0x0a, 0x07, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69,
+	0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x74,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x43, 0x0a, 0x07, 0x6d, 0x65, 0x74, 0x72,
+	0x69, 0x63, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x29, 0x2e, 0x6f, 0x72, 0x67, 0x2e,
+	0x65, 0x63, 0x6c, 0x69, 0x70, 0x73, 0x65, 0x2e, 0x74, 0x61, 0x68, 0x75, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x2e, 0x4d, 0x65,
+	0x74, 0x72, 0x69, 0x63, 0x52, 0x07, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x12, 0x10, 0x0a,
+	0x03, 0x73, 0x65, 0x71, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x73, 0x65, 0x71, 0x12,
+	0x12, 0x0a, 0x04, 0x75, 0x75, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x75,
+	0x75, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x04, 0x62, 0x6f, 0x64, 0x79, 0x1a, 0xcd, 0x03, 0x0a, 0x06, 0x4d, 0x65, 0x74, 0x72,
+	0x69, 0x63, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x61, 0x6c, 0x69, 0x61, 0x73, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x61, 0x6c, 0x69, 0x61, 0x73, 0x12, 0x1c, 0x0a, 0x09,
+	0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x61,
+	0x74, 0x61, 0x74, 0x79, 0x70, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x64, 0x61,
+	0x74, 0x61, 0x74, 0x79, 0x70, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x69, 0x73, 0x5f, 0x68, 0x69, 0x73,
+	0x74, 0x6f, 0x72, 0x69, 0x63, 0x61, 0x6c, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0c, 0x69,
+	0x73, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x69, 0x63, 0x61, 0x6c, 0x12, 0x21, 0x0a, 0x0c, 0x69,
+	0x73, 0x5f, 0x74, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x65, 0x6e, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x0b, 0x69, 0x73, 0x54, 0x72, 0x61, 0x6e, 0x73, 0x69, 0x65, 0x6e, 0x74, 0x12, 0x17,
+	0x0a, 0x07, 0x69, 0x73, 0x5f, 0x6e, 0x75, 0x6c, 0x6c, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x06, 0x69, 0x73, 0x4e, 0x75, 0x6c, 0x6c, 0x12, 0x1d, 0x0a, 0x09, 0x69, 0x6e, 0x74, 0x5f, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0d, 0x48, 0x00, 0x52, 0x08, 0x69, 0x6e,
+	0x74, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x1f, 0x0a, 0x0a, 0x6c, 0x6f, 0x6e, 0x67, 0x5f, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x04, 0x48, 0x00, 0x52, 0x09, 0x6c, 0x6f,
+	0x6e, 0x67, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x21, 0x0a, 0x0b, 0x66, 0x6c, 0x6f, 0x61, 0x74,
+	0x5f, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x02, 0x48, 0x00, 0x52, 0x0a,
+	0x66, 0x6c, 0x6f, 0x61, 0x74, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x23, 0x0a, 0x0c, 0x64, 0x6f,
+	0x75, 0x62, 0x6c, 0x65, 0x5f, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x01,
+	0x48, 0x00, 0x52, 0x0b, 0x64, 0x6f, 0x75, 0x62, 0x6c, 0x65, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12,
+	0x25, 0x0a, 0x0d, 0x62, 0x6f, 0x6f, 0x6c, 0x65, 0x61, 0x6e, 0x5f, 0x76, 0x61, 0x6c, 0x75, 0x65,
+	0x18, 0x0e, 0x20, 0x01, 0x28, 0x08, 0x48, 0x00, 0x52, 0x0c, 0x62, 0x6f, 0x6f, 0x6c, 0x65, 0x61,
+	0x6e, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x23, 0x0a, 0x0c, 0x73, 0x74, 0x72, 0x69, 0x6e, 0x67,
+	0x5f, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x0b,
+	0x73, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x12, 0x21, 0x0a, 0x0b, 0x62,
+	0x79, 0x74, 0x65, 0x73, 0x5f, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x10, 0x20, 0x01, 0x28, 0x0c,
+	0x48, 0x00, 0x52, 0x0a, 0x62, 0x79, 0x74, 0x65, 0x73, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x42, 0x07,
+	0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x2a, 0xb9, 0x01, 0x0a, 0x08, 0x44, 0x61, 0x74, 0x61,
+	0x54, 0x79, 0x70, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x6e, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x10,
+	0x00, 0x12, 0x08, 0x0a, 0x04, 0x49, 0x6e, 0x74, 0x38, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x49,
+	0x6e, 0x74, 0x31, 0x36, 0x10, 0x02, 0x12, 0x09, 0x0a, 0x05, 0x49, 0x6e, 0x74, 0x33, 0x32, 0x10,
+	0x03, 0x12, 0x09, 0x0a, 0x05, 0x49, 0x6e, 0x74, 0x36, 0x34, 0x10, 0x04, 0x12, 0x09, 0x0a, 0x05,
+	0x55, 0x49, 0x6e, 0x74, 0x38, 0x10, 0x05, 0x12, 0x0a, 0x0a, 0x06, 0x55, 0x49, 0x6e, 0x74, 0x31,
+	0x36, 0x10, 0x06, 0x12, 0x0a, 0x0a, 0x06, 0x55, 0x49, 0x6e, 0x74, 0x33, 0x32, 0x10, 0x07, 0x12,
+	0x0a, 0x0a, 0x06, 0x55, 0x49, 0x6e, 0x74, 0x36, 0x34, 0x10, 0x08, 0x12, 0x09, 0x0a, 0x05, 0x46,
+	0x6c, 0x6f, 0x61, 0x74, 0x10, 0x09, 0x12, 0x0a, 0x0a, 0x06, 0x44, 0x6f, 0x75, 0x62, 0x6c, 0x65,
+	0x10, 0x0a, 0x12, 0x0b, 0x0a, 0x07, 0x42, 0x6f, 0x6f, 0x6c, 0x65, 0x61, 0x6e, 0x10, 0x0b, 0x12,
+	0x0a, 0x0a, 0x06, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x10, 0x0c, 0x12, 0x0c, 0x0a, 0x08, 0x44,
+	0x61, 0x74, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x10, 0x0d, 0x12, 0x08, 0x0a, 0x04, 0x54, 0x65, 0x78,
+	0x74, 0x10, 0x0e, 0x42, 0x26, 0x5a, 0x24, 0x66, 0x6f, 0x6c, 0x6b, 0x65, 0x39, 0x39, 0x2f, 0x67,
+	0x6f, 0x66, 0x69, 0x6e, 0x73, 0x2f, 0x73, 0x70, 0x61, 0x72, 0x6b, 0x70, 0x6c, 0x75, 0x67, 0x2f,
+	0x73, 0x70, 0x61, 0x72, 0x6b, 0x70, 0x6c, 0x75, 0x67, 0x70, 0x62,
+})
+
+var (
+	file_sparkplug_b_proto_rawDescOnce sync.Once
+	file_sparkplug_b_proto_rawDescData []byte
+)
+
+func file_sparkplug_b_proto_rawDescGZIP() []byte {
+	file_sparkplug_b_proto_rawDescOnce.Do(func() {
+		file_sparkplug_b_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_sparkplug_b_proto_rawDesc), len(file_sparkplug_b_proto_rawDesc)))
+	})
+	return file_sparkplug_b_proto_rawDescData
+}
+
+var file_sparkplug_b_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_sparkplug_b_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_sparkplug_b_proto_goTypes = []any{
+	(DataType)(0),          // 0: org.eclipse.tahu.protobuf.DataType
+	(*Payload)(nil),        // 1: org.eclipse.tahu.protobuf.Payload
+	(*Payload_Metric)(nil), // 2: org.eclipse.tahu.protobuf.Payload.Metric
+}
+var file_sparkplug_b_proto_depIdxs = []int32{
+	2, // 0: org.eclipse.tahu.protobuf.Payload.metrics:type_name -> org.eclipse.tahu.protobuf.Payload.Metric
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_sparkplug_b_proto_init() }
+func file_sparkplug_b_proto_init() {
+	if File_sparkplug_b_proto != nil {
+		return
+	}
+	file_sparkplug_b_proto_msgTypes[1].OneofWrappers = []any{
+		(*Payload_Metric_IntValue)(nil),
+		(*Payload_Metric_LongValue)(nil),
+		(*Payload_Metric_FloatValue)(nil),
+		(*Payload_Metric_DoubleValue)(nil),
+		(*Payload_Metric_BooleanValue)(nil),
+		(*Payload_Metric_StringValue)(nil),
+		(*Payload_Metric_BytesValue)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_sparkplug_b_proto_rawDesc), len(file_sparkplug_b_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_sparkplug_b_proto_goTypes,
+		DependencyIndexes: file_sparkplug_b_proto_depIdxs,
+		EnumInfos:         file_sparkplug_b_proto_enumTypes,
+		MessageInfos:      file_sparkplug_b_proto_msgTypes,
+	}.Build()
+	File_sparkplug_b_proto = out.File
+	file_sparkplug_b_proto_goTypes = nil
+	file_sparkplug_b_proto_depIdxs = nil
+}
@@ -0,0 +1,156 @@
+package fins
+
+import (
+	"testing"
+	"time"
+
+	"folke99/gofins/alarms"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// alarmRecorder collects the events of an Engine
+type alarmRecorder struct {
+	events []alarms.Event
+}
+
+func (r *alarmRecorder) handle(ev alarms.Event) {
+	r.events = append(r.events, ev)
+}
+
+// take returns the collected events as "alarm TYPE" strings and clears them
+func (r *alarmRecorder) take() []string {
+	var out []string
+	for _, ev := range r.events {
+		out = append(out, ev.Alarm+" "+ev.Type.String())
+	}
+	r.events = nil
+	return out
+}
+
+func TestAlarmEngine(t *testing.T) {
+	start := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	at := func(seconds float64) time.Time {
+		return start.Add(time.Duration(seconds * float64(time.Second)))
+	}
+
+	t.Run("Raise And Clear With Hysteresis", func(t *testing.T) {
+		var r alarmRecorder
+		e := alarms.NewEngine(r.handle)
+		require.NoError(t, e.Add(alarms.Definition{Name: "overheat", Tag: "temp", Condition: alarms.ConditionHigh, Limit: 100, Hysteresis: 5}))
+		require.NoError(t, e.Add(alarms.Definition{Name: "underheat", Tag: "temp", Condition: alarms.ConditionLow, Limit: 20, Hysteresis: 5}))
+
+		e.Update("temp", 100, at(0))
+		assert.Empty(t, r.take(), "the limit itself is not exceeded")
+		e.Update("temp", 101, at(1))
+		assert.Equal(t, []alarms.Event{{Alarm: "overheat", Tag: "temp", Type: alarms.EventActive, Value: 101, Timestamp: at(1)}}, r.events)
+		r.take()
+		assert.Equal(t, []string{"overheat"}, e.Active())
+
+		e.Update("temp", 96, at(2))
+		assert.Empty(t, r.take(), "within the hysteresis the alarm stays active")
+		e.Update("temp", 94, at(3))
+		assert.Equal(t, []string{"overheat CLEARED"}, r.take())
+
+		e.Update("temp", 19, at(4))
+		e.Update("temp", 24, at(5))
+		assert.Equal(t, []string{"underheat ACTIVE"}, r.take())
+		e.Update("temp", 26, at(6))
+		assert.Equal(t, []string{"underheat CLEARED"}, r.take())
+		assert.Empty(t, e.Active())
+
+		e.Update("other", 1000, at(7))
+		assert.Empty(t, r.take(), "other tags don't affect the alarms")
+	})
+
+	t.Run("Bit Set", func(t *testing.T) {
+		var r alarmRecorder
+		e := alarms.NewEngine(r.handle)
+		require.NoError(t, e.Add(alarms.Definition{Name: "door", Tag: "doorOpen", Condition: alarms.ConditionBitSet}))
+
+		e.Update("doorOpen", 0, at(0))
+		e.Update("doorOpen", 1, at(1))
+		e.Update("doorOpen", 1, at(2))
+		e.Update("doorOpen", 0, at(3))
+		assert.Equal(t, []string{"door ACTIVE", "door CLEARED"}, r.take())
+	})
+
+	t.Run("Rate Of Change", func(t *testing.T) {
+		var r alarmRecorder
+		e := alarms.NewEngine(r.handle)
+		require.NoError(t, e.Add(alarms.Definition{Name: "ramp", Tag: "pressure", Condition: alarms.ConditionRateOfChange, Limit: 10}))
+
+		e.Update("pressure", 50, at(0))
+		assert.Empty(t, r.take(), "the first value has no rate")
+		e.Update("pressure", 55, at(1))
+		assert.Empty(t, r.take())
+		e.Update("pressure", 40, at(2))
+		assert.Equal(t, []string{"ramp ACTIVE"}, r.take(), "falling values count as well")
+		e.Update("pressure", 45, at(2))
+		assert.Empty(t, r.take(), "a value without elapsed time keeps the state")
+		e.Update("pressure", 47, at(3))
+		assert.Equal(t, []string{"ramp CLEARED"}, r.take())
+	})
+
+	t.Run("Debounce", func(t *testing.T) {
+		var r alarmRecorder
+		e := alarms.NewEngine(r.handle)
+		require.NoError(t, e.Add(alarms.Definition{Name: "overheat", Tag: "temp", Condition: alarms.ConditionHigh, Limit: 100, Debounce: 2 * time.Second}))
+
+		e.Update("temp", 120, at(0))
+		e.Update("temp", 90, at(1))
+		e.Update("temp", 120, at(3))
+		assert.Empty(t, r.take(), "a spike shorter than the debounce is not reported")
+
+		e.Update("temp", 120, at(4))
+		assert.Empty(t, r.take())
+		e.Update("temp", 120, at(5))
+		require.Len(t, r.events, 1)
+		assert.Equal(t, at(5), r.events[0].Timestamp, "reported once the debounce passed")
+		assert.Equal(t, []string{"overheat ACTIVE"}, r.take())
+
+		e.Update("temp", 90, at(6))
+		e.Update("temp", 90, at(7))
+		assert.Empty(t, r.take())
+		e.Update("temp", 90, at(8))
+		assert.Equal(t, []string{"overheat CLEARED"}, r.take())
+	})
+
+	t.Run("Acknowledge", func(t *testing.T) {
+		var r alarmRecorder
+		e := alarms.NewEngine(r.handle)
+		require.NoError(t, e.Add(alarms.Definition{Name: "door", Tag: "doorOpen", Condition: alarms.ConditionBitSet}))
+
+		assert.ErrorContains(t, e.Acknowledge("door"), "nothing to acknowledge")
+		assert.ErrorContains(t, e.Acknowledge("missing"), "unknown alarm")
+
+		e.Update("doorOpen", 1, at(0))
+		require.NoError(t, e.Acknowledge("door"))
+		assert.Equal(t, []string{"door ACTIVE", "door ACKNOWLEDGED"}, r.take())
+		assert.Equal(t, []string{"door"}, e.Active(), "an acknowledged alarm stays active")
+		assert.Error(t, e.Acknowledge("door"), "an alarm is acknowledged once")
+
+		// An alarm that cleared unacknowledged still waits for its acknowledgement
+		e.Update("doorOpen", 0, at(1))
+		e.Update("doorOpen", 1, at(2))
+		e.Update("doorOpen", 0, at(3))
+		assert.Equal(t, []string{"door CLEARED", "door ACTIVE", "door CLEARED"}, r.take())
+		require.NoError(t, e.Acknowledge("door"))
+		assert.Equal(t, []string{"door ACKNOWLEDGED"}, r.take())
+	})
+
+	t.Run("Definitions", func(t *testing.T) {
+		e := alarms.NewEngine(nil)
+		assert.Error(t, e.Add(alarms.Definition{Tag: "temp"}))
+		assert.Error(t, e.Add(alarms.Definition{Name: "a"}))
+		assert.Error(t, e.Add(alarms.Definition{Name: "a", Tag: "temp", Hysteresis: -1}))
+		assert.Error(t, e.Add(alarms.Definition{Name: "a", Tag: "temp", Debounce: -time.Second}))
+		require.NoError(t, e.Add(alarms.Definition{Name: "a", Tag: "temp", Condition: alarms.ConditionHigh}))
+		assert.ErrorContains(t, e.Add(alarms.Definition{Name: "a", Tag: "pressure"}), "already defined")
+
+		// Without a handler the state is still tracked
+		e.Update("temp", 1, at(0))
+		assert.Equal(t, []string{"a"}, e.Active())
+	})
+}
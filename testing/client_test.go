@@ -1,10 +1,22 @@
 package fins
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"folke99/gofins/finsproto"
 	"folke99/gofins/mapping"
 	"folke99/gofins/simulator"
 
@@ -12,16 +24,17 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/japanese"
 )
 
 func setupTest(t *testing.T) (*fins.Client, *simulator.Server, func()) {
-	clientAddr, err := fins.NewAddress("0.0.0.0", 9600, 0, 2, 0)
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
 	require.NoError(t, err)
 
-	plcAddr, err := fins.NewAddress("0.0.0.0", 9601, 0, 10, 0)
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
 	require.NoError(t, err)
 
-	s, err := simulator.NewPLCSimulator(plcAddr.String())
+	plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, 10, 0)
 	require.NoError(t, err)
 
 	c, err := fins.NewClient(clientAddr, plcAddr)
@@ -89,6 +102,34 @@ func TestFINSProtocolImplementation(t *testing.T) {
 		}
 	})
 
+	t.Run("Bits Of Words", func(t *testing.T) {
+		require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 800, make([]uint16, 4)))
+		require.NoError(t, c.SetBit(mapping.MemoryAreaDMBit, 800, 0))
+		require.NoError(t, c.SetBit(mapping.MemoryAreaDMBit, 800, 15))
+		// Four bits from bit 14 of D801 continue in D802
+		require.NoError(t, c.WriteBits(mapping.MemoryAreaDMBit, 801, 14, []bool{true, true, true, false}))
+		words, err := c.ReadWords(mapping.MemoryAreaDMWord, 800, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{0x8001, 0xC000, 0x0001}, words)
+
+		require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 803, []uint16{0xA5F0}))
+		bits, err := c.ReadBits(mapping.MemoryAreaDMBit, 803, 4, 8)
+		require.NoError(t, err)
+		assert.Equal(t, []bool{true, true, true, true, true, false, true, false}, bits)
+
+		require.NoError(t, c.ToggleBit(mapping.MemoryAreaDMBit, 803, 0))
+		require.NoError(t, c.ResetBit(mapping.MemoryAreaDMBit, 803, 15))
+		words, err = c.ReadWords(mapping.MemoryAreaDMWord, 803, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{0x25F1}, words)
+
+		// Bit numbers above 15 don't address the next word
+		_, err = c.SendUnitCommand(fins.UNIT_CPU, mapping.CommandCodeMemoryAreaRead, []byte{byte(mapping.MemoryAreaDMBit), 0x03, 0x20, 0x10, 0x00, 0x01})
+		var endCodeErr fins.EndCodeError
+		require.ErrorAs(t, err, &endCodeErr)
+		assert.Equal(t, mapping.EndCodeAddressRangeError, endCodeErr.EndCode)
+	})
+
 	t.Run("String Operations", func(t *testing.T) {
 		testCases := []struct {
 			name    string
@@ -115,6 +156,102 @@ func TestFINSProtocolImplementation(t *testing.T) {
 	})
 }
 
+func TestRelayedDestination(t *testing.T) {
+	c, gateway, cleanup := setupTest(t)
+	defer cleanup()
+
+	remote, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	require.NoError(t, err)
+	defer remote.Close()
+	gateway.SetRoute(2, 5, remote)
+	require.NoError(t, remote.WriteDM(100, []uint16{42}))
+	require.NoError(t, gateway.WriteDM(100, []uint16{7}))
+
+	line := fins.Destination{Network: 2, Node: 5}
+	words, err := c.ReadWordsAt(line, mapping.MemoryAreaDMWord, 100, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{42}, words)
+	words, err = c.ReadWords(mapping.MemoryAreaDMWord, 100, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{7}, words, "the client still reaches the gateway")
+
+	require.NoError(t, c.WriteWordsAt(line, mapping.MemoryAreaDMWord, 101, []uint16{1, 2}))
+	stored, err := remote.ReadDM(101, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2}, stored)
+
+	// Every command of a destination handle is relayed, including unit commands
+	remote.SetMode(mapping.StatusStop, mapping.ModeProgram)
+	status, err := c.WithDestination(line).Status()
+	require.NoError(t, err)
+	assert.Equal(t, mapping.ModeProgram, status.Mode)
+	remote.SetUnit(fins.CPUBusUnit(0), func(r finsproto.Request) (uint16, []byte) {
+		return mapping.EndCodeNormalCompletion, []byte{0x55}
+	})
+	data, err := c.WithDestination(line).UnitCommand(fins.CPUBusUnit(0), 0x2801, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x55}, data)
+
+	var endCodeErr fins.EndCodeError
+	_, err = c.ReadWordsAt(fins.Destination{Network: 2, Node: 6}, mapping.MemoryAreaDMWord, 100, 1)
+	require.ErrorAs(t, err, &endCodeErr)
+	assert.Equal(t, mapping.EndCodeDestinationNodeNotInNetwork, endCodeErr.EndCode)
+	assert.ErrorContains(t, err, "read from 2.6.0 failed")
+	_, err = c.ReadWordsAt(fins.Destination{Network: 3, Node: 5}, mapping.MemoryAreaDMWord, 100, 1)
+	require.ErrorAs(t, err, &endCodeErr)
+	assert.Equal(t, mapping.EndCodeDestinationAddressSettingError, endCodeErr.EndCode)
+}
+
+func TestSelfTest(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	plcTime := time.Date(2026, 5, 4, 3, 2, 1, 0, time.Local)
+	s.HoldClock(true)
+	s.SetClock(plcTime)
+	require.NoError(t, s.WriteDM(0, []uint16{0x1234}))
+
+	report, err := c.SelfTest(context.Background())
+	require.NoError(t, err, report.String())
+	assert.True(t, report.OK())
+	assert.Equal(t, byte(2), report.ClientNode)
+	assert.Equal(t, byte(simulator.SIMULATOR_NODE), report.ServerNode)
+	require.NotNil(t, report.Status)
+	assert.True(t, report.Status.IsRunning())
+	assert.Equal(t, plcTime, report.Clock)
+	require.Len(t, report.Steps, 4)
+	assert.Equal(t, fins.SelfTestDMRead, report.Steps[3].Name)
+	assert.Equal(t, "D0 = 0x1234", report.Steps[3].Detail)
+
+	// A unit without a clock fails that step only
+	s.Replay([]simulator.Exchange{{CommandCode: mapping.CommandCodeClockRead, Request: []byte{}, EndCode: mapping.EndCodeUndefinedCommand}})
+	report, err = c.SelfTest(context.Background())
+	require.Error(t, err)
+	assert.ErrorContains(t, err, fins.SelfTestClockRead)
+	assert.True(t, report.Clock.IsZero())
+	for _, step := range report.Steps {
+		assert.Equal(t, step.Name == fins.SelfTestClockRead, step.Err != nil, step.Name)
+	}
+	s.Replay(nil)
+
+	s.SetLatency(simulator.FixedLatency(200 * time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	report, err = c.SelfTest(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Nil(t, report.Status, "an abandoned step leaves the report alone")
+	assert.NoError(t, report.Steps[0].Err)
+	s.SetLatency(nil)
+
+	c.Close()
+	report, err = c.SelfTest(context.Background())
+	require.Error(t, err)
+	require.Len(t, report.Steps, 4)
+	for _, step := range report.Steps {
+		assert.Error(t, step.Err, step.Name)
+	}
+}
+
 func TestTCPSpecificFeatures(t *testing.T) {
 	c, _, cleanup := setupTest(t)
 	defer cleanup()
@@ -124,6 +261,16 @@ func TestTCPSpecificFeatures(t *testing.T) {
 		require.NoError(t, err, "Failed to set keep-alive")
 	})
 
+	t.Run("Verify", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, c.Verify(ctx), "Verify should succeed against the simulator")
+
+		canceled, cancelNow := context.WithCancel(context.Background())
+		cancelNow()
+		assert.ErrorIs(t, c.Verify(canceled), context.Canceled)
+	})
+
 	t.Run("Connection Management", func(t *testing.T) {
 		// Test graceful close
 		c.Close()
@@ -142,6 +289,23 @@ func TestErrorHandling(t *testing.T) {
 		assert.IsType(t, fins.IncompatibleMemoryAreaError{}, err)
 	})
 
+	t.Run("Bit Area For Words", func(t *testing.T) {
+		_, err := c.ReadWords(mapping.MemoryAreaDMBit, 100, 5)
+		assert.IsType(t, fins.IncompatibleMemoryAreaError{}, err)
+		assert.Contains(t, err.Error(), "DM bit")
+	})
+
+	t.Run("Address Out Of Range", func(t *testing.T) {
+		_, err := c.ReadWords(mapping.MemoryAreaDMWord, 32767, 2)
+		assert.IsType(t, fins.AddressRangeError{}, err)
+
+		err = c.WriteWords(mapping.MemoryAreaDMWord, 32767, []uint16{1})
+		assert.NoError(t, err, "Last DM word should be writable")
+
+		_, err = c.ReadBits(mapping.MemoryAreaDMBit, 100, 16, 1)
+		assert.IsType(t, fins.AddressRangeError{}, err, "Bit offsets above 15 are invalid")
+	})
+
 	t.Run("Write With Invalid Length", func(t *testing.T) {
 		err := c.WriteBytes(mapping.MemoryAreaDMWord, 100, []byte{1}) // Single byte is invalid
 		assert.Error(t, err, "Should error on odd byte length")
@@ -194,6 +358,31 @@ func TestEdgeCases(t *testing.T) {
 		assert.Error(t, err, "Should handle large packet size appropriately")
 	})
 
+	t.Run("Frame Size Options", func(t *testing.T) {
+		s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+		require.NoError(t, err)
+		defer s.Close()
+		clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+		require.NoError(t, err)
+		plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, 10, 0)
+		require.NoError(t, err)
+
+		small, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{MaxFrameSize: 1004, ReceiveBufferSize: 512, ScannerBufferSize: 256})
+		require.NoError(t, err)
+		defer small.Close()
+
+		limit := small.TransferLimit(mapping.MemoryAreaDMWord)
+		assert.Equal(t, uint16((1004-fins.RESPONSE_OVERHEAD)/2), limit.Read)
+		_, err = small.ReadWords(mapping.MemoryAreaDMWord, 0, limit.Read)
+		assert.NoError(t, err, "the scanner buffer grows up to the frame size")
+		_, err = small.ReadWords(mapping.MemoryAreaDMWord, 0, limit.Read+1)
+		assert.Error(t, err)
+		assert.NoError(t, small.WriteWords(mapping.MemoryAreaDMWord, 0, make([]uint16, limit.Write)))
+
+		_, err = fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{MaxFrameSize: 16})
+		assert.Error(t, err)
+	})
+
 	t.Run("Zero Length Operations", func(t *testing.T) {
 		err := c.WriteWords(mapping.MemoryAreaDMWord, 100, []uint16{})
 		assert.Error(t, err, "Should handle zero length write appropriately")
@@ -202,3 +391,3514 @@ func TestEdgeCases(t *testing.T) {
 		assert.Error(t, err, "Should handle zero length read appropriately")
 	})
 }
+
+func TestProfiles(t *testing.T) {
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	require.NoError(t, err)
+	defer s.Close()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, 10, 0)
+	require.NoError(t, err)
+
+	t.Run("Detect", func(t *testing.T) {
+		c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{DetectProfile: true})
+		require.NoError(t, err)
+		defer c.Close()
+
+		assert.Equal(t, "CJ2", c.Profile().Name)
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		profile := mapping.ProfileCP1
+		c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{Profile: &profile})
+		require.NoError(t, err)
+		defer c.Close()
+
+		_, err = c.ReadWords(mapping.MemoryAreaDMWord, 0, 500)
+		assert.Error(t, err, "CP1 reads are limited to 499 words")
+		_, err = c.ReadWords(mapping.MemoryAreaDMWord, 0, 499)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Area Limits", func(t *testing.T) {
+		profile := mapping.ProfileCJ2
+		profile.AreaTransferLimits = map[mapping.MemoryArea]mapping.TransferLimit{mapping.MemoryAreaHRWord: {Read: 100, Write: 50}}
+		c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{
+			Profile:        &profile,
+			TransferLimits: map[mapping.MemoryArea]mapping.TransferLimit{mapping.MemoryAreaDMWord: {Read: 64}},
+		})
+		require.NoError(t, err)
+		defer c.Close()
+
+		assert.Equal(t, mapping.TransferLimit{Read: 100, Write: 50}, c.TransferLimit(mapping.MemoryAreaHRWord))
+		assert.Equal(t, mapping.TransferLimit{Read: 64, Write: 996}, c.TransferLimit(mapping.MemoryAreaDMWord), "the option overrides the profile")
+		assert.Equal(t, mapping.TransferLimit{Read: 999, Write: 996}, c.TransferLimit(mapping.MemoryAreaWRWord))
+
+		_, err = c.ReadWords(mapping.MemoryAreaHRWord, 0, 101)
+		assert.Error(t, err)
+		assert.Error(t, c.WriteWords(mapping.MemoryAreaHRWord, 0, make([]uint16, 51)))
+		_, err = c.ReadWords(mapping.MemoryAreaDMWord, 0, 65)
+		assert.Error(t, err)
+
+		// Chunked transfers follow the limit of the area
+		require.NoError(t, s.WriteDM(0, make([]uint16, 200)))
+		var buf bytes.Buffer
+		var progress []int
+		require.NoError(t, c.SnapshotArea(&buf, mapping.MemoryAreaDMWord, 0, 200, func(done, total int) { progress = append(progress, done) }))
+		assert.Equal(t, []int{64, 128, 192, 200}, progress)
+
+		require.NoError(t, s.WriteDM(150, []uint16{7}))
+		diffs, err := c.CompareLive(&fins.Snapshot{MemoryArea: mapping.MemoryAreaDMWord, Words: make([]uint16, 200)})
+		require.NoError(t, err)
+		assert.Equal(t, []fins.WordDiff{{MemoryArea: mapping.MemoryAreaDMWord, Address: 150, New: 7}}, diffs)
+	})
+
+	t.Run("Unsupported Command", func(t *testing.T) {
+		profile := mapping.ProfileNJNX
+		profile.Commands = []uint16{mapping.CommandCodeMemoryAreaRead}
+		c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{Profile: &profile})
+		require.NoError(t, err)
+		defer c.Close()
+
+		err = c.WriteWords(mapping.MemoryAreaDMWord, 0, []uint16{1})
+		assert.IsType(t, fins.UnsupportedCommandError{}, err)
+	})
+}
+
+// mapVariables is a VariableBackend holding variables in memory
+type mapVariables map[string]float64
+
+func (m mapVariables) ReadVariable(name string, dataType fins.DataType) (float64, error) {
+	return m[name], nil
+}
+
+func (m mapVariables) WriteVariable(name string, dataType fins.DataType, value float64) error {
+	m[name] = value
+	return nil
+}
+
+func TestVariableBackend(t *testing.T) {
+	c, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	tag := fins.Tag{Name: "setpoint", Variable: "Kiln.Setpoint", DataType: fins.DataTypeReal}
+
+	_, err := c.ReadTag(tag)
+	assert.Error(t, err, "Variable tags need a backend")
+
+	vars := mapVariables{}
+	c.SetVariableBackend(vars)
+
+	require.NoError(t, c.WriteTag(tag, 850.5))
+	assert.Equal(t, 850.5, vars["Kiln.Setpoint"])
+
+	value, err := c.ReadTag(tag)
+	require.NoError(t, err)
+	assert.Equal(t, 850.5, value)
+}
+
+// silentPLC completes the FINS/TCP handshake and never answers commands
+func silentPLC(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, _, err := finsproto.ReadTCPFrame(conn); err != nil {
+					return
+				}
+				conn.Write(finsproto.TCPFrame(finsproto.TCP_COMMAND_NODE_ADDRESS_RESPONSE, []byte{0, 0, 0, 2, 0, 0, 0, 10}))
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+	return l
+}
+
+func TestPerRequestTimeout(t *testing.T) {
+	l := silentPLC(t)
+	defer l.Close()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", l.Addr().(*net.TCPAddr).Port, 0, 10, 0)
+	require.NoError(t, err)
+
+	c, err := fins.NewClient(clientAddr, plcAddr)
+	require.NoError(t, err)
+	defer c.Close()
+
+	start := time.Now()
+	_, err = c.WithTimeout(50*time.Millisecond).ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second, "Handle timeout should override the 10s default")
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn) // Never answers the handshake
+		}
+	}()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", l.Addr().(*net.TCPAddr).Port, 0, 10, 0)
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{HandshakeTimeout: 50 * time.Millisecond})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestBackoff(t *testing.T) {
+	fib := fins.FibonacciBackoff{Unit: time.Millisecond, Max: 4 * time.Millisecond}
+	for attempt, want := range []time.Duration{1, 1, 2, 3, 4, 4} {
+		d, ok := fib.Next(attempt + 1)
+		require.True(t, ok)
+		assert.Equal(t, want*time.Millisecond, d, "attempt %d", attempt+1)
+	}
+
+	exp := fins.ExponentialBackoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, MaxAttempts: 4}
+	d, _ := exp.Next(3)
+	assert.Equal(t, 40*time.Millisecond, d)
+	d, _ = exp.Next(4)
+	assert.Equal(t, 50*time.Millisecond, d)
+	_, ok := exp.Next(5)
+	assert.False(t, ok)
+
+	jittered := fins.ExponentialBackoff{Initial: 100 * time.Millisecond, Jitter: 0.5}
+	d, _ = jittered.Next(1)
+	assert.InDelta(t, float64(100*time.Millisecond), float64(d), float64(50*time.Millisecond))
+}
+
+func TestReconnect(t *testing.T) {
+	// The PLC drops the first connection right after the handshake and keeps the next ones
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for first := true; ; first = false {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(drop bool) {
+				defer conn.Close()
+				if _, _, err := finsproto.ReadTCPFrame(conn); err != nil {
+					return
+				}
+				conn.Write(finsproto.TCPFrame(finsproto.TCP_COMMAND_NODE_ADDRESS_RESPONSE, []byte{0, 0, 0, 2, 0, 0, 0, 10}))
+				if !drop {
+					io.Copy(io.Discard, conn)
+				}
+			}(first)
+		}
+	}()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", l.Addr().(*net.TCPAddr).Port, 0, 10, 0)
+	require.NoError(t, err)
+
+	var attempts []fins.ReconnectAttempt
+	c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{
+		ReconnectBackoff:   fins.ConstantBackoff{Interval: 10 * time.Millisecond, MaxAttempts: 3},
+		OnReconnectAttempt: func(a fins.ReconnectAttempt) { attempts = append(attempts, a) },
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	reconnected := make(chan struct{}, 1)
+	c.OnReconnect(func() { reconnected <- struct{}{} })
+
+	time.Sleep(50 * time.Millisecond) // Let the listen loop see the dropped connection
+	require.NoError(t, c.Reconnect())
+
+	select {
+	case <-reconnected:
+	default:
+		t.Fatal("OnReconnect hook did not run")
+	}
+	require.Len(t, attempts, 1)
+	assert.NoError(t, attempts[0].Err)
+	assert.Equal(t, 10*time.Millisecond, attempts[0].Delay)
+}
+
+func TestConnectionEvents(t *testing.T) {
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	require.NoError(t, err)
+	defer s.Close()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, 10, 0)
+	require.NoError(t, err)
+
+	events := make(chan string, 8)
+	var disconnect, reconnect fins.ConnectionEvent
+	c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{
+		ReconnectBackoff: fins.ConstantBackoff{Interval: 10 * time.Millisecond, MaxAttempts: 3},
+		OnConnect:        func(e fins.ConnectionEvent) { events <- "connect" },
+		OnDisconnect:     func(e fins.ConnectionEvent) { disconnect = e; events <- "disconnect" },
+		OnReconnectSuccess: func(e fins.ConnectionEvent) {
+			reconnect = e
+			events <- "reconnect"
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "connect", <-events)
+
+	s.DisconnectClients()
+	select {
+	case e := <-events:
+		require.Equal(t, "disconnect", e)
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect was not called")
+	}
+	assert.Error(t, disconnect.Err)
+	assert.Equal(t, s.Addr().String(), disconnect.PLC)
+	assert.NotZero(t, disconnect.ClientNode)
+
+	require.NoError(t, c.Reconnect())
+	assert.Equal(t, "reconnect", <-events)
+	assert.Equal(t, 1, reconnect.Attempts)
+	assert.GreaterOrEqual(t, reconnect.Downtime, 10*time.Millisecond)
+	assert.Equal(t, disconnect.ServerNode, reconnect.ServerNode)
+
+	require.NoError(t, c.Close())
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, events, "Close is not a disconnect")
+}
+
+// scriptedPLC completes the FINS/TCP handshake and passes every command to answer
+func scriptedPLC(t *testing.T, answer func(conn net.Conn, req finsproto.Request)) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, _, err := finsproto.ReadTCPFrame(conn); err != nil {
+					return
+				}
+				conn.Write(finsproto.TCPFrame(finsproto.TCP_COMMAND_NODE_ADDRESS_RESPONSE, []byte{0, 0, 0, 2, 0, 0, 0, 10}))
+				for {
+					_, payload, err := finsproto.ReadTCPFrame(conn)
+					if err != nil {
+						return
+					}
+					if req, err := finsproto.DecodeRequest(payload); err == nil {
+						answer(conn, req)
+					}
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func responseFrame(req finsproto.Request, data ...byte) []byte {
+	return finsproto.TCPFrame(finsproto.TCP_COMMAND_FRAME_SEND, finsproto.EncodeResponse(finsproto.NewResponse(req, 0, data)))
+}
+
+func scriptedClient(t *testing.T, l net.Listener, opts fins.Options) *fins.Client {
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", l.Addr().(*net.TCPAddr).Port, 0, 10, 0)
+	require.NoError(t, err)
+	c, err := fins.NewClientWithOptions(clientAddr, plcAddr, opts)
+	require.NoError(t, err)
+	return c
+}
+
+func TestResponseDelivery(t *testing.T) {
+	// The PLC answers every command twice
+	l := scriptedPLC(t, func(conn net.Conn, req finsproto.Request) {
+		conn.Write(append(responseFrame(req, 0, 1), responseFrame(req, 0, 2)...))
+	})
+	defer l.Close()
+
+	for _, policy := range []fins.DeliveryPolicy{fins.DeliveryDrop, fins.DeliveryReplace, fins.DeliveryBlock} {
+		t.Run(policy.String(), func(t *testing.T) {
+			c := scriptedClient(t, l, fins.Options{ResponseDelivery: policy})
+			defer c.Close()
+
+			for i := range 3 {
+				words, err := c.WithTimeout(time.Second).ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+				require.NoError(t, err)
+				if policy == fins.DeliveryReplace {
+					assert.Contains(t, [][]uint16{{1}, {2}}, words)
+				} else {
+					assert.Equal(t, []uint16{1}, words, "the first response wins")
+				}
+				assert.Eventually(t, func() bool { return c.Diagnostics().Discarded == uint64(i+1) },
+					time.Second, time.Millisecond, "every command takes exactly one response")
+			}
+		})
+	}
+}
+
+func TestIncomingCommand(t *testing.T) {
+	// The PLC sends a command when the client reads D0, and answers D100 reads with 42
+	replies := make(chan finsproto.Request, 1)
+	l := scriptedPLC(t, func(conn net.Conn, req finsproto.Request) {
+		if !req.Header.IsCommand() {
+			replies <- req // The reply of the client, decoded the same way
+			return
+		}
+		if binary.BigEndian.Uint16(req.Data[1:3]) == 100 {
+			conn.Write(responseFrame(req, 0, 42))
+			return
+		}
+		conn.Write(responseFrame(req, 0, 0))
+		header := finsproto.EncodeHeader(finsproto.Header{ICF: 0x80, GCT: 2, DA1: 2, SA1: 10, SID: 0x77})
+		command := finsproto.WriteCommand(finsproto.MemoryAddress{MemoryArea: byte(mapping.MemoryAreaDMWord), Address: 500}, 1, []byte{0, 7})
+		conn.Write(finsproto.TCPFrame(finsproto.TCP_COMMAND_FRAME_SEND, append(header, command...)))
+	})
+	defer l.Close()
+	c := scriptedClient(t, l, fins.Options{})
+	defer c.Close()
+
+	// The handler reads from the PLC, which needs the listen loop to deliver the response
+	handled := make(chan []uint16, 1)
+	c.OnCommand(func(req fins.Request) (uint16, []byte) {
+		words, err := c.WithTimeout(time.Second).ReadWords(mapping.MemoryAreaDMWord, 100, 1)
+		assert.NoError(t, err)
+		handled <- words
+		return mapping.EndCodeNormalCompletion, nil
+	})
+
+	_, err := c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	require.NoError(t, err)
+	select {
+	case words := <-handled:
+		assert.Equal(t, []uint16{42}, words)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler didn't get its response")
+	}
+	select {
+	case reply := <-replies:
+		assert.Equal(t, byte(0x77), reply.Header.SID)
+		assert.Equal(t, mapping.CommandCodeMemoryAreaWrite, reply.CommandCode)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply to the PLC")
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	r, err := fins.NewReceiver("127.0.0.1:0", 1)
+	require.NoError(t, err)
+	defer r.Close()
+
+	// The PLC connects and sends memory area writes as a SEND instruction does
+	conn, err := net.Dial("tcp", r.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Write(finsproto.TCPFrame(finsproto.TCP_COMMAND_NODE_ADDRESS_REQUEST, []byte{0, 0, 0, 10}))
+	require.NoError(t, err)
+	_, payload, err := finsproto.ReadTCPFrame(conn)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 10, 0, 0, 0, 1}, payload)
+
+	// PLCs requesting node 0 are assigned nodes no other connection uses
+	for i, node := range []byte{2, 3, 4} {
+		requested := byte(0)
+		if i == 0 {
+			requested = node
+		}
+		other, err := net.Dial("tcp", r.Addr().String())
+		require.NoError(t, err)
+		defer other.Close()
+		require.NoError(t, other.SetDeadline(time.Now().Add(5*time.Second)))
+		_, err = other.Write(finsproto.TCPFrame(finsproto.TCP_COMMAND_NODE_ADDRESS_REQUEST, []byte{0, 0, 0, requested}))
+		require.NoError(t, err)
+		_, payload, err := finsproto.ReadTCPFrame(other)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0, 0, 0, node, 0, 0, 0, 1}, payload)
+	}
+
+	send := func(sid byte, value byte) uint16 {
+		header := finsproto.EncodeHeader(finsproto.Header{ICF: 0x80, GCT: 2, DA1: 1, SA1: 10, SID: sid})
+		command := finsproto.WriteCommand(finsproto.MemoryAddress{MemoryArea: byte(mapping.MemoryAreaDMWord), Address: 200}, 1, []byte{0, value})
+		_, err := conn.Write(finsproto.TCPFrame(finsproto.TCP_COMMAND_FRAME_SEND, append(header, command...)))
+		require.NoError(t, err)
+		_, payload, err := finsproto.ReadTCPFrame(conn)
+		require.NoError(t, err)
+		resp, err := finsproto.DecodeResponse(payload)
+		require.NoError(t, err)
+		assert.Equal(t, sid, resp.Header.SID)
+		return resp.EndCode
+	}
+
+	assert.Equal(t, mapping.EndCodeNormalCompletion, send(1, 5))
+	event := <-r.Events()
+	require.NotNil(t, event.Memory)
+	assert.Equal(t, uint16(200), event.Memory.Address.Address)
+	assert.Equal(t, []uint16{5}, event.Memory.Words())
+
+	// Nobody drains the events, the connection keeps being answered
+	for i := range fins.RECEIVER_EVENT_BUFFER {
+		require.Equal(t, mapping.EndCodeNormalCompletion, send(byte(i), byte(i)))
+	}
+	assert.Equal(t, mapping.EndCodeDestinationNodeBusy, send(0xFF, 0xFF), "the PLC repeats a dropped SEND")
+	assert.Equal(t, uint64(1), r.Dropped())
+
+	require.NoError(t, r.Close())
+	var received int
+	for range r.Events() {
+		received++
+	}
+	assert.Equal(t, fins.RECEIVER_EVENT_BUFFER, received, "Close closes the channel after the buffered events")
+}
+
+func TestLateResponse(t *testing.T) {
+	// The first command to SID 1 is answered after the client gave up
+	var late sync.Once
+	l := scriptedPLC(t, func(conn net.Conn, req finsproto.Request) {
+		delayed := false
+		if req.Header.SID == 1 {
+			late.Do(func() { delayed = true })
+		}
+		if delayed {
+			time.AfterFunc(150*time.Millisecond, func() { conn.Write(responseFrame(req, 0, 9)) })
+			return
+		}
+		conn.Write(responseFrame(req, 0, 2))
+	})
+	defer l.Close()
+
+	c := scriptedClient(t, l, fins.Options{MinSID: 1, MaxSID: 2})
+	defer c.Close()
+
+	_, err := c.WithTimeout(50*time.Millisecond).ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	require.Error(t, err)
+	for range 2 {
+		words, err := c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{2}, words)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{2}, words)
+
+	diag := c.Diagnostics()
+	assert.Equal(t, uint64(1), diag.Discarded, "the late response is discarded")
+	var sids []byte
+	for _, e := range diag.Recent {
+		sids = append(sids, e.SID)
+	}
+	assert.Equal(t, []byte{1, 2, 2, 1}, sids, "SID 1 is reserved until its late response arrived")
+}
+
+func TestDeliveryTimeoutRace(t *testing.T) {
+	// Responses arrive around the timeout, each answers with the address it was asked for
+	l := scriptedPLC(t, func(conn net.Conn, req finsproto.Request) {
+		delay := time.Duration(req.Data[2]%4) * 500 * time.Microsecond
+		time.AfterFunc(delay, func() { conn.Write(responseFrame(req, req.Data[1], req.Data[2])) })
+	})
+	defer l.Close()
+
+	for _, policy := range []fins.DeliveryPolicy{fins.DeliveryDrop, fins.DeliveryReplace, fins.DeliveryBlock} {
+		t.Run(policy.String(), func(t *testing.T) {
+			c := scriptedClient(t, l, fins.Options{ResponseDelivery: policy, MinSID: 1, MaxSID: 4})
+			defer c.Close()
+
+			var wg sync.WaitGroup
+			for g := range 4 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := range 50 {
+						address := uint16(g*50 + i)
+						words, err := c.WithTimeout(time.Millisecond).ReadWords(mapping.MemoryAreaDMWord, address, 1)
+						if err == nil {
+							assert.Equal(t, []uint16{address}, words, "response of another command")
+						}
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestTCPFrameError(t *testing.T) {
+	// The PLC rejects reads of D0 with the rejected frame and reads of D1 without it
+	l := scriptedPLC(t, func(conn net.Conn, req finsproto.Request) {
+		switch req.Data[2] {
+		case 0:
+			conn.Write(finsproto.TCPErrorFrame(finsproto.TCP_COMMAND_FRAME_SEND_ERROR, finsproto.TCP_ERROR_NODE_OUT_OF_RANGE, finsproto.EncodeHeader(req.Header)...))
+		case 1:
+			conn.Write(finsproto.TCPErrorFrame(finsproto.TCP_COMMAND_FRAME_SEND, finsproto.TCP_ERROR_DATA_TOO_LONG))
+		default:
+			conn.Write(responseFrame(req, 0, 7))
+		}
+	})
+	defer l.Close()
+
+	c := scriptedClient(t, l, fins.Options{})
+	defer c.Close()
+
+	for _, tc := range []struct {
+		address uint16
+		command uint32
+		code    uint32
+	}{
+		{0, finsproto.TCP_COMMAND_FRAME_SEND_ERROR, finsproto.TCP_ERROR_NODE_OUT_OF_RANGE},
+		{1, finsproto.TCP_COMMAND_FRAME_SEND, finsproto.TCP_ERROR_DATA_TOO_LONG},
+	} {
+		start := time.Now()
+		_, err := c.WithTimeout(5*time.Second).ReadWords(mapping.MemoryAreaDMWord, tc.address, 1)
+		var tcpErr fins.TCPError
+		require.ErrorAs(t, err, &tcpErr)
+		assert.Equal(t, fins.TCPError{Command: tc.command, Code: tc.code}, tcpErr)
+		assert.Less(t, time.Since(start), time.Second, "the command fails without waiting for the timeout")
+	}
+
+	words, err := c.WithTimeout(time.Second).ReadWords(mapping.MemoryAreaDMWord, 2, 1)
+	require.NoError(t, err, "the connection is kept")
+	assert.Equal(t, []uint16{7}, words)
+}
+
+func TestReconnectDoesNotBlock(t *testing.T) {
+	// The PLC drops the first connection after the handshake and never answers the next handshakes
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for first := true; ; first = false {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(first bool) {
+				defer conn.Close()
+				if first {
+					finsproto.ReadTCPFrame(conn)
+					conn.Write(finsproto.TCPFrame(finsproto.TCP_COMMAND_NODE_ADDRESS_RESPONSE, []byte{0, 0, 0, 2, 0, 0, 0, 10}))
+					return
+				}
+				io.Copy(io.Discard, conn)
+			}(first)
+		}
+	}()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", l.Addr().(*net.TCPAddr).Port, 0, 10, 0)
+	require.NoError(t, err)
+	c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{
+		HandshakeTimeout: 500 * time.Millisecond,
+		ReconnectBackoff: fins.ConstantBackoff{Interval: 10 * time.Millisecond, MaxAttempts: 10},
+	})
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond) // Let the listen loop see the dropped connection
+
+	reconnectErr := make(chan error, 1)
+	go func() { reconnectErr <- c.Reconnect() }()
+	time.Sleep(100 * time.Millisecond) // The reconnect is in a handshake now
+
+	// Commands fail fast and configuration changes don't wait for the reconnect
+	start := time.Now()
+	_, err = c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	assert.Error(t, err)
+	c.Use(func(next fins.Sender) fins.Sender { return next })
+	c.SetWriteGuard(nil)
+	c.Diagnostics()
+	c.ClientNode()
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	// Close ends the reconnect without waiting for its backoff
+	start = time.Now()
+	require.NoError(t, c.Close())
+	select {
+	case err := <-reconnectErr:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Reconnect did not stop after Close")
+	}
+	assert.Less(t, time.Since(start), 300*time.Millisecond)
+}
+
+func TestManagerReadAll(t *testing.T) {
+	c1, _, cleanup1 := setupTest(t)
+	defer cleanup1()
+	c2, _, cleanup2 := setupTest(t)
+	defer cleanup2()
+
+	require.NoError(t, c1.WriteWords(mapping.MemoryAreaDMWord, 10, []uint16{11}))
+	require.NoError(t, c2.WriteWords(mapping.MemoryAreaDMWord, 10, []uint16{22}))
+
+	m := fins.NewManager(2)
+	m.Add("line1", c1)
+	m.Add("line2", c2)
+	assert.Equal(t, []string{"line1", "line2"}, m.Names())
+
+	tag := fins.Tag{Name: "count", MemoryArea: mapping.MemoryAreaDMWord, Address: 10, DataType: fins.DataTypeUint}
+	bad := fins.Tag{Name: "bad", MemoryArea: mapping.MemoryAreaDMBit, Address: 10, DataType: fins.DataTypeUint}
+
+	results, err := m.ReadAll(context.Background(), map[string][]fins.Tag{
+		"line1": {tag},
+		"line2": {tag, bad},
+		"line3": {tag},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown PLC "line3"`)
+	assert.Contains(t, err.Error(), "line2: tag bad")
+	var multi *fins.MultiError
+	require.ErrorAs(t, err, &multi)
+	assert.Equal(t, 4, multi.Total)
+	assert.Len(t, multi.Errors, 2)
+
+	assert.Equal(t, 11.0, results["line1"][0].Value)
+	assert.Equal(t, 22.0, results["line2"][0].Value)
+	assert.NoError(t, results["line2"][0].Err)
+	assert.Error(t, results["line2"][1].Err)
+	assert.Error(t, results["line3"][0].Err)
+}
+
+func TestReadMultiple(t *testing.T) {
+	c, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 20, []uint16{7, 8}))
+	tags := []fins.Tag{
+		{Name: "first", MemoryArea: mapping.MemoryAreaDMWord, Address: 20, DataType: fins.DataTypeUint},
+		{Name: "bad", MemoryArea: mapping.MemoryAreaDMWord, Address: 21, DataType: "FOO"},
+		{Name: "second", MemoryArea: mapping.MemoryAreaDMWord, Address: 21, DataType: fins.DataTypeUint},
+	}
+
+	values, err := c.ReadMultiple(tags)
+	require.Len(t, values, 3)
+	assert.Equal(t, 7.0, values[0].Value)
+	assert.Error(t, values[1].Err)
+	assert.Equal(t, 8.0, values[2].Value)
+
+	var multi *fins.MultiError
+	require.ErrorAs(t, err, &multi)
+	assert.Equal(t, 3, multi.Total)
+	require.Len(t, multi.Errors, 1)
+	assert.Equal(t, 1, multi.Errors[0].Index)
+	assert.Equal(t, `1 of 3 items failed: tag bad: unsupported data type: "FOO"`, err.Error())
+
+	values, err = c.ReadMultiple(tags[:1])
+	require.NoError(t, err)
+	assert.Equal(t, 7.0, values[0].Value)
+}
+
+func TestClockSync(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	s.SetClock(time.Now().Add(-time.Hour))
+
+	events := make(chan fins.ClockSyncEvent, 4)
+	cs := fins.NewClockSync(c, fins.ClockSyncOptions{
+		Interval:  time.Hour,
+		Threshold: 5 * time.Second,
+		OnEvent:   func(e fins.ClockSyncEvent) { events <- e },
+	})
+	defer cs.Close()
+
+	e := <-events
+	require.NoError(t, e.Err)
+	assert.True(t, e.Corrected)
+	assert.InDelta(t, -time.Hour, e.Drift, float64(5*time.Second))
+
+	e = cs.SyncNow()
+	require.NoError(t, e.Err)
+	assert.False(t, e.Corrected)
+	assert.Less(t, e.Drift.Abs(), 5*time.Second)
+
+	plcTime, err := c.ReadClock()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), *plcTime, 5*time.Second)
+}
+
+func TestStatusMessages(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	s.SetErrors(0, uint16(fins.ErrorBattery))
+	s.SetFAL(12, false, "LOW PRESSURE")
+	s.SetMessage(1, "CHECK FILTER")
+	s.SetMessage(3, "SERVICE DUE")
+
+	status, err := c.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsRunning())
+	assert.True(t, status.HasBatteryError())
+	assert.True(t, status.HasNonFatalError(fins.ErrorFAL))
+	assert.Equal(t, uint16(12), status.FAL())
+	assert.Equal(t, "LOW PRESSURE", status.ErrorMessage)
+	assert.Equal(t, uint8(0b1010), status.Messages)
+	assert.Equal(t, `RUN, RUN mode, non-fatal: battery error, FAL error, FAL 12 "LOW PRESSURE", messages 0b00001010`, status.String())
+
+	messages, err := c.ReadMessages(status.Messages)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{1: "CHECK FILTER", 3: "SERVICE DUE"}, messages)
+
+	number, message, err := c.ReadFAL()
+	require.NoError(t, err)
+	assert.Equal(t, uint16(12), number)
+	assert.Equal(t, "LOW PRESSURE", message)
+
+	s.SetFAL(7, true, "EMERGENCY STOP")
+	status, err = c.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsStopped())
+	assert.True(t, status.HasError(fins.ErrorFALS))
+	assert.Equal(t, uint16(7), status.FAL())
+	assert.Equal(t, "FALS error", status.FatalError.String())
+}
+
+func TestStatusWatcher(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	w := fins.NewStatusWatcher(c, fins.StatusWatcherOptions{Interval: 10 * time.Millisecond})
+	defer w.Close()
+
+	next := func() fins.StatusEvent {
+		select {
+		case e := <-w.Events():
+			return e
+		case <-time.After(2 * time.Second):
+			t.Fatal("no status event")
+			return fins.StatusEvent{}
+		}
+	}
+
+	require.Eventually(t, func() bool { return w.Status() != nil }, 2*time.Second, 10*time.Millisecond)
+
+	s.SetErrors(uint16(fins.ErrorProgram|fins.ErrorCycleTimeOver), uint16(fins.ErrorBattery))
+	e := next()
+	assert.Equal(t, fins.EventRunToStop, e.Type)
+	e = next()
+	assert.Equal(t, fins.EventFatalErrorRaised, e.Type)
+	assert.Equal(t, []string{"cycle time over", "program error"}, e.Errors)
+	assert.Equal(t, fins.EventBatteryErrorRaised, next().Type)
+
+	s.SetErrors(0, 0)
+	e = next()
+	assert.Equal(t, fins.EventFatalErrorCleared, e.Type)
+	assert.Equal(t, fins.ErrorProgram|fins.ErrorCycleTimeOver, e.Fatal)
+	assert.Equal(t, fins.EventBatteryErrorCleared, next().Type)
+
+	s.SetMode(mapping.StatusRun, mapping.ModeMonitor)
+	e = next()
+	assert.Equal(t, fins.EventStopToRun, e.Type)
+	assert.Equal(t, mapping.ModeMonitor, e.Current.Mode)
+
+	w.Close()
+	_, open := <-w.Events()
+	assert.False(t, open)
+}
+
+func TestHeartbeat(t *testing.T) {
+	c, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	t.Run("Missed", func(t *testing.T) {
+		missed := make(chan fins.HeartbeatEvent, 16)
+		h, err := fins.NewHeartbeat(c, fins.HeartbeatOptions{
+			Address:     700,
+			EchoAddress: 701,
+			Interval:    10 * time.Millisecond,
+			MaxMissed:   2,
+			OnMissed: func(e fins.HeartbeatEvent) {
+				select {
+				case missed <- e:
+				default:
+				}
+			},
+		})
+		require.NoError(t, err)
+		defer h.Close()
+
+		e := <-missed
+		assert.NoError(t, e.Err)
+		assert.Equal(t, 1, e.Missed)
+		e = <-missed
+		assert.Equal(t, 2, e.Missed)
+		assert.False(t, h.Alive())
+
+		counter, err := c.ReadWords(mapping.MemoryAreaDMWord, 700, 1)
+		require.NoError(t, err)
+		assert.NotZero(t, counter[0])
+	})
+
+	t.Run("Echoed", func(t *testing.T) {
+		// Stand in for the PLC program copying the counter to the echo word
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(2 * time.Millisecond):
+				}
+				if counter, err := c.ReadWords(mapping.MemoryAreaDMWord, 710, 1); err == nil {
+					c.WriteWords(mapping.MemoryAreaDMWord, 711, counter)
+				}
+			}
+		}()
+		defer func() {
+			close(stop)
+			wg.Wait()
+		}()
+
+		h, err := fins.NewHeartbeat(c, fins.HeartbeatOptions{
+			Address:     710,
+			EchoAddress: 711,
+			Interval:    50 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		defer h.Close()
+
+		time.Sleep(300 * time.Millisecond)
+		assert.True(t, h.Alive())
+	})
+
+	t.Run("Bit Area", func(t *testing.T) {
+		_, err := fins.NewHeartbeat(c, fins.HeartbeatOptions{MemoryArea: mapping.MemoryAreaDMBit})
+		assert.Error(t, err)
+	})
+}
+
+func TestTriggeredReader(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	bit := func(address uint16) bool {
+		bits, err := c.ReadBits(mapping.MemoryAreaDMBit, address, 0, 1)
+		require.NoError(t, err)
+		return bits[0]
+	}
+
+	t.Run("Handshake", func(t *testing.T) {
+		blocks := make(chan fins.TriggerBlock, 16)
+		events := make(chan fins.TriggerEvent, 16)
+		r, err := fins.NewTriggeredReader(c, fins.TriggerOptions{
+			TriggerAddress: 800,
+			AckAddress:     801,
+			DataAddress:    810,
+			DataCount:      3,
+			Sequenced:      true,
+			PollInterval:   5 * time.Millisecond,
+			OnData:         func(b fins.TriggerBlock) error { blocks <- b; return nil },
+			OnError:        func(e fins.TriggerEvent) { events <- e },
+		})
+		require.NoError(t, err)
+		defer r.Close()
+
+		// Stand in for the PLC program, block 3 is lost
+		for _, seq := range []uint16{1, 2, 4} {
+			require.NoError(t, s.WriteDM(810, []uint16{seq, 10 * seq, 20 * seq}))
+			require.NoError(t, c.SetBit(mapping.MemoryAreaDMBit, 800, 0))
+			require.Eventually(t, func() bool { return bit(801) }, time.Second, time.Millisecond, "acknowledge of block %d", seq)
+			require.NoError(t, c.ResetBit(mapping.MemoryAreaDMBit, 800, 0))
+			require.Eventually(t, func() bool { return !bit(801) }, time.Second, time.Millisecond, "acknowledge reset of block %d", seq)
+
+			b := <-blocks
+			assert.Equal(t, seq, b.Sequence)
+			assert.Equal(t, []uint16{seq, 10 * seq, 20 * seq}, b.Data)
+		}
+
+		e := <-events
+		var missed fins.MissedTriggerError
+		require.ErrorAs(t, e.Err, &missed)
+		assert.Equal(t, 1, missed.Missed)
+		assert.Equal(t, fins.TriggerStats{Blocks: 3, Missed: 1}, r.Stats())
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		events := make(chan fins.TriggerEvent, 16)
+		r, err := fins.NewTriggeredReader(c, fins.TriggerOptions{
+			TriggerAddress: 820,
+			AckAddress:     821,
+			DataAddress:    830,
+			DataCount:      1,
+			PollInterval:   5 * time.Millisecond,
+			Timeout:        30 * time.Millisecond,
+			OnError:        func(e fins.TriggerEvent) { events <- e },
+		})
+		require.NoError(t, err)
+		defer r.Close()
+
+		// The PLC never resets the trigger
+		require.NoError(t, c.SetBit(mapping.MemoryAreaDMBit, 820, 0))
+		e := <-events
+		var timeout fins.TriggerTimeoutError
+		require.ErrorAs(t, e.Err, &timeout)
+		assert.Equal(t, uint16(820), timeout.Address)
+		assert.True(t, bit(821), "the acknowledge stays set")
+		assert.Equal(t, int64(1), r.Stats().Blocks)
+	})
+
+	_, err := fins.NewTriggeredReader(c, fins.TriggerOptions{DataAddress: 0})
+	assert.Error(t, err, "empty data block")
+}
+
+func TestFIFOReader(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	// Head in D900, tail in D901, 4 slots of 2 words from D910
+	layout := fins.FIFOLayout{HeadAddress: 900, TailAddress: 901, DataAddress: 910, RecordSize: 2, Capacity: 4}
+	head := uint16(0)
+	enqueue := func(records ...uint16) {
+		for _, r := range records {
+			require.NoError(t, s.WriteDM(910+head*2, []uint16{r, r + 1}))
+			head = (head + 1) % 4
+			require.NoError(t, s.WriteDM(900, []uint16{head}))
+		}
+	}
+	require.NoError(t, s.WriteDM(900, []uint16{0, 0}))
+
+	q, err := fins.NewFIFOReader(c, layout)
+	require.NoError(t, err)
+
+	var got []uint16
+	collect := func(records []fins.FIFORecord) error {
+		for _, r := range records {
+			got = append(got, r.Data[0])
+		}
+		return nil
+	}
+
+	enqueue(10, 20, 30)
+	pending, err := q.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, 3, pending)
+	n, err := q.Drain(collect)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []uint16{10, 20, 30}, got)
+
+	t.Run("Wrap Around", func(t *testing.T) {
+		got = nil
+		enqueue(40, 50)
+		n, err := q.Drain(collect)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, []uint16{40, 50}, got)
+
+		tail, err := c.ReadWords(mapping.MemoryAreaDMWord, 901, 1)
+		require.NoError(t, err)
+		assert.Equal(t, uint16(1), tail[0])
+	})
+
+	t.Run("At Least Once", func(t *testing.T) {
+		enqueue(60)
+		n, err := q.Drain(func([]fins.FIFORecord) error { return fmt.Errorf("database down") })
+		assert.Error(t, err)
+		assert.Zero(t, n)
+
+		got = nil
+		_, err = q.Drain(collect)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{60}, got, "the rejected record is delivered again")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := fins.NewFIFOReader(c, fins.FIFOLayout{RecordSize: 2, Capacity: 1})
+		assert.Error(t, err)
+
+		require.NoError(t, s.WriteDM(900, []uint16{7}))
+		_, err = q.Pending()
+		assert.Error(t, err, "head outside the buffer")
+	})
+}
+
+func TestBatchWrite(t *testing.T) {
+	c, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	rows, err := fins.LoadBatchCSV(strings.NewReader("Address,Value,Type\n# setpoints\nD100,#1A2B\nD102,-12.5,REAL\n\nD104.03,on\n"))
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, 3, rows[0].Line)
+	assert.Equal(t, 0x1A2B, int(rows[0].Value))
+	assert.Equal(t, fins.DataTypeReal, rows[1].Tag.DataType)
+	assert.Equal(t, mapping.MemoryAreaDMBit, rows[2].Tag.MemoryArea)
+
+	t.Run("Excel", func(t *testing.T) {
+		rows, err := fins.LoadBatchCSV(strings.NewReader("D200;1,5;REAL\r\nD202;7\r\n"))
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+		assert.Equal(t, 1.5, rows[0].Value)
+	})
+
+	t.Run("Invalid Rows", func(t *testing.T) {
+		for _, sheet := range []string{"D100", "X1,2", "D100,70000", "D100.01,1,UINT", "D100,1,FOO"} {
+			_, err := fins.LoadBatchCSV(strings.NewReader(sheet))
+			assert.Error(t, err, sheet)
+		}
+	})
+
+	require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 100, []uint16{5}))
+	report, err := c.WriteBatch(rows, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Written)
+	assert.Zero(t, report.Failed)
+	require.NotNil(t, report.Results[0].Previous)
+	assert.Equal(t, 5.0, *report.Results[0].Previous)
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 100, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0x1A2B), words[0])
+
+	t.Run("Failures", func(t *testing.T) {
+		c.SetWriteGuard(func(w fins.MemoryWrite) error {
+			if w.Address.Address == 102 {
+				return fmt.Errorf("locked")
+			}
+			return nil
+		})
+		defer c.SetWriteGuard(nil)
+
+		report, err := c.WriteBatch(rows, true)
+		assert.Equal(t, 1, report.Written)
+		assert.Equal(t, 1, report.Failed)
+		assert.Equal(t, 1, report.Skipped)
+		var multi *fins.MultiError
+		require.ErrorAs(t, err, &multi)
+		assert.Equal(t, 3, multi.Total)
+		require.Len(t, multi.Errors, 1)
+		assert.Equal(t, 1, multi.Errors[0].Index)
+		assert.ErrorContains(t, err, "locked")
+
+		var buf bytes.Buffer
+		require.NoError(t, report.WriteCSV(&buf))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 4)
+		assert.Equal(t, "line,address,type,value,previous,status,error", lines[0])
+		assert.Equal(t, "3,D100,UINT,6699,6699,ok,", lines[1])
+		assert.Contains(t, lines[2], "failed")
+		assert.Equal(t, "6,D104.03,BOOL,1,,skipped,", lines[3])
+	})
+}
+
+func TestProgramAndFileTransfer(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	program := make([]byte, 1500)
+	for i := range program {
+		program[i] = byte(i * 7)
+	}
+	s.SetProgram(program)
+	modified := time.Date(2026, 3, 14, 15, 9, 26, 0, time.Local)
+	for i := range 25 {
+		s.SetFile(fmt.Sprintf("DATA%02d.CSV", i), bytes.Repeat([]byte{byte(i)}, 100*i), modified)
+	}
+	s.SetFile("AUTOEXEC.OBJ", program, modified)
+
+	t.Run("Program", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := c.DownloadProgram(&buf, 0)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(program)), n)
+		assert.Equal(t, program, buf.Bytes())
+
+		// Resume after the first 1000 bytes
+		buf.Reset()
+		_, err = c.DownloadProgram(&buf, 1000)
+		require.NoError(t, err)
+		assert.Equal(t, program[1000:], buf.Bytes())
+	})
+
+	t.Run("File Names", func(t *testing.T) {
+		info, files, err := c.ReadFileNames(fins.DiskMemoryCard, "")
+		require.NoError(t, err)
+		assert.Equal(t, "SIMULATOR", info.Label)
+		assert.Equal(t, 26, info.Files)
+		require.Len(t, files, 26, "listed over several reads")
+		assert.Equal(t, "AUTOEXEC.OBJ", files[0].Name)
+		assert.Equal(t, uint32(len(program)), files[0].Size)
+		assert.Equal(t, modified, files[0].Modified)
+		assert.Equal(t, "DATA24.CSV", files[25].Name)
+	})
+
+	t.Run("File", func(t *testing.T) {
+		var progress []int
+		var buf bytes.Buffer
+		n, err := c.DownloadFile(&buf, fins.DiskMemoryCard, "", "AUTOEXEC.OBJ", 100, func(done, total int) {
+			assert.Equal(t, len(program), total)
+			progress = append(progress, done)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(program)-100), n)
+		assert.Equal(t, program[100:], buf.Bytes())
+		assert.Equal(t, len(program), progress[len(progress)-1])
+
+		_, _, err = c.ReadFile(fins.DiskMemoryCard, "", "MISSING.TXT", 0, 10)
+		assert.Error(t, err)
+	})
+
+	t.Run("Upload", func(t *testing.T) {
+		var progress []int
+		n, err := c.UploadFile(bytes.NewReader(program), fins.DiskMemoryCard, "", "UPLOAD.BIN", 0, len(program), func(done, total int) {
+			assert.Equal(t, len(program), total)
+			progress = append(progress, done)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(program)), n)
+		assert.Greater(t, len(progress), 1, "written in several chunks")
+		data, ok := s.File("UPLOAD.BIN")
+		require.True(t, ok)
+		assert.Equal(t, program, data)
+
+		// Resume after the first 1000 bytes, a new upload replaces the file
+		require.NoError(t, c.WriteFile(fins.DiskMemoryCard, "", "UPLOAD.BIN", fins.FileWriteReplace, 0, program[:1000]))
+		_, err = c.UploadFile(bytes.NewReader(program[1000:]), fins.DiskMemoryCard, "", "UPLOAD.BIN", 1000, len(program), nil)
+		require.NoError(t, err)
+		data, _ = s.File("UPLOAD.BIN")
+		assert.Equal(t, program, data)
+		_, err = c.UploadFile(bytes.NewReader([]byte("abc")), fins.DiskMemoryCard, "", "UPLOAD.BIN", 0, 3, nil)
+		require.NoError(t, err)
+		data, _ = s.File("UPLOAD.BIN")
+		assert.Equal(t, []byte("abc"), data)
+
+		err = c.WriteFile(fins.DiskMemoryCard, "", "UPLOAD.BIN", fins.FileWriteNew, 0, []byte("x"))
+		var endCodeErr fins.EndCodeError
+		require.ErrorAs(t, err, &endCodeErr)
+		assert.Equal(t, mapping.EndCodeWriteNotPossibleFileNameAlreadyExists, endCodeErr.EndCode)
+		require.NoError(t, c.WriteFile(fins.DiskMemoryCard, "", "UPLOAD.BIN", fins.FileWriteOverwrite, 1, []byte("X")))
+		data, _ = s.File("UPLOAD.BIN")
+		assert.Equal(t, []byte("aXc"), data)
+
+		assert.Error(t, c.WriteFile(fins.DiskMemoryCard, "", "TOOLONGNAME.CSV", fins.FileWriteNew, 0, nil))
+	})
+}
+
+func TestParameterArea(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	s.SetParameterArea(finsproto.PARAMETER_AREA_PLC_SETUP, 0x10, []uint16{1, 2, 3})
+	words, err := c.ReadParameterArea(fins.ParameterPLCSetup, 0x10, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2, 3}, words)
+
+	_, err = c.ReadParameterArea(fins.ParameterPLCSetup, 0x1F0, 0x20)
+	assert.Error(t, err, "the PLC Setup has 512 words")
+
+	// The CPU Bus Unit setup doesn't fit in one frame
+	setup := make([]uint16, fins.ParameterCPUBusUnitSetup.Words())
+	for i := range setup {
+		setup[i] = uint16(i)
+	}
+	err = c.WriteParameterArea(fins.ParameterCPUBusUnitSetup, 0, setup)
+	var endErr fins.EndCodeError
+	require.ErrorAs(t, err, &endErr, "parameter areas are written in PROGRAM mode")
+	assert.Equal(t, mapping.EndCodeNotExecutableInCurrentModeWrongPLCModeInRun, endErr.EndCode)
+
+	s.SetMode(mapping.StatusStop, mapping.ModeProgram)
+	require.NoError(t, c.WriteParameterArea(fins.ParameterCPUBusUnitSetup, 0, setup))
+	assert.Equal(t, setup, s.ParameterArea(finsproto.PARAMETER_AREA_CPU_BUS_UNIT))
+
+	words, err = c.ReadParameterArea(fins.ParameterCPUBusUnitSetup, 0, uint16(len(setup)))
+	require.NoError(t, err)
+	assert.Equal(t, setup, words)
+}
+
+func TestRoutingTables(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.SetMode(mapping.StatusStop, mapping.ModeProgram)
+
+	tables, err := c.ReadRoutingTables()
+	require.NoError(t, err)
+	assert.Empty(t, tables.Local)
+	assert.Empty(t, tables.Relay)
+
+	tables.SetLocalNetwork(1, 0x10)
+	tables.SetLocalNetwork(2, 0x11)
+	tables.SetRelayNetwork(3, 2, 5)
+	require.NoError(t, c.WriteRoutingTables(tables))
+	area := s.ParameterArea(finsproto.PARAMETER_AREA_ROUTING_TABLE)
+	assert.Equal(t, []uint16{2, 0x0110, 0x0211}, area[0:3])
+	assert.Equal(t, []uint16{1, 0x0302, 5}, area[fins.ROUTING_RELAY_COUNT_WORD:fins.ROUTING_RELAY_COUNT_WORD+3])
+
+	err = c.UpdateRoutingTables(func(t *fins.RoutingTables) error {
+		t.SetRelayNetwork(4, 1, 7)
+		t.SetRelayNetwork(3, 1, 6)
+		return nil
+	})
+	require.NoError(t, err)
+	tables, err = c.ReadRoutingTables()
+	require.NoError(t, err)
+	assert.Equal(t, []fins.LocalNetwork{{Network: 1, UnitAddress: 0x10}, {Network: 2, UnitAddress: 0x11}}, tables.Local)
+	assert.Equal(t, []fins.RelayNetwork{{Destination: 3, RelayNetwork: 1, RelayNode: 6}, {Destination: 4, RelayNetwork: 1, RelayNode: 7}}, tables.Relay)
+
+	for name, update := range map[string]func(t *fins.RoutingTables){
+		"network out of range": func(t *fins.RoutingTables) { t.SetLocalNetwork(128, 0x12) },
+		"not a CPU Bus Unit":   func(t *fins.RoutingTables) { t.SetLocalNetwork(5, 0x00) },
+		"unit used twice":      func(t *fins.RoutingTables) { t.SetLocalNetwork(5, 0x10) },
+		"local network relay":  func(t *fins.RoutingTables) { t.SetRelayNetwork(2, 1, 3) },
+		"unknown relay net":    func(t *fins.RoutingTables) { t.SetRelayNetwork(9, 8, 3) },
+		"relay node 0":         func(t *fins.RoutingTables) { t.SetRelayNetwork(9, 1, 0) },
+	} {
+		invalid := tables
+		invalid.Local = append([]fins.LocalNetwork(nil), tables.Local...)
+		invalid.Relay = append([]fins.RelayNetwork(nil), tables.Relay...)
+		update(&invalid)
+		assert.Error(t, c.WriteRoutingTables(invalid), name)
+	}
+
+	require.True(t, tables.RemoveNetwork(4))
+	assert.False(t, tables.RemoveNetwork(4))
+	assert.Len(t, tables.Relay, 1)
+}
+
+func TestUnitCommand(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	const serialStatus = 0x2101
+	s.SetUnit(fins.CPUBusUnit(2), func(r finsproto.Request) (uint16, []byte) {
+		switch r.CommandCode {
+		case mapping.CommandCodeCPUUnitDataRead:
+			return mapping.EndCodeNormalCompletion, []byte(fmt.Sprintf("%-20s%-20s", "CJ1W-SCU42", "V2.0"))
+		case serialStatus:
+			return mapping.EndCodeNormalCompletion, append([]byte{r.Data[0]}, 0x80, 0x01)
+		}
+		return mapping.EndCodeNotSupportedByModelVersion, nil
+	})
+	s.SetUnit(fins.SpecialIOUnit(1), func(r finsproto.Request) (uint16, []byte) {
+		return mapping.EndCodeNormalCompletion, []byte{0x12, 0x34, 0x56, 0x78}
+	})
+
+	data, err := c.UnitCommand(fins.CPUBusUnit(2), mapping.CommandCodeCPUUnitDataRead, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fins.UnitData{Model: "CJ1W-SCU42", Version: "V2.0"}, data)
+
+	// Without a decoder the response data is returned
+	data, err = c.UnitCommand(fins.CPUBusUnit(2), serialStatus, []byte{1})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 0x80, 0x01}, data)
+
+	type portStatus struct {
+		Port  byte
+		Ready bool
+	}
+	fins.RegisterUnitDecoder(serialStatus, func(unitAddress byte, r *fins.Response) (any, error) {
+		assert.Equal(t, fins.CPUBusUnit(2), unitAddress)
+		return portStatus{Port: r.Data[0], Ready: r.Data[1]&0x80 != 0}, nil
+	})
+	defer fins.RegisterUnitDecoder(serialStatus, nil)
+	data, err = c.UnitCommand(fins.CPUBusUnit(2), serialStatus, []byte{2})
+	require.NoError(t, err)
+	assert.Equal(t, portStatus{Port: 2, Ready: true}, data)
+
+	_, err = c.SendUnitCommand(fins.CPUBusUnit(2), mapping.CommandCodeClockRead, nil)
+	var endCodeErr fins.EndCodeError
+	require.ErrorAs(t, err, &endCodeErr)
+	assert.Equal(t, mapping.EndCodeNotSupportedByModelVersion, endCodeErr.EndCode)
+
+	_, err = c.UnitCommand(fins.CPUBusUnit(5), mapping.CommandCodeCPUUnitDataRead, nil)
+	require.ErrorAs(t, err, &endCodeErr)
+	assert.Equal(t, mapping.EndCodeUnitMissing, endCodeErr.EndCode)
+
+	// A unit handle sends all commands to the unit, the client still reaches the CPU unit
+	words, err := c.WithUnit(fins.SpecialIOUnit(1)).ReadWords(mapping.MemoryAreaDMWord, 0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{0x1234, 0x5678}, words)
+	require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 0, []uint16{7, 8}))
+	words, err = c.ReadWords(mapping.MemoryAreaDMWord, 0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{7, 8}, words)
+}
+
+func TestReadWordsAsync(t *testing.T) {
+	c, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	for i := uint16(0); i < 8; i++ {
+		require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 800+i*10, []uint16{i, i + 100}))
+	}
+
+	futures := make([]*fins.Future, 8)
+	for i := range futures {
+		f, err := c.ReadWordsAsync(mapping.MemoryAreaDMWord, 800+uint16(i)*10, 2)
+		require.NoError(t, err)
+		futures[i] = f
+	}
+
+	for i, f := range futures {
+		select {
+		case <-f.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("future %d not done", i)
+		}
+		words, err := f.Result()
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{uint16(i), uint16(i) + 100}, words)
+	}
+
+	_, err := c.ReadWordsAsync(mapping.MemoryAreaDMBit, 800, 1)
+	assert.IsType(t, fins.IncompatibleMemoryAreaError{}, err)
+}
+
+func TestAreaReader(t *testing.T) {
+	c, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	words := make([]uint16, 2500)
+	for i := range words {
+		words[i] = uint16(i * 7)
+	}
+	for i := 0; i < len(words); i += 500 {
+		require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 1000+uint16(i), words[i:i+500]))
+	}
+
+	data, err := io.ReadAll(c.AreaReader(mapping.MemoryAreaDMWord, 1000, len(words)))
+	require.NoError(t, err)
+	require.Len(t, data, 2*len(words))
+	for i, w := range words {
+		assert.Equal(t, w, binary.BigEndian.Uint16(data[i*2:]), "word %d", i)
+	}
+
+	_, err = io.ReadAll(c.AreaReader(mapping.MemoryAreaDMWord, 0xFFFF, 2))
+	assert.Error(t, err)
+}
+
+func TestAreaWriter(t *testing.T) {
+	c, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	data := make([]byte, 2*2300)
+	for i := range data {
+		data[i] = byte(i * 13)
+	}
+
+	w := c.AreaWriter(mapping.MemoryAreaDMWord, 5000)
+	// Odd sized writes end in the middle of a word
+	for i := 0; i < len(data); i += 333 {
+		n, err := w.Write(data[i:min(i+333, len(data))])
+		require.NoError(t, err)
+		assert.Equal(t, min(333, len(data)-i), n)
+	}
+	require.NoError(t, w.Close())
+
+	read, err := io.ReadAll(c.AreaReader(mapping.MemoryAreaDMWord, 5000, len(data)/2))
+	require.NoError(t, err)
+	assert.Equal(t, data, read)
+
+	w = c.AreaWriter(mapping.MemoryAreaDMWord, 5000)
+	_, err = w.Write([]byte{1, 2, 3})
+	require.NoError(t, err)
+	assert.Error(t, w.Close())
+}
+
+func TestStringOptions(t *testing.T) {
+	c, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	testCases := []struct {
+		name string
+		s    string
+		opts fins.StringOptions
+		raw  []byte
+	}{
+		{"Default", "ABC", fins.StringOptions{}, []byte("ABC\x00")},
+		{"Swapped", "ABC", fins.StringOptions{SwapBytes: true}, []byte("BA\x00C")},
+		{"Fixed Length", "AB", fins.StringOptions{Length: 6, Padding: ' '}, []byte("AB    ")},
+		{"Length Prefixed", "ABC", fins.StringOptions{Layout: fins.StringLengthPrefixed}, []byte("\x00\x03ABC\x00")},
+		{"Shift-JIS", "温度", fins.StringOptions{Encoding: japanese.ShiftJIS}, []byte{0x89, 0xB7, 0x93, 0x78}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 900, make([]uint16, 8)))
+			require.NoError(t, c.WriteStringWith(mapping.MemoryAreaDMWord, 900, tc.s, tc.opts))
+
+			raw, err := c.ReadBytes(mapping.MemoryAreaDMWord, 900, uint16(len(tc.raw)))
+			require.NoError(t, err)
+			assert.Equal(t, tc.raw, raw)
+
+			s, err := c.ReadStringWith(mapping.MemoryAreaDMWord, 900, 8, tc.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tc.s, s)
+		})
+	}
+
+	err := c.WriteStringWith(mapping.MemoryAreaDMWord, 900, "TOO LONG", fins.StringOptions{Length: 4})
+	assert.Error(t, err)
+}
+
+func TestMarshal(t *testing.T) {
+	c, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	type status struct {
+		Speed   int16   `fins:"D1100,int16"`
+		Count   uint32  `fins:"D1101,UDINT"`
+		Temp    float32 `fins:"D1103,real"`
+		Running bool    `fins:"D1105.03,bool"`
+		Total   float64 `fins:"D1107,lreal"`
+		Note    string
+	}
+
+	require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 1105, []uint16{0x0001, 0xBEEF}))
+
+	in := status{Speed: -12, Count: 70000, Temp: 21.5, Running: true, Total: 1e9}
+	require.NoError(t, c.Marshal(&in))
+
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 1100, 7)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{0xFFF4, 0x1170, 0x0001}, words[0:3])
+	assert.Equal(t, uint16(0x0009), words[5], "bit fields keep the other bits")
+	assert.Equal(t, uint16(0xBEEF), words[6], "gaps between fields are preserved")
+
+	var out status
+	require.NoError(t, c.Unmarshal(&out))
+	assert.Equal(t, in, out)
+
+	t.Run("Errors", func(t *testing.T) {
+		assert.Error(t, c.Unmarshal(out), "not a pointer")
+		assert.Error(t, c.Marshal(&struct {
+			V int16 `fins:"D1100,int16"`
+			W int16 `fins:"H10,int16"`
+		}{}), "mixed areas")
+		assert.Error(t, c.Marshal(&struct {
+			V string `fins:"D1100,int16"`
+		}{}), "field type")
+		assert.Error(t, c.Marshal(&struct {
+			V int32 `fins:"D1100,int16"`
+		}{V: 40000}), "out of range")
+		assert.ErrorContains(t, c.Marshal(&struct {
+			V int16 `fins:"D1100,int16"`
+			w int16 `fins:"D1101,int16"`
+		}{}), "unexported", "unexported field")
+		assert.ErrorContains(t, c.Unmarshal(&struct {
+			v int16 `fins:"D1100,int16"`
+		}{}), "unexported", "unexported field")
+		assert.ErrorContains(t, c.Marshal(&struct {
+			Count uint32 `fins:"D1100,udint"`
+			Speed int16  `fins:"D1101,int16"`
+		}{}), "field Speed overlaps field Count", "overlapping words")
+		assert.ErrorContains(t, c.Unmarshal(&struct {
+			Flags uint16 `fins:"D1100,uint16"`
+			Ready bool   `fins:"D1100.01,bool"`
+		}{}), "overlaps", "a bool in the word of another field")
+		assert.ErrorContains(t, c.Marshal(&struct {
+			Ready bool `fins:"D1100.01,bool"`
+			Done  bool `fins:"D1100.01,bool"`
+		}{}), "overlaps", "two bools in one bit")
+	})
+
+	t.Run("Shared Bool Word", func(t *testing.T) {
+		type flags struct {
+			Ready bool `fins:"D1110.00,bool"`
+			Done  bool `fins:"D1110.01,bool"`
+		}
+		in := flags{Ready: false, Done: true}
+		require.NoError(t, c.Marshal(&in))
+		var out flags
+		require.NoError(t, c.Unmarshal(&out))
+		assert.Equal(t, in, out)
+	})
+}
+
+func TestTypedAccessors(t *testing.T) {
+	c, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	dm := mapping.MemoryAreaDMWord
+	require.NoError(t, fins.Write(c, dm, 1200, int16(-5)))
+	require.NoError(t, fins.Write(c, dm, 1201, uint16(65000)))
+	require.NoError(t, fins.Write(c, dm, 1202, int32(-100000)))
+	require.NoError(t, fins.Write(c, dm, 1204, uint32(3000000000)))
+	require.NoError(t, fins.Write(c, dm, 1206, float32(3.25)))
+	require.NoError(t, fins.Write(c, dm, 1208, 2.5e-9))
+	require.NoError(t, fins.Write(c, dm, 1212, true))
+	require.NoError(t, fins.Write(c, dm, 1213, "PUMP-1"))
+	require.NoError(t, fins.Write(c, mapping.MemoryAreaDMBit, 1220, true))
+
+	i16, err := fins.Read[int16](c, dm, 1200)
+	require.NoError(t, err)
+	assert.Equal(t, int16(-5), i16)
+	u16, err := fins.Read[uint16](c, dm, 1201)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(65000), u16)
+	i32, err := fins.Read[int32](c, dm, 1202)
+	require.NoError(t, err)
+	assert.Equal(t, int32(-100000), i32)
+	u32, err := fins.Read[uint32](c, dm, 1204)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3000000000), u32)
+	f32, err := fins.Read[float32](c, dm, 1206)
+	require.NoError(t, err)
+	assert.Equal(t, float32(3.25), f32)
+	f64, err := fins.Read[float64](c, dm, 1208)
+	require.NoError(t, err)
+	assert.Equal(t, 2.5e-9, f64)
+	b, err := fins.Read[bool](c, dm, 1212)
+	require.NoError(t, err)
+	assert.True(t, b)
+	// Strings are read with a length, up to the first null byte within it
+	require.NoError(t, c.WriteWords(dm, 1216, []uint16{0x4142, 0x0000, 0x4344}))
+	s, err := c.ReadStringWith(dm, 1213, 6, fins.StringOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "PUMP-1", s)
+	s, err = c.ReadStringWith(dm, 1213, 20, fins.StringOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "PUMP-1AB", s)
+	bit, err := fins.Read[bool](c, mapping.MemoryAreaDMBit, 1220)
+	require.NoError(t, err)
+	assert.True(t, bit)
+
+	words, err := c.ReadWords(dm, 1202, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{0x7960, 0xFFFE}, words, "least significant word first")
+}
+
+func TestBitFields(t *testing.T) {
+	c, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	tag := fins.Tag{
+		Name:       "Status",
+		MemoryArea: mapping.MemoryAreaDMWord,
+		Address:    1300,
+		Fields: []fins.BitField{
+			{Name: "Running", Shift: 0, Width: 1},
+			{Name: "Mode", Shift: 4, Width: 3},
+			{Name: "Alarm", Shift: 15, Width: 1},
+		},
+	}
+	require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 1300, []uint16{0x0A08}))
+
+	require.NoError(t, c.WriteBitFields(tag, map[string]uint16{"Running": 1, "Mode": 5}))
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 1300, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0x0A59), words[0], "bits outside the fields are kept")
+
+	values, err := c.ReadBitFields(tag)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uint16{"Running": 1, "Mode": 5, "Alarm": 0}, values)
+
+	assert.Error(t, c.WriteBitFields(tag, map[string]uint16{"Mode": 8}), "value too wide")
+	assert.Error(t, c.WriteBitFields(tag, map[string]uint16{"Unknown": 1}))
+
+	// Concurrent updates of different bits must not overwrite each other
+	var wg sync.WaitGroup
+	for bit := 0; bit < 16; bit++ {
+		wg.Add(1)
+		go func(bit int) {
+			defer wg.Done()
+			assert.NoError(t, c.UpdateBits(mapping.MemoryAreaDMWord, 1301, 1<<bit, 0xFFFF))
+		}(bit)
+	}
+	wg.Wait()
+	words, err = c.ReadWords(mapping.MemoryAreaDMWord, 1301, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0xFFFF), words[0])
+}
+
+func TestUpdateWord(t *testing.T) {
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	require.NoError(t, err)
+	defer s.Close()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, 10, 0)
+	require.NoError(t, err)
+	c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{VerifyUpdates: true})
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 1400, []uint16{41}))
+	require.NoError(t, c.UpdateWord(mapping.MemoryAreaDMWord, 1400, func(old uint16) uint16 { return old + 1 }))
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 1400, 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(42), words[0])
+
+	t.Run("Conflict", func(t *testing.T) {
+		// A second connection stands in for the PLC program writing the same word
+		plc, err := fins.NewClient(clientAddr, plcAddr)
+		require.NoError(t, err)
+		defer plc.Close()
+
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					plc.WriteWords(mapping.MemoryAreaDMWord, 1401, []uint16{0xAAAA})
+				}
+			}
+		}()
+		defer func() {
+			close(stop)
+			wg.Wait()
+		}()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			err := c.UpdateWord(mapping.MemoryAreaDMWord, 1401, func(uint16) uint16 { return 0x5555 })
+			if err == nil {
+				continue
+			}
+			var conflict fins.ConflictError
+			require.ErrorAs(t, err, &conflict)
+			assert.Equal(t, uint16(0x5555), conflict.Expected)
+			assert.Equal(t, uint16(0xAAAA), conflict.Actual)
+			return
+		}
+		t.Fatal("no conflict detected")
+	})
+}
+
+func TestSimulatorNetworkConditions(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	t.Run("Latency", func(t *testing.T) {
+		s.SetLatency(simulator.FixedLatency(50 * time.Millisecond))
+		defer s.SetLatency(nil)
+
+		start := time.Now()
+		_, err := c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+		_, err = c.WithTimeout(10*time.Millisecond).ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+		assert.Error(t, err)
+		time.Sleep(50 * time.Millisecond) // Let the late response arrive
+	})
+
+	t.Run("Distributions", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			d := simulator.UniformLatency{Min: time.Millisecond, Max: 3 * time.Millisecond}.Delay()
+			assert.GreaterOrEqual(t, d, time.Millisecond)
+			assert.Less(t, d, 3*time.Millisecond)
+			assert.GreaterOrEqual(t, simulator.NormalLatency{Mean: time.Millisecond, StdDev: time.Millisecond}.Delay(), time.Duration(0))
+		}
+	})
+
+	t.Run("Packet Loss", func(t *testing.T) {
+		s.SetPacketLoss(1)
+		_, err := c.WithTimeout(50*time.Millisecond).ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+		assert.Error(t, err)
+
+		s.SetPacketLoss(0)
+		_, err = c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+		assert.NoError(t, err)
+	})
+}
+
+func TestSimulatorScenario(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	sc, err := simulator.ParseScenario([]byte(`
+scan: 10ms
+endCodes:
+  - {from: D100, to: D199, endCode: 0x2002, commands: [read]}
+readOnly:
+  - {from: D0, to: D9}
+counters:
+  - {address: D500, step: 2}
+modes:
+  - {after: 50ms, mode: program}
+`))
+	require.NoError(t, err)
+	require.NoError(t, s.RunScenario(sc))
+
+	_, err = c.ReadWords(mapping.MemoryAreaDMWord, 190, 20)
+	assert.ErrorContains(t, err, "0x2002")
+	var endCodeErr fins.EndCodeError
+	require.ErrorAs(t, err, &endCodeErr)
+	assert.Equal(t, mapping.EndCodeReadNotPossibleProtected, endCodeErr.EndCode)
+	assert.Equal(t, "error reported by destination for MEMORY AREA READ, end code 0x2002: read not possible; protected", err.Error())
+	assert.False(t, endCodeErr.Retryable())
+	assert.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 150, []uint16{1}), "only reads fail")
+
+	assert.ErrorContains(t, c.WriteWords(mapping.MemoryAreaDMWord, 8, []uint16{1, 2, 3}), "0x2101")
+	assert.ErrorContains(t, c.WriteBits(mapping.MemoryAreaDMBit, 9, 15, []bool{true}), "0x2101")
+	assert.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 10, []uint16{1}))
+
+	time.Sleep(100 * time.Millisecond)
+	counter, err := c.ReadWords(mapping.MemoryAreaDMWord, 500, 1)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, counter[0], uint16(4))
+	assert.Zero(t, counter[0]%2)
+
+	status, err := c.Status()
+	require.NoError(t, err)
+	assert.Equal(t, mapping.StatusStop, status.Status)
+	assert.Equal(t, mapping.ModeProgram, status.Mode)
+
+	require.NoError(t, s.RunScenario(nil))
+	_, err = c.ReadWords(mapping.MemoryAreaDMWord, 190, 20)
+	assert.NoError(t, err)
+
+	for _, invalid := range []string{
+		"endCodes: [{from: H10, endCode: 1}]",
+		"readOnly: [{from: D20, to: D10}]",
+		"modes: [{after: 1s, mode: sleeping}]",
+		"scan: often",
+	} {
+		_, err := simulator.ParseScenario([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSimulatorClock(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	// A held clock reads the same time until it is written
+	start := time.Date(2024, 2, 29, 23, 59, 58, 0, time.Local)
+	s.HoldClock(true)
+	s.SetClock(start)
+	time.Sleep(20 * time.Millisecond)
+	plcTime, err := c.ReadClock()
+	require.NoError(t, err)
+	assert.Equal(t, start, *plcTime)
+
+	written := time.Date(1999, 12, 31, 12, 0, 0, 0, time.Local)
+	require.NoError(t, c.WriteClock(written))
+	assert.Equal(t, written, s.Clock())
+
+	_, err = c.SendUnitCommand(fins.UNIT_CPU, mapping.CommandCodeClockWrite, []byte{0x24, 0x02, 0x30, 0x10, 0x00, 0x00})
+	var endCodeErr fins.EndCodeError
+	require.ErrorAs(t, err, &endCodeErr, "February 30th")
+	assert.Equal(t, mapping.EndCodeParameterError, endCodeErr.EndCode)
+
+	// Running twice as fast as the host clock
+	s.SetClockDrift(1)
+	s.HoldClock(false)
+	time.Sleep(200 * time.Millisecond)
+	gained := s.Clock().Sub(written)
+	assert.GreaterOrEqual(t, gained, 400*time.Millisecond)
+	assert.Less(t, gained, 600*time.Millisecond)
+
+	s.SetClockDrift(-1)
+	stopped := s.Clock()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, stopped, s.Clock(), "a drift of -1 stops the clock")
+}
+
+func TestSimulatorContention(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, 10, 0)
+	require.NoError(t, err)
+	other, err := fins.NewClient(clientAddr, plcAddr)
+	require.NoError(t, err)
+	defer other.Close()
+
+	s.SetContention(&simulator.Contention{Window: 100 * time.Millisecond})
+	require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 700, make([]uint16, 10)))
+
+	err = other.WriteWords(mapping.MemoryAreaDMWord, 705, []uint16{1})
+	var endCodeErr fins.EndCodeError
+	require.ErrorAs(t, err, &endCodeErr)
+	assert.Equal(t, mapping.EndCodeAccessWriteErrorNoAccessRight, endCodeErr.EndCode)
+	assert.True(t, endCodeErr.Retryable())
+	assert.ErrorAs(t, other.WriteBits(mapping.MemoryAreaDMBit, 709, 3, []bool{true}), &endCodeErr)
+
+	assert.NoError(t, other.WriteWords(mapping.MemoryAreaDMWord, 710, []uint16{1}), "no overlap")
+	assert.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 705, []uint16{2}), "the writing client keeps access")
+	_, err = other.ReadWords(mapping.MemoryAreaDMWord, 700, 10)
+	assert.NoError(t, err, "reads don't collide")
+
+	// Retrying once the window passed succeeds
+	assert.Eventually(t, func() bool {
+		return other.WriteWords(mapping.MemoryAreaDMWord, 705, []uint16{3}) == nil
+	}, time.Second, 20*time.Millisecond)
+
+	s.SetContention(&simulator.Contention{Window: time.Second, EndCode: mapping.EndCodeDestinationNodeBusy})
+	require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 700, []uint16{1}))
+	require.ErrorAs(t, other.WriteWords(mapping.MemoryAreaDMWord, 700, []uint16{1}), &endCodeErr)
+	assert.Equal(t, mapping.EndCodeDestinationNodeBusy, endCodeErr.EndCode)
+
+	s.SetContention(nil)
+	assert.NoError(t, other.WriteWords(mapping.MemoryAreaDMWord, 700, []uint16{1}))
+}
+
+func TestSimulatorScanLogic(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	// Heartbeat in D600.0, a level ramping by 0.5 per scan in D610 and a pump started by D620.0
+	s.SetScanLogic(5*time.Millisecond, func(scan *simulator.Scan) {
+		scan.SetBit(600, 0, scan.Cycle%2 == 1)
+		scan.SetReal(610, float32(scan.Cycle)*0.5)
+		scan.SetBit(620, 1, scan.Bit(620, 0))
+		scan.SetWord(630, uint16(scan.Cycle))
+	})
+	defer s.SetScanLogic(0, nil)
+
+	require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 620, []uint16{0x0001}))
+	require.Eventually(t, func() bool {
+		words, err := c.ReadWords(mapping.MemoryAreaDMWord, 620, 1)
+		return err == nil && words[0] == 0x0003
+	}, time.Second, 5*time.Millisecond)
+
+	// Every read sees a whole scan
+	for range 20 {
+		words, err := c.ReadWords(mapping.MemoryAreaDMWord, 610, 21)
+		require.NoError(t, err)
+		level := math.Float32frombits(uint32(words[1])<<16 | uint32(words[0]))
+		assert.Equal(t, float32(words[20])*0.5, level)
+	}
+
+	// The program doesn't run in PROGRAM mode
+	s.SetMode(mapping.StatusStop, mapping.ModeProgram)
+	time.Sleep(20 * time.Millisecond)
+	before, err := c.ReadWords(mapping.MemoryAreaDMWord, 630, 1)
+	require.NoError(t, err)
+	time.Sleep(30 * time.Millisecond)
+	after, err := c.ReadWords(mapping.MemoryAreaDMWord, 630, 1)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	s.SetMode(mapping.StatusRun, mapping.ModeRun)
+	assert.Eventually(t, func() bool {
+		words, err := c.ReadWords(mapping.MemoryAreaDMWord, 630, 1)
+		return err == nil && words[0] > after[0]
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestSimulatorInspector(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	addr, err := s.StartInspector("127.0.0.1:0")
+	require.NoError(t, err)
+	base := "http://" + addr.String()
+
+	require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 1500, []uint16{7, 8}))
+
+	getJSON := func(path string, v any) {
+		resp, err := http.Get(base + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+
+	var words []uint16
+	getJSON("/api/memory?address=D1500&count=2", &words)
+	assert.Equal(t, []uint16{7, 8}, words)
+
+	var clients []simulator.ClientInfo
+	getJSON("/api/clients", &clients)
+	require.Len(t, clients, 1)
+	assert.Equal(t, byte(2), clients[0].Node)
+
+	var log []simulator.RequestLogEntry
+	getJSON("/api/log", &log)
+	require.NotEmpty(t, log)
+	assert.Equal(t, mapping.CommandCodeMemoryAreaWrite, log[len(log)-1].CommandCode)
+
+	resp, err := http.Post(base+"/api/memory", "application/json", strings.NewReader(`{"address":"D1501","values":[42]}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	words, err = c.ReadWords(mapping.MemoryAreaDMWord, 1501, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{42}, words)
+
+	resp, err = http.Get(base + "/?address=D1500&count=4")
+	require.NoError(t, err)
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Contains(t, string(page), "D1501")
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	plc, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	require.NoError(t, err)
+	defer plc.Close()
+
+	var recording bytes.Buffer
+	proxy, err := simulator.NewProxy("127.0.0.1:0", plc.Addr().String(), &recording)
+	require.NoError(t, err)
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	proxyAddr, err := fins.NewAddress("127.0.0.1", proxy.Addr().Port, 0, 10, 0)
+	require.NoError(t, err)
+	c, err := fins.NewClient(clientAddr, proxyAddr)
+	require.NoError(t, err)
+
+	for _, v := range []uint16{11, 22} {
+		require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 1600, []uint16{v}))
+		words, err := c.ReadWords(mapping.MemoryAreaDMWord, 1600, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{v}, words)
+	}
+	c.Close()
+	assert.Eventually(t, func() bool { return len(plc.Clients()) == 0 }, time.Second, 10*time.Millisecond,
+		"the PLC connection closes with the client connection")
+	proxy.Close()
+
+	exchanges, err := simulator.ReadRecording(&recording)
+	require.NoError(t, err)
+	require.Len(t, exchanges, 4)
+	assert.Equal(t, mapping.CommandCodeMemoryAreaRead, exchanges[1].CommandCode)
+	assert.Equal(t, []byte{0, 11}, exchanges[1].Response)
+
+	// The replaying simulator has empty memory but answers the reads as recorded
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+	s.Replay(exchanges)
+
+	for _, want := range []uint16{11, 22, 22} {
+		words, err := c.ReadWords(mapping.MemoryAreaDMWord, 1600, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{want}, words)
+	}
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 1601, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{0}, words, "requests not recorded are simulated")
+}
+
+func TestResponseDataLength(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	read := func(area mapping.MemoryArea, address uint16, bit byte, count uint16) []byte {
+		return finsproto.ReadCommand(finsproto.MemoryAddress{MemoryArea: byte(area), Address: address, BitOffset: bit}, count)[2:]
+	}
+	s.Replay([]simulator.Exchange{
+		{CommandCode: mapping.CommandCodeMemoryAreaRead, Request: read(mapping.MemoryAreaDMWord, 100, 0, 4), Response: []byte{0, 1, 0}},
+		{CommandCode: mapping.CommandCodeMemoryAreaRead, Request: read(mapping.MemoryAreaDMWord, 200, 0, 1), Response: []byte{0, 1, 0, 2}},
+		{CommandCode: mapping.CommandCodeMemoryAreaRead, Request: read(mapping.MemoryAreaDMWord, 300, 0, 2), Response: []byte{'A'}},
+		{CommandCode: mapping.CommandCodeMemoryAreaRead, Request: read(mapping.MemoryAreaDMBit, 400, 0, 8), Response: []byte{1, 0}},
+		{CommandCode: mapping.CommandCodeClockRead, Request: []byte{}, Response: []byte{0x24, 0x01}},
+		{CommandCode: mapping.CommandCodeCPUUnitStatusRead, Request: []byte{}, Response: []byte{1}},
+	})
+
+	var protoErr fins.ProtocolError
+	_, err := c.ReadWords(mapping.MemoryAreaDMWord, 100, 4)
+	require.ErrorAs(t, err, &protoErr)
+	assert.Contains(t, err.Error(), "memory area read response holds 3 data bytes, expected 8")
+
+	_, err = c.ReadWords(mapping.MemoryAreaDMWord, 200, 1)
+	require.ErrorAs(t, err, &protoErr, "surplus data is rejected too")
+
+	_, err = c.ReadBytes(mapping.MemoryAreaDMWord, 300, 4)
+	require.ErrorAs(t, err, &protoErr)
+
+	_, err = c.ReadBits(mapping.MemoryAreaDMBit, 400, 0, 8)
+	require.ErrorAs(t, err, &protoErr)
+	assert.Contains(t, err.Error(), "memory area bit read response holds 2 data bytes, expected 8")
+
+	_, err = c.ReadClock()
+	require.ErrorAs(t, err, &protoErr)
+
+	_, err = c.Status()
+	require.ErrorAs(t, err, &protoErr)
+
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 500, 2)
+	require.NoError(t, err, "reads with complete responses still succeed")
+	assert.Equal(t, []uint16{0, 0}, words)
+}
+
+func TestResponseValidation(t *testing.T) {
+	// The PLC answers the read of word n with the response defect n
+	l := scriptedPLC(t, func(conn net.Conn, req finsproto.Request) {
+		resp := finsproto.NewResponse(req, 0, []byte{0, 42})
+		switch binary.BigEndian.Uint16(req.Data[1:3]) {
+		case 1:
+			resp.CommandCode = mapping.CommandCodeMemoryAreaWrite
+		case 2:
+			resp.Header.SID++
+		case 3:
+			resp.Header.DA1 = 99
+		case 4:
+			resp.Header.SA1 = 77
+		case 5:
+			resp.Data = resp.Data[:1]
+		case 6:
+			resp.Data = append(resp.Data, 0, 43)
+		case 7:
+			// A FINS message too short for its header
+			conn.Write(finsproto.TCPFrame(finsproto.TCP_COMMAND_FRAME_SEND, []byte{0xC0, 0, 2, 0}))
+			return
+		case 8:
+			// A frame larger than the client accepts, followed by the response
+			oversized := finsproto.TCPFrame(finsproto.TCP_COMMAND_FRAME_SEND, bytes.Repeat([]byte{0xEE}, 4000))
+			conn.Write(append(oversized, responseFrame(req, 0, 42)...))
+			return
+		}
+		conn.Write(finsproto.TCPFrame(finsproto.TCP_COMMAND_FRAME_SEND, finsproto.EncodeResponse(resp)))
+	})
+	defer l.Close()
+
+	c := scriptedClient(t, l, fins.Options{})
+	defer c.Close()
+	read := func(address uint16) error {
+		_, err := c.WithTimeout(200*time.Millisecond).ReadWords(mapping.MemoryAreaDMWord, address, 1)
+		return err
+	}
+
+	var protoErr fins.ProtocolError
+	err := read(1)
+	require.ErrorAs(t, err, &protoErr)
+	assert.ErrorContains(t, err, "does not match request")
+
+	discarded := c.Diagnostics().Discarded
+	assert.ErrorContains(t, read(2), "timeout", "a response with another SID answers no request")
+	assert.Equal(t, discarded+1, c.Diagnostics().Discarded)
+
+	err = read(3)
+	require.ErrorAs(t, err, &protoErr)
+	assert.ErrorContains(t, err, "response destination 0.99.0")
+	err = read(4)
+	require.ErrorAs(t, err, &protoErr)
+	assert.ErrorContains(t, err, "response source 0.77.0")
+
+	err = read(5)
+	require.ErrorAs(t, err, &protoErr, "truncated data")
+	assert.ErrorContains(t, err, "holds 1 data bytes, expected 2")
+	err = read(6)
+	require.ErrorAs(t, err, &protoErr, "oversized data")
+	assert.ErrorContains(t, err, "holds 4 data bytes, expected 2")
+
+	assert.ErrorContains(t, read(7), "timeout", "a truncated message is dropped")
+	assert.NoError(t, read(8), "an oversized frame is skipped without losing the next one")
+
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	require.NoError(t, err, "the connection survives every defect")
+	assert.Equal(t, []uint16{42}, words)
+}
+
+func TestMiddleware(t *testing.T) {
+	c, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	var order []string
+	var commands []uint16
+	c.Use(func(next fins.Sender) fins.Sender {
+		return fins.SenderFunc(func(command []byte) (*fins.Response, error) {
+			order = append(order, "log")
+			commands = append(commands, binary.BigEndian.Uint16(command))
+			return next.SendCommand(command)
+		})
+	}, func(next fins.Sender) fins.Sender {
+		return fins.SenderFunc(func(command []byte) (*fins.Response, error) {
+			order = append(order, "authorize")
+			if binary.BigEndian.Uint16(command) == mapping.CommandCodeMemoryAreaWrite {
+				return nil, fmt.Errorf("writes are not allowed")
+			}
+			return next.SendCommand(command)
+		})
+	})
+
+	_, err := c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	require.NoError(t, err)
+	assert.ErrorContains(t, c.WriteWords(mapping.MemoryAreaDMWord, 0, []uint16{1}), "not allowed")
+
+	assert.Equal(t, []string{"log", "authorize", "log", "authorize"}, order)
+	assert.Equal(t, []uint16{mapping.CommandCodeMemoryAreaRead, mapping.CommandCodeMemoryAreaWrite}, commands)
+
+	// Handles share the chain of their client
+	order = nil
+	_, err = c.WithPriority(fins.PriorityLow).ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"log", "authorize"}, order)
+}
+
+func TestPriority(t *testing.T) {
+	// The PLC holds the first read until released and records the order of the reads
+	release := make(chan struct{})
+	received := make(chan uint16, 3)
+	l := scriptedPLC(t, func(conn net.Conn, req finsproto.Request) {
+		address := binary.BigEndian.Uint16(req.Data[1:3])
+		received <- address
+		if address == 0 {
+			<-release
+		}
+		conn.Write(responseFrame(req, 0, 0))
+	})
+	defer l.Close()
+
+	c := scriptedClient(t, l, fins.Options{MaxInFlight: 1})
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	read := func(h *fins.Client, address uint16) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := h.WithTimeout(time.Second).ReadWords(mapping.MemoryAreaDMWord, address, 1)
+			assert.NoError(t, err)
+		}()
+	}
+	read(c, 0)
+	assert.Equal(t, uint16(0), <-received)
+
+	// Out of range priorities are clamped to the nearest class
+	read(c.WithPriority(fins.Priority(-3)), 1)
+	time.Sleep(50 * time.Millisecond)
+	read(c.WithPriority(fins.Priority(7)), 2)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, uint16(2), <-received, "the high priority read goes first")
+	assert.Equal(t, uint16(1), <-received)
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	_, err = fins.NewClientWithOptions(clientAddr, clientAddr, fins.Options{
+		CommandPriorities: map[uint16]fins.Priority{mapping.CommandCodeMemoryAreaRead: 5},
+	})
+	assert.ErrorContains(t, err, "invalid priority")
+}
+
+func TestRateLimit(t *testing.T) {
+	_, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, 10, 0)
+	require.NoError(t, err)
+
+	t.Run("Burst", func(t *testing.T) {
+		c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{MaxRequestsPerSecond: 50, Burst: 5})
+		require.NoError(t, err)
+		defer c.Close()
+
+		begin := time.Now()
+		for range 5 {
+			_, err := c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+			require.NoError(t, err)
+		}
+		assert.Less(t, time.Since(begin), 80*time.Millisecond, "the burst is sent back to back")
+
+		// The next 10 requests wait for tokens earned at 50 per second
+		for range 10 {
+			_, err := c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+			require.NoError(t, err)
+		}
+		elapsed := time.Since(begin)
+		assert.GreaterOrEqual(t, elapsed, 180*time.Millisecond)
+		assert.Less(t, elapsed, time.Second)
+	})
+
+	t.Run("Shared By Goroutines", func(t *testing.T) {
+		c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{MaxRequestsPerSecond: 100})
+		require.NoError(t, err)
+		defer c.Close()
+
+		begin := time.Now()
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := c.WithTimeout(5*time.Second).ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+		// One request at once without a burst, then one every 10 ms
+		assert.GreaterOrEqual(t, time.Since(begin), 180*time.Millisecond, "the limit covers all handles and goroutines")
+	})
+
+	t.Run("Priority", func(t *testing.T) {
+		c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{MaxRequestsPerSecond: 20, MaxInFlight: 1})
+		require.NoError(t, err)
+		defer c.Close()
+
+		var mu sync.Mutex
+		var done []string
+		var wg sync.WaitGroup
+		send := func(name string, fn func() error) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, fn())
+				mu.Lock()
+				done = append(done, name)
+				mu.Unlock()
+			}()
+		}
+
+		// The first poll takes the token, the others wait 50 ms each for theirs
+		poller := c.WithPriority(fins.PriorityLow).WithTimeout(5 * time.Second)
+		for i := range 5 {
+			send(fmt.Sprintf("poll %d", i), func() error {
+				_, err := poller.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+				return err
+			})
+			time.Sleep(5 * time.Millisecond)
+		}
+		send("write", func() error {
+			return c.WithTimeout(5*time.Second).WriteWords(mapping.MemoryAreaDMWord, 10, []uint16{1})
+		})
+		wg.Wait()
+
+		require.Len(t, done, 6)
+		assert.Equal(t, "write", done[1], "the write gets the next token before the waiting polls")
+	})
+
+	t.Run("Max In Flight", func(t *testing.T) {
+		// The PLC answers every request after 20 ms and records how many wait at once
+		var mu sync.Mutex
+		inFlight, maxInFlight := 0, 0
+		l := scriptedPLC(t, func(conn net.Conn, req finsproto.Request) {
+			mu.Lock()
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			mu.Unlock()
+			go func() {
+				time.Sleep(20 * time.Millisecond)
+				mu.Lock()
+				defer mu.Unlock()
+				inFlight--
+				conn.Write(responseFrame(req, 0, 0))
+			}()
+		})
+		defer l.Close()
+
+		c := scriptedClient(t, l, fins.Options{MaxInFlight: 2})
+		defer c.Close()
+
+		var wg sync.WaitGroup
+		for i := range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := c.WithTimeout(5*time.Second).ReadWords(mapping.MemoryAreaDMWord, uint16(i), 1)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, 2, maxInFlight)
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	t.Run("Commit", func(t *testing.T) {
+		err := c.Transaction().
+			WriteWords(mapping.MemoryAreaDMWord, 3000, []uint16{1, 2}).
+			WriteBits(mapping.MemoryAreaDMBit, 3010, 2, []bool{true, false, true}).
+			Commit()
+		require.NoError(t, err)
+		words, err := s.ReadDM(3000, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{1}, words)
+		words, err = s.ReadDM(3001, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{2}, words)
+		words, err = s.ReadDM(3010, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{0b10100}, words)
+	})
+
+	t.Run("Invalid Steps", func(t *testing.T) {
+		var txErr fins.TransactionError
+		err := c.Transaction().WriteWords(mapping.MemoryAreaDMWord, 3000, []uint16{9}).WriteBits(mapping.MemoryAreaDMBit, 3010, 0, nil).Commit()
+		require.ErrorAs(t, err, &txErr)
+		assert.Equal(t, 1, txErr.Step)
+		assert.ErrorContains(t, err, "empty bit write", "a bit write without data is still a bit write")
+		words, err := s.ReadDM(3000, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{1}, words, "nothing is written")
+	})
+
+	t.Run("Invalid Tag Value", func(t *testing.T) {
+		writes := 0
+		c.SetWriteGuard(func(w fins.MemoryWrite) error {
+			writes++
+			return nil
+		})
+		defer c.SetWriteGuard(nil)
+
+		level := fins.Tag{Name: "level", MemoryArea: mapping.MemoryAreaDMWord, Address: 3020, DataType: fins.DataTypeInt}
+		var txErr fins.TransactionError
+		err := c.Transaction().WriteWords(mapping.MemoryAreaDMWord, 3000, []uint16{9}).WriteTag(level, 70000).Commit()
+		require.ErrorAs(t, err, &txErr)
+		assert.Equal(t, 1, txErr.Step)
+		assert.ErrorContains(t, err, "out of range")
+		assert.Zero(t, writes, "the value is rejected before the first write")
+		words, err := s.ReadDM(3000, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{1}, words)
+	})
+
+	require.NoError(t, s.WriteDM(3100, []uint16{7, 8, 9}))
+	tx := func() error {
+		return c.Transaction().
+			WriteWords(mapping.MemoryAreaDMWord, 3100, []uint16{1}).
+			WriteWords(mapping.MemoryAreaDMWord, 3101, []uint16{2}).
+			WriteWords(mapping.MemoryAreaDMWord, 3102, []uint16{3}).
+			Commit()
+	}
+
+	t.Run("Rollback", func(t *testing.T) {
+		// The last step fails the first time only
+		denied := false
+		c.SetWriteGuard(func(w fins.MemoryWrite) error {
+			if w.Address.Address == 3102 && !denied {
+				denied = true
+				return fmt.Errorf("locked")
+			}
+			return nil
+		})
+		defer c.SetWriteGuard(nil)
+
+		var txErr fins.TransactionError
+		require.ErrorAs(t, tx(), &txErr)
+		assert.Equal(t, 2, txErr.Step)
+		assert.NoError(t, txErr.RollbackErr)
+		words, err := s.ReadDM(3100, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{7, 8, 9}, words)
+	})
+
+	t.Run("Partial Rollback", func(t *testing.T) {
+		// The last step and its restore fail, the other steps are restored all the same
+		c.SetWriteGuard(func(w fins.MemoryWrite) error {
+			if w.Address.Address == 3102 {
+				return fmt.Errorf("locked")
+			}
+			return nil
+		})
+		defer c.SetWriteGuard(nil)
+
+		var txErr fins.TransactionError
+		require.ErrorAs(t, tx(), &txErr)
+		assert.Equal(t, 2, txErr.Step)
+		assert.ErrorContains(t, txErr.RollbackErr, "step 2")
+		words, err := s.ReadDM(3100, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{7, 8, 9}, words)
+	})
+}
+
+func TestRecipe(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	speed := fins.Tag{Name: "speed", MemoryArea: mapping.MemoryAreaDMWord, Address: 3200, DataType: fins.DataTypeUint}
+	temp := fins.Tag{Name: "temp", MemoryArea: mapping.MemoryAreaDMWord, Address: 3202, DataType: fins.DataTypeReal}
+	mode := fins.Tag{Name: "mode", MemoryArea: mapping.MemoryAreaDMWord, Address: 3204, DataType: fins.DataTypeUint}
+	recipe := fins.Recipe{Name: "batch", Values: []fins.RecipeValue{
+		{Tag: speed, Value: 1200},
+		{Tag: temp, Value: 180.5},
+		{Tag: mode, Value: 3},
+	}}
+
+	t.Run("Download", func(t *testing.T) {
+		require.NoError(t, c.DownloadRecipe(recipe))
+		uploaded, err := c.UploadRecipe("batch", []fins.Tag{speed, temp, mode})
+		require.NoError(t, err)
+		assert.Equal(t, recipe, *uploaded)
+
+		var buf bytes.Buffer
+		require.NoError(t, fins.SaveRecipe(&buf, *uploaded))
+		loaded, err := fins.LoadRecipe(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, recipe, *loaded)
+	})
+
+	previous, err := s.ReadDM(3200, 5)
+	require.NoError(t, err)
+	other := fins.Recipe{Name: "other", Values: []fins.RecipeValue{
+		{Tag: speed, Value: 800},
+		{Tag: temp, Value: 90},
+		{Tag: mode, Value: 1},
+	}}
+
+	t.Run("Rollback", func(t *testing.T) {
+		// The last tag fails the first time only
+		denied := false
+		c.SetWriteGuard(func(w fins.MemoryWrite) error {
+			if w.Address.Address == 3204 && !denied {
+				denied = true
+				return fmt.Errorf("locked")
+			}
+			return nil
+		})
+		defer c.SetWriteGuard(nil)
+
+		var recipeErr fins.RecipeError
+		require.ErrorAs(t, c.DownloadRecipe(other), &recipeErr)
+		assert.Equal(t, 2, recipeErr.Step)
+		assert.Equal(t, "mode", recipeErr.Tag)
+		assert.NoError(t, recipeErr.RollbackErr)
+		words, err := s.ReadDM(3200, 5)
+		require.NoError(t, err)
+		assert.Equal(t, previous, words)
+	})
+
+	t.Run("Partial Rollback", func(t *testing.T) {
+		// The last tag and its restore fail, the other tags are restored all the same
+		c.SetWriteGuard(func(w fins.MemoryWrite) error {
+			if w.Address.Address == 3204 {
+				return fmt.Errorf("locked")
+			}
+			return nil
+		})
+		defer c.SetWriteGuard(nil)
+
+		var recipeErr fins.RecipeError
+		require.ErrorAs(t, c.DownloadRecipe(other), &recipeErr)
+		assert.Equal(t, 2, recipeErr.Step)
+		assert.ErrorContains(t, recipeErr.RollbackErr, "step 2")
+		words, err := s.ReadDM(3200, 5)
+		require.NoError(t, err)
+		assert.Equal(t, previous, words)
+	})
+
+	t.Run("Unreadable Tag", func(t *testing.T) {
+		bad := fins.Recipe{Name: "bad", Values: []fins.RecipeValue{
+			{Tag: speed, Value: 1},
+			{Tag: fins.Tag{Name: "bad", MemoryArea: mapping.MemoryAreaDMWord, Address: 3206, DataType: "DECIMAL"}, Value: 1},
+		}}
+		var recipeErr fins.RecipeError
+		require.ErrorAs(t, c.DownloadRecipe(bad), &recipeErr)
+		assert.Equal(t, 1, recipeErr.Step)
+		assert.Equal(t, "bad", recipeErr.Tag)
+		words, err := s.ReadDM(3200, 1)
+		require.NoError(t, err)
+		assert.Equal(t, previous[:1], words, "nothing is written")
+	})
+}
+
+func TestWriteGuard(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	// Only D2000-D2009 may be written while the PLC runs
+	var guarded []fins.MemoryWrite
+	c.SetWriteGuard(func(w fins.MemoryWrite) error {
+		guarded = append(guarded, w)
+		status, err := c.Status()
+		if err != nil {
+			return err
+		}
+		if status.Mode == mapping.ModeRun && (w.Address.Address < 2000 || w.Address.Address > 2009) {
+			return fmt.Errorf("PLC is in RUN mode")
+		}
+		return nil
+	})
+
+	assert.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 2000, []uint16{1, 2}))
+	err := c.WriteWords(mapping.MemoryAreaDMWord, 2010, []uint16{1})
+	var denied fins.WriteDeniedError
+	require.ErrorAs(t, err, &denied)
+	assert.Equal(t, uint16(2010), denied.Write.Address.Address)
+	assert.Error(t, c.SetBit(mapping.MemoryAreaDMBit, 100, 3))
+	assert.Error(t, c.WriteWordsNoAck(mapping.MemoryAreaDMWord, 100, []uint16{1}))
+	_, err = c.ReadWords(mapping.MemoryAreaDMWord, 2010, 1)
+	assert.NoError(t, err, "reads are not guarded")
+
+	require.Len(t, guarded, 4)
+	assert.Equal(t, []byte{0, 1, 0, 2}, guarded[0].Data)
+	assert.Equal(t, byte(3), guarded[2].Address.BitOffset)
+	assert.Equal(t, []byte{1}, guarded[2].Data)
+
+	c.SetWriteGuard(nil)
+	assert.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 2010, []uint16{1}))
+
+	t.Run("Other write commands", func(t *testing.T) {
+		// A locked-down PLC takes no writes at all
+		var commands []uint16
+		c.SetWriteGuard(func(w fins.MemoryWrite) error {
+			commands = append(commands, w.Command)
+			if w.Command == mapping.CommandCodeMemoryAreaFill {
+				assert.Equal(t, uint16(3000), w.Address.Address)
+				assert.Equal(t, uint16(4), w.ItemCount)
+			}
+			if w.Command == mapping.CommandCodeMemoryAreaTransfer {
+				assert.Equal(t, uint16(3100), w.Address.Address, "the destination is written")
+				assert.Equal(t, uint16(2), w.ItemCount)
+			}
+			return fmt.Errorf("locked")
+		})
+		defer c.SetWriteGuard(nil)
+
+		var denied fins.WriteDeniedError
+		err := c.WriteClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+		require.ErrorAs(t, err, &denied)
+		assert.Equal(t, "CLOCK WRITE denied: locked", denied.Error())
+		assert.ErrorAs(t, c.WriteFile(fins.DiskMemoryCard, `\`, "TEST.TXT", fins.FileWriteReplace, 0, []byte("x")), &denied)
+		assert.ErrorAs(t, c.WriteParameterArea(fins.ParameterPLCSetup, 0, []uint16{1}), &denied)
+		fill := []byte{byte(mapping.MemoryAreaDMWord), 0x0B, 0xB8, 0, 0, 4, 0x12, 0x34}
+		_, err = c.SendUnitCommand(0, mapping.CommandCodeMemoryAreaFill, fill)
+		assert.ErrorAs(t, err, &denied)
+		transfer := []byte{byte(mapping.MemoryAreaDMWord), 0, 0x64, 0, byte(mapping.MemoryAreaDMWord), 0x0C, 0x1C, 0, 0, 2}
+		_, err = c.SendUnitCommand(0, mapping.CommandCodeMemoryAreaTransfer, transfer)
+		assert.ErrorAs(t, err, &denied)
+		_, err = c.SendUnitCommand(0, mapping.CommandCodeForcedSetReset, []byte{0, 1, 0, 1, byte(mapping.MemoryAreaCIOBit), 0, 0, 0})
+		assert.ErrorAs(t, err, &denied)
+		_, err = c.ReadClock()
+		assert.NoError(t, err, "reads are not guarded")
+
+		assert.Equal(t, []uint16{
+			mapping.CommandCodeClockWrite,
+			mapping.CommandCodeSingleFileWrite,
+			mapping.CommandCodeParameterAreaWrite,
+			mapping.CommandCodeMemoryAreaFill,
+			mapping.CommandCodeMemoryAreaTransfer,
+			mapping.CommandCodeForcedSetReset,
+		}, commands)
+		assert.False(t, s.Clock().Equal(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)))
+		_, ok := s.File("TEST.TXT")
+		assert.False(t, ok)
+	})
+}
+
+type auditCollector struct {
+	sync.Mutex
+	records []fins.AuditRecord
+}
+
+func (a *auditCollector) RecordWrite(r fins.AuditRecord) error {
+	a.Lock()
+	defer a.Unlock()
+	a.records = append(a.records, r)
+	return nil
+}
+
+func TestAuditTrail(t *testing.T) {
+	c, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 300, []uint16{7, 8}))
+
+	sink := &auditCollector{}
+	c.SetAuditSink(sink, true)
+	operator := c.WithAuditContext(map[string]string{"user": "alice"})
+
+	require.NoError(t, operator.WriteWords(mapping.MemoryAreaDMWord, 300, []uint16{9, 10}))
+	_, err := operator.ReadWords(mapping.MemoryAreaDMWord, 300, 2)
+	require.NoError(t, err)
+	require.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 302, []uint16{1}))
+
+	require.Len(t, sink.records, 2, "reads are not recorded")
+	r := sink.records[0]
+	assert.Equal(t, mapping.MemoryAreaDMWord, r.MemoryArea)
+	assert.Equal(t, uint16(300), r.Address)
+	assert.Equal(t, uint16(2), r.ItemCount)
+	assert.Equal(t, []byte{0, 7, 0, 8}, r.Previous)
+	assert.Equal(t, []byte{0, 9, 0, 10}, r.Data)
+	assert.Equal(t, "alice", r.Context["user"])
+	assert.Empty(t, r.Err)
+	assert.False(t, r.Time.IsZero())
+	assert.Nil(t, sink.records[1].Context)
+
+	var buf bytes.Buffer
+	c.SetAuditSink(fins.NewJSONAuditSink(&buf), false)
+	require.NoError(t, operator.WriteWords(mapping.MemoryAreaDMWord, 304, []uint16{1}))
+	var decoded fins.AuditRecord
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, uint16(304), decoded.Address)
+	assert.Nil(t, decoded.Previous)
+	assert.Equal(t, "alice", decoded.Context["user"])
+}
+
+func TestDryRun(t *testing.T) {
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.WriteDM(400, []uint16{5, 6}))
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, 10, 0)
+	require.NoError(t, err)
+
+	c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{DryRun: true, VerifyUpdates: true})
+	require.NoError(t, err)
+	defer c.Close()
+	assert.True(t, c.DryRun())
+
+	assert.NoError(t, c.WriteWords(mapping.MemoryAreaDMWord, 400, []uint16{1, 2}))
+	assert.NoError(t, c.WriteWordsNoAck(mapping.MemoryAreaDMWord, 400, []uint16{1, 2}))
+	assert.NoError(t, c.SetBit(mapping.MemoryAreaDMBit, 400, 0))
+	assert.NoError(t, c.WriteClock(time.Date(2000, 1, 1, 0, 0, 0, 0, time.Local)))
+
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 400, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{5, 6}, words, "writes must not reach the PLC")
+	assert.NotEqual(t, 2000, s.Clock().Year())
+
+	_, err = c.ReadWords(mapping.MemoryAreaDMWord, 0xFFFF, 2)
+	assert.Error(t, err, "commands are still validated")
+	assert.Error(t, c.WriteWords(mapping.MemoryAreaDMWord, 0xFFFF, []uint16{1, 2}))
+
+	t.Run("Files", func(t *testing.T) {
+		require.NoError(t, c.WriteFile(fins.DiskMemoryCard, "", "TEST.TXT", fins.FileWriteReplace, 0, []byte("hello")))
+		_, err := c.UploadFile(strings.NewReader("hello"), fins.DiskMemoryCard, "", "DATA.CSV", 0, 5, nil)
+		require.NoError(t, err)
+		_, ok := s.File("TEST.TXT")
+		assert.False(t, ok, "file writes must not reach the PLC")
+		_, ok = s.File("DATA.CSV")
+		assert.False(t, ok)
+	})
+
+	// The writes aren't sent, so reading them back would always fail verification
+	t.Run("Verified writes", func(t *testing.T) {
+		sink := &auditCollector{}
+		c.SetAuditSink(sink, false)
+		defer c.SetAuditSink(nil, false)
+
+		dm := mapping.MemoryAreaDMWord
+		require.NoError(t, c.Transaction().
+			WriteWords(dm, 400, []uint16{7}).
+			WriteBits(mapping.MemoryAreaDMBit, 401, 2, []bool{true}).
+			WriteTag(fins.Tag{Name: "speed", MemoryArea: dm, Address: 402, DataType: fins.DataTypeReal}, 12.5).
+			Commit())
+		require.NoError(t, c.DownloadRecipe(fins.Recipe{Name: "dry", Values: []fins.RecipeValue{
+			{Tag: fins.Tag{Name: "level", MemoryArea: dm, Address: 404, DataType: fins.DataTypeInt}, Value: -3},
+		}}))
+		require.NoError(t, c.UpdateWord(dm, 400, func(old uint16) uint16 { return old + 1 }))
+		assert.Len(t, sink.records, 5)
+
+		words, err := s.ReadDM(400, 6)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{5, 6, 0, 0, 0, 0}, words, "writes must not reach the PLC")
+
+		// A failed step isn't rolled back, there is nothing to restore
+		c.SetWriteGuard(func(w fins.MemoryWrite) error {
+			if w.Address.Address == 401 {
+				return fmt.Errorf("read-only address")
+			}
+			return nil
+		})
+		defer c.SetWriteGuard(nil)
+		sink.records = nil
+		err = c.Transaction().WriteWords(dm, 400, []uint16{7}).WriteWords(dm, 401, []uint16{8}).Commit()
+		var txErr fins.TransactionError
+		require.ErrorAs(t, err, &txErr)
+		assert.Equal(t, 1, txErr.Step)
+		assert.NoError(t, txErr.RollbackErr)
+		require.Len(t, sink.records, 1, "no rollback writes")
+		assert.Equal(t, []byte{0, 7}, sink.records[0].Data)
+	})
+}
+
+func TestConvertFloat32(t *testing.T) {
+	for _, v := range []float32{0, 42.5, -1.25, 3.14159, 1e-7, math.MaxFloat32, float32(math.Inf(-1))} {
+		words, err := fins.ConvertFloat32ToOmronData(v)
+		require.NoError(t, err)
+		bits := math.Float32bits(v)
+		assert.Equal(t, []uint16{uint16(bits), uint16(bits >> 16)}, words, "low word first")
+
+		back, err := fins.ConvertToFloat32(words)
+		require.NoError(t, err)
+		assert.Equal(t, v, back, "conversion must not round")
+	}
+
+	// 42.5 is 0x422A0000
+	f, err := fins.ConvertToFloat32([]uint16{0x0000, 0x422A})
+	require.NoError(t, err)
+	assert.Equal(t, float32(42.5), f)
+
+	_, err = fins.ConvertToFloat32([]uint16{1})
+	assert.Error(t, err)
+
+	assert.Equal(t, float32(3.1), fins.RoundReal(3.14159, 1))
+	assert.Equal(t, float32(3.142), fins.RoundReal(3.14159, 3))
+}
+
+func TestLreal(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	const value = 1234.56789012345
+	tag := fins.Tag{Name: "total", MemoryArea: mapping.MemoryAreaDMWord, Address: 500, DataType: fins.DataTypeLreal}
+	require.NoError(t, c.WriteTag(tag, value))
+	stored, err := s.ReadDMLreal(500)
+	require.NoError(t, err)
+	assert.Equal(t, value, stored)
+
+	read, err := c.ReadTag(tag)
+	require.NoError(t, err)
+	assert.Equal(t, value, read)
+
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 500, 4)
+	require.NoError(t, err)
+	f, err := fins.ConvertToFloat64(words)
+	require.NoError(t, err)
+	assert.Equal(t, value, f)
+	converted, err := fins.ConvertFloat64ToOmronData(value)
+	require.NoError(t, err)
+	assert.Equal(t, words, converted)
+
+	require.NoError(t, s.WriteDMLreal(510, -2.5))
+	swapped := fins.Tag{Name: "swapped", MemoryArea: mapping.MemoryAreaDMWord, Address: 510, DataType: fins.DataTypeLreal, WordOrder: fins.WordOrderHighFirst}
+	read, err = c.ReadTag(swapped)
+	require.NoError(t, err)
+	assert.NotEqual(t, -2.5, read, "words are reversed")
+	require.NoError(t, c.WriteTag(swapped, -2.5))
+	raw, err := c.ReadWords(mapping.MemoryAreaDMWord, 510, 4)
+	require.NoError(t, err)
+	lowFirst, err := fins.ConvertFloat64ToOmronData(-2.5)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{lowFirst[3], lowFirst[2], lowFirst[1], lowFirst[0]}, raw)
+	read, err = c.ReadTag(swapped)
+	require.NoError(t, err)
+	assert.Equal(t, -2.5, read)
+}
+
+func TestSnapshot(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	// 1200 words are three chunks of 500, 500 and 200 words
+	original := make([]uint16, 1200)
+	for i := range original {
+		original[i] = uint16(i*7 + 1)
+	}
+	require.NoError(t, s.WriteDM(4000, original))
+
+	var stream bytes.Buffer
+	var progress []int
+	require.NoError(t, c.SnapshotArea(&stream, mapping.MemoryAreaDMWord, 4000, len(original), func(done, total int) {
+		assert.Equal(t, len(original), total)
+		progress = append(progress, done)
+	}))
+	assert.Equal(t, []int{500, 1000, 1200}, progress)
+	snapshot := stream.Bytes()
+
+	t.Run("Read", func(t *testing.T) {
+		read, err := fins.ReadSnapshot(bytes.NewReader(snapshot))
+		require.NoError(t, err)
+		assert.Equal(t, mapping.MemoryAreaDMWord, read.MemoryArea)
+		assert.Equal(t, uint16(4000), read.Start)
+		assert.Equal(t, original, read.Words)
+		assert.WithinDuration(t, time.Now(), read.Taken, time.Minute)
+
+		var written bytes.Buffer
+		n, err := read.WriteTo(&written)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(snapshot)), n)
+		assert.Equal(t, snapshot, written.Bytes(), "an in-memory snapshot streams as taken")
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		require.NoError(t, s.WriteDM(4000, make([]uint16, len(original))))
+		progress = nil
+		require.NoError(t, c.RestoreArea(bytes.NewReader(snapshot), func(done, total int) { progress = append(progress, done) }))
+		assert.Equal(t, []int{500, 1000, 1200}, progress)
+		words, err := s.ReadDM(4000, len(original))
+		require.NoError(t, err)
+		assert.Equal(t, original, words)
+	})
+
+	restoredWords := func(t *testing.T) int {
+		words, err := s.ReadDM(4000, len(original))
+		require.NoError(t, err)
+		restored := 0
+		for restored < len(words) && words[restored] == original[restored] {
+			restored++
+		}
+		return restored
+	}
+
+	t.Run("Write Failure Partway", func(t *testing.T) {
+		require.NoError(t, s.WriteDM(4000, make([]uint16, len(original))))
+		c.SetWriteGuard(func(w fins.MemoryWrite) error {
+			if w.Address.Address >= 4500 {
+				return fmt.Errorf("locked")
+			}
+			return nil
+		})
+		defer c.SetWriteGuard(nil)
+
+		err := c.RestoreArea(bytes.NewReader(snapshot), nil)
+		var denied fins.WriteDeniedError
+		require.ErrorAs(t, err, &denied)
+		assert.ErrorContains(t, err, "restore write at address 4500")
+		assert.Equal(t, 500, restoredWords(t), "the chunks before the failure are written")
+	})
+
+	t.Run("Corrupt Chunk", func(t *testing.T) {
+		require.NoError(t, s.WriteDM(4000, make([]uint16, len(original))))
+		corrupt := bytes.Clone(snapshot)
+		// Second word of the second chunk: header, first chunk, chunk length and first word
+		corrupt[fins.SNAPSHOT_HEADER_SIZE+(2+1000+4)+2+2] ^= 0xFF
+
+		err := c.RestoreArea(bytes.NewReader(corrupt), nil)
+		assert.ErrorContains(t, err, "restore stopped after 500 of 1200 words")
+		assert.ErrorContains(t, err, "checksum mismatch")
+		assert.Equal(t, 500, restoredWords(t), "no word of the corrupt chunk is written")
+
+		_, err = fins.ReadSnapshot(bytes.NewReader(corrupt))
+		assert.ErrorContains(t, err, "checksum mismatch")
+	})
+
+	t.Run("Truncated Stream", func(t *testing.T) {
+		require.NoError(t, s.WriteDM(4000, make([]uint16, len(original))))
+		err := c.RestoreArea(bytes.NewReader(snapshot[:len(snapshot)-10]), nil)
+		assert.ErrorContains(t, err, "restore stopped after 1000 of 1200 words")
+		assert.Equal(t, 1000, restoredWords(t))
+
+		_, err = fins.ReadSnapshot(bytes.NewReader(snapshot[:fins.SNAPSHOT_HEADER_SIZE-1]))
+		assert.ErrorContains(t, err, "snapshot header")
+	})
+
+	t.Run("Invalid Streams", func(t *testing.T) {
+		invalid := bytes.Clone(snapshot)
+		copy(invalid, "NOTSNAPS")
+		assert.ErrorContains(t, c.RestoreArea(bytes.NewReader(invalid), nil), "invalid snapshot marker")
+
+		invalid = bytes.Clone(snapshot)
+		invalid[8] = fins.SNAPSHOT_VERSION + 1
+		assert.ErrorContains(t, c.RestoreArea(bytes.NewReader(invalid), nil), "unsupported snapshot version")
+
+		// The header declares fewer words than the chunks hold
+		invalid = bytes.Clone(snapshot)
+		binary.BigEndian.PutUint32(invalid[12:16], 100)
+		assert.ErrorContains(t, c.RestoreArea(bytes.NewReader(invalid), nil), "more words than declared")
+
+		assert.Error(t, c.SnapshotArea(io.Discard, mapping.MemoryAreaDMWord, 0, 0, nil))
+		assert.Error(t, c.SnapshotArea(io.Discard, mapping.MemoryAreaDMWord, 0xFFFF, 2, nil))
+	})
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	// Larger than one chunk, so the live comparison reads three chunks
+	words := make([]uint16, 1200)
+	for i := range words {
+		words[i] = uint16(i)
+	}
+	require.NoError(t, s.WriteDM(6000, words))
+	before := &fins.Snapshot{MemoryArea: mapping.MemoryAreaDMWord, Start: 6000, Words: words}
+
+	diffs, err := c.CompareLive(before)
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	// Changes at both ends and on both sides of the chunk boundaries
+	changed := map[uint16]uint16{6000: 0xAAAA, 6499: 1, 6500: 2, 6999: 3, 7000: 4, 7199: 0xFFFF}
+	for address, word := range changed {
+		require.NoError(t, s.WriteDM(address, []uint16{word}))
+	}
+	want := []fins.WordDiff{
+		{MemoryArea: mapping.MemoryAreaDMWord, Address: 6000, Old: 0, New: 0xAAAA},
+		{MemoryArea: mapping.MemoryAreaDMWord, Address: 6499, Old: 499, New: 1},
+		{MemoryArea: mapping.MemoryAreaDMWord, Address: 6500, Old: 500, New: 2},
+		{MemoryArea: mapping.MemoryAreaDMWord, Address: 6999, Old: 999, New: 3},
+		{MemoryArea: mapping.MemoryAreaDMWord, Address: 7000, Old: 1000, New: 4},
+		{MemoryArea: mapping.MemoryAreaDMWord, Address: 7199, Old: 1199, New: 0xFFFF},
+	}
+	diffs, err = c.CompareLive(before)
+	require.NoError(t, err)
+	assert.Equal(t, want, diffs)
+	assert.Equal(t, "area 0x82 address 6000: 0x0000 -> 0xAAAA", diffs[0].String())
+
+	var stream bytes.Buffer
+	require.NoError(t, c.SnapshotArea(&stream, mapping.MemoryAreaDMWord, 6000, len(words), nil))
+	after, err := fins.ReadSnapshot(&stream)
+	require.NoError(t, err)
+	diffs, err = fins.CompareSnapshots(before, after)
+	require.NoError(t, err)
+	assert.Equal(t, want, diffs, "snapshots compare like live memory")
+	diffs, err = fins.CompareSnapshots(after, after)
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+
+	for _, other := range []*fins.Snapshot{
+		{MemoryArea: mapping.MemoryAreaHRWord, Start: 6000, Words: words},
+		{MemoryArea: mapping.MemoryAreaDMWord, Start: 6001, Words: words},
+		{MemoryArea: mapping.MemoryAreaDMWord, Start: 6000, Words: words[:10]},
+	} {
+		_, err = fins.CompareSnapshots(before, other)
+		assert.ErrorContains(t, err, "different regions: area 0x82 6000+1200")
+	}
+
+	_, err = c.CompareLive(&fins.Snapshot{MemoryArea: mapping.MemoryAreaDMWord, Start: 32700, Words: make([]uint16, 600)})
+	assert.ErrorContains(t, err, "live read at address", "the region exceeds the DM area")
+}
+
+func TestSnapshotCSV(t *testing.T) {
+	s := &fins.Snapshot{MemoryArea: mapping.MemoryAreaDMWord, Start: 98, Words: []uint16{0x0001, 0xABCD, 0x1234, 0, 0, 0, 0, 0, 0, 0, 0, 0x00FF}}
+
+	var buf bytes.Buffer
+	require.NoError(t, s.WriteCSV(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "D00090,,,,,,,,,0001,ABCD", lines[0])
+	assert.Equal(t, "D00100,1234,0000,0000,0000,0000,0000,0000,0000,0000,00FF", lines[1])
+
+	read, err := fins.ReadSnapshotCSV(strings.NewReader(buf.String()))
+	require.NoError(t, err)
+	assert.Equal(t, s.MemoryArea, read.MemoryArea)
+	assert.Equal(t, s.Start, read.Start)
+	assert.Equal(t, s.Words, read.Words)
+
+	read, err = fins.ReadSnapshotCSV(strings.NewReader("H0010, #0001, 0x0002\n"))
+	require.NoError(t, err)
+	assert.Equal(t, mapping.MemoryAreaHRWord, read.MemoryArea)
+	assert.Equal(t, []uint16{1, 2}, read.Words)
+
+	em := &fins.Snapshot{MemoryArea: 0xa2, Start: 100, Words: []uint16{0x0102, 0x0304}}
+	buf.Reset()
+	require.NoError(t, em.WriteCSV(&buf))
+	assert.Equal(t, "E2_00100,0102,0304,,,,,,,,\n", buf.String())
+	read, err = fins.ReadSnapshotCSV(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, em, read)
+
+	_, err = fins.ReadSnapshotCSV(strings.NewReader("D00000,0001,,0003\n"))
+	assert.Error(t, err, "gaps are rejected")
+	_, err = fins.ReadSnapshotCSV(strings.NewReader("D00000,0001\nH00001,0002\n"))
+	assert.Error(t, err, "mixed areas are rejected")
+}
+
+func TestNodeAllocation(t *testing.T) {
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	require.NoError(t, err)
+	defer s.Close()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, 10, 0)
+	require.NoError(t, err)
+
+	t.Run("Node in use", func(t *testing.T) {
+		c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{ClientNode: 50})
+		require.NoError(t, err)
+		defer c.Close()
+		assert.Equal(t, byte(50), c.ClientNode())
+
+		_, err = fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{ClientNode: 50})
+		var handshakeErr fins.HandshakeError
+		require.ErrorAs(t, err, &handshakeErr)
+		assert.True(t, handshakeErr.NodeInUse())
+		assert.Equal(t, byte(50), handshakeErr.Node)
+		assert.Contains(t, err.Error(), "NodeAllocator", "the error suggests a remedy")
+
+		_, err = fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{ClientNode: simulator.SIMULATOR_NODE})
+		require.ErrorAs(t, err, &handshakeErr)
+		assert.Equal(t, uint32(finsproto.TCP_ERROR_SAME_NODE), handshakeErr.Code)
+	})
+
+	t.Run("File allocator", func(t *testing.T) {
+		allocator := fins.FileNodeAllocator{Dir: t.TempDir(), Min: 100, Max: 101}
+		opts := fins.Options{NodeAllocator: allocator}
+
+		a, err := fins.NewClientWithOptions(clientAddr, plcAddr, opts)
+		require.NoError(t, err)
+		b, err := fins.NewClientWithOptions(clientAddr, plcAddr, opts)
+		require.NoError(t, err)
+		assert.Equal(t, byte(100), a.ClientNode())
+		assert.Equal(t, byte(101), b.ClientNode())
+
+		_, err = fins.NewClientWithOptions(clientAddr, plcAddr, opts)
+		assert.ErrorContains(t, err, "allocated", "the range is exhausted")
+
+		require.NoError(t, a.Close())
+		// The PLC frees the node once it notices the disconnect
+		require.Eventually(t, func() bool { return len(s.Clients()) == 1 }, time.Second, 10*time.Millisecond)
+		c, err := fins.NewClientWithOptions(clientAddr, plcAddr, opts)
+		require.NoError(t, err, "closing a client releases its node")
+		assert.Equal(t, byte(100), c.ClientNode())
+		c.Close()
+		b.Close()
+	})
+
+	t.Run("Stale lock file", func(t *testing.T) {
+		dir := t.TempDir()
+		allocator := fins.FileNodeAllocator{Dir: dir, Min: 110, Max: 110}
+		_, release, err := allocator.AllocateNode(nil, s.Addr())
+		require.NoError(t, err)
+		_, _, err = allocator.AllocateNode(nil, s.Addr())
+		assert.Error(t, err)
+
+		// The lock file of a process that died stays behind, unlocked
+		release()
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+
+		node, release, err := allocator.AllocateNode(nil, s.Addr())
+		require.NoError(t, err)
+		assert.Equal(t, byte(110), node)
+		release()
+	})
+
+	t.Run("Concurrent allocations", func(t *testing.T) {
+		allocator := fins.FileNodeAllocator{Dir: t.TempDir(), Min: 130, Max: 133}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		nodes := make(map[byte]int)
+		for range 16 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if node, release, err := allocator.AllocateNode(nil, s.Addr()); err == nil {
+					mu.Lock()
+					nodes[node]++
+					mu.Unlock()
+					t.Cleanup(release)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, map[byte]int{130: 1, 131: 1, 132: 1, 133: 1}, nodes, "every node is allocated once")
+	})
+
+	t.Run("Port allocator", func(t *testing.T) {
+		c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{NodeAllocator: fins.PortNodeAllocator{Min: 120, Max: 129}})
+		require.NoError(t, err)
+		defer c.Close()
+		assert.GreaterOrEqual(t, c.ClientNode(), byte(120))
+		assert.LessOrEqual(t, c.ClientNode(), byte(129))
+	})
+}
+
+func TestPing(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	s.SetLatency(simulator.FixedLatency(20 * time.Millisecond))
+	rtt, err := c.Ping()
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, rtt, 20*time.Millisecond)
+	s.SetLatency(nil)
+
+	// A unit without the clock read answers the status read probe
+	s.Replay([]simulator.Exchange{{CommandCode: mapping.CommandCodeClockRead, Request: []byte{}, EndCode: mapping.EndCodeUndefinedCommand}})
+	_, err = c.Ping()
+	var endErr fins.EndCodeError
+	require.ErrorAs(t, err, &endErr)
+	assert.Equal(t, mapping.EndCodeUndefinedCommand, endErr.EndCode)
+
+	rtt, err = c.PingWith(fins.ProbeStatusRead)
+	require.NoError(t, err)
+	assert.Positive(t, rtt)
+}
+
+func TestSessionKeepAlive(t *testing.T) {
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	require.NoError(t, err)
+	defer s.Close()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, 10, 0)
+	require.NoError(t, err)
+
+	reconnected := make(chan struct{}, 1)
+	c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{
+		SessionKeepAlive: 50 * time.Millisecond,
+		KeepAliveProbe:   fins.ProbeStatusRead,
+		ReconnectBackoff: fins.ConstantBackoff{Interval: 10 * time.Millisecond, MaxAttempts: 5},
+		OnReconnectAttempt: func(a fins.ReconnectAttempt) {
+			if a.Err == nil {
+				reconnected <- struct{}{}
+			}
+		},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	time.Sleep(200 * time.Millisecond)
+	probes := 0
+	for _, e := range s.RequestLog() {
+		if e.CommandCode == mapping.CommandCodeCPUUnitStatusRead {
+			probes++
+		}
+	}
+	assert.GreaterOrEqual(t, probes, 2, "the idle session is probed")
+	assert.Less(t, c.Idle(), 100*time.Millisecond)
+
+	// A probe without an answer drops the connection and reconnects
+	s.SetPacketLoss(1)
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no reconnect after the probe failed")
+	}
+	s.SetPacketLoss(0)
+	_, err = c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	assert.NoError(t, err)
+}
+
+func TestHalfOpenDetection(t *testing.T) {
+	s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+	require.NoError(t, err)
+	defer s.Close()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", s.Addr().Port, 0, 10, 0)
+	require.NoError(t, err)
+
+	reconnected := make(chan struct{}, 1)
+	c, err := fins.NewClientWithOptions(clientAddr, plcAddr, fins.Options{
+		HalfOpenTimeout:  100 * time.Millisecond,
+		ReconnectBackoff: fins.ConstantBackoff{Interval: 10 * time.Millisecond, MaxAttempts: 5},
+		OnReconnectAttempt: func(a fins.ReconnectAttempt) {
+			if a.Err == nil {
+				reconnected <- struct{}{}
+			}
+		},
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	// The PLC stops answering while the connection stays open
+	s.SetPacketLoss(1)
+	_, err = c.WithTimeout(50*time.Millisecond).ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	assert.Error(t, err)
+	select {
+	case <-reconnected:
+		t.Fatal("a single timeout right after traffic must not reconnect")
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	_, err = c.WithTimeout(50*time.Millisecond).ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	assert.Error(t, err)
+	select {
+	case <-reconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the half-open connection was not re-established")
+	}
+
+	s.SetPacketLoss(0)
+	_, err = c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	assert.NoError(t, err)
+}
+
+func TestDeadbandFilter(t *testing.T) {
+	start := time.Now()
+	at := func(seconds float64) time.Time { return start.Add(time.Duration(seconds * float64(time.Second))) }
+	value := func(v float64) fins.TagValue { return fins.TagValue{Value: v} }
+
+	type reading struct {
+		seconds float64
+		value   float64
+		report  bool
+	}
+	for _, tc := range []struct {
+		name     string
+		deadband *fins.Deadband
+		readings []reading
+	}{
+		{"None", nil, []reading{{0, 10, true}, {1, 10, false}, {2, 10.01, true}}},
+		{"Absolute", &fins.Deadband{Type: fins.DeadbandAbsolute, Value: 1},
+			[]reading{{0, 10, true}, {1, 10.5, false}, {2, 11, false}, {3, 11.5, true}, {4, 10.6, false}, {5, 10.4, true}}},
+		{"Percent Of Span", &fins.Deadband{Type: fins.DeadbandPercent, Value: 2, Span: 500},
+			[]reading{{0, 100, true}, {1, 109, false}, {2, 111, true}}},
+		{"Percent Of Value", &fins.Deadband{Type: fins.DeadbandPercent, Value: 10},
+			[]reading{{0, 100, true}, {1, 95, false}, {2, 89, true}, {3, 95, false}, {4, 98, true}}},
+		// A deviation of 1 reports after 5s, one of 5 at once
+		{"Integral", &fins.Deadband{Type: fins.DeadbandIntegral, Value: 4.5},
+			[]reading{{0, 10, true}, {1, 11, false}, {2, 11, false}, {3, 11, false}, {4, 11, false}, {5, 11, true}, {6, 16, true}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := fins.NewDeadbandFilter(tc.deadband)
+			for _, r := range tc.readings {
+				assert.Equal(t, r.report, f.Report(value(r.value), at(r.seconds)), "%v at %vs", r.value, r.seconds)
+			}
+		})
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		f := fins.NewDeadbandFilter(&fins.Deadband{Type: fins.DeadbandAbsolute, Value: 100})
+		assert.True(t, f.Report(value(1), at(0)))
+		failed := fins.TagValue{Err: fmt.Errorf("timeout")}
+		assert.True(t, f.Report(failed, at(1)), "a failed read is reported")
+		assert.False(t, f.Report(failed, at(2)), "the same error once")
+		assert.True(t, f.Report(value(1), at(3)), "the recovery is reported")
+	})
+
+	assert.NoError(t, fins.Deadband{Type: fins.DeadbandIntegral, Value: 3}.Validate())
+	assert.Error(t, fins.Deadband{Type: "sometimes"}.Validate())
+	assert.Error(t, fins.Deadband{Type: fins.DeadbandAbsolute, Value: -1}.Validate())
+}
+
+func TestCyclicPoller(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	tag := fins.Tag{Name: "speed", MemoryArea: mapping.MemoryAreaDMWord, Address: 10, DataType: fins.DataTypeUint}
+	require.NoError(t, s.WriteDM(10, []uint16{42}))
+
+	var mu sync.Mutex
+	periods := map[string]time.Duration{"fast": 20 * time.Millisecond, "slow": 100 * time.Millisecond}
+	first := make(map[string]fins.PollSample)
+	onSample := func(s fins.PollSample) {
+		mu.Lock()
+		defer mu.Unlock()
+		f, ok := first[s.Group]
+		if !ok {
+			first[s.Group] = s
+			return
+		}
+		assert.Equal(t, periods[s.Group]*time.Duration(s.Cycle-f.Cycle), s.Scheduled.Sub(f.Scheduled), "cycles don't drift")
+	}
+
+	p, err := fins.NewCyclicPoller(c, []fins.PollGroup{
+		{Name: "fast", Tags: []fins.Tag{tag}, Period: 20 * time.Millisecond, OnSample: onSample},
+		{Name: "slow", Tags: []fins.Tag{tag}, Period: 100 * time.Millisecond, Phase: 10 * time.Millisecond, OnSample: onSample},
+	})
+	require.NoError(t, err)
+	time.Sleep(250 * time.Millisecond)
+	p.Close()
+
+	fast, ok := p.Stats("fast")
+	require.True(t, ok)
+	slow, _ := p.Stats("slow")
+	assert.GreaterOrEqual(t, fast.Cycles, int64(8))
+	assert.GreaterOrEqual(t, slow.Cycles, int64(2))
+	assert.Zero(t, fast.Overruns)
+
+	mu.Lock()
+	assert.Equal(t, 10*time.Millisecond, first["slow"].Scheduled.Sub(first["fast"].Scheduled), "the groups keep their phase")
+	assert.Equal(t, 42.0, first["fast"].Values[0].Value)
+	mu.Unlock()
+
+	t.Run("Overrun", func(t *testing.T) {
+		s.SetLatency(simulator.FixedLatency(30 * time.Millisecond))
+		defer s.SetLatency(nil)
+
+		samples := make(chan fins.PollSample, 16)
+		p, err := fins.NewCyclicPoller(c, []fins.PollGroup{
+			{Name: "fast", Tags: []fins.Tag{tag}, Period: 20 * time.Millisecond, OnSample: func(s fins.PollSample) { samples <- s }},
+		})
+		require.NoError(t, err)
+		first, second := <-samples, <-samples
+		p.Close()
+
+		assert.True(t, first.Overrun)
+		assert.Equal(t, 1, first.Skipped)
+		assert.Equal(t, first.Cycle+2, second.Cycle, "the overlapped cycle is skipped")
+		stats, _ := p.Stats("fast")
+		assert.GreaterOrEqual(t, stats.Overruns, int64(1))
+	})
+
+	t.Run("Stamp", func(t *testing.T) {
+		counter := fins.Tag{Name: "scan", MemoryArea: mapping.MemoryAreaDMWord, Address: 20, DataType: fins.DataTypeUdint}
+		require.NoError(t, s.WriteDM(20, []uint16{7, 0}))
+
+		samples := make(chan fins.PollSample, 16)
+		p, err := fins.NewCyclicPoller(c, []fins.PollGroup{
+			{Name: "stamped", Tags: []fins.Tag{tag}, Period: 20 * time.Millisecond, Stamp: &counter, OnSample: func(s fins.PollSample) { samples <- s }},
+		})
+		require.NoError(t, err)
+		sample := <-samples
+		p.Close()
+
+		require.NotNil(t, sample.Stamp)
+		require.NoError(t, sample.Stamp.Err)
+		assert.Equal(t, 7.0, sample.Stamp.Value)
+		assert.Equal(t, "scan", sample.Stamp.Tag.Name)
+		assert.Nil(t, first["fast"].Stamp, "groups without a stamp tag")
+	})
+
+	t.Run("Coalesce", func(t *testing.T) {
+		require.NoError(t, s.WriteDM(100, []uint16{0x0008, 0x0000, 0x4048, 0, 0, 0xFFFE}))
+		require.NoError(t, s.WriteDM(200, []uint16{9}))
+		tags := []fins.Tag{
+			{Name: "far", MemoryArea: mapping.MemoryAreaDMWord, Address: 200, DataType: fins.DataTypeUint},
+			{Name: "real", MemoryArea: mapping.MemoryAreaDMWord, Address: 101, DataType: fins.DataTypeReal},
+			{Name: "word", MemoryArea: mapping.MemoryAreaDMWord, Address: 100, DataType: fins.DataTypeUint},
+			{Name: "bit", MemoryArea: mapping.MemoryAreaDMBit, Address: 100, BitOffset: 3, DataType: fins.DataTypeBool},
+			{Name: "int", MemoryArea: mapping.MemoryAreaDMWord, Address: 105, DataType: fins.DataTypeInt},
+		}
+
+		samples := make(chan fins.PollSample, 16)
+		p, err := fins.NewCyclicPoller(c, []fins.PollGroup{
+			{Name: "coalesced", Tags: tags, Period: 20 * time.Millisecond, Coalesce: true, MaxGap: 2, OnSample: func(s fins.PollSample) { samples <- s }},
+		})
+		require.NoError(t, err)
+		sample := <-samples
+		p.Close()
+
+		values := make(map[string]float64)
+		for i, v := range sample.Values {
+			require.NoError(t, v.Err)
+			assert.Equal(t, tags[i].Name, v.Tag.Name, "values are in the order of the tags")
+			values[v.Tag.Name] = v.Value
+		}
+		assert.Equal(t, map[string]float64{"far": 9, "real": 3.125, "word": 8, "bit": 1, "int": -2}, values)
+
+		stats, _ := p.Stats("coalesced")
+		assert.Equal(t, 2*stats.Cycles, stats.Reads, "D100 to D105 in one read, D200 in another")
+		assert.Equal(t, 5*stats.Cycles, stats.TagReads)
+		assert.Equal(t, 2*stats.Cycles, stats.GapWords, "D103 and D104 bridge the gap")
+		assert.Equal(t, 2.5, stats.TagsPerRead())
+	})
+
+	t.Run("Adaptive", func(t *testing.T) {
+		require.NoError(t, s.WriteDM(300, []uint16{5, 0}))
+		tags := []fins.Tag{
+			{Name: "still", MemoryArea: mapping.MemoryAreaDMWord, Address: 300, DataType: fins.DataTypeUint},
+			{Name: "moving", MemoryArea: mapping.MemoryAreaDMWord, Address: 301, DataType: fins.DataTypeUint},
+		}
+
+		// Every sample changes the moving tag before the next cycle
+		samples := make(chan fins.PollSample, 32)
+		p, err := fins.NewCyclicPoller(c, []fins.PollGroup{{
+			Name: "adaptive", Tags: tags, Period: 10 * time.Millisecond, MaxPeriod: 80 * time.Millisecond,
+			OnSample: func(sample fins.PollSample) {
+				s.WriteDM(301, []uint16{uint16(sample.Cycle + 1)})
+				samples <- sample
+			},
+		}})
+		require.NoError(t, err)
+		var stillReads int
+		for range 20 {
+			sample := <-samples
+			require.Len(t, sample.Values, 2)
+			assert.Equal(t, 5.0, sample.Values[0].Value, "a tag not read keeps its last value")
+			assert.True(t, sample.Fresh[1], "the changing tag is read every cycle")
+			if sample.Fresh[0] {
+				stillReads++
+			}
+		}
+		p.Close()
+
+		// Cycles 0, 1, 3, 7 and 15 read the unchanged tag, fewer with overruns
+		assert.GreaterOrEqual(t, stillReads, 2)
+		assert.LessOrEqual(t, stillReads, 5)
+		stats, _ := p.Stats("adaptive")
+		assert.Positive(t, stats.Deferred)
+		assert.Equal(t, 2*stats.Cycles, stats.TagReads+stats.Deferred)
+
+		_, err = fins.NewCyclicPoller(c, []fins.PollGroup{{Name: "bad", Period: time.Second, MaxPeriod: time.Millisecond}})
+		assert.Error(t, err)
+	})
+
+	_, err = fins.NewCyclicPoller(c, []fins.PollGroup{{Name: "bad", Period: time.Second, Phase: time.Second}})
+	assert.Error(t, err)
+}
+
+func TestConcurrencyStress(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	run := func(fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				fn(i)
+			}
+		}()
+	}
+
+	for w := 0; w < 4; w++ {
+		address := uint16(100 * w)
+		run(func(i int) {
+			c.WriteWords(mapping.MemoryAreaDMWord, address, []uint16{uint16(i)})
+			c.ReadWords(mapping.MemoryAreaDMWord, address, 1)
+		})
+	}
+	run(func(int) { c.WithPriority(fins.PriorityHigh).ReadBits(mapping.MemoryAreaDMBit, 0, 0, 4) })
+	run(func(int) { c.ReadClock() })
+	run(func(i int) {
+		tag := fins.Tag{Name: "t", MemoryArea: mapping.MemoryAreaDMWord, Address: 500, DataType: fins.DataTypeReal}
+		c.WriteTag(tag, float64(i))
+		c.ReadTag(tag)
+		c.UpdateWord(mapping.MemoryAreaDMWord, 510, func(v uint16) uint16 { return v + 1 })
+	})
+	run(func(i int) {
+		c.SetTimeoutMs(uint(1000 + i%10))
+		c.SetByteOrder(binary.BigEndian)
+		c.Diagnostics()
+		c.Idle()
+		c.ClientNode()
+		c.Profile()
+	})
+	run(func(int) {
+		c.OnCommand(func(fins.Request) (uint16, []byte) { return mapping.EndCodeNormalCompletion, nil })
+		c.Use(func(next fins.Sender) fins.Sender { return next })
+		c.SetWriteGuard(func(fins.MemoryWrite) error { return nil })
+		c.SetAuditSink(nil, false)
+		c.SetVariableBackend(mapVariables{})
+		c.SetKeepAlive(true, time.Second)
+		c.OnReconnect(func() {})
+		time.Sleep(time.Millisecond)
+	})
+	run(func(int) {
+		// Drop the connection under the running commands
+		s.DisconnectClients()
+		c.Reconnect()
+		time.Sleep(20 * time.Millisecond)
+	})
+
+	time.Sleep(500 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	assert.NoError(t, c.Reconnect())
+	_, err := c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	assert.NoError(t, err)
+
+	// Closing while commands run
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+			}
+		}()
+	}
+	c.Close()
+	wg.Wait()
+	_, err = c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,85 @@
+package fins
+
+import (
+	"flag"
+	"fmt"
+	"testing"
+	"time"
+
+	"folke99/gofins/config"
+	"folke99/gofins/mapping"
+	"folke99/gofins/simulator"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	t.Run("Defaults, Env and Flags", func(t *testing.T) {
+		t.Setenv("FINS_ADDRESS", "10.0.0.5")
+		t.Setenv("FINS_NODE", "33")
+		t.Setenv("FINS_TIMEOUT", "2s")
+		t.Setenv("FINS_PORT", "9700")
+
+		cfg := config.Default()
+		require.NoError(t, cfg.LoadEnv(config.ENV_PREFIX))
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		cfg.RegisterFlags(fs, "")
+		require.NoError(t, fs.Parse([]string{"-port", "9800", "-detect-profile", "-local-node", "0x0A"}))
+
+		assert.Equal(t, "10.0.0.5", cfg.Address)
+		assert.Equal(t, byte(33), cfg.Node)
+		assert.Equal(t, 2*time.Second, cfg.Timeout)
+		assert.Equal(t, 9800, cfg.Port, "flags override the environment")
+		assert.True(t, cfg.DetectProfile)
+		assert.Equal(t, byte(10), cfg.LocalNode)
+		assert.Equal(t, 5*time.Second, cfg.DialTimeout, "unset settings keep their default")
+		assert.Equal(t, "9700", fs.Lookup("port").DefValue, "the environment sets the flag defaults")
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Setenv("FINS_NODE", "300")
+		cfg := config.Default()
+		assert.ErrorContains(t, cfg.LoadEnv(config.ENV_PREFIX), "FINS_NODE")
+
+		cfg = config.Default()
+		assert.Error(t, cfg.Validate(), "the PLC address has no default")
+		cfg.Address = "10.0.0.5"
+		cfg.Port = 0
+		assert.Error(t, cfg.Validate())
+	})
+
+	t.Run("Manager", func(t *testing.T) {
+		s, err := simulator.NewPLCSimulator("127.0.0.1:0")
+		require.NoError(t, err)
+		defer s.Close()
+
+		t.Setenv("FINS_PLCS", "kiln, dryer-2")
+		for _, prefix := range []string{"FINS_KILN_", "FINS_DRYER_2_"} {
+			t.Setenv(prefix+"ADDRESS", "127.0.0.1")
+			t.Setenv(prefix+"PORT", fmt.Sprint(s.Addr().Port))
+			t.Setenv(prefix+"NODE", "10")
+		}
+		t.Setenv("FINS_KILN_LOCAL_ADDRESS", "127.0.0.1")
+
+		plcs, err := config.LoadPLCs(config.ENV_PREFIX)
+		require.NoError(t, err)
+		require.Len(t, plcs, 2)
+		assert.Equal(t, "127.0.0.1", plcs["dryer-2"].Address)
+
+		m, err := config.NewManager(plcs, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"dryer-2", "kiln"}, m.Names())
+		for _, name := range m.Names() {
+			c, _ := m.Client(name)
+			_, err := c.ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+			assert.NoError(t, err)
+			c.Close()
+		}
+
+		t.Setenv("FINS_PLCS", "")
+		_, err = config.LoadPLCs(config.ENV_PREFIX)
+		assert.Error(t, err)
+	})
+}
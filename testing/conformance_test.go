@@ -0,0 +1,317 @@
+package fins
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"folke99/gofins/finsproto"
+	"folke99/gofins/mapping"
+
+	"folke99/gofins/fins"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Known-good FINS/TCP frames in the layout CJ2 and CS1 CPUs exchange: PC node 2, PLC node 10.
+// Encoding changes must keep these bytes, add frames here when a new command is supported.
+var goldenFrames = []struct {
+	name     string
+	frame    string
+	command  uint32
+	payload  string              // Handshake frames
+	request  *finsproto.Request  // Command frames
+	response *finsproto.Response // Response frames
+}{
+	{
+		name:    "Node Address Request",
+		frame:   "46494E53 0000000C 00000000 00000000 00000000",
+		command: finsproto.TCP_COMMAND_NODE_ADDRESS_REQUEST,
+		payload: "00000000",
+	},
+	{
+		name:    "Node Address Response",
+		frame:   "46494E53 00000010 00000001 00000000 00000002 0000000A",
+		command: finsproto.TCP_COMMAND_NODE_ADDRESS_RESPONSE,
+		payload: "00000002 0000000A",
+	},
+	{
+		name:    "Memory Area Read D100 3 Words",
+		frame:   "46494E53 0000001A 00000002 00000000 80 00 02 00 0A 00 00 02 00 01 0101 82 0064 00 0003",
+		command: finsproto.TCP_COMMAND_FRAME_SEND,
+		request: &finsproto.Request{
+			Header:      finsproto.Header{ICF: 0x80, GCT: 2, DA1: 10, SA1: 2, SID: 1},
+			CommandCode: mapping.CommandCodeMemoryAreaRead,
+			Data:        []byte{0x82, 0x00, 0x64, 0x00, 0x00, 0x03},
+		},
+	},
+	{
+		name:    "Memory Area Read Response",
+		frame:   "46494E53 0000001C 00000002 00000000 C0 00 02 00 02 00 00 0A 00 01 0101 0000 0001 0002 0003",
+		command: finsproto.TCP_COMMAND_FRAME_SEND,
+		response: &finsproto.Response{
+			Header:      finsproto.Header{ICF: 0xC0, GCT: 2, DA1: 2, SA1: 10, SID: 1},
+			CommandCode: mapping.CommandCodeMemoryAreaRead,
+			EndCode:     mapping.EndCodeNormalCompletion,
+			Data:        []byte{0x00, 0x01, 0x00, 0x02, 0x00, 0x03},
+		},
+	},
+	{
+		name:    "Memory Area Write D200 2 Words",
+		frame:   "46494E53 0000001E 00000002 00000000 80 00 02 00 0A 00 00 02 00 02 0102 82 00C8 00 0002 1234 5678",
+		command: finsproto.TCP_COMMAND_FRAME_SEND,
+		request: &finsproto.Request{
+			Header:      finsproto.Header{ICF: 0x80, GCT: 2, DA1: 10, SA1: 2, SID: 2},
+			CommandCode: mapping.CommandCodeMemoryAreaWrite,
+			Data:        []byte{0x82, 0x00, 0xC8, 0x00, 0x00, 0x02, 0x12, 0x34, 0x56, 0x78},
+		},
+	},
+	{
+		name:    "Memory Area Write D10.03 Bit",
+		frame:   "46494E53 0000001B 00000002 00000000 80 00 02 00 0A 00 00 02 00 03 0102 02 000A 03 0001 01",
+		command: finsproto.TCP_COMMAND_FRAME_SEND,
+		request: &finsproto.Request{
+			Header:      finsproto.Header{ICF: 0x80, GCT: 2, DA1: 10, SA1: 2, SID: 3},
+			CommandCode: mapping.CommandCodeMemoryAreaWrite,
+			Data:        []byte{0x02, 0x00, 0x0A, 0x03, 0x00, 0x01, 0x01},
+		},
+	},
+	{
+		name:    "Memory Area Write Without Response",
+		frame:   "46494E53 0000001C 00000002 00000000 81 00 02 00 0A 00 00 02 00 04 0102 82 0000 00 0001 FFFF",
+		command: finsproto.TCP_COMMAND_FRAME_SEND,
+		request: &finsproto.Request{
+			Header:      finsproto.Header{ICF: 0x81, GCT: 2, DA1: 10, SA1: 2, SID: 4},
+			CommandCode: mapping.CommandCodeMemoryAreaWrite,
+			Data:        []byte{0x82, 0x00, 0x00, 0x00, 0x00, 0x01, 0xFF, 0xFF},
+		},
+	},
+	{
+		name:    "Address Range Error Response",
+		frame:   "46494E53 00000016 00000002 00000000 C0 00 02 00 02 00 00 0A 00 05 0101 1103",
+		command: finsproto.TCP_COMMAND_FRAME_SEND,
+		response: &finsproto.Response{
+			Header:      finsproto.Header{ICF: 0xC0, GCT: 2, DA1: 2, SA1: 10, SID: 5},
+			CommandCode: mapping.CommandCodeMemoryAreaRead,
+			EndCode:     mapping.EndCodeAddressRangeError,
+			Data:        []byte{},
+		},
+	},
+	{
+		name:    "Clock Read Response",
+		frame:   "46494E53 0000001D 00000002 00000000 C0 00 02 00 02 00 00 0A 00 06 0701 0000 24 03 15 14 30 05 05",
+		command: finsproto.TCP_COMMAND_FRAME_SEND,
+		response: &finsproto.Response{
+			Header:      finsproto.Header{ICF: 0xC0, GCT: 2, DA1: 2, SA1: 10, SID: 6},
+			CommandCode: mapping.CommandCodeClockRead,
+			EndCode:     mapping.EndCodeNormalCompletion,
+			Data:        []byte{0x24, 0x03, 0x15, 0x14, 0x30, 0x05, 0x05},
+		},
+	},
+}
+
+func goldenBytes(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	require.NoError(t, err)
+	return b
+}
+
+func TestGoldenFrames(t *testing.T) {
+	for _, g := range goldenFrames {
+		t.Run(g.name, func(t *testing.T) {
+			frame := goldenBytes(t, g.frame)
+
+			command, payload, err := finsproto.ReadTCPFrame(bytes.NewReader(frame))
+			require.NoError(t, err)
+			assert.Equal(t, g.command, command)
+
+			var encoded []byte
+			switch {
+			case g.request != nil:
+				req, err := finsproto.DecodeRequest(payload)
+				require.NoError(t, err)
+				assert.Equal(t, *g.request, req)
+				encoded = finsproto.EncodeHeader(req.Header)
+				encoded = append(encoded, byte(req.CommandCode>>8), byte(req.CommandCode))
+				encoded = append(encoded, req.Data...)
+			case g.response != nil:
+				resp, err := finsproto.DecodeResponse(payload)
+				require.NoError(t, err)
+				assert.Equal(t, *g.response, resp)
+				assert.Equal(t, g.response.EndCode, resp.GetEndCode())
+				assert.Equal(t, g.response.Data, resp.GetData())
+				encoded = finsproto.EncodeResponse(resp)
+			default:
+				assert.Equal(t, goldenBytes(t, g.payload), payload)
+				encoded = payload
+			}
+			assert.Equal(t, frame, finsproto.TCPFrame(command, encoded), "re-encoded frame")
+		})
+	}
+}
+
+func TestGoldenCommands(t *testing.T) {
+	testCases := []struct {
+		name    string
+		command []byte
+		want    string
+	}{
+		{"Read", finsproto.ReadCommand(finsproto.MemoryAddress{MemoryArea: 0x82, Address: 100}, 3), "0101 82 0064 00 0003"},
+		{"Write", finsproto.WriteCommand(finsproto.MemoryAddress{MemoryArea: 0x82, Address: 200}, 2, []byte{0x12, 0x34, 0x56, 0x78}), "0102 82 00C8 00 0002 1234 5678"},
+		{"Bit Write", finsproto.WriteCommand(finsproto.MemoryAddress{MemoryArea: 0x02, Address: 10, BitOffset: 3}, 1, []byte{1}), "0102 02 000A 03 0001 01"},
+		{"Clock Read", finsproto.ClockReadCommand(), "0701"},
+		{"Clock Write", finsproto.ClockWriteCommand(time.Date(2024, 3, 15, 14, 30, 5, 0, time.Local)), "0702 24 03 15 14 30 05 05"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, goldenBytes(t, tc.want), tc.command, tc.name)
+	}
+}
+
+// TestClientWireFormat checks the bytes the client puts on the wire against the golden frames
+func TestClientWireFormat(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 256)
+		n, _ := conn.Read(buf)
+		if !bytes.Equal(buf[:n], goldenBytes(t, goldenFrames[0].frame)) {
+			received <- buf[:n]
+			return
+		}
+		conn.Write(goldenBytes(t, goldenFrames[1].frame))
+
+		_, payload, err := finsproto.ReadTCPFrame(conn)
+		if err != nil {
+			return
+		}
+		received <- finsproto.TCPFrame(finsproto.TCP_COMMAND_FRAME_SEND, payload)
+		conn.Write(goldenBytes(t, goldenFrames[3].frame))
+	}()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", l.Addr().(*net.TCPAddr).Port, 0, 10, 0)
+	require.NoError(t, err)
+	c, err := fins.NewClient(clientAddr, plcAddr)
+	require.NoError(t, err)
+	defer c.Close()
+
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 100, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{1, 2, 3}, words)
+	assert.Equal(t, goldenBytes(t, goldenFrames[2].frame), <-received)
+}
+
+func TestDecodeTCPFrame(t *testing.T) {
+	command, payload, err := finsproto.DecodeTCPFrame(goldenBytes(t, goldenFrames[1].frame))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(finsproto.TCP_COMMAND_NODE_ADDRESS_RESPONSE), command)
+	assert.Equal(t, goldenBytes(t, goldenFrames[1].payload), payload)
+
+	for name, frame := range map[string]string{
+		"Short":      "46494E53 00000004 00000002",
+		"Marker":     "46494E54 00000008 00000002 00000000",
+		"Truncated":  "46494E53 0000000C 00000002 00000000",
+		"Oversized":  "46494E53 00000008 00000002 00000000 C0000200",
+		"Empty":      "",
+		"Header Cut": "46494E53 00000008",
+	} {
+		_, _, err := finsproto.DecodeTCPFrame(goldenBytes(t, frame))
+		assert.Error(t, err, name)
+	}
+}
+
+// TestMalformedFrames sends a malformed frame ahead of the response to each read, the client
+// must discard it and keep the connection
+func TestMalformedFrames(t *testing.T) {
+	respond := func(req finsproto.Request, data ...byte) []byte {
+		return finsproto.TCPFrame(finsproto.TCP_COMMAND_FRAME_SEND, finsproto.EncodeResponse(finsproto.NewResponse(req, 0, data)))
+	}
+	scripts := []func(req finsproto.Request) []byte{
+		func(req finsproto.Request) []byte { // Frame shorter than the FINS/TCP header
+			return append(goldenBytes(t, "46494E53 00000004 00000002"), respond(req, 0, 1, 0, 2)...)
+		},
+		func(req finsproto.Request) []byte { // Frame without FINS message
+			return append(finsproto.TCPFrame(finsproto.TCP_COMMAND_FRAME_SEND, nil), respond(req, 0, 1, 0, 2)...)
+		},
+		func(req finsproto.Request) []byte { // FINS message cut within the header
+			bad := finsproto.EncodeResponse(finsproto.NewResponse(req, 0, []byte{0xFF, 0xFF, 0xFF, 0xFF}))[:10]
+			return append(finsproto.TCPFrame(finsproto.TCP_COMMAND_FRAME_SEND, bad), respond(req, 0, 1, 0, 2)...)
+		},
+		func(req finsproto.Request) []byte { // Response in a frame that isn't a FINS frame send
+			bad := finsproto.EncodeResponse(finsproto.NewResponse(req, 0, []byte{0xFF, 0xFF, 0xFF, 0xFF}))
+			return append(finsproto.TCPFrame(3, bad), respond(req, 0, 1, 0, 2)...)
+		},
+		func(req finsproto.Request) []byte { // Data beyond the length field
+			frame := respond(req)
+			return append(frame, 0, 1, 0, 2)
+		},
+		func(req finsproto.Request) []byte {
+			return respond(req, 0, 3, 0, 4)
+		},
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, _, err := finsproto.ReadTCPFrame(conn); err != nil {
+			return
+		}
+		conn.Write(goldenBytes(t, goldenFrames[1].frame))
+		for _, script := range scripts {
+			_, payload, err := finsproto.ReadTCPFrame(conn)
+			if err != nil {
+				return
+			}
+			req, err := finsproto.DecodeRequest(payload)
+			if err != nil {
+				return
+			}
+			conn.Write(script(req))
+		}
+		io.Copy(io.Discard, conn)
+	}()
+
+	clientAddr, err := fins.NewAddress("127.0.0.1", 9600, 0, 2, 0)
+	require.NoError(t, err)
+	plcAddr, err := fins.NewAddress("127.0.0.1", l.Addr().(*net.TCPAddr).Port, 0, 10, 0)
+	require.NoError(t, err)
+	c, err := fins.NewClient(clientAddr, plcAddr)
+	require.NoError(t, err)
+	defer c.Close()
+	c = c.WithTimeout(time.Second)
+
+	for i := range 4 {
+		words, err := c.ReadWords(mapping.MemoryAreaDMWord, 100, 2)
+		require.NoError(t, err, "script %d", i)
+		assert.Equal(t, []uint16{1, 2}, words, "script %d", i)
+	}
+
+	_, err = c.ReadWords(mapping.MemoryAreaDMWord, 100, 2)
+	var protoErr fins.ProtocolError
+	require.ErrorAs(t, err, &protoErr, "data beyond the length field isn't part of the response")
+
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 100, 2)
+	require.NoError(t, err, "the client resyncs on the next frame")
+	assert.Equal(t, []uint16{3, 4}, words)
+}
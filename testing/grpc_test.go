@@ -0,0 +1,134 @@
+package fins
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"folke99/gofins/fins"
+	finsgrpc "folke99/gofins/grpc"
+	"folke99/gofins/grpc/finspb"
+	"folke99/gofins/mapping"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCService(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	m := fins.NewManager(1)
+	m.Add("kiln", c)
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	finsgrpc.NewServer(m).Register(server)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := finspb.NewFINSClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	temp := &finspb.Tag{Name: "temp", MemoryArea: uint32(mapping.MemoryAreaDMWord), Address: 600, DataType: string(fins.DataTypeReal)}
+	count := &finspb.Tag{Name: "count", MemoryArea: uint32(mapping.MemoryAreaDMWord), Address: 602, DataType: string(fins.DataTypeUint)}
+
+	t.Run("Write and Read", func(t *testing.T) {
+		wr, err := client.Write(ctx, &finspb.WriteRequest{Plc: "kiln", Writes: []*finspb.TagWrite{
+			{Tag: temp, Value: 812.5},
+			{Tag: count, Value: -1},
+		}})
+		require.NoError(t, err)
+		assert.Empty(t, wr.Errors[0])
+		assert.NotEmpty(t, wr.Errors[1], "UINT can't hold -1")
+
+		rr, err := client.Read(ctx, &finspb.ReadRequest{Plc: "kiln", Tags: []*finspb.Tag{temp}})
+		require.NoError(t, err)
+		require.Len(t, rr.Values, 1)
+		assert.Equal(t, 812.5, rr.Values[0].Value)
+		assert.Equal(t, "temp", rr.Values[0].Tag.Name)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := client.Read(ctx, &finspb.ReadRequest{Plc: "oven", Tags: []*finspb.Tag{temp}})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		bad := &finspb.Tag{Name: "bad", MemoryArea: uint32(mapping.MemoryAreaDMWord), DataType: "STRING"}
+		_, err = client.Read(ctx, &finspb.ReadRequest{Plc: "kiln", Tags: []*finspb.Tag{bad}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		st, err := client.Status(ctx, &finspb.StatusRequest{Plc: "kiln"})
+		require.NoError(t, err)
+		assert.Equal(t, uint32(mapping.ModeRun), st.Mode)
+		assert.Equal(t, mapping.ModeRun.String(), st.ModeName)
+	})
+
+	t.Run("Subscribe", func(t *testing.T) {
+		require.NoError(t, s.WriteDM(602, []uint16{1}))
+		subCtx, subCancel := context.WithCancel(ctx)
+		defer subCancel()
+		stream, err := client.Subscribe(subCtx, &finspb.SubscribeRequest{Plc: "kiln", Tags: []*finspb.Tag{temp, count}, IntervalMs: 20})
+		require.NoError(t, err)
+
+		update, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Len(t, update.Values, 2, "the first update holds all tags")
+
+		require.NoError(t, s.WriteDM(602, []uint16{2}))
+		update, err = stream.Recv()
+		require.NoError(t, err)
+		require.Len(t, update.Values, 1, "only changed tags are sent")
+		assert.Equal(t, "count", update.Values[0].Tag.Name)
+		assert.Equal(t, float64(2), update.Values[0].Value)
+	})
+
+	t.Run("Subscribe With Deadband", func(t *testing.T) {
+		level := &finspb.Tag{Name: "level", MemoryArea: uint32(mapping.MemoryAreaDMWord), Address: 610, DataType: string(fins.DataTypeUint),
+			Deadband: &finspb.Deadband{Type: string(fins.DeadbandAbsolute), Value: 5}}
+		require.NoError(t, s.WriteDM(610, []uint16{100}))
+		require.NoError(t, s.WriteDM(602, []uint16{10}))
+		subCtx, subCancel := context.WithCancel(ctx)
+		defer subCancel()
+		stream, err := client.Subscribe(subCtx, &finspb.SubscribeRequest{Plc: "kiln", Tags: []*finspb.Tag{level, count}, IntervalMs: 20})
+		require.NoError(t, err)
+		update, err := stream.Recv()
+		require.NoError(t, err)
+		require.Len(t, update.Values, 2)
+		assert.Equal(t, string(fins.DeadbandAbsolute), update.Values[0].Tag.Deadband.GetType())
+
+		// The change of level within the deadband is held back, count shows the read happened
+		require.NoError(t, s.WriteDM(610, []uint16{103}))
+		require.NoError(t, s.WriteDM(602, []uint16{11}))
+		update, err = stream.Recv()
+		require.NoError(t, err)
+		require.Len(t, update.Values, 1)
+		assert.Equal(t, "count", update.Values[0].Tag.Name)
+
+		require.NoError(t, s.WriteDM(610, []uint16{106}))
+		update, err = stream.Recv()
+		require.NoError(t, err)
+		require.Len(t, update.Values, 1, "the deviation from the last sent value counts")
+		assert.Equal(t, "level", update.Values[0].Tag.Name)
+		assert.Equal(t, float64(106), update.Values[0].Value)
+
+		bad := &finspb.Tag{Name: "bad", MemoryArea: uint32(mapping.MemoryAreaDMWord), Address: 610, DataType: string(fins.DataTypeUint),
+			Deadband: &finspb.Deadband{Type: "sometimes"}}
+		_, err = client.Read(ctx, &finspb.ReadRequest{Plc: "kiln", Tags: []*finspb.Tag{bad}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
@@ -0,0 +1,342 @@
+package fins
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"folke99/gofins/fins"
+	"folke99/gofins/historian"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySink keeps the samples written to it, or fails while down is set
+type memorySink struct {
+	sync.Mutex
+	samples []historian.Sample
+	closed  bool
+	down    bool
+}
+
+func (s *memorySink) WriteBatch(samples []historian.Sample) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.down {
+		return fmt.Errorf("database unavailable")
+	}
+	s.samples = append(s.samples, samples...)
+	return nil
+}
+
+func (s *memorySink) setDown(down bool) {
+	s.Lock()
+	s.down = down
+	s.Unlock()
+}
+
+func (s *memorySink) count() int {
+	s.Lock()
+	defer s.Unlock()
+	return len(s.samples)
+}
+
+func (s *memorySink) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestHistorianAggregation(t *testing.T) {
+	raw, aggregated := &memorySink{}, &memorySink{}
+	sink, err := historian.NewAggregatingSink(aggregated, historian.AggregateOptions{
+		Window:     time.Minute,
+		TagWindows: map[string]time.Duration{"level": time.Hour},
+	})
+	require.NoError(t, err)
+	l := historian.NewLogger(4, time.Hour, raw, sink)
+
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	record := func(tag string, seconds int, value float64) {
+		require.NoError(t, l.Record(historian.Sample{Tag: tag, Value: value, Timestamp: start.Add(time.Duration(seconds) * time.Second)}))
+	}
+	record("temp", 0, 10)
+	record("temp", 20, 30)
+	record("level", 30, 5)
+	record("temp", 40, 20)
+	record("temp", 61, 50) // Completes the first window of temp
+	record("temp", 10, 99) // Late
+	require.NoError(t, l.Close())
+
+	assert.Len(t, raw.samples, 6, "the raw sink keeps every sample")
+	assert.True(t, aggregated.closed)
+	assert.Equal(t, 1, sink.Dropped())
+
+	values := make(map[string]float64)
+	for _, s := range aggregated.samples {
+		if s.Timestamp.Equal(start) {
+			values[s.Tag] = s.Value
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"temp.min": 10, "temp.max": 30, "temp.avg": 20, "temp.last": 20,
+		"level.min": 5, "level.max": 5, "level.avg": 5, "level.last": 5,
+	}, values)
+	assert.Len(t, aggregated.samples, 12, "the open windows are written on close")
+	assert.Contains(t, aggregated.samples, historian.Sample{Tag: "temp.last", Value: 50, Timestamp: start.Add(time.Minute)})
+
+	_, err = historian.NewAggregatingSink(aggregated, historian.AggregateOptions{Window: time.Minute, Aggregates: []historian.Aggregate{"median"}})
+	assert.Error(t, err)
+	_, err = historian.NewAggregatingSink(aggregated, historian.AggregateOptions{})
+	assert.Error(t, err)
+}
+
+func TestHistorianRetrySink(t *testing.T) {
+	at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	batch := func(first int) []historian.Sample {
+		return []historian.Sample{{Tag: "temp", Value: float64(first), Timestamp: at}, {Tag: "temp", Value: float64(first + 1), Timestamp: at}}
+	}
+
+	t.Run("Influx Outage", func(t *testing.T) {
+		// The database is down for the first three requests
+		var requests atomic.Int32
+		var mu sync.Mutex
+		var lines []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requests.Add(1) <= 3 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			assert.Equal(t, "/api/v2/write", r.URL.Path)
+			assert.Equal(t, "plant", r.URL.Query().Get("bucket"))
+			assert.Equal(t, "Token secret", r.Header.Get("Authorization"))
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			lines = append(lines, strings.Fields(strings.TrimSpace(string(body)))...)
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		influx, err := historian.NewInfluxSink(historian.InfluxOptions{URL: server.URL, Org: "acme", Bucket: "plant", Token: "secret", Measurement: "kiln"})
+		require.NoError(t, err)
+		sink, err := historian.NewRetrySink(influx, historian.RetryOptions{Dir: t.TempDir(), Backoff: fins.ConstantBackoff{Interval: 10 * time.Millisecond}})
+		require.NoError(t, err)
+		defer sink.Close()
+
+		for i := range 3 {
+			require.NoError(t, sink.WriteBatch(batch(10*i)), "the batches are spooled")
+		}
+		require.Eventually(t, func() bool { return sink.Stats().SpooledBatches == 0 }, 5*time.Second, 10*time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		var values []string
+		for _, l := range lines {
+			if strings.HasPrefix(l, "value=") {
+				values = append(values, l)
+			}
+		}
+		assert.Equal(t, []string{"value=0", "value=1", "value=10", "value=11", "value=20", "value=21"}, values, "the batches arrive in order")
+		assert.Positive(t, sink.Stats().Retries)
+	})
+
+	t.Run("Spool Survives Restart", func(t *testing.T) {
+		dir := t.TempDir()
+		db := &memorySink{down: true}
+		sink, err := historian.NewRetrySink(db, historian.RetryOptions{Dir: dir, Backoff: fins.ConstantBackoff{Interval: time.Hour}})
+		require.NoError(t, err)
+		require.NoError(t, sink.WriteBatch(batch(0)))
+		require.NoError(t, sink.WriteBatch(batch(2)))
+		assert.Equal(t, 2, sink.Stats().SpooledBatches)
+		require.NoError(t, sink.Close())
+
+		db.setDown(false)
+		sink, err = historian.NewRetrySink(db, historian.RetryOptions{Dir: dir})
+		require.NoError(t, err)
+		defer sink.Close()
+		require.NoError(t, sink.WriteBatch(batch(4)), "new batches queue behind the spooled ones")
+		require.Eventually(t, func() bool { return db.count() == 6 }, 5*time.Second, 10*time.Millisecond)
+		db.Lock()
+		for i, s := range db.samples {
+			assert.Equal(t, float64(i), s.Value)
+		}
+		db.Unlock()
+	})
+
+	t.Run("Spool Limit", func(t *testing.T) {
+		db := &memorySink{down: true}
+		sink, err := historian.NewRetrySink(db, historian.RetryOptions{Dir: t.TempDir(), MaxBytes: 1, Backoff: fins.ConstantBackoff{Interval: time.Hour}})
+		require.NoError(t, err)
+		defer sink.Close()
+		for i := range 3 {
+			require.NoError(t, sink.WriteBatch(batch(2*i)))
+		}
+		stats := sink.Stats()
+		assert.Equal(t, 1, stats.SpooledBatches, "the newest batch is kept")
+		assert.Equal(t, int64(4), stats.Dropped)
+	})
+
+	t.Run("Spool Limit While Sending", func(t *testing.T) {
+		// The database fails once, then hangs on the retry of the spooled batch
+		db := &stallingSink{release: make(chan struct{}), sending: make(chan struct{})}
+		sink, err := historian.NewRetrySink(db, historian.RetryOptions{Dir: t.TempDir(), MaxBytes: 1, Backoff: fins.ConstantBackoff{Interval: time.Millisecond}})
+		require.NoError(t, err)
+		defer sink.Close()
+		require.NoError(t, sink.WriteBatch(batch(0)))
+		<-db.sending
+
+		assert.ErrorContains(t, sink.WriteBatch(batch(2)), "dropped 2 samples", "only the batch being sent fits")
+		assert.Equal(t, int64(2), sink.Stats().Dropped)
+		close(db.release)
+		require.Eventually(t, func() bool { return sink.Stats().SpooledBatches == 0 }, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, 2, db.count(), "the batch being sent is written")
+	})
+
+	t.Run("Rejected Data", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unable to parse", http.StatusBadRequest)
+		}))
+		defer server.Close()
+		influx, err := historian.NewInfluxSink(historian.InfluxOptions{URL: server.URL, Bucket: "plant", Measurement: "kiln"})
+		require.NoError(t, err)
+		sink, err := historian.NewRetrySink(influx, historian.RetryOptions{Dir: t.TempDir()})
+		require.NoError(t, err)
+		defer sink.Close()
+
+		var permanent historian.PermanentError
+		require.ErrorAs(t, sink.WriteBatch(batch(0)), &permanent)
+		assert.Equal(t, historian.RetryStats{Dropped: 2}, sink.Stats(), "rejected data isn't retried")
+	})
+}
+
+// stallingSink fails the first write and blocks the next ones until released
+type stallingSink struct {
+	memorySink
+	failed  bool
+	sending chan struct{} // Closed when the first retry starts
+	release chan struct{}
+}
+
+func (s *stallingSink) WriteBatch(samples []historian.Sample) error {
+	if !s.failed {
+		s.failed = true
+		return fmt.Errorf("database unavailable")
+	}
+	select {
+	case <-s.sending:
+	default:
+		close(s.sending)
+	}
+	<-s.release
+	return s.memorySink.WriteBatch(samples)
+}
+
+// serialSink fails the test when batches are written concurrently
+type serialSink struct {
+	memorySink
+	writing atomic.Bool
+	overlap atomic.Bool
+}
+
+func (s *serialSink) WriteBatch(samples []historian.Sample) error {
+	if !s.writing.CompareAndSwap(false, true) {
+		s.overlap.Store(true)
+	}
+	defer s.writing.Store(false)
+	time.Sleep(time.Millisecond)
+	return s.memorySink.WriteBatch(samples)
+}
+
+func TestHistorianLoggerFlush(t *testing.T) {
+	// Full batches and the flush interval race to flush
+	sink := &serialSink{}
+	l := historian.NewLogger(1, time.Millisecond, sink)
+	var wg sync.WaitGroup
+	for g := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 25 {
+				assert.NoError(t, l.Record(historian.Sample{Tag: fmt.Sprintf("tag%d", g), Value: float64(i)}))
+				go l.Flush()
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, l.Close())
+	assert.False(t, sink.overlap.Load(), "WriteBatch ran concurrently")
+	assert.Equal(t, 100, sink.count())
+}
+
+// recordingDB is a database/sql connector recording the statements executed
+type recordingDB struct {
+	sync.Mutex
+	statements []string
+	args       [][]driver.Value
+}
+
+func (d *recordingDB) Connect(context.Context) (driver.Conn, error) { return recordingConn{d}, nil }
+func (d *recordingDB) Driver() driver.Driver                        { return nil }
+
+type recordingConn struct{ db *recordingDB }
+
+func (c recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepared statements not supported")
+}
+func (c recordingConn) Close() error              { return nil }
+func (c recordingConn) Begin() (driver.Tx, error) { return c, nil }
+func (c recordingConn) Commit() error             { return nil }
+func (c recordingConn) Rollback() error           { return nil }
+
+func (c recordingConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.Lock()
+	defer c.db.Unlock()
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	c.db.statements = append(c.db.statements, query)
+	c.db.args = append(c.db.args, values)
+	return driver.RowsAffected(len(args) / 3), nil
+}
+
+func TestHistorianSQLiteSink(t *testing.T) {
+	rec := &recordingDB{}
+	db := sql.OpenDB(rec)
+	defer db.Close()
+
+	_, err := historian.NewSQLiteSink(db, "main.samples")
+	assert.Error(t, err, "SQLite tables aren't qualified")
+	sink, err := historian.NewSQLiteSink(db, "samples")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"CREATE TABLE IF NOT EXISTS samples (time TEXT NOT NULL, tag TEXT NOT NULL, value REAL)",
+		"CREATE INDEX IF NOT EXISTS samples_tag_time ON samples (tag, time)",
+	}, rec.statements)
+
+	at := time.Date(2026, 10, 18, 14, 0, 0, 500, time.FixedZone("CEST", 2*3600))
+	samples := make([]historian.Sample, 400)
+	for i := range samples {
+		samples[i] = historian.Sample{Tag: "temp", Value: float64(i), Timestamp: at}
+	}
+	require.NoError(t, sink.WriteBatch(samples))
+
+	require.Len(t, rec.statements, 4, "400 rows take two inserts")
+	assert.True(t, strings.HasPrefix(rec.statements[2], "INSERT INTO samples (time, tag, value) VALUES (?, ?, ?), (?, ?, ?)"))
+	assert.Equal(t, historian.SQLITE_ROWS_PER_INSERT, strings.Count(rec.statements[2], "(?, ?, ?)"))
+	assert.Equal(t, 400-historian.SQLITE_ROWS_PER_INSERT, strings.Count(rec.statements[3], "(?, ?, ?)"))
+	assert.Equal(t, []driver.Value{"2026-10-18 12:00:00.000000500", "temp", 0.0}, rec.args[2][:3], "times are stored as UTC text")
+	assert.Equal(t, 399.0, rec.args[3][len(rec.args[3])-1])
+}
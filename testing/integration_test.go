@@ -0,0 +1,192 @@
+//go:build integration
+
+// Integration tests against a real PLC, run them with
+//
+//	FINS_ADDRESS=192.168.250.1 FINS_TEST_SCRATCH=D1000,H100 go test -tags integration -run Integration -v ./testing
+//
+// The connection is configured with the FINS_* variables of the config package. Writes only
+// go to the scratch words listed in FINS_TEST_SCRATCH: each of them and the word after it are
+// overwritten and restored afterwards, the write tests are skipped without scratch words.
+// FINS_TEST_MANUAL=1 enables the steps that need an operator, such as pulling the cable,
+// follow the prompts in the test log.
+package fins
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"folke99/gofins/config"
+	"folke99/gofins/fins"
+	"folke99/gofins/mapping"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const MANUAL_STEP_TIMEOUT = 2 * time.Minute
+
+// connectIntegration connects to the PLC configured in the environment
+func connectIntegration(t *testing.T) *fins.Client {
+	cfg := config.Default()
+	require.NoError(t, cfg.LoadEnv(config.ENV_PREFIX))
+	if cfg.Address == "" {
+		t.Skip("FINS_ADDRESS is not set")
+	}
+	c, err := cfg.Connect()
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// scratchWords returns the word addresses the tests may overwrite
+func scratchWords(t *testing.T) []string {
+	var words []string
+	for _, s := range strings.Split(os.Getenv("FINS_TEST_SCRATCH"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			words = append(words, s)
+		}
+	}
+	if len(words) == 0 {
+		t.Skip("FINS_TEST_SCRATCH is not set")
+	}
+	return words
+}
+
+// waitFor polls cond until it holds or the manual step times out
+func waitFor(t *testing.T, step string, cond func() bool) {
+	t.Logf(">>> %s (waiting up to %v)", step, MANUAL_STEP_TIMEOUT)
+	deadline := time.Now().Add(MANUAL_STEP_TIMEOUT)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for: %s", step)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func TestIntegrationReads(t *testing.T) {
+	c := connectIntegration(t)
+
+	for _, area := range []mapping.MemoryArea{
+		mapping.MemoryAreaDMWord,
+		mapping.MemoryAreaCIOWord,
+		mapping.MemoryAreaWRWord,
+		mapping.MemoryAreaHRWord,
+		mapping.MemoryAreaARWord,
+	} {
+		t.Run(area.String(), func(t *testing.T) {
+			words, err := c.ReadWords(area, 0, 10)
+			require.NoError(t, err)
+			assert.Len(t, words, 10)
+		})
+	}
+
+	t.Run("Bits", func(t *testing.T) {
+		bits, err := c.ReadBits(mapping.MemoryAreaCIOBit, 0, 0, 16)
+		require.NoError(t, err)
+		assert.Len(t, bits, 16)
+	})
+
+	t.Run("Largest Read", func(t *testing.T) {
+		limit := c.TransferLimit(mapping.MemoryAreaDMWord)
+		words, err := c.ReadWords(mapping.MemoryAreaDMWord, 0, limit.Read)
+		require.NoError(t, err)
+		assert.Len(t, words, int(limit.Read))
+	})
+}
+
+func TestIntegrationWrites(t *testing.T) {
+	c := connectIntegration(t)
+
+	for _, address := range scratchWords(t) {
+		t.Run(address, func(t *testing.T) {
+			area, word, bit, err := mapping.ParseAddress(address)
+			require.NoError(t, err)
+			require.Equal(t, -1, bit, "scratch addresses are words")
+
+			saved, err := c.ReadWords(area, word, 2)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				assert.NoError(t, c.WriteWords(area, word, saved), "restoring %s", address)
+			})
+
+			require.NoError(t, c.WriteWords(area, word, []uint16{0x1234, 0xABCD}))
+			words, err := c.ReadWords(area, word, 2)
+			require.NoError(t, err)
+			assert.Equal(t, []uint16{0x1234, 0xABCD}, words)
+
+			bitArea, ok := area.BitArea()
+			require.True(t, ok)
+			require.NoError(t, c.SetBit(bitArea, word, 15))
+			require.NoError(t, c.ResetBit(bitArea, word, 2))
+			words, err = c.ReadWords(area, word, 1)
+			require.NoError(t, err)
+			assert.Equal(t, uint16(0x1234|0x8000)&^0x0004, words[0])
+
+			tag := fins.Tag{Name: "scratch", MemoryArea: area, Address: word, DataType: fins.DataTypeReal}
+			require.NoError(t, c.WriteTag(tag, -12.5))
+			value, err := c.ReadTag(tag)
+			require.NoError(t, err)
+			assert.Equal(t, -12.5, value)
+		})
+	}
+}
+
+func TestIntegrationStatus(t *testing.T) {
+	c := connectIntegration(t)
+
+	status, err := c.Status()
+	require.NoError(t, err)
+	t.Logf("Status: %+v", status)
+
+	model, err := c.ReadCPUUnitModel()
+	require.NoError(t, err)
+	assert.NotEmpty(t, model)
+	if p, ok := mapping.ProfileForModel(model); ok {
+		t.Logf("CPU unit %s uses profile %s", model, p.Name)
+	} else {
+		t.Logf("CPU unit %s has no profile", model)
+	}
+	rtt, err := c.Ping()
+	require.NoError(t, err)
+	t.Logf("Round-trip time %v", rtt)
+	_, err = c.PingWith(fins.ProbeStatusRead)
+	assert.NoError(t, err)
+}
+
+func TestIntegrationClock(t *testing.T) {
+	c := connectIntegration(t)
+
+	clock, err := c.ReadClock()
+	require.NoError(t, err)
+	t.Logf("PLC clock %v, drift %v", clock, clock.Sub(time.Now()).Round(time.Second))
+	assert.Greater(t, clock.Year(), 2000)
+}
+
+func TestIntegrationReconnect(t *testing.T) {
+	if os.Getenv("FINS_TEST_MANUAL") != "1" {
+		t.Skip("FINS_TEST_MANUAL is not set")
+	}
+	// The connection stays half-open while the cable is out
+	if os.Getenv("FINS_HALF_OPEN_TIMEOUT") == "" {
+		t.Setenv("FINS_HALF_OPEN_TIMEOUT", "5s")
+	}
+	c := connectIntegration(t)
+	_, err := c.Ping()
+	require.NoError(t, err)
+
+	waitFor(t, "Pull the Ethernet cable of the PLC", func() bool {
+		_, err := c.WithTimeout(time.Second).ReadWords(mapping.MemoryAreaDMWord, 0, 1)
+		return err != nil
+	})
+	waitFor(t, "Plug the Ethernet cable back in", func() bool {
+		_, err := c.Ping()
+		return err == nil
+	})
+
+	words, err := c.ReadWords(mapping.MemoryAreaDMWord, 0, 10)
+	require.NoError(t, err)
+	assert.Len(t, words, 10)
+}
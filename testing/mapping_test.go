@@ -0,0 +1,130 @@
+package fins
+
+import (
+	"testing"
+
+	"folke99/gofins/mapping"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryArea(t *testing.T) {
+	assert.True(t, mapping.MemoryAreaDMWord.IsWord())
+	assert.False(t, mapping.MemoryAreaDMWord.IsBit())
+	assert.True(t, mapping.MemoryAreaHRBit.IsBit())
+	assert.Equal(t, uint16(32767), mapping.MemoryAreaDMWord.MaxAddress())
+	assert.Equal(t, "DM word", mapping.MemoryAreaDMWord.String())
+
+	unknown := mapping.MemoryArea(0xFF)
+	assert.False(t, unknown.Known())
+	assert.False(t, unknown.IsWord())
+	assert.False(t, unknown.IsBit())
+	assert.Equal(t, "unknown memory area 0xFF", unknown.String())
+}
+
+func TestCodeNames(t *testing.T) {
+	assert.Equal(t, "MEMORY AREA READ", mapping.CommandCode(mapping.CommandCodeMemoryAreaRead).String())
+	assert.Equal(t, "unknown command 0xFFFF", mapping.CommandCode(0xFFFF).String())
+	assert.True(t, mapping.CommandCode(mapping.CommandCodeMemoryAreaWrite).IsRetryable())
+	assert.False(t, mapping.CommandCode(mapping.CommandCodeErrorClear).IsRetryable())
+	assert.False(t, mapping.CommandCode(0xFFFF).IsRetryable())
+
+	assert.Equal(t, "service unsupported; undefined command", mapping.EndCode(mapping.EndCodeUndefinedCommand).String())
+	assert.Equal(t, "unknown end code 0x7777", mapping.EndCode(0x7777).String())
+	assert.True(t, mapping.EndCode(mapping.EndCodeDestinationNodeBusy).IsRetryable())
+	assert.True(t, mapping.EndCode(mapping.EndCodeAccessWriteErrorNoAccessRight).IsRetryable())
+	assert.False(t, mapping.EndCode(mapping.EndCodeAddressRangeError).IsRetryable())
+
+	// A relay error at a busy node with the non-fatal CPU error flag set
+	flagged := mapping.EndCode(mapping.EndCodeDestinationNodeBusy) | mapping.EndCodeFlagRelayError | mapping.EndCodeFlagNonFatalCPUError
+	assert.Equal(t, mapping.EndCode(mapping.EndCodeDestinationNodeBusy), flagged.Code())
+	assert.Equal(t, "destination node error; destination node busy", flagged.String())
+	assert.True(t, flagged.IsRetryable())
+}
+
+func TestProfileForModel(t *testing.T) {
+	p, ok := mapping.ProfileForModel("CJ2M-CPU33")
+	assert.True(t, ok)
+	assert.Equal(t, "CJ2", p.Name)
+
+	p, ok = mapping.ProfileForModel("NX102-9000")
+	assert.True(t, ok)
+	assert.False(t, p.Supports(mapping.CommandCodeParameterAreaRead))
+	assert.True(t, p.Supports(mapping.CommandCodeMemoryAreaRead))
+
+	assert.Equal(t, uint16(511), mapping.ProfileCJ1.AreaMaxAddress(mapping.MemoryAreaHRWord))
+	assert.Equal(t, uint16(32767), mapping.ProfileCJ1.AreaMaxAddress(mapping.MemoryAreaDMWord))
+
+	_, ok = mapping.ProfileForModel("unknown")
+	assert.False(t, ok)
+}
+
+func TestParseAddress(t *testing.T) {
+	testCases := []struct {
+		s       string
+		area    mapping.MemoryArea
+		address uint16
+		bit     int
+	}{
+		{"D100", mapping.MemoryAreaDMWord, 100, -1},
+		{"dm32767", mapping.MemoryAreaDMWord, 32767, -1},
+		{"H10.03", mapping.MemoryAreaHRWord, 10, 3},
+		{"W5", mapping.MemoryAreaWRWord, 5, -1},
+		{"A960", mapping.MemoryAreaARWord, 960, -1},
+		{"CIO0.15", mapping.MemoryAreaCIOWord, 0, 15},
+		{"1200", mapping.MemoryAreaCIOWord, 1200, -1},
+		{"E0_100", 0xa0, 100, -1},
+		{"e2_00100.05", 0xa2, 100, 5},
+		{"E18_32767", 0x68, 32767, -1},
+		{"E300", mapping.MemoryAreaEMCurrentWord, 300, -1},
+	}
+	for _, tc := range testCases {
+		area, address, bit, err := mapping.ParseAddress(tc.s)
+		require.NoError(t, err, tc.s)
+		assert.Equal(t, tc.area, area, tc.s)
+		assert.Equal(t, tc.address, address, tc.s)
+		assert.Equal(t, tc.bit, bit, tc.s)
+	}
+
+	for _, s := range []string{"", "D", "X100", "D100.16", "D70000", "E19_0", "EX_0", "DE5"} {
+		_, _, _, err := mapping.ParseAddress(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestEMBanks(t *testing.T) {
+	for bank := byte(0); bank < mapping.EM_BANKS; bank++ {
+		word, ok := mapping.EMBankWord(bank)
+		require.True(t, ok)
+		bit, ok := mapping.EMBankBit(bank)
+		require.True(t, ok)
+		assert.True(t, word.IsWord(), word)
+		assert.True(t, bit.IsBit(), bit)
+		assert.Equal(t, uint16(32767), word.MaxAddress())
+
+		got, ok := word.EMBank()
+		assert.True(t, ok)
+		assert.Equal(t, bank, got)
+		got, ok = bit.EMBank()
+		assert.True(t, ok)
+		assert.Equal(t, bank, got)
+		wordBit, ok := word.BitArea()
+		assert.True(t, ok)
+		assert.Equal(t, bit, wordBit)
+
+		prefix, ok := word.AddressPrefix()
+		require.True(t, ok)
+		area, _, _, err := mapping.ParseAddress(prefix + "100")
+		require.NoError(t, err)
+		assert.Equal(t, word, area, "the prefix parses back to the bank")
+	}
+	assert.Equal(t, "EMC word", mapping.MemoryArea(0xac).String())
+
+	_, ok := mapping.EMBankWord(mapping.EM_BANKS)
+	assert.False(t, ok)
+	_, ok = mapping.MemoryAreaDMWord.EMBank()
+	assert.False(t, ok)
+	_, ok = mapping.MemoryAreaEMCurrentWord.EMBank()
+	assert.False(t, ok, "the current bank has no fixed bank number")
+}
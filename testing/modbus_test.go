@@ -0,0 +1,177 @@
+package fins
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"folke99/gofins/fins"
+	"folke99/gofins/mapping"
+	"folke99/gofins/modbus"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// modbusRequest sends a PDU to the server and returns the response PDU
+func modbusRequest(t *testing.T, conn net.Conn, transactionID uint16, pdu ...byte) []byte {
+	frame := binary.BigEndian.AppendUint16(nil, transactionID)
+	frame = binary.BigEndian.AppendUint16(frame, 0)
+	frame = binary.BigEndian.AppendUint16(frame, uint16(len(pdu)+1))
+	frame = append(frame, 1)
+	frame = append(frame, pdu...)
+	_, err := conn.Write(frame)
+	require.NoError(t, err)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	header := make([]byte, modbus.MBAP_HEADER_LENGTH)
+	_, err = io.ReadFull(conn, header)
+	require.NoError(t, err)
+	assert.Equal(t, transactionID, binary.BigEndian.Uint16(header[0:2]), "the transaction ID is echoed")
+	assert.Equal(t, byte(1), header[6], "the unit ID is echoed")
+	resp := make([]byte, binary.BigEndian.Uint16(header[4:6])-1)
+	_, err = io.ReadFull(conn, resp)
+	require.NoError(t, err)
+	return resp
+}
+
+// failingBackend fails every FINS command with err
+type failingBackend struct {
+	err error
+}
+
+func (b failingBackend) ReadWords(mapping.MemoryArea, uint16, uint16) ([]uint16, error) {
+	return nil, b.err
+}
+
+func (b failingBackend) WriteWords(mapping.MemoryArea, uint16, []uint16) error {
+	return b.err
+}
+
+func (b failingBackend) ReadBits(mapping.MemoryArea, uint16, byte, uint16) ([]bool, error) {
+	return nil, b.err
+}
+
+func (b failingBackend) WriteBits(mapping.MemoryArea, uint16, byte, []bool) error {
+	return b.err
+}
+
+func TestModbusBridge(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	m := modbus.Mapping{
+		HoldingRegisterArea:  mapping.MemoryAreaDMWord,
+		HoldingRegisterStart: 1000,
+		CoilArea:             mapping.MemoryAreaDMBit,
+		CoilStart:            2000,
+	}
+	server, err := modbus.NewServer("127.0.0.1:0", c, m)
+	require.NoError(t, err)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	t.Run("Holding Registers", func(t *testing.T) {
+		resp := modbusRequest(t, conn, 1, modbus.FunctionWriteSingleRegister, 0, 5, 0x12, 0x34)
+		assert.Equal(t, []byte{modbus.FunctionWriteSingleRegister, 0, 5, 0x12, 0x34}, resp)
+		resp = modbusRequest(t, conn, 2, modbus.FunctionWriteMultipleRegisters, 0, 6, 0, 2, 4, 0, 7, 0, 8)
+		assert.Equal(t, []byte{modbus.FunctionWriteMultipleRegisters, 0, 6, 0, 2}, resp)
+
+		words, err := s.ReadDM(1005, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{0x1234, 7, 8}, words)
+
+		resp = modbusRequest(t, conn, 3, modbus.FunctionReadHoldingRegisters, 0, 5, 0, 3)
+		assert.Equal(t, []byte{modbus.FunctionReadHoldingRegisters, 6, 0x12, 0x34, 0, 7, 0, 8}, resp)
+	})
+
+	t.Run("Coils", func(t *testing.T) {
+		// Coil 17 is bit 1 of D2001
+		resp := modbusRequest(t, conn, 4, modbus.FunctionWriteSingleCoil, 0, 17, 0xFF, 0x00)
+		assert.Equal(t, []byte{modbus.FunctionWriteSingleCoil, 0, 17, 0xFF, 0x00}, resp)
+		resp = modbusRequest(t, conn, 5, modbus.FunctionWriteMultipleCoils, 0, 20, 0, 3, 1, 0b101)
+		assert.Equal(t, []byte{modbus.FunctionWriteMultipleCoils, 0, 20, 0, 3}, resp)
+
+		words, err := s.ReadDM(2001, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{0b1010010}, words)
+
+		resp = modbusRequest(t, conn, 6, modbus.FunctionReadCoils, 0, 16, 0, 9)
+		assert.Equal(t, []byte{modbus.FunctionReadCoils, 2, 0b01010010, 0}, resp)
+	})
+
+	t.Run("Exceptions", func(t *testing.T) {
+		resp := modbusRequest(t, conn, 7, 0x2B, 0x0E)
+		assert.Equal(t, []byte{0x2B | 0x80, modbus.ExceptionIllegalFunction}, resp)
+		resp = modbusRequest(t, conn, 8, modbus.FunctionReadHoldingRegisters, 0, 0, 0, 0)
+		assert.Equal(t, []byte{modbus.FunctionReadHoldingRegisters | 0x80, modbus.ExceptionIllegalDataValue}, resp)
+		resp = modbusRequest(t, conn, 9, modbus.FunctionWriteSingleCoil, 0, 0, 0x12, 0x34)
+		assert.Equal(t, []byte{modbus.FunctionWriteSingleCoil | 0x80, modbus.ExceptionIllegalDataValue}, resp)
+		resp = modbusRequest(t, conn, 10, modbus.FunctionWriteMultipleRegisters, 0, 0, 0, 2, 3, 0, 1, 0)
+		assert.Equal(t, []byte{modbus.FunctionWriteMultipleRegisters | 0x80, modbus.ExceptionIllegalDataValue}, resp, "the byte count must match")
+		resp = modbusRequest(t, conn, 11, modbus.FunctionReadHoldingRegisters, 0xFF, 0xFF, 0, 1)
+		assert.Equal(t, []byte{modbus.FunctionReadHoldingRegisters | 0x80, modbus.ExceptionIllegalDataAddress}, resp, "the register is beyond the FINS address space")
+	})
+
+	t.Run("FINS Errors", func(t *testing.T) {
+		// Register 31768 is D32768, beyond the highest DM address of the PLC
+		resp := modbusRequest(t, conn, 12, modbus.FunctionReadHoldingRegisters, 0x7C, 0x18, 0, 1)
+		assert.Equal(t, []byte{modbus.FunctionReadHoldingRegisters | 0x80, modbus.ExceptionIllegalDataAddress}, resp)
+		resp = modbusRequest(t, conn, 13, modbus.FunctionWriteSingleRegister, 0x7C, 0x18, 0, 1)
+		assert.Equal(t, []byte{modbus.FunctionWriteSingleRegister | 0x80, modbus.ExceptionIllegalDataAddress}, resp)
+
+		for _, tc := range []struct {
+			name      string
+			err       error
+			exception byte
+		}{
+			{"Address Range", fins.AddressRangeError{Area: mapping.MemoryAreaDMWord, Address: 1000, Count: 1, MaxAddress: 999}, modbus.ExceptionIllegalDataAddress},
+			{"Count Limit", fins.CountLimitError{Count: 100, Max: 64}, modbus.ExceptionIllegalDataValue},
+			{"Address End Code", fins.EndCodeError{CommandCode: mapping.CommandCodeMemoryAreaRead, EndCode: mapping.EndCodeAddressRangeExceeded}, modbus.ExceptionIllegalDataAddress},
+			{"Other End Code", fins.EndCodeError{CommandCode: mapping.CommandCodeMemoryAreaRead, EndCode: mapping.EndCodeNotExecutableInCurrentModeNotPossibleWhileRunning}, modbus.ExceptionServerDeviceFailure},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				failing, err := modbus.NewServer("127.0.0.1:0", failingBackend{fmt.Errorf("wrapped: %w", tc.err)}, m)
+				require.NoError(t, err)
+				defer failing.Close()
+				failingConn, err := net.Dial("tcp", failing.Addr().String())
+				require.NoError(t, err)
+				defer failingConn.Close()
+
+				resp := modbusRequest(t, failingConn, 1, modbus.FunctionReadCoils, 0, 0, 0, 1)
+				assert.Equal(t, []byte{modbus.FunctionReadCoils | 0x80, tc.exception}, resp)
+				resp = modbusRequest(t, failingConn, 2, modbus.FunctionWriteMultipleRegisters, 0, 0, 0, 1, 2, 0, 1)
+				assert.Equal(t, []byte{modbus.FunctionWriteMultipleRegisters | 0x80, tc.exception}, resp)
+			})
+		}
+	})
+
+	t.Run("Device Failure", func(t *testing.T) {
+		c.Close()
+		resp := modbusRequest(t, conn, 14, modbus.FunctionReadHoldingRegisters, 0, 0, 0, 1)
+		assert.Equal(t, []byte{modbus.FunctionReadHoldingRegisters | 0x80, modbus.ExceptionServerDeviceFailure}, resp)
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		require.NoError(t, server.Close())
+		_, err := net.DialTimeout("tcp", server.Addr().String(), time.Second)
+		assert.Error(t, err)
+
+		// Open connections are closed as well
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+		assert.NoError(t, server.Close(), "closing twice is fine")
+	})
+
+	_, err = modbus.NewServer("127.0.0.1:0", c, modbus.Mapping{HoldingRegisterArea: mapping.MemoryAreaDMBit, CoilArea: mapping.MemoryAreaDMBit})
+	assert.Error(t, err, "holding registers need a word area")
+	_, err = modbus.NewServer("127.0.0.1:0", c, modbus.Mapping{HoldingRegisterArea: mapping.MemoryAreaDMWord, CoilArea: mapping.MemoryAreaDMWord})
+	assert.Error(t, err, "coils need a bit area")
+}
@@ -0,0 +1,163 @@
+package fins
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"folke99/gofins/fins"
+	"folke99/gofins/mapping"
+	"folke99/gofins/opcua"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nodeRecorder struct {
+	nodes []opcua.Node
+}
+
+func (r *nodeRecorder) AddNode(n opcua.Node) error {
+	r.nodes = append(r.nodes, n)
+	return nil
+}
+
+func TestOPCUAAddressSpace(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	m := fins.NewManager(1)
+	m.Add("kiln", c)
+	setpoint := fins.Tag{Name: "setpoint", MemoryArea: mapping.MemoryAreaDMWord, Address: 800, DataType: fins.DataTypeInt}
+	temp := fins.Tag{Name: "temp", MemoryArea: mapping.MemoryAreaDMWord, Address: 802, DataType: fins.DataTypeReal}
+	running := fins.Tag{Name: "running", MemoryArea: mapping.MemoryAreaDMBit, Address: 804, BitOffset: 3, DataType: fins.DataTypeBool}
+
+	var denied []string
+	space, err := opcua.NewAddressSpace(m, opcua.Options{
+		Tags: map[string][]fins.Tag{"kiln": {setpoint, temp, running}},
+		Authorize: func(session any, plc string, tag fins.Tag, value float64) error {
+			if session == "guest" {
+				denied = append(denied, plc+"."+tag.Name)
+				return fmt.Errorf("guests may not write")
+			}
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	node := func(id string) opcua.NodeID {
+		return opcua.NodeID{Namespace: opcua.DEFAULT_NAMESPACE, ID: id}
+	}
+
+	t.Run("Nodes", func(t *testing.T) {
+		var r nodeRecorder
+		require.NoError(t, space.Register(&r))
+		require.Len(t, r.nodes, 4)
+
+		folder := r.nodes[0]
+		assert.Equal(t, "ns=2;s=kiln", folder.ID.String())
+		assert.True(t, folder.Folder)
+		assert.Nil(t, folder.Parent)
+
+		types := []opcua.BuiltinType{opcua.TypeInt16, opcua.TypeFloat, opcua.TypeBoolean}
+		for i, name := range []string{"setpoint", "temp", "running"} {
+			n := r.nodes[i+1]
+			assert.Equal(t, node("kiln."+name), n.ID)
+			assert.Equal(t, name, n.BrowseName)
+			assert.Equal(t, &folder.ID, n.Parent)
+			assert.Equal(t, types[i], n.DataType)
+			assert.True(t, n.Writable)
+		}
+	})
+
+	t.Run("Node IDs", func(t *testing.T) {
+		id, err := opcua.ParseNodeID("ns=2;s=kiln.temp")
+		require.NoError(t, err)
+		assert.Equal(t, node("kiln.temp"), id)
+
+		for _, invalid := range []string{"kiln.temp", "ns=x;s=kiln", "ns=70000;s=kiln", "ns=2;i=5"} {
+			_, err := opcua.ParseNodeID(invalid)
+			assert.Error(t, err, invalid)
+		}
+	})
+
+	t.Run("Read", func(t *testing.T) {
+		require.NoError(t, c.WriteTag(setpoint, -40))
+		require.NoError(t, c.WriteTag(temp, 812.5))
+		require.NoError(t, c.WriteTag(running, 1))
+
+		values := space.Read(context.Background(), []opcua.NodeID{
+			node("kiln.temp"), node("kiln.missing"), node("kiln.setpoint"), node("kiln.running"),
+			{Namespace: 3, ID: "kiln.temp"},
+		})
+		require.Len(t, values, 5)
+		assert.Equal(t, opcua.StatusGood, values[0].Status)
+		assert.Equal(t, float32(812.5), values[0].Value)
+		assert.False(t, values[0].SourceTimestamp.IsZero())
+		assert.Equal(t, opcua.StatusBadNodeIDUnknown, values[1].Status)
+		assert.Equal(t, int16(-40), values[2].Value)
+		assert.Equal(t, true, values[3].Value)
+		assert.Equal(t, opcua.StatusBadNodeIDUnknown, values[4].Status, "other namespaces are unknown")
+	})
+
+	t.Run("Write", func(t *testing.T) {
+		// The temperature may not be written by the client
+		c.SetWriteGuard(func(w fins.MemoryWrite) error {
+			if w.Address.Address == 802 {
+				return fmt.Errorf("read-only address")
+			}
+			return nil
+		})
+		defer c.SetWriteGuard(nil)
+
+		assert.Equal(t, opcua.StatusGood, space.Write(nil, node("kiln.setpoint"), int16(120)))
+		words, err := s.ReadDM(800, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{120}, words)
+
+		assert.Equal(t, opcua.StatusGood, space.Write(nil, node("kiln.running"), false))
+		value, err := c.ReadTag(running)
+		require.NoError(t, err)
+		assert.Equal(t, 0.0, value)
+
+		assert.Equal(t, opcua.StatusBadTypeMismatch, space.Write(nil, node("kiln.setpoint"), 120.0))
+		assert.Equal(t, opcua.StatusBadTypeMismatch, space.Write(nil, node("kiln.running"), int16(1)))
+		assert.Equal(t, opcua.StatusBadNodeIDUnknown, space.Write(nil, node("kiln.missing"), int16(1)))
+		assert.Equal(t, opcua.StatusBadUserAccessDenied, space.Write(nil, node("kiln.temp"), float32(20)),
+			"the write guard of the client applies")
+
+		assert.Equal(t, opcua.StatusBadUserAccessDenied, space.Write("guest", node("kiln.setpoint"), int16(1)))
+		assert.Equal(t, []string{"kiln.setpoint"}, denied)
+		words, err = s.ReadDM(800, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{120}, words, "rejected writes don't reach the PLC")
+	})
+
+	t.Run("Read-only", func(t *testing.T) {
+		readOnly, err := opcua.NewAddressSpace(m, opcua.Options{
+			Tags:      map[string][]fins.Tag{"kiln": {setpoint}},
+			Namespace: 4,
+			ReadOnly:  true,
+		})
+		require.NoError(t, err)
+		assert.False(t, readOnly.Nodes()[1].Writable)
+		id := opcua.NodeID{Namespace: 4, ID: "kiln.setpoint"}
+		assert.Equal(t, opcua.StatusBadNotWritable, readOnly.Write(nil, id, int16(1)))
+		assert.Equal(t, int16(120), readOnly.Read(context.Background(), []opcua.NodeID{id})[0].Value)
+	})
+
+	t.Run("Unavailable PLC", func(t *testing.T) {
+		unknown, err := opcua.NewAddressSpace(m, opcua.Options{Tags: map[string][]fins.Tag{"dryer": {setpoint}}})
+		require.NoError(t, err)
+		id := node("dryer.setpoint")
+		assert.Equal(t, opcua.StatusBadCommunicationError, unknown.Read(context.Background(), []opcua.NodeID{id})[0].Status)
+		assert.Equal(t, opcua.StatusBadCommunicationError, unknown.Write(nil, id, int16(1)))
+	})
+
+	t.Run("Invalid tag table", func(t *testing.T) {
+		_, err := opcua.NewAddressSpace(m, opcua.Options{Tags: map[string][]fins.Tag{"kiln": {setpoint, setpoint}}})
+		assert.ErrorContains(t, err, "duplicate node ID")
+		_, err = opcua.NewAddressSpace(m, opcua.Options{Tags: map[string][]fins.Tag{"kiln": {{Name: "x", DataType: "STRING"}}}})
+		assert.ErrorContains(t, err, "unsupported data type")
+	})
+}
@@ -0,0 +1,315 @@
+package fins
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"folke99/gofins/fins"
+	"folke99/gofins/mapping"
+	"folke99/gofins/sparkplug"
+	"folke99/gofins/sparkplug/sparkplugpb"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeMQTT is an MQTT client recording what it publishes, connected as soon as asked
+type fakeMQTT struct {
+	sync.Mutex
+	opts      *mqtt.ClientOptions
+	connected bool
+	published []fakeMessage
+	handler   mqtt.MessageHandler
+}
+
+type fakeMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m fakeMessage) Duplicate() bool   { return false }
+func (m fakeMessage) Qos() byte         { return 1 }
+func (m fakeMessage) Retained() bool    { return false }
+func (m fakeMessage) Topic() string     { return m.topic }
+func (m fakeMessage) MessageID() uint16 { return 0 }
+func (m fakeMessage) Payload() []byte   { return m.payload }
+func (m fakeMessage) Ack()              {}
+
+type fakeToken struct{}
+
+func (fakeToken) Wait() bool                     { return true }
+func (fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (fakeToken) Error() error                   { return nil }
+func (fakeToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+func (f *fakeMQTT) IsConnected() bool      { return f.IsConnectionOpen() }
+func (f *fakeMQTT) IsConnectionOpen() bool { f.Lock(); defer f.Unlock(); return f.connected }
+
+func (f *fakeMQTT) Connect() mqtt.Token {
+	f.Lock()
+	f.connected = true
+	f.Unlock()
+	f.opts.OnConnect(f)
+	return fakeToken{}
+}
+
+func (f *fakeMQTT) Disconnect(uint) {
+	f.Lock()
+	f.connected = false
+	f.Unlock()
+}
+
+func (f *fakeMQTT) Publish(topic string, _ byte, _ bool, payload interface{}) mqtt.Token {
+	f.Lock()
+	f.published = append(f.published, fakeMessage{topic, payload.([]byte)})
+	f.Unlock()
+	return fakeToken{}
+}
+
+func (f *fakeMQTT) Subscribe(string, byte, mqtt.MessageHandler) mqtt.Token {
+	return fakeToken{}
+}
+
+func (f *fakeMQTT) SubscribeMultiple(_ map[string]byte, handler mqtt.MessageHandler) mqtt.Token {
+	f.Lock()
+	f.handler = handler
+	f.Unlock()
+	return fakeToken{}
+}
+
+func (f *fakeMQTT) Unsubscribe(...string) mqtt.Token        { return fakeToken{} }
+func (f *fakeMQTT) AddRoute(string, mqtt.MessageHandler)    {}
+func (f *fakeMQTT) OptionsReader() mqtt.ClientOptionsReader { return mqtt.NewOptionsReader(f.opts) }
+
+// reconnect loses the connection and connects again the way the paho client does
+func (f *fakeMQTT) reconnect() {
+	f.opts.OnReconnecting(f, f.opts)
+	f.opts.OnConnect(f)
+}
+
+// command delivers a message to the subscription of the node
+func (f *fakeMQTT) command(topic string, p *sparkplugpb.Payload) error {
+	payload, err := proto.Marshal(p)
+	if err != nil {
+		return err
+	}
+	f.Lock()
+	handler := f.handler
+	f.Unlock()
+	handler(f, fakeMessage{topic, payload})
+	return nil
+}
+
+// take returns and forgets the messages published so far, with their payloads decoded
+func (f *fakeMQTT) take(t *testing.T) ([]string, []*sparkplugpb.Payload) {
+	f.Lock()
+	defer f.Unlock()
+	var topics []string
+	var payloads []*sparkplugpb.Payload
+	for _, m := range f.published {
+		var p sparkplugpb.Payload
+		require.NoError(t, proto.Unmarshal(m.payload, &p))
+		topics = append(topics, m.topic)
+		payloads = append(payloads, &p)
+	}
+	f.published = nil
+	return topics, payloads
+}
+
+// metricValues returns the values of the metrics by name, or by alias when unnamed
+func metricValues(p *sparkplugpb.Payload) map[string]any {
+	values := make(map[string]any)
+	for _, m := range p.Metrics {
+		name := m.GetName()
+		if m.Name == nil {
+			name = fmt.Sprintf("#%d", m.GetAlias())
+		}
+		switch v := m.Value.(type) {
+		case *sparkplugpb.Payload_Metric_BooleanValue:
+			values[name] = v.BooleanValue
+		case *sparkplugpb.Payload_Metric_IntValue:
+			values[name] = v.IntValue
+		case *sparkplugpb.Payload_Metric_LongValue:
+			values[name] = v.LongValue
+		case *sparkplugpb.Payload_Metric_FloatValue:
+			values[name] = v.FloatValue
+		default:
+			values[name] = nil
+		}
+	}
+	return values
+}
+
+func TestSparkplugEdgeNode(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	m := fins.NewManager(1)
+	m.Add("kiln", c)
+	tags := []fins.Tag{
+		{Name: "temp", MemoryArea: mapping.MemoryAreaDMWord, Address: 100, DataType: fins.DataTypeInt,
+			Deadband: &fins.Deadband{Type: fins.DeadbandAbsolute, Value: 5}},
+		{Name: "setpoint", MemoryArea: mapping.MemoryAreaDMWord, Address: 101, DataType: fins.DataTypeUint},
+		{Name: "flow", MemoryArea: mapping.MemoryAreaDMWord, Address: 102, DataType: fins.DataTypeReal},
+	}
+
+	fake := &fakeMQTT{}
+	var node *sparkplug.EdgeNode
+	var authorized []string
+	heldLock := false
+	node, err := sparkplug.NewEdgeNode(m, sparkplug.Options{
+		Broker:  "tcp://broker:1883",
+		GroupID: "plant",
+		NodeID:  "gw",
+		Tags:    map[string][]fins.Tag{"kiln": tags},
+		Authorize: func(plc string, tag fins.Tag, value float64) error {
+			if node.TryLock() {
+				node.Unlock()
+			} else {
+				heldLock = true
+			}
+			authorized = append(authorized, fmt.Sprintf("%s.%s=%v", plc, tag.Name, value))
+			if tag.Name == "flow" {
+				return fmt.Errorf("read-only tag")
+			}
+			return nil
+		},
+		NewClient: func(o *mqtt.ClientOptions) mqtt.Client {
+			fake.opts = o
+			return fake
+		},
+	})
+	require.NoError(t, err)
+
+	poll := func(at time.Time) {
+		values, _ := m.ReadAll(context.Background(), map[string][]fins.Tag{"kiln": tags})
+		require.NoError(t, node.Publish("kiln", values["kiln"], at))
+	}
+	at := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Node Birth", func(t *testing.T) {
+		assert.Equal(t, "spBv1.0/plant/NDEATH/gw", fake.opts.WillTopic)
+		var will sparkplugpb.Payload
+		require.NoError(t, proto.Unmarshal(fake.opts.WillPayload, &will))
+		assert.Equal(t, map[string]any{"bdSeq": uint64(0)}, metricValues(&will))
+
+		topics, payloads := fake.take(t)
+		require.Equal(t, []string{"spBv1.0/plant/NBIRTH/gw"}, topics)
+		assert.Equal(t, uint64(0), payloads[0].GetSeq())
+		assert.Equal(t, map[string]any{
+			"bdSeq": uint64(0), "Node Control/Rebirth": false, "PLCs/kiln/Connected": false,
+		}, metricValues(payloads[0]))
+	})
+
+	t.Run("Device Birth And Data", func(t *testing.T) {
+		require.NoError(t, s.WriteDM(100, []uint16{0xFFEC, 40, 0, 0})) // temp -20, flow 0.0
+		poll(at)
+		topics, payloads := fake.take(t)
+		require.Equal(t, []string{"spBv1.0/plant/DBIRTH/gw/kiln", "spBv1.0/plant/NDATA/gw"}, topics)
+		assert.Equal(t, []uint64{1, 2}, []uint64{payloads[0].GetSeq(), payloads[1].GetSeq()})
+		assert.Equal(t, map[string]any{
+			"Device Control/Rebirth": false, "temp": uint32(0xFFFFFFEC), "setpoint": uint32(40), "flow": float32(0),
+		}, metricValues(payloads[0]))
+		birth := payloads[0].Metrics[1]
+		assert.Equal(t, uint64(1), birth.GetAlias())
+		assert.Equal(t, uint32(sparkplugpb.DataType_Int16), birth.GetDatatype())
+		assert.Equal(t, uint64(at.UnixMilli()), birth.GetTimestamp())
+		assert.Equal(t, map[string]any{"PLCs/kiln/Connected": true}, metricValues(payloads[1]))
+
+		// temp moves within its deadband
+		require.NoError(t, s.WriteDM(100, []uint16{0xFFEA, 41}))
+		poll(at.Add(time.Second))
+		topics, payloads = fake.take(t)
+		require.Equal(t, []string{"spBv1.0/plant/DDATA/gw/kiln"}, topics)
+		assert.Equal(t, uint64(3), payloads[0].GetSeq())
+		assert.Equal(t, map[string]any{"#2": uint32(41)}, metricValues(payloads[0]), "changes are sent by alias")
+
+		poll(at.Add(2 * time.Second))
+		topics, _ = fake.take(t)
+		assert.Empty(t, topics, "nothing changed")
+	})
+
+	t.Run("Device Command", func(t *testing.T) {
+		require.NoError(t, fake.command("spBv1.0/plant/DCMD/gw/kiln", &sparkplugpb.Payload{Metrics: []*sparkplugpb.Payload_Metric{
+			{Alias: proto.Uint64(2), Value: &sparkplugpb.Payload_Metric_IntValue{IntValue: 55}},
+			{Name: proto.String("temp"), Value: &sparkplugpb.Payload_Metric_IntValue{IntValue: 0xFFFFFFFB}},
+		}}))
+		words, err := s.ReadDM(100, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{0xFFFB, 55}, words)
+
+		require.NoError(t, fake.command("spBv1.0/plant/DCMD/gw/kiln", &sparkplugpb.Payload{Metrics: []*sparkplugpb.Payload_Metric{
+			{Name: proto.String("flow"), Value: &sparkplugpb.Payload_Metric_FloatValue{FloatValue: 2.5}},
+		}}))
+		words, err = s.ReadDM(102, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []uint16{0, 0}, words, "rejected writes don't reach the PLC")
+		assert.Equal(t, []string{"kiln.setpoint=55", "kiln.temp=-5", "kiln.flow=2.5"}, authorized)
+		assert.False(t, heldLock, "the node isn't locked during writes")
+
+		require.NoError(t, fake.command("spBv1.0/plant/DCMD/gw/kiln", &sparkplugpb.Payload{Metrics: []*sparkplugpb.Payload_Metric{
+			{Name: proto.String("Device Control/Rebirth"), Value: &sparkplugpb.Payload_Metric_BooleanValue{BooleanValue: true}},
+		}}))
+		topics, _ := fake.take(t)
+		assert.Equal(t, []string{"spBv1.0/plant/DBIRTH/gw/kiln"}, topics)
+	})
+
+	t.Run("Node Rebirth", func(t *testing.T) {
+		require.NoError(t, fake.command("spBv1.0/plant/NCMD/gw", &sparkplugpb.Payload{Metrics: []*sparkplugpb.Payload_Metric{
+			{Name: proto.String("Node Control/Rebirth"), Value: &sparkplugpb.Payload_Metric_BooleanValue{BooleanValue: true}},
+		}}))
+		topics, payloads := fake.take(t)
+		require.Equal(t, []string{"spBv1.0/plant/NBIRTH/gw", "spBv1.0/plant/DBIRTH/gw/kiln"}, topics)
+		assert.Equal(t, uint64(0), payloads[0].GetSeq(), "the sequence restarts with NBIRTH")
+		assert.Equal(t, true, metricValues(payloads[0])["PLCs/kiln/Connected"])
+	})
+
+	t.Run("Device Death", func(t *testing.T) {
+		failed := []fins.TagValue{{Tag: tags[0], Err: fmt.Errorf("timeout")}, {Tag: tags[1], Err: fmt.Errorf("timeout")}}
+		require.NoError(t, node.Publish("kiln", failed, at.Add(3*time.Second)))
+		topics, payloads := fake.take(t)
+		require.Equal(t, []string{"spBv1.0/plant/DDEATH/gw/kiln", "spBv1.0/plant/NDATA/gw"}, topics)
+		assert.Equal(t, map[string]any{"PLCs/kiln/Connected": false}, metricValues(payloads[1]))
+
+		require.NoError(t, node.Publish("kiln", failed, at.Add(4*time.Second)))
+		topics, _ = fake.take(t)
+		assert.Empty(t, topics, "a dead device dies once")
+	})
+
+	t.Run("Reconnect", func(t *testing.T) {
+		fake.reconnect()
+		var will sparkplugpb.Payload
+		require.NoError(t, proto.Unmarshal(fake.opts.WillPayload, &will))
+		assert.Equal(t, map[string]any{"bdSeq": uint64(1)}, metricValues(&will), "every session has its own bdSeq")
+
+		topics, payloads := fake.take(t)
+		require.Equal(t, []string{"spBv1.0/plant/NBIRTH/gw"}, topics, "dead devices aren't born")
+		assert.Equal(t, uint64(1), metricValues(payloads[0])["bdSeq"])
+
+		poll(at.Add(5 * time.Second))
+		topics, _ = fake.take(t)
+		assert.Equal(t, []string{"spBv1.0/plant/DBIRTH/gw/kiln", "spBv1.0/plant/NDATA/gw"}, topics)
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		require.NoError(t, node.Close())
+		topics, payloads := fake.take(t)
+		require.Equal(t, []string{"spBv1.0/plant/NDEATH/gw"}, topics)
+		assert.Equal(t, map[string]any{"bdSeq": uint64(1)}, metricValues(payloads[0]))
+		assert.False(t, fake.IsConnected())
+	})
+
+	_, err = sparkplug.NewEdgeNode(m, sparkplug.Options{GroupID: "plant/a", NodeID: "gw"})
+	assert.Error(t, err)
+	_, err = sparkplug.NewEdgeNode(m, sparkplug.Options{GroupID: "plant", NodeID: "gw", Tags: map[string][]fins.Tag{"press": nil}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,186 @@
+package fins
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"folke99/gofins/fins"
+	"folke99/gofins/mapping"
+	finsws "folke99/gofins/websocket"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func TestWebSocketServer(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	// Only the setpoint may be written
+	c.SetWriteGuard(func(w fins.MemoryWrite) error {
+		if w.Address.Address != 700 {
+			return fmt.Errorf("read-only address")
+		}
+		return nil
+	})
+
+	m := fins.NewManager(1)
+	m.Add("kiln", c)
+	setpoint := fins.Tag{Name: "setpoint", MemoryArea: mapping.MemoryAreaDMWord, Address: 700, DataType: fins.DataTypeUint}
+	actual := fins.Tag{Name: "actual", MemoryArea: mapping.MemoryAreaDMWord, Address: 701, DataType: fins.DataTypeUint}
+	server := httptest.NewServer(finsws.NewServer(m, finsws.Options{
+		Tags:     map[string][]fins.Tag{"kiln": {setpoint, actual}},
+		Interval: 20 * time.Millisecond,
+	}))
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	require.NoError(t, err)
+	defer ws.Close()
+	require.NoError(t, ws.SetDeadline(time.Now().Add(5*time.Second)))
+
+	receive := func() finsws.Message {
+		var msg finsws.Message
+		require.NoError(t, websocket.JSON.Receive(ws, &msg))
+		return msg
+	}
+
+	require.NoError(t, s.WriteDM(700, []uint16{10, 20}))
+	require.NoError(t, websocket.JSON.Send(ws, finsws.Message{Type: "subscribe", PLC: "kiln", Tags: []string{"actual"}}))
+	msg := receive()
+	assert.Equal(t, "update", msg.Type)
+	require.Len(t, msg.Values, 1, "only the subscribed tag is sent")
+	assert.Equal(t, finsws.TagReading{Tag: "actual", Value: 20}, msg.Values[0])
+
+	require.NoError(t, websocket.JSON.Send(ws, finsws.Message{Type: "write", ID: "1", PLC: "kiln", Tag: "setpoint", Value: wsValue(15)}))
+	msg = receive()
+	assert.Equal(t, finsws.Message{Type: "writeResult", ID: "1"}, msg)
+	words, err := s.ReadDM(700, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{15}, words)
+
+	require.NoError(t, websocket.JSON.Send(ws, finsws.Message{Type: "write", ID: "2", PLC: "kiln", Tag: "actual", Value: wsValue(1)}))
+	msg = receive()
+	assert.Equal(t, "2", msg.ID)
+	assert.Contains(t, msg.Error, "read-only address", "writes pass the write guard")
+
+	require.NoError(t, websocket.JSON.Send(ws, finsws.Message{Type: "write", ID: "3", PLC: "kiln", Tag: "setpoint"}))
+	msg = receive()
+	assert.Equal(t, finsws.Message{Type: "writeResult", ID: "3", Error: "write without a value"}, msg)
+	words, err = s.ReadDM(700, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{15}, words, "a missing value isn't written as 0")
+
+	require.NoError(t, websocket.JSON.Send(ws, finsws.Message{Type: "subscribe", PLC: "kiln", Tags: []string{"flow"}}))
+	msg = receive()
+	assert.Equal(t, "error", msg.Type)
+
+	require.NoError(t, s.WriteDM(701, []uint16{21}))
+	msg = receive()
+	assert.Equal(t, "update", msg.Type)
+	assert.Equal(t, []finsws.TagReading{{Tag: "actual", Value: 21}}, msg.Values)
+}
+
+func TestWebSocketSharedPoll(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	var reads atomic.Int64
+	c.Use(func(next fins.Sender) fins.Sender {
+		return fins.SenderFunc(func(command []byte) (*fins.Response, error) {
+			if binary.BigEndian.Uint16(command) == mapping.CommandCodeMemoryAreaRead {
+				reads.Add(1)
+			}
+			return next.SendCommand(command)
+		})
+	})
+
+	m := fins.NewManager(1)
+	m.Add("kiln", c)
+	actual := fins.Tag{Name: "actual", MemoryArea: mapping.MemoryAreaDMWord, Address: 701, DataType: fins.DataTypeUint}
+	interval := 20 * time.Millisecond
+	server := httptest.NewServer(finsws.NewServer(m, finsws.Options{
+		Tags:     map[string][]fins.Tag{"kiln": {actual}},
+		Interval: interval,
+	}))
+	defer server.Close()
+	require.NoError(t, s.WriteDM(701, []uint16{20}))
+
+	var conns []*websocket.Conn
+	for range 3 {
+		ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+		require.NoError(t, err)
+		defer ws.Close()
+		require.NoError(t, ws.SetDeadline(time.Now().Add(5*time.Second)))
+		require.NoError(t, websocket.JSON.Send(ws, finsws.Message{Type: "subscribe", PLC: "kiln"}))
+		conns = append(conns, ws)
+	}
+	for _, ws := range conns {
+		var msg finsws.Message
+		require.NoError(t, websocket.JSON.Receive(ws, &msg))
+		assert.Equal(t, []finsws.TagReading{{Tag: "actual", Value: 20}}, msg.Values)
+	}
+
+	// Polling per connection would read three times per interval
+	reads.Store(0)
+	time.Sleep(10 * interval)
+	assert.LessOrEqual(t, reads.Load(), int64(15), "the connections share one read per interval")
+
+	require.NoError(t, s.WriteDM(701, []uint16{21}))
+	for _, ws := range conns {
+		var msg finsws.Message
+		require.NoError(t, websocket.JSON.Receive(ws, &msg))
+		assert.Equal(t, []finsws.TagReading{{Tag: "actual", Value: 21}}, msg.Values)
+	}
+}
+
+func wsValue(v float64) *float64 {
+	return &v
+}
+
+func TestWebSocketAuthorize(t *testing.T) {
+	c, s, cleanup := setupTest(t)
+	defer cleanup()
+
+	m := fins.NewManager(1)
+	m.Add("kiln", c)
+	setpoint := fins.Tag{Name: "setpoint", MemoryArea: mapping.MemoryAreaDMWord, Address: 700, DataType: fins.DataTypeUint}
+	server := httptest.NewServer(finsws.NewServer(m, finsws.Options{
+		Tags: map[string][]fins.Tag{"kiln": {setpoint}},
+		Authorize: func(r *http.Request, plc string, tag fins.Tag, value float64) error {
+			if r.URL.Query().Get("role") != "operator" {
+				return fmt.Errorf("%s of %s needs the operator role", tag.Name, plc)
+			}
+			return nil
+		},
+	}))
+	defer server.Close()
+
+	write := func(query string) finsws.Message {
+		ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+query, "", server.URL)
+		require.NoError(t, err)
+		defer ws.Close()
+		require.NoError(t, ws.SetDeadline(time.Now().Add(5*time.Second)))
+		require.NoError(t, websocket.JSON.Send(ws, finsws.Message{Type: "write", ID: "1", PLC: "kiln", Tag: "setpoint", Value: wsValue(15)}))
+		var msg finsws.Message
+		require.NoError(t, websocket.JSON.Receive(ws, &msg))
+		return msg
+	}
+
+	assert.Equal(t, "setpoint of kiln needs the operator role", write("?role=viewer").Error)
+	words, err := s.ReadDM(700, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{0}, words, "the rejected write isn't sent")
+
+	assert.Empty(t, write("?role=operator").Error)
+	words, err = s.ReadDM(700, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{15}, words)
+}
@@ -0,0 +1,359 @@
+// Package websocket streams tag values of a fins.Manager to browser dashboards over WebSocket.
+//
+// The server serves a fixed tag table per PLC. Every connection selects the tags it wants
+// with subscribe messages and receives the values that changed as JSON, beyond the deadband
+// of the tag if it has one; it can write tags
+// of the table, the writes pass through the write guard and audit trail of the PLC client.
+// One poller reads the tags subscribed by any connection, so more connections don't add PLC
+// load.
+//
+// Messages from the browser:
+//
+//	{"type": "subscribe", "plc": "kiln", "tags": ["temp", "fan"]}  no tags selects all tags of the PLC
+//	{"type": "unsubscribe", "plc": "kiln"}
+//	{"type": "write", "id": "1", "plc": "kiln", "tag": "temp", "value": 812.5}
+//
+// Messages to the browser:
+//
+//	{"type": "update", "plc": "kiln", "time": "...", "values": [{"tag": "temp", "value": 812.5}]}
+//	{"type": "writeResult", "id": "1", "error": "..."}
+//	{"type": "error", "error": "..."}
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"folke99/gofins/fins"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	xwebsocket "golang.org/x/net/websocket"
+)
+
+const DEFAULT_INTERVAL = time.Second
+
+// Options configures a Server
+type Options struct {
+	// Tags is the tag table per PLC name, only these tags can be subscribed and written
+	Tags map[string][]fins.Tag
+	// Interval between reads of the subscribed tags.
+	// Default value: DEFAULT_INTERVAL
+	Interval time.Duration
+	// ReadOnly rejects all write messages
+	ReadOnly bool
+	// Authorize decides whether the connection opened by r may write value to tag of plc, a
+	// non-nil error rejects the write. It sees the request that opened the connection, e.g. to
+	// check its credentials, and the value, e.g. to check its range. All writes are authorized
+	// when nil.
+	Authorize func(r *http.Request, plc string, tag fins.Tag, value float64) error
+}
+
+// Server is an http.Handler accepting WebSocket connections
+type Server struct {
+	manager *fins.Manager
+	opts    Options
+
+	sync.Mutex
+	conns    map[*connection]struct{}
+	stopPoll context.CancelFunc // Stops the poller, nil while there are no connections
+}
+
+// Message is the JSON message exchanged with the browser, the fields used depend on Type
+type Message struct {
+	Type   string       `json:"type"`
+	ID     string       `json:"id,omitempty"`
+	PLC    string       `json:"plc,omitempty"`
+	Tags   []string     `json:"tags,omitempty"`
+	Tag    string       `json:"tag,omitempty"`
+	Value  *float64     `json:"value,omitempty"`
+	Time   *time.Time   `json:"time,omitempty"`
+	Values []TagReading `json:"values,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// TagReading is the value of one tag in an update
+type TagReading struct {
+	Tag   string  `json:"tag"`
+	Value float64 `json:"value"`
+	Error string  `json:"error,omitempty"`
+}
+
+// NewServer creates a WebSocket server for the tag table in opts
+func NewServer(m *fins.Manager, opts Options) *Server {
+	if opts.Interval <= 0 {
+		opts.Interval = DEFAULT_INTERVAL
+	}
+	return &Server{manager: m, opts: opts, conns: make(map[*connection]struct{})}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	xwebsocket.Handler(s.serveConn).ServeHTTP(w, r)
+}
+
+// connection is the state of one browser connection
+type connection struct {
+	server *Server
+	ws     *xwebsocket.Conn
+	sendMu sync.Mutex
+
+	sync.Mutex
+	subscriptions map[string][]fins.Tag // Selected tags per PLC
+	filters       map[string][]*fins.DeadbandFilter
+
+	results chan map[string][]fins.TagValue // Reads of the poller not handled yet
+}
+
+func (s *Server) serveConn(ws *xwebsocket.Conn) {
+	defer ws.Close()
+	c := &connection{
+		server:        s,
+		ws:            ws,
+		subscriptions: make(map[string][]fins.Tag),
+		filters:       make(map[string][]*fins.DeadbandFilter),
+		results:       make(chan map[string][]fins.TagValue, 1),
+	}
+
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+	go c.sendUpdates(ctx)
+	s.add(c)
+	defer s.remove(c)
+
+	for {
+		var msg Message
+		if err := xwebsocket.JSON.Receive(ws, &msg); err != nil {
+			return
+		}
+		c.handle(msg)
+	}
+}
+
+func (c *connection) handle(msg Message) {
+	switch msg.Type {
+	case "subscribe":
+		tags, err := c.server.selectTags(msg.PLC, msg.Tags)
+		if err != nil {
+			c.send(Message{Type: "error", Error: err.Error()})
+			return
+		}
+		c.Lock()
+		c.subscriptions[msg.PLC] = tags
+		delete(c.filters, msg.PLC)
+		c.Unlock()
+	case "unsubscribe":
+		c.Lock()
+		delete(c.subscriptions, msg.PLC)
+		delete(c.filters, msg.PLC)
+		c.Unlock()
+	case "write":
+		result := Message{Type: "writeResult", ID: msg.ID}
+		if err := c.write(msg); err != nil {
+			result.Error = err.Error()
+		}
+		c.send(result)
+	default:
+		c.send(Message{Type: "error", Error: fmt.Sprintf("unknown message type %q", msg.Type)})
+	}
+}
+
+// write writes a tag of the table, Authorize, the client write guard and audit trail apply.
+// The audit context records the remote address of the connection.
+func (c *connection) write(msg Message) error {
+	if c.server.opts.ReadOnly {
+		return fmt.Errorf("writes are disabled")
+	}
+	if msg.Value == nil {
+		return fmt.Errorf("write without a value")
+	}
+	tags, err := c.server.selectTags(msg.PLC, []string{msg.Tag})
+	if err != nil {
+		return err
+	}
+	if authorize := c.server.opts.Authorize; authorize != nil {
+		if err := authorize(c.ws.Request(), msg.PLC, tags[0], *msg.Value); err != nil {
+			return err
+		}
+	}
+	client, ok := c.server.manager.Client(msg.PLC)
+	if !ok {
+		return fmt.Errorf("unknown PLC %q", msg.PLC)
+	}
+	client = client.WithAuditContext(map[string]string{"remote": c.ws.Request().RemoteAddr})
+	return client.WriteTag(tags[0], *msg.Value)
+}
+
+// add registers a connection with the poller, starting it for the first connection
+func (s *Server) add(c *connection) {
+	s.Lock()
+	defer s.Unlock()
+	s.conns[c] = struct{}{}
+	if s.stopPoll == nil {
+		var ctx context.Context
+		ctx, s.stopPoll = context.WithCancel(context.Background())
+		go s.poll(ctx)
+	}
+}
+
+// remove unregisters a connection, stopping the poller after the last one
+func (s *Server) remove(c *connection) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.conns, c)
+	if len(s.conns) == 0 && s.stopPoll != nil {
+		s.stopPoll()
+		s.stopPoll = nil
+	}
+}
+
+// poll reads the tags subscribed by any connection every interval, each tag once, and hands
+// the values to the connections. A connection still sending the previous values skips them.
+func (s *Server) poll(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.Lock()
+		conns := make([]*connection, 0, len(s.conns))
+		for c := range s.conns {
+			conns = append(conns, c)
+		}
+		s.Unlock()
+
+		reads := make(map[string][]fins.Tag)
+		for _, c := range conns {
+			c.Lock()
+			for plc, tags := range c.subscriptions {
+				for _, t := range tags {
+					if !slices.ContainsFunc(reads[plc], func(r fins.Tag) bool { return sameTag(r, t) }) {
+						reads[plc] = append(reads[plc], t)
+					}
+				}
+			}
+			c.Unlock()
+		}
+		if len(reads) == 0 {
+			continue
+		}
+
+		results, _ := s.manager.ReadAll(ctx, reads)
+		if ctx.Err() != nil {
+			return
+		}
+		for _, c := range conns {
+			select {
+			case c.results <- results:
+			default:
+			}
+		}
+	}
+}
+
+// sendUpdates sends the values of the subscriptions that changed in the reads of the poller
+func (c *connection) sendUpdates(ctx context.Context) {
+	for {
+		var results map[string][]fins.TagValue
+		select {
+		case <-ctx.Done():
+			return
+		case results = <-c.results:
+		}
+
+		for _, update := range c.changes(results) {
+			if err := c.send(update); err != nil {
+				log.Printf("WebSocket send to %s failed: %v", c.ws.Request().RemoteAddr, err)
+				return
+			}
+		}
+	}
+}
+
+// changes returns an update per PLC with the subscribed values that changed beyond their
+// deadband since they were last reported. Subscriptions the reads don't cover, made during
+// the read, wait for the next reads.
+func (c *connection) changes(results map[string][]fins.TagValue) []Message {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	var updates []Message
+	for plc, tags := range c.subscriptions {
+		values := make([]fins.TagValue, 0, len(tags))
+		for _, t := range tags {
+			i := slices.IndexFunc(results[plc], func(v fins.TagValue) bool { return sameTag(v.Tag, t) })
+			if i < 0 {
+				break
+			}
+			values = append(values, results[plc][i])
+		}
+		if len(values) < len(tags) {
+			continue
+		}
+
+		filters, ok := c.filters[plc]
+		if !ok {
+			filters = make([]*fins.DeadbandFilter, len(tags))
+			for i, t := range tags {
+				filters[i] = fins.NewDeadbandFilter(t.Deadband)
+			}
+			c.filters[plc] = filters
+		}
+
+		update := Message{Type: "update", PLC: plc, Time: &now}
+		for i, v := range values {
+			if !filters[i].Report(v, now) {
+				continue
+			}
+			r := TagReading{Tag: v.Tag.Name, Value: v.Value}
+			if v.Err != nil {
+				r.Error = v.Err.Error()
+			}
+			update.Values = append(update.Values, r)
+		}
+		if len(update.Values) > 0 {
+			updates = append(updates, update)
+		}
+	}
+	slices.SortFunc(updates, func(a, b Message) int { return strings.Compare(a.PLC, b.PLC) })
+	return updates
+}
+
+func sameTag(a, b fins.Tag) bool {
+	return a.Name == b.Name
+}
+
+func (c *connection) send(msg Message) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return xwebsocket.JSON.Send(c.ws, msg)
+}
+
+// selectTags returns the tags of the table of plc with the given names, all tags when names is empty
+func (s *Server) selectTags(plc string, names []string) ([]fins.Tag, error) {
+	table, ok := s.opts.Tags[plc]
+	if !ok {
+		return nil, fmt.Errorf("unknown PLC %q", plc)
+	}
+	if len(names) == 0 {
+		return table, nil
+	}
+
+	tags := make([]fins.Tag, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(table, func(t fins.Tag) bool { return t.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown tag %q of PLC %q", name, plc)
+		}
+		tags = append(tags, table[i])
+	}
+	return tags, nil
+}